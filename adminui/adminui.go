@@ -0,0 +1,36 @@
+// Package adminui embeds the static admin console served at /admin/ui.
+package adminui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the console's HTML, CSS and JavaScript.
+func Handler() fiber.Handler {
+	root, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	serve := filesystem.New(filesystem.Config{
+		Root:   http.FS(root),
+		Index:  "index.html",
+		MaxAge: 300,
+	})
+
+	return func(c *fiber.Ctx) error {
+		// The page links its assets relatively, which needs the trailing slash
+		if c.Path() == c.Route().Path {
+			return c.Redirect(c.Path()+"/", fiber.StatusMovedPermanently)
+		}
+		return serve(c)
+	}
+}
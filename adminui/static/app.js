@@ -0,0 +1,294 @@
+// The console is served from <base>/admin/ui/, so the API lives at <base>/api/v1.
+const apiBase = location.pathname.replace(/\/admin\/ui(\/.*)?$/, '') + '/api/v1';
+const $ = (id) => document.getElementById(id);
+
+let currentUser = null;
+
+async function api(method, path, body) {
+  const response = await fetch(apiBase + path, {
+    method,
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': 'Bearer ' + (sessionStorage.getItem('adminToken') || ''),
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const data = await response.json().catch(() => ({}));
+  if (response.status === 401 || response.status === 403) {
+    signOut();
+  }
+  if (!response.ok) {
+    const fields = data.fields ? ': ' + Object.entries(data.fields).map(([k, v]) => `${k} ${v}`).join(', ') : '';
+    throw new Error((data.error || response.statusText) + fields);
+  }
+  return data;
+}
+
+function show(message, isError) {
+  $('message').textContent = message;
+  $('message').className = isError ? 'error' : '';
+}
+
+function signOut() {
+  sessionStorage.removeItem('adminToken');
+  challengeToken = null;
+  $('code-label').hidden = true;
+  $('console').hidden = true;
+  $('sign-out').hidden = true;
+  $('sign-in').hidden = false;
+}
+
+function signedIn() {
+  $('sign-in').hidden = true;
+  $('console').hidden = false;
+  $('sign-out').hidden = false;
+  loadAnnouncements();
+  loadFeatureFlags();
+}
+
+// Accounts with two-factor authentication answer the password with a
+// challenge; the second submit sends it with the code.
+let challengeToken = null;
+
+$('sign-in-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  try {
+    const data = challengeToken
+      ? await api('POST', '/auth/2fa/verify', { challenge_token: challengeToken, code: $('code').value })
+      : await api('POST', '/auth/login', { email: $('email').value, password: $('password').value });
+    if (data.two_factor_required) {
+      challengeToken = data.challenge_token;
+      $('code-label').hidden = false;
+      $('code').required = true;
+      show('Enter the code from your authenticator app');
+      return;
+    }
+
+    challengeToken = null;
+    sessionStorage.setItem('adminToken', data.token);
+    await api('GET', '/admin/audit-logs?limit=1');
+    signedIn();
+    show('');
+  } catch (err) {
+    show(err.message, true);
+  }
+});
+
+$('sign-out').addEventListener('click', signOut);
+
+$('search-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  try {
+    const data = await api('GET', '/admin/search?q=' + encodeURIComponent($('query').value));
+    const list = $('results');
+    list.replaceChildren();
+    for (const result of data.results.filter((r) => r.type === 'user')) {
+      const item = document.createElement('li');
+      item.textContent = `${result.title} — ${result.subtitle}`;
+      item.addEventListener('click', () => loadUser(result.id));
+      list.append(item);
+    }
+    show(data.results.length ? '' : 'No matches');
+  } catch (err) {
+    show(err.message, true);
+  }
+});
+
+async function loadUser(id) {
+  try {
+    const { user } = await api('GET', `/admin/users/${id}`);
+    currentUser = user;
+    $('user-title').textContent = `${user.first_name} ${user.last_name}`;
+    $('user-email').textContent = user.email;
+    $('user-membership').textContent = user.membership_id;
+    $('user-phone').textContent = user.phone || '—';
+    $('user-points').textContent = user.points;
+    $('first-name').value = user.first_name;
+    $('last-name').value = user.last_name;
+    $('member-level').value = user.member_level;
+    $('user').hidden = false;
+
+    const { items: logs } = await api('GET', `/admin/audit-logs?filter[resource]=users&filter[resource_id]=${id}&limit=20`);
+    const rows = $('audit');
+    rows.replaceChildren();
+    for (const log of logs) {
+      const row = document.createElement('tr');
+      for (const value of [new Date(log.created_at).toLocaleString(), log.actor, log.action, (log.fields || []).join(', ')]) {
+        const cell = document.createElement('td');
+        cell.textContent = value;
+        row.append(cell);
+      }
+      rows.append(row);
+    }
+  } catch (err) {
+    show(err.message, true);
+  }
+}
+
+async function patchUser(fields) {
+  await api('PATCH', `/admin/users/${currentUser.id}`, {
+    update_mask: Object.keys(fields),
+    user: fields,
+  });
+  await loadUser(currentUser.id);
+}
+
+// Points are adjusted by the difference, which the server adds to the
+// balance as it stands, so adjustments made at the same time all count.
+$('points-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const button = event.submitter;
+  button.disabled = true;
+  try {
+    const entry = await api('POST', `/admin/users/${currentUser.id}/points/adjustments`, {
+      amount: Number($('points-delta').value),
+      reason: $('points-reason').value,
+    });
+    $('points-delta').value = '';
+    $('points-reason').value = '';
+    await loadUser(currentUser.id);
+    show(`Points adjusted to ${entry.balance_after}`);
+  } catch (err) {
+    show(err.message, true);
+  } finally {
+    button.disabled = false;
+  }
+});
+
+$('profile-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  try {
+    await patchUser({
+      first_name: $('first-name').value,
+      last_name: $('last-name').value,
+      member_level: $('member-level').value,
+    });
+    show('Saved');
+  } catch (err) {
+    show(err.message, true);
+  }
+});
+
+function row(values, ...buttons) {
+  const tr = document.createElement('tr');
+  for (const value of values) {
+    const cell = document.createElement('td');
+    cell.textContent = value;
+    tr.append(cell);
+  }
+  const actions = document.createElement('td');
+  for (const [label, onClick] of buttons) {
+    const button = document.createElement('button');
+    button.type = 'button';
+    button.textContent = label;
+    button.addEventListener('click', async () => {
+      try {
+        await onClick();
+      } catch (err) {
+        show(err.message, true);
+      }
+    });
+    actions.append(button);
+  }
+  tr.append(actions);
+  return tr;
+}
+
+// datetime-local inputs hold local times without a zone.
+const toInput = (time) => (time ? new Date(new Date(time).getTime() - new Date(time).getTimezoneOffset() * 60000).toISOString().slice(0, 16) : '');
+const fromInput = (value) => (value ? new Date(value).toISOString() : undefined);
+
+let editedAnnouncement = null;
+
+async function loadAnnouncements() {
+  try {
+    const { items } = await api('GET', '/admin/announcements?limit=100');
+    $('announcements').replaceChildren(...items.map((item) => row(
+      [item.title, new Date(item.starts_at).toLocaleString(), item.ends_at ? new Date(item.ends_at).toLocaleString() : '—'],
+      ['Edit', () => editAnnouncement(item)],
+      ['Delete', async () => {
+        if (!confirm(`Delete "${item.title}"?`)) return;
+        await api('DELETE', `/admin/announcements/${item.id}`);
+        await loadAnnouncements();
+        show('Announcement deleted');
+      }],
+    )));
+  } catch (err) {
+    show(err.message, true);
+  }
+}
+
+function editAnnouncement(item) {
+  editedAnnouncement = item;
+  $('announcement-form-title').textContent = item ? 'Edit announcement' : 'New announcement';
+  $('announcement-title').value = item ? item.title : '';
+  $('announcement-body').value = item ? item.body : '';
+  $('announcement-starts').value = item ? toInput(item.starts_at) : '';
+  $('announcement-ends').value = item ? toInput(item.ends_at) : '';
+  $('announcement-cancel').hidden = !item;
+}
+
+$('announcement-cancel').addEventListener('click', () => editAnnouncement(null));
+
+$('announcement-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const fields = {
+    title: $('announcement-title').value,
+    body: $('announcement-body').value,
+    starts_at: fromInput($('announcement-starts').value),
+    ends_at: fromInput($('announcement-ends').value),
+  };
+  try {
+    if (editedAnnouncement) {
+      await api('PATCH', `/admin/announcements/${editedAnnouncement.id}`, fields);
+    } else {
+      await api('POST', '/admin/announcements', fields);
+    }
+    editAnnouncement(null);
+    await loadAnnouncements();
+    show('Announcement saved');
+  } catch (err) {
+    show(err.message, true);
+  }
+});
+
+async function loadFeatureFlags() {
+  try {
+    const flags = await api('GET', '/admin/feature-flags');
+    $('feature-flags').replaceChildren(...flags.map((flag) => row(
+      [flag.key, flag.description, flag.enabled ? 'Yes' : 'No'],
+      [flag.enabled ? 'Disable' : 'Enable', async () => {
+        await api('PUT', `/admin/feature-flags/${flag.key}`, { enabled: !flag.enabled, description: flag.description });
+        await loadFeatureFlags();
+        show(`${flag.key} ${flag.enabled ? 'disabled' : 'enabled'}`);
+      }],
+      ['Delete', async () => {
+        if (!confirm(`Delete ${flag.key}?`)) return;
+        await api('DELETE', `/admin/feature-flags/${flag.key}`);
+        await loadFeatureFlags();
+        show('Feature flag deleted');
+      }],
+    )));
+  } catch (err) {
+    show(err.message, true);
+  }
+}
+
+$('feature-flag-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  try {
+    await api('PUT', `/admin/feature-flags/${$('feature-flag-key').value}`, {
+      enabled: $('feature-flag-enabled').checked,
+      description: $('feature-flag-description').value,
+    });
+    event.target.reset();
+    await loadFeatureFlags();
+    show('Feature flag saved');
+  } catch (err) {
+    show(err.message, true);
+  }
+});
+
+if (sessionStorage.getItem('adminToken')) {
+  signedIn();
+}
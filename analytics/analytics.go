@@ -0,0 +1,305 @@
+// Package analytics exports the loyalty data to the analytics warehouse as
+// Parquet files, so analysts query copies rather than the production
+// database. The export job writes, for the day that ended, a snapshot of the
+// member dimension and the day's points ledger entries and domain events,
+// catching up on every day missed since the last run.
+//
+// Files are laid out as Hive partitions that BigQuery, Athena and Spark read
+// as one table per dataset:
+//
+//	<prefix><dataset>/v<version>/dt=2026-10-14/part-00000.parquet
+//
+// next to a _schema.json with the columns. The schema of a dataset only
+// grows: columns added to the code are appended, and columns dropped from it
+// are still written, as null, so the files of every day read with the same
+// schema. A column cannot change type within a version; the dataset's
+// version has to be raised, which exports it again under v<version+1>.
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/parquet"
+	"temp-backend-at-kbtg/storage"
+
+	"gorm.io/gorm"
+)
+
+// dayLayout is the format of the dt partition and of ExportedThrough.
+const dayLayout = "2006-01-02"
+
+// Exporter writes the datasets to a store.
+type Exporter struct {
+	store  storage.Service
+	prefix string
+	// batchSize is the most rows a file holds; a partition with more is
+	// split into parts
+	batchSize int
+}
+
+// New returns an exporter writing to the destination in cfg: a directory
+// with the local driver, a bucket of S3 or a compatible service, such as
+// Google Cloud Storage for BigQuery, with s3.
+func New(cfg config.AnalyticsConfig) *Exporter {
+	var store storage.Service = &storage.Local{Dir: cfg.Dir}
+	if cfg.Driver == "s3" {
+		store = storage.NewS3(cfg.S3, "")
+	}
+	return &Exporter{store: store, prefix: cfg.Prefix, batchSize: cfg.BatchSize}
+}
+
+// NewWithStore returns an exporter writing to store, for tests.
+func NewWithStore(store storage.Service, prefix string, batchSize int) *Exporter {
+	return &Exporter{store: store, prefix: prefix, batchSize: batchSize}
+}
+
+// Default is the exporter of the scheduled job. It writes to ./analytics-data
+// until Init configures it.
+var Default = New(config.Default().Analytics)
+
+// Init sets Default to the destination in cfg.
+func Init(cfg config.AnalyticsConfig) {
+	Default = New(cfg)
+}
+
+// Run exports every dataset through the day before now, in UTC. A dataset
+// that fails does not stop the others; it resumes from its last exported
+// day on the next run.
+func (e *Exporter) Run(ctx context.Context, db *gorm.DB, now time.Time) error {
+	through := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	var errs []error
+	for _, ds := range datasets {
+		if err := e.export(ctx, db.WithContext(ctx), ds, through); err != nil {
+			errs = append(errs, fmt.Errorf("analytics: %s: %w", ds.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// export brings ds up to date through the day through.
+func (e *Exporter) export(ctx context.Context, db *gorm.DB, ds dataset, through time.Time) error {
+	state, err := e.prepare(ctx, db, ds)
+	if err != nil {
+		return err
+	}
+
+	var from time.Time
+	switch {
+	case state.ExportedThrough != "":
+		last, err := time.Parse(dayLayout, state.ExportedThrough)
+		if err != nil {
+			return err
+		}
+		from = last.AddDate(0, 0, 1)
+	case ds.dayColumn == "":
+		from = through
+	default:
+		// The first export starts with the first day that has rows
+		var first []time.Time
+		err := db.Model(ds.model).Order(ds.dayColumn).Limit(1).Pluck(ds.dayColumn, &first).Error
+		if err != nil || len(first) == 0 {
+			return err
+		}
+		from = first[0].UTC().Truncate(24 * time.Hour)
+	}
+	if ds.dayColumn == "" && from.Before(through) {
+		// Past snapshots cannot be taken any more
+		from = through
+	}
+
+	for day := from; !day.After(through); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		query := db
+		if ds.dayColumn != "" {
+			query = db.Where(ds.dayColumn+" >= ? AND "+ds.dayColumn+" < ?", day, day.AddDate(0, 0, 1))
+		}
+		rows, err := e.writePartition(ctx, query, ds, state, day.Format(dayLayout))
+		if err != nil {
+			return fmt.Errorf("%s: %w", day.Format(dayLayout), err)
+		}
+		state.ExportedThrough = day.Format(dayLayout)
+		if err := db.Save(state).Error; err != nil {
+			return err
+		}
+		log.Printf("[analytics] exported %d rows of %s for %s", rows, ds.name, state.ExportedThrough)
+	}
+	return nil
+}
+
+// prepare loads the state of ds and brings its published schema up to date
+// with the code, writing the new _schema.json when it changed.
+func (e *Exporter) prepare(ctx context.Context, db *gorm.DB, ds dataset) (*models.AnalyticsExport, error) {
+	var state models.AnalyticsExport
+	if err := db.Where("dataset = ?", ds.name).Limit(1).Find(&state).Error; err != nil {
+		return nil, err
+	}
+	if state.Dataset == "" || state.Version != ds.version {
+		// A new version is a new table, exported from the start
+		state = models.AnalyticsExport{Dataset: ds.name, Version: ds.version}
+	}
+
+	columns, changed, err := evolve(state.Columns, ds.columns)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &state, nil
+	}
+	state.Columns = columns
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"dataset":     ds.name,
+		"version":     ds.version,
+		"columns":     columns,
+		"partitioned": "dt",
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	key := e.tablePath(ds.name, ds.version) + "/_schema.json"
+	if err := e.store.Put(ctx, key, "application/json", bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return nil, err
+	}
+	if err := db.Save(&state).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[analytics] published the schema of %s v%d with %d columns", ds.name, ds.version, len(columns))
+	return &state, nil
+}
+
+// evolve returns the columns the files of a dataset published with
+// published are written with now that the code has code: published with the
+// new columns of code appended. A column whose type differs is an error.
+func evolve(published []models.AnalyticsColumn, code []parquet.Column) ([]models.AnalyticsColumn, bool, error) {
+	types := make(map[string]string, len(published))
+	for _, c := range published {
+		types[c.Name] = c.Type
+	}
+	columns := append([]models.AnalyticsColumn(nil), published...)
+	for _, c := range code {
+		typ, ok := types[c.Name]
+		switch {
+		case !ok:
+			columns = append(columns, models.AnalyticsColumn{Name: c.Name, Type: string(c.Type)})
+		case typ != string(c.Type):
+			return nil, false, fmt.Errorf("column %s changed from %s to %s; raise the dataset's version", c.Name, typ, c.Type)
+		}
+	}
+	return columns, len(columns) != len(published), nil
+}
+
+// writePartition writes the rows of ds that query selects to the partition
+// of day, as many files as batchSize requires, and returns how many rows
+// there were. A partition without rows gets no file.
+func (e *Exporter) writePartition(ctx context.Context, query *gorm.DB, ds dataset, state *models.AnalyticsExport, day string) (int, error) {
+	columns := make([]parquet.Column, len(state.Columns))
+	// at maps the columns of the code to those of the files
+	at := make(map[string]int, len(state.Columns))
+	for i, c := range state.Columns {
+		columns[i] = parquet.Column{Name: c.Name, Type: parquet.Type(c.Type)}
+		at[c.Name] = i
+	}
+	positions := make([]int, len(ds.columns))
+	for i, c := range ds.columns {
+		positions[i] = at[c.Name]
+	}
+
+	part := &partWriter{exporter: e, columns: columns, dir: e.tablePath(ds.name, state.Version) + "/dt=" + day}
+	defer part.abort()
+	rows := 0
+	err := ds.rows(query, func(values ...interface{}) error {
+		row := make([]interface{}, len(columns))
+		for i, v := range values {
+			row[positions[i]] = v
+		}
+		rows++
+		return part.write(ctx, row)
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, part.finish(ctx)
+}
+
+// tablePath is the prefix of the files of version of dataset.
+func (e *Exporter) tablePath(dataset string, version int) string {
+	return fmt.Sprintf("%s%s/v%d", e.prefix, dataset, version)
+}
+
+// partWriter writes the files of a partition: rows go to a temporary file,
+// which is uploaded as the next part once it has batchSize rows or the
+// partition ends.
+type partWriter struct {
+	exporter *Exporter
+	columns  []parquet.Column
+	dir      string
+	part     int
+	rows     int
+	file     *os.File
+	writer   *parquet.Writer
+}
+
+func (p *partWriter) write(ctx context.Context, row []interface{}) error {
+	if p.writer == nil {
+		file, err := os.CreateTemp("", "analytics-*.parquet")
+		if err != nil {
+			return err
+		}
+		p.file = file
+		if p.writer, err = parquet.NewWriter(file, p.columns); err != nil {
+			return err
+		}
+	}
+	if err := p.writer.WriteRow(row...); err != nil {
+		return err
+	}
+	p.rows++
+	if p.rows == p.exporter.batchSize {
+		return p.finish(ctx)
+	}
+	return nil
+}
+
+// finish uploads the current part, if it has rows.
+func (p *partWriter) finish(ctx context.Context) error {
+	if p.writer == nil {
+		return nil
+	}
+	defer p.abort()
+	if err := p.writer.Close(); err != nil {
+		return err
+	}
+	size, err := p.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/part-%05d.parquet", p.dir, p.part)
+	if err := p.exporter.store.Put(ctx, key, parquet.ContentType, p.file, size); err != nil {
+		return err
+	}
+	p.part++
+	return nil
+}
+
+// abort drops the current part's temporary file.
+func (p *partWriter) abort() {
+	if p.file != nil {
+		p.file.Close()
+		os.Remove(p.file.Name())
+	}
+	p.file, p.writer, p.rows = nil, nil, 0
+}
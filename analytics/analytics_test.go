@@ -0,0 +1,126 @@
+package analytics_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/analytics"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/storage"
+	"temp-backend-at-kbtg/testutil"
+)
+
+// files lists the files under dir, relative to it.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRun(t *testing.T) {
+	db := testutil.NewDB(t)
+	user := testutil.CreateUser(t, db, testutil.WithPoints(500))
+	earned := testutil.CreateTransaction(t, db, &user)
+	redeemed := testutil.CreateTransaction(t, db, &user, testutil.Redeemed(250))
+
+	// The member joined and earned on the 12th and redeemed on the 13th;
+	// the export runs on the 15th
+	now := time.Date(2026, 10, 15, 1, 0, 0, 0, time.UTC)
+	first := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+	second := time.Date(2026, 10, 13, 18, 0, 0, 0, time.UTC)
+	db.Model(&models.PointTransaction{}).Where("id = ?", earned.ID).Update("created_at", first)
+	db.Model(&models.PointTransaction{}).Where("id = ?", redeemed.ID).Update("created_at", second)
+	db.Model(&models.DomainEvent{}).Where("user_id = ? AND version < 3", user.ID).Update("occurred_at", first)
+	db.Model(&models.DomainEvent{}).Where("user_id = ? AND version = 3", user.ID).Update("occurred_at", second)
+	var members int64
+	db.Model(&models.User{}).Count(&members)
+
+	dir := t.TempDir()
+	// One row per file, so the parts count the rows
+	exporter := analytics.NewWithStore(&storage.Local{Dir: dir}, "loyalty/", 1)
+	if err := exporter.Run(context.Background(), db, now); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	got := files(t, dir)
+	want := []string{
+		"loyalty/domain_events/v1/_schema.json",
+		"loyalty/domain_events/v1/dt=2026-10-12/part-00000.parquet",
+		"loyalty/domain_events/v1/dt=2026-10-12/part-00001.parquet",
+		"loyalty/domain_events/v1/dt=2026-10-13/part-00000.parquet",
+		"loyalty/point_transactions/v1/_schema.json",
+		"loyalty/point_transactions/v1/dt=2026-10-12/part-00000.parquet",
+		"loyalty/point_transactions/v1/dt=2026-10-13/part-00000.parquet",
+		"loyalty/users/v1/_schema.json",
+	}
+	for i := int64(0); i < members; i++ {
+		want = append(want, fmt.Sprintf("loyalty/users/v1/dt=2026-10-14/part-%05d.parquet", i))
+	}
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "loyalty/point_transactions/v1/dt=2026-10-12/part-00000.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "PAR1") || !strings.HasSuffix(string(data), "PAR1") {
+		t.Error("part is not a Parquet file")
+	}
+
+	var schema struct {
+		Version int                      `json:"version"`
+		Columns []models.AnalyticsColumn `json:"columns"`
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "loyalty/users/v1/_schema.json"))
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	if schema.Version != 1 || len(schema.Columns) == 0 || schema.Columns[0] != (models.AnalyticsColumn{Name: "id", Type: "INT64"}) {
+		t.Errorf("users schema = %+v", schema)
+	}
+	for _, c := range schema.Columns {
+		if c.Name == "email" || c.Name == "phone" || c.Name == "name" {
+			t.Errorf("users schema has PII column %s", c.Name)
+		}
+	}
+
+	var states []models.AnalyticsExport
+	db.Order("dataset").Find(&states)
+	if len(states) != 3 {
+		t.Fatalf("%d export states, want 3", len(states))
+	}
+	for _, s := range states {
+		if s.ExportedThrough != "2026-10-14" {
+			t.Errorf("%s exported through %q, want 2026-10-14", s.Dataset, s.ExportedThrough)
+		}
+	}
+
+	// A second run on the same day has nothing left to export
+	if err := exporter.Run(context.Background(), db, now.Add(time.Hour)); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if again := files(t, dir); len(again) != len(got) {
+		t.Errorf("second run wrote %d files, want none", len(again)-len(got))
+	}
+}
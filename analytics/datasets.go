@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/parquet"
+
+	"gorm.io/gorm"
+)
+
+// readBatch is how many rows a dataset reads from the database at a time.
+const readBatch = 1000
+
+// dataset is a table of the export.
+type dataset struct {
+	name string
+	// version is raised to change the type of a column; the dataset is then
+	// exported again as a new table
+	version int
+	columns []parquet.Column
+	model   interface{}
+	// dayColumn is the time that puts a row in the partition of its day.
+	// Without one the dataset is a snapshot of the whole table, taken for
+	// the day that just ended.
+	dayColumn string
+	// rows calls emit with the values of the columns for each row query
+	// selects
+	rows func(query *gorm.DB, emit func(values ...interface{}) error) error
+}
+
+// datasets are exported in this order. Members' names, email addresses and
+// phone numbers are left out; analysts join on the user ID.
+var datasets = []dataset{
+	{
+		name:    "users",
+		version: 1,
+		columns: []parquet.Column{
+			{Name: "id", Type: parquet.Int64},
+			{Name: "membership_id", Type: parquet.String},
+			{Name: "member_level", Type: parquet.String},
+			{Name: "points", Type: parquet.Int64},
+			{Name: "role", Type: parquet.String},
+			{Name: "email_verified", Type: parquet.Bool},
+			{Name: "phone_verified", Type: parquet.Bool},
+			{Name: "terms_version", Type: parquet.String},
+			{Name: "suspended", Type: parquet.Bool},
+			{Name: "created_at", Type: parquet.Timestamp},
+			{Name: "deleted_at", Type: parquet.Timestamp},
+		},
+		model: &models.User{},
+		rows: func(query *gorm.DB, emit func(values ...interface{}) error) error {
+			var users []models.User
+			return query.Unscoped().
+				Select("id", "membership_id", "member_level", "points", "role", "email_verified_at", "phone_verified_at",
+					"accepted_terms_version", "suspended_at", "created_at", "deleted_at").
+				FindInBatches(&users, readBatch, func(*gorm.DB, int) error {
+					for _, u := range users {
+						var deletedAt interface{}
+						if u.DeletedAt.Valid {
+							deletedAt = u.DeletedAt.Time
+						}
+						err := emit(u.ID, u.MembershipID, u.MemberLevel, u.Points, u.Role, u.EmailVerifiedAt != nil, u.PhoneVerifiedAt != nil,
+							u.AcceptedTermsVersion, u.SuspendedAt != nil, u.CreatedAt, deletedAt)
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				}).Error
+		},
+	},
+	{
+		name:    "point_transactions",
+		version: 1,
+		columns: []parquet.Column{
+			{Name: "id", Type: parquet.Int64},
+			{Name: "user_id", Type: parquet.Int64},
+			{Name: "type", Type: parquet.String},
+			{Name: "amount", Type: parquet.Int64},
+			{Name: "balance_after", Type: parquet.Int64},
+			{Name: "reason", Type: parquet.String},
+			{Name: "reference", Type: parquet.String},
+			{Name: "expires_at", Type: parquet.Timestamp},
+			{Name: "created_at", Type: parquet.Timestamp},
+		},
+		model:     &models.PointTransaction{},
+		dayColumn: "created_at",
+		rows: func(query *gorm.DB, emit func(values ...interface{}) error) error {
+			var entries []models.PointTransaction
+			return query.FindInBatches(&entries, readBatch, func(*gorm.DB, int) error {
+				for _, e := range entries {
+					if err := emit(e.ID, e.UserID, e.Type, e.Amount, e.BalanceAfter, e.Reason, e.Reference, e.ExpiresAt, e.CreatedAt); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		},
+	},
+	{
+		name:    "domain_events",
+		version: 1,
+		columns: []parquet.Column{
+			{Name: "id", Type: parquet.Int64},
+			{Name: "user_id", Type: parquet.Int64},
+			{Name: "version", Type: parquet.Int64},
+			{Name: "type", Type: parquet.String},
+			{Name: "occurred_at", Type: parquet.Timestamp},
+			{Name: "points", Type: parquet.Int64},
+			{Name: "amount", Type: parquet.Int64},
+			{Name: "transaction_id", Type: parquet.Int64},
+			{Name: "from_tier", Type: parquet.String},
+			{Name: "to_tier", Type: parquet.String},
+			{Name: "reason", Type: parquet.String},
+			{Name: "reference", Type: parquet.String},
+		},
+		model:     &models.DomainEvent{},
+		dayColumn: "occurred_at",
+		rows: func(query *gorm.DB, emit func(values ...interface{}) error) error {
+			var events []models.DomainEvent
+			return query.FindInBatches(&events, readBatch, func(*gorm.DB, int) error {
+				for _, e := range events {
+					var transactionID interface{}
+					if e.Data.TransactionID != 0 {
+						transactionID = e.Data.TransactionID
+					}
+					err := emit(e.ID, e.UserID, e.Version, e.Type, e.OccurredAt, e.Data.Points, e.Data.Amount, transactionID,
+						e.Data.FromTier, e.Data.ToTier, e.Data.Reason, e.Data.Reference)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		},
+	},
+}
@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/parquet"
+)
+
+func TestEvolve(t *testing.T) {
+	published := []models.AnalyticsColumn{{Name: "id", Type: "INT64"}, {Name: "reason", Type: "STRING"}}
+	tests := []struct {
+		name        string
+		published   []models.AnalyticsColumn
+		code        []parquet.Column
+		want        []models.AnalyticsColumn
+		wantChanged bool
+		wantErr     bool
+	}{
+		{
+			name:        "first export",
+			code:        []parquet.Column{{Name: "id", Type: parquet.Int64}},
+			want:        []models.AnalyticsColumn{{Name: "id", Type: "INT64"}},
+			wantChanged: true,
+		},
+		{
+			name:      "unchanged",
+			published: published,
+			code:      []parquet.Column{{Name: "id", Type: parquet.Int64}, {Name: "reason", Type: parquet.String}},
+			want:      published,
+		},
+		{
+			name:        "added column is appended",
+			published:   published,
+			code:        []parquet.Column{{Name: "id", Type: parquet.Int64}, {Name: "channel", Type: parquet.String}, {Name: "reason", Type: parquet.String}},
+			want:        append(published[:2:2], models.AnalyticsColumn{Name: "channel", Type: "STRING"}),
+			wantChanged: true,
+		},
+		{
+			name:      "dropped column is kept",
+			published: published,
+			code:      []parquet.Column{{Name: "id", Type: parquet.Int64}},
+			want:      published,
+		},
+		{
+			name:      "changed type",
+			published: published,
+			code:      []parquet.Column{{Name: "id", Type: parquet.String}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := evolve(tt.published, tt.code)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || changed != tt.wantChanged {
+				t.Errorf("evolve = %v, %v; want %v, %v", got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
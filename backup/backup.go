@@ -0,0 +1,298 @@
+// Package backup writes encrypted, verified snapshots of the SQLite database
+// and restores them.
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	filePrefix = "backup-"
+	fileSuffix = ".db.enc"
+	timeLayout = "20060102-150405"
+	saltSize   = 16
+)
+
+// magic starts every backup file and is authenticated with the contents.
+var magic = []byte("LBKBACKUP1")
+
+var (
+	ErrNoKey       = errors.New("backup.key (BACKUP_KEY) must be set to encrypt and decrypt backups")
+	ErrNoBackup    = errors.New("no backup found")
+	ErrCorrupt     = errors.New("backup is corrupt or was encrypted with a different key")
+	ErrNotVerified = errors.New("backup failed the integrity check")
+	ErrNotSQLite   = errors.New("backups only cover SQLite databases; use the database's own tools, e.g. pg_dump")
+)
+
+// Create snapshots db with VACUUM INTO, which gives a consistent copy while
+// the server keeps running, encrypts it into cfg.Dir, verifies that it
+// decrypts to a sound database and removes backups beyond cfg.Keep.
+func Create(db *gorm.DB, cfg config.BackupConfig) (models.BackupInfo, error) {
+	if cfg.Key == "" {
+		return models.BackupInfo{}, ErrNoKey
+	}
+	if db.Dialector.Name() != "sqlite" {
+		return models.BackupInfo{}, ErrNotSQLite
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return models.BackupInfo{}, err
+	}
+
+	now := time.Now()
+	name := filePrefix + now.Format(timeLayout) + fileSuffix
+	snapshot := filepath.Join(cfg.Dir, "."+name+".snapshot")
+	defer os.Remove(snapshot)
+
+	if err := db.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return models.BackupInfo{}, fmt.Errorf("snapshot: %w", err)
+	}
+	plain, err := os.ReadFile(snapshot)
+	if err != nil {
+		return models.BackupInfo{}, err
+	}
+	sealed, err := encrypt(plain, cfg.Key)
+	if err != nil {
+		return models.BackupInfo{}, err
+	}
+
+	path := filepath.Join(cfg.Dir, name)
+	if err := writeFileAtomic(path, sealed); err != nil {
+		return models.BackupInfo{}, err
+	}
+	if err := Verify(path, cfg.Key); err != nil {
+		os.Remove(path)
+		return models.BackupInfo{}, err
+	}
+	if _, err := Rotate(cfg.Dir, cfg.Keep); err != nil {
+		return models.BackupInfo{}, err
+	}
+
+	return models.BackupInfo{Name: name, Size: int64(len(sealed)), CreatedAt: now}, nil
+}
+
+// Verify decrypts a backup to a temporary file and runs SQLite's integrity
+// check on it.
+func Verify(path, key string) error {
+	tmp, err := decryptToTemp(path, key, os.TempDir())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return checkDatabase(tmp)
+}
+
+// Restore verifies a backup and atomically replaces the SQLite database file
+// at dst with it. The server must not be running against dst.
+func Restore(path, key, dst string) error {
+	tmp, err := decryptToTemp(path, key, filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := checkDatabase(tmp); err != nil {
+		return err
+	}
+
+	// Leftover WAL files belong to the old database
+	os.Remove(dst + "-wal")
+	os.Remove(dst + "-shm")
+	return os.Rename(tmp, dst)
+}
+
+// List returns the backups in dir, newest first.
+func List(dir string) ([]models.BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []models.BackupInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, models.BackupInfo{Name: name, Size: info.Size(), CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// Find returns the newest backup in dir taken at or before at.
+func Find(dir string, at time.Time) (models.BackupInfo, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return models.BackupInfo{}, err
+	}
+	for _, backup := range backups {
+		if !backup.CreatedAt.After(at) {
+			return backup, nil
+		}
+	}
+	return models.BackupInfo{}, ErrNoBackup
+}
+
+// Rotate deletes all but the newest keep backups in dir and returns the
+// names of the deleted files.
+func Rotate(dir string, keep int) ([]string, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i].Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[i].Name)
+	}
+	return removed, nil
+}
+
+func checkDatabase(path string) error {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", ErrNotVerified, result)
+	}
+
+	// A sound file must also hold our schema
+	var users int64
+	if err := db.Table("users").Count(&users).Error; err != nil {
+		return fmt.Errorf("%w: %v", ErrNotVerified, err)
+	}
+	return nil
+}
+
+func decryptToTemp(path, key, dir string) (string, error) {
+	if key == "" {
+		return "", ErrNoKey
+	}
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	plain, err := decrypt(sealed, key)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if _, err := tmp.Write(plain); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Backup files are magic | salt | nonce | AES-256-GCM ciphertext, with the
+// AES key derived from the passphrase and salt by scrypt.
+func encrypt(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, magic...), salt...), nonce...)
+	return gcm.Seal(out, nonce, plain, magic), nil
+}
+
+func decrypt(sealed []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, magic) || len(sealed) < len(magic)+saltSize {
+		return nil, ErrCorrupt
+	}
+	sealed = sealed[len(magic):]
+	gcm, err := newGCM(passphrase, sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[saltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrCorrupt
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], magic)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,155 @@
+// Package cache keeps the results of hot reads, such as GET /profile, so
+// repeated requests do not reach the database. Values are stored as JSON
+// for cache.ttl and dropped with Delete when what they were read from
+// changes.
+//
+// The cache is best effort: a backend that cannot be reached is logged and
+// treated as a miss, so requests fall back to the database instead of
+// failing.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/tenant"
+)
+
+// Reads cached per user, keyed by UserKey.
+const (
+	Profile    = "profile"
+	Membership = "membership"
+)
+
+// backend stores the encoded values.
+type backend interface {
+	// get returns the value of key, or nil when it is missing or expired.
+	get(key string) ([]byte, error)
+	set(key string, value []byte, ttl time.Duration) error
+	del(keys ...string) error
+	ping() error
+	close() error
+	name() string
+}
+
+var (
+	store backend = newMemoryBackend()
+	ttl           = 5 * time.Minute
+)
+
+// Init selects the backend of cfg, connecting to Redis at redisURL for the
+// redis backend.
+func Init(cfg config.CacheConfig, redisURL string) error {
+	ttl = cfg.TTL
+	switch cfg.Backend {
+	case "none":
+		store = noBackend{}
+	case "redis":
+		b, err := newRedisBackend(redisURL)
+		if err != nil {
+			return err
+		}
+		store = b
+		log.Printf("Caching reads in Redis at %s", b.client.Addr)
+	}
+	return nil
+}
+
+// UserKey is the key of the read of user id cached under name, e.g.
+// UserKey(ctx, Profile, 1). The users of another tenant than the server's
+// own, named in ctx, have keys of their own, as their IDs are those of
+// their shard.
+func UserKey(ctx context.Context, name string, id uint) string {
+	if t := tenant.FromContext(ctx); t != "" {
+		return fmt.Sprintf("%s:%s:%d", t, name, id)
+	}
+	return fmt.Sprintf("%s:%d", name, id)
+}
+
+// Get decodes the cached value of key into dest and reports whether there
+// was one.
+func Get(key string, dest interface{}) bool {
+	data, err := store.get(key)
+	if err != nil {
+		log.Printf("[cache] reading %s failed: %v", key, err)
+		return false
+	}
+	if data == nil {
+		return false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		log.Printf("[cache] decoding %s failed: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// Set caches value under key for cache.ttl.
+func Set(key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("[cache] encoding %s failed: %v", key, err)
+		return
+	}
+	if err := store.set(key, data, ttl); err != nil {
+		log.Printf("[cache] writing %s failed: %v", key, err)
+	}
+}
+
+// Delete drops the cached values of keys.
+func Delete(keys ...string) {
+	if err := store.del(keys...); err != nil {
+		log.Printf("[cache] deleting %v failed: %v", keys, err)
+	}
+}
+
+// InvalidateUser drops every read cached for user id. It is called once
+// changes to the columns those reads show have committed: called inside
+// the transaction, a request reading the old row before the commit would
+// cache it again until it expires.
+func InvalidateUser(ctx context.Context, id uint) {
+	Delete(UserKey(ctx, Profile, id), UserKey(ctx, Membership, id))
+}
+
+// Ping reports whether the backend can be reached.
+func Ping() error { return store.ping() }
+
+// Backend is the name of the backend: none, memory or redis.
+func Backend() string { return store.name() }
+
+// Close releases the backend's connection at shutdown.
+func Close() error { return store.close() }
+
+// Cache is the cache as the services and handlers use it, so they can be
+// given their own, e.g. in tests.
+type Cache interface {
+	Get(key string, dest interface{}) bool
+	Set(key string, value interface{})
+	Delete(keys ...string)
+	InvalidateUser(ctx context.Context, id uint)
+}
+
+// Default is the Cache on the backend selected by Init.
+var Default Cache = shared{}
+
+// shared forwards to the package functions.
+type shared struct{}
+
+func (shared) Get(key string, dest interface{}) bool       { return Get(key, dest) }
+func (shared) Set(key string, value interface{})           { Set(key, value) }
+func (shared) Delete(keys ...string)                       { Delete(keys...) }
+func (shared) InvalidateUser(ctx context.Context, id uint) { InvalidateUser(ctx, id) }
+
+// noBackend caches nothing.
+type noBackend struct{}
+
+func (noBackend) get(string) ([]byte, error)              { return nil, nil }
+func (noBackend) set(string, []byte, time.Duration) error { return nil }
+func (noBackend) del(...string) error                     { return nil }
+func (noBackend) ping() error                             { return nil }
+func (noBackend) close() error                            { return nil }
+func (noBackend) name() string                            { return "none" }
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/tenant"
+)
+
+type profile struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+}
+
+func TestCache(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) backend
+		// caches is false for backends that never return a value
+		caches bool
+	}{
+		{name: "memory", new: func(*testing.T) backend { return newMemoryBackend() }, caches: true},
+		{name: "redis", new: func(t *testing.T) backend {
+			b, err := newRedisBackend("redis://" + startFakeRedis(t))
+			if err != nil {
+				t.Fatalf("redis backend: %v", err)
+			}
+			t.Cleanup(func() { b.close() })
+			return b
+		}, caches: true},
+		{name: "none", new: func(*testing.T) backend { return noBackend{} }},
+	}
+
+	ctx := context.Background()
+	acme := tenant.NewContext(ctx, "acme")
+	somchai := profile{Name: "Somchai", Points: 1500}
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// run changes the cache before the profile of user 1 is read
+		run  func()
+		want *profile
+	}{
+		{name: "miss", run: func() {}},
+		{name: "hit", run: func() { Set(UserKey(ctx, Profile, 1), somchai) }, want: &somchai},
+		{name: "other key", run: func() { Set(UserKey(ctx, Membership, 1), somchai) }},
+		{name: "other user", run: func() { Set(UserKey(ctx, Profile, 2), somchai) }},
+		{name: "deleted", run: func() { Set(UserKey(ctx, Profile, 1), somchai); Delete(UserKey(ctx, Profile, 1)) }},
+		{name: "user invalidated", run: func() { Set(UserKey(ctx, Profile, 1), somchai); InvalidateUser(ctx, 1) }},
+		{name: "other tenant's user", run: func() { Set(UserKey(acme, Profile, 1), somchai) }},
+		{name: "other tenant's user invalidated", run: func() { Set(UserKey(ctx, Profile, 1), somchai); InvalidateUser(acme, 1) }, want: &somchai},
+		{name: "other user invalidated", run: func() { Set(UserKey(ctx, Profile, 1), somchai); InvalidateUser(ctx, 2) }, want: &somchai},
+		{name: "expired", ttl: 20 * time.Millisecond, run: func() { Set(UserKey(ctx, Profile, 1), somchai); time.Sleep(40 * time.Millisecond) }},
+		{name: "not encodable", run: func() { Set(UserKey(ctx, Profile, 1), func() {}) }},
+	}
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				store, ttl = b.new(t), time.Minute
+				if tt.ttl > 0 {
+					ttl = tt.ttl
+				}
+				t.Cleanup(func() { store, ttl = newMemoryBackend(), 5*time.Minute })
+
+				tt.run()
+				var got profile
+				ok := Get(UserKey(ctx, Profile, 1), &got)
+				want := tt.want
+				if !b.caches {
+					want = nil
+				}
+				if ok != (want != nil) || (ok && got != *want) {
+					t.Errorf("Get = %v %+v, want %v", ok, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	b, err := newRedisBackend("redis://" + addr)
+	if err != nil {
+		t.Fatalf("redis backend: %v", err)
+	}
+	store = b
+	t.Cleanup(func() { store = newMemoryBackend() })
+
+	// Reads fall back to the database and writes are dropped
+	ctx := context.Background()
+	Set(UserKey(ctx, Profile, 1), profile{Name: "Somchai"})
+	var got profile
+	if Get(UserKey(ctx, Profile, 1), &got) {
+		t.Errorf("Get = %+v from an unreachable Redis", got)
+	}
+	InvalidateUser(ctx, 1)
+	if err := Ping(); err == nil {
+		t.Error("Ping: want an error")
+	}
+}
+
+// startFakeRedis serves the GET, SET with PX and DEL commands of the cache
+// from a map and returns its address.
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	data := map[string]entry{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						e, ok := data[args[1]]
+						if !ok || time.Now().After(e.expires) {
+							io.WriteString(conn, "$-1\r\n")
+						} else {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(e.value), e.value)
+						}
+					case "SET":
+						ms, _ := strconv.Atoi(args[4])
+						data[args[1]] = entry{value: []byte(args[2]), expires: time.Now().Add(time.Duration(ms) * time.Millisecond)}
+						io.WriteString(conn, "+OK\r\n")
+					case "DEL":
+						for _, key := range args[1:] {
+							delete(data, key)
+						}
+						fmt.Fprintf(conn, ":%d\r\n", len(args)-1)
+					default:
+						fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad argument %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
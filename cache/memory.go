@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the memory backend; expired entries are swept when it
+// is reached, and everything is dropped if that is not enough.
+const maxEntries = 100000
+
+// memoryBackend keeps the values in the server's memory.
+type memoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{entries: map[string]entry{}}
+}
+
+func (b *memoryBackend) get(key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, nil
+	}
+	return e.value, nil
+}
+
+func (b *memoryBackend) set(key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.entries) >= maxEntries {
+		for k, e := range b.entries {
+			if now.After(e.expires) {
+				delete(b.entries, k)
+			}
+		}
+		if len(b.entries) >= maxEntries {
+			b.entries = map[string]entry{}
+		}
+	}
+	b.entries[key] = entry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+func (b *memoryBackend) del(keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, key := range keys {
+		delete(b.entries, key)
+	}
+	return nil
+}
+
+func (b *memoryBackend) ping() error { return nil }
+
+func (b *memoryBackend) close() error { return nil }
+
+func (b *memoryBackend) name() string { return "memory" }
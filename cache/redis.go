@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/redis"
+)
+
+// keyPrefix keeps the cache apart from the other data in Redis.
+const keyPrefix = "cache:"
+
+// redisBackend shares the cache between instances through Redis.
+type redisBackend struct {
+	client *redis.Client
+}
+
+func newRedisBackend(rawURL string) (*redisBackend, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisBackend{client: client}, nil
+}
+
+func (b *redisBackend) get(key string) ([]byte, error) {
+	reply, err := b.client.Do("GET", keyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return []byte(s), nil
+}
+
+func (b *redisBackend) set(key string, value []byte, ttl time.Duration) error {
+	_, err := b.client.Do("SET", keyPrefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (b *redisBackend) del(keys ...string) error {
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, keyPrefix+key)
+	}
+	_, err := b.client.Do(args...)
+	return err
+}
+
+func (b *redisBackend) ping() error { return b.client.Ping() }
+
+func (b *redisBackend) close() error { return b.client.Close() }
+
+func (b *redisBackend) name() string { return "redis" }
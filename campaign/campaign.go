@@ -0,0 +1,80 @@
+// Package campaign awards onboarding points defined in the campaigns table.
+package campaign
+
+import (
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/points"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Events lists the events campaigns can be attached to.
+var Events = map[string]bool{
+	models.CampaignEventRegistration:     true,
+	models.CampaignEventProfileCompleted: true,
+	models.CampaignEventPhoneVerified:    true,
+}
+
+// Award grants the user the points of every running campaign for event it
+// has not received yet and returns the points added. It should run in the
+// same transaction as the change that caused the event. Each campaign is an
+// earn entry in the points ledger; user.Points is updated in place.
+func Award(tx *gorm.DB, user *models.User, event string) (int, error) {
+	now := time.Now()
+
+	var campaigns []models.Campaign
+	err := tx.Where("event = ? AND active = ?", event, true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Order("id").Find(&campaigns).Error
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var codes []string
+	for _, c := range campaigns {
+		award := models.CampaignAward{CampaignID: c.ID, UserID: user.ID, Points: c.Points}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&award)
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		// Already awarded
+		if result.RowsAffected == 0 {
+			continue
+		}
+		_, err := points.Post(tx, user, models.PointTransaction{
+			Type:      models.PointTransactionEarn,
+			Amount:    c.Points,
+			Reason:    c.Name,
+			Reference: "campaign:" + c.Code,
+		})
+		if err != nil {
+			return 0, err
+		}
+		total += c.Points
+		codes = append(codes, c.Code)
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	err = tx.Create(&models.AuditLog{
+		Actor:      "campaign:" + strings.Join(codes, ","),
+		Action:     "campaign.award",
+		Resource:   "users",
+		ResourceID: user.ID,
+		Fields:     []string{"points"},
+	}).Error
+	return total, err
+}
+
+// ProfileComplete reports whether the profile has every field the
+// profile_completed event asks for.
+func ProfileComplete(user *models.User) bool {
+	return user.FirstName != "" && user.LastName != "" && user.RomanizedName != "" && user.Phone != ""
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"temp-backend-at-kbtg/analytics"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+)
+
+// runExportAnalytics runs the analytics export once, e.g. to catch up
+// before the first scheduled run or after fixing a failed one.
+func runExportAnalytics(args []string) error {
+	flags := flag.NewFlagSet("analytics", flag.ExitOnError)
+	flags.Parse(args)
+
+	cfg := config.Get()
+	db := database.Connect(cfg.Database)
+	defer database.Close(db)
+
+	return analytics.New(cfg.Analytics).Run(context.Background(), db, time.Now())
+}
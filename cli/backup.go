@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/backup"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+)
+
+func runBackup(args []string) error {
+	cfg := config.Get().Backup
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.StringVar(&cfg.Dir, "dir", cfg.Dir, "directory to write backups to")
+	flags.IntVar(&cfg.Keep, "keep", cfg.Keep, "number of newest backups to keep")
+	flags.Parse(args)
+
+	db := database.Connect(config.Get().Database)
+	defer database.Close(db)
+
+	info, err := backup.Create(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Backup written and verified: %s (%d bytes)", filepath.Join(cfg.Dir, info.Name), info.Size)
+	return nil
+}
+
+func runRestore(args []string) error {
+	cfg := config.Get().Backup
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.StringVar(&cfg.Dir, "dir", cfg.Dir, "directory holding the backups")
+	file := flags.String("file", "", "backup file name or path (default: the newest backup)")
+	at := flags.String("at", "", "restore the newest backup taken at or before this local time, e.g. 2025-10-18T09:30")
+	list := flags.Bool("list", false, "list available backups and exit")
+	flags.Parse(args)
+
+	if *list {
+		backups, err := backup.List(cfg.Dir)
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			fmt.Printf("%s  %s  %d bytes\n", b.Name, b.CreatedAt.Format(time.RFC3339), b.Size)
+		}
+		return nil
+	}
+
+	driver, dsn := database.Settings()
+	if driver != "sqlite" || dsn == ":memory:" || strings.HasPrefix(dsn, "file:") || strings.Contains(dsn, "?") {
+		return fmt.Errorf("restore needs a plain SQLite file DSN, got %s %q", driver, dsn)
+	}
+
+	path := *file
+	if path != "" && !strings.ContainsRune(path, filepath.Separator) {
+		path = filepath.Join(cfg.Dir, path)
+	}
+	if path == "" {
+		pointInTime := time.Now()
+		if *at != "" {
+			var err error
+			if pointInTime, err = time.ParseInLocation("2006-01-02T15:04", *at, time.Local); err != nil {
+				return fmt.Errorf("invalid -at: %w", err)
+			}
+		}
+		info, err := backup.Find(cfg.Dir, pointInTime)
+		if errors.Is(err, backup.ErrNoBackup) {
+			return fmt.Errorf("no backup in %s taken at or before %s", cfg.Dir, pointInTime.Format(time.RFC3339))
+		}
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(cfg.Dir, info.Name)
+	}
+
+	if err := backup.Restore(path, cfg.Key, dsn); err != nil {
+		return err
+	}
+
+	log.Printf("Restored %s from %s; run `migrate up` to apply pending migrations", dsn, path)
+	return nil
+}
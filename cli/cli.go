@@ -0,0 +1,47 @@
+// Package cli implements the maintenance subcommands that run instead of the
+// HTTP server, e.g. `go run . dump --anonymize`.
+package cli
+
+import (
+	"fmt"
+	"sort"
+)
+
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"dump":           {"Export the database as SQL, optionally with PII anonymized", runDump},
+	"backup":         {"Write an encrypted, verified database snapshot and rotate old ones", runBackup},
+	"restore":        {"Replace the database with a verified backup (stop the server first)", runRestore},
+	"set-role":       {"Change a user's role, e.g. appoint an admin", runSetRole},
+	"migrate":        {"Apply, revert, list or create versioned schema migrations", runMigrate},
+	"reindex-search": {"Rebuild the admin search index from the users and points transactions", runReindexSearch},
+	"replay-events":  {"Rebuild members' balances and tiers from their event streams", runReplayEvents},
+	"analytics":      {"Export the days since the last run to the analytics warehouse as Parquet", runExportAnalytics},
+}
+
+// Run executes the subcommand named by args[0].
+func Run(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage())
+	}
+	return cmd.run(args[1:])
+}
+
+func usage() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := "Available commands:\n"
+	for _, name := range names {
+		text += fmt.Sprintf("  %-14s %s\n", name, commands[name].description)
+	}
+	return text
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// anonymizedPassword is the password of every user in an anonymized dump.
+const anonymizedPassword = "password123"
+
+var (
+	fakeFirstNames = []string{"Somchai", "Somying", "Anan", "Kanya", "Niran", "Pimchanok", "Arthit", "Malee", "Krit", "Nattaya", "Thanawat", "Siriporn", "John", "Emma", "Daniel", "Sarah"}
+	fakeLastNames  = []string{"Srisuk", "Wongsawat", "Chaiyaporn", "Suksawat", "Rattanakul", "Thongdee", "Boonmee", "Saetang", "Jaidee", "Kaewmanee", "Smith", "Brown"}
+)
+
+// anonymizers rewrite the PII columns of a table row in place. New tables or
+// columns holding personal data must be registered here.
+var anonymizers = map[string]func(row map[string]interface{}){
+	"users":                anonymizeUser,
+	"devices":              anonymizeDevice,
+	"sessions":             anonymizeSession,
+	"suppressed_addresses": anonymizeSuppressedAddress,
+	"user_identities":      anonymizeUserIdentity,
+}
+
+// derivedTables copy personal data from the tables above in a form the
+// anonymizers cannot rewrite; an anonymized dump leaves their rows out, and
+// `go run . reindex-search` fills them again from the anonymized rows.
+var derivedTables = map[string]bool{
+	"search_documents": true,
+	"search_grams":     true,
+}
+
+func runDump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	anonymize := flags.Bool("anonymize", false, "replace emails, names and phone numbers with fake values")
+	output := flags.String("output", fmt.Sprintf("dump-%s.sql", time.Now().Format("20060102-150405")), "file to write the SQL dump to")
+	flags.Parse(args)
+
+	if driver, _ := database.Settings(); driver != "sqlite" {
+		return fmt.Errorf("dump writes SQLite statements and needs a SQLite database, got %s", driver)
+	}
+
+	db := database.Connect(config.Get().Database)
+	defer database.Close(db)
+
+	if *anonymize {
+		hash, err := bcrypt.GenerateFromPassword([]byte(anonymizedPassword), config.Get().BcryptCost)
+		if err != nil {
+			return err
+		}
+		anonymizedHash = string(hash)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := writeDump(db, w, *anonymize); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	log.Printf("Database dump written to %s (anonymized: %t)", *output, *anonymize)
+	return nil
+}
+
+type schemaObject struct {
+	Type string
+	Name string
+	SQL  string
+}
+
+// writeDump writes the schema and rows of every table as SQLite statements
+// that can be loaded with `sqlite3 staging.db < dump.sql`.
+func writeDump(db *gorm.DB, w *bufio.Writer, anonymize bool) error {
+	var objects []schemaObject
+	err := db.Raw("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type DESC, name").
+		Scan(&objects).Error
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+
+	for _, obj := range objects {
+		fmt.Fprintf(w, "%s;\n", obj.SQL)
+		if obj.Type != "table" || anonymize && derivedTables[obj.Name] {
+			continue
+		}
+
+		var rows []map[string]interface{}
+		if err := db.Table(obj.Name).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if anonymizer, ok := anonymizers[obj.Name]; ok && anonymize {
+				anonymizer(row)
+			}
+			writeInsert(w, obj.Name, row)
+		}
+	}
+
+	fmt.Fprintln(w, "COMMIT;")
+	return nil
+}
+
+func writeInsert(w *bufio.Writer, table string, row map[string]interface{}) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = sqlLiteral(row[column])
+	}
+
+	fmt.Fprintf(w, "INSERT INTO %q (%s) VALUES (%s);\n", table, quoteIdentifiers(columns), strings.Join(values, ", "))
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999999-07:00") + "'"
+	case []byte:
+		return fmt.Sprintf("X'%x'", v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var anonymizedHash string
+
+// anonymizeUser replaces PII with realistic values derived from the user ID,
+// so the same user gets the same fake identity in every dump and emails stay
+// unique. IDs and membership IDs are kept to preserve references.
+func anonymizeUser(row map[string]interface{}) {
+	id := fmt.Sprint(row["id"])
+	seed := fakeSeed(id)
+
+	first := fakeFirstNames[seed%uint32(len(fakeFirstNames))]
+	last := fakeLastNames[(seed/7)%uint32(len(fakeLastNames))]
+
+	row["first_name"] = first
+	row["last_name"] = last
+	if romanized, ok := row["romanized_name"].(string); ok && romanized != "" {
+		row["romanized_name"] = first + " " + last
+	}
+	row["email"] = fmt.Sprintf("%s.%s.%s@example.com", strings.ToLower(first), strings.ToLower(last), id)
+	row["email_canonical"] = row["email"]
+	if phone, ok := row["phone"].(string); ok && phone != "" {
+		row["phone"] = fmt.Sprintf("+668%d%03d%04d", seed%10, (seed/10)%1000, (seed/10000)%10000)
+	}
+	row["password"] = anonymizedHash
+}
+
+// anonymizeDevice drops push tokens, which can be used to message the
+// device, and device names, which often contain the owner's name.
+func anonymizeDevice(row map[string]interface{}) {
+	row["name"] = row["model"]
+	row["push_token"] = ""
+}
+
+// anonymizeSession drops where a login came from; the timestamps stay.
+func anonymizeSession(row map[string]interface{}) {
+	row["ip"] = "192.0.2.1"
+	row["last_ip"] = "192.0.2.1"
+	row["user_agent"] = ""
+}
+
+// anonymizeSuppressedAddress also drops the provider's bounce message, which
+// often quotes the address.
+func anonymizeSuppressedAddress(row map[string]interface{}) {
+	row["address"] = fmt.Sprintf("suppressed.%v@example.com", row["id"])
+	row["detail"] = ""
+}
+
+// anonymizeUserIdentity replaces the provider account's address and subject
+// ID, which identifies the person at the provider.
+func anonymizeUserIdentity(row map[string]interface{}) {
+	row["email"] = fmt.Sprintf("identity.%v@example.com", row["id"])
+	row["subject"] = fmt.Sprintf("anonymized-%v", row["id"])
+}
+
+func fakeSeed(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return h.Sum32()
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+)
+
+// errDryRun rolls back the rebuild of a member in a dry run.
+var errDryRun = errors.New("dry run")
+
+// runReplayEvents replays the event streams of members and writes the balance
+// and tier they add up to onto the users table, e.g. after restoring the
+// users table alone or to check that the two agree.
+func runReplayEvents(args []string) error {
+	flags := flag.NewFlagSet("replay-events", flag.ExitOnError)
+	userID := flags.Uint("user", 0, "ID of the member to replay (default all)")
+	dryRun := flags.Bool("dry-run", false, "report the differences without writing them")
+	flags.Parse(args)
+
+	db := database.Connect(config.Get().Database)
+	defer database.Close(db)
+
+	query := db.Model(&models.User{}).Order("id")
+	if *userID != 0 {
+		query = query.Where("id = ?", *userID)
+	}
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 && *userID != 0 {
+		return fmt.Errorf("no user with ID %d", *userID)
+	}
+
+	var errs []error
+	differed := 0
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			before, after, err := eventstore.Rebuild(tx, id)
+			if err != nil || before == after {
+				return err
+			}
+			differed++
+			log.Printf("User %d: %d points at %s, events add up to %d points at %s",
+				id, before.Points, before.MemberLevel, after.Points, after.MemberLevel)
+			if *dryRun {
+				return errDryRun
+			}
+			return tx.Create(&models.AuditLog{
+				Actor:      "cli",
+				Action:     "points.replay",
+				Resource:   "users",
+				ResourceID: id,
+				Fields:     []string{"points", "member_level"},
+			}).Error
+		})
+		if err != nil && !errors.Is(err, errDryRun) {
+			errs = append(errs, fmt.Errorf("user %d: %w", id, err))
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Replayed %d members; %d differ from their events", len(ids), differed)
+	} else {
+		log.Printf("Replayed %d members; rebuilt %d from their events", len(ids), differed)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+
+	"gorm.io/gorm"
+)
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// runMigrate applies, reverts, lists or creates versioned migrations:
+// `migrate up`, `migrate down -steps N`, `migrate to VERSION`,
+// `migrate status` and `migrate create NAME`. All but create act on the
+// database setting, then on each shard of sharding.shards, stopping at the
+// first that fails.
+func runMigrate(args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "up":
+		return withEveryDatabase(func(tenant string, db *gorm.DB) error {
+			applied, err := database.MigrateUp(db)
+			if err != nil {
+				return err
+			}
+			if len(applied) == 0 {
+				log.Printf("No pending migrations for tenant %s", tenant)
+			}
+			return nil
+		})
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert, newest first")
+		flags.Parse(args)
+		if *steps < 1 {
+			return errors.New("-steps must be at least 1")
+		}
+		return withEveryDatabase(func(tenant string, db *gorm.DB) error {
+			reverted, err := database.MigrateDown(db, *steps)
+			if err != nil {
+				return err
+			}
+			if len(reverted) == 0 {
+				log.Printf("No applied migrations for tenant %s", tenant)
+			}
+			return nil
+		})
+	case "to":
+		if len(args) != 1 {
+			return errors.New("usage: migrate to VERSION, e.g. migrate to 3")
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return withEveryDatabase(func(tenant string, db *gorm.DB) error {
+			changed, err := database.MigrateTo(db, version)
+			if err != nil {
+				return err
+			}
+			if len(changed) == 0 {
+				log.Printf("Tenant %s is already at version %04d", tenant, version)
+			}
+			return nil
+		})
+	case "status":
+		sharded := len(config.Get().Sharding.Shards) > 0
+		return withEveryDatabase(func(tenant string, db *gorm.DB) error {
+			states, err := database.MigrationStatus(db)
+			if err != nil {
+				return err
+			}
+			if sharded {
+				fmt.Printf("Tenant %s:\n", tenant)
+			}
+			for _, state := range states {
+				status := "pending"
+				if state.AppliedAt != nil {
+					status = "applied " + state.AppliedAt.Format(time.RFC3339)
+				}
+				if state.Unknown {
+					status += " (not in this build)"
+				}
+				fmt.Printf("%04d_%-40s %s\n", state.Version, state.Name, status)
+			}
+			return nil
+		})
+	case "create":
+		if len(args) != 1 || !migrationName.MatchString(args[0]) {
+			return errors.New("usage: migrate create NAME, with NAME in lower case letters, digits and underscores")
+		}
+		return createMigration(args[0])
+	default:
+		return fmt.Errorf("unknown migrate action %q; use up, down, to, status or create", action)
+	}
+}
+
+// withEveryDatabase calls fn with the database setting, as withDatabase
+// does, and then with each shard of sharding.shards, naming the tenant of
+// each.
+func withEveryDatabase(fn func(tenant string, db *gorm.DB) error) error {
+	cfg := config.Get()
+	err := withDatabase(func(db *gorm.DB) error {
+		return fn(cfg.Sharding.Tenant, db)
+	})
+	if err != nil {
+		return err
+	}
+	for _, shard := range cfg.Sharding.Shards {
+		log.Printf("Shard of tenant %s", shard.Tenant)
+		settings := cfg.Database
+		settings.Driver, settings.DSN = shard.Driver, shard.DSN
+		err := withSettings(settings, func(db *gorm.DB) error {
+			return fn(shard.Tenant, db)
+		})
+		if err != nil {
+			return fmt.Errorf("shard of tenant %s: %w", shard.Tenant, err)
+		}
+	}
+	return nil
+}
+
+// withDatabase opens the configured database without migrating it, unlike
+// database.Connect, and closes it after fn.
+func withDatabase(fn func(db *gorm.DB) error) error {
+	return withSettings(config.Get().Database, fn)
+}
+
+// withSettings is withDatabase for the database of settings.
+func withSettings(settings config.DatabaseConfig, fn func(db *gorm.DB) error) error {
+	db, err := database.Open(settings)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	return fn(db)
+}
+
+// createMigration writes an empty up and down file for the next version to
+// the migrations directory of each driver in the source tree; they are
+// built into the binary on the next build.
+func createMigration(name string) error {
+	drivers, err := database.MigrationDrivers()
+	if err != nil {
+		return err
+	}
+	next := database.Migration{Version: 1, Name: name}
+	for _, driver := range drivers {
+		migrations, err := database.Migrations(driver)
+		if err != nil {
+			return err
+		}
+		if n := len(migrations); n > 0 && migrations[n-1].Version >= next.Version {
+			next.Version = migrations[n-1].Version + 1
+		}
+	}
+
+	for _, driver := range drivers {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(database.MigrationsDir, driver, next.ID()+"."+direction+".sql")
+			content := fmt.Sprintf("-- %s: %s (%s)\n", next.ID(), direction, driver)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return err
+			}
+			log.Printf("Created %s", path)
+		}
+	}
+	return nil
+}
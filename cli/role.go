@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+
+	"gorm.io/gorm"
+)
+
+// runSetRole changes a user's role, e.g. to appoint the first admin of a
+// database that was not seeded.
+func runSetRole(args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the user")
+	role := flags.String("role", models.RoleAdmin, "new role: "+strings.Join(models.Roles, ", "))
+	flags.Parse(args)
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	if !slices.Contains(models.Roles, *role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	db := database.Connect(config.Get().Database)
+	defer database.Close(db)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.
+			Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", normalize.CanonicalEmail(*email), normalize.Email(*email)).
+			First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no user with email %s", *email)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("role", *role).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.AuditLog{
+			Actor:      "cli",
+			Action:     "user.role",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"role"},
+		}).Error; err != nil {
+			return err
+		}
+
+		log.Printf("User %d (%s) now has role %s", user.ID, user.Email, *role)
+		return nil
+	})
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"log"
+
+	"temp-backend-at-kbtg/search"
+
+	"gorm.io/gorm"
+)
+
+// runReindexSearch rebuilds the admin search's index in the server's
+// database and in every shard, e.g. after records were changed by
+// statements the index does not see (see search.Plugin).
+func runReindexSearch(args []string) error {
+	return withEveryDatabase(func(tenant string, db *gorm.DB) error {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return search.Rebuild(tx, search.Default)
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Rebuilt the search index of tenant %s", tenant)
+		return nil
+	})
+}
@@ -0,0 +1,954 @@
+// Package config loads the server settings from a YAML file, a .env file
+// and the environment, in increasing order of precedence, and validates them
+// at startup.
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/scheduler"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// tenantName is the form of tenant names, which appear in URLs and logs.
+var tenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// defaultJWTSecret is for development only; Validate refuses it in
+// production.
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// Config holds the settings of the server. The yaml tags are the keys of
+// config.yaml; each field's environment variable is listed in env.go.
+type Config struct {
+	// AppEnv is the deployment environment; "production" turns off debug
+	// routes and enforces production-only checks.
+	AppEnv string `yaml:"app_env"`
+	Port   int    `yaml:"port"`
+	// GRPCPort is the port of the gRPC API; 0 serves none.
+	GRPCPort int    `yaml:"grpc_port"`
+	BasePath string `yaml:"base_path"`
+	// PublicURL is the address clients reach the server at, including
+	// BasePath, for links in messages sent outside a request.
+	PublicURL string `yaml:"public_url"`
+	// ProvidersMode "mock" records email, SMS, push, payments and events
+	// in the outbox of GET /debug/outbox instead of sending them; "live"
+	// sends them.
+	ProvidersMode string `yaml:"providers_mode"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests
+	// and background jobs.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the addresses and CIDR ranges whose X-Forwarded-*
+	// headers are honoured.
+	TrustedProxies []string       `yaml:"trusted_proxies"`
+	CORS           CORSConfig     `yaml:"cors"`
+	Database       DatabaseConfig `yaml:"database"`
+	Sharding       ShardingConfig `yaml:"sharding"`
+	JWT            JWTConfig      `yaml:"jwt"`
+	BcryptCost     int            `yaml:"bcrypt_cost"`
+	// RequireEmailVerification refuses authenticated requests from accounts
+	// whose email is not verified.
+	RequireEmailVerification bool `yaml:"require_email_verification"`
+	// TermsVersion is the terms-of-service version users must accept; no
+	// gating when empty.
+	TermsVersion string `yaml:"terms_version"`
+	// FoldEmailAliases makes addresses that differ only in a +tag, or in
+	// the dots of a Gmail address, one account.
+	FoldEmailAliases bool `yaml:"fold_email_aliases"`
+	// PasswordResetURL and EmailVerificationURL are the app pages the
+	// emailed links open, which post the token to the API; the links point
+	// at the API itself when they are empty.
+	PasswordResetURL      string `yaml:"password_reset_url"`
+	EmailVerificationURL  string `yaml:"email_verification_url"`
+	CaptureFailedRequests bool   `yaml:"capture_failed_requests"`
+	// ReplayTargetURL is the server captured requests are replayed
+	// against, e.g. a staging instance; replay is off when it is empty.
+	ReplayTargetURL string           `yaml:"replay_target_url"`
+	WebhookSecrets  WebhookSecrets   `yaml:"webhook_secrets"`
+	Swagger         SwaggerConfig    `yaml:"swagger"`
+	TOTP            TOTPConfig       `yaml:"totp"`
+	Backup          BackupConfig     `yaml:"backup"`
+	Mail            MailConfig       `yaml:"mail"`
+	SMTP            SMTPConfig       `yaml:"smtp"`
+	SMS             SMSConfig        `yaml:"sms"`
+	Push            PushConfig       `yaml:"push"`
+	Moderation      ModerationConfig `yaml:"moderation"`
+	Events          EventsConfig     `yaml:"events"`
+	Redis           RedisConfig      `yaml:"redis"`
+	RateLimit       RateLimitConfig  `yaml:"rate_limit"`
+	Jobs            JobsConfig       `yaml:"jobs"`
+	Cache           CacheConfig      `yaml:"cache"`
+	Lock            LockConfig       `yaml:"lock"`
+	Tracing         TracingConfig    `yaml:"tracing"`
+	Points          PointsConfig     `yaml:"points"`
+	Tiers           TiersConfig      `yaml:"tiers"`
+	Referrals       ReferralsConfig  `yaml:"referrals"`
+	Wallet          WalletConfig     `yaml:"wallet"`
+	AuditLog        AuditLogConfig   `yaml:"audit_log"`
+	Storage         StorageConfig    `yaml:"storage"`
+	Analytics       AnalyticsConfig  `yaml:"analytics"`
+	Accounts        AccountsConfig   `yaml:"accounts"`
+	Sync            SyncConfig       `yaml:"sync"`
+	OAuth           OAuthConfig      `yaml:"oauth"`
+}
+
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+type DatabaseConfig struct {
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn"`
+	// AutoMigrate applies pending migrations on startup; otherwise the
+	// server refuses to start until `go run . migrate up` has applied them.
+	// In-memory databases are always migrated.
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// Seed inserts demo data on startup; in-memory databases are always
+	// seeded.
+	Seed              bool   `yaml:"seed"`
+	SeedAdminPassword string `yaml:"seed_admin_password"`
+	// The connection pool limits override the defaults of the driver when
+	// set; zero keeps them.
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// SlowQueryThreshold is how long a statement may take before it is
+	// logged with the request ID; zero turns the log off.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+}
+
+// ShardingConfig maps tenants to the shards their data lives in. The
+// database setting is the shard of Tenant, the server's own; Shards are the
+// databases of the other tenants, each holding one tenant, or a schema of a
+// shared PostgreSQL database chosen with search_path in the DSN.
+type ShardingConfig struct {
+	Tenant string        `yaml:"tenant"`
+	Shards []ShardConfig `yaml:"shards"`
+}
+
+// ShardConfig is the database of a tenant. It is migrated and pooled like
+// the server's own, with the connection limits set here.
+type ShardConfig struct {
+	Tenant       string `yaml:"tenant"`
+	Driver       string `yaml:"driver"`
+	DSN          string `yaml:"dsn"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+	MaxIdleConns int    `yaml:"max_idle_conns"`
+}
+
+type JWTConfig struct {
+	Secret          string        `yaml:"secret"`
+	Issuer          string        `yaml:"issuer"`
+	Audience        string        `yaml:"audience"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	// SigningKey is a PEM private key file for RS256/ES256 access tokens;
+	// HS256 with Secret is used when it is empty.
+	SigningKey string `yaml:"signing_key"`
+	// VerificationKeys are PEM files of retired signing keys whose tokens
+	// are still accepted.
+	VerificationKeys []string `yaml:"verification_keys"`
+}
+
+// MailConfig selects how email is delivered: through the mail server in
+// SMTP ("smtp"), the SendGrid API ("sendgrid"), or not at all ("log"), in
+// which case messages are only logged.
+type MailConfig struct {
+	Driver string `yaml:"driver"`
+	// From is the sender, e.g. "Rewards <no-reply@example.com>".
+	From     string         `yaml:"from"`
+	SendGrid SendGridConfig `yaml:"sendgrid"`
+	// MaxAttempts is how often an email is tried before it is dropped;
+	// only failures the provider reports as temporary are retried.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// SendGridConfig is the account of the sendgrid mail driver.
+type SendGridConfig struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// SMTPConfig is the mail server of the smtp mail driver.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// SMSConfig selects the SMS gateway: Twilio ("twilio"), the Thai
+// aggregator ThaiBulkSMS ("thaibulksms") or none ("log"), in which case
+// messages are only logged.
+type SMSConfig struct {
+	Driver string `yaml:"driver"`
+	// Sender is the number or registered sender name messages come from.
+	Sender      string            `yaml:"sender"`
+	Twilio      TwilioConfig      `yaml:"twilio"`
+	ThaiBulkSMS ThaiBulkSMSConfig `yaml:"thaibulksms"`
+	// UserHourlyLimit is how many messages one member can be sent per
+	// hour, codes and notifications together; 0 for no limit.
+	UserHourlyLimit int `yaml:"user_hourly_limit"`
+}
+
+// TwilioConfig is the account of the twilio SMS driver.
+type TwilioConfig struct {
+	AccountSID string `yaml:"account_sid"`
+	AuthToken  string `yaml:"auth_token"`
+}
+
+// ThaiBulkSMSConfig is the account of the thaibulksms SMS driver.
+type ThaiBulkSMSConfig struct {
+	APIKey    string `yaml:"api_key"`
+	APISecret string `yaml:"api_secret"`
+}
+
+// PushConfig selects how push notifications are delivered: through
+// Firebase Cloud Messaging ("fcm") or not at all ("log"), in which case they
+// are only logged.
+type PushConfig struct {
+	Driver string    `yaml:"driver"`
+	FCM    FCMConfig `yaml:"fcm"`
+}
+
+// FCMConfig is the Firebase project of the fcm push driver.
+type FCMConfig struct {
+	// CredentialsFile is the JSON key of a service account allowed to
+	// send messages, which also names the project.
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+// ModerationConfig selects how uploaded avatars are checked: through Google
+// Cloud Vision SafeSearch ("vision") or not at all ("none").
+type ModerationConfig struct {
+	Driver string `yaml:"driver"`
+	// Threshold is the SafeSearch likelihood from which an image rated
+	// adult, violent or racy is flagged: POSSIBLE, LIKELY or VERY_LIKELY.
+	Threshold string       `yaml:"threshold"`
+	Vision    VisionConfig `yaml:"vision"`
+}
+
+// VisionConfig is the Google Cloud account of the vision moderation driver.
+type VisionConfig struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// EventsConfig selects the message broker domain events are published to
+// for downstream consumers: NATS ("nats"), Kafka through its REST proxy
+// ("kafka") or none ("none").
+type EventsConfig struct {
+	Broker string `yaml:"broker"`
+	// TopicPrefix is put before the event name to make the NATS subject or
+	// Kafka topic, e.g. loyalty.points.earned.
+	TopicPrefix string      `yaml:"topic_prefix"`
+	NATS        NATSConfig  `yaml:"nats"`
+	Kafka       KafkaConfig `yaml:"kafka"`
+}
+
+// NATSConfig is the server of the nats broker.
+type NATSConfig struct {
+	// URL is a nats:// or tls:// URL, with a user and password or a token
+	// as user info when the server requires them.
+	URL string `yaml:"url"`
+}
+
+// WebhookSecrets are the shared secrets the email and SMS providers send
+// in X-Webhook-Secret with their delivery reports; a webhook is off while
+// its secret is empty.
+type WebhookSecrets struct {
+	Email string `yaml:"email"`
+	SMS   string `yaml:"sms"`
+}
+
+// SwaggerConfig controls the Swagger UI at /swagger/. Mode "open" serves
+// it to everyone, "basic" behind User and Password, and "disabled" not at
+// all; empty means open, or disabled in production.
+type SwaggerConfig struct {
+	Mode     string `yaml:"mode"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// Host and BasePath are where the served spec sends requests; by
+	// default the host Swagger UI was loaded from, and base_path.
+	Host     string `yaml:"host"`
+	BasePath string `yaml:"base_path"`
+}
+
+// TOTPConfig controls two-factor authentication with authenticator apps.
+type TOTPConfig struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string `yaml:"issuer"`
+	// EncryptionKey encrypts the stored secrets; they are encrypted with a
+	// key derived from the JWT secret when it is empty. Changing it makes
+	// members enroll again.
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
+// BackupConfig controls the encrypted SQLite backups. Backups are off
+// while Key is empty.
+type BackupConfig struct {
+	Dir string `yaml:"dir"`
+	Key string `yaml:"key"`
+	// Keep is the number of newest backups retained after each backup.
+	Keep int `yaml:"keep"`
+}
+
+// OAuthConfig holds the clients registered with the identity providers
+// users can sign in with. A provider is offered once its client ID and
+// secret are set.
+type OAuthConfig struct {
+	Google   OAuthClientConfig `yaml:"google"`
+	GitHub   OAuthClientConfig `yaml:"github"`
+	Facebook OAuthClientConfig `yaml:"facebook"`
+	LINE     OAuthClientConfig `yaml:"line"`
+}
+
+// OAuthClientConfig is the client registered with one identity provider.
+type OAuthClientConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL overrides the callback URL derived from the request, for
+	// deployments whose public URL differs from what the server sees.
+	RedirectURL string `yaml:"redirect_url"`
+}
+
+// namedOAuthClient is a provider's client with the provider's name, e.g.
+// "google".
+type namedOAuthClient struct {
+	name   string
+	client *OAuthClientConfig
+}
+
+// clients lists the clients of every provider.
+func (c *OAuthConfig) clients() []namedOAuthClient {
+	return []namedOAuthClient{
+		{"google", &c.Google},
+		{"github", &c.GitHub},
+		{"facebook", &c.Facebook},
+		{"line", &c.LINE},
+	}
+}
+
+// KafkaConfig is the REST proxy of the kafka broker.
+type KafkaConfig struct {
+	RESTProxyURL string `yaml:"rest_proxy_url"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+}
+
+type RedisConfig struct {
+	URL string `yaml:"url"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" (per instance) or "redis" (shared through Redis.URL).
+	Store string `yaml:"store"`
+	Auth  Rate   `yaml:"auth"`
+	User  Rate   `yaml:"user"`
+	// Tiers overrides User for the members of the listed tiers, by tier
+	// code, e.g. Platinum: 600/1m.
+	Tiers map[string]Rate `yaml:"tiers"`
+	// Partner is the number of partner API requests per partner per minute.
+	Partner int `yaml:"partner"`
+	// Plans overrides Partner for the partners on the listed plans, e.g.
+	// premium: 300; partners on any other plan, such as the default
+	// "standard", get Partner.
+	Plans map[string]int `yaml:"plans"`
+}
+
+// JobsConfig is the queue of background jobs such as email and report
+// exports. With the memory backend the server runs the jobs itself; with
+// redis they are queued in Redis.URL and run by `go run . worker`.
+type JobsConfig struct {
+	Backend string `yaml:"backend"`
+	// Concurrency is how many jobs a process runs at once.
+	Concurrency int `yaml:"concurrency"`
+}
+
+// CacheConfig is the cache of hot reads such as GET /profile. The memory
+// backend only suits a single instance, as other instances do not see its
+// invalidations; redis shares the cache through Redis.URL; none turns it
+// off.
+type CacheConfig struct {
+	Backend string `yaml:"backend"`
+	// TTL is how long a cached read is served at most.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// LockConfig selects where the locks of scheduled jobs, redemptions and
+// account linking are taken: memory only excludes one instance, redis
+// takes them with Redlock over RedisURLs, or Redis.URL when there are none,
+// and database as PostgreSQL advisory locks.
+type LockConfig struct {
+	Driver    string   `yaml:"driver"`
+	RedisURLs []string `yaml:"redis_urls"`
+}
+
+// TracingConfig is the OpenTelemetry collector spans are exported to over
+// OTLP/HTTP. Tracing is off when Endpoint is empty.
+type TracingConfig struct {
+	// Endpoint is the collector's base URL; spans are posted to
+	// <Endpoint>/v1/traces.
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the share of new traces that are recorded; requests
+	// carrying a traceparent follow the caller's decision.
+	SampleRatio float64           `yaml:"sample_ratio"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+// PointsConfig controls the expiry of earned points, the reconciliation
+// of balances with the ledger and the monthly settlement with partners. Points do not expire when ExpiryDays is 0.
+type PointsConfig struct {
+	// ExpiryDays is how long earned points stay valid.
+	ExpiryDays int `yaml:"expiry_days"`
+	// ExpirySchedule is the cron expression of the job that expires them.
+	ExpirySchedule string `yaml:"expiry_schedule"`
+	// ExpiryNoticeDays is how many days ahead members are told about points
+	// about to expire; no notice when 0.
+	ExpiryNoticeDays int `yaml:"expiry_notice_days"`
+	// StatementSchedule is the cron expression of the job that emails
+	// members their statement of the previous month; no statements when
+	// empty.
+	StatementSchedule string `yaml:"statement_schedule"`
+	// ReconcileSchedule is the cron expression of the job that compares
+	// every balance with the ledger.
+	ReconcileSchedule string `yaml:"reconcile_schedule"`
+	// ReconcilePolicy is what the job does about a balance that differs
+	// from a consistent ledger: "flag" only reports it, "fix" also sets it
+	// to the ledger's total.
+	ReconcilePolicy string `yaml:"reconcile_policy"`
+	// SettlementSchedule is the cron expression of the job that settles
+	// the points partners credited in the previous month.
+	SettlementSchedule string `yaml:"settlement_schedule"`
+}
+
+// TiersConfig controls how members are placed in the tiers of the
+// member_tiers table.
+type TiersConfig struct {
+	// QualifyingDays is the period whose earned points count towards a
+	// tier; all earned points count when 0.
+	QualifyingDays int `yaml:"qualifying_days"`
+	// Schedule is the cron expression of the job that recalculates every
+	// member's tier.
+	Schedule string `yaml:"schedule"`
+}
+
+// ReferralsConfig sets the bonus points paid when a referred member
+// verifies their email address.
+type ReferralsConfig struct {
+	// ReferrerPoints go to the member whose code was used.
+	ReferrerPoints int `yaml:"referrer_points"`
+	// ReferredPoints go to the new member.
+	ReferredPoints int `yaml:"referred_points"`
+}
+
+// AuditLogConfig controls how long the audit log is kept. Entries are kept
+// forever when RetentionDays is 0.
+type AuditLogConfig struct {
+	RetentionDays int `yaml:"retention_days"`
+	// PruneSchedule is the cron expression of the job that deletes the
+	// entries older than RetentionDays.
+	PruneSchedule string `yaml:"prune_schedule"`
+}
+
+// AccountsConfig controls accounts deleted by their owner, which can be
+// restored for DeletionGraceDays before they are purged, and the copies of
+// their data members export.
+type AccountsConfig struct {
+	DeletionGraceDays int `yaml:"deletion_grace_days"`
+	// PurgeSchedule is the cron expression of the job that purges the
+	// accounts whose grace period is over.
+	PurgeSchedule string `yaml:"purge_schedule"`
+	// DataExportRetentionDays is how long an exported archive can be
+	// downloaded before it is deleted.
+	DataExportRetentionDays int `yaml:"data_export_retention_days"`
+}
+
+// SyncConfig controls GET /sync. Rows deleted from synced resources are
+// kept as tombstones for TombstoneRetentionDays; a client whose cursor is
+// older has to sync from scratch.
+type SyncConfig struct {
+	TombstoneRetentionDays int `yaml:"tombstone_retention_days"`
+}
+
+// WalletConfig limits the stored-value wallets of members.
+type WalletConfig struct {
+	// MaxBalance is the most a member's wallet can hold, in satang; top-ups
+	// and incoming transfers above it are refused. 0 means no limit.
+	MaxBalance int `yaml:"max_balance"`
+}
+
+// StorageConfig is where uploaded files such as avatars are kept: a
+// directory served by this server ("local") or an S3-compatible bucket
+// ("s3"), e.g. on AWS or MinIO.
+type StorageConfig struct {
+	Driver string `yaml:"driver"`
+	// Dir is the directory of the local driver, served under /uploads.
+	Dir string `yaml:"dir"`
+	// PublicURL is the address files are linked at, without the trailing
+	// slash; by default public_url plus /uploads for the local driver and
+	// the bucket's own address for s3.
+	PublicURL string   `yaml:"public_url"`
+	S3        S3Config `yaml:"s3"`
+}
+
+// S3Config is the bucket of the s3 storage driver.
+type S3Config struct {
+	// Endpoint is the service's base URL, e.g. https://s3.ap-southeast-1.amazonaws.com
+	// or http://minio:9000.
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// PathStyle addresses the bucket as <endpoint>/<bucket> instead of
+	// <bucket>.<endpoint host>, as MinIO needs.
+	PathStyle bool `yaml:"path_style"`
+}
+
+// AnalyticsConfig is where the analytics export writes its Parquet files:
+// a directory ("local") or an S3-compatible bucket ("s3"), such as Google
+// Cloud Storage's interoperability endpoint for BigQuery.
+type AnalyticsConfig struct {
+	// Schedule is the cron expression of the export job; empty disables it.
+	Schedule string `yaml:"schedule"`
+	Driver   string `yaml:"driver"`
+	Dir      string `yaml:"dir"`
+	// Prefix is put before the keys of the files, e.g. "loyalty/".
+	Prefix string `yaml:"prefix"`
+	// BatchSize is the most rows a file holds; larger partitions are split.
+	BatchSize int      `yaml:"batch_size"`
+	S3        S3Config `yaml:"s3"`
+}
+
+// Production reports whether the server runs with APP_ENV=production.
+func (c *Config) Production() bool {
+	return c.AppEnv == "production"
+}
+
+// BaseURL is PublicURL without a trailing slash, which the links in emails
+// and other messages are built on; outside production it falls back to the
+// server on localhost. Links never follow the Host header of a request,
+// which a client could forge to have a token mailed under its own domain.
+func (c *Config) BaseURL() string {
+	if c.PublicURL != "" {
+		return strings.TrimSuffix(c.PublicURL, "/")
+	}
+	base := fmt.Sprintf("http://localhost:%d", c.Port)
+	if path := strings.Trim(c.BasePath, "/"); path != "" {
+		base += "/" + path
+	}
+	return base
+}
+
+// Default returns the settings used where nothing else is configured.
+func Default() *Config {
+	return &Config{
+		Port:            3000,
+		ProvidersMode:   "live",
+		ShutdownTimeout: 30 * time.Second,
+		CORS:            CORSConfig{AllowOrigins: []string{"*"}},
+		Database: DatabaseConfig{
+			Driver:             "sqlite",
+			DSN:                "app.db",
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Sharding: ShardingConfig{Tenant: "default"},
+		JWT: JWTConfig{
+			Secret:          defaultJWTSecret,
+			Issuer:          "training-kbtg-backend",
+			Audience:        "training-kbtg-api",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		BcryptCost: bcrypt.DefaultCost,
+		TOTP:       TOTPConfig{Issuer: "Training KBTG"},
+		Backup:     BackupConfig{Dir: "backups", Keep: 7},
+		Mail:       MailConfig{Driver: "log", MaxAttempts: 5},
+		SMTP:       SMTPConfig{Port: 587},
+		SMS:        SMSConfig{Driver: "log", UserHourlyLimit: 5},
+		Push:       PushConfig{Driver: "log"},
+		Moderation: ModerationConfig{Driver: "none", Threshold: "LIKELY"},
+		Events:     EventsConfig{Broker: "none", TopicPrefix: "loyalty.", NATS: NATSConfig{URL: "nats://localhost:4222"}},
+		Redis:      RedisConfig{URL: "redis://localhost:6379/0"},
+		Jobs:       JobsConfig{Backend: "memory", Concurrency: 4},
+		RateLimit: RateLimitConfig{
+			Store: "memory",
+			Auth:  Rate{Limit: 30, Window: time.Minute},
+			User:  Rate{Limit: 120, Window: time.Minute},
+			Tiers: map[string]Rate{
+				"Gold":     {Limit: 240, Window: time.Minute},
+				"Platinum": {Limit: 600, Window: time.Minute},
+			},
+			Partner: 30,
+			Plans:   map[string]int{"premium": 300},
+		},
+		Cache: CacheConfig{Backend: "memory", TTL: 5 * time.Minute},
+		Lock:  LockConfig{Driver: "memory"},
+		Tracing: TracingConfig{
+			ServiceName: "training-kbtg-backend",
+			SampleRatio: 1,
+		},
+		Points: PointsConfig{
+			ExpiryDays:         365,
+			ExpirySchedule:     "0 2 * * *",
+			ReconcileSchedule:  "15 2 * * *",
+			ReconcilePolicy:    "flag",
+			SettlementSchedule: "30 3 1 * *",
+		},
+		Tiers: TiersConfig{
+			QualifyingDays: 365,
+			Schedule:       "30 2 * * *",
+		},
+		Referrals: ReferralsConfig{
+			ReferrerPoints: 200,
+			ReferredPoints: 100,
+		},
+		Wallet:   WalletConfig{MaxBalance: 5000000},
+		AuditLog: AuditLogConfig{PruneSchedule: "0 4 * * *"},
+		Accounts: AccountsConfig{DeletionGraceDays: 30, PurgeSchedule: "30 4 * * *", DataExportRetentionDays: 7},
+		Sync:     SyncConfig{TombstoneRetentionDays: 30},
+		Storage: StorageConfig{
+			Driver: "local",
+			Dir:    "uploads",
+			S3:     S3Config{Region: "us-east-1"},
+		},
+		Analytics: AnalyticsConfig{
+			Driver:    "local",
+			Dir:       "analytics-data",
+			BatchSize: 1000000,
+			S3:        S3Config{Region: "us-east-1"},
+		},
+	}
+}
+
+var (
+	loadOnce sync.Once
+	current  *Config
+)
+
+// Get returns the configuration, loading it on first use. Invalid settings
+// stop the process.
+func Get() *Config {
+	loadOnce.Do(func() {
+		cfg, err := Load()
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		current = cfg
+	})
+	return current
+}
+
+// Load reads the configuration: the defaults, overridden by the YAML file
+// named by CONFIG_FILE (default config.yaml, skipped when missing), then by
+// environment variables. Variables from a .env file in the working directory
+// are added to the environment first, without replacing variables that are
+// already set.
+func Load() (*Config, error) {
+	if err := loadDotEnv(".env"); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	file := os.Getenv("CONFIG_FILE")
+	data, err := os.ReadFile(cmp.Or(file, "config.yaml"))
+	switch {
+	case err == nil:
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", cmp.Or(file, "config.yaml"), err)
+		}
+	case file != "" || !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if err := errors.Join(cfg.readEnv(), cfg.Validate()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port %d is out of range", c.Port)
+	if c.GRPCPort != 0 {
+		check(c.GRPCPort > 0 && c.GRPCPort < 65536, "grpc_port %d is out of range", c.GRPCPort)
+		check(c.GRPCPort != c.Port, "grpc_port must differ from port")
+		check(c.PublicURL != "", "grpc_port requires public_url for the links in verification emails")
+	}
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	check(len(c.CORS.AllowOrigins) > 0, "cors.allow_origins is empty")
+	check(c.Database.Driver != "", "database.driver is required")
+	check(c.Database.DSN != "", "database.dsn is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.SlowQueryThreshold >= 0, "database.slow_query_threshold must not be negative")
+	// Every connection to :memory: would open its own empty database
+	check(c.Database.DSN != ":memory:" || c.Database.MaxOpenConns <= 1, "database.max_open_conns must be 1 for an in-memory database")
+
+	check(tenantName.MatchString(c.Sharding.Tenant), "sharding.tenant %q must be lowercase letters, digits and dashes", c.Sharding.Tenant)
+	tenants := map[string]bool{c.Sharding.Tenant: true}
+	for i, shard := range c.Sharding.Shards {
+		check(tenantName.MatchString(shard.Tenant), "sharding.shards[%d].tenant %q must be lowercase letters, digits and dashes", i, shard.Tenant)
+		check(!tenants[shard.Tenant], "sharding.shards[%d].tenant %q has another shard", i, shard.Tenant)
+		tenants[shard.Tenant] = true
+		check(shard.Driver != "" && shard.DSN != "", "sharding.shards[%d] needs a driver and a dsn", i)
+		// The requests of every tenant are built in the dialect of the server's database
+		check(shard.Driver == c.Database.Driver, "sharding.shards[%d].driver must be database.driver, %q", i, c.Database.Driver)
+		check(shard.Driver != c.Database.Driver || shard.DSN != c.Database.DSN, "sharding.shards[%d] is the database of sharding.tenant", i)
+		check(shard.DSN != ":memory:", "sharding.shards[%d] cannot be an in-memory database", i)
+		check(shard.MaxOpenConns >= 0 && shard.MaxIdleConns >= 0, "sharding.shards[%d] connection limits must not be negative", i)
+	}
+
+	check(c.JWT.Secret != "", "jwt.secret is required")
+	check(!c.Production() || c.JWT.Secret != defaultJWTSecret, "jwt.secret (JWT_SECRET) must be set in production")
+	check(c.JWT.Issuer != "", "jwt.issuer is required")
+	check(c.JWT.Audience != "", "jwt.audience is required")
+	check(c.JWT.AccessTokenTTL > 0, "jwt.access_token_ttl must be positive")
+	check(c.JWT.RefreshTokenTTL > c.JWT.AccessTokenTTL, "jwt.refresh_token_ttl must be longer than the access token TTL")
+	check(c.JWT.SigningKey != "" || len(c.JWT.VerificationKeys) == 0, "jwt.verification_keys requires jwt.signing_key")
+
+	check(c.BcryptCost >= bcrypt.MinCost && c.BcryptCost <= bcrypt.MaxCost,
+		"bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		check(c.SMTP.Host != "", "smtp.host is required")
+		check(c.SMTP.Port > 0 && c.SMTP.Port < 65536, "smtp.port %d is out of range", c.SMTP.Port)
+	case "sendgrid":
+		check(c.Mail.SendGrid.APIKey != "", "mail.sendgrid.api_key is required")
+	default:
+		check(false, "mail.driver must be log, smtp or sendgrid, not %q", c.Mail.Driver)
+	}
+	if c.Mail.Driver != "log" {
+		_, err := mail.ParseAddress(c.Mail.From)
+		check(err == nil, "mail.from %q is not an email address", c.Mail.From)
+	}
+	check(c.Mail.MaxAttempts > 0, "mail.max_attempts must be positive")
+
+	switch c.SMS.Driver {
+	case "log":
+	case "twilio":
+		check(c.SMS.Twilio.AccountSID != "" && c.SMS.Twilio.AuthToken != "", "sms.twilio.account_sid and auth_token are required")
+		check(c.SMS.Sender != "", "sms.sender is required")
+	case "thaibulksms":
+		check(c.SMS.ThaiBulkSMS.APIKey != "" && c.SMS.ThaiBulkSMS.APISecret != "", "sms.thaibulksms.api_key and api_secret are required")
+		check(c.SMS.Sender != "", "sms.sender is required")
+	default:
+		check(false, "sms.driver must be log, twilio or thaibulksms, not %q", c.SMS.Driver)
+	}
+	check(c.SMS.UserHourlyLimit >= 0, "sms.user_hourly_limit must not be negative")
+
+	switch c.Push.Driver {
+	case "log":
+	case "fcm":
+		check(c.Push.FCM.CredentialsFile != "", "push.fcm.credentials_file is required")
+	default:
+		check(false, "push.driver must be log or fcm, not %q", c.Push.Driver)
+	}
+
+	switch c.Moderation.Driver {
+	case "none":
+	case "vision":
+		check(c.Moderation.Vision.APIKey != "", "moderation.vision.api_key is required")
+	default:
+		check(false, "moderation.driver must be none or vision, not %q", c.Moderation.Driver)
+	}
+	switch c.Moderation.Threshold {
+	case "POSSIBLE", "LIKELY", "VERY_LIKELY":
+	default:
+		check(false, "moderation.threshold must be POSSIBLE, LIKELY or VERY_LIKELY, not %q", c.Moderation.Threshold)
+	}
+
+	switch c.Events.Broker {
+	case "none":
+	case "nats":
+		u, err := url.Parse(c.Events.NATS.URL)
+		check(err == nil && (u.Scheme == "nats" || u.Scheme == "tls") && u.Host != "", "events.nats.url %q is not a nats:// or tls:// URL", c.Events.NATS.URL)
+	case "kafka":
+		u, err := url.Parse(c.Events.Kafka.RESTProxyURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "events.kafka.rest_proxy_url %q is not an http(s) URL", c.Events.Kafka.RESTProxyURL)
+	default:
+		check(false, "events.broker must be none, nats or kafka, not %q", c.Events.Broker)
+	}
+
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "redis", "rate_limit.store must be memory or redis, not %q", c.RateLimit.Store)
+	check(c.RateLimit.Partner > 0, "rate_limit.partner must be positive")
+	for plan, limit := range c.RateLimit.Plans {
+		check(plan != "" && limit > 0, "rate_limit.plans.%s must be positive", plan)
+	}
+	check(c.Jobs.Backend == "memory" || c.Jobs.Backend == "redis", "jobs.backend must be memory or redis, not %q", c.Jobs.Backend)
+	check(c.Jobs.Concurrency > 0, "jobs.concurrency must be positive")
+	check(c.Cache.Backend == "none" || c.Cache.Backend == "memory" || c.Cache.Backend == "redis", "cache.backend must be none, memory or redis, not %q", c.Cache.Backend)
+	check(c.Cache.TTL > 0, "cache.ttl must be positive")
+	switch c.Lock.Driver {
+	case "memory", "redis":
+	case "database":
+		check(c.Database.Driver == "postgres", "lock.driver database needs database.driver postgres")
+	default:
+		check(false, "lock.driver must be memory, redis or database, not %q", c.Lock.Driver)
+	}
+	for _, raw := range c.Lock.RedisURLs {
+		u, err := url.Parse(raw)
+		check(err == nil && (u.Scheme == "redis" || u.Scheme == "rediss"), "lock.redis_urls: %q is not a redis:// or rediss:// URL", raw)
+	}
+	if c.RateLimit.Store == "redis" || c.Jobs.Backend == "redis" || c.Cache.Backend == "redis" || (c.Lock.Driver == "redis" && len(c.Lock.RedisURLs) == 0) {
+		u, err := url.Parse(c.Redis.URL)
+		check(err == nil && (u.Scheme == "redis" || u.Scheme == "rediss"), "redis.url %q is not a redis:// or rediss:// URL", c.Redis.URL)
+	}
+
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"tracing.endpoint %q is not an http(s) URL", c.Tracing.Endpoint)
+		check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	for _, setting := range []struct{ name, value string }{
+		{"public_url", c.PublicURL},
+		{"password_reset_url", c.PasswordResetURL},
+		{"email_verification_url", c.EmailVerificationURL},
+		{"replay_target_url", c.ReplayTargetURL},
+	} {
+		if setting.value != "" {
+			u, err := url.Parse(setting.value)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"%s %q is not an http(s) URL", setting.name, setting.value)
+		}
+	}
+	check(!c.Production() || c.PublicURL != "", "public_url (PUBLIC_URL) must be set in production; emailed links are built from it")
+	check(c.ProvidersMode == "live" || c.ProvidersMode == "mock", "providers_mode must be live or mock, not %q", c.ProvidersMode)
+
+	switch c.Swagger.Mode {
+	case "", "open", "disabled":
+	case "basic":
+		check(c.Swagger.User != "" && c.Swagger.Password != "", "swagger.user and swagger.password are required for swagger.mode basic")
+	default:
+		check(false, "swagger.mode must be open, basic or disabled, not %q", c.Swagger.Mode)
+	}
+	check(c.TOTP.Issuer != "", "totp.issuer is required")
+	check(c.TOTP.EncryptionKey == "" || len(c.TOTP.EncryptionKey) >= 16, "totp.encryption_key must be at least 16 characters")
+	check(c.Backup.Dir != "", "backup.dir is required")
+	check(c.Backup.Keep > 0, "backup.keep must be positive")
+
+	check(c.Points.ExpiryDays >= 0, "points.expiry_days must not be negative")
+	if c.Points.ExpiryDays > 0 {
+		schedule, err := scheduler.Parse(c.Points.ExpirySchedule)
+		check(err == nil, "points.expiry_schedule: %v", err)
+		check(err != nil || !schedule.Next(time.Now()).IsZero(), "points.expiry_schedule %q is never due", c.Points.ExpirySchedule)
+		check(c.Points.ExpiryNoticeDays >= 0 && c.Points.ExpiryNoticeDays < c.Points.ExpiryDays,
+			"points.expiry_notice_days must be between 0 and points.expiry_days")
+		check(c.Points.ExpiryNoticeDays == 0 || c.PublicURL != "", "points.expiry_notice_days requires public_url for the links in the notice")
+	}
+
+	if c.Points.StatementSchedule != "" {
+		schedule, err := scheduler.Parse(c.Points.StatementSchedule)
+		check(err == nil, "points.statement_schedule: %v", err)
+		check(err != nil || !schedule.Next(time.Now()).IsZero(), "points.statement_schedule %q is never due", c.Points.StatementSchedule)
+		check(c.PublicURL != "", "points.statement_schedule requires public_url for the links in the statement")
+	}
+
+	reconcileSchedule, err := scheduler.Parse(c.Points.ReconcileSchedule)
+	check(err == nil, "points.reconcile_schedule: %v", err)
+	check(err != nil || !reconcileSchedule.Next(time.Now()).IsZero(), "points.reconcile_schedule %q is never due", c.Points.ReconcileSchedule)
+	check(c.Points.ReconcilePolicy == "flag" || c.Points.ReconcilePolicy == "fix", "points.reconcile_policy must be flag or fix, not %q", c.Points.ReconcilePolicy)
+	settlementSchedule, err := scheduler.Parse(c.Points.SettlementSchedule)
+	check(err == nil, "points.settlement_schedule: %v", err)
+	check(err != nil || !settlementSchedule.Next(time.Now()).IsZero(), "points.settlement_schedule %q is never due", c.Points.SettlementSchedule)
+
+	check(c.Tiers.QualifyingDays >= 0, "tiers.qualifying_days must not be negative")
+	tierSchedule, err := scheduler.Parse(c.Tiers.Schedule)
+	check(err == nil, "tiers.schedule: %v", err)
+	check(err != nil || !tierSchedule.Next(time.Now()).IsZero(), "tiers.schedule %q is never due", c.Tiers.Schedule)
+
+	check(c.AuditLog.RetentionDays >= 0, "audit_log.retention_days must not be negative")
+	if c.AuditLog.RetentionDays > 0 {
+		schedule, err := scheduler.Parse(c.AuditLog.PruneSchedule)
+		check(err == nil, "audit_log.prune_schedule: %v", err)
+		check(err != nil || !schedule.Next(time.Now()).IsZero(), "audit_log.prune_schedule %q is never due", c.AuditLog.PruneSchedule)
+	}
+
+	check(c.Accounts.DeletionGraceDays > 0, "accounts.deletion_grace_days must be positive")
+	purgeSchedule, err := scheduler.Parse(c.Accounts.PurgeSchedule)
+	check(err == nil, "accounts.purge_schedule: %v", err)
+	check(err != nil || !purgeSchedule.Next(time.Now()).IsZero(), "accounts.purge_schedule %q is never due", c.Accounts.PurgeSchedule)
+	check(c.Accounts.DataExportRetentionDays > 0, "accounts.data_export_retention_days must be positive")
+	check(c.Sync.TombstoneRetentionDays > 0, "sync.tombstone_retention_days must be positive")
+
+	check(c.Referrals.ReferrerPoints >= 0, "referrals.referrer_points must not be negative")
+	check(c.Referrals.ReferredPoints >= 0, "referrals.referred_points must not be negative")
+	check(c.Wallet.MaxBalance >= 0, "wallet.max_balance must not be negative")
+
+	switch c.Storage.Driver {
+	case "local":
+		check(c.Storage.Dir != "", "storage.dir is required")
+	case "s3":
+		u, err := url.Parse(c.Storage.S3.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"storage.s3.endpoint %q is not an http(s) URL", c.Storage.S3.Endpoint)
+		check(c.Storage.S3.Region != "", "storage.s3.region is required")
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket is required")
+		check(c.Storage.S3.AccessKey != "" && c.Storage.S3.SecretKey != "", "storage.s3.access_key and secret_key are required")
+	default:
+		check(false, "storage.driver must be local or s3, not %q", c.Storage.Driver)
+	}
+	if c.Storage.PublicURL != "" {
+		u, err := url.Parse(c.Storage.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"storage.public_url %q is not an http(s) URL", c.Storage.PublicURL)
+	}
+
+	if c.Analytics.Schedule != "" {
+		schedule, err := scheduler.Parse(c.Analytics.Schedule)
+		check(err == nil, "analytics.schedule: %v", err)
+		check(err != nil || !schedule.Next(time.Now()).IsZero(), "analytics.schedule %q is never due", c.Analytics.Schedule)
+	}
+	switch c.Analytics.Driver {
+	case "local":
+		check(c.Analytics.Dir != "", "analytics.dir is required")
+	case "s3":
+		u, err := url.Parse(c.Analytics.S3.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"analytics.s3.endpoint %q is not an http(s) URL", c.Analytics.S3.Endpoint)
+		check(c.Analytics.S3.Region != "", "analytics.s3.region is required")
+		check(c.Analytics.S3.Bucket != "", "analytics.s3.bucket is required")
+		check(c.Analytics.S3.AccessKey != "" && c.Analytics.S3.SecretKey != "", "analytics.s3.access_key and secret_key are required")
+	default:
+		check(false, "analytics.driver must be local or s3, not %q", c.Analytics.Driver)
+	}
+	check(c.Analytics.BatchSize > 0, "analytics.batch_size must be positive")
+
+	for _, provider := range c.OAuth.clients() {
+		name, client := provider.name, *provider.client
+		check((client.ClientID == "") == (client.ClientSecret == ""), "oauth.%s.client_id and client_secret must be set together", name)
+		if client.RedirectURL != "" {
+			u, err := url.Parse(client.RedirectURL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"oauth.%s.redirect_url %q is not an http(s) URL", name, client.RedirectURL)
+		}
+	}
+
+	return errors.Join(errs...)
+}
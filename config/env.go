@@ -0,0 +1,357 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readEnv overrides the settings with the environment variables that are
+// set and not empty.
+func (c *Config) readEnv() error {
+	r := envReader{}
+
+	r.string("APP_ENV", &c.AppEnv)
+	r.int("PORT", &c.Port)
+	r.int("GRPC_PORT", &c.GRPCPort)
+	r.string("BASE_PATH", &c.BasePath)
+	r.string("PUBLIC_URL", &c.PublicURL)
+	r.string("PROVIDERS_MODE", &c.ProvidersMode)
+	r.duration("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+	r.list("TRUSTED_PROXIES", &c.TrustedProxies)
+	r.list("CORS_ALLOW_ORIGINS", &c.CORS.AllowOrigins)
+
+	r.string("DB_DRIVER", &c.Database.Driver)
+	r.string("DB_DSN", &c.Database.DSN)
+	r.bool("DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+	r.bool("DB_SEED", &c.Database.Seed)
+	r.string("SEED_ADMIN_PASSWORD", &c.Database.SeedAdminPassword)
+	r.int("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	r.int("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	r.duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	r.duration("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	r.duration("DB_SLOW_QUERY_THRESHOLD", &c.Database.SlowQueryThreshold)
+	r.string("SHARDING_TENANT", &c.Sharding.Tenant)
+
+	r.string("JWT_SECRET", &c.JWT.Secret)
+	r.string("JWT_ISSUER", &c.JWT.Issuer)
+	r.string("JWT_AUDIENCE", &c.JWT.Audience)
+	r.duration("ACCESS_TOKEN_TTL", &c.JWT.AccessTokenTTL)
+	r.duration("REFRESH_TOKEN_TTL", &c.JWT.RefreshTokenTTL)
+	r.string("JWT_SIGNING_KEY", &c.JWT.SigningKey)
+	r.list("JWT_VERIFICATION_KEYS", &c.JWT.VerificationKeys)
+
+	r.int("BCRYPT_COST", &c.BcryptCost)
+	r.bool("REQUIRE_EMAIL_VERIFICATION", &c.RequireEmailVerification)
+	r.string("TERMS_VERSION", &c.TermsVersion)
+	r.bool("EMAIL_FOLD_ALIASES", &c.FoldEmailAliases)
+	r.string("PASSWORD_RESET_URL", &c.PasswordResetURL)
+	r.string("EMAIL_VERIFICATION_URL", &c.EmailVerificationURL)
+	r.bool("CAPTURE_FAILED_REQUESTS", &c.CaptureFailedRequests)
+	r.string("REPLAY_TARGET_URL", &c.ReplayTargetURL)
+	r.string("EMAIL_WEBHOOK_SECRET", &c.WebhookSecrets.Email)
+	r.string("SMS_WEBHOOK_SECRET", &c.WebhookSecrets.SMS)
+
+	r.string("SWAGGER_MODE", &c.Swagger.Mode)
+	r.string("SWAGGER_USER", &c.Swagger.User)
+	r.string("SWAGGER_PASSWORD", &c.Swagger.Password)
+	r.string("SWAGGER_HOST", &c.Swagger.Host)
+	r.string("SWAGGER_BASE_PATH", &c.Swagger.BasePath)
+
+	r.string("TOTP_ISSUER", &c.TOTP.Issuer)
+	r.string("TOTP_ENCRYPTION_KEY", &c.TOTP.EncryptionKey)
+	r.string("BACKUP_DIR", &c.Backup.Dir)
+	r.string("BACKUP_KEY", &c.Backup.Key)
+	r.int("BACKUP_KEEP", &c.Backup.Keep)
+
+	r.string("MAIL_DRIVER", &c.Mail.Driver)
+	// SMTP_FROM is the name the sender had when only SMTP was planned
+	r.string("SMTP_FROM", &c.Mail.From)
+	r.string("MAIL_FROM", &c.Mail.From)
+	r.string("SENDGRID_API_KEY", &c.Mail.SendGrid.APIKey)
+	r.int("MAIL_MAX_ATTEMPTS", &c.Mail.MaxAttempts)
+	r.string("SMTP_HOST", &c.SMTP.Host)
+	r.int("SMTP_PORT", &c.SMTP.Port)
+	r.string("SMTP_USERNAME", &c.SMTP.Username)
+	r.string("SMTP_PASSWORD", &c.SMTP.Password)
+
+	r.string("SMS_DRIVER", &c.SMS.Driver)
+	r.string("SMS_SENDER", &c.SMS.Sender)
+	r.string("TWILIO_ACCOUNT_SID", &c.SMS.Twilio.AccountSID)
+	r.string("TWILIO_AUTH_TOKEN", &c.SMS.Twilio.AuthToken)
+	r.string("THAIBULKSMS_API_KEY", &c.SMS.ThaiBulkSMS.APIKey)
+	r.string("THAIBULKSMS_API_SECRET", &c.SMS.ThaiBulkSMS.APISecret)
+	r.int("SMS_USER_HOURLY_LIMIT", &c.SMS.UserHourlyLimit)
+
+	r.string("PUSH_DRIVER", &c.Push.Driver)
+	r.string("FCM_CREDENTIALS_FILE", &c.Push.FCM.CredentialsFile)
+	r.string("MODERATION_DRIVER", &c.Moderation.Driver)
+	r.string("MODERATION_THRESHOLD", &c.Moderation.Threshold)
+	r.string("MODERATION_VISION_API_KEY", &c.Moderation.Vision.APIKey)
+	r.string("EVENTS_BROKER", &c.Events.Broker)
+	r.string("EVENTS_TOPIC_PREFIX", &c.Events.TopicPrefix)
+	r.string("NATS_URL", &c.Events.NATS.URL)
+	r.string("KAFKA_REST_PROXY_URL", &c.Events.Kafka.RESTProxyURL)
+	r.string("KAFKA_USERNAME", &c.Events.Kafka.Username)
+	r.string("KAFKA_PASSWORD", &c.Events.Kafka.Password)
+
+	r.string("REDIS_URL", &c.Redis.URL)
+	r.string("RATE_LIMIT_STORE", &c.RateLimit.Store)
+	r.rate("AUTH_RATE_LIMIT", &c.RateLimit.Auth)
+	r.rate("USER_RATE_LIMIT", &c.RateLimit.User)
+	r.rates("USER_RATE_LIMIT_TIERS", &c.RateLimit.Tiers)
+	r.int("PARTNER_RATE_LIMIT", &c.RateLimit.Partner)
+	r.counts("PARTNER_RATE_LIMIT_PLANS", &c.RateLimit.Plans)
+	r.string("JOBS_BACKEND", &c.Jobs.Backend)
+	r.int("JOBS_CONCURRENCY", &c.Jobs.Concurrency)
+	r.string("CACHE_BACKEND", &c.Cache.Backend)
+	r.duration("CACHE_TTL", &c.Cache.TTL)
+	r.string("LOCK_DRIVER", &c.Lock.Driver)
+	r.list("LOCK_REDIS_URLS", &c.Lock.RedisURLs)
+
+	r.string("OTEL_EXPORTER_OTLP_ENDPOINT", &c.Tracing.Endpoint)
+	r.string("OTEL_SERVICE_NAME", &c.Tracing.ServiceName)
+	r.float("OTEL_TRACES_SAMPLER_ARG", &c.Tracing.SampleRatio)
+	r.pairs("OTEL_EXPORTER_OTLP_HEADERS", &c.Tracing.Headers)
+
+	r.int("POINTS_EXPIRY_DAYS", &c.Points.ExpiryDays)
+	r.string("POINTS_EXPIRY_SCHEDULE", &c.Points.ExpirySchedule)
+	r.int("POINTS_EXPIRY_NOTICE_DAYS", &c.Points.ExpiryNoticeDays)
+	r.string("POINTS_STATEMENT_SCHEDULE", &c.Points.StatementSchedule)
+	r.string("POINTS_RECONCILE_SCHEDULE", &c.Points.ReconcileSchedule)
+	r.string("POINTS_RECONCILE_POLICY", &c.Points.ReconcilePolicy)
+	r.string("POINTS_SETTLEMENT_SCHEDULE", &c.Points.SettlementSchedule)
+
+	r.int("TIER_QUALIFYING_DAYS", &c.Tiers.QualifyingDays)
+	r.string("TIER_SCHEDULE", &c.Tiers.Schedule)
+
+	r.int("REFERRAL_REFERRER_POINTS", &c.Referrals.ReferrerPoints)
+	r.int("REFERRAL_REFERRED_POINTS", &c.Referrals.ReferredPoints)
+
+	r.int("WALLET_MAX_BALANCE", &c.Wallet.MaxBalance)
+
+	r.int("AUDIT_LOG_RETENTION_DAYS", &c.AuditLog.RetentionDays)
+	r.string("AUDIT_LOG_PRUNE_SCHEDULE", &c.AuditLog.PruneSchedule)
+	r.int("ACCOUNT_DELETION_GRACE_DAYS", &c.Accounts.DeletionGraceDays)
+	r.string("ACCOUNT_PURGE_SCHEDULE", &c.Accounts.PurgeSchedule)
+	r.int("ACCOUNT_DATA_EXPORT_RETENTION_DAYS", &c.Accounts.DataExportRetentionDays)
+	r.int("SYNC_TOMBSTONE_RETENTION_DAYS", &c.Sync.TombstoneRetentionDays)
+
+	for _, provider := range c.OAuth.clients() {
+		prefix, client := strings.ToUpper(provider.name), provider.client
+		r.string(prefix+"_CLIENT_ID", &client.ClientID)
+		r.string(prefix+"_CLIENT_SECRET", &client.ClientSecret)
+		r.string(prefix+"_REDIRECT_URL", &client.RedirectURL)
+	}
+
+	r.string("STORAGE_DRIVER", &c.Storage.Driver)
+	r.string("STORAGE_DIR", &c.Storage.Dir)
+	r.string("STORAGE_PUBLIC_URL", &c.Storage.PublicURL)
+	r.string("S3_ENDPOINT", &c.Storage.S3.Endpoint)
+	r.string("S3_REGION", &c.Storage.S3.Region)
+	r.string("S3_BUCKET", &c.Storage.S3.Bucket)
+	r.string("S3_ACCESS_KEY", &c.Storage.S3.AccessKey)
+	r.string("S3_SECRET_KEY", &c.Storage.S3.SecretKey)
+	r.bool("S3_PATH_STYLE", &c.Storage.S3.PathStyle)
+
+	r.string("ANALYTICS_SCHEDULE", &c.Analytics.Schedule)
+	r.string("ANALYTICS_DRIVER", &c.Analytics.Driver)
+	r.string("ANALYTICS_DIR", &c.Analytics.Dir)
+	r.string("ANALYTICS_PREFIX", &c.Analytics.Prefix)
+	r.int("ANALYTICS_BATCH_SIZE", &c.Analytics.BatchSize)
+	r.string("ANALYTICS_S3_ENDPOINT", &c.Analytics.S3.Endpoint)
+	r.string("ANALYTICS_S3_REGION", &c.Analytics.S3.Region)
+	r.string("ANALYTICS_S3_BUCKET", &c.Analytics.S3.Bucket)
+	r.string("ANALYTICS_S3_ACCESS_KEY", &c.Analytics.S3.AccessKey)
+	r.string("ANALYTICS_S3_SECRET_KEY", &c.Analytics.S3.SecretKey)
+	r.bool("ANALYTICS_S3_PATH_STYLE", &c.Analytics.S3.PathStyle)
+
+	return errors.Join(r.errs...)
+}
+
+// envReader parses environment variables into settings and collects the
+// values it cannot parse.
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) lookup(key string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(key))
+	return value, value != ""
+}
+
+func (r *envReader) fail(key, value string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("%s=%q: %w", key, value, err))
+}
+
+func (r *envReader) string(key string, dst *string) {
+	if value, ok := r.lookup(key); ok {
+		*dst = value
+	}
+}
+
+// list reads a comma-separated list.
+func (r *envReader) list(key string, dst *[]string) {
+	value, ok := r.lookup(key)
+	if !ok {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
+
+func (r *envReader) int(key string, dst *int) {
+	if value, ok := r.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.fail(key, value, errors.New("not a number"))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) float(key string, dst *float64) {
+	if value, ok := r.lookup(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.fail(key, value, errors.New("not a number"))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (r *envReader) bool(key string, dst *bool) {
+	if value, ok := r.lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			r.fail(key, value, errors.New("not true or false"))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (r *envReader) duration(key string, dst *time.Duration) {
+	if value, ok := r.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.fail(key, value, errors.New("not a duration such as 15m"))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (r *envReader) rate(key string, dst *Rate) {
+	if value, ok := r.lookup(key); ok {
+		rate, err := ParseRate(value)
+		if err != nil {
+			r.fail(key, value, err)
+			return
+		}
+		*dst = rate
+	}
+}
+
+// pairs reads comma-separated key=value pairs.
+func (r *envReader) pairs(key string, dst *map[string]string) {
+	value, ok := r.lookup(key)
+	if !ok {
+		return
+	}
+	pairs := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(item, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			r.fail(key, value, errors.New("not a list of key=value pairs"))
+			return
+		}
+		pairs[k] = strings.TrimSpace(v)
+	}
+	*dst = pairs
+}
+
+// loadDotEnv sets the KEY=value lines of file as environment variables
+// unless they are already set. Blank lines, "#" comments and an "export "
+// prefix are allowed, and values may be quoted. A missing file is ignored.
+func loadDotEnv(file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=value", file, line)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// rates reads comma-separated name=rate pairs, e.g. Gold=240/1m.
+func (r *envReader) rates(key string, dst *map[string]Rate) {
+	var pairs map[string]string
+	if r.pairs(key, &pairs); pairs == nil {
+		return
+	}
+	rates := map[string]Rate{}
+	for name, value := range pairs {
+		rate, err := ParseRate(value)
+		if err != nil {
+			r.fail(key, value, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		rates[name] = rate
+	}
+	*dst = rates
+}
+
+// counts reads comma-separated name=number pairs, e.g. premium=300.
+func (r *envReader) counts(key string, dst *map[string]int) {
+	var pairs map[string]string
+	if r.pairs(key, &pairs); pairs == nil {
+		return
+	}
+	counts := map[string]int{}
+	for name, value := range pairs {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.fail(key, value, fmt.Errorf("%s: not a number", name))
+			return
+		}
+		counts[name] = n
+	}
+	*dst = counts
+}
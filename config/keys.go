@@ -0,0 +1,17 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// DeriveKey returns HMAC-SHA256(secret, purpose), a key of its own for each
+// kind of token signed or data sealed with secret, usually the JWT secret.
+// A token signed with the key of one purpose, e.g. "unsubscribe", so never
+// passes as one of another, or as a login token signed with secret itself.
+// Changing purpose or secret invalidates everything signed with the key.
+func DeriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
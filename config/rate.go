@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a request limit per window, written as "<requests>/<window>",
+// e.g. "30/1m". A zero Limit ("off") turns the limiter off.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Off reports whether the limiter is turned off.
+func (r Rate) Off() bool {
+	return r.Limit == 0
+}
+
+func (r Rate) String() string {
+	if r.Off() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// ParseRate parses "<requests>/<window>" or "off".
+func ParseRate(value string) (Rate, error) {
+	if value == "off" {
+		return Rate{}, nil
+	}
+	count, per, _ := strings.Cut(value, "/")
+	n, err := strconv.Atoi(count)
+	d, derr := time.ParseDuration(per)
+	if err != nil || derr != nil || n <= 0 || d <= 0 {
+		return Rate{}, errors.New(`not a rate such as "30/1m" or "off"`)
+	}
+	return Rate{Limit: n, Window: d}, nil
+}
+
+// UnmarshalYAML reads a rate written like the environment variables.
+func (r *Rate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	rate, err := ParseRate(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("rate %q: %w", value, err)
+	}
+	*r = rate
+	return nil
+}
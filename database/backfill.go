@@ -0,0 +1,164 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/referral"
+
+	"gorm.io/gorm"
+)
+
+// backfillEmails normalizes stored emails and fills email_canonical. Rows
+// whose canonical email collides with another account are left blank and
+// logged so they can be merged by hand; they can still log in with their
+// exact address.
+func backfillEmails(db *gorm.DB) error {
+	var users []models.User
+	return db.Unscoped().Select("id", "email", "email_canonical", "deleted_at").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				email := normalize.Email(user.Email)
+				canonical := normalize.CanonicalEmail(user.Email)
+				if email == user.Email && canonical == user.EmailCanonical {
+					continue
+				}
+
+				var conflicts int64
+				db.Model(&models.User{}).
+					Where("id <> ? AND (email = ? OR email_canonical = ?)", user.ID, email, canonical).
+					Count(&conflicts)
+				if conflicts > 0 && !user.DeletedAt.Valid {
+					log.Printf("Email backfill: user %d conflicts with another account, needs manual merge", user.ID)
+					continue
+				}
+
+				err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).
+					UpdateColumns(map[string]interface{}{"email": email, "email_canonical": canonical}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillPhones rewrites stored phone numbers to E.164. Numbers that cannot
+// be parsed, or whose verified E.164 form is already verified on another
+// account, are left as they are and logged.
+func backfillPhones(db *gorm.DB) error {
+	var users []models.User
+	return db.Unscoped().Select("id", "phone", "phone_verified_at", "deleted_at").
+		Where("phone <> '' AND phone NOT LIKE '+%'").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				phone, err := normalize.ParsePhone(user.Phone)
+				if err != nil {
+					log.Printf("Phone backfill: user %d has an unparseable phone number", user.ID)
+					continue
+				}
+
+				if user.PhoneVerifiedAt != nil && !user.DeletedAt.Valid {
+					var conflicts int64
+					db.Model(&models.User{}).
+						Where("id <> ? AND phone = ? AND phone_verified_at IS NOT NULL", user.ID, phone.E164).
+						Count(&conflicts)
+					if conflicts > 0 {
+						log.Printf("Phone backfill: user %d shares a verified number with another account, needs manual review", user.ID)
+						continue
+					}
+				}
+
+				err = db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).
+					UpdateColumn("phone", phone.E164).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillReferralCodes gives a referral code to every account that has
+// none, such as those created before referrals existed.
+func backfillReferralCodes(db *gorm.DB) error {
+	var users []models.User
+	return db.Unscoped().Select("id").Where("referral_code = '' OR referral_code IS NULL").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).
+					UpdateColumn("referral_code", referral.NewCode()).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillEmailVerified marks accounts that existed before email
+// verification as verified at sign-up, so requiring verification does not
+// lock them out.
+func backfillEmailVerified(db *gorm.DB) error {
+	return db.Unscoped().Model(&models.User{}).
+		Where("email_verified_at IS NULL").
+		UpdateColumn("email_verified_at", gorm.Expr("created_at")).Error
+}
+
+// backfillPointLedger records the balance every user had before the points
+// ledger existed as an opening adjustment, so that each balance equals the
+// balance_after of the user's latest entry.
+func backfillPointLedger(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO point_transactions (created_at, user_id, type, amount, balance_after, reason, remaining)
+		SELECT ?, id, ?, points, points, ?, points FROM users WHERE points <> 0`,
+		time.Now(), models.PointTransactionAdjust, "Opening balance").Error
+}
+
+// backfillPointLots turns the credits posted before point lots existed into
+// lots. The balance of each user is what is left of their latest credits, as
+// older points were spent first. Earned points left over get a full expiry
+// period from now rather than from when they were earned, so nothing expires
+// the night expiry is introduced.
+func backfillPointLots(db *gorm.DB) error {
+	var expiresAt *time.Time
+	if days := config.Get().Points.ExpiryDays; days > 0 {
+		t := time.Now().AddDate(0, 0, days)
+		expiresAt = &t
+	}
+
+	var users []models.User
+	return db.Unscoped().Select("id", "points").Where("points > 0").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				var credits []models.PointTransaction
+				err := db.Select("id", "type", "amount").
+					Where("user_id = ? AND amount > 0", user.ID).
+					Order("id DESC").Find(&credits).Error
+				if err != nil {
+					return err
+				}
+
+				left := user.Points
+				for _, credit := range credits {
+					if left == 0 {
+						break
+					}
+					updates := map[string]interface{}{"remaining": min(left, credit.Amount)}
+					if credit.Type == models.PointTransactionEarn {
+						updates["expires_at"] = expiresAt
+					}
+					if err := db.Model(&models.PointTransaction{}).Where("id = ?", credit.ID).UpdateColumns(updates).Error; err != nil {
+						return err
+					}
+					left -= min(left, credit.Amount)
+				}
+				if left > 0 {
+					log.Printf("Point lot backfill: user %d has %d points not covered by the ledger", user.ID, left)
+				}
+			}
+			return nil
+		}).Error
+}
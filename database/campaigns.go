@@ -0,0 +1,27 @@
+package database
+
+import (
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultCampaigns is the onboarding campaign set inserted by Migrate.
+// Existing rows are left untouched so points, dates and deactivations made
+// through the admin API survive restarts.
+var defaultCampaigns = []models.Campaign{
+	{Code: "welcome", Name: "Welcome bonus", Event: models.CampaignEventRegistration, Points: 100, Active: true},
+	{Code: "complete_profile", Name: "Complete your profile", Event: models.CampaignEventProfileCompleted, Points: 50, Active: true},
+	{Code: "verify_phone", Name: "Verify your phone number", Event: models.CampaignEventPhoneVerified, Points: 50, Active: true},
+}
+
+// seedCampaigns inserts any missing default campaigns.
+func seedCampaigns(db *gorm.DB) error {
+	for _, campaign := range defaultCampaigns {
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&campaign).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
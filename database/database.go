@@ -3,36 +3,282 @@ package database
 import (
 	"log"
 
+	"temp-backend-at-kbtg/config"
 	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/search"
+	"temp-backend-at-kbtg/tracing"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
-
-func Connect() {
-	var err error
-	DB, err = gorm.Open(sqlite.Open("app.db"), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+// Connect opens the database selected by DB_DRIVER and DB_DSN, applies
+// pending migrations when DB_AUTO_MIGRATE is set and seeds demo data when
+// DB_SEED is set (both always for in-memory DBs). Without DB_AUTO_MIGRATE it
+// refuses to start while migrations are pending.
+func Connect(cfg config.DatabaseConfig) *gorm.DB {
+	driver, dsn := cfg.Driver, cfg.DSN
 
+	db, err := Open(cfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	log.Println("Connected to SQLite database")
+	log.Printf("Connected to %s database (%s)", driver, redactDSN(driver, dsn))
+
+	if dsn == ":memory:" || cfg.AutoMigrate {
+		if err := Migrate(db); err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+		log.Println("Database migration completed")
+	} else {
+		pending, err := PendingMigrations(db)
+		if err != nil {
+			log.Fatal("Failed to read applied migrations:", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("Database has pending migrations %v; run `go run main.go migrate up` or set DB_AUTO_MIGRATE=true", pending)
+		}
+		if err := seedReferenceData(db); err != nil {
+			log.Fatal("Failed to seed reference data:", err)
+		}
+	}
+
+	if dsn == ":memory:" || cfg.Seed {
+		if err := Seed(db); err != nil {
+			log.Fatal("Failed to seed database:", err)
+		}
+		log.Println("Database seeding completed")
+	}
+	return db
+}
+
+// Settings returns the driver and DSN selected by DB_DRIVER and DB_DSN.
+func Settings() (driver, dsn string) {
+	settings := config.Get().Database
+	return settings.Driver, settings.DSN
+}
 
-	// Auto migrate the schema
-	err = DB.AutoMigrate(&models.User{})
+// Open creates a GORM connection for the driver and DSN of cfg, with the
+// driver's connection pool defaults overridden by the limits set in cfg.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	driver, err := lookupDriver(cfg.Driver)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return nil, err
+	}
+
+	db, err := gorm.Open(driver.open(cfg.DSN), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin()); err != nil {
+		return nil, err
+	}
+	if err := db.Use(search.Plugin(search.Default)); err != nil {
+		return nil, err
+	}
+
+	if cfg.SlowQueryThreshold > 0 {
+		if err := db.Use(slowQueryPlugin{threshold: cfg.SlowQueryThreshold}); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := driver.pool(cfg.DSN)
+	pool.override(poolSettings{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+	})
+	if err := applyPool(db, pool); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Close closes the connection pool of db.
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// SchemaDrift lists the tables and columns of the current models that are
+// missing from db, i.e. what a model change added without a migration.
+func SchemaDrift(db *gorm.DB) ([]string, error) {
+	var pending []string
+	for _, model := range schema {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(model) {
+			pending = append(pending, "table "+table)
+			continue
+		}
+
+		columns, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			existing[column.Name()] = true
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if !existing[name] {
+				pending = append(pending, "column "+table+"."+name)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// schema lists the models migration 1 creates tables for.
+var schema = []interface{}{
+	&models.User{},
+	&models.CapturedRequest{},
+	&models.MemberTier{},
+	&models.MemberTierTranslation{},
+	&models.AuditLog{},
+	&models.PhoneVerification{},
+	&models.Device{},
+	&models.Address{},
+	&models.Partner{},
+	&models.WebhookEndpoint{},
+	&models.WebhookDelivery{},
+	&models.PendingEvent{},
+	&models.Campaign{},
+	&models.CampaignAward{},
+	&models.NotificationPreference{},
+	&models.UserSettings{},
+	&models.Notification{},
+	&models.PointsStatement{},
+	&models.SMSMessage{},
+	&models.SuppressedAddress{},
+	&models.ExperimentExposure{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.PasswordReset{},
+	&models.EmailVerification{},
+	&models.UserIdentity{},
+	&models.TwoFactor{},
+	&models.RecoveryCode{},
+	&models.LoginOTP{},
+	&models.Session{},
+	&models.APIKey{},
+	&models.PointTransaction{},
+	&models.TierChange{},
+	&models.Reward{},
+	&models.Redemption{},
+	&models.Referral{},
+	&models.Coupon{},
+	&models.CouponUse{},
+	&models.WalletAccount{},
+	&models.WalletTransaction{},
+	&models.WalletEntry{},
+	&models.ScheduledRun{},
+}
+
+// Migrate applies the pending migrations and inserts missing reference
+// data.
+func Migrate(db *gorm.DB) error {
+	if _, err := MigrateUp(db); err != nil {
+		return err
 	}
+	return seedReferenceData(db)
+}
 
-	log.Println("Database migration completed")
+// seedReferenceData inserts the default tiers and campaigns that are
+// missing.
+func seedReferenceData(db *gorm.DB) error {
+	if err := seedTiers(db); err != nil {
+		return err
+	}
+	return seedCampaigns(db)
 }
 
-func GetDB() *gorm.DB {
-	return DB
+// legacyMigrate is how databases were upgraded before versioned migrations:
+// AutoMigrate followed by backfills of the columns it added. It only runs
+// to adopt such a database at migration 1.
+func legacyMigrate(db *gorm.DB) error {
+	// Unique indexes on users only cover rows that are not soft-deleted;
+	// drop the old full-table indexes they replace.
+	for _, index := range []string{"idx_users_email", "idx_users_membership_id"} {
+		if db.Migrator().HasIndex(&models.User{}, index) {
+			if err := db.Migrator().DropIndex(&models.User{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Tiers created before earn multipliers existed get the defaults
+	addingMultipliers := db.Migrator().HasTable(&models.MemberTier{}) &&
+		!db.Migrator().HasColumn(&models.MemberTier{}, "earn_multiplier")
+
+	// Tiers created before automatic tier placement get the default
+	// thresholds
+	addingThresholds := db.Migrator().HasTable(&models.MemberTier{}) &&
+		!db.Migrator().HasColumn(&models.MemberTier{}, "min_points")
+
+	// Accounts created before email verification existed count as verified
+	addingEmailVerification := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
+	// Balances from before the points ledger become its opening entries
+	addingLedger := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasTable(&models.PointTransaction{})
+
+	// Ledger credits from before point expiry become lots
+	addingLots := db.Migrator().HasTable(&models.PointTransaction{}) &&
+		!db.Migrator().HasColumn(&models.PointTransaction{}, "remaining")
+
+	err := db.AutoMigrate(schema...)
+	if err != nil {
+		return err
+	}
+
+	if err := backfillEmails(db); err != nil {
+		return err
+	}
+	if err := backfillPhones(db); err != nil {
+		return err
+	}
+	if err := backfillReferralCodes(db); err != nil {
+		return err
+	}
+	if addingEmailVerification {
+		if err := backfillEmailVerified(db); err != nil {
+			return err
+		}
+	}
+	if addingMultipliers {
+		if err := backfillEarnMultipliers(db); err != nil {
+			return err
+		}
+	}
+	if addingThresholds {
+		if err := backfillTierThresholds(db); err != nil {
+			return err
+		}
+	}
+	if addingLedger {
+		if err := backfillPointLedger(db); err != nil {
+			return err
+		}
+	}
+	if addingLots {
+		if err := backfillPointLots(db); err != nil {
+			return err
+		}
+	}
+	return nil
 }
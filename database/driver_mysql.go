@@ -0,0 +1,48 @@
+//go:build mysql
+
+package database
+
+import (
+	"regexp"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// mysqlPassword matches the password of a user:password@tcp(host)/db DSN.
+var mysqlPassword = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+
+func init() {
+	registerDriver("mysql", driver{
+		open: openMySQL,
+		pool: func(string) poolSettings {
+			// Close connections before the server's wait_timeout or a
+			// proxy in between drops them.
+			return poolSettings{
+				MaxOpenConns:    25,
+				MaxIdleConns:    25,
+				ConnMaxLifetime: 3 * time.Minute,
+				ConnMaxIdleTime: time.Minute,
+			}
+		},
+		redact: func(dsn string) string {
+			return mysqlPassword.ReplaceAllString(dsn, "$1:xxxxx@")
+		},
+	})
+}
+
+// openMySQL opens dsn with the parameters the server depends on turned on:
+// parseTime, so DATETIME columns scan into time.Time, and
+// multiStatements, since a migration file holds several statements.
+func openMySQL(dsn string) gorm.Dialector {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		// Opening the DSN reports the error
+		return mysql.Open(dsn)
+	}
+	cfg.ParseTime = true
+	cfg.MultiStatements = true
+	return mysql.Open(cfg.FormatDSN())
+}
@@ -0,0 +1,17 @@
+package database
+
+import "gorm.io/driver/sqlite"
+
+func init() {
+	registerDriver("sqlite", driver{
+		open: sqlite.Open,
+		pool: func(dsn string) poolSettings {
+			// Every SQLite connection to ":memory:" gets its own empty
+			// database, so keep the pool at a single connection.
+			if dsn == ":memory:" {
+				return poolSettings{MaxOpenConns: 1}
+			}
+			return poolSettings{}
+		},
+	})
+}
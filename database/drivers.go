@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// driver opens one kind of database. SQLite is always built in; PostgreSQL
+// and MySQL are added by building with -tags postgres or -tags mysql, so
+// the default binary does not carry their client libraries. A driver needs
+// migrations in its dialect under database/migrations as well.
+type driver struct {
+	open func(dsn string) gorm.Dialector
+	// pool returns the connection pool settings suited to the driver and
+	// dsn.
+	pool func(dsn string) poolSettings
+	// redact hides the password in dsn for the log; nil when dsn holds
+	// none.
+	redact func(dsn string) string
+}
+
+// poolSettings configure the database/sql connection pool. Zero values
+// keep the database/sql defaults: unlimited open connections, two idle
+// ones, and no lifetime limits.
+type poolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// optionalDrivers are the drivers that need a build tag, for the error
+// message when one is selected without it.
+var optionalDrivers = []string{"postgres", "mysql"}
+
+var drivers = map[string]driver{}
+
+// registerDriver makes a driver available as DB_DRIVER name. It is called
+// from the init functions of the driver files.
+func registerDriver(name string, d driver) {
+	if _, ok := drivers[name]; ok {
+		panic("database: driver " + name + " registered twice")
+	}
+	drivers[name] = d
+}
+
+// Drivers lists the drivers built into the binary.
+func Drivers() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupDriver(name string) (driver, error) {
+	d, ok := drivers[name]
+	if ok {
+		return d, nil
+	}
+	for _, optional := range optionalDrivers {
+		if name == optional {
+			return driver{}, fmt.Errorf("DB_DRIVER %s is not built in; build with -tags %s", name, name)
+		}
+	}
+	return driver{}, fmt.Errorf("unsupported DB_DRIVER %q; use %s", name, strings.Join(Drivers(), ", "))
+}
+
+// override replaces the settings that are set in configured.
+func (p *poolSettings) override(configured poolSettings) {
+	if configured.MaxOpenConns > 0 {
+		p.MaxOpenConns = configured.MaxOpenConns
+	}
+	if configured.MaxIdleConns > 0 {
+		p.MaxIdleConns = configured.MaxIdleConns
+	}
+	if configured.ConnMaxLifetime > 0 {
+		p.ConnMaxLifetime = configured.ConnMaxLifetime
+	}
+	if configured.ConnMaxIdleTime > 0 {
+		p.ConnMaxIdleTime = configured.ConnMaxIdleTime
+	}
+}
+
+// applyPool configures the connection pool of db.
+func applyPool(db *gorm.DB, pool poolSettings) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if pool.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	return nil
+}
+
+// redactDSN returns dsn with its password hidden, for the log.
+func redactDSN(driverName, dsn string) string {
+	if d, ok := drivers[driverName]; ok && d.redact != nil {
+		return d.redact(dsn)
+	}
+	return dsn
+}
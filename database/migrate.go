@@ -0,0 +1,353 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/search"
+
+	"gorm.io/gorm"
+)
+
+// MigrationsDir is where the migration files live in the source tree, in
+// a directory per driver, e.g. database/migrations/postgres; `go run .
+// migrate create` writes new ones there.
+const MigrationsDir = "database/migrations"
+
+// migrationFiles are the numbered schema changes, NNNN_name.up.sql and
+// NNNN_name.down.sql, of each driver, built into the binary.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationBackfills fill in, after the SQL of the migration of their
+// version and in its transaction, what SQL cannot compute.
+var migrationBackfills = map[int]func(tx *gorm.DB) error{
+	// The search index of the users and transactions already there
+	15: func(tx *gorm.DB) error { return search.Rebuild(tx, search.Default) },
+}
+
+// Migration is one numbered schema change with the SQL that applies it and
+// the SQL that reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// ID is the version and name, e.g. 0002_add_user_nickname.
+func (m Migration) ID() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationState is a migration known to this build or recorded in the
+// database, with when it was applied; AppliedAt is nil while it is pending.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for applied versions this build has no files for,
+	// e.g. after a rollback to an older release.
+	Unknown bool
+}
+
+// schemaMigration records an applied migration in schema_migrations.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationDrivers lists the drivers the binary has migrations for.
+func MigrationDrivers() ([]string, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	var drivers []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			drivers = append(drivers, entry.Name())
+		}
+	}
+	return drivers, nil
+}
+
+// Migrations returns the migrations built into the binary for driver in
+// version order. Every driver has the same versions, written in its own SQL
+// dialect.
+func Migrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no migrations for the %s driver in %s/%s", driver, MigrationsDir, driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m.ID())
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus lists the known migrations and any applied versions this
+// build does not know, in version order.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			state.AppliedAt = &record.AppliedAt
+		}
+		states = append(states, state)
+	}
+	for version, record := range applied {
+		if !known[version] {
+			states = append(states, MigrationState{Version: version, Name: record.Name, AppliedAt: &record.AppliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// PendingMigrations lists the IDs of the migrations this build has that
+// db has not applied yet. The server refuses to start while there are any,
+// unless database.auto_migrate is set.
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, Migration{Version: state.Version, Name: state.Name}.ID())
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies the pending migrations in version order, each in its
+// own transaction together with its schema_migrations record, and returns
+// the IDs of those it applied. It stops at the first that fails.
+func MigrateUp(db *gorm.DB) ([]string, error) {
+	return migrateUp(db, math.MaxInt)
+}
+
+// MigrateTo brings db to version: it reverts the applied migrations above
+// version newest first, as MigrateDown does, and applies the pending ones up
+// to and including it, as MigrateUp does. It returns the IDs of those it
+// reverted or applied. Version 0 reverts every migration.
+func MigrateTo(db *gorm.DB, version int) ([]string, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version }) {
+		return nil, fmt.Errorf("migration %04d is not known to this build", version)
+	}
+
+	if err := ensureMigrationTable(db); err != nil {
+		return nil, err
+	}
+	var above int64
+	if err := db.Model(&schemaMigration{}).Where("version > ?", version).Count(&above).Error; err != nil {
+		return nil, err
+	}
+	var done []string
+	if above > 0 {
+		reverted, err := MigrateDown(db, int(above))
+		done = append(done, reverted...)
+		if err != nil {
+			return done, err
+		}
+	}
+	applied, err := migrateUp(db, version)
+	return append(done, applied...), err
+}
+
+// migrateUp applies the pending migrations up to and including version.
+func migrateUp(db *gorm.DB, version int) ([]string, error) {
+	if err := adoptLegacySchema(db); err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			if backfill, ok := migrationBackfills[m.Version]; ok {
+				if err := backfill(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", m.ID(), err)
+		}
+		log.Printf("Applied migration %s", m.ID())
+		done = append(done, m.ID())
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first,
+// and returns the IDs of those it reverted. A migration without a down file
+// cannot be reverted.
+func MigrateDown(db *gorm.DB, steps int) ([]string, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	if err := ensureMigrationTable(db); err != nil {
+		return nil, err
+	}
+	var records []schemaMigration
+	if err := db.Order("version DESC").Limit(steps).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, record := range records {
+		m, ok := byVersion[record.Version]
+		if !ok {
+			return done, fmt.Errorf("migration %04d_%s is not known to this build", record.Version, record.Name)
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %s has no down file", m.ID())
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, record.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", m.ID(), err)
+		}
+		log.Printf("Reverted migration %s", m.ID())
+		done = append(done, m.ID())
+	}
+	return done, nil
+}
+
+// ensureMigrationTable creates schema_migrations in SQL every driver
+// understands.
+func ensureMigrationTable(db *gorm.DB) error {
+	return db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name varchar(255) NOT NULL, applied_at timestamp NOT NULL)").Error
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]schemaMigration, error) {
+	applied := map[int]schemaMigration{}
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return applied, nil
+	}
+	var records []schemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// adoptLegacySchema brings a database created by AutoMigrate, before
+// versioned migrations, to the schema of migration 1 the way it used to be
+// upgraded, and records migration 1 as applied. Databases have to pass
+// through a release that can adopt them before a migration changes the
+// tables of the models AutoMigrate covers.
+func adoptLegacySchema(db *gorm.DB) error {
+	if db.Migrator().HasTable(&schemaMigration{}) || !db.Migrator().HasTable(&models.User{}) {
+		return ensureMigrationTable(db)
+	}
+
+	log.Println("Adopting a database created before versioned migrations")
+	if err := legacyMigrate(db); err != nil {
+		return err
+	}
+	if err := ensureMigrationTable(db); err != nil {
+		return err
+	}
+	return db.Create(&schemaMigration{Version: 1, Name: "initial_schema", AppliedAt: time.Now()}).Error
+}
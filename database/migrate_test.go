@@ -0,0 +1,195 @@
+package database_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/search"
+)
+
+func TestMigrateTo(t *testing.T) {
+	migrations, err := database.Migrations("sqlite")
+	if err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	tests := []struct {
+		name    string
+		from    int
+		to      int
+		changed int
+		wantErr bool
+	}{
+		{name: "up from empty", from: 0, to: latest, changed: latest},
+		{name: "down to the first", from: latest, to: 1, changed: latest - 1},
+		{name: "down to empty", from: 2, to: 0, changed: 2},
+		{name: "already there", from: latest, to: latest, changed: 0},
+		{name: "unknown version", from: 1, to: latest + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Open(config.DatabaseConfig{Driver: "sqlite", DSN: ":memory:"})
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { database.Close(db) })
+			if tt.from > 0 {
+				if _, err := database.MigrateTo(db, tt.from); err != nil {
+					t.Fatalf("migrate to %d: %v", tt.from, err)
+				}
+			}
+
+			changed, err := database.MigrateTo(db, tt.to)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("migrate to %d: want an error", tt.to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("migrate to %d: %v", tt.to, err)
+			}
+			if len(changed) != tt.changed {
+				t.Errorf("changed %v, want %d migrations", changed, tt.changed)
+			}
+
+			states, err := database.MigrationStatus(db)
+			if err != nil {
+				t.Fatalf("status: %v", err)
+			}
+			var applied []int
+			for _, state := range states {
+				if state.AppliedAt != nil {
+					applied = append(applied, state.Version)
+				}
+			}
+			var want []int
+			for v := 1; v <= tt.to; v++ {
+				want = append(want, v)
+			}
+			if !slices.Equal(applied, want) {
+				t.Errorf("applied %v, want %v", applied, want)
+			}
+		})
+	}
+}
+
+// TestMigrationsMatchAcrossDrivers checks that every driver has the same
+// migrations, each with a down file.
+func TestMigrationsMatchAcrossDrivers(t *testing.T) {
+	drivers, err := database.MigrationDrivers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := database.Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, driver := range drivers {
+		migrations, err := database.Migrations(driver)
+		if err != nil {
+			t.Fatalf("%s: %v", driver, err)
+		}
+		if len(migrations) != len(want) {
+			t.Errorf("%s has %d migrations, sqlite %d", driver, len(migrations), len(want))
+			continue
+		}
+		for i, m := range migrations {
+			if m.ID() != want[i].ID() {
+				t.Errorf("%s migration %d is %s, sqlite's %s", driver, i, m.ID(), want[i].ID())
+			}
+			if m.Down == "" {
+				t.Errorf("%s migration %s has no down file", driver, m.ID())
+			}
+		}
+	}
+}
+
+// TestDomainEventBackfill checks that the event store starts with the
+// history of the members there before it.
+func TestDomainEventBackfill(t *testing.T) {
+	db, err := database.Open(config.DatabaseConfig{Driver: "sqlite", DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if _, err := database.MigrateTo(db, 10); err != nil {
+		t.Fatalf("migrate to 10: %v", err)
+	}
+
+	// Joined in Silver, earned 500 and moved up to Gold, then redeemed 150
+	for _, stmt := range []string{
+		"INSERT INTO users (id, created_at, email, password, member_level, points) VALUES (1, '2026-01-01 09:00:00', 'a@example.com', 'x', 'Gold', 350)",
+		"INSERT INTO point_transactions (created_at, user_id, type, amount, balance_after) VALUES ('2026-02-01 09:00:00', 1, 'earn', 500, 500)",
+		"INSERT INTO tier_changes (created_at, user_id, from_tier, to_tier) VALUES ('2026-02-01 09:00:00', 1, 'Silver', 'Gold')",
+		"INSERT INTO point_transactions (created_at, user_id, type, amount, balance_after) VALUES ('2026-03-01 09:00:00', 1, 'redeem', -150, 350)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := database.MigrateTo(db, 11); err != nil {
+		t.Fatalf("migrate to 11: %v", err)
+	}
+
+	tests := []struct {
+		at      time.Time
+		points  int
+		level   string
+		version int
+	}{
+		{time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC), 0, "Silver", 1},
+		{time.Date(2026, time.February, 15, 0, 0, 0, 0, time.UTC), 500, "Gold", 3},
+		{time.Now(), 350, "Gold", 4},
+	}
+	for _, tt := range tests {
+		state, err := eventstore.StateAt(db, 1, tt.at)
+		if err != nil {
+			t.Fatalf("replay to %s: %v", tt.at, err)
+		}
+		if state.Points != tt.points || state.MemberLevel != tt.level || state.Version != tt.version {
+			t.Errorf("at %s: %+v, want %d points at %s after %d events", tt.at, state, tt.points, tt.level, tt.version)
+		}
+	}
+}
+
+// TestSearchIndexBackfill checks that the search index starts with the
+// records there before it.
+func TestSearchIndexBackfill(t *testing.T) {
+	db, err := database.Open(config.DatabaseConfig{Driver: "sqlite", DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if _, err := database.MigrateTo(db, 14); err != nil {
+		t.Fatalf("migrate to 14: %v", err)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO users (id, created_at, email, password, first_name, phone) VALUES (1, '2026-01-01 09:00:00', 'a@example.com', 'x', 'Somchai', '+66812345678')",
+		"INSERT INTO users (id, created_at, deleted_at, email, password, first_name) VALUES (2, '2026-01-01 09:00:00', '2026-02-01 09:00:00', 'b@example.com', 'x', 'Somchai')",
+		"INSERT INTO point_transactions (created_at, user_id, type, amount, balance_after, reason) VALUES ('2026-02-01 09:00:00', 1, 'earn', 500, 500, 'Songkran bonus')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := database.MigrateTo(db, 15); err != nil {
+		t.Fatalf("migrate to 15: %v", err)
+	}
+
+	for q, want := range map[string]string{"somchai": "user:1", "0812345678": "user:1", "songkran": "transaction:1"} {
+		hits, err := search.Default.Search(db, q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 1 || fmt.Sprintf("%s:%d", hits[0].Kind, hits[0].ID) != want {
+			t.Errorf("%q found %v, want %s", q, hits, want)
+		}
+	}
+}
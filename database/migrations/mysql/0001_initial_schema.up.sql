@@ -0,0 +1,181 @@
+-- The schema of sqlite/0001_initial_schema.up.sql in MySQL 8 types:
+-- auto-increment keys, bigint integers, datetime(3) times and boolean
+-- flags. Strings that are indexed or have a default are varchar, and the
+-- partial indexes of the other drivers are functional indexes on an
+-- expression that is NULL for the rows they leave out.
+
+CREATE TABLE `users` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`deleted_at` datetime(3),`email` varchar(255) NOT NULL,`email_canonical` varchar(255),`email_verified_at` datetime(3),`password` text NOT NULL,`first_name` text,`last_name` text,`romanized_name` text,`phone` varchar(255),`phone_verified_at` datetime(3),`membership_id` varchar(255),`referral_code` varchar(255),`member_level` varchar(255) DEFAULT 'Gold',`points` bigint DEFAULT 0,`accepted_terms_version` text,`terms_accepted_at` datetime(3),`tokens_revoked_at` datetime(3),`role` varchar(255) NOT NULL DEFAULT 'member',`suspended_at` datetime(3),`suspension_reason` text,`avatar_url` text,`avatar_key` text);
+CREATE UNIQUE INDEX `idx_users_referral_code` ON `users`((NULLIF(`referral_code`, '')));
+CREATE UNIQUE INDEX `idx_users_membership_id_active` ON `users`((CASE WHEN `deleted_at` IS NULL THEN `membership_id` END));
+CREATE UNIQUE INDEX `idx_users_verified_phone` ON `users`((CASE WHEN `phone_verified_at` IS NOT NULL AND `deleted_at` IS NULL THEN `phone` END));
+CREATE UNIQUE INDEX `idx_users_email_canonical_active` ON `users`((CASE WHEN `deleted_at` IS NULL AND `email_canonical` <> '' THEN `email_canonical` END));
+CREATE UNIQUE INDEX `idx_users_email_active` ON `users`((CASE WHEN `deleted_at` IS NULL THEN `email` END));
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE `captured_requests` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`method` text,`path` varchar(255),`query` text,`headers` text,`body` text,`status` bigint,`user_id` bigint unsigned,`response` text);
+CREATE INDEX `idx_captured_requests_status` ON `captured_requests`(`status`);
+CREATE INDEX `idx_captured_requests_path` ON `captured_requests`(`path`);
+CREATE INDEX `idx_captured_requests_created_at` ON `captured_requests`(`created_at`);
+
+CREATE TABLE `member_tiers` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`code` varchar(255) NOT NULL,`rank` bigint NOT NULL DEFAULT 0,`min_points` bigint NOT NULL DEFAULT 0,`earn_multiplier` double precision NOT NULL DEFAULT 1);
+CREATE UNIQUE INDEX `idx_member_tiers_code` ON `member_tiers`(`code`);
+
+CREATE TABLE `member_tier_translations` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`tier_code` varchar(255) NOT NULL,`locale` varchar(255) NOT NULL,`name` text NOT NULL,`description` text,`benefits` text,CONSTRAINT `fk_member_tiers_translations` FOREIGN KEY (`tier_code`) REFERENCES `member_tiers`(`code`));
+CREATE UNIQUE INDEX `idx_tier_locale` ON `member_tier_translations`(`tier_code`,`locale`);
+
+CREATE TABLE `audit_logs` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`actor` text,`action` varchar(255),`resource` varchar(255),`resource_id` bigint unsigned,`fields` text);
+CREATE INDEX `idx_audit_resource` ON `audit_logs`(`resource`,`resource_id`);
+CREATE INDEX `idx_audit_logs_action` ON `audit_logs`(`action`);
+CREATE INDEX `idx_audit_logs_created_at` ON `audit_logs`(`created_at`);
+
+CREATE TABLE `phone_verifications` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`phone` text NOT NULL,`code_hash` text NOT NULL,`expires_at` datetime(3) NOT NULL,`attempts` bigint NOT NULL DEFAULT 0,`consumed_at` datetime(3));
+CREATE INDEX `idx_phone_verifications_user_id` ON `phone_verifications`(`user_id`);
+
+CREATE TABLE `devices` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`deleted_at` datetime(3),`user_id` bigint unsigned NOT NULL,`device_id` varchar(255) NOT NULL,`name` text,`platform` text,`model` text,`app_version` text,`push_token` varchar(255),`last_seen_at` datetime(3));
+CREATE INDEX `idx_devices_push_token` ON `devices`(`push_token`);
+CREATE UNIQUE INDEX `idx_devices_user_device` ON `devices`(`user_id`,(CASE WHEN `deleted_at` IS NULL THEN `device_id` END));
+CREATE INDEX `idx_devices_deleted_at` ON `devices`(`deleted_at`);
+
+CREATE TABLE `addresses` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`deleted_at` datetime(3),`user_id` bigint unsigned NOT NULL,`label` text NOT NULL,`line1` text NOT NULL,`line2` text,`district` text NOT NULL,`province` text NOT NULL,`postal_code` text NOT NULL,`is_default` boolean NOT NULL DEFAULT false);
+CREATE UNIQUE INDEX `idx_addresses_user_default` ON `addresses`((CASE WHEN `is_default` AND `deleted_at` IS NULL THEN `user_id` END));
+CREATE INDEX `idx_addresses_user_id` ON `addresses`(`user_id`);
+CREATE INDEX `idx_addresses_deleted_at` ON `addresses`(`deleted_at`);
+
+CREATE TABLE `partners` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`name` text NOT NULL,`key_hash` varchar(255) NOT NULL,`key_prefix` text,`scopes` text,`visible_fields` text,`last_used_at` datetime(3),`revoked_at` datetime(3));
+CREATE UNIQUE INDEX `idx_partners_key_hash` ON `partners`(`key_hash`);
+
+CREATE TABLE `webhook_endpoints` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`url` text NOT NULL,`description` text,`events` text,`secret` text NOT NULL,`secret_prefix` text,`active` boolean NOT NULL DEFAULT true);
+
+CREATE TABLE `webhook_deliveries` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`endpoint_id` bigint unsigned NOT NULL,`event_id` varchar(255) NOT NULL,`event` text NOT NULL,`payload` text NOT NULL,`status` varchar(255) NOT NULL,`attempts` bigint NOT NULL DEFAULT 0,`next_attempt_at` datetime(3),`response_status` bigint,`last_error` text,`delivered_at` datetime(3));
+CREATE INDEX `idx_webhook_deliveries_due` ON `webhook_deliveries`(`status`,`next_attempt_at`);
+CREATE INDEX `idx_webhook_deliveries_event_id` ON `webhook_deliveries`(`event_id`);
+CREATE INDEX `idx_webhook_deliveries_endpoint_id` ON `webhook_deliveries`(`endpoint_id`);
+
+CREATE TABLE `pending_events` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`event_id` text NOT NULL,`event` text NOT NULL,`payload` text NOT NULL,`attempts` bigint NOT NULL DEFAULT 0,`next_attempt_at` datetime(3) NOT NULL,`last_error` text);
+CREATE INDEX `idx_pending_events_next_attempt_at` ON `pending_events`(`next_attempt_at`);
+CREATE INDEX `idx_pending_events_created_at` ON `pending_events`(`created_at`);
+
+CREATE TABLE `campaigns` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`code` varchar(255) NOT NULL,`name` text,`event` varchar(255) NOT NULL,`points` bigint NOT NULL,`active` boolean NOT NULL DEFAULT true,`starts_at` datetime(3),`ends_at` datetime(3));
+CREATE INDEX `idx_campaigns_event` ON `campaigns`(`event`);
+CREATE UNIQUE INDEX `idx_campaigns_code` ON `campaigns`(`code`);
+
+CREATE TABLE `campaign_awards` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`campaign_id` bigint unsigned NOT NULL,`user_id` bigint unsigned NOT NULL,`points` bigint);
+CREATE INDEX `idx_campaign_awards_user_id` ON `campaign_awards`(`user_id`);
+CREATE UNIQUE INDEX `idx_campaign_awards_user` ON `campaign_awards`(`campaign_id`,`user_id`);
+
+CREATE TABLE `notification_preferences` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`channel` varchar(255) NOT NULL,`category` varchar(255) NOT NULL,`enabled` boolean);
+CREATE UNIQUE INDEX `idx_notification_preferences_user` ON `notification_preferences`(`user_id`,`channel`,`category`);
+
+CREATE TABLE `user_settings` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`settings` text NOT NULL);
+CREATE UNIQUE INDEX `idx_user_settings_user_id` ON `user_settings`(`user_id`);
+
+CREATE TABLE `notifications` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`category` text NOT NULL,`title` text NOT NULL,`body` text,`read_at` datetime(3));
+CREATE INDEX `idx_notifications_user_read` ON `notifications`(`user_id`,`read_at`);
+CREATE INDEX `idx_notifications_created_at` ON `notifications`(`created_at`);
+
+CREATE TABLE `points_statements` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`period` varchar(255) NOT NULL,`opening` bigint,`earned` bigint,`redeemed` bigint,`expired` bigint,`adjusted` bigint,`closing` bigint);
+CREATE UNIQUE INDEX `idx_points_statements_period` ON `points_statements`(`user_id`,`period`);
+
+CREATE TABLE `sms_messages` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`phone` text NOT NULL,`purpose` text NOT NULL,`provider` varchar(255) NOT NULL,`provider_id` varchar(255),`status` text NOT NULL,`error` text);
+CREATE INDEX `idx_sms_messages_provider` ON `sms_messages`(`provider`,`provider_id`);
+CREATE INDEX `idx_sms_messages_user` ON `sms_messages`(`created_at`,`user_id`);
+
+CREATE TABLE `suppressed_addresses` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`address` varchar(255) NOT NULL,`reason` text,`detail` text);
+CREATE UNIQUE INDEX `idx_suppressed_addresses_address` ON `suppressed_addresses`(`address`);
+
+CREATE TABLE `experiment_exposures` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`experiment` varchar(255) NOT NULL,`variant` text NOT NULL);
+CREATE INDEX `idx_experiment_exposures_experiment` ON `experiment_exposures`(`experiment`);
+CREATE UNIQUE INDEX `idx_experiment_exposures_user` ON `experiment_exposures`(`user_id`,`experiment`);
+
+CREATE TABLE `refresh_tokens` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`family_id` varchar(255) NOT NULL,`token_hash` varchar(255) NOT NULL,`expires_at` datetime(3),`used_at` datetime(3),`revoked_at` datetime(3));
+CREATE UNIQUE INDEX `idx_refresh_tokens_token_hash` ON `refresh_tokens`(`token_hash`);
+CREATE INDEX `idx_refresh_tokens_family_id` ON `refresh_tokens`(`family_id`);
+CREATE INDEX `idx_refresh_tokens_user_id` ON `refresh_tokens`(`user_id`);
+
+CREATE TABLE `revoked_tokens` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`jti` varchar(255) NOT NULL,`user_id` bigint unsigned,`expires_at` datetime(3));
+CREATE INDEX `idx_revoked_tokens_expires_at` ON `revoked_tokens`(`expires_at`);
+CREATE INDEX `idx_revoked_tokens_user_id` ON `revoked_tokens`(`user_id`);
+CREATE UNIQUE INDEX `idx_revoked_tokens_jti` ON `revoked_tokens`(`jti`);
+
+CREATE TABLE `password_resets` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`token_hash` varchar(255) NOT NULL,`expires_at` datetime(3) NOT NULL,`consumed_at` datetime(3));
+CREATE UNIQUE INDEX `idx_password_resets_token_hash` ON `password_resets`(`token_hash`);
+CREATE INDEX `idx_password_resets_user_id` ON `password_resets`(`user_id`);
+
+CREATE TABLE `email_verifications` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`email` text NOT NULL,`token_hash` varchar(255) NOT NULL,`expires_at` datetime(3) NOT NULL,`consumed_at` datetime(3));
+CREATE UNIQUE INDEX `idx_email_verifications_token_hash` ON `email_verifications`(`token_hash`);
+CREATE INDEX `idx_email_verifications_user_id` ON `email_verifications`(`user_id`);
+
+CREATE TABLE `user_identities` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`deleted_at` datetime(3),`user_id` bigint unsigned NOT NULL,`provider` varchar(255) NOT NULL,`subject` varchar(255) NOT NULL,`email` text);
+CREATE UNIQUE INDEX `idx_user_identities_provider_subject` ON `user_identities`(`provider`,(CASE WHEN `deleted_at` IS NULL THEN `subject` END));
+CREATE UNIQUE INDEX `idx_user_identities_user_provider` ON `user_identities`(`user_id`,(CASE WHEN `deleted_at` IS NULL THEN `provider` END));
+CREATE INDEX `idx_user_identities_deleted_at` ON `user_identities`(`deleted_at`);
+
+CREATE TABLE `two_factors` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`secret_encrypted` text NOT NULL,`enabled_at` datetime(3),`last_used_step` bigint,`failed_attempts` bigint,`last_failed_at` datetime(3));
+CREATE UNIQUE INDEX `idx_two_factors_user_id` ON `two_factors`(`user_id`);
+
+CREATE TABLE `recovery_codes` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`code_hash` text NOT NULL,`used_at` datetime(3));
+CREATE INDEX `idx_recovery_codes_user_id` ON `recovery_codes`(`user_id`);
+
+CREATE TABLE `login_otps` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`phone` varchar(255) NOT NULL,`code_hash` text NOT NULL,`expires_at` datetime(3) NOT NULL,`attempts` bigint NOT NULL DEFAULT 0,`consumed_at` datetime(3));
+CREATE INDEX `idx_login_otps_phone` ON `login_otps`(`phone`);
+CREATE INDEX `idx_login_otps_user_id` ON `login_otps`(`user_id`);
+
+CREATE TABLE `sessions` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`family_id` varchar(255) NOT NULL,`ip` text,`user_agent` text,`last_seen_at` datetime(3),`last_ip` text,`expires_at` datetime(3));
+CREATE INDEX `idx_sessions_expires_at` ON `sessions`(`expires_at`);
+CREATE UNIQUE INDEX `idx_sessions_family_id` ON `sessions`(`family_id`);
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+CREATE INDEX `idx_sessions_created_at` ON `sessions`(`created_at`);
+
+CREATE TABLE `api_keys` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`name` text NOT NULL,`key_hash` varchar(255) NOT NULL,`key_prefix` text,`scopes` text,`expires_at` datetime(3),`last_used_at` datetime(3),`revoked_at` datetime(3));
+CREATE UNIQUE INDEX `idx_api_keys_key_hash` ON `api_keys`(`key_hash`);
+CREATE INDEX `idx_api_keys_user_id` ON `api_keys`(`user_id`);
+
+CREATE TABLE `point_transactions` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`type` text NOT NULL,`amount` bigint NOT NULL,`balance_after` bigint NOT NULL,`reason` text,`reference` varchar(255),`idempotency_key` varchar(255),`remaining` bigint NOT NULL DEFAULT 0,`expires_at` datetime(3),`expiry_notice_at` datetime(3));
+CREATE INDEX `idx_point_transactions_expires_at` ON `point_transactions`(`expires_at`);
+CREATE UNIQUE INDEX `idx_point_transactions_idempotency` ON `point_transactions`(`reference`,(NULLIF(`idempotency_key`, ''));
+CREATE INDEX `idx_point_transactions_reference` ON `point_transactions`(`reference`);
+CREATE INDEX `idx_point_transactions_user_id` ON `point_transactions`(`user_id`);
+CREATE INDEX `idx_point_transactions_created_at` ON `point_transactions`(`created_at`);
+
+CREATE TABLE `tier_changes` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`user_id` bigint unsigned NOT NULL,`from_tier` text,`to_tier` text NOT NULL,`upgrade` boolean,`qualifying_points` bigint,`reason` text,`notified_at` datetime(3));
+CREATE INDEX `idx_tier_changes_notified_at` ON `tier_changes`(`notified_at`);
+CREATE INDEX `idx_tier_changes_user_id` ON `tier_changes`(`user_id`);
+CREATE INDEX `idx_tier_changes_created_at` ON `tier_changes`(`created_at`);
+
+CREATE TABLE `rewards` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`deleted_at` datetime(3),`name` text NOT NULL,`description` text,`image_url` text,`image_key` text,`cost` bigint NOT NULL,`stock` bigint NOT NULL,`active` boolean NOT NULL DEFAULT true);
+CREATE INDEX `idx_rewards_deleted_at` ON `rewards`(`deleted_at`);
+
+CREATE TABLE `redemptions` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`reward_id` bigint unsigned NOT NULL,`reward_name` text,`points` bigint NOT NULL,`status` varchar(255) NOT NULL,`code` varchar(255) NOT NULL,`fulfilled_at` datetime(3),`cancelled_at` datetime(3));
+CREATE UNIQUE INDEX `idx_redemptions_code` ON `redemptions`(`code`);
+CREATE INDEX `idx_redemptions_status` ON `redemptions`(`status`);
+CREATE INDEX `idx_redemptions_reward_id` ON `redemptions`(`reward_id`);
+CREATE INDEX `idx_redemptions_user_id` ON `redemptions`(`user_id`);
+
+CREATE TABLE `referrals` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`referrer_id` bigint unsigned NOT NULL,`referred_id` bigint unsigned NOT NULL,`code` text NOT NULL,`status` varchar(255) NOT NULL DEFAULT 'pending',`completed_at` datetime(3),`referrer_points` bigint,`referred_points` bigint);
+CREATE INDEX `idx_referrals_status` ON `referrals`(`status`);
+CREATE UNIQUE INDEX `idx_referrals_referred_id` ON `referrals`(`referred_id`);
+CREATE INDEX `idx_referrals_referrer_id` ON `referrals`(`referrer_id`);
+
+CREATE TABLE `coupons` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`code` varchar(255) NOT NULL,`batch` varchar(255),`name` text NOT NULL,`type` text NOT NULL,`value` bigint NOT NULL,`max_uses` bigint NOT NULL,`uses` bigint NOT NULL DEFAULT 0,`active` boolean NOT NULL DEFAULT true,`starts_at` datetime(3),`ends_at` datetime(3));
+CREATE INDEX `idx_coupons_batch` ON `coupons`(`batch`);
+CREATE UNIQUE INDEX `idx_coupons_code` ON `coupons`(`code`);
+
+CREATE TABLE `coupon_uses` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`coupon_id` bigint unsigned NOT NULL,`user_id` bigint unsigned NOT NULL,`code` text NOT NULL,`name` text,`type` text NOT NULL,`value` bigint);
+CREATE INDEX `idx_coupon_uses_user_id` ON `coupon_uses`(`user_id`);
+CREATE UNIQUE INDEX `idx_coupon_uses_user` ON `coupon_uses`(`coupon_id`,`user_id`);
+
+CREATE TABLE `wallet_accounts` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned,`code` varchar(255),`currency` text NOT NULL,`balance` bigint NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX `idx_wallet_accounts_code` ON `wallet_accounts`((NULLIF(`code`, '')));
+CREATE UNIQUE INDEX `idx_wallet_accounts_user_id` ON `wallet_accounts`(`user_id`);
+
+CREATE TABLE `wallet_transactions` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`type` text NOT NULL,`amount` bigint NOT NULL,`description` text,`reference` text,`initiator_id` bigint unsigned NOT NULL,`idempotency_key` varchar(255));
+CREATE UNIQUE INDEX `idx_wallet_transactions_idempotency` ON `wallet_transactions`(`initiator_id`,(NULLIF(`idempotency_key`, ''));
+
+CREATE TABLE `wallet_entries` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`transaction_id` bigint unsigned NOT NULL,`account_id` bigint unsigned NOT NULL,`type` text NOT NULL,`description` text,`amount` bigint NOT NULL,`balance_after` bigint NOT NULL);
+CREATE INDEX `idx_wallet_entries_account_id` ON `wallet_entries`(`account_id`);
+CREATE INDEX `idx_wallet_entries_transaction_id` ON `wallet_entries`(`transaction_id`);
+CREATE INDEX `idx_wallet_entries_created_at` ON `wallet_entries`(`created_at`);
+
+CREATE TABLE `scheduled_runs` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`job` varchar(255) NOT NULL,`due_at` datetime(3) NOT NULL,`instance` text,`job_id` text,`status` varchar(255) NOT NULL,`attempts` bigint NOT NULL DEFAULT 0,`error` text,`started_at` datetime(3),`finished_at` datetime(3));
+CREATE INDEX `idx_scheduled_runs_status` ON `scheduled_runs`(`status`);
+CREATE UNIQUE INDEX `idx_scheduled_runs_due` ON `scheduled_runs`(`job`,`due_at`);
@@ -0,0 +1,2 @@
+DROP INDEX `idx_users_purge_at` ON `users`;
+ALTER TABLE `users` DROP COLUMN `purge_at`;
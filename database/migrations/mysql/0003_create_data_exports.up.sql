@@ -0,0 +1,4 @@
+-- Copies of a member's data requested with POST /profile/data-export.
+CREATE TABLE `data_exports` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`status` text NOT NULL,`job_id` text,`storage_key` text,`size` bigint,`ready_at` datetime(3),`expires_at` datetime(3));
+CREATE INDEX `idx_data_exports_user_id` ON `data_exports`(`user_id`);
+CREATE INDEX `idx_data_exports_expires_at` ON `data_exports`(`expires_at`);
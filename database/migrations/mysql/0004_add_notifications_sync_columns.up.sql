@@ -0,0 +1,4 @@
+-- Notifications report changes and deletions to GET /sync.
+ALTER TABLE `notifications` ADD COLUMN `updated_at` datetime(3);
+ALTER TABLE `notifications` ADD COLUMN `deleted_at` datetime(3);
+CREATE INDEX `idx_notifications_deleted_at` ON `notifications`(`deleted_at`);
@@ -0,0 +1,5 @@
+-- Runs of the nightly comparison of balances with the points ledger.
+CREATE TABLE `points_reconciliations` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`finished_at` datetime(3),`policy` text NOT NULL,`members` bigint NOT NULL DEFAULT 0,`mismatches` bigint NOT NULL DEFAULT 0,`fixed` bigint NOT NULL DEFAULT 0);
+CREATE TABLE `points_mismatches` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`reconciliation_id` bigint unsigned NOT NULL,`user_id` bigint unsigned NOT NULL,`balance` bigint NOT NULL,`ledger_total` bigint NOT NULL,`last_balance` bigint NOT NULL,`fixed` boolean NOT NULL DEFAULT false);
+CREATE INDEX `idx_points_mismatches_reconciliation_id` ON `points_mismatches`(`reconciliation_id`);
+CREATE INDEX `idx_points_mismatches_user_id` ON `points_mismatches`(`user_id`);
@@ -0,0 +1,2 @@
+-- Partners are on a plan that sets their rate limit.
+ALTER TABLE `partners` ADD COLUMN `plan` varchar(255) NOT NULL DEFAULT 'standard';
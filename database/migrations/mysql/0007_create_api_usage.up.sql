@@ -0,0 +1,4 @@
+-- Hourly request counts per API key and route, for partner usage and admin reports.
+CREATE TABLE `api_usage` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`key_type` varchar(16) NOT NULL,`key_id` bigint unsigned NOT NULL,`hour` datetime(3) NOT NULL,`method` varchar(16) NOT NULL,`route` varchar(255) NOT NULL,`requests` bigint NOT NULL DEFAULT 0,`client_errors` bigint NOT NULL DEFAULT 0,`server_errors` bigint NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX `idx_api_usage_bucket` ON `api_usage`(`key_type`,`key_id`,`hour`,`method`,`route`);
+CREATE INDEX `idx_api_usage_hour` ON `api_usage`(`hour`);
@@ -0,0 +1,8 @@
+-- Monthly settlements of partner-earned points, with their adjustments and disputes.
+CREATE TABLE `settlements` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`partner_id` bigint unsigned NOT NULL,`period` varchar(255) NOT NULL,`status` varchar(255) NOT NULL DEFAULT 'open',`transactions` bigint NOT NULL DEFAULT 0,`points` bigint NOT NULL DEFAULT 0,`adjusted` bigint NOT NULL DEFAULT 0,`total` bigint NOT NULL DEFAULT 0,`signed_off_at` datetime(3),`signed_off_by` text);
+CREATE UNIQUE INDEX `idx_settlements_partner_period` ON `settlements`(`partner_id`,`period`);
+CREATE INDEX `idx_settlements_period` ON `settlements`(`period`);
+CREATE TABLE `settlement_adjustments` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`settlement_id` bigint unsigned NOT NULL,`points` bigint NOT NULL,`reason` text NOT NULL,`dispute_id` bigint unsigned,`created_by` text NOT NULL);
+CREATE INDEX `idx_settlement_adjustments_settlement_id` ON `settlement_adjustments`(`settlement_id`);
+CREATE TABLE `settlement_disputes` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`settlement_id` bigint unsigned NOT NULL,`transaction_id` bigint unsigned,`reason` text NOT NULL,`status` varchar(255) NOT NULL DEFAULT 'open',`resolution` text,`resolved_at` datetime(3),`resolved_by` text);
+CREATE INDEX `idx_settlement_disputes_settlement_id` ON `settlement_disputes`(`settlement_id`);
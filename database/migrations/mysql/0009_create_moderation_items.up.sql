@@ -0,0 +1,4 @@
+-- Uploaded content going through moderation, with the admin review queue.
+CREATE TABLE `moderation_items` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`user_id` bigint unsigned NOT NULL,`kind` text NOT NULL,`key` text NOT NULL,`quarantine_key` text,`status` varchar(255) NOT NULL DEFAULT 'pending',`labels` text,`reviewed_at` datetime(3),`reviewed_by` text);
+CREATE INDEX `idx_moderation_items_user_id` ON `moderation_items`(`user_id`);
+CREATE INDEX `idx_moderation_items_status` ON `moderation_items`(`status`);
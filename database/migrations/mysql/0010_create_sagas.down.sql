@@ -0,0 +1,2 @@
+ALTER TABLE `redemptions` DROP COLUMN `voucher_code`;
+DROP TABLE IF EXISTS `sagas`;
@@ -0,0 +1,19 @@
+-- The event store of members' points and tiers, started with their history so far: joining in the tier of their first tier change, then their ledger entries and tier changes in the order they happened.
+CREATE TABLE `domain_events` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`user_id` bigint unsigned NOT NULL,`version` bigint NOT NULL,`type` text NOT NULL,`occurred_at` datetime(3) NOT NULL,`data` text);
+CREATE UNIQUE INDEX `idx_domain_events_stream` ON `domain_events`(`user_id`,`version`);
+CREATE INDEX `idx_domain_events_occurred_at` ON `domain_events`(`occurred_at`);
+INSERT INTO `domain_events` (`user_id`,`version`,`type`,`occurred_at`,`data`)
+SELECT `user_id`, ROW_NUMBER() OVER (PARTITION BY `user_id` ORDER BY `stage`, `occurred_at`, `kind`, `source_id`), `type`, `occurred_at`, `data` FROM (
+  SELECT `id` AS `user_id`, 0 AS `stage`, 0 AS `kind`, `id` AS `source_id`, 'MemberJoined' AS `type`, `created_at` AS `occurred_at`,
+    CAST(JSON_OBJECT('to_tier', COALESCE((SELECT `from_tier` FROM `tier_changes` WHERE `tier_changes`.`user_id` = `users`.`id` AND `from_tier` <> '' ORDER BY `id` LIMIT 1), `member_level`)) AS CHAR) AS `data`
+  FROM `users`
+  UNION ALL
+  SELECT `user_id`, 1, 0, `id`,
+    CASE `type` WHEN 'earn' THEN 'PointsEarned' WHEN 'redeem' THEN 'PointsRedeemed' WHEN 'expire' THEN 'PointsExpired' ELSE 'PointsAdjusted' END,
+    `created_at`, CAST(JSON_OBJECT('amount', `amount`, 'transaction_id', `id`, 'reason', COALESCE(`reason`, ''), 'reference', COALESCE(`reference`, '')) AS CHAR)
+  FROM `point_transactions`
+  UNION ALL
+  SELECT `user_id`, 1, 1, `id`, 'TierChanged', `created_at`,
+    CAST(JSON_OBJECT('from_tier', COALESCE(`from_tier`, ''), 'to_tier', `to_tier`, 'reason', COALESCE(`reason`, '')) AS CHAR)
+  FROM `tier_changes`
+) AS `history`;
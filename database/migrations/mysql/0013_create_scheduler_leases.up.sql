@@ -0,0 +1,2 @@
+-- The lease of the instance that runs the scheduled jobs.
+CREATE TABLE `scheduler_leases` (`name` varchar(255),`holder` text NOT NULL,`acquired_at` datetime(3) NOT NULL,`renewed_at` datetime(3) NOT NULL,`expires_at` datetime(3) NOT NULL,PRIMARY KEY (`name`));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `feature_flags`;
+DROP TABLE IF EXISTS `announcements`;
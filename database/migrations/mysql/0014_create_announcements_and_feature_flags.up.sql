@@ -0,0 +1,4 @@
+-- Announcements shown to members and feature flags of the clients.
+CREATE TABLE `announcements` (`id` bigint unsigned AUTO_INCREMENT PRIMARY KEY,`created_at` datetime(3),`updated_at` datetime(3),`title` text NOT NULL,`body` text NOT NULL,`starts_at` datetime(3) NOT NULL,`ends_at` datetime(3));
+CREATE INDEX `idx_announcements_starts_at` ON `announcements`(`starts_at`);
+CREATE TABLE `feature_flags` (`key` varchar(255),`enabled` boolean NOT NULL,`description` text,`created_at` datetime(3),`updated_at` datetime(3),PRIMARY KEY (`key`));
@@ -0,0 +1,42 @@
+DROP TABLE IF EXISTS "scheduled_runs";
+DROP TABLE IF EXISTS "wallet_entries";
+DROP TABLE IF EXISTS "wallet_transactions";
+DROP TABLE IF EXISTS "wallet_accounts";
+DROP TABLE IF EXISTS "coupon_uses";
+DROP TABLE IF EXISTS "coupons";
+DROP TABLE IF EXISTS "referrals";
+DROP TABLE IF EXISTS "redemptions";
+DROP TABLE IF EXISTS "rewards";
+DROP TABLE IF EXISTS "tier_changes";
+DROP TABLE IF EXISTS "point_transactions";
+DROP TABLE IF EXISTS "api_keys";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "login_otps";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "two_factors";
+DROP TABLE IF EXISTS "user_identities";
+DROP TABLE IF EXISTS "email_verifications";
+DROP TABLE IF EXISTS "password_resets";
+DROP TABLE IF EXISTS "revoked_tokens";
+DROP TABLE IF EXISTS "refresh_tokens";
+DROP TABLE IF EXISTS "experiment_exposures";
+DROP TABLE IF EXISTS "suppressed_addresses";
+DROP TABLE IF EXISTS "sms_messages";
+DROP TABLE IF EXISTS "points_statements";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "user_settings";
+DROP TABLE IF EXISTS "notification_preferences";
+DROP TABLE IF EXISTS "campaign_awards";
+DROP TABLE IF EXISTS "campaigns";
+DROP TABLE IF EXISTS "pending_events";
+DROP TABLE IF EXISTS "webhook_deliveries";
+DROP TABLE IF EXISTS "webhook_endpoints";
+DROP TABLE IF EXISTS "partners";
+DROP TABLE IF EXISTS "addresses";
+DROP TABLE IF EXISTS "devices";
+DROP TABLE IF EXISTS "phone_verifications";
+DROP TABLE IF EXISTS "audit_logs";
+DROP TABLE IF EXISTS "member_tier_translations";
+DROP TABLE IF EXISTS "member_tiers";
+DROP TABLE IF EXISTS "captured_requests";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,178 @@
+-- The schema of sqlite/0001_initial_schema.up.sql in PostgreSQL types:
+-- bigserial keys, bigint integers, timestamptz times and boolean flags.
+
+CREATE TABLE "users" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"email" text NOT NULL,"email_canonical" text,"email_verified_at" timestamptz,"password" text NOT NULL,"first_name" text,"last_name" text,"romanized_name" text,"phone" text,"phone_verified_at" timestamptz,"membership_id" text,"referral_code" text,"member_level" text DEFAULT 'Gold',"points" bigint DEFAULT 0,"accepted_terms_version" text,"terms_accepted_at" timestamptz,"tokens_revoked_at" timestamptz,"role" text NOT NULL DEFAULT 'member',"suspended_at" timestamptz,"suspension_reason" text,"avatar_url" text,"avatar_key" text);
+CREATE UNIQUE INDEX "idx_users_referral_code" ON "users"("referral_code") WHERE referral_code <> '';
+CREATE UNIQUE INDEX "idx_users_membership_id_active" ON "users"("membership_id") WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX "idx_users_verified_phone" ON "users"("phone") WHERE phone_verified_at IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX "idx_users_email_canonical_active" ON "users"("email_canonical") WHERE deleted_at IS NULL AND email_canonical <> '';
+CREATE UNIQUE INDEX "idx_users_email_active" ON "users"("email") WHERE deleted_at IS NULL;
+CREATE INDEX "idx_users_deleted_at" ON "users"("deleted_at");
+
+CREATE TABLE "captured_requests" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"method" text,"path" text,"query" text,"headers" text,"body" text,"status" bigint,"user_id" bigint,"response" text);
+CREATE INDEX "idx_captured_requests_status" ON "captured_requests"("status");
+CREATE INDEX "idx_captured_requests_path" ON "captured_requests"("path");
+CREATE INDEX "idx_captured_requests_created_at" ON "captured_requests"("created_at");
+
+CREATE TABLE "member_tiers" ("id" bigserial PRIMARY KEY,"code" text NOT NULL,"rank" bigint NOT NULL DEFAULT 0,"min_points" bigint NOT NULL DEFAULT 0,"earn_multiplier" double precision NOT NULL DEFAULT 1);
+CREATE UNIQUE INDEX "idx_member_tiers_code" ON "member_tiers"("code");
+
+CREATE TABLE "member_tier_translations" ("id" bigserial PRIMARY KEY,"tier_code" text NOT NULL,"locale" text NOT NULL,"name" text NOT NULL,"description" text,"benefits" text,CONSTRAINT "fk_member_tiers_translations" FOREIGN KEY ("tier_code") REFERENCES "member_tiers"("code"));
+CREATE UNIQUE INDEX "idx_tier_locale" ON "member_tier_translations"("tier_code","locale");
+
+CREATE TABLE "audit_logs" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"actor" text,"action" text,"resource" text,"resource_id" bigint,"fields" text);
+CREATE INDEX "idx_audit_resource" ON "audit_logs"("resource","resource_id");
+CREATE INDEX "idx_audit_logs_action" ON "audit_logs"("action");
+CREATE INDEX "idx_audit_logs_created_at" ON "audit_logs"("created_at");
+
+CREATE TABLE "phone_verifications" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"phone" text NOT NULL,"code_hash" text NOT NULL,"expires_at" timestamptz NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"consumed_at" timestamptz);
+CREATE INDEX "idx_phone_verifications_user_id" ON "phone_verifications"("user_id");
+
+CREATE TABLE "devices" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"device_id" text NOT NULL,"name" text,"platform" text,"model" text,"app_version" text,"push_token" text,"last_seen_at" timestamptz);
+CREATE INDEX "idx_devices_push_token" ON "devices"("push_token");
+CREATE UNIQUE INDEX "idx_devices_user_device" ON "devices"("user_id","device_id") WHERE deleted_at IS NULL;
+CREATE INDEX "idx_devices_deleted_at" ON "devices"("deleted_at");
+
+CREATE TABLE "addresses" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"label" text NOT NULL,"line1" text NOT NULL,"line2" text,"district" text NOT NULL,"province" text NOT NULL,"postal_code" text NOT NULL,"is_default" boolean NOT NULL DEFAULT false);
+CREATE UNIQUE INDEX "idx_addresses_user_default" ON "addresses"("user_id") WHERE is_default AND deleted_at IS NULL;
+CREATE INDEX "idx_addresses_user_id" ON "addresses"("user_id");
+CREATE INDEX "idx_addresses_deleted_at" ON "addresses"("deleted_at");
+
+CREATE TABLE "partners" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"name" text NOT NULL,"key_hash" text NOT NULL,"key_prefix" text,"scopes" text,"visible_fields" text,"last_used_at" timestamptz,"revoked_at" timestamptz);
+CREATE UNIQUE INDEX "idx_partners_key_hash" ON "partners"("key_hash");
+
+CREATE TABLE "webhook_endpoints" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"url" text NOT NULL,"description" text,"events" text,"secret" text NOT NULL,"secret_prefix" text,"active" boolean NOT NULL DEFAULT true);
+
+CREATE TABLE "webhook_deliveries" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"endpoint_id" bigint NOT NULL,"event_id" text NOT NULL,"event" text NOT NULL,"payload" text NOT NULL,"status" text NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"next_attempt_at" timestamptz,"response_status" bigint,"last_error" text,"delivered_at" timestamptz);
+CREATE INDEX "idx_webhook_deliveries_due" ON "webhook_deliveries"("status","next_attempt_at");
+CREATE INDEX "idx_webhook_deliveries_event_id" ON "webhook_deliveries"("event_id");
+CREATE INDEX "idx_webhook_deliveries_endpoint_id" ON "webhook_deliveries"("endpoint_id");
+
+CREATE TABLE "pending_events" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"event_id" text NOT NULL,"event" text NOT NULL,"payload" text NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"next_attempt_at" timestamptz NOT NULL,"last_error" text);
+CREATE INDEX "idx_pending_events_next_attempt_at" ON "pending_events"("next_attempt_at");
+CREATE INDEX "idx_pending_events_created_at" ON "pending_events"("created_at");
+
+CREATE TABLE "campaigns" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"code" text NOT NULL,"name" text,"event" text NOT NULL,"points" bigint NOT NULL,"active" boolean NOT NULL DEFAULT true,"starts_at" timestamptz,"ends_at" timestamptz);
+CREATE INDEX "idx_campaigns_event" ON "campaigns"("event");
+CREATE UNIQUE INDEX "idx_campaigns_code" ON "campaigns"("code");
+
+CREATE TABLE "campaign_awards" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"campaign_id" bigint NOT NULL,"user_id" bigint NOT NULL,"points" bigint);
+CREATE INDEX "idx_campaign_awards_user_id" ON "campaign_awards"("user_id");
+CREATE UNIQUE INDEX "idx_campaign_awards_user" ON "campaign_awards"("campaign_id","user_id");
+
+CREATE TABLE "notification_preferences" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"channel" text NOT NULL,"category" text NOT NULL,"enabled" boolean);
+CREATE UNIQUE INDEX "idx_notification_preferences_user" ON "notification_preferences"("user_id","channel","category");
+
+CREATE TABLE "user_settings" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"settings" text NOT NULL);
+CREATE UNIQUE INDEX "idx_user_settings_user_id" ON "user_settings"("user_id");
+
+CREATE TABLE "notifications" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"category" text NOT NULL,"title" text NOT NULL,"body" text,"read_at" timestamptz);
+CREATE INDEX "idx_notifications_user_read" ON "notifications"("user_id","read_at");
+CREATE INDEX "idx_notifications_created_at" ON "notifications"("created_at");
+
+CREATE TABLE "points_statements" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"period" text NOT NULL,"opening" bigint,"earned" bigint,"redeemed" bigint,"expired" bigint,"adjusted" bigint,"closing" bigint);
+CREATE UNIQUE INDEX "idx_points_statements_period" ON "points_statements"("user_id","period");
+
+CREATE TABLE "sms_messages" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"phone" text NOT NULL,"purpose" text NOT NULL,"provider" text NOT NULL,"provider_id" text,"status" text NOT NULL,"error" text);
+CREATE INDEX "idx_sms_messages_provider" ON "sms_messages"("provider","provider_id");
+CREATE INDEX "idx_sms_messages_user" ON "sms_messages"("created_at","user_id");
+
+CREATE TABLE "suppressed_addresses" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"address" text NOT NULL,"reason" text,"detail" text);
+CREATE UNIQUE INDEX "idx_suppressed_addresses_address" ON "suppressed_addresses"("address");
+
+CREATE TABLE "experiment_exposures" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"experiment" text NOT NULL,"variant" text NOT NULL);
+CREATE INDEX "idx_experiment_exposures_experiment" ON "experiment_exposures"("experiment");
+CREATE UNIQUE INDEX "idx_experiment_exposures_user" ON "experiment_exposures"("user_id","experiment");
+
+CREATE TABLE "refresh_tokens" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"family_id" text NOT NULL,"token_hash" text NOT NULL,"expires_at" timestamptz,"used_at" timestamptz,"revoked_at" timestamptz);
+CREATE UNIQUE INDEX "idx_refresh_tokens_token_hash" ON "refresh_tokens"("token_hash");
+CREATE INDEX "idx_refresh_tokens_family_id" ON "refresh_tokens"("family_id");
+CREATE INDEX "idx_refresh_tokens_user_id" ON "refresh_tokens"("user_id");
+
+CREATE TABLE "revoked_tokens" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"jti" text NOT NULL,"user_id" bigint,"expires_at" timestamptz);
+CREATE INDEX "idx_revoked_tokens_expires_at" ON "revoked_tokens"("expires_at");
+CREATE INDEX "idx_revoked_tokens_user_id" ON "revoked_tokens"("user_id");
+CREATE UNIQUE INDEX "idx_revoked_tokens_jti" ON "revoked_tokens"("jti");
+
+CREATE TABLE "password_resets" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"token_hash" text NOT NULL,"expires_at" timestamptz NOT NULL,"consumed_at" timestamptz);
+CREATE UNIQUE INDEX "idx_password_resets_token_hash" ON "password_resets"("token_hash");
+CREATE INDEX "idx_password_resets_user_id" ON "password_resets"("user_id");
+
+CREATE TABLE "email_verifications" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"email" text NOT NULL,"token_hash" text NOT NULL,"expires_at" timestamptz NOT NULL,"consumed_at" timestamptz);
+CREATE UNIQUE INDEX "idx_email_verifications_token_hash" ON "email_verifications"("token_hash");
+CREATE INDEX "idx_email_verifications_user_id" ON "email_verifications"("user_id");
+
+CREATE TABLE "user_identities" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"provider" text NOT NULL,"subject" text NOT NULL,"email" text);
+CREATE UNIQUE INDEX "idx_user_identities_provider_subject" ON "user_identities"("provider","subject") WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX "idx_user_identities_user_provider" ON "user_identities"("user_id","provider") WHERE deleted_at IS NULL;
+CREATE INDEX "idx_user_identities_deleted_at" ON "user_identities"("deleted_at");
+
+CREATE TABLE "two_factors" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"secret_encrypted" text NOT NULL,"enabled_at" timestamptz,"last_used_step" bigint,"failed_attempts" bigint,"last_failed_at" timestamptz);
+CREATE UNIQUE INDEX "idx_two_factors_user_id" ON "two_factors"("user_id");
+
+CREATE TABLE "recovery_codes" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"code_hash" text NOT NULL,"used_at" timestamptz);
+CREATE INDEX "idx_recovery_codes_user_id" ON "recovery_codes"("user_id");
+
+CREATE TABLE "login_otps" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"phone" text NOT NULL,"code_hash" text NOT NULL,"expires_at" timestamptz NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"consumed_at" timestamptz);
+CREATE INDEX "idx_login_otps_phone" ON "login_otps"("phone");
+CREATE INDEX "idx_login_otps_user_id" ON "login_otps"("user_id");
+
+CREATE TABLE "sessions" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"family_id" text NOT NULL,"ip" text,"user_agent" text,"last_seen_at" timestamptz,"last_ip" text,"expires_at" timestamptz);
+CREATE INDEX "idx_sessions_expires_at" ON "sessions"("expires_at");
+CREATE UNIQUE INDEX "idx_sessions_family_id" ON "sessions"("family_id");
+CREATE INDEX "idx_sessions_user_id" ON "sessions"("user_id");
+CREATE INDEX "idx_sessions_created_at" ON "sessions"("created_at");
+
+CREATE TABLE "api_keys" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"name" text NOT NULL,"key_hash" text NOT NULL,"key_prefix" text,"scopes" text,"expires_at" timestamptz,"last_used_at" timestamptz,"revoked_at" timestamptz);
+CREATE UNIQUE INDEX "idx_api_keys_key_hash" ON "api_keys"("key_hash");
+CREATE INDEX "idx_api_keys_user_id" ON "api_keys"("user_id");
+
+CREATE TABLE "point_transactions" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"type" text NOT NULL,"amount" bigint NOT NULL,"balance_after" bigint NOT NULL,"reason" text,"reference" text,"idempotency_key" text,"remaining" bigint NOT NULL DEFAULT 0,"expires_at" timestamptz,"expiry_notice_at" timestamptz);
+CREATE INDEX "idx_point_transactions_expires_at" ON "point_transactions"("expires_at");
+CREATE UNIQUE INDEX "idx_point_transactions_idempotency" ON "point_transactions"("reference","idempotency_key") WHERE idempotency_key <> '';
+CREATE INDEX "idx_point_transactions_reference" ON "point_transactions"("reference");
+CREATE INDEX "idx_point_transactions_user_id" ON "point_transactions"("user_id");
+CREATE INDEX "idx_point_transactions_created_at" ON "point_transactions"("created_at");
+
+CREATE TABLE "tier_changes" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"user_id" bigint NOT NULL,"from_tier" text,"to_tier" text NOT NULL,"upgrade" boolean,"qualifying_points" bigint,"reason" text,"notified_at" timestamptz);
+CREATE INDEX "idx_tier_changes_notified_at" ON "tier_changes"("notified_at");
+CREATE INDEX "idx_tier_changes_user_id" ON "tier_changes"("user_id");
+CREATE INDEX "idx_tier_changes_created_at" ON "tier_changes"("created_at");
+
+CREATE TABLE "rewards" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL,"description" text,"image_url" text,"image_key" text,"cost" bigint NOT NULL,"stock" bigint NOT NULL,"active" boolean NOT NULL DEFAULT true);
+CREATE INDEX "idx_rewards_deleted_at" ON "rewards"("deleted_at");
+
+CREATE TABLE "redemptions" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"reward_id" bigint NOT NULL,"reward_name" text,"points" bigint NOT NULL,"status" text NOT NULL,"code" text NOT NULL,"fulfilled_at" timestamptz,"cancelled_at" timestamptz);
+CREATE UNIQUE INDEX "idx_redemptions_code" ON "redemptions"("code");
+CREATE INDEX "idx_redemptions_status" ON "redemptions"("status");
+CREATE INDEX "idx_redemptions_reward_id" ON "redemptions"("reward_id");
+CREATE INDEX "idx_redemptions_user_id" ON "redemptions"("user_id");
+
+CREATE TABLE "referrals" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"referrer_id" bigint NOT NULL,"referred_id" bigint NOT NULL,"code" text NOT NULL,"status" text NOT NULL DEFAULT 'pending',"completed_at" timestamptz,"referrer_points" bigint,"referred_points" bigint);
+CREATE INDEX "idx_referrals_status" ON "referrals"("status");
+CREATE UNIQUE INDEX "idx_referrals_referred_id" ON "referrals"("referred_id");
+CREATE INDEX "idx_referrals_referrer_id" ON "referrals"("referrer_id");
+
+CREATE TABLE "coupons" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"code" text NOT NULL,"batch" text,"name" text NOT NULL,"type" text NOT NULL,"value" bigint NOT NULL,"max_uses" bigint NOT NULL,"uses" bigint NOT NULL DEFAULT 0,"active" boolean NOT NULL DEFAULT true,"starts_at" timestamptz,"ends_at" timestamptz);
+CREATE INDEX "idx_coupons_batch" ON "coupons"("batch");
+CREATE UNIQUE INDEX "idx_coupons_code" ON "coupons"("code");
+
+CREATE TABLE "coupon_uses" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"coupon_id" bigint NOT NULL,"user_id" bigint NOT NULL,"code" text NOT NULL,"name" text,"type" text NOT NULL,"value" bigint);
+CREATE INDEX "idx_coupon_uses_user_id" ON "coupon_uses"("user_id");
+CREATE UNIQUE INDEX "idx_coupon_uses_user" ON "coupon_uses"("coupon_id","user_id");
+
+CREATE TABLE "wallet_accounts" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"code" text,"currency" text NOT NULL,"balance" bigint NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX "idx_wallet_accounts_code" ON "wallet_accounts"("code") WHERE code <> '';
+CREATE UNIQUE INDEX "idx_wallet_accounts_user_id" ON "wallet_accounts"("user_id");
+
+CREATE TABLE "wallet_transactions" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"type" text NOT NULL,"amount" bigint NOT NULL,"description" text,"reference" text,"initiator_id" bigint NOT NULL,"idempotency_key" text);
+CREATE UNIQUE INDEX "idx_wallet_transactions_idempotency" ON "wallet_transactions"("initiator_id","idempotency_key") WHERE idempotency_key <> '';
+
+CREATE TABLE "wallet_entries" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"transaction_id" bigint NOT NULL,"account_id" bigint NOT NULL,"type" text NOT NULL,"description" text,"amount" bigint NOT NULL,"balance_after" bigint NOT NULL);
+CREATE INDEX "idx_wallet_entries_account_id" ON "wallet_entries"("account_id");
+CREATE INDEX "idx_wallet_entries_transaction_id" ON "wallet_entries"("transaction_id");
+CREATE INDEX "idx_wallet_entries_created_at" ON "wallet_entries"("created_at");
+
+CREATE TABLE "scheduled_runs" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"job" text NOT NULL,"due_at" timestamptz NOT NULL,"instance" text,"job_id" text,"status" text NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"error" text,"started_at" timestamptz,"finished_at" timestamptz);
+CREATE INDEX "idx_scheduled_runs_status" ON "scheduled_runs"("status");
+CREATE UNIQUE INDEX "idx_scheduled_runs_due" ON "scheduled_runs"("job","due_at");
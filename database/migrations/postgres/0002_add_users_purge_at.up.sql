@@ -0,0 +1,3 @@
+-- Accounts deleted by their owner are purged for good at purge_at.
+ALTER TABLE "users" ADD COLUMN "purge_at" timestamptz;
+CREATE INDEX "idx_users_purge_at" ON "users"("purge_at");
@@ -0,0 +1,4 @@
+-- Copies of a member's data requested with POST /profile/data-export.
+CREATE TABLE "data_exports" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"status" text NOT NULL,"job_id" text,"storage_key" text,"size" bigint,"ready_at" timestamptz,"expires_at" timestamptz);
+CREATE INDEX "idx_data_exports_user_id" ON "data_exports"("user_id");
+CREATE INDEX "idx_data_exports_expires_at" ON "data_exports"("expires_at");
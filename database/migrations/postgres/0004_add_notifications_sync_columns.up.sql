@@ -0,0 +1,4 @@
+-- Notifications report changes and deletions to GET /sync.
+ALTER TABLE "notifications" ADD COLUMN "updated_at" timestamptz;
+ALTER TABLE "notifications" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_notifications_deleted_at" ON "notifications"("deleted_at");
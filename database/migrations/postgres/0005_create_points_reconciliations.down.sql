@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "points_mismatches";
+DROP TABLE IF EXISTS "points_reconciliations";
@@ -0,0 +1,5 @@
+-- Runs of the nightly comparison of balances with the points ledger.
+CREATE TABLE "points_reconciliations" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"finished_at" timestamptz,"policy" text NOT NULL,"members" bigint NOT NULL DEFAULT 0,"mismatches" bigint NOT NULL DEFAULT 0,"fixed" bigint NOT NULL DEFAULT 0);
+CREATE TABLE "points_mismatches" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"reconciliation_id" bigint NOT NULL,"user_id" bigint NOT NULL,"balance" bigint NOT NULL,"ledger_total" bigint NOT NULL,"last_balance" bigint NOT NULL,"fixed" boolean NOT NULL DEFAULT false);
+CREATE INDEX "idx_points_mismatches_reconciliation_id" ON "points_mismatches"("reconciliation_id");
+CREATE INDEX "idx_points_mismatches_user_id" ON "points_mismatches"("user_id");
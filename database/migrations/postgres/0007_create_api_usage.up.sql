@@ -0,0 +1,4 @@
+-- Hourly request counts per API key and route, for partner usage and admin reports.
+CREATE TABLE "api_usage" ("id" bigserial PRIMARY KEY,"key_type" text NOT NULL,"key_id" bigint NOT NULL,"hour" timestamptz NOT NULL,"method" text NOT NULL,"route" text NOT NULL,"requests" bigint NOT NULL DEFAULT 0,"client_errors" bigint NOT NULL DEFAULT 0,"server_errors" bigint NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX "idx_api_usage_bucket" ON "api_usage"("key_type","key_id","hour","method","route");
+CREATE INDEX "idx_api_usage_hour" ON "api_usage"("hour");
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "settlement_disputes";
+DROP TABLE IF EXISTS "settlement_adjustments";
+DROP TABLE IF EXISTS "settlements";
@@ -0,0 +1,8 @@
+-- Monthly settlements of partner-earned points, with their adjustments and disputes.
+CREATE TABLE "settlements" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"partner_id" bigint NOT NULL,"period" text NOT NULL,"status" text NOT NULL DEFAULT 'open',"transactions" bigint NOT NULL DEFAULT 0,"points" bigint NOT NULL DEFAULT 0,"adjusted" bigint NOT NULL DEFAULT 0,"total" bigint NOT NULL DEFAULT 0,"signed_off_at" timestamptz,"signed_off_by" text);
+CREATE UNIQUE INDEX "idx_settlements_partner_period" ON "settlements"("partner_id","period");
+CREATE INDEX "idx_settlements_period" ON "settlements"("period");
+CREATE TABLE "settlement_adjustments" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"settlement_id" bigint NOT NULL,"points" bigint NOT NULL,"reason" text NOT NULL,"dispute_id" bigint,"created_by" text NOT NULL);
+CREATE INDEX "idx_settlement_adjustments_settlement_id" ON "settlement_adjustments"("settlement_id");
+CREATE TABLE "settlement_disputes" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"settlement_id" bigint NOT NULL,"transaction_id" bigint,"reason" text NOT NULL,"status" text NOT NULL DEFAULT 'open',"resolution" text,"resolved_at" timestamptz,"resolved_by" text);
+CREATE INDEX "idx_settlement_disputes_settlement_id" ON "settlement_disputes"("settlement_id");
@@ -0,0 +1,4 @@
+-- Uploaded content going through moderation, with the admin review queue.
+CREATE TABLE "moderation_items" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint NOT NULL,"kind" text NOT NULL,"key" text NOT NULL,"quarantine_key" text,"status" text NOT NULL DEFAULT 'pending',"labels" text,"reviewed_at" timestamptz,"reviewed_by" text);
+CREATE INDEX "idx_moderation_items_user_id" ON "moderation_items"("user_id");
+CREATE INDEX "idx_moderation_items_status" ON "moderation_items"("status");
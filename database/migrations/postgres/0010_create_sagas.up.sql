@@ -0,0 +1,7 @@
+-- Progress of multi-step work such as redemptions, and the voucher codes redemptions are issued.
+CREATE TABLE "sagas" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"kind" text NOT NULL,"user_id" bigint NOT NULL,"status" text NOT NULL,"completed" bigint NOT NULL DEFAULT 0,"step" text,"attempts" bigint NOT NULL DEFAULT 0,"last_error" text,"failure" text,"next_attempt_at" timestamptz NOT NULL,"state" text,"version" bigint NOT NULL DEFAULT 0);
+CREATE INDEX "idx_sagas_kind" ON "sagas"("kind");
+CREATE INDEX "idx_sagas_user_id" ON "sagas"("user_id");
+CREATE INDEX "idx_sagas_status" ON "sagas"("status");
+CREATE INDEX "idx_sagas_next_attempt_at" ON "sagas"("next_attempt_at");
+ALTER TABLE "redemptions" ADD COLUMN "voucher_code" text;
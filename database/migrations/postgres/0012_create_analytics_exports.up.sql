@@ -0,0 +1,2 @@
+-- How far each dataset of the analytics export has been written, and the columns its files are published with.
+CREATE TABLE "analytics_exports" ("dataset" text,"version" bigint NOT NULL,"columns" text,"exported_through" text,"updated_at" timestamptz,PRIMARY KEY ("dataset"));
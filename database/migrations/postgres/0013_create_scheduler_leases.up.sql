@@ -0,0 +1,2 @@
+-- The lease of the instance that runs the scheduled jobs.
+CREATE TABLE "scheduler_leases" ("name" text,"holder" text NOT NULL,"acquired_at" timestamptz NOT NULL,"renewed_at" timestamptz NOT NULL,"expires_at" timestamptz NOT NULL,PRIMARY KEY ("name"));
@@ -0,0 +1,4 @@
+-- Announcements shown to members and feature flags of the clients.
+CREATE TABLE "announcements" ("id" bigserial PRIMARY KEY,"created_at" timestamptz,"updated_at" timestamptz,"title" text NOT NULL,"body" text NOT NULL,"starts_at" timestamptz NOT NULL,"ends_at" timestamptz);
+CREATE INDEX "idx_announcements_starts_at" ON "announcements"("starts_at");
+CREATE TABLE "feature_flags" ("key" text,"enabled" boolean NOT NULL,"description" text,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("key"));
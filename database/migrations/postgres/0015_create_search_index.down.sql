@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "search_grams";
+DROP TABLE IF EXISTS "search_documents";
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `idx_users_purge_at`;
+ALTER TABLE `users` DROP COLUMN `purge_at`;
@@ -0,0 +1,4 @@
+-- Copies of a member's data requested with POST /profile/data-export.
+CREATE TABLE `data_exports` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`user_id` integer NOT NULL,`status` text NOT NULL,`job_id` text,`storage_key` text,`size` integer,`ready_at` datetime,`expires_at` datetime);
+CREATE INDEX `idx_data_exports_user_id` ON `data_exports`(`user_id`);
+CREATE INDEX `idx_data_exports_expires_at` ON `data_exports`(`expires_at`);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `idx_notifications_deleted_at`;
+ALTER TABLE `notifications` DROP COLUMN `deleted_at`;
+ALTER TABLE `notifications` DROP COLUMN `updated_at`;
@@ -0,0 +1,5 @@
+-- Runs of the nightly comparison of balances with the points ledger.
+CREATE TABLE `points_reconciliations` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`finished_at` datetime,`policy` text NOT NULL,`members` integer NOT NULL DEFAULT 0,`mismatches` integer NOT NULL DEFAULT 0,`fixed` integer NOT NULL DEFAULT 0);
+CREATE TABLE `points_mismatches` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`reconciliation_id` integer NOT NULL,`user_id` integer NOT NULL,`balance` integer NOT NULL,`ledger_total` integer NOT NULL,`last_balance` integer NOT NULL,`fixed` numeric NOT NULL DEFAULT false);
+CREATE INDEX `idx_points_mismatches_reconciliation_id` ON `points_mismatches`(`reconciliation_id`);
+CREATE INDEX `idx_points_mismatches_user_id` ON `points_mismatches`(`user_id`);
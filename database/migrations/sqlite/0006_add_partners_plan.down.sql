@@ -0,0 +1 @@
+ALTER TABLE `partners` DROP COLUMN `plan`;
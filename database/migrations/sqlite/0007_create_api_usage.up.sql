@@ -0,0 +1,4 @@
+-- Hourly request counts per API key and route, for partner usage and admin reports.
+CREATE TABLE `api_usage` (`id` integer PRIMARY KEY AUTOINCREMENT,`key_type` text NOT NULL,`key_id` integer NOT NULL,`hour` datetime NOT NULL,`method` text NOT NULL,`route` text NOT NULL,`requests` integer NOT NULL DEFAULT 0,`client_errors` integer NOT NULL DEFAULT 0,`server_errors` integer NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX `idx_api_usage_bucket` ON `api_usage`(`key_type`,`key_id`,`hour`,`method`,`route`);
+CREATE INDEX `idx_api_usage_hour` ON `api_usage`(`hour`);
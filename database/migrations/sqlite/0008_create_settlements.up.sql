@@ -0,0 +1,8 @@
+-- Monthly settlements of partner-earned points, with their adjustments and disputes.
+CREATE TABLE `settlements` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`partner_id` integer NOT NULL,`period` text NOT NULL,`status` text NOT NULL DEFAULT "open",`transactions` integer NOT NULL DEFAULT 0,`points` integer NOT NULL DEFAULT 0,`adjusted` integer NOT NULL DEFAULT 0,`total` integer NOT NULL DEFAULT 0,`signed_off_at` datetime,`signed_off_by` text);
+CREATE UNIQUE INDEX `idx_settlements_partner_period` ON `settlements`(`partner_id`,`period`);
+CREATE INDEX `idx_settlements_period` ON `settlements`(`period`);
+CREATE TABLE `settlement_adjustments` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`settlement_id` integer NOT NULL,`points` integer NOT NULL,`reason` text NOT NULL,`dispute_id` integer,`created_by` text NOT NULL);
+CREATE INDEX `idx_settlement_adjustments_settlement_id` ON `settlement_adjustments`(`settlement_id`);
+CREATE TABLE `settlement_disputes` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`settlement_id` integer NOT NULL,`transaction_id` integer,`reason` text NOT NULL,`status` text NOT NULL DEFAULT "open",`resolution` text,`resolved_at` datetime,`resolved_by` text);
+CREATE INDEX `idx_settlement_disputes_settlement_id` ON `settlement_disputes`(`settlement_id`);
@@ -0,0 +1,4 @@
+-- Uploaded content going through moderation, with the admin review queue.
+CREATE TABLE `moderation_items` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`user_id` integer NOT NULL,`kind` text NOT NULL,`key` text NOT NULL,`quarantine_key` text,`status` text NOT NULL DEFAULT "pending",`labels` text,`reviewed_at` datetime,`reviewed_by` text);
+CREATE INDEX `idx_moderation_items_user_id` ON `moderation_items`(`user_id`);
+CREATE INDEX `idx_moderation_items_status` ON `moderation_items`(`status`);
@@ -0,0 +1,7 @@
+-- Progress of multi-step work such as redemptions, and the voucher codes redemptions are issued.
+CREATE TABLE `sagas` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`kind` text NOT NULL,`user_id` integer NOT NULL,`status` text NOT NULL,`completed` integer NOT NULL DEFAULT 0,`step` text,`attempts` integer NOT NULL DEFAULT 0,`last_error` text,`failure` text,`next_attempt_at` datetime NOT NULL,`state` text,`version` integer NOT NULL DEFAULT 0);
+CREATE INDEX `idx_sagas_kind` ON `sagas`(`kind`);
+CREATE INDEX `idx_sagas_user_id` ON `sagas`(`user_id`);
+CREATE INDEX `idx_sagas_status` ON `sagas`(`status`);
+CREATE INDEX `idx_sagas_next_attempt_at` ON `sagas`(`next_attempt_at`);
+ALTER TABLE `redemptions` ADD COLUMN `voucher_code` text;
@@ -0,0 +1,2 @@
+-- The lease of the instance that runs the scheduled jobs.
+CREATE TABLE `scheduler_leases` (`name` text,`holder` text NOT NULL,`acquired_at` datetime NOT NULL,`renewed_at` datetime NOT NULL,`expires_at` datetime NOT NULL,PRIMARY KEY (`name`));
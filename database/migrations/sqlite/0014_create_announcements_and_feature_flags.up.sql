@@ -0,0 +1,4 @@
+-- Announcements shown to members and feature flags of the clients.
+CREATE TABLE `announcements` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`title` text NOT NULL,`body` text NOT NULL,`starts_at` datetime NOT NULL,`ends_at` datetime);
+CREATE INDEX `idx_announcements_starts_at` ON `announcements`(`starts_at`);
+CREATE TABLE `feature_flags` (`key` text,`enabled` numeric NOT NULL,`description` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`key`));
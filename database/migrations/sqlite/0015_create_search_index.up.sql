@@ -0,0 +1,4 @@
+-- The admin search's index of users and points transactions; the records already there are indexed after it (see migrationBackfills).
+CREATE TABLE `search_documents` (`kind` text,`id` integer,`content` text NOT NULL,PRIMARY KEY (`kind`,`id`));
+CREATE TABLE `search_grams` (`kind` text,`document_id` integer,`gram` text,PRIMARY KEY (`kind`,`document_id`,`gram`));
+CREATE INDEX `idx_search_grams_gram` ON `search_grams`(`gram`);
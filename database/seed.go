@@ -0,0 +1,114 @@
+package database
+
+import (
+	"cmp"
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/referral"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Demo account created by Seed so the API can be tried without registering.
+const (
+	SeedUserEmail    = "demo@example.com"
+	SeedUserPassword = "password123"
+)
+
+// Default admin created by Seed. Its password can be set with
+// SEED_ADMIN_PASSWORD.
+const (
+	SeedAdminEmail    = "admin@example.com"
+	SeedAdminPassword = "admin12345"
+)
+
+// Seed inserts demo data. It is safe to run repeatedly.
+func Seed(db *gorm.DB) error {
+	now := time.Now()
+	seeds := []struct {
+		password string
+		points   int
+		user     models.User
+	}{
+		{SeedUserPassword, 1500, models.User{
+			Email:           SeedUserEmail,
+			EmailVerifiedAt: &now,
+			FirstName:       "Demo",
+			LastName:        "User",
+			RomanizedName:   "Demo User",
+			Phone:           "+66812345678",
+			MembershipID:    "LBK00001",
+			MemberLevel:     "Silver",
+			Role:            models.RoleMember,
+		}},
+		{cmp.Or(config.Get().Database.SeedAdminPassword, SeedAdminPassword), 0, models.User{
+			Email:           SeedAdminEmail,
+			EmailVerifiedAt: &now,
+			FirstName:       "Admin",
+			LastName:        "User",
+			RomanizedName:   "Admin User",
+			MembershipID:    "LBK00000",
+			MemberLevel:     "Bronze",
+			Role:            models.RoleAdmin,
+		}},
+	}
+
+	for _, seed := range seeds {
+		var existing models.User
+		err := db.Where("email = ?", seed.user.Email).First(&existing).Error
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(seed.password), config.Get().BcryptCost)
+		if err != nil {
+			return err
+		}
+
+		user := seed.user
+		user.EmailCanonical = normalize.CanonicalEmail(user.Email)
+		user.Password = string(hashedPassword)
+		user.ReferralCode = referral.NewCode()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if seed.points == 0 {
+				return nil
+			}
+			_, err := points.Post(tx, &user, models.PointTransaction{
+				Type:      models.PointTransactionEarn,
+				Amount:    seed.points,
+				Reason:    "Demo balance",
+				Reference: "seed",
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// A small demo catalog, only on an empty rewards table
+	var rewards int64
+	if err := db.Model(&models.Reward{}).Count(&rewards).Error; err != nil {
+		return err
+	}
+	if rewards > 0 {
+		return nil
+	}
+	return db.Create([]models.Reward{
+		{Name: "Free coffee", Description: "Any hot or iced coffee at partner cafes", Cost: 300, Stock: 500, Active: true},
+		{Name: "Movie ticket", Description: "One 2D standard seat, any day", Cost: 1200, Stock: 100, Active: true},
+		{Name: "100 THB shopping voucher", Description: "Valid at partner stores for 30 days", Cost: 2000, Stock: 50, Active: true},
+	}).Error
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/requestid"
+
+	"gorm.io/gorm"
+)
+
+const slowQueryStartKey = "slowquery:start"
+
+// slowQueryPlugin logs every statement that takes longer than threshold,
+// with the ID of the request that ran it when the statement was run with
+// the request's context, i.e. db.WithContext(c.UserContext()). Like the
+// tracing plugin it logs the SQL with placeholders, never the bound
+// values.
+type slowQueryPlugin struct {
+	threshold time.Duration
+}
+
+func (slowQueryPlugin) Name() string {
+	return "slowquery"
+}
+
+func (p slowQueryPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, proc := range processors {
+		if err := proc.before("slowquery:before_"+proc.name, startTimer); err != nil {
+			return err
+		}
+		if err := proc.after("slowquery:after_"+proc.name, p.logSlow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(slowQueryStartKey, time.Now())
+}
+
+func (p slowQueryPlugin) logSlow(db *gorm.DB) {
+	value, ok := db.InstanceGet(slowQueryStartKey)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(value.(time.Time))
+	if elapsed < p.threshold {
+		return
+	}
+
+	id := requestid.FromContext(db.Statement.Context)
+	if id == "" {
+		id = "-"
+	}
+	log.Printf("[db] slow query %s rows=%d request_id=%s: %s",
+		elapsed.Round(time.Microsecond), db.Statement.RowsAffected, id, db.Statement.SQL.String())
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownResource is returned for resource names without a registered
+// soft-delete policy.
+var ErrUnknownResource = errors.New("unknown resource")
+
+// CascadeRule soft-deletes, restores and purges child rows together with
+// their parent. Children are matched on ForeignKey = parent ID.
+type CascadeRule struct {
+	Model      interface{}
+	ForeignKey string
+}
+
+// SoftDeletePolicy describes how a soft-deletable model is managed.
+type SoftDeletePolicy struct {
+	Model   interface{}
+	Cascade []CascadeRule
+	// Owned lists child rows without a DeletedAt field. They stay while the
+	// parent is soft-deleted and are removed when it is purged.
+	Owned []CascadeRule
+	// ClearOnRestore are columns set to NULL when the row is restored.
+	ClearOnRestore []string
+	// Describe lists soft-deleted rows for the admin trash view.
+	Describe func(db *gorm.DB) ([]models.DeletedRecord, error)
+}
+
+// SoftDeletePolicies maps the resource names used in admin URLs to their
+// policies. Every model with a gorm.DeletedAt field should be registered, and
+// models owned by a user (addresses, devices, ...) should be added to the
+// "users" cascade, or to its owned rows when they cannot be soft-deleted.
+var SoftDeletePolicies = map[string]SoftDeletePolicy{
+	"users": {
+		Model: &models.User{},
+		// A restored account is no longer due to be purged
+		ClearOnRestore: []string{"purge_at"},
+		Cascade: []CascadeRule{
+			{Model: &models.Device{}, ForeignKey: "user_id"},
+			{Model: &models.UserIdentity{}, ForeignKey: "user_id"},
+			{Model: &models.Address{}, ForeignKey: "user_id"},
+		},
+		Owned: []CascadeRule{
+			{Model: &models.PhoneVerification{}, ForeignKey: "user_id"},
+			{Model: &models.CampaignAward{}, ForeignKey: "user_id"},
+			{Model: &models.NotificationPreference{}, ForeignKey: "user_id"},
+			{Model: &models.UserSettings{}, ForeignKey: "user_id"},
+			{Model: &models.Notification{}, ForeignKey: "user_id"},
+			{Model: &models.PointsStatement{}, ForeignKey: "user_id"},
+			{Model: &models.SMSMessage{}, ForeignKey: "user_id"},
+			{Model: &models.ExperimentExposure{}, ForeignKey: "user_id"},
+			{Model: &models.RefreshToken{}, ForeignKey: "user_id"},
+			{Model: &models.PasswordReset{}, ForeignKey: "user_id"},
+			{Model: &models.EmailVerification{}, ForeignKey: "user_id"},
+			{Model: &models.TwoFactor{}, ForeignKey: "user_id"},
+			{Model: &models.RecoveryCode{}, ForeignKey: "user_id"},
+			{Model: &models.LoginOTP{}, ForeignKey: "user_id"},
+			{Model: &models.Session{}, ForeignKey: "user_id"},
+			{Model: &models.APIKey{}, ForeignKey: "user_id"},
+			{Model: &models.PointTransaction{}, ForeignKey: "user_id"},
+			{Model: &models.PointsMismatch{}, ForeignKey: "user_id"},
+			{Model: &models.TierChange{}, ForeignKey: "user_id"},
+			{Model: &models.DomainEvent{}, ForeignKey: "user_id"},
+			{Model: &models.Redemption{}, ForeignKey: "user_id"},
+			{Model: &models.Saga{}, ForeignKey: "user_id"},
+			{Model: &models.Referral{}, ForeignKey: "referrer_id"},
+			{Model: &models.Referral{}, ForeignKey: "referred_id"},
+			{Model: &models.CouponUse{}, ForeignKey: "user_id"},
+			{Model: &models.DataExport{}, ForeignKey: "user_id"},
+			{Model: &models.ModerationItem{}, ForeignKey: "user_id"},
+			// Wallet accounts and their entries are kept so the wallet
+			// ledger still balances
+		},
+		Describe: func(db *gorm.DB) ([]models.DeletedRecord, error) {
+			var users []models.User
+			if err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&users).Error; err != nil {
+				return nil, err
+			}
+			records := make([]models.DeletedRecord, len(users))
+			for i, user := range users {
+				records[i] = models.DeletedRecord{
+					Resource:  "users",
+					ID:        user.ID,
+					Label:     fmt.Sprintf("%s (%s)", user.Email, user.MembershipID),
+					DeletedAt: user.DeletedAt.Time,
+				}
+			}
+			return records, nil
+		},
+	},
+	// Redemptions keep a copy of the reward's name and cost, so they are
+	// left alone when a reward is purged
+	"rewards": {
+		Model: &models.Reward{},
+		Describe: func(db *gorm.DB) ([]models.DeletedRecord, error) {
+			var rewards []models.Reward
+			if err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&rewards).Error; err != nil {
+				return nil, err
+			}
+			records := make([]models.DeletedRecord, len(rewards))
+			for i, reward := range rewards {
+				records[i] = models.DeletedRecord{
+					Resource:  "rewards",
+					ID:        reward.ID,
+					Label:     fmt.Sprintf("%s (%d points)", reward.Name, reward.Cost),
+					DeletedAt: reward.DeletedAt.Time,
+				}
+			}
+			return records, nil
+		},
+	},
+}
+
+func policyFor(resource string) (SoftDeletePolicy, error) {
+	policy, ok := SoftDeletePolicies[resource]
+	if !ok {
+		return SoftDeletePolicy{}, ErrUnknownResource
+	}
+	return policy, nil
+}
+
+// ListDeleted returns the soft-deleted rows of resource.
+func ListDeleted(db *gorm.DB, resource string) ([]models.DeletedRecord, error) {
+	policy, err := policyFor(resource)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Describe(db)
+}
+
+// SoftDelete marks a row and its cascaded children as deleted. Children get
+// the parent's deletion time so Restore can bring back exactly that set.
+func SoftDelete(db *gorm.DB, resource string, id uint) error {
+	policy, err := policyFor(resource)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(policy.Model).Where("id = ?", id).Update("deleted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		for _, rule := range policy.Cascade {
+			err := tx.Model(rule.Model).Where(rule.ForeignKey+" = ?", id).Update("deleted_at", now).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore clears the deletion mark of a soft-deleted row and of the children
+// that were cascaded with it.
+func Restore(db *gorm.DB, resource string, id uint) error {
+	policy, err := policyFor(resource)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var row struct{ DeletedAt *time.Time }
+		err := tx.Unscoped().Model(policy.Model).Select("deleted_at").
+			Where("id = ? AND deleted_at IS NOT NULL", id).Take(&row).Error
+		if err != nil {
+			return err
+		}
+
+		columns := map[string]interface{}{"deleted_at": nil}
+		for _, column := range policy.ClearOnRestore {
+			columns[column] = nil
+		}
+		if err := tx.Unscoped().Model(policy.Model).Where("id = ?", id).Updates(columns).Error; err != nil {
+			return err
+		}
+		for _, rule := range policy.Cascade {
+			err := tx.Unscoped().Model(rule.Model).
+				Where(rule.ForeignKey+" = ? AND deleted_at = ?", id, row.DeletedAt).
+				Update("deleted_at", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Purge permanently removes a soft-deleted row and all of its children and
+// owned rows.
+func Purge(db *gorm.DB, resource string, id uint) error {
+	policy, err := policyFor(resource)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range slices.Concat(policy.Cascade, policy.Owned) {
+			if err := tx.Unscoped().Where(rule.ForeignKey+" = ?", id).Delete(rule.Model).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Delete(policy.Model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultTiers is the reference tier configuration inserted by Migrate.
+// Existing rows are left untouched so copy edited in the database survives
+// restarts.
+var defaultTiers = []models.MemberTier{
+	{Code: "Bronze", Rank: 1, EarnMultiplier: 1, MinPoints: 0, Translations: []models.MemberTierTranslation{
+		{Locale: "en", Name: "Bronze", Description: "Welcome tier for new members", Benefits: []string{"Earn 1 point per 25 THB"}},
+		{Locale: "th", Name: "บรอนซ์", Description: "ระดับเริ่มต้นสำหรับสมาชิกใหม่", Benefits: []string{"รับ 1 คะแนนทุกการใช้จ่าย 25 บาท"}},
+	}},
+	{Code: "Silver", Rank: 2, EarnMultiplier: 1.25, MinPoints: 1000, Translations: []models.MemberTierTranslation{
+		{Locale: "en", Name: "Silver", Description: "For regular members", Benefits: []string{"Earn 1 point per 20 THB", "Birthday bonus points"}},
+		{Locale: "th", Name: "ซิลเวอร์", Description: "สำหรับสมาชิกประจำ", Benefits: []string{"รับ 1 คะแนนทุกการใช้จ่าย 20 บาท", "คะแนนพิเศษในเดือนเกิด"}},
+	}},
+	{Code: "Gold", Rank: 3, EarnMultiplier: 1.5, MinPoints: 5000, Translations: []models.MemberTierTranslation{
+		{Locale: "en", Name: "Gold", Description: "For our valued members", Benefits: []string{"Earn 1 point per 15 THB", "Birthday bonus points", "Exclusive rewards"}},
+		{Locale: "th", Name: "โกลด์", Description: "สำหรับสมาชิกคนสำคัญของเรา", Benefits: []string{"รับ 1 คะแนนทุกการใช้จ่าย 15 บาท", "คะแนนพิเศษในเดือนเกิด", "ของรางวัลพิเศษเฉพาะสมาชิก"}},
+	}},
+	{Code: "Platinum", Rank: 4, EarnMultiplier: 2.5, MinPoints: 15000, Translations: []models.MemberTierTranslation{
+		{Locale: "en", Name: "Platinum", Description: "Our highest tier", Benefits: []string{"Earn 1 point per 10 THB", "Birthday bonus points", "Exclusive rewards", "Priority support"}},
+		{Locale: "th", Name: "แพลทินัม", Description: "ระดับสูงสุดของเรา", Benefits: []string{"รับ 1 คะแนนทุกการใช้จ่าย 10 บาท", "คะแนนพิเศษในเดือนเกิด", "ของรางวัลพิเศษเฉพาะสมาชิก", "บริการลูกค้าแบบเร่งด่วน"}},
+	}},
+}
+
+// backfillEarnMultipliers sets the default earn multipliers on tiers created
+// before the column existed.
+func backfillEarnMultipliers(db *gorm.DB) error {
+	for _, tier := range defaultTiers {
+		err := db.Model(&models.MemberTier{}).Where("code = ?", tier.Code).
+			Update("earn_multiplier", tier.EarnMultiplier).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillTierThresholds sets the default thresholds on tiers created before
+// members were placed in tiers automatically.
+func backfillTierThresholds(db *gorm.DB) error {
+	for _, tier := range defaultTiers {
+		err := db.Model(&models.MemberTier{}).Where("code = ?", tier.Code).
+			Update("min_points", tier.MinPoints).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedTiers inserts any missing tiers and translations.
+func seedTiers(db *gorm.DB) error {
+	for _, tier := range defaultTiers {
+		translations := tier.Translations
+		tier.Translations = nil
+
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tier).Error; err != nil {
+			return err
+		}
+		for _, translation := range translations {
+			translation.TierCode = tier.Code
+			if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&translation).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package events publishes domain events such as points.earned. Publish
+// hands each event to the webhook endpoints subscribed to it and, when
+// events.broker is set, to the message broker for analytics and other
+// services.
+//
+// Both go through the database: Publish writes the deliveries and a
+// pending_events row in the transaction of the change, and the relay of
+// Start publishes the pending events to NATS or Kafka, deleting each once
+// the broker has it. While the broker is down the events wait in the table
+// and are retried with backoff, in their original order.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/outbox"
+	"temp-backend-at-kbtg/retry"
+	"temp-backend-at-kbtg/webhook"
+	"temp-backend-at-kbtg/worker"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// pollInterval is how often the relay looks for pending events, and
+	// batchSize how many it takes at a time.
+	pollInterval = time.Second
+	batchSize    = 100
+	// claimTimeout is how long an event being published is left alone by
+	// other instances.
+	claimTimeout = time.Minute
+)
+
+// backoff is the delay after a failed attempt: a second after the first,
+// doubling with every further failure up to 5 minutes. Events are never
+// dropped.
+var backoff = retry.Backoff{Delay: time.Second, MaxDelay: 5 * time.Minute}
+
+// Publisher sends payload to the subject or topic of a broker. key
+// identifies the event for brokers that partition by key.
+type Publisher interface {
+	Publish(topic, key string, payload []byte) error
+}
+
+// Default is the broker events are published to, nil when events.broker is
+// none. In PROVIDERS_MODE=mock Init sets the outbox.
+var Default Publisher
+
+// topicPrefix is put before event names to make topics.
+var topicPrefix = "loyalty."
+
+// Init sets Default to the broker in cfg. PROVIDERS_MODE=mock selects the
+// outbox whatever the broker.
+func Init(cfg config.EventsConfig) error {
+	topicPrefix = cfg.TopicPrefix
+	if outbox.MockMode() {
+		Default = OutboxPublisher{}
+		return nil
+	}
+	switch cfg.Broker {
+	case "nats":
+		nats, err := NewNATS(cfg.NATS.URL)
+		if err != nil {
+			return err
+		}
+		Default = nats
+		log.Printf("Publishing events to NATS at %s", nats.Addr)
+	case "kafka":
+		Default = NewKafka(cfg.Kafka.RESTProxyURL, cfg.Kafka.Username, cfg.Kafka.Password)
+		log.Printf("Publishing events to Kafka through %s", cfg.Kafka.RESTProxyURL)
+	}
+	return nil
+}
+
+// Publish records event with data for the webhook endpoints subscribed to
+// it and for the broker. It should run in the transaction of the change the
+// event reports, so nothing is sent when that rolls back.
+func Publish(tx *gorm.DB, event string, data interface{}) error {
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	envelope := models.Event{ID: id, Event: event, CreatedAt: now.UTC(), Data: data}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	if err := webhook.Enqueue(tx, envelope, payload); err != nil {
+		return err
+	}
+	if Default == nil {
+		return nil
+	}
+	return tx.Create(&models.PendingEvent{
+		EventID:       id,
+		Event:         event,
+		Payload:       string(payload),
+		NextAttemptAt: now,
+	}).Error
+}
+
+// UserData is the data of user.registered for user.
+func UserData(user *models.User) models.WebhookUserData {
+	return models.WebhookUserData{
+		UserID:       user.ID,
+		MembershipID: user.MembershipID,
+		Email:        user.Email,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		MemberLevel:  user.MemberLevel,
+	}
+}
+
+// Topic is the subject or topic event is published to.
+func Topic(event string) string {
+	return topicPrefix + event
+}
+
+// Start publishes pending events in the background until shutdown. It
+// does nothing when no broker is configured.
+func Start(db *gorm.DB) {
+	if Default == nil {
+		return
+	}
+	worker.Go("event relay", func(ctx context.Context) {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				relay(ctx, db)
+			}
+		}
+	})
+}
+
+// relay publishes the pending events, oldest first, until it reaches one
+// that is not due: one waiting for its retry or being published by another
+// instance. It also stops at a failure, as the broker is most likely down.
+// Either way later events do not overtake the earlier one.
+func relay(ctx context.Context, db *gorm.DB) {
+	var pending []models.PendingEvent
+	if err := db.Order("id").Limit(batchSize).Find(&pending).Error; err != nil {
+		log.Printf("[events] loading pending events failed: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range pending {
+		if ctx.Err() != nil || pending[i].NextAttemptAt.After(now) {
+			return
+		}
+		ok, err := publish(db, &pending[i])
+		if err != nil {
+			log.Printf("[events] %s %s not published (attempt %d): %v", pending[i].Event, pending[i].EventID, pending[i].Attempts, err)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// publish claims event, sends it to the broker and deletes it, or schedules
+// the next attempt. It reports whether the relay should go on with the next
+// event: false after a failure or when another instance claimed the event
+// first, and publishes the events after it in turn.
+func publish(db *gorm.DB, event *models.PendingEvent) (bool, error) {
+	claim := db.Model(&models.PendingEvent{}).
+		Where("id = ? AND attempts = ?", event.ID, event.Attempts).
+		Updates(map[string]interface{}{
+			"attempts":        event.Attempts + 1,
+			"next_attempt_at": time.Now().Add(claimTimeout),
+		})
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return false, nil
+	}
+	event.Attempts++
+
+	if err := Default.Publish(Topic(event.Event), event.EventID, []byte(event.Payload)); err != nil {
+		update := db.Model(event).Updates(map[string]interface{}{
+			"next_attempt_at": time.Now().Add(backoff.After(event.Attempts)),
+			"last_error":      retry.Error(err),
+		})
+		if update.Error != nil {
+			log.Printf("[events] retry of %s not scheduled: %v", event.EventID, update.Error)
+		}
+		return false, err
+	}
+	return true, db.Delete(event).Error
+}
+
+// Close releases the broker connection at shutdown.
+func Close() error {
+	if closer, ok := Default.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Backlog returns the number of events waiting for the broker and the age
+// of the oldest.
+func Backlog(db *gorm.DB) (int64, time.Duration, error) {
+	var oldest models.PendingEvent
+	err := db.Order("id").Limit(1).Find(&oldest).Error
+	if err != nil || oldest.ID == 0 {
+		return 0, 0, err
+	}
+	var count int64
+	if err := db.Model(&models.PendingEvent{}).Count(&count).Error; err != nil {
+		return 0, 0, err
+	}
+	return count, time.Since(oldest.CreatedAt), nil
+}
+
+func newEventID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(raw), nil
+}
+
+// OutboxPublisher records events in the mock provider outbox, with the
+// topic as recipient and the event ID as subject.
+type OutboxPublisher struct{}
+
+func (OutboxPublisher) Publish(topic, key string, payload []byte) error {
+	outbox.Record(outbox.Message{
+		Channel: outbox.ChannelEvent,
+		To:      topic,
+		Subject: key,
+		Body:    string(payload),
+	})
+	return nil
+}
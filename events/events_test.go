@@ -0,0 +1,196 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newDB opens an in-memory database with the tables Publish writes. The
+// migrations live in the database package, which imports this one.
+func newDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.PendingEvent{}, &models.WebhookEndpoint{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// fakeBroker records what it is sent, failing while err is set.
+type fakeBroker struct {
+	mu   sync.Mutex
+	err  error
+	keys []string
+}
+
+func (b *fakeBroker) Publish(topic, key string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.keys = append(b.keys, topic+" "+key)
+	return nil
+}
+
+func (b *fakeBroker) published() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.keys...)
+}
+
+// useBroker makes b the Default broker for the test.
+func useBroker(t *testing.T, b Publisher) {
+	previous, prefix := Default, topicPrefix
+	Default, topicPrefix = b, "loyalty."
+	t.Cleanup(func() { Default, topicPrefix = previous, prefix })
+}
+
+// pending returns the pending events, oldest first.
+func pending(t *testing.T, db *gorm.DB) []models.PendingEvent {
+	t.Helper()
+
+	var events []models.PendingEvent
+	if err := db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestPublishFollowsTheTransaction(t *testing.T) {
+	db := newDB(t)
+	useBroker(t, &fakeBroker{})
+
+	rollback := errors.New("rolled back")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := Publish(tx, models.WebhookEventPointsEarned, map[string]int{"points": 1}); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("transaction: %v", err)
+	}
+	if events := pending(t, db); len(events) != 0 {
+		t.Fatalf("%d events pending after a rollback, want none", len(events))
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return Publish(tx, models.WebhookEventPointsEarned, map[string]int{"points": 2})
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	events := pending(t, db)
+	if len(events) != 1 {
+		t.Fatalf("%d events pending after a commit, want 1", len(events))
+	}
+	if e := events[0]; !strings.HasPrefix(e.EventID, "evt_") || e.Event != models.WebhookEventPointsEarned || !strings.Contains(e.Payload, `"points":2`) {
+		t.Errorf("pending event = %+v", e)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db := newDB(t)
+	broker := &fakeBroker{err: errors.New("broker down")}
+	useBroker(t, broker)
+	for _, event := range []string{models.WebhookEventUserRegistered, models.WebhookEventPointsEarned} {
+		if err := Publish(db, event, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := []string{pending(t, db)[0].EventID, pending(t, db)[1].EventID}
+
+	// A failure keeps the event for a later attempt and holds back the
+	// ones after it
+	relay(context.Background(), db)
+	events := pending(t, db)
+	if len(events) != 2 {
+		t.Fatalf("%d events pending after a failure, want 2", len(events))
+	}
+	if first := events[0]; first.Attempts != 1 || first.LastError != "broker down" || !first.NextAttemptAt.After(time.Now()) {
+		t.Errorf("failed event = %+v", first)
+	}
+	if second := events[1]; second.Attempts != 0 {
+		t.Errorf("the event after the failure was attempted: %+v", second)
+	}
+
+	// The later event waits for the retry of the earlier one
+	broker.mu.Lock()
+	broker.err = nil
+	broker.mu.Unlock()
+	relay(context.Background(), db)
+	if got := broker.published(); len(got) != 0 {
+		t.Fatalf("published %v before the retry was due", got)
+	}
+
+	db.Model(&models.PendingEvent{}).Where("event_id = ?", ids[0]).Update("next_attempt_at", time.Now())
+	relay(context.Background(), db)
+	want := []string{"loyalty.user.registered " + ids[0], "loyalty.points.earned " + ids[1]}
+	if got := broker.published(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	if events := pending(t, db); len(events) != 0 {
+		t.Errorf("%d events pending after publishing, want none", len(events))
+	}
+}
+
+func TestPublishClaimed(t *testing.T) {
+	db := newDB(t)
+	broker := &fakeBroker{}
+	useBroker(t, broker)
+	if err := Publish(db, models.WebhookEventPointsEarned, nil); err != nil {
+		t.Fatal(err)
+	}
+	event := pending(t, db)[0]
+
+	// Another instance claims the event after this one loaded it
+	stale := event
+	if ok, err := publish(db, &event); !ok || err != nil {
+		t.Fatalf("publish = %v, %v", ok, err)
+	}
+	if ok, err := publish(db, &stale); ok || err != nil {
+		t.Errorf("publish of a claimed event = %v, %v, want false, nil", ok, err)
+	}
+	if got := broker.published(); len(got) != 1 {
+		t.Errorf("published %d times, want once", len(got))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 5, want: 16 * time.Second},
+		{attempts: 9, want: 256 * time.Second},
+		{attempts: 10, want: backoff.MaxDelay},
+		{attempts: 100, want: backoff.MaxDelay},
+	}
+	for _, tt := range tests {
+		if got := backoff.After(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKafkaPublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{
+			name:     "published",
+			status:   http.StatusOK,
+			response: `{"key_schema_id":null,"value_schema_id":null,"offsets":[{"partition":2,"offset":100,"error_code":null,"error":null}]}`,
+		},
+		{
+			name:     "basic auth",
+			username: "loyalty",
+			status:   http.StatusOK,
+			response: `{"offsets":[{"partition":0,"offset":7}]}`,
+		},
+		{
+			name:     "record refused",
+			status:   http.StatusOK,
+			response: `{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"Kafka error: record too large"}]}`,
+			wantErr:  "kafka: loyalty.points.earned: error 50002 Kafka error: record too large",
+		},
+		{
+			name:     "unknown topic",
+			status:   http.StatusNotFound,
+			response: `{"error_code":40401,"message":"Topic not found."}`,
+			wantErr:  "kafka: 404 Not Found: 40401 Topic not found.",
+		},
+		{
+			name:     "proxy down",
+			status:   http.StatusBadGateway,
+			response: `<html>Bad Gateway</html>`,
+			wantErr:  "kafka: 502 Bad Gateway: 0 ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			t.Cleanup(server.Close)
+
+			err := NewKafka(server.URL+"/", tt.username, "s3cret").Publish("loyalty.points.earned", "evt_1", []byte(`{"id":"evt_1","event":"points.earned"}`))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("publish: error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+
+			if got.Method != http.MethodPost || got.URL.Path != "/topics/loyalty.points.earned" {
+				t.Errorf("request %s %s, want POST /topics/loyalty.points.earned", got.Method, got.URL.Path)
+			}
+			if ct := got.Header.Get("Content-Type"); ct != "application/vnd.kafka.json.v2+json" {
+				t.Errorf("Content-Type %q", ct)
+			}
+			user, password, ok := got.BasicAuth()
+			if ok != (tt.username != "") || user != tt.username || (ok && password != "s3cret") {
+				t.Errorf("basic auth %q %q %v, want user %q", user, password, ok, tt.username)
+			}
+			var records kafkaRecords
+			if err := json.Unmarshal(body, &records); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			if len(records.Records) != 1 || records.Records[0].Key != "evt_1" || string(records.Records[0].Value) != `{"id":"evt_1","event":"points.earned"}` {
+				t.Errorf("records %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package eventstore keeps the domain events of each member in
+// domain_events and projects them onto the read model: users.points and
+// users.member_level are only written by Append, as the state the member's
+// events add up to, so replaying the events gives the same state at any
+// point of the member's history.
+//
+// points and tiers append the events in the transaction of the change,
+// with the user row locked, so a member's events are numbered without gaps
+// in the order they happened. StateAt replays a stream up to a time, e.g.
+// for the balance as of March 1, and Rebuild writes the projection again
+// from the stream.
+package eventstore
+
+import (
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Apply adds event to state.
+func Apply(state *models.MemberState, event models.DomainEvent) error {
+	switch event.Type {
+	case models.EventMemberJoined:
+		state.Points = event.Data.Points
+		state.MemberLevel = event.Data.ToTier
+	case models.EventPointsEarned, models.EventPointsRedeemed, models.EventPointsAdjusted, models.EventPointsExpired:
+		state.Points += event.Data.Amount
+	case models.EventTierChanged:
+		state.MemberLevel = event.Data.ToTier
+	default:
+		return fmt.Errorf("eventstore: unknown event type %s", event.Type)
+	}
+	state.Version = event.Version
+	state.At = event.OccurredAt
+	return nil
+}
+
+// Append adds an event of type with data to the stream of user and
+// projects it: the balance and tier of the user row, and of user, become
+// those after the event. It should run in the transaction of the change the
+// event records.
+func Append(tx *gorm.DB, user *models.User, eventType string, data models.DomainEventData) (*models.DomainEvent, error) {
+	var current models.User
+	err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Select("id", "points", "member_level").First(&current, user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	err = tx.Model(&models.DomainEvent{}).Where("user_id = ?", user.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.DomainEvent{
+		UserID:     user.ID,
+		Version:    version + 1,
+		Type:       eventType,
+		OccurredAt: time.Now(),
+		Data:       data,
+	}
+	state := models.MemberState{Points: current.Points, MemberLevel: current.MemberLevel, Version: version}
+	if err := Apply(&state, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, err
+	}
+	if err := project(tx, user.ID, state); err != nil {
+		return nil, err
+	}
+	user.Points, user.MemberLevel = state.Points, state.MemberLevel
+	return &event, nil
+}
+
+// StateAt replays the events of userID that occurred by at.
+func StateAt(db *gorm.DB, userID uint, at time.Time) (models.MemberState, error) {
+	state, err := replay(db.Where("occurred_at <= ?", at), userID)
+	state.At = at
+	return state, err
+}
+
+// Rebuild replays all the events of userID and writes the projection,
+// returning the state of the user row before and the state replayed. The
+// row is locked until tx ends.
+func Rebuild(tx *gorm.DB, userID uint) (before, after models.MemberState, err error) {
+	var user models.User
+	err = tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Select("id", "points", "member_level").First(&user, userID).Error
+	if err != nil {
+		return before, after, err
+	}
+	before = models.MemberState{Points: user.Points, MemberLevel: user.MemberLevel}
+
+	after, err = replay(tx, userID)
+	if err != nil {
+		return before, after, err
+	}
+	if after.Version == 0 {
+		return before, after, fmt.Errorf("eventstore: user %d has no events", userID)
+	}
+	before.Version, before.At = after.Version, after.At
+	if before != after {
+		err = project(tx, userID, after)
+	}
+	return before, after, err
+}
+
+// replayBatch is how many events replay reads at a time.
+const replayBatch = 500
+
+// replay applies the events of userID that query selects in order.
+func replay(query *gorm.DB, userID uint) (models.MemberState, error) {
+	var state models.MemberState
+	query = query.Session(&gorm.Session{})
+	for {
+		var events []models.DomainEvent
+		err := query.Where("user_id = ? AND version > ?", userID, state.Version).
+			Order("version").Limit(replayBatch).Find(&events).Error
+		if err != nil {
+			return state, err
+		}
+		for _, event := range events {
+			if event.Version != state.Version+1 {
+				return state, fmt.Errorf("eventstore: user %d is missing event %d", userID, state.Version+1)
+			}
+			if err := Apply(&state, event); err != nil {
+				return state, err
+			}
+		}
+		if len(events) < replayBatch {
+			return state, nil
+		}
+	}
+}
+
+// project writes state to the read model of userID.
+func project(tx *gorm.DB, userID uint, state models.MemberState) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"points": state.Points, "member_level": state.MemberLevel}).Error
+}
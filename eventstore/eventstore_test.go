@@ -0,0 +1,137 @@
+package eventstore_test
+
+import (
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+// setup creates a member who joined with 500 points on January 1, earned
+// 100 on February 1 and redeemed 250 on March 15.
+func setup(t *testing.T) (*gorm.DB, models.User) {
+	t.Helper()
+	db := testutil.NewDB(t)
+	user := testutil.CreateUser(t, db, testutil.WithPoints(500))
+	testutil.CreateTransaction(t, db, &user)
+	testutil.CreateTransaction(t, db, &user, testutil.Redeemed(250))
+
+	for version, at := range map[int]time.Time{
+		1: date(2026, time.January, 1),
+		2: date(2026, time.February, 1),
+		3: date(2026, time.March, 15),
+	} {
+		err := db.Model(&models.DomainEvent{}).Where("user_id = ? AND version = ?", user.ID, version).
+			Update("occurred_at", at).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, user
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+}
+
+func TestAppend(t *testing.T) {
+	db, user := setup(t)
+
+	var events []models.DomainEvent
+	db.Where("user_id = ?", user.ID).Order("version").Find(&events)
+	want := []struct {
+		kind   string
+		amount int
+	}{
+		{models.EventMemberJoined, 0},
+		{models.EventPointsEarned, 100},
+		{models.EventPointsRedeemed, -250},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Version != i+1 || events[i].Type != w.kind || events[i].Data.Amount != w.amount {
+			t.Errorf("event %d is %+v, want %s of %d", i, events[i], w.kind, w.amount)
+		}
+	}
+	if events[0].Data.Points != 500 || events[0].Data.ToTier != user.MemberLevel {
+		t.Errorf("joined with %+v, want 500 points at %s", events[0].Data, user.MemberLevel)
+	}
+	if events[2].Data.TransactionID == 0 {
+		t.Error("redemption event has no transaction")
+	}
+}
+
+func TestStateAt(t *testing.T) {
+	db, user := setup(t)
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		points  int
+		version int
+	}{
+		{name: "before joining", at: date(2025, time.December, 31)},
+		{name: "joined", at: date(2026, time.January, 20), points: 500, version: 1},
+		{name: "March 1", at: date(2026, time.March, 1), points: 600, version: 2},
+		{name: "at the event", at: date(2026, time.March, 15), points: 350, version: 3},
+		{name: "now", at: time.Now(), points: 350, version: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := eventstore.StateAt(db, user.ID, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Points != tt.points || state.Version != tt.version || !state.At.Equal(tt.at) {
+				t.Errorf("state %+v, want %d points at version %d", state, tt.points, tt.version)
+			}
+		})
+	}
+
+	// A stream with a gap cannot be replayed
+	db.Where("user_id = ? AND version = 2", user.ID).Delete(&models.DomainEvent{})
+	if _, err := eventstore.StateAt(db, user.ID, time.Now()); err == nil {
+		t.Error("replayed a stream missing an event")
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	db, user := setup(t)
+
+	rebuild := func() (before, after models.MemberState) {
+		t.Helper()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			before, after, err = eventstore.Rebuild(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return before, after
+	}
+
+	if before, after := rebuild(); before != after || after.Points != 350 {
+		t.Errorf("in step: before %+v, after %+v, want both at 350 points", before, after)
+	}
+
+	db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"points": 9999, "member_level": "Platinum"})
+	before, after := rebuild()
+	if before.Points != 9999 || before.MemberLevel != "Platinum" {
+		t.Errorf("before %+v, want the corrupted row", before)
+	}
+	if after.Points != 350 || after.MemberLevel != user.MemberLevel || after.Version != 3 {
+		t.Errorf("after %+v, want 350 points at %s", after, user.MemberLevel)
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.Points != 350 || stored.MemberLevel != user.MemberLevel {
+		t.Errorf("stored %d points at %s, want the rebuilt state", stored.Points, stored.MemberLevel)
+	}
+}
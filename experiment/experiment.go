@@ -0,0 +1,131 @@
+// Package experiment assigns users to A/B test variants. Assignment is a
+// hash of the experiment key and user ID, so a user always sees the same
+// variant without anything being stored; only exposures are recorded.
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Variant is one arm of an experiment. Weights are relative to the other
+// variants of the experiment.
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Experiment is a test run on backend-driven behaviour. The first variant
+// is the control, which everyone gets while the experiment is inactive.
+type Experiment struct {
+	Key         string
+	Description string
+	Variants    []Variant
+	Active      bool
+}
+
+// Experiments lists the experiments handlers can evaluate. Changing the
+// variants or weights of a running experiment reassigns users, so start a
+// new key instead.
+var Experiments = []Experiment{}
+
+// Find returns the experiment with key.
+func Find(key string) (Experiment, bool) {
+	for _, exp := range Experiments {
+		if exp.Key == key {
+			return exp, true
+		}
+	}
+	return Experiment{}, false
+}
+
+// Assign returns the variant of exp for the user without recording an
+// exposure.
+func Assign(exp Experiment, userID uint) string {
+	if len(exp.Variants) == 0 {
+		return ""
+	}
+	if !exp.Active {
+		return exp.Variants[0].Name
+	}
+
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return exp.Variants[0].Name
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", exp.Key, userID)))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range exp.Variants {
+		if bucket < v.Weight {
+			return v.Name
+		}
+		bucket -= v.Weight
+	}
+	return exp.Variants[0].Name
+}
+
+// Assignments returns the user's variant of every active experiment.
+func Assignments(userID uint) []models.ExperimentAssignment {
+	assignments := []models.ExperimentAssignment{}
+	for _, exp := range Experiments {
+		if exp.Active && len(exp.Variants) > 0 {
+			assignments = append(assignments, models.ExperimentAssignment{
+				Experiment: exp.Key,
+				Variant:    Assign(exp, userID),
+			})
+		}
+	}
+	return assignments
+}
+
+// exposed remembers exposures already written by this instance so hot paths
+// do not hit the database on every evaluation.
+var exposed sync.Map
+
+// VariantFor is the evaluation API for handlers: it returns the user's
+// variant of the experiment with key and records the user's first exposure
+// to it. Unknown and inactive experiments return the control variant, or ""
+// for unknown keys, and are not recorded.
+func VariantFor(db *gorm.DB, userID uint, key string) string {
+	exp, ok := Find(key)
+	if !ok {
+		return ""
+	}
+	variant := Assign(exp, userID)
+	if exp.Active && variant != "" {
+		expose(db, userID, exp.Key, variant)
+	}
+	return variant
+}
+
+// expose stores an exposure. Failures are logged rather than returned so an
+// analytics problem never breaks the request being served.
+func expose(db *gorm.DB, userID uint, key, variant string) {
+	cacheKey := fmt.Sprintf("%s:%d", key, userID)
+	if _, seen := exposed.Load(cacheKey); seen {
+		return
+	}
+
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ExperimentExposure{
+		UserID:     userID,
+		Experiment: key,
+		Variant:    variant,
+	}).Error
+	if err != nil {
+		log.Printf("[experiment] recording exposure of user %d to %s failed: %v", userID, key, err)
+		return
+	}
+	exposed.Store(cacheKey, true)
+}
@@ -0,0 +1,140 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/validation"
+
+	"google.golang.org/grpc/peer"
+)
+
+// authService is AuthService on the account service.
+type authService struct {
+	*server
+	loyaltyv1.UnimplementedAuthServiceServer
+}
+
+func (s authService) Register(ctx context.Context, in *loyaltyv1.RegisterRequest) (*loyaltyv1.AuthResponse, error) {
+	req := models.RegisterRequest{
+		Email:                in.GetEmail(),
+		Password:             in.GetPassword(),
+		FirstName:            in.GetFirstName(),
+		LastName:             in.GetLastName(),
+		Phone:                in.GetPhone(),
+		RomanizedName:        in.GetRomanizedName(),
+		AcceptedTermsVersion: in.GetAcceptedTermsVersion(),
+		ReferralCode:         in.GetReferralCode(),
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.accounts.Register(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account is usable even if the email fails; the user can ask for
+	// another link
+	if s.sendEmailVerification != nil {
+		if err := s.sendEmailVerification(ctx, user); err != nil {
+			log.Printf("[auth] verification email for user %d not sent: %v request_id=%s", user.ID, err, requestid.FromContext(ctx))
+		}
+	}
+
+	tokens, err := s.accounts.IssueTokens(ctx, user, client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return authResponse(&tokens, user), nil
+}
+
+func (s authService) Login(ctx context.Context, in *loyaltyv1.LoginRequest) (*loyaltyv1.AuthResponse, error) {
+	req := models.LoginRequest{Email: in.GetEmail(), Password: in.GetPassword()}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.accounts.Authenticate(ctx, req.Email, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	signIn, err := s.accounts.SignIn(ctx, user, client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if signIn.Challenge != nil {
+		return &loyaltyv1.AuthResponse{
+			ChallengeToken: signIn.Challenge.ChallengeToken,
+			ExpiresIn:      int64(signIn.Challenge.ExpiresIn),
+		}, nil
+	}
+	return authResponse(signIn.Tokens, user), nil
+}
+
+func (s authService) VerifyTwoFactor(ctx context.Context, in *loyaltyv1.VerifyTwoFactorRequest) (*loyaltyv1.AuthResponse, error) {
+	if s.verifyTwoFactor == nil {
+		return s.UnimplementedAuthServiceServer.VerifyTwoFactor(ctx, in)
+	}
+	req := models.TwoFactorVerifyRequest{ChallengeToken: in.GetChallengeToken(), Code: in.GetCode()}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifyTwoFactor(ctx, req.ChallengeToken, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.accounts.IssueTokens(ctx, user, client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return authResponse(&tokens, user), nil
+}
+
+func (s authService) Refresh(ctx context.Context, in *loyaltyv1.RefreshRequest) (*loyaltyv1.AuthResponse, error) {
+	tokens, err := s.accounts.Refresh(ctx, in.GetRefreshToken(), client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &loyaltyv1.AuthResponse{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn),
+	}, nil
+}
+
+func (s authService) Logout(ctx context.Context, in *loyaltyv1.LogoutRequest) (*loyaltyv1.LogoutResponse, error) {
+	if err := s.accounts.Logout(ctx, incoming(ctx, metadataAuthorization), in.GetRefreshToken()); err != nil {
+		return nil, err
+	}
+	return &loyaltyv1.LogoutResponse{}, nil
+}
+
+// client is the device the call comes from: the peer's address and the
+// user-agent metadata.
+func client(ctx context.Context) service.Client {
+	c := service.Client{UserAgent: incoming(ctx, "user-agent")}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		c.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(c.IP); err == nil {
+			c.IP = host
+		}
+	}
+	return c
+}
+
+// validate checks the validate tags of req, a pointer to a request model,
+// as the REST handlers check the body.
+func validate(req interface{}) error {
+	if fields := validation.Struct(req); len(fields) > 0 {
+		return models.NewValidationError("Validation failed", fields)
+	}
+	return nil
+}
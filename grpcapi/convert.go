@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"time"
+
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/models"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// timestamp converts t, leaving a nil or zero time unset.
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// member converts user as the REST API renders it.
+func member(user *models.User) *loyaltyv1.Member {
+	return &loyaltyv1.Member{
+		Id:                   uint64(user.ID),
+		Email:                user.Email,
+		EmailVerifiedAt:      timestamp(user.EmailVerifiedAt),
+		FirstName:            user.FirstName,
+		LastName:             user.LastName,
+		RomanizedName:        user.RomanizedName,
+		Phone:                user.Phone,
+		PhoneVerifiedAt:      timestamp(user.PhoneVerifiedAt),
+		MembershipId:         user.MembershipID,
+		ReferralCode:         user.ReferralCode,
+		MemberLevel:          user.MemberLevel,
+		Points:               int64(user.Points),
+		Role:                 user.Role,
+		AvatarUrl:            user.AvatarURL,
+		AcceptedTermsVersion: user.AcceptedTermsVersion,
+		CreatedAt:            timestamp(&user.CreatedAt),
+		UpdatedAt:            timestamp(&user.UpdatedAt),
+	}
+}
+
+// pointTransaction converts a ledger entry.
+func pointTransaction(entry *models.PointTransaction) *loyaltyv1.PointTransaction {
+	return &loyaltyv1.PointTransaction{
+		Id:           uint64(entry.ID),
+		CreatedAt:    timestamp(&entry.CreatedAt),
+		Type:         entry.Type,
+		Amount:       int64(entry.Amount),
+		BalanceAfter: int64(entry.BalanceAfter),
+		Reason:       entry.Reason,
+		Reference:    entry.Reference,
+		ExpiresAt:    timestamp(entry.ExpiresAt),
+	}
+}
+
+// authResponse converts signed-in tokens for user.
+func authResponse(tokens *models.TokenResponse, user *models.User) *loyaltyv1.AuthResponse {
+	return &loyaltyv1.AuthResponse{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn),
+		Member:       member(user),
+	}
+}
@@ -0,0 +1,94 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/requestid"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the domain of the ErrorInfo details of errors.
+const errorDomain = "loyalty.v1"
+
+// codeForStatus maps the HTTP status of an *models.AppError to the gRPC
+// code of the same failure; statuses not listed are Internal.
+var codeForStatus = map[int]codes.Code{
+	http.StatusBadRequest:           codes.InvalidArgument,
+	http.StatusUnauthorized:         codes.Unauthenticated,
+	http.StatusForbidden:            codes.PermissionDenied,
+	http.StatusNotFound:             codes.NotFound,
+	http.StatusConflict:             codes.AlreadyExists,
+	http.StatusGone:                 codes.NotFound,
+	http.StatusPreconditionFailed:   codes.FailedPrecondition,
+	http.StatusUnprocessableEntity:  codes.FailedPrecondition,
+	http.StatusPreconditionRequired: codes.FailedPrecondition,
+	http.StatusTooManyRequests:      codes.ResourceExhausted,
+	http.StatusNotImplemented:       codes.Unimplemented,
+	http.StatusServiceUnavailable:   codes.Unavailable,
+	http.StatusGatewayTimeout:       codes.DeadlineExceeded,
+}
+
+// translateErrors turns the errors of a call into gRPC status errors, as
+// handlers.ErrorHandler renders them for HTTP.
+func translateErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, toStatus(ctx, info.FullMethod, err)
+	}
+	return resp, nil
+}
+
+// toStatus returns err as a status error. The code follows the status of
+// the *models.AppError err is; an ErrorInfo detail carries its error code,
+// e.g. INVALID_CREDENTIALS, and a BadRequest detail the rejected fields of
+// validation errors.
+func toStatus(ctx context.Context, method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	appErr := middleware.AsAppError(err)
+	if appErr.Status >= http.StatusInternalServerError && appErr.Err != nil {
+		log.Printf("Unhandled error on %s: %v request_id=%s", method, appErr.Err, requestid.FromContext(ctx))
+	}
+
+	code, ok := codeForStatus[appErr.Status]
+	if !ok {
+		code = codes.Internal
+	}
+	st := status.New(code, appErr.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: appErr.Code, Domain: errorDomain}}
+	if fields, ok := appErr.Details.(map[string]string); ok && appErr.Code == models.CodeValidationFailed {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(names))
+		for i, name := range names {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: name, Description: fields[name]}
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,335 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/grpcapi"
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+	"temp-backend-at-kbtg/totp"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newConn serves the gRPC API on the services of env's handlers and
+// returns a client connection to it.
+func newConn(t *testing.T, env *testutil.Env) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpcapi.New(grpcapi.Deps{
+		DB:                    env.DB,
+		Config:                env.Config,
+		Accounts:              env.Handler.Accounts(),
+		Membership:            env.Handler.Membership(),
+		Points:                env.Handler.Points(),
+		SendEmailVerification: env.Handler.SendEmailVerification,
+		VerifyTwoFactor:       env.Handler.VerifyTwoFactorChallenge,
+	})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withMetadata returns a context sending the key and value pairs kv.
+func withMetadata(kv ...string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(kv...))
+}
+
+// checkError fails unless err has code and, in its ErrorInfo, reason.
+func checkError(t *testing.T, err error, code codes.Code, reason string) *status.Status {
+	t.Helper()
+
+	st, _ := status.FromError(err)
+	if st.Code() != code {
+		t.Fatalf("code %s (%v), want %s", st.Code(), err, code)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			if info.Reason != reason {
+				t.Errorf("reason %s, want %s", info.Reason, reason)
+			}
+			return st
+		}
+	}
+	t.Errorf("no ErrorInfo in %v", err)
+	return st
+}
+
+func TestAuthService(t *testing.T) {
+	env := testutil.NewEnv(t)
+	auth := loyaltyv1.NewAuthServiceClient(newConn(t, env))
+	profile := loyaltyv1.NewProfileServiceClient(newConn(t, env))
+	ctx := context.Background()
+
+	registered, err := auth.Register(ctx, &loyaltyv1.RegisterRequest{
+		Email:     "New.Member@Example.com",
+		Password:  "secret123",
+		FirstName: "Somchai",
+		LastName:  "Jaidee",
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if registered.Token == "" || registered.RefreshToken == "" || registered.Member.GetEmail() != "new.member@example.com" {
+		t.Errorf("register = %v", registered)
+	}
+	if messages := env.Mailer.Messages(); len(messages) != 1 || !strings.Contains(messages[0].Body, "/api/v1/auth/verify-email?token=") {
+		t.Errorf("verification emails %v", messages)
+	}
+
+	_, err = auth.Register(ctx, &loyaltyv1.RegisterRequest{Email: "not an email", Password: "x"})
+	st := checkError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if got := strings.Join(fields, ","); got != "email,first_name,last_name,password" {
+		t.Errorf("field violations %s", got)
+	}
+
+	_, err = auth.Login(ctx, &loyaltyv1.LoginRequest{Email: "new.member@example.com", Password: "wrong"})
+	checkError(t, err, codes.Unauthenticated, models.CodeInvalidCredentials)
+
+	login, err := auth.Login(ctx, &loyaltyv1.LoginRequest{Email: "new.member@example.com", Password: "secret123"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if login.ChallengeToken != "" || login.Member.GetId() != registered.Member.GetId() {
+		t.Errorf("login = %v", login)
+	}
+
+	refreshed, err := auth.Refresh(ctx, &loyaltyv1.RefreshRequest{RefreshToken: login.RefreshToken})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	_, err = auth.Refresh(ctx, &loyaltyv1.RefreshRequest{RefreshToken: login.RefreshToken})
+	checkError(t, err, codes.Unauthenticated, models.CodeRefreshTokenReused)
+
+	signedIn := withMetadata("authorization", "Bearer "+registered.Token)
+	if _, err := profile.GetProfile(signedIn, &loyaltyv1.GetProfileRequest{}); err != nil {
+		t.Fatalf("profile before logout: %v", err)
+	}
+	if _, err := auth.Logout(signedIn, &loyaltyv1.LogoutRequest{RefreshToken: refreshed.RefreshToken}); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	_, err = profile.GetProfile(signedIn, &loyaltyv1.GetProfileRequest{})
+	checkError(t, err, codes.Unauthenticated, models.CodeTokenRevoked)
+	_, err = auth.Refresh(ctx, &loyaltyv1.RefreshRequest{RefreshToken: refreshed.RefreshToken})
+	checkError(t, err, codes.Unauthenticated, models.CodeInvalidRefreshToken)
+}
+
+func TestProfileService(t *testing.T) {
+	env := testutil.NewEnv(t)
+	profile := loyaltyv1.NewProfileServiceClient(newConn(t, env))
+	user := testutil.CreateUser(t, env.DB, testutil.WithPoints(300))
+	ctx := withMetadata("authorization", testutil.AuthHeader(t, user))
+
+	_, err := profile.GetProfile(context.Background(), &loyaltyv1.GetProfileRequest{})
+	checkError(t, err, codes.Unauthenticated, models.CodeMissingCredentials)
+	_, err = profile.GetProfile(withMetadata("authorization", "Bearer nope"), &loyaltyv1.GetProfileRequest{})
+	checkError(t, err, codes.Unauthenticated, models.CodeInvalidToken)
+
+	got, err := profile.GetProfile(ctx, &loyaltyv1.GetProfileRequest{})
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	if got.MembershipId != user.MembershipID || got.Points != 300 || got.CreatedAt == nil || got.EmailVerifiedAt != nil {
+		t.Errorf("profile = %v", got)
+	}
+
+	updated, err := profile.UpdateProfile(ctx, &loyaltyv1.UpdateProfileRequest{FirstName: proto.String("  Somsri ")})
+	if err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	if updated.FirstName != "Somsri" || updated.LastName != user.LastName {
+		t.Errorf("updated profile = %v", updated)
+	}
+	_, err = profile.UpdateProfile(ctx, &loyaltyv1.UpdateProfileRequest{Phone: proto.String("02-123-4567")})
+	checkError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+
+	membership, err := profile.GetMembership(ctx, &loyaltyv1.GetMembershipRequest{})
+	if err != nil {
+		t.Fatalf("get membership: %v", err)
+	}
+	if membership.Member.GetId() != uint64(user.ID) || membership.Member.GetMemberLevel() != "Gold" {
+		t.Errorf("membership = %v", membership)
+	}
+}
+
+func TestPointsService(t *testing.T) {
+	env := testutil.NewEnv(t)
+	points := loyaltyv1.NewPointsServiceClient(newConn(t, env))
+	user := testutil.CreateUser(t, env.DB, testutil.WithPoints(500))
+	for i := 0; i < 3; i++ {
+		testutil.CreateTransaction(t, env.DB, &user)
+	}
+	ctx := withMetadata("authorization", testutil.AuthHeader(t, user))
+
+	page, err := points.ListHistory(ctx, &loyaltyv1.ListHistoryRequest{Page: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("list history: %v", err)
+	}
+	if page.Total != 3 || page.Pages != 2 || len(page.Items) != 1 || page.Items[0].Type != models.PointTransactionEarn {
+		t.Errorf("history page = %v", page)
+	}
+	_, err = points.ListHistory(ctx, &loyaltyv1.ListHistoryRequest{Limit: 1000})
+	checkError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+
+	_, key := testutil.CreatePartner(t, env.DB, "points:earn")
+	_, readOnly := testutil.CreatePartner(t, env.DB, "members:read")
+	earn := &loyaltyv1.EarnRequest{MembershipId: user.MembershipID, Amount: 120, Source: "Purchase #1"}
+
+	_, err = points.Earn(ctx, earn)
+	checkError(t, err, codes.Unauthenticated, models.CodeMissingCredentials)
+	_, err = points.Earn(withMetadata("x-api-key", readOnly, "idempotency-key", "order-1"), earn)
+	checkError(t, err, codes.PermissionDenied, models.CodeInsufficientScope)
+	_, err = points.Earn(withMetadata("x-api-key", key), earn)
+	checkError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+
+	partnerCtx := withMetadata("x-api-key", key, "idempotency-key", "order-1")
+	first, err := points.Earn(partnerCtx, earn)
+	if err != nil {
+		t.Fatalf("earn: %v", err)
+	}
+	if first.Replayed || first.Transaction.GetAmount() != 120 || first.Transaction.GetBalanceAfter() != int64(user.Points)+120 {
+		t.Errorf("earn = %v", first)
+	}
+	again, err := points.Earn(partnerCtx, earn)
+	if err != nil {
+		t.Fatalf("replayed earn: %v", err)
+	}
+	if !again.Replayed || again.Transaction.GetId() != first.Transaction.GetId() {
+		t.Errorf("replayed earn = %v", again)
+	}
+	_, err = points.Earn(withMetadata("x-api-key", key, "idempotency-key", "order-2"), &loyaltyv1.EarnRequest{MembershipId: "LBK99999", Amount: 1, Source: "x"})
+	checkError(t, err, codes.NotFound, models.CodeUserNotFound)
+
+	var usage models.APIUsage
+	env.DB.Where("route = ?", loyaltyv1.PointsService_Earn_FullMethodName).First(&usage)
+	if usage.Method != "GRPC" || usage.Requests != 4 || usage.ClientErrors != 2 {
+		t.Errorf("usage = %+v, want 4 requests with 2 client errors", usage)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	env := testutil.NewEnv(t)
+	auth := loyaltyv1.NewAuthServiceClient(newConn(t, env))
+	ctx := context.Background()
+
+	user := testutil.CreateUser(t, env.DB)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := totp.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := env.DB.Create(&models.TwoFactor{UserID: user.ID, SecretEncrypted: sealed, EnabledAt: &now}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := auth.Login(ctx, &loyaltyv1.LoginRequest{Email: user.Email, Password: testutil.DefaultPassword})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if login.ChallengeToken == "" || login.Token != "" {
+		t.Fatalf("login = %v, want a challenge", login)
+	}
+
+	_, err = auth.VerifyTwoFactor(ctx, &loyaltyv1.VerifyTwoFactorRequest{ChallengeToken: login.ChallengeToken})
+	checkError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+	_, err = auth.VerifyTwoFactor(ctx, &loyaltyv1.VerifyTwoFactorRequest{ChallengeToken: "nope", Code: "123456"})
+	checkError(t, err, codes.Unauthenticated, models.CodeSessionExpired)
+	_, err = auth.VerifyTwoFactor(ctx, &loyaltyv1.VerifyTwoFactorRequest{ChallengeToken: login.ChallengeToken, Code: "000000"})
+	checkError(t, err, codes.Unauthenticated, models.CodeInvalidCode)
+
+	code, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := auth.VerifyTwoFactor(ctx, &loyaltyv1.VerifyTwoFactorRequest{ChallengeToken: login.ChallengeToken, Code: code})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if verified.Token == "" || verified.RefreshToken == "" || verified.Member.GetId() != uint64(user.ID) {
+		t.Errorf("verify = %v", verified)
+	}
+
+	// A code works once
+	_, err = auth.VerifyTwoFactor(ctx, &loyaltyv1.VerifyTwoFactorRequest{ChallengeToken: login.ChallengeToken, Code: code})
+	checkError(t, err, codes.Unauthenticated, models.CodeInvalidCode)
+}
+
+func TestRateLimitsAndTerms(t *testing.T) {
+	env := testutil.NewEnv(t)
+	conn := newConn(t, env)
+	auth := loyaltyv1.NewAuthServiceClient(conn)
+	profile := loyaltyv1.NewProfileServiceClient(conn)
+	// The server reads the limits and terms version on every call
+	env.Config.RateLimit.Auth = config.Rate{Limit: 2, Window: time.Minute}
+	env.Config.RateLimit.User = config.Rate{Limit: 2, Window: time.Minute}
+
+	for i := 1; i <= 3; i++ {
+		_, err := auth.Login(context.Background(), &loyaltyv1.LoginRequest{Email: "nobody@example.com", Password: "wrong"})
+		if i <= 2 {
+			checkError(t, err, codes.Unauthenticated, models.CodeInvalidCredentials)
+		} else {
+			checkError(t, err, codes.ResourceExhausted, models.CodeRateLimited)
+		}
+	}
+
+	user := testutil.CreateUser(t, env.DB)
+	ctx := withMetadata("authorization", testutil.AuthHeader(t, user))
+	for i := 1; i <= 3; i++ {
+		_, err := profile.GetMembership(ctx, &loyaltyv1.GetMembershipRequest{})
+		if i <= 2 && err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if i > 2 {
+			checkError(t, err, codes.ResourceExhausted, models.CodeRateLimited)
+		}
+	}
+
+	env.Config.RateLimit.User = config.Rate{}
+	env.Config.TermsVersion = "2026-10"
+	stale := testutil.CreateUser(t, env.DB)
+	ctx = withMetadata("authorization", testutil.AuthHeader(t, stale))
+	_, err := profile.GetMembership(ctx, &loyaltyv1.GetMembershipRequest{})
+	checkError(t, err, codes.FailedPrecondition, models.CodeTermsNotAccepted)
+	if _, err := profile.GetProfile(ctx, &loyaltyv1.GetProfileRequest{}); err != nil {
+		t.Errorf("profile before accepting the terms: %v", err)
+	}
+
+	env.DB.Model(&stale).Update("accepted_terms_version", "2026-10")
+	if _, err := profile.GetMembership(ctx, &loyaltyv1.GetMembershipRequest{}); err != nil {
+		t.Errorf("membership after accepting the terms: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: loyalty/v1/member.proto
+
+package loyaltyv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Member is models.User as the REST API returns it; fields that are unset
+// there are unset here.
+type Member struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	Id                   uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email                string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	EmailVerifiedAt      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=email_verified_at,json=emailVerifiedAt,proto3" json:"email_verified_at,omitempty"`
+	FirstName            string                 `protobuf:"bytes,4,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName             string                 `protobuf:"bytes,5,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	RomanizedName        string                 `protobuf:"bytes,6,opt,name=romanized_name,json=romanizedName,proto3" json:"romanized_name,omitempty"`
+	Phone                string                 `protobuf:"bytes,7,opt,name=phone,proto3" json:"phone,omitempty"`
+	PhoneVerifiedAt      *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=phone_verified_at,json=phoneVerifiedAt,proto3" json:"phone_verified_at,omitempty"`
+	MembershipId         string                 `protobuf:"bytes,9,opt,name=membership_id,json=membershipId,proto3" json:"membership_id,omitempty"`
+	ReferralCode         string                 `protobuf:"bytes,10,opt,name=referral_code,json=referralCode,proto3" json:"referral_code,omitempty"`
+	MemberLevel          string                 `protobuf:"bytes,11,opt,name=member_level,json=memberLevel,proto3" json:"member_level,omitempty"`
+	Points               int64                  `protobuf:"varint,12,opt,name=points,proto3" json:"points,omitempty"`
+	Role                 string                 `protobuf:"bytes,13,opt,name=role,proto3" json:"role,omitempty"`
+	AvatarUrl            string                 `protobuf:"bytes,14,opt,name=avatar_url,json=avatarUrl,proto3" json:"avatar_url,omitempty"`
+	AcceptedTermsVersion string                 `protobuf:"bytes,15,opt,name=accepted_terms_version,json=acceptedTermsVersion,proto3" json:"accepted_terms_version,omitempty"`
+	CreatedAt            *timestamppb.Timestamp `protobuf:"bytes,16,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt            *timestamppb.Timestamp `protobuf:"bytes,17,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *Member) Reset() {
+	*x = Member{}
+	mi := &file_loyalty_v1_member_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Member) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Member) ProtoMessage() {}
+
+func (x *Member) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_member_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Member.ProtoReflect.Descriptor instead.
+func (*Member) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_member_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Member) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Member) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Member) GetEmailVerifiedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EmailVerifiedAt
+	}
+	return nil
+}
+
+func (x *Member) GetFirstName() string {
+	if x != nil {
+		return x.FirstName
+	}
+	return ""
+}
+
+func (x *Member) GetLastName() string {
+	if x != nil {
+		return x.LastName
+	}
+	return ""
+}
+
+func (x *Member) GetRomanizedName() string {
+	if x != nil {
+		return x.RomanizedName
+	}
+	return ""
+}
+
+func (x *Member) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *Member) GetPhoneVerifiedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PhoneVerifiedAt
+	}
+	return nil
+}
+
+func (x *Member) GetMembershipId() string {
+	if x != nil {
+		return x.MembershipId
+	}
+	return ""
+}
+
+func (x *Member) GetReferralCode() string {
+	if x != nil {
+		return x.ReferralCode
+	}
+	return ""
+}
+
+func (x *Member) GetMemberLevel() string {
+	if x != nil {
+		return x.MemberLevel
+	}
+	return ""
+}
+
+func (x *Member) GetPoints() int64 {
+	if x != nil {
+		return x.Points
+	}
+	return 0
+}
+
+func (x *Member) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *Member) GetAvatarUrl() string {
+	if x != nil {
+		return x.AvatarUrl
+	}
+	return ""
+}
+
+func (x *Member) GetAcceptedTermsVersion() string {
+	if x != nil {
+		return x.AcceptedTermsVersion
+	}
+	return ""
+}
+
+func (x *Member) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Member) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+var File_loyalty_v1_member_proto protoreflect.FileDescriptor
+
+const file_loyalty_v1_member_proto_rawDesc = "" +
+	"\n" +
+	"\x17loyalty/v1/member.proto\x12\n" +
+	"loyalty.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9b\x05\n" +
+	"\x06Member\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12F\n" +
+	"\x11email_verified_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x0femailVerifiedAt\x12\x1d\n" +
+	"\n" +
+	"first_name\x18\x04 \x01(\tR\tfirstName\x12\x1b\n" +
+	"\tlast_name\x18\x05 \x01(\tR\blastName\x12%\n" +
+	"\x0eromanized_name\x18\x06 \x01(\tR\rromanizedName\x12\x14\n" +
+	"\x05phone\x18\a \x01(\tR\x05phone\x12F\n" +
+	"\x11phone_verified_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\x0fphoneVerifiedAt\x12#\n" +
+	"\rmembership_id\x18\t \x01(\tR\fmembershipId\x12#\n" +
+	"\rreferral_code\x18\n" +
+	" \x01(\tR\freferralCode\x12!\n" +
+	"\fmember_level\x18\v \x01(\tR\vmemberLevel\x12\x16\n" +
+	"\x06points\x18\f \x01(\x03R\x06points\x12\x12\n" +
+	"\x04role\x18\r \x01(\tR\x04role\x12\x1d\n" +
+	"\n" +
+	"avatar_url\x18\x0e \x01(\tR\tavatarUrl\x124\n" +
+	"\x16accepted_terms_version\x18\x0f \x01(\tR\x14acceptedTermsVersion\x129\n" +
+	"\n" +
+	"created_at\x18\x10 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x11 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAtB2Z0temp-backend-at-kbtg/grpcapi/loyaltyv1;loyaltyv1b\x06proto3"
+
+var (
+	file_loyalty_v1_member_proto_rawDescOnce sync.Once
+	file_loyalty_v1_member_proto_rawDescData []byte
+)
+
+func file_loyalty_v1_member_proto_rawDescGZIP() []byte {
+	file_loyalty_v1_member_proto_rawDescOnce.Do(func() {
+		file_loyalty_v1_member_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_loyalty_v1_member_proto_rawDesc), len(file_loyalty_v1_member_proto_rawDesc)))
+	})
+	return file_loyalty_v1_member_proto_rawDescData
+}
+
+var file_loyalty_v1_member_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_loyalty_v1_member_proto_goTypes = []any{
+	(*Member)(nil),                // 0: loyalty.v1.Member
+	(*timestamppb.Timestamp)(nil), // 1: google.protobuf.Timestamp
+}
+var file_loyalty_v1_member_proto_depIdxs = []int32{
+	1, // 0: loyalty.v1.Member.email_verified_at:type_name -> google.protobuf.Timestamp
+	1, // 1: loyalty.v1.Member.phone_verified_at:type_name -> google.protobuf.Timestamp
+	1, // 2: loyalty.v1.Member.created_at:type_name -> google.protobuf.Timestamp
+	1, // 3: loyalty.v1.Member.updated_at:type_name -> google.protobuf.Timestamp
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_loyalty_v1_member_proto_init() }
+func file_loyalty_v1_member_proto_init() {
+	if File_loyalty_v1_member_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_loyalty_v1_member_proto_rawDesc), len(file_loyalty_v1_member_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_loyalty_v1_member_proto_goTypes,
+		DependencyIndexes: file_loyalty_v1_member_proto_depIdxs,
+		MessageInfos:      file_loyalty_v1_member_proto_msgTypes,
+	}.Build()
+	File_loyalty_v1_member_proto = out.File
+	file_loyalty_v1_member_proto_goTypes = nil
+	file_loyalty_v1_member_proto_depIdxs = nil
+}
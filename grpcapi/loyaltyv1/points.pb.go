@@ -0,0 +1,471 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: loyalty/v1/points.proto
+
+package loyaltyv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PointTransaction struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Amount        int64                  `protobuf:"varint,4,opt,name=amount,proto3" json:"amount,omitempty"`
+	BalanceAfter  int64                  `protobuf:"varint,5,opt,name=balance_after,json=balanceAfter,proto3" json:"balance_after,omitempty"`
+	Reason        string                 `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	Reference     string                 `protobuf:"bytes,7,opt,name=reference,proto3" json:"reference,omitempty"`
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PointTransaction) Reset() {
+	*x = PointTransaction{}
+	mi := &file_loyalty_v1_points_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PointTransaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PointTransaction) ProtoMessage() {}
+
+func (x *PointTransaction) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_points_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PointTransaction.ProtoReflect.Descriptor instead.
+func (*PointTransaction) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_points_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PointTransaction) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PointTransaction) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *PointTransaction) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PointTransaction) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *PointTransaction) GetBalanceAfter() int64 {
+	if x != nil {
+		return x.BalanceAfter
+	}
+	return 0
+}
+
+func (x *PointTransaction) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *PointTransaction) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+func (x *PointTransaction) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+type ListHistoryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Page          int32                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHistoryRequest) Reset() {
+	*x = ListHistoryRequest{}
+	mi := &file_loyalty_v1_points_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHistoryRequest) ProtoMessage() {}
+
+func (x *ListHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_points_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHistoryRequest.ProtoReflect.Descriptor instead.
+func (*ListHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_points_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListHistoryRequest) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListHistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListHistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*PointTransaction    `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Page          int32                  `protobuf:"varint,3,opt,name=page,proto3" json:"page,omitempty"`
+	Pages         int32                  `protobuf:"varint,4,opt,name=pages,proto3" json:"pages,omitempty"`
+	Limit         int32                  `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHistoryResponse) Reset() {
+	*x = ListHistoryResponse{}
+	mi := &file_loyalty_v1_points_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHistoryResponse) ProtoMessage() {}
+
+func (x *ListHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_points_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHistoryResponse.ProtoReflect.Descriptor instead.
+func (*ListHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_points_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListHistoryResponse) GetItems() []*PointTransaction {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *ListHistoryResponse) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *ListHistoryResponse) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListHistoryResponse) GetPages() int32 {
+	if x != nil {
+		return x.Pages
+	}
+	return 0
+}
+
+func (x *ListHistoryResponse) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type EarnRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MembershipId  string                 `protobuf:"bytes,1,opt,name=membership_id,json=membershipId,proto3" json:"membership_id,omitempty"`
+	Amount        int64                  `protobuf:"varint,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	Source        string                 `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EarnRequest) Reset() {
+	*x = EarnRequest{}
+	mi := &file_loyalty_v1_points_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EarnRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EarnRequest) ProtoMessage() {}
+
+func (x *EarnRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_points_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EarnRequest.ProtoReflect.Descriptor instead.
+func (*EarnRequest) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_points_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EarnRequest) GetMembershipId() string {
+	if x != nil {
+		return x.MembershipId
+	}
+	return ""
+}
+
+func (x *EarnRequest) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *EarnRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type EarnResponse struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	MembershipId string                 `protobuf:"bytes,1,opt,name=membership_id,json=membershipId,proto3" json:"membership_id,omitempty"`
+	Transaction  *PointTransaction      `protobuf:"bytes,2,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	// replayed is true when the idempotency key was used before
+	Replayed      bool `protobuf:"varint,3,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EarnResponse) Reset() {
+	*x = EarnResponse{}
+	mi := &file_loyalty_v1_points_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EarnResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EarnResponse) ProtoMessage() {}
+
+func (x *EarnResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_points_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EarnResponse.ProtoReflect.Descriptor instead.
+func (*EarnResponse) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_points_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EarnResponse) GetMembershipId() string {
+	if x != nil {
+		return x.MembershipId
+	}
+	return ""
+}
+
+func (x *EarnResponse) GetTransaction() *PointTransaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+func (x *EarnResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+var File_loyalty_v1_points_proto protoreflect.FileDescriptor
+
+const file_loyalty_v1_points_proto_rawDesc = "" +
+	"\n" +
+	"\x17loyalty/v1/points.proto\x12\n" +
+	"loyalty.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9f\x02\n" +
+	"\x10PointTransaction\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\x03R\x06amount\x12#\n" +
+	"\rbalance_after\x18\x05 \x01(\x03R\fbalanceAfter\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\x12\x1c\n" +
+	"\treference\x18\a \x01(\tR\treference\x129\n" +
+	"\n" +
+	"expires_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\">\n" +
+	"\x12ListHistoryRequest\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x05R\x04page\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"\x9f\x01\n" +
+	"\x13ListHistoryResponse\x122\n" +
+	"\x05items\x18\x01 \x03(\v2\x1c.loyalty.v1.PointTransactionR\x05items\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x03R\x05total\x12\x12\n" +
+	"\x04page\x18\x03 \x01(\x05R\x04page\x12\x14\n" +
+	"\x05pages\x18\x04 \x01(\x05R\x05pages\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\x05R\x05limit\"b\n" +
+	"\vEarnRequest\x12#\n" +
+	"\rmembership_id\x18\x01 \x01(\tR\fmembershipId\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x03R\x06amount\x12\x16\n" +
+	"\x06source\x18\x03 \x01(\tR\x06source\"\x8f\x01\n" +
+	"\fEarnResponse\x12#\n" +
+	"\rmembership_id\x18\x01 \x01(\tR\fmembershipId\x12>\n" +
+	"\vtransaction\x18\x02 \x01(\v2\x1c.loyalty.v1.PointTransactionR\vtransaction\x12\x1a\n" +
+	"\breplayed\x18\x03 \x01(\bR\breplayed2\x9a\x01\n" +
+	"\rPointsService\x12N\n" +
+	"\vListHistory\x12\x1e.loyalty.v1.ListHistoryRequest\x1a\x1f.loyalty.v1.ListHistoryResponse\x129\n" +
+	"\x04Earn\x12\x17.loyalty.v1.EarnRequest\x1a\x18.loyalty.v1.EarnResponseB2Z0temp-backend-at-kbtg/grpcapi/loyaltyv1;loyaltyv1b\x06proto3"
+
+var (
+	file_loyalty_v1_points_proto_rawDescOnce sync.Once
+	file_loyalty_v1_points_proto_rawDescData []byte
+)
+
+func file_loyalty_v1_points_proto_rawDescGZIP() []byte {
+	file_loyalty_v1_points_proto_rawDescOnce.Do(func() {
+		file_loyalty_v1_points_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_loyalty_v1_points_proto_rawDesc), len(file_loyalty_v1_points_proto_rawDesc)))
+	})
+	return file_loyalty_v1_points_proto_rawDescData
+}
+
+var file_loyalty_v1_points_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_loyalty_v1_points_proto_goTypes = []any{
+	(*PointTransaction)(nil),      // 0: loyalty.v1.PointTransaction
+	(*ListHistoryRequest)(nil),    // 1: loyalty.v1.ListHistoryRequest
+	(*ListHistoryResponse)(nil),   // 2: loyalty.v1.ListHistoryResponse
+	(*EarnRequest)(nil),           // 3: loyalty.v1.EarnRequest
+	(*EarnResponse)(nil),          // 4: loyalty.v1.EarnResponse
+	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+}
+var file_loyalty_v1_points_proto_depIdxs = []int32{
+	5, // 0: loyalty.v1.PointTransaction.created_at:type_name -> google.protobuf.Timestamp
+	5, // 1: loyalty.v1.PointTransaction.expires_at:type_name -> google.protobuf.Timestamp
+	0, // 2: loyalty.v1.ListHistoryResponse.items:type_name -> loyalty.v1.PointTransaction
+	0, // 3: loyalty.v1.EarnResponse.transaction:type_name -> loyalty.v1.PointTransaction
+	1, // 4: loyalty.v1.PointsService.ListHistory:input_type -> loyalty.v1.ListHistoryRequest
+	3, // 5: loyalty.v1.PointsService.Earn:input_type -> loyalty.v1.EarnRequest
+	2, // 6: loyalty.v1.PointsService.ListHistory:output_type -> loyalty.v1.ListHistoryResponse
+	4, // 7: loyalty.v1.PointsService.Earn:output_type -> loyalty.v1.EarnResponse
+	6, // [6:8] is the sub-list for method output_type
+	4, // [4:6] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_loyalty_v1_points_proto_init() }
+func file_loyalty_v1_points_proto_init() {
+	if File_loyalty_v1_points_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_loyalty_v1_points_proto_rawDesc), len(file_loyalty_v1_points_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_loyalty_v1_points_proto_goTypes,
+		DependencyIndexes: file_loyalty_v1_points_proto_depIdxs,
+		MessageInfos:      file_loyalty_v1_points_proto_msgTypes,
+	}.Build()
+	File_loyalty_v1_points_proto = out.File
+	file_loyalty_v1_points_proto_goTypes = nil
+	file_loyalty_v1_points_proto_depIdxs = nil
+}
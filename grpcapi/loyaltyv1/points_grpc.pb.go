@@ -0,0 +1,173 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: loyalty/v1/points.proto
+
+package loyaltyv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PointsService_ListHistory_FullMethodName = "/loyalty.v1.PointsService/ListHistory"
+	PointsService_Earn_FullMethodName        = "/loyalty.v1.PointsService/Earn"
+)
+
+// PointsServiceClient is the client API for PointsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PointsService reads the signed-in member's points ledger and, for
+// partners, credits points.
+type PointsServiceClient interface {
+	// ListHistory is GET /api/v1/profile/points/history.
+	ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error)
+	// Earn is POST /api/v1/points/earn. It takes a partner key in the
+	// x-api-key metadata instead of an access token, and an idempotency-key;
+	// a retry with the same key returns the original transaction.
+	Earn(ctx context.Context, in *EarnRequest, opts ...grpc.CallOption) (*EarnResponse, error)
+}
+
+type pointsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPointsServiceClient(cc grpc.ClientConnInterface) PointsServiceClient {
+	return &pointsServiceClient{cc}
+}
+
+func (c *pointsServiceClient) ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListHistoryResponse)
+	err := c.cc.Invoke(ctx, PointsService_ListHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pointsServiceClient) Earn(ctx context.Context, in *EarnRequest, opts ...grpc.CallOption) (*EarnResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EarnResponse)
+	err := c.cc.Invoke(ctx, PointsService_Earn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PointsServiceServer is the server API for PointsService service.
+// All implementations must embed UnimplementedPointsServiceServer
+// for forward compatibility.
+//
+// PointsService reads the signed-in member's points ledger and, for
+// partners, credits points.
+type PointsServiceServer interface {
+	// ListHistory is GET /api/v1/profile/points/history.
+	ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error)
+	// Earn is POST /api/v1/points/earn. It takes a partner key in the
+	// x-api-key metadata instead of an access token, and an idempotency-key;
+	// a retry with the same key returns the original transaction.
+	Earn(context.Context, *EarnRequest) (*EarnResponse, error)
+	mustEmbedUnimplementedPointsServiceServer()
+}
+
+// UnimplementedPointsServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPointsServiceServer struct{}
+
+func (UnimplementedPointsServiceServer) ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHistory not implemented")
+}
+func (UnimplementedPointsServiceServer) Earn(context.Context, *EarnRequest) (*EarnResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Earn not implemented")
+}
+func (UnimplementedPointsServiceServer) mustEmbedUnimplementedPointsServiceServer() {}
+func (UnimplementedPointsServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafePointsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PointsServiceServer will
+// result in compilation errors.
+type UnsafePointsServiceServer interface {
+	mustEmbedUnimplementedPointsServiceServer()
+}
+
+func RegisterPointsServiceServer(s grpc.ServiceRegistrar, srv PointsServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPointsServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PointsService_ServiceDesc, srv)
+}
+
+func _PointsService_ListHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).ListHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PointsService_ListHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).ListHistory(ctx, req.(*ListHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PointsService_Earn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EarnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).Earn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PointsService_Earn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).Earn(ctx, req.(*EarnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PointsService_ServiceDesc is the grpc.ServiceDesc for PointsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PointsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "loyalty.v1.PointsService",
+	HandlerType: (*PointsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListHistory",
+			Handler:    _PointsService_ListHistory_Handler,
+		},
+		{
+			MethodName: "Earn",
+			Handler:    _PointsService_Earn_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "loyalty/v1/points.proto",
+}
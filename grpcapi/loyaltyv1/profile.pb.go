@@ -0,0 +1,376 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: loyalty/v1/profile.proto
+
+package loyaltyv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetProfileRequest) Reset() {
+	*x = GetProfileRequest{}
+	mi := &file_loyalty_v1_profile_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetProfileRequest) ProtoMessage() {}
+
+func (x *GetProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_profile_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetProfileRequest.ProtoReflect.Descriptor instead.
+func (*GetProfileRequest) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_profile_proto_rawDescGZIP(), []int{0}
+}
+
+type UpdateProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FirstName     *string                `protobuf:"bytes,1,opt,name=first_name,json=firstName,proto3,oneof" json:"first_name,omitempty"`
+	LastName      *string                `protobuf:"bytes,2,opt,name=last_name,json=lastName,proto3,oneof" json:"last_name,omitempty"`
+	Phone         *string                `protobuf:"bytes,3,opt,name=phone,proto3,oneof" json:"phone,omitempty"`
+	RomanizedName *string                `protobuf:"bytes,4,opt,name=romanized_name,json=romanizedName,proto3,oneof" json:"romanized_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateProfileRequest) Reset() {
+	*x = UpdateProfileRequest{}
+	mi := &file_loyalty_v1_profile_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateProfileRequest) ProtoMessage() {}
+
+func (x *UpdateProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_profile_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateProfileRequest.ProtoReflect.Descriptor instead.
+func (*UpdateProfileRequest) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_profile_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateProfileRequest) GetFirstName() string {
+	if x != nil && x.FirstName != nil {
+		return *x.FirstName
+	}
+	return ""
+}
+
+func (x *UpdateProfileRequest) GetLastName() string {
+	if x != nil && x.LastName != nil {
+		return *x.LastName
+	}
+	return ""
+}
+
+func (x *UpdateProfileRequest) GetPhone() string {
+	if x != nil && x.Phone != nil {
+		return *x.Phone
+	}
+	return ""
+}
+
+func (x *UpdateProfileRequest) GetRomanizedName() string {
+	if x != nil && x.RomanizedName != nil {
+		return *x.RomanizedName
+	}
+	return ""
+}
+
+type GetMembershipRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMembershipRequest) Reset() {
+	*x = GetMembershipRequest{}
+	mi := &file_loyalty_v1_profile_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMembershipRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMembershipRequest) ProtoMessage() {}
+
+func (x *GetMembershipRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_profile_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMembershipRequest.ProtoReflect.Descriptor instead.
+func (*GetMembershipRequest) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_profile_proto_rawDescGZIP(), []int{2}
+}
+
+// Membership is service.MembershipInfo: the member with their tier standing.
+type Membership struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Member *Member                `protobuf:"bytes,1,opt,name=member,proto3" json:"member,omitempty"`
+	// qualifying is the points earned in the tier qualifying period
+	Qualifying int64 `protobuf:"varint,2,opt,name=qualifying,proto3" json:"qualifying,omitempty"`
+	// next is the tier above the member's, unset at the top tier
+	Next          *NextTier `protobuf:"bytes,3,opt,name=next,proto3" json:"next,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Membership) Reset() {
+	*x = Membership{}
+	mi := &file_loyalty_v1_profile_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Membership) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Membership) ProtoMessage() {}
+
+func (x *Membership) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_profile_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Membership.ProtoReflect.Descriptor instead.
+func (*Membership) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_profile_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Membership) GetMember() *Member {
+	if x != nil {
+		return x.Member
+	}
+	return nil
+}
+
+func (x *Membership) GetQualifying() int64 {
+	if x != nil {
+		return x.Qualifying
+	}
+	return 0
+}
+
+func (x *Membership) GetNext() *NextTier {
+	if x != nil {
+		return x.Next
+	}
+	return nil
+}
+
+type NextTier struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	MinPoints     int64                  `protobuf:"varint,2,opt,name=min_points,json=minPoints,proto3" json:"min_points,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NextTier) Reset() {
+	*x = NextTier{}
+	mi := &file_loyalty_v1_profile_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NextTier) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NextTier) ProtoMessage() {}
+
+func (x *NextTier) ProtoReflect() protoreflect.Message {
+	mi := &file_loyalty_v1_profile_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NextTier.ProtoReflect.Descriptor instead.
+func (*NextTier) Descriptor() ([]byte, []int) {
+	return file_loyalty_v1_profile_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *NextTier) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *NextTier) GetMinPoints() int64 {
+	if x != nil {
+		return x.MinPoints
+	}
+	return 0
+}
+
+var File_loyalty_v1_profile_proto protoreflect.FileDescriptor
+
+const file_loyalty_v1_profile_proto_rawDesc = "" +
+	"\n" +
+	"\x18loyalty/v1/profile.proto\x12\n" +
+	"loyalty.v1\x1a\x17loyalty/v1/member.proto\"\x13\n" +
+	"\x11GetProfileRequest\"\xdd\x01\n" +
+	"\x14UpdateProfileRequest\x12\"\n" +
+	"\n" +
+	"first_name\x18\x01 \x01(\tH\x00R\tfirstName\x88\x01\x01\x12 \n" +
+	"\tlast_name\x18\x02 \x01(\tH\x01R\blastName\x88\x01\x01\x12\x19\n" +
+	"\x05phone\x18\x03 \x01(\tH\x02R\x05phone\x88\x01\x01\x12*\n" +
+	"\x0eromanized_name\x18\x04 \x01(\tH\x03R\rromanizedName\x88\x01\x01B\r\n" +
+	"\v_first_nameB\f\n" +
+	"\n" +
+	"_last_nameB\b\n" +
+	"\x06_phoneB\x11\n" +
+	"\x0f_romanized_name\"\x16\n" +
+	"\x14GetMembershipRequest\"\x82\x01\n" +
+	"\n" +
+	"Membership\x12*\n" +
+	"\x06member\x18\x01 \x01(\v2\x12.loyalty.v1.MemberR\x06member\x12\x1e\n" +
+	"\n" +
+	"qualifying\x18\x02 \x01(\x03R\n" +
+	"qualifying\x12(\n" +
+	"\x04next\x18\x03 \x01(\v2\x14.loyalty.v1.NextTierR\x04next\"=\n" +
+	"\bNextTier\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x1d\n" +
+	"\n" +
+	"min_points\x18\x02 \x01(\x03R\tminPoints2\xe3\x01\n" +
+	"\x0eProfileService\x12?\n" +
+	"\n" +
+	"GetProfile\x12\x1d.loyalty.v1.GetProfileRequest\x1a\x12.loyalty.v1.Member\x12E\n" +
+	"\rUpdateProfile\x12 .loyalty.v1.UpdateProfileRequest\x1a\x12.loyalty.v1.Member\x12I\n" +
+	"\rGetMembership\x12 .loyalty.v1.GetMembershipRequest\x1a\x16.loyalty.v1.MembershipB2Z0temp-backend-at-kbtg/grpcapi/loyaltyv1;loyaltyv1b\x06proto3"
+
+var (
+	file_loyalty_v1_profile_proto_rawDescOnce sync.Once
+	file_loyalty_v1_profile_proto_rawDescData []byte
+)
+
+func file_loyalty_v1_profile_proto_rawDescGZIP() []byte {
+	file_loyalty_v1_profile_proto_rawDescOnce.Do(func() {
+		file_loyalty_v1_profile_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_loyalty_v1_profile_proto_rawDesc), len(file_loyalty_v1_profile_proto_rawDesc)))
+	})
+	return file_loyalty_v1_profile_proto_rawDescData
+}
+
+var file_loyalty_v1_profile_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_loyalty_v1_profile_proto_goTypes = []any{
+	(*GetProfileRequest)(nil),    // 0: loyalty.v1.GetProfileRequest
+	(*UpdateProfileRequest)(nil), // 1: loyalty.v1.UpdateProfileRequest
+	(*GetMembershipRequest)(nil), // 2: loyalty.v1.GetMembershipRequest
+	(*Membership)(nil),           // 3: loyalty.v1.Membership
+	(*NextTier)(nil),             // 4: loyalty.v1.NextTier
+	(*Member)(nil),               // 5: loyalty.v1.Member
+}
+var file_loyalty_v1_profile_proto_depIdxs = []int32{
+	5, // 0: loyalty.v1.Membership.member:type_name -> loyalty.v1.Member
+	4, // 1: loyalty.v1.Membership.next:type_name -> loyalty.v1.NextTier
+	0, // 2: loyalty.v1.ProfileService.GetProfile:input_type -> loyalty.v1.GetProfileRequest
+	1, // 3: loyalty.v1.ProfileService.UpdateProfile:input_type -> loyalty.v1.UpdateProfileRequest
+	2, // 4: loyalty.v1.ProfileService.GetMembership:input_type -> loyalty.v1.GetMembershipRequest
+	5, // 5: loyalty.v1.ProfileService.GetProfile:output_type -> loyalty.v1.Member
+	5, // 6: loyalty.v1.ProfileService.UpdateProfile:output_type -> loyalty.v1.Member
+	3, // 7: loyalty.v1.ProfileService.GetMembership:output_type -> loyalty.v1.Membership
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_loyalty_v1_profile_proto_init() }
+func file_loyalty_v1_profile_proto_init() {
+	if File_loyalty_v1_profile_proto != nil {
+		return
+	}
+	file_loyalty_v1_member_proto_init()
+	file_loyalty_v1_profile_proto_msgTypes[1].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_loyalty_v1_profile_proto_rawDesc), len(file_loyalty_v1_profile_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_loyalty_v1_profile_proto_goTypes,
+		DependencyIndexes: file_loyalty_v1_profile_proto_depIdxs,
+		MessageInfos:      file_loyalty_v1_profile_proto_msgTypes,
+	}.Build()
+	File_loyalty_v1_profile_proto = out.File
+	file_loyalty_v1_profile_proto_goTypes = nil
+	file_loyalty_v1_profile_proto_depIdxs = nil
+}
@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/service"
+)
+
+// pointsService is PointsService on the points service.
+type pointsService struct {
+	*server
+	loyaltyv1.UnimplementedPointsServiceServer
+}
+
+func (s pointsService) ListHistory(ctx context.Context, in *loyaltyv1.ListHistoryRequest) (*loyaltyv1.ListHistoryResponse, error) {
+	query := map[string]string{}
+	if in.GetPage() != 0 {
+		query["page"] = strconv.Itoa(int(in.GetPage()))
+	}
+	if in.GetLimit() != 0 {
+		query["limit"] = strconv.Itoa(int(in.GetLimit()))
+	}
+	params, err := pagination.ParseQuery(query, service.HistoryPages)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.points.History(ctx, userID(ctx), params)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := page.Items.([]models.PointTransaction)
+	response := &loyaltyv1.ListHistoryResponse{
+		Items: make([]*loyaltyv1.PointTransaction, len(entries)),
+		Total: page.Total,
+		Page:  int32(page.Page),
+		Pages: int32(page.Pages),
+		Limit: int32(page.Limit),
+	}
+	for i := range entries {
+		response.Items[i] = pointTransaction(&entries[i])
+	}
+	return response, nil
+}
+
+func (s pointsService) Earn(ctx context.Context, in *loyaltyv1.EarnRequest) (*loyaltyv1.EarnResponse, error) {
+	key := strings.TrimSpace(incoming(ctx, metadataIdempotency))
+	switch {
+	case key == "":
+		return nil, models.NewValidationError("Missing idempotency-key", map[string]string{metadataIdempotency: "is required"})
+	case len(key) > 255:
+		return nil, models.NewValidationError("Invalid idempotency-key", map[string]string{metadataIdempotency: "must be at most 255 characters long"})
+	}
+
+	req := models.EarnPointsRequest{
+		MembershipID: in.GetMembershipId(),
+		Amount:       int(in.GetAmount()),
+		Source:       in.GetSource(),
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	result, err := s.points.Earn(ctx, partnerOf(ctx), key, req)
+	if err != nil {
+		return nil, err
+	}
+	return &loyaltyv1.EarnResponse{
+		MembershipId: result.User.MembershipID,
+		Transaction:  pointTransaction(result.Transaction),
+		Replayed:     result.Replayed,
+	}, nil
+}
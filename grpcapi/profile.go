@@ -0,0 +1,57 @@
+package grpcapi
+
+import (
+	"context"
+
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/models"
+)
+
+// profileService is ProfileService on the membership service.
+type profileService struct {
+	*server
+	loyaltyv1.UnimplementedProfileServiceServer
+}
+
+func (s profileService) GetProfile(ctx context.Context, _ *loyaltyv1.GetProfileRequest) (*loyaltyv1.Member, error) {
+	user, err := s.membership.Profile(ctx, userID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return member(user), nil
+}
+
+func (s profileService) UpdateProfile(ctx context.Context, in *loyaltyv1.UpdateProfileRequest) (*loyaltyv1.Member, error) {
+	// Unset fields are empty, which UpdateProfile leaves unchanged
+	req := models.UpdateProfileRequest{
+		FirstName:     in.GetFirstName(),
+		LastName:      in.GetLastName(),
+		Phone:         in.GetPhone(),
+		RomanizedName: in.GetRomanizedName(),
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.membership.UpdateProfile(ctx, userID(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+	return member(user), nil
+}
+
+func (s profileService) GetMembership(ctx context.Context, _ *loyaltyv1.GetMembershipRequest) (*loyaltyv1.Membership, error) {
+	info, err := s.membership.Info(ctx, userID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	membership := &loyaltyv1.Membership{
+		Member:     member(&info.User),
+		Qualifying: int64(info.Qualifying),
+	}
+	if info.Next != nil {
+		membership.Next = &loyaltyv1.NextTier{Code: info.Next.Code, MinPoints: int64(info.Next.MinPoints)}
+	}
+	return membership, nil
+}
@@ -0,0 +1,252 @@
+// Package grpcapi serves the gRPC API of proto/loyalty/v1 for other
+// internal services, on its own port next to the HTTP server. It calls the
+// same service layer as the REST handlers, so both transports apply the
+// same rules, and answers their *models.AppError failures with gRPC status
+// codes.
+//
+// The stubs in loyaltyv1 are generated from the .proto files; regenerate
+// them after changing the contract with
+//
+//	protoc -I proto --go_out=. --go_opt=module=temp-backend-at-kbtg \
+//		--go-grpc_out=. --go-grpc_opt=module=temp-backend-at-kbtg \
+//		proto/loyalty/v1/*.proto
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/grpcapi/loyaltyv1"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/repository"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/tenant"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// Deps are what the server is built from. DB and Config are required;
+// services left nil are built on the GORM repositories of DB and
+// cache.Default, as handlers.New builds them.
+type Deps struct {
+	DB         *gorm.DB
+	Config     *config.Config
+	Accounts   *service.Accounts
+	Membership *service.Membership
+	Points     *service.Points
+	// SendEmailVerification emails new accounts the link to verify their
+	// address; without it Register sends none
+	SendEmailVerification func(ctx context.Context, user *models.User) error
+	// VerifyTwoFactor returns the user who passes the second factor of a
+	// login with the challenge token and code; without it VerifyTwoFactor
+	// is unimplemented and accounts with two-factor authentication cannot
+	// log in over gRPC
+	VerifyTwoFactor func(ctx context.Context, challengeToken, code string) (*models.User, error)
+	// Tenants are the tenants the x-tenant-id metadata may name, as
+	// X-Tenant-ID does; without them calls are served for sharding.tenant
+	Tenants []string
+}
+
+// server implements the services of loyaltyv1.
+type server struct {
+	db                    *gorm.DB
+	cfg                   *config.Config
+	accounts              *service.Accounts
+	membership            *service.Membership
+	points                *service.Points
+	sendEmailVerification func(ctx context.Context, user *models.User) error
+	verifyTwoFactor       func(ctx context.Context, challengeToken, code string) (*models.User, error)
+	tenants               []string
+}
+
+// New returns a gRPC server with the auth, profile and points services on
+// deps. Calls other than those of AuthService need an access token in the
+// authorization metadata, except PointsService.Earn, which needs a partner
+// key in x-api-key. The calls count against the same rate limits as the
+// REST routes they match.
+func New(deps Deps) *grpc.Server {
+	s := &server{
+		db:                    deps.DB,
+		cfg:                   deps.Config,
+		accounts:              deps.Accounts,
+		membership:            deps.Membership,
+		points:                deps.Points,
+		sendEmailVerification: deps.SendEmailVerification,
+		verifyTwoFactor:       deps.VerifyTwoFactor,
+		tenants:               deps.Tenants,
+	}
+	store := repository.New(deps.DB)
+	if s.accounts == nil {
+		s.accounts = service.NewAccounts(store, deps.Config)
+	}
+	if s.membership == nil {
+		s.membership = service.NewMembership(store, cache.Default)
+	}
+	if s.points == nil {
+		s.points = service.NewPoints(store, cache.Default)
+	}
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(logCalls, recoverPanics, translateErrors, s.resolveTenant, s.authenticate))
+	loyaltyv1.RegisterAuthServiceServer(srv, authService{server: s})
+	loyaltyv1.RegisterProfileServiceServer(srv, profileService{server: s})
+	loyaltyv1.RegisterPointsServiceServer(srv, pointsService{server: s})
+	return srv
+}
+
+// Metadata keys the services read.
+const (
+	metadataAuthorization = "authorization"
+	metadataPartnerKey    = "x-api-key"
+	metadataIdempotency   = "idempotency-key"
+	metadataRequestID     = "x-request-id"
+	metadataTenant        = "x-tenant-id"
+)
+
+// incoming returns the first value of key in the call's metadata, or "".
+func incoming(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// logCalls takes the request ID from the x-request-id metadata, or
+// generates one, as middleware.RequestID does, returns it in the response
+// header and logs each call with its code and latency.
+func logCalls(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	id := incoming(ctx, metadataRequestID)
+	if !middleware.ValidRequestID(id) {
+		id = uuid.NewString()
+	}
+	ctx = requestid.NewContext(ctx, id)
+	grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, id))
+
+	resp, err := handler(ctx, req)
+	log.Printf("[grpc] %s %s - %s request_id=%s", status.Code(err), info.FullMethod, time.Since(start), id)
+	return resp, err
+}
+
+// recoverPanics turns a panic in a call into an Internal error instead of
+// crashing the server; the stack trace is logged.
+func recoverPanics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[grpc] panic in %s: %v request_id=%s\n%s", info.FullMethod, r, requestid.FromContext(ctx), debug.Stack())
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// resolveTenant serves the call for the tenant named in the x-tenant-id
+// metadata, as middleware.Tenant does for X-Tenant-ID.
+func (s *server) resolveTenant(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	name, err := middleware.ResolveTenant(s.tenants, incoming(ctx, metadataTenant))
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		ctx = tenant.NewContext(ctx, name)
+	}
+	return handler(ctx, req)
+}
+
+// publicMethods need no access token and count against the client's
+// AUTH_RATE_LIMIT, as the /auth routes do. Logout reads the token itself,
+// so an expired one can still be logged out.
+var publicMethods = map[string]bool{
+	loyaltyv1.AuthService_Register_FullMethodName:        true,
+	loyaltyv1.AuthService_Login_FullMethodName:           true,
+	loyaltyv1.AuthService_VerifyTwoFactor_FullMethodName: true,
+	loyaltyv1.AuthService_Refresh_FullMethodName:         true,
+	loyaltyv1.AuthService_Logout_FullMethodName:          true,
+}
+
+// termsExemptMethods can be called before the latest terms are accepted,
+// like the routes TermsGate lets through.
+var termsExemptMethods = map[string]bool{
+	loyaltyv1.ProfileService_GetProfile_FullMethodName: true,
+}
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	partnerKey
+)
+
+// authenticate checks the access token in the authorization metadata as
+// JWTMiddleware checks the header, then applies UserRateLimit and TermsGate,
+// or for Earn the partner key in x-api-key as PartnerKeyMiddleware and
+// PartnerRateLimit do, and puts the account in the context of the call.
+// The calls of AuthService only count against AuthRateLimit.
+func (s *server) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	switch {
+	case publicMethods[info.FullMethod]:
+		if err := middleware.LimitAuth(s.cfg.RateLimit.Auth, client(ctx).IP); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	case info.FullMethod == loyaltyv1.PointsService_Earn_FullMethodName:
+		partner, err := middleware.AuthenticatePartner(ctx, s.db, incoming(ctx, metadataPartnerKey), "points:earn")
+		if err != nil {
+			return nil, err
+		}
+		if err := middleware.LimitPartner(s.cfg.RateLimit, partner); err != nil {
+			return nil, s.meter(ctx, partner, info.FullMethod, err)
+		}
+		resp, err := handler(context.WithValue(ctx, partnerKey, partner), req)
+		return resp, s.meter(ctx, partner, info.FullMethod, err)
+	}
+
+	_, user, err := middleware.Authenticate(ctx, s.db, incoming(ctx, metadataAuthorization))
+	if err != nil {
+		return nil, err
+	}
+	if err := middleware.LimitUser(s.cfg.RateLimit, user); err != nil {
+		return nil, err
+	}
+	if !termsExemptMethods[info.FullMethod] {
+		if err := middleware.CheckTerms(ctx, s.db, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return handler(context.WithValue(ctx, userKey, user), req)
+}
+
+// meter counts a partner's call, with the outcome of err, in its API usage
+// and returns err.
+func (s *server) meter(ctx context.Context, partner *models.Partner, method string, err error) error {
+	httpStatus := http.StatusOK
+	if err != nil {
+		httpStatus = middleware.AsAppError(err).Status
+	}
+	if err := middleware.Meter(ctx, s.db, models.APIKeyTypePartner, partner.ID, "GRPC", method, httpStatus); err != nil {
+		log.Printf("[metering] %s key %d: %v request_id=%s", models.APIKeyTypePartner, partner.ID, err, requestid.FromContext(ctx))
+	}
+	return err
+}
+
+// userID is the ID of the account the call authenticated as.
+func userID(ctx context.Context) uint {
+	return ctx.Value(userKey).(*models.User).ID
+}
+
+// partnerOf is the partner whose key the call authenticated with.
+func partnerOf(ctx context.Context) *models.Partner {
+	return ctx.Value(partnerKey).(*models.Partner)
+}
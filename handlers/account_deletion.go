@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// accountPurgeBatch is how many accounts one run of the purge job loads at a
+// time.
+const accountPurgeBatch = 100
+
+// DeleteAccount godoc
+// @Summary Delete the current account
+// @Description Soft-delete the current user's account after confirming the password, and sign out every session. The account can be restored with POST /auth/restore until purge_at, when it and everything it owns are removed for good.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.DeleteAccountRequest true "Current password"
+// @Success 200 {object} models.DeleteAccountResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile [delete]
+func (h *Handler) DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.DeleteAccountRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return models.NewValidationError("Password is incorrect", map[string]string{"password": "is incorrect"})
+	}
+
+	purgeAt := time.Now().AddDate(0, 0, h.cfg.Accounts.DeletionGraceDays).Truncate(time.Second)
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := database.SoftDelete(tx, "users", user.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("purge_at", purgeAt).Error; err != nil {
+			return err
+		}
+		if err := middleware.RevokeUserTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "user.delete",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"deleted_at", "purge_at"},
+		}).Error
+	})
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to delete account").Wrap(err)
+	}
+	h.cache.InvalidateUser(c.UserContext(), user.ID)
+
+	body := fmt.Sprintf("Your account was deleted. You can restore it by signing in through the app until %s; after that it is removed for good. If this was not you, restore it right away and change your password.",
+		purgeAt.Format("2 January 2006"))
+	if err := h.notify.Email(h.db.WithContext(c.UserContext()), h.cfg.BaseURL(), &user, models.NotificationCategoryAccount, "Your account was deleted", body); err != nil {
+		middleware.Logf(c, "[auth] deletion notice for user %d not sent: %v", user.ID, err)
+	}
+
+	return c.JSON(models.DeleteAccountResponse{
+		Message: "Account deleted",
+		PurgeAt: purgeAt,
+	})
+}
+
+// RestoreAccount godoc
+// @Summary Restore a deleted account
+// @Description Restore an account its owner deleted with DELETE /profile, before its purge date, and log in to it. Answers like POST /auth/login, including the two-factor challenge.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.RestoreAccountRequest true "Credentials of the deleted account"
+// @Success 200 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/auth/restore [post]
+func (h *Handler) RestoreAccount(c *fiber.Ctx) error {
+	var req models.RestoreAccountRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	// Only accounts deleted by their owner have a purge date; those an
+	// admin deleted are restored from the trash
+	email := normalize.Email(req.Email)
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).Unscoped().
+		Where("deleted_at IS NOT NULL AND purge_at > ?", time.Now()).
+		Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", normalize.CanonicalEmail(email), email).
+		Order("deleted_at DESC").
+		First(&user).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCredentials, "Invalid credentials")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCredentials, "Invalid credentials")
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := database.Restore(tx, "users", user.ID); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", user.ID),
+			Action:     "user.restore",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"deleted_at", "purge_at"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeEmailTaken, "Another account now uses this email address or phone number")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to restore account").Wrap(err)
+	}
+	h.cache.InvalidateUser(c.UserContext(), user.ID)
+
+	if err := h.db.WithContext(c.UserContext()).First(&user, user.ID).Error; err != nil {
+		return err
+	}
+	return h.loginResponse(c, &user, fiber.StatusOK)
+}
+
+// PurgeDeletedAccounts permanently removes the accounts deleted by their
+// owner whose grace period is over, with everything they own, including
+// their avatar, quarantined uploads and data exports. Accounts an
+// admin deleted have no purge date and stay in the trash.
+func (h *Handler) PurgeDeletedAccounts(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	purged := 0
+	for {
+		var users []models.User
+		err := db.Unscoped().Select("id", "avatar_key").
+			Where("deleted_at IS NOT NULL AND purge_at <= ?", time.Now()).
+			Order("id").Limit(accountPurgeBatch).
+			Find(&users).Error
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			var exportKeys, quarantineKeys []string
+			if err := db.Model(&models.DataExport{}).Where("user_id = ? AND storage_key <> ''", user.ID).Pluck("storage_key", &exportKeys).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&models.ModerationItem{}).Where("user_id = ? AND quarantine_key <> ''", user.ID).Pluck("quarantine_key", &quarantineKeys).Error; err != nil {
+				return err
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := database.Purge(tx, "users", user.ID); err != nil {
+					return err
+				}
+				return tx.Create(&models.AuditLog{
+					Actor:      "job:users.purge",
+					Action:     "user.purge",
+					Resource:   "users",
+					ResourceID: user.ID,
+					Fields:     []string{"deleted_at"},
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("purging user %d: %w", user.ID, err)
+			}
+			h.cache.InvalidateUser(ctx, user.ID)
+			h.deleteStoredFile(user.AvatarKey)
+			for _, key := range append(exportKeys, quarantineKeys...) {
+				h.deleteStoredFile(key)
+			}
+			purged++
+		}
+	}
+	if purged > 0 {
+		log.Printf("[accounts] purged %d deleted accounts", purged)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxAddresses caps the addresses in a user's address book.
+const maxAddresses = 20
+
+// ListAddresses godoc
+// @Summary List addresses
+// @Description List the current user's address book, the default address first, then oldest first
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {array} models.Address
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/addresses [get]
+func (h *Handler) ListAddresses(c *fiber.Ctx) error {
+	var addresses []models.Address
+	err := h.db.WithContext(c.UserContext()).
+		Where("user_id = ?", c.Locals("user_id")).
+		Order("is_default DESC, id").
+		Find(&addresses).Error
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(addresses)
+}
+
+// GetAddress godoc
+// @Summary Get an address
+// @Description Get one address of the current user's address book
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} models.Address
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/addresses/{id} [get]
+func (h *Handler) GetAddress(c *fiber.Ctx) error {
+	var address models.Address
+	err := h.db.WithContext(c.UserContext()).
+		Where("id = ? AND user_id = ?", c.Params("id"), c.Locals("user_id")).
+		First(&address).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Address not found")
+	}
+
+	return c.JSON(address)
+}
+
+// CreateAddress godoc
+// @Summary Add an address
+// @Description Add an address to the current user's address book. The first address becomes the default; is_default makes a later one the default instead. Postal codes are the 5 digits of Thai addresses. A user can keep up to 20 addresses.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param address body models.AddressRequest true "Address"
+// @Success 201 {object} models.Address
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/profile/addresses [post]
+func (h *Handler) CreateAddress(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.AddressRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	address := models.Address{UserID: userID}
+	applyAddress(&address, req)
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxAddresses {
+			return models.NewAppError(fiber.StatusConflict, models.CodeAddressLimitReached, "Address book is full; remove an address first")
+		}
+
+		if count == 0 {
+			address.IsDefault = true
+		} else if address.IsDefault {
+			if err := clearDefaultAddress(tx, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&address).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(address)
+}
+
+// UpdateAddress godoc
+// @Summary Replace an address
+// @Description Replace every field of one of the current user's addresses. is_default makes it the default; false leaves the default as it is, so the default only changes by making another address the default.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param id path int true "Address ID"
+// @Param address body models.AddressRequest true "Address"
+// @Success 200 {object} models.Address
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/addresses/{id} [put]
+func (h *Handler) UpdateAddress(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.AddressRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var address models.Address
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&address).Error; err != nil {
+			return err
+		}
+		wasDefault := address.IsDefault
+		applyAddress(&address, req)
+		address.IsDefault = address.IsDefault || wasDefault
+
+		if address.IsDefault && !wasDefault {
+			if err := clearDefaultAddress(tx, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&address).Updates(map[string]interface{}{
+			"label":       address.Label,
+			"line1":       address.Line1,
+			"line2":       address.Line2,
+			"district":    address.District,
+			"province":    address.Province,
+			"postal_code": address.PostalCode,
+			"is_default":  address.IsDefault,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Address not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(address)
+}
+
+// DeleteAddress godoc
+// @Summary Remove an address
+// @Description Remove one of the current user's addresses. When it was the default, the oldest remaining address becomes the default.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/addresses/{id} [delete]
+func (h *Handler) DeleteAddress(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var address models.Address
+		if err := tx.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&address).Error; err != nil {
+			return err
+		}
+		// Soft-deleted so that GET /sync can report it
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+
+		var next models.Address
+		err := tx.Where("user_id = ?", userID).Order("id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_default", true).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Address not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Address removed",
+	})
+}
+
+// applyAddress copies the trimmed fields of req to address.
+func applyAddress(address *models.Address, req models.AddressRequest) {
+	address.Label = strings.TrimSpace(req.Label)
+	address.Line1 = strings.TrimSpace(req.Line1)
+	address.Line2 = strings.TrimSpace(req.Line2)
+	address.District = strings.TrimSpace(req.District)
+	address.Province = strings.TrimSpace(req.Province)
+	address.PostalCode = strings.TrimSpace(req.PostalCode)
+	address.IsDefault = req.IsDefault
+}
+
+// clearDefaultAddress unsets the user's default address before another one
+// becomes the default, as the unique index allows only one.
+func clearDefaultAddress(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Address{}).Where("user_id = ? AND is_default", userID).Update("is_default", false).Error
+}
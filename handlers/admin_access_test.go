@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+func TestAdminAccess(t *testing.T) {
+	// A read and a write of the admin API, which share the group's guard
+	requests := []struct{ method, path, body string }{
+		{method: http.MethodGet, path: "/api/v1/admin/users"},
+		{method: http.MethodPut, path: "/api/v1/admin/feature-flags/new_checkout", body: `{"enabled":true}`},
+	}
+	tests := []struct {
+		name string
+		role string
+		// change runs after the token is issued
+		change     func(db *gorm.DB, user *models.User)
+		noToken    bool
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "no token", noToken: true, wantStatus: http.StatusUnauthorized},
+		{name: "member", role: models.RoleMember, wantStatus: http.StatusForbidden, wantCode: models.CodeInsufficientPermissions},
+		{name: "unknown role", role: "superuser", wantStatus: http.StatusForbidden, wantCode: models.CodeInsufficientPermissions},
+		{name: "admin", role: models.RoleAdmin, wantStatus: http.StatusOK},
+		{
+			name: "admin demoted since the token was issued",
+			role: models.RoleAdmin,
+			change: func(db *gorm.DB, user *models.User) {
+				db.Model(user).Update("role", models.RoleMember)
+			},
+			wantStatus: http.StatusForbidden,
+			wantCode:   models.CodeInsufficientPermissions,
+		},
+		{
+			name: "member promoted since the token was issued",
+			role: models.RoleMember,
+			change: func(db *gorm.DB, user *models.User) {
+				db.Model(user).Update("role", models.RoleAdmin)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := testutil.NewApp(t)
+			user := testutil.CreateUser(t, db, func(u *models.User) { u.Role = tt.role })
+			auth := testutil.AuthHeader(t, user)
+			if tt.noToken {
+				auth = ""
+			}
+			if tt.change != nil {
+				tt.change(db, &user)
+			}
+
+			for _, req := range requests {
+				status, body := testutil.Request(t, app, req.method, req.path, req.body, auth)
+				if status != tt.wantStatus {
+					t.Fatalf("%s %s: status %d, want %d: %s", req.method, req.path, status, tt.wantStatus, body)
+				}
+				if tt.wantCode != "" {
+					var failure models.ErrorResponse
+					if err := json.Unmarshal([]byte(body), &failure); err != nil || failure.Code != tt.wantCode {
+						t.Errorf("%s %s: error %s, want code %s", req.method, req.path, body, tt.wantCode)
+					}
+				}
+			}
+
+			// A denied write changes nothing
+			var flags, wantFlags int64
+			if tt.wantStatus == http.StatusOK {
+				wantFlags = 1
+			}
+			if db.Model(&models.FeatureFlag{}).Count(&flags); flags != wantFlags {
+				t.Errorf("%d feature flags, want %d", flags, wantFlags)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/backup"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/worker"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// lastBackupJob is the most recent admin-triggered backup. Only one backup
+// runs at a time.
+var (
+	backupMu      sync.Mutex
+	lastBackupJob *models.BackupJob
+)
+
+// ListBackups godoc
+// @Summary List database backups
+// @Description List encrypted backups in BACKUP_DIR, newest first, and the state of the last backup started through the admin API
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.BackupListResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/backups [get]
+func (h *Handler) ListBackups(c *fiber.Ctx) error {
+	backups, err := backup.List(h.cfg.Backup.Dir)
+	if err != nil {
+		return err
+	}
+
+	backupMu.Lock()
+	var job *models.BackupJob
+	if lastBackupJob != nil {
+		snapshot := *lastBackupJob
+		job = &snapshot
+	}
+	backupMu.Unlock()
+
+	return c.JSON(models.BackupListResponse{
+		Backups: backups,
+		LastJob: job,
+	})
+}
+
+// StartBackup godoc
+// @Summary Start a database backup
+// @Description Snapshot, encrypt and verify the database in the background, then rotate old backups. Poll GET /admin/backups for the result.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 202 {object} models.BackupJob
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/backups [post]
+func (h *Handler) StartBackup(c *fiber.Ctx) error {
+	cfg := h.cfg.Backup
+	if cfg.Key == "" {
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Backups are disabled: BACKUP_KEY is not set")
+	}
+	if h.db.Dialector.Name() != "sqlite" {
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Backups are only supported for SQLite databases")
+	}
+
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if lastBackupJob != nil && lastBackupJob.Status == "running" {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "A backup is already running")
+	}
+
+	job := &models.BackupJob{
+		ID:        uuid.NewString(),
+		Status:    "running",
+		StartedAt: time.Now(),
+	}
+	lastBackupJob = job
+	response := *job
+
+	// Shutdown waits for the backup to finish before closing the database
+	worker.Go("backup", func(context.Context) {
+		info, err := backup.Create(h.db, cfg)
+
+		backupMu.Lock()
+		defer backupMu.Unlock()
+		finished := time.Now()
+		job.FinishedAt = &finished
+		if err != nil {
+			log.Printf("Backup %s failed: %v", job.ID, err)
+			job.Status = "failed"
+			job.Error = err.Error()
+			return
+		}
+		job.Status = "succeeded"
+		job.Backup = &info
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(response)
+}
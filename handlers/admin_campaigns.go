@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// campaignPages are the sort and filter keys of GET /admin/campaigns.
+var campaignPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "code": "code", "starts_at": "starts_at"},
+	DefaultSort: "id",
+	Filters:     map[string]string{"event": "event"},
+}
+
+// ListCampaigns godoc
+// @Summary List onboarding campaigns
+// @Description List the campaigns that award points on registration, profile completion and phone verification
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[event] query string false "Event, e.g. registration"
+// @Param sort query string false "id, code or starts_at, - for descending (default id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Campaigns per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Campaign}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/campaigns [get]
+func (h *Handler) ListCampaigns(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, campaignPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Campaign](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateCampaign godoc
+// @Summary Create an onboarding campaign
+// @Description Award points once per user when the event (registration, profile_completed or phone_verified) happens between starts_at and ends_at. Campaigns are active unless active is false.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param campaign body models.CreateCampaignRequest true "Campaign settings"
+// @Success 201 {object} models.Campaign
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/campaigns [post]
+func (h *Handler) CreateCampaign(c *fiber.Ctx) error {
+	var req models.CreateCampaignRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	item := models.Campaign{
+		Code:     strings.TrimSpace(req.Code),
+		Name:     strings.TrimSpace(req.Name),
+		Event:    req.Event,
+		Points:   req.Points,
+		Active:   req.Active == nil || *req.Active,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	}
+
+	fields := campaignProblems(item)
+	if item.Code == "" {
+		fields["code"] = "is required"
+	}
+	if !campaign.Events[item.Event] {
+		fields["event"] = "must be registration, profile_completed or phone_verified"
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid campaign", fields)
+	}
+
+	var existing int64
+	if err := h.db.WithContext(c.UserContext()).Model(&models.Campaign{}).Where("code = ?", item.Code).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Campaign with this code already exists")
+	}
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "campaign.create",
+			Resource:   "campaigns",
+			ResourceID: item.ID,
+			Fields:     []string{"event", "points", "active", "starts_at", "ends_at"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// UpdateCampaign godoc
+// @Summary Update an onboarding campaign
+// @Description Change a campaign's name, points, dates or active flag; only fields present in the body are changed. Points already awarded are kept.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Campaign ID"
+// @Param campaign body models.UpdateCampaignRequest true "Fields to change"
+// @Success 200 {object} models.Campaign
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/campaigns/{id} [patch]
+func (h *Handler) UpdateCampaign(c *fiber.Ctx) error {
+	var req models.UpdateCampaignRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	var item models.Campaign
+	err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Campaign not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	var changed []string
+	if req.Name != nil {
+		item.Name = strings.TrimSpace(*req.Name)
+		updates["name"] = item.Name
+		changed = append(changed, "name")
+	}
+	if req.Points != nil {
+		item.Points = *req.Points
+		updates["points"] = item.Points
+		changed = append(changed, "points")
+	}
+	if req.Active != nil {
+		item.Active = *req.Active
+		updates["active"] = item.Active
+		changed = append(changed, "active")
+	}
+	if req.StartsAt != nil {
+		item.StartsAt = req.StartsAt
+		updates["starts_at"] = item.StartsAt
+		changed = append(changed, "starts_at")
+	}
+	if req.EndsAt != nil {
+		item.EndsAt = req.EndsAt
+		updates["ends_at"] = item.EndsAt
+		changed = append(changed, "ends_at")
+	}
+
+	if fields := campaignProblems(item); len(fields) > 0 {
+		return models.NewValidationError("Invalid campaign", fields)
+	}
+	if len(updates) == 0 {
+		return c.JSON(item)
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "campaign.update",
+			Resource:   "campaigns",
+			ResourceID: item.ID,
+			Fields:     changed,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+// campaignProblems validates the fields shared by create and update.
+func campaignProblems(item models.Campaign) map[string]string {
+	fields := map[string]string{}
+	if item.Points <= 0 {
+		fields["points"] = "must be greater than 0"
+	}
+	if item.StartsAt != nil && item.EndsAt != nil && !item.EndsAt.After(*item.StartsAt) {
+		fields["ends_at"] = "must be after starts_at"
+	}
+	return fields
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// capturePages are the sort and filter keys of GET /admin/captured-requests.
+var capturePages = pagination.Options{
+	DefaultLimit: 50,
+	MaxLimit:     200,
+	Sorts:        map[string]string{"id": "id", "created_at": "created_at", "status": "status"},
+	DefaultSort:  "-id",
+	Filters: map[string]string{
+		"status":  "status",
+		"method":  "method",
+		"user_id": "user_id",
+	},
+}
+
+// ListCapturedRequests godoc
+// @Summary List captured failing requests
+// @Description List anonymized 4xx/5xx requests recorded while CAPTURE_FAILED_REQUESTS=true, most recent first
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[status] query int false "Response status"
+// @Param filter[method] query string false "HTTP method"
+// @Param filter[user_id] query int false "User the request was made as"
+// @Param path query string false "Filter by path prefix"
+// @Param sort query string false "id, created_at or status, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Requests per page (default 50, max 200)"
+// @Success 200 {object} models.PagedResponse{items=[]models.CapturedRequest}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/captured-requests [get]
+func (h *Handler) ListCapturedRequests(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, capturePages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext())
+	if path := c.Query("path"); path != "" {
+		query = query.Where("path LIKE ? ESCAPE '!'", likeEscaper.Replace(path)+"%")
+	}
+
+	page, err := pagination.Find[models.CapturedRequest](query, params)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load captured requests")
+	}
+
+	return c.JSON(page)
+}
+
+// DeleteCapturedRequests godoc
+// @Summary Delete captured failing requests
+// @Description Permanently delete all captured requests
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/captured-requests [delete]
+func (h *Handler) DeleteCapturedRequests(c *fiber.Ctx) error {
+	result := h.db.WithContext(c.UserContext()).Where("1 = 1").Delete(&models.CapturedRequest{})
+	if result.Error != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to delete captured requests")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Captured requests deleted",
+		"deleted": result.RowsAffected,
+	})
+}
+
+// ReplayCapturedRequest godoc
+// @Summary Replay a captured request against staging
+// @Description Send a captured request to the instance configured in REPLAY_TARGET_URL and return its response. Redacted headers are dropped; pass a staging token as authorization to replay authenticated calls.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Captured request ID"
+// @Param replay body models.ReplayRequest false "Replay options"
+// @Success 200 {object} models.ReplayResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/captured-requests/{id}/replay [post]
+func (h *Handler) ReplayCapturedRequest(c *fiber.Ctx) error {
+	target := strings.TrimRight(h.cfg.ReplayTargetURL, "/")
+	if target == "" {
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "REPLAY_TARGET_URL is not configured")
+	}
+
+	var req models.ReplayRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+		}
+	}
+
+	var captured models.CapturedRequest
+	if err := h.db.WithContext(c.UserContext()).First(&captured, c.Params("id")).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Captured request not found")
+	}
+
+	url := target + captured.Path
+	if captured.Query != "" {
+		url += "?" + captured.Query
+	}
+
+	outbound, err := http.NewRequestWithContext(c.UserContext(), captured.Method, url, bytes.NewBufferString(captured.Body))
+	if err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Captured request cannot be replayed")
+	}
+	for name, value := range captured.Headers {
+		if value == "[REDACTED]" || strings.EqualFold(name, "Host") || strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		outbound.Header.Set(name, value)
+	}
+	if req.Authorization != "" {
+		outbound.Header.Set("Authorization", req.Authorization)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second, Transport: requestid.Transport(tracing.Transport(nil))}
+	started := time.Now()
+	resp, err := client.Do(outbound)
+	if err != nil {
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Replay target unreachable: "+err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	return c.JSON(models.ReplayResponse{
+		Target:     url,
+		Status:     resp.StatusCode,
+		Body:       string(body),
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// adminCouponPages are the sort and filter keys of GET /admin/coupons.
+var adminCouponPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "code": "code", "uses": "uses", "ends_at": "ends_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"batch": "batch",
+		"code":  "code",
+		"type":  "type",
+	},
+}
+
+// couponCodeAttempts is how often a batch is generated again when one of
+// its random codes is already taken.
+const couponCodeAttempts = 3
+
+// AdminListCoupons godoc
+// @Summary List coupons
+// @Description List coupons with how often each was applied, e.g. the codes of a generated batch
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[batch] query string false "Batch name"
+// @Param filter[code] query string false "Exact code, upper-case"
+// @Param filter[type] query string false "points or discount"
+// @Param sort query string false "id, code, uses or ends_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Coupons per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Coupon}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/coupons [get]
+func (h *Handler) AdminListCoupons(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, adminCouponPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Coupon](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateCoupon godoc
+// @Summary Create a coupon
+// @Description Create a coupon with a chosen code, e.g. a promotion code many members can apply. A points coupon credits value points; a discount coupon is value percent off. max_uses limits how many members can apply it (0, the default, is unlimited). Coupons are active unless active is false.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param coupon body models.CreateCouponRequest true "Coupon"
+// @Success 201 {object} models.Coupon
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/coupons [post]
+func (h *Handler) CreateCoupon(c *fiber.Ctx) error {
+	var req models.CreateCouponRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	item := models.Coupon{
+		Code:     strings.ToUpper(strings.TrimSpace(req.Code)),
+		Name:     strings.TrimSpace(req.Name),
+		Type:     req.Type,
+		Value:    req.Value,
+		MaxUses:  req.MaxUses,
+		Active:   req.Active == nil || *req.Active,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	}
+	if fields := couponProblems(item); len(fields) > 0 {
+		return models.NewValidationError("Invalid coupon", fields)
+	}
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "coupon.create",
+			Resource:   "coupons",
+			ResourceID: item.ID,
+			Fields:     []string{"code", "name", "type", "value", "max_uses", "active", "starts_at", "ends_at"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Coupon with this code already exists")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// GenerateCoupons godoc
+// @Summary Generate a batch of coupons
+// @Description Create up to 10000 coupons with random codes (the prefix and 10 characters) and the same settings, e.g. single-use codes to print or send out. max_uses defaults to 1. The codes are returned once here and can be listed again with filter[batch].
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param batch body models.GenerateCouponsRequest true "Batch settings"
+// @Success 201 {object} models.GenerateCouponsResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/coupons/batch [post]
+func (h *Handler) GenerateCoupons(c *fiber.Ctx) error {
+	var req models.GenerateCouponsRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	template := models.Coupon{
+		Batch:    strings.TrimSpace(req.Batch),
+		Name:     strings.TrimSpace(req.Name),
+		Type:     req.Type,
+		Value:    req.Value,
+		MaxUses:  1,
+		Active:   req.Active == nil || *req.Active,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	}
+	if req.MaxUses != nil {
+		template.MaxUses = *req.MaxUses
+	}
+	if fields := couponProblems(template); len(fields) > 0 {
+		return models.NewValidationError("Invalid coupon", fields)
+	}
+	prefix := strings.ToUpper(strings.TrimSpace(req.Prefix))
+
+	var existing int64
+	if err := h.db.WithContext(c.UserContext()).Model(&models.Coupon{}).Where("batch = ?", template.Batch).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Batch with this name already exists")
+	}
+
+	var coupons []models.Coupon
+	var err error
+	for attempt := 0; attempt < couponCodeAttempts; attempt++ {
+		coupons = make([]models.Coupon, req.Count)
+		for i := range coupons {
+			coupons[i] = template
+			coupons[i].Code = prefix + rand.Text()[:10]
+		}
+
+		err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(&coupons, 500).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.AuditLog{
+				Actor:      auditActor(c),
+				Action:     "coupon.generate",
+				Resource:   "coupons",
+				ResourceID: coupons[0].ID,
+				Fields:     []string{"batch", "code", "name", "type", "value", "max_uses", "active", "starts_at", "ends_at"},
+			}).Error
+		})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	codes := make([]string, len(coupons))
+	for i, coupon := range coupons {
+		codes[i] = coupon.Code
+	}
+	return c.Status(fiber.StatusCreated).JSON(models.GenerateCouponsResponse{
+		Batch: template.Batch,
+		Codes: codes,
+	})
+}
+
+// UpdateCoupon godoc
+// @Summary Update a coupon
+// @Description Change a coupon's name, use limit, dates or active flag; only fields present in the body are changed. Deactivating stops further uses; coupons already applied are kept.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Coupon ID"
+// @Param coupon body models.UpdateCouponRequest true "Fields to change"
+// @Success 200 {object} models.Coupon
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/coupons/{id} [patch]
+func (h *Handler) UpdateCoupon(c *fiber.Ctx) error {
+	var req models.UpdateCouponRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var item models.Coupon
+	err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Coupon not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	var changed []string
+	if req.Name != nil {
+		item.Name = strings.TrimSpace(*req.Name)
+		updates["name"] = item.Name
+		changed = append(changed, "name")
+	}
+	if req.MaxUses != nil {
+		item.MaxUses = *req.MaxUses
+		updates["max_uses"] = item.MaxUses
+		changed = append(changed, "max_uses")
+	}
+	if req.Active != nil {
+		item.Active = *req.Active
+		updates["active"] = item.Active
+		changed = append(changed, "active")
+	}
+	if req.StartsAt != nil {
+		item.StartsAt = req.StartsAt
+		updates["starts_at"] = item.StartsAt
+		changed = append(changed, "starts_at")
+	}
+	if req.EndsAt != nil {
+		item.EndsAt = req.EndsAt
+		updates["ends_at"] = item.EndsAt
+		changed = append(changed, "ends_at")
+	}
+
+	if fields := couponProblems(item); len(fields) > 0 {
+		return models.NewValidationError("Invalid coupon", fields)
+	}
+	if len(updates) == 0 {
+		return c.JSON(item)
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "coupon.update",
+			Resource:   "coupons",
+			ResourceID: item.ID,
+			Fields:     changed,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+// couponProblems validates the fields shared by create, generate and update
+// that the validate tags cannot express.
+func couponProblems(item models.Coupon) map[string]string {
+	fields := map[string]string{}
+	if item.Name == "" {
+		fields["name"] = "cannot be empty"
+	}
+	if item.Type == models.CouponDiscount && item.Value > 100 {
+		fields["value"] = "must be at most 100 for a discount"
+	}
+	if item.StartsAt != nil && item.EndsAt != nil && !item.EndsAt.After(*item.StartsAt) {
+		fields["ends_at"] = "must be after starts_at"
+	}
+	return fields
+}
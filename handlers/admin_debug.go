@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBodyLogging godoc
+// @Summary Get request/response body logging settings
+// @Description Get which routes or user currently have their request and response bodies logged
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} middleware.BodyLogConfig
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/debug/body-logging [get]
+func (h *Handler) GetBodyLogging(c *fiber.Ctx) error {
+	return c.JSON(middleware.GetBodyLogConfig())
+}
+
+// UpdateBodyLogging godoc
+// @Summary Update request/response body logging settings
+// @Description Enable or disable body logging for route prefixes or a specific user ID. Bodies are redacted and truncated to max_bytes.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param settings body middleware.BodyLogConfig true "Body logging settings"
+// @Success 200 {object} middleware.BodyLogConfig
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/debug/body-logging [put]
+func (h *Handler) UpdateBodyLogging(c *fiber.Ctx) error {
+	var req middleware.BodyLogConfig
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if req.Enabled && len(req.Routes) == 0 && req.UserID == 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "At least one route or a user ID is required to enable body logging")
+	}
+
+	return c.JSON(middleware.SetBodyLogConfig(req))
+}
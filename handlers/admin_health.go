@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/backup"
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/payment"
+	"temp-backend-at-kbtg/push"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/sms"
+	"temp-backend-at-kbtg/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	// backupMaxAge is how old the newest backup may get before the backup
+	// job is reported as degraded
+	backupMaxAge = 26 * time.Hour
+)
+
+// healthCheck probes one dependency. It returns the status and an optional
+// detail; its latency is measured by runHealthChecks.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) (string, string)
+}
+
+// healthChecks probe each external dependency.
+func (h *Handler) healthChecks() []healthCheck {
+	return []healthCheck{
+		{"database", h.checkDatabase},
+		{"shards", h.checkShards},
+		{"email_provider", func(context.Context) (string, string) { return providerHealth(h.mailer) }},
+		{"sms_provider", func(context.Context) (string, string) { return providerHealth(h.sms) }},
+		{"push_provider", func(context.Context) (string, string) { return providerHealth(h.push) }},
+		{"payment_gateway", func(context.Context) (string, string) { return providerHealth(h.payments) }},
+		{"event_broker", h.checkEventBroker},
+		{"storage", h.checkStorage},
+		{"rate_limit_store", checkRateLimitStore},
+		{"job_queue", checkJobQueue},
+		{"cache", checkCache},
+		{"lock_store", h.checkLockStore},
+		{"migrations", h.checkMigrations},
+	}
+}
+
+// HealthDetails godoc
+// @Summary Detailed health diagnostics
+// @Description Report status and latency of each dependency, request error rates over the last minutes and when background jobs last ran. Returns 503 when a dependency is down.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.HealthDetailsResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 503 {object} models.HealthDetailsResponse
+// @Router /api/v1/admin/health/details [get]
+func (h *Handler) HealthDetails(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), healthCheckTimeout)
+	defer cancel()
+
+	result := models.HealthDetailsResponse{
+		CheckedAt: time.Now(),
+		Requests:  middleware.RecentRequestStats(),
+		Jobs:      []models.JobHealth{h.backupJobHealth()},
+		Locks:     lock.Stats(),
+	}
+	result.Dependencies, result.Status = runHealthChecks(ctx, h.healthChecks())
+
+	code := fiber.StatusOK
+	if result.Status == "down" {
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(result)
+}
+
+// runHealthChecks runs the checks in order and returns their results and
+// the overall status: down if any check is down, else degraded if any is
+// degraded, else ok.
+func runHealthChecks(ctx context.Context, checks []healthCheck) ([]models.DependencyHealth, string) {
+	results := make([]models.DependencyHealth, 0, len(checks))
+	overall := "ok"
+	for _, hc := range checks {
+		started := time.Now()
+		status, detail := hc.check(ctx)
+		results = append(results, models.DependencyHealth{
+			Name:      hc.name,
+			Status:    status,
+			LatencyMs: time.Since(started).Milliseconds(),
+			Detail:    detail,
+		})
+
+		switch {
+		case status == "down":
+			overall = "down"
+		case status == "degraded" && overall == "ok":
+			overall = "degraded"
+		}
+	}
+	return results, overall
+}
+
+func (h *Handler) checkDatabase(ctx context.Context) (string, string) {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return "down", err.Error()
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return "down", err.Error()
+	}
+
+	var users int64
+	if err := h.db.WithContext(ctx).Model(&models.User{}).Count(&users).Error; err != nil {
+		return "down", err.Error()
+	}
+
+	// Requests waiting for a connection mean the pool is too small
+	stats := sqlDB.Stats()
+	return "ok", fmt.Sprintf("%d open connections, %d in use, %d waits for a free one", stats.OpenConnections, stats.InUse, stats.WaitCount)
+}
+
+// checkShards pings the databases of the other tenants. One that cannot be
+// reached is degraded: only the admin stats need it.
+func (h *Handler) checkShards(ctx context.Context) (string, string) {
+	shards := h.shards.Shards()[1:]
+	if len(shards) == 0 {
+		return "ok", "no other shards"
+	}
+	_, errs := shard.Gather(ctx, shard.New(shards...), func(ctx context.Context, s *shard.Shard) (struct{}, error) {
+		sqlDB, err := s.DB.DB()
+		if err != nil {
+			return struct{}{}, err
+		}
+		return struct{}{}, sqlDB.PingContext(ctx)
+	})
+	var down []string
+	for i, err := range errs {
+		if err != nil {
+			down = append(down, fmt.Sprintf("%s: %v", shards[i].Tenant, err))
+		}
+	}
+	if len(down) > 0 {
+		return "degraded", strings.Join(down, "; ")
+	}
+	return "ok", fmt.Sprintf("%d other shards", len(shards))
+}
+
+// checkLockStore reports where locks are taken. A store that cannot be
+// reached is down: scheduled jobs, redemptions and social sign-in stop.
+func (h *Handler) checkLockStore(ctx context.Context) (string, string) {
+	if err := h.locks.Ping(ctx); err != nil {
+		return "down", err.Error()
+	}
+	return "ok", h.locks.Name()
+}
+
+// checkRateLimitStore reports an unreachable store as degraded rather than
+// down, because the limiters then let requests through.
+func checkRateLimitStore(context.Context) (string, string) {
+	store := middleware.RateStore()
+	if err := store.Ping(); err != nil {
+		return "degraded", err.Error()
+	}
+	return "ok", store.Name()
+}
+
+// checkJobQueue reports whether jobs can be queued. Requests still succeed
+// without the queue, so a failure is degraded rather than down; email is
+// then sent at once.
+func checkJobQueue(context.Context) (string, string) {
+	counts, err := jobs.Counts()
+	if err != nil {
+		return "degraded", err.Error()
+	}
+	return "ok", fmt.Sprintf("%s, %d queued, %d retrying", jobs.Backend(), counts.Queued, counts.Retrying)
+}
+
+// checkCache reports whether cached reads can be served. Reads fall back
+// to the database without the cache, so a failure is degraded rather than
+// down.
+func checkCache(context.Context) (string, string) {
+	if err := cache.Ping(); err != nil {
+		return "degraded", err.Error()
+	}
+	return "ok", cache.Backend()
+}
+
+// checkStorage reports whether uploads can be stored. Only uploads fail
+// without storage, so a failure is degraded rather than down.
+func (h *Handler) checkStorage(ctx context.Context) (string, string) {
+	switch store := h.storage.(type) {
+	case *storage.Local:
+		info, err := os.Stat(store.Dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "ok", "local directory " + store.Dir + ", created on the first upload"
+		}
+		if err != nil {
+			return "degraded", err.Error()
+		}
+		if !info.IsDir() {
+			return "degraded", store.Dir + " is not a directory"
+		}
+		return "ok", "local directory " + store.Dir
+	case *storage.S3:
+		if err := store.Ping(ctx); err != nil {
+			return "degraded", err.Error()
+		}
+		return "ok", "s3"
+	default:
+		return "ok", ""
+	}
+}
+
+// checkEventBroker reports the broker events are relayed to. Events waiting
+// for over a minute mean the broker has been refusing them.
+func (h *Handler) checkEventBroker(ctx context.Context) (string, string) {
+	if h.events == nil {
+		return "not_configured", "events only go to webhooks"
+	}
+	count, age, err := events.Backlog(h.db.WithContext(ctx))
+	if err != nil {
+		return "degraded", err.Error()
+	}
+	if age > time.Minute {
+		return "degraded", fmt.Sprintf("%d events waiting, the oldest for %s", count, age.Round(time.Second))
+	}
+	return providerHealth(h.events)
+}
+
+// providerHealth reports whether a sender delivers for real. Senders that
+// only write to the outbox or the log are not real providers.
+func providerHealth(sender interface{}) (string, string) {
+	switch sender.(type) {
+	case mailer.Queue:
+		return providerHealth(mailer.Default)
+	case sms.OutboxSender, push.OutboxSender, mailer.OutboxSender, events.OutboxPublisher:
+		return "ok", "mock mode, delivering to the outbox"
+	case sms.LogSender, push.LogSender, mailer.LogSender:
+		return "not_configured", "messages are only logged"
+	case payment.OutboxGateway:
+		return "ok", "mock mode, charges go to the outbox"
+	case payment.UnconfiguredGateway:
+		return "not_configured", "top-ups are refused"
+	case *mailer.SMTP:
+		return "ok", "smtp"
+	case *mailer.SendGrid:
+		return "ok", "sendgrid"
+	case *sms.Twilio:
+		return "ok", "twilio"
+	case *sms.ThaiBulkSMS:
+		return "ok", "thaibulksms"
+	case *push.FCM:
+		return "ok", "fcm"
+	case *events.NATS:
+		return "ok", "nats"
+	case *events.Kafka:
+		return "ok", "kafka"
+	default:
+		return "ok", ""
+	}
+}
+
+func (h *Handler) backupJobHealth() models.JobHealth {
+	job := models.JobHealth{Name: "backup", Status: "not_configured"}
+	if h.cfg.Backup.Key == "" {
+		return job
+	}
+
+	backups, err := backup.List(h.cfg.Backup.Dir)
+	if err != nil {
+		job.Status = "degraded"
+		job.LastResult = err.Error()
+		return job
+	}
+
+	job.Status = "degraded"
+	job.LastResult = "no backup yet"
+	if len(backups) > 0 {
+		job.LastRunAt = &backups[0].CreatedAt
+		job.LastResult = backups[0].Name
+		if time.Since(backups[0].CreatedAt) <= backupMaxAge {
+			job.Status = "ok"
+		}
+	}
+
+	backupMu.Lock()
+	if lastBackupJob != nil && lastBackupJob.Status == "failed" {
+		job.Status = "degraded"
+		job.LastResult = lastBackupJob.Error
+	}
+	backupMu.Unlock()
+
+	return job
+}
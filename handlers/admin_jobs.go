@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	jobReportExport = "report.export"
+	// lockTTL is how long the locks of the handlers outlive a holder that
+	// died; lock.Do extends them while the holder runs.
+	lockTTL = 30 * time.Second
+	// jobListLimit is how many jobs GET /admin/jobs returns.
+	jobListLimit = 100
+)
+
+// RegisterJobs registers the background jobs run by the handlers, with
+// their retry policies. The server and `go run . worker` both call it at
+// startup. The scheduled jobs are safe to run again after a failure part
+// way.
+func (h *Handler) RegisterJobs() {
+	jobs.Register(jobReportExport, jobs.Policy{MaxAttempts: 3, RetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute, Timeout: 10 * time.Minute}, h.exportReport)
+	jobs.Register(jobDataExport, jobs.Policy{MaxAttempts: 3, RetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute, Timeout: 10 * time.Minute}, h.exportUserData)
+	jobs.Register(jobModerationCheck, jobs.Policy{MaxAttempts: 3, RetryDelay: 30 * time.Second, MaxRetryDelay: 5 * time.Minute, Timeout: time.Minute}, h.checkModeration)
+	jobs.Register("points.expire", jobs.Policy{MaxAttempts: 5, RetryDelay: time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("points.expire", h.ExpirePoints))
+	jobs.Register("points.reconcile", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("points.reconcile", h.ReconcilePoints))
+	jobs.Register("points.statements", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("points.statements", h.SendPointsStatements))
+	jobs.Register("settlements.generate", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("settlements.generate", h.GenerateMonthlySettlements))
+	jobs.Register("tiers.recalculate", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("tiers.recalculate", h.RecalculateTiers))
+	// Tier notices run every minute, so the next run is the retry
+	jobs.Register("tiers.notices", jobs.Policy{MaxAttempts: 1, Timeout: 5 * time.Minute}, h.scheduledJob("tiers.notices", h.SendTierNotices))
+	// Sagas resume every minute as well, and each records its own retries
+	jobs.Register("sagas.resume", jobs.Policy{MaxAttempts: 1, Timeout: 5 * time.Minute}, h.scheduledJob("sagas.resume", h.ResumeSagas))
+	jobs.Register("notifications.prune", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("notifications.prune", h.PruneNotifications))
+	jobs.Register("sync.prune_tombstones", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("sync.prune_tombstones", h.PruneSyncTombstones))
+	jobs.Register("users.purge", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("users.purge", h.PurgeDeletedAccounts))
+	jobs.Register("data_exports.prune", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("data_exports.prune", h.PruneDataExports))
+	jobs.Register("audit_logs.prune", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: time.Hour}, h.scheduledJob("audit_logs.prune", h.PruneAuditLogs))
+	jobs.Register("analytics.export", jobs.Policy{MaxAttempts: 3, RetryDelay: 5 * time.Minute, MaxRetryDelay: 30 * time.Minute, Timeout: 2 * time.Hour}, h.scheduledJob("analytics.export", h.ExportAnalytics))
+}
+
+// scheduledRunPayload is the payload of a job queued by the scheduler.
+type scheduledRunPayload struct {
+	RunID uint `json:"run_id"`
+}
+
+// QueueScheduledRun is the scheduler's dispatch: it queues the job named
+// after the recurring job for a run this instance claimed.
+func QueueScheduledRun(ctx context.Context, run *models.ScheduledRun) error {
+	job, err := jobs.Enqueue(ctx, run.Job, scheduledRunPayload{RunID: run.ID})
+	if err != nil {
+		return err
+	}
+	run.JobID = job.ID
+	return nil
+}
+
+// scheduledJob runs the scheduled function of the job name, which returns
+// no result, as a job, recording each attempt in the history of the run it
+// was queued for. A run holds the lock job:<name>, so one that starts
+// while another is still going, such as a retry after a worker's lease
+// ran out, fails at once instead of doing the work twice.
+func (h *Handler) scheduledJob(name string, fn func(ctx context.Context) error) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var p scheduledRunPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		return nil, scheduler.Track(ctx, p.RunID, func(ctx context.Context) error {
+			err := lock.Do(ctx, h.locks, "job:"+name, lockTTL, fn)
+			if errors.Is(err, lock.ErrHeld) {
+				return jobs.Permanent(fmt.Errorf("another run of %s is in progress", name))
+			}
+			return err
+		})
+	}
+}
+
+// ListJobs godoc
+// @Summary List background jobs
+// @Description Report the job queue's backend and the number of jobs in each status, with the most recent jobs (up to 100, newest first). Finished jobs are kept for 7 days, up to the latest 1000.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param status query string false "queued, running, retrying, succeeded or failed"
+// @Param type query string false "Job type, e.g. report.export or email.send"
+// @Success 200 {object} models.JobListResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/jobs [get]
+func (h *Handler) ListJobs(c *fiber.Ctx) error {
+	result, err := jobs.List(c.Query("status"), c.Query("type"), jobListLimit)
+	if err != nil {
+		log.Printf("[jobs] listing jobs failed: %v", err)
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Job queue unavailable")
+	}
+	return c.JSON(result)
+}
+
+// GetJob godoc
+// @Summary Get a background job
+// @Description Get a job's status and, once it has succeeded, its result, e.g. the download link of a report export
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/jobs/{id} [get]
+func (h *Handler) GetJob(c *fiber.Ctx) error {
+	job, err := jobs.Get(c.Params("id"))
+	if err != nil {
+		log.Printf("[jobs] loading job %s failed: %v", c.Params("id"), err)
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Job queue unavailable")
+	}
+	if job == nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Job not found")
+	}
+	return c.JSON(job)
+}
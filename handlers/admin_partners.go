@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// partnerScopes are the scopes a partner key can be granted.
+var partnerScopes = map[string]bool{
+	partnerScopeMembersRead: true,
+	partnerScopePointsEarn:  true,
+}
+
+// partnerPages are the sort keys of GET /admin/partners.
+var partnerPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "name": "name", "last_used_at": "last_used_at"},
+	DefaultSort: "id",
+}
+
+// ListPartners godoc
+// @Summary List partners
+// @Description List partners with their scopes, visible fields and key prefixes
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param sort query string false "id, name or last_used_at, - for descending (default id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Partners per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Partner}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/partners [get]
+func (h *Handler) ListPartners(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, partnerPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Partner](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreatePartner godoc
+// @Summary Create a partner and API key
+// @Description Register a partner and issue its API key. The key is only returned in this response. Without visible_fields the partner sees member_level, earn_multiplier and points_eligible. The plan sets the partner's rate limit: standard (the default) gets rate_limit.partner requests per minute, the plans of rate_limit.plans theirs.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param partner body models.CreatePartnerRequest true "Partner settings"
+// @Success 201 {object} models.CreatePartnerResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/partners [post]
+func (h *Handler) CreatePartner(c *fiber.Ctx) error {
+	var req models.CreatePartnerRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.VisibleFields) == 0 {
+		req.VisibleFields = defaultPartnerFields
+	}
+
+	fields := map[string]string{}
+	if req.Name == "" {
+		fields["name"] = "is required"
+	}
+	if len(req.Scopes) == 0 {
+		fields["scopes"] = "is required"
+	}
+	for _, scope := range req.Scopes {
+		if !partnerScopes[scope] {
+			fields["scopes"] = "unknown scope " + scope
+		}
+	}
+	for _, field := range req.VisibleFields {
+		if !partnerFields[field] {
+			fields["visible_fields"] = "unknown field " + field
+		}
+	}
+	if req.Plan == "" {
+		req.Plan = models.PartnerPlanStandard
+	}
+	if !h.partnerPlan(req.Plan) {
+		fields["plan"] = "unknown plan " + req.Plan
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid partner", fields)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	key := "pk_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	partner := models.Partner{
+		Name:          req.Name,
+		KeyHash:       middleware.HashPartnerKey(key),
+		KeyPrefix:     key[:10],
+		Scopes:        req.Scopes,
+		VisibleFields: req.VisibleFields,
+		Plan:          req.Plan,
+	}
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&partner).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "partner.create",
+			Resource:   "partners",
+			ResourceID: partner.ID,
+			Fields:     []string{"scopes", "visible_fields", "plan"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.CreatePartnerResponse{
+		Partner: partner,
+		APIKey:  key,
+	})
+}
+
+// UpdatePartner godoc
+// @Summary Update a partner
+// @Description Move a partner to another plan, which takes effect with its next request: standard gets rate_limit.partner requests per minute, the plans of rate_limit.plans theirs. Only fields present in the body are changed.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Partner ID"
+// @Param partner body models.UpdatePartnerRequest true "Fields to change"
+// @Success 200 {object} models.Partner
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/partners/{id} [patch]
+func (h *Handler) UpdatePartner(c *fiber.Ctx) error {
+	var req models.UpdatePartnerRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if req.Plan != nil && !h.partnerPlan(*req.Plan) {
+		return models.NewValidationError("Invalid partner", map[string]string{"plan": "unknown plan " + *req.Plan})
+	}
+
+	var partner models.Partner
+	err := h.db.WithContext(c.UserContext()).First(&partner, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Partner not found")
+	}
+	if err != nil {
+		return err
+	}
+	if req.Plan == nil || *req.Plan == partner.Plan {
+		return c.JSON(partner)
+	}
+
+	partner.Plan = *req.Plan
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&partner).Update("plan", partner.Plan).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "partner.update",
+			Resource:   "partners",
+			ResourceID: partner.ID,
+			Fields:     []string{"plan"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(partner)
+}
+
+// partnerPlan reports whether plan is standard or a plan of
+// rate_limit.plans.
+func (h *Handler) partnerPlan(plan string) bool {
+	_, ok := h.cfg.RateLimit.Plans[plan]
+	return ok || plan == models.PartnerPlanStandard
+}
+
+// RevokePartner godoc
+// @Summary Revoke a partner's API key
+// @Description Stop accepting the partner's API key immediately
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Partner ID"
+// @Success 200 {object} models.Partner
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/partners/{id} [delete]
+func (h *Handler) RevokePartner(c *fiber.Ctx) error {
+	var partner models.Partner
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("revoked_at IS NULL").First(&partner, c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&partner).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "partner.revoke",
+			Resource:   "partners",
+			ResourceID: partner.ID,
+			Fields:     []string{"revoked_at"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Active partner not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(partner)
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const reportDateLayout = "2006-01-02"
+
+// reportExportTTL is how long the download link of a report export works.
+const reportExportTTL = 15 * time.Minute
+
+type report struct {
+	description string
+	columns     []string
+	// run returns the rows for the half-open range [from, to).
+	run func(db *gorm.DB, from, to time.Time) ([]map[string]interface{}, error)
+}
+
+var reports = map[string]report{
+	"daily_registrations": {
+		description: "New registrations per day (UTC), including accounts deleted since",
+		columns:     []string{"day", "registrations"},
+		run: func(db *gorm.DB, from, to time.Time) ([]map[string]interface{}, error) {
+			var rows []map[string]interface{}
+			err := db.Model(&models.User{}).Unscoped().
+				Select("DATE(created_at) AS day, COUNT(*) AS registrations").
+				Where("created_at >= ? AND created_at < ?", from, to).
+				Group("DATE(created_at)").
+				Order("day").
+				Find(&rows).Error
+			return rows, err
+		},
+	},
+	"points_liability": {
+		description: "Outstanding points per member level right now; the date range is ignored",
+		columns:     []string{"member_level", "members", "points"},
+		run: func(db *gorm.DB, from, to time.Time) ([]map[string]interface{}, error) {
+			var rows []map[string]interface{}
+			err := db.Model(&models.User{}).
+				Select("member_level, COUNT(*) AS members, COALESCE(SUM(points), 0) AS points").
+				Group("member_level").
+				Order("member_level").
+				Find(&rows).Error
+			return rows, err
+		},
+	},
+	"api_usage": {
+		description: "Requests and errors per API key, partner keys by partner and user keys by key",
+		columns:     []string{"key_type", "key_id", "name", "requests", "client_errors", "server_errors"},
+		run: func(db *gorm.DB, from, to time.Time) ([]map[string]interface{}, error) {
+			var rows []map[string]interface{}
+			err := apiUsageQuery(db, from, to).
+				Select(apiUsageKeyColumns + ", " + apiUsageCountColumns).
+				Group("api_usage.key_type, api_usage.key_id, partners.name, api_keys.name").
+				Order("requests DESC, api_usage.key_type, api_usage.key_id").
+				Find(&rows).Error
+			return rows, err
+		},
+	},
+	"api_usage_endpoints": {
+		description: "Requests and errors per API key and endpoint",
+		columns:     []string{"key_type", "key_id", "name", "method", "route", "requests", "client_errors", "server_errors"},
+		run: func(db *gorm.DB, from, to time.Time) ([]map[string]interface{}, error) {
+			var rows []map[string]interface{}
+			err := apiUsageQuery(db, from, to).
+				Select(apiUsageKeyColumns + ", api_usage.method, api_usage.route, " + apiUsageCountColumns).
+				Group("api_usage.key_type, api_usage.key_id, partners.name, api_keys.name, api_usage.method, api_usage.route").
+				Order("api_usage.key_type, api_usage.key_id, requests DESC, api_usage.route, api_usage.method").
+				Find(&rows).Error
+			return rows, err
+		},
+	},
+}
+
+const (
+	apiUsageKeyColumns   = "api_usage.key_type, api_usage.key_id, COALESCE(partners.name, api_keys.name, '') AS name"
+	apiUsageCountColumns = "SUM(api_usage.requests) AS requests, SUM(api_usage.client_errors) AS client_errors, SUM(api_usage.server_errors) AS server_errors"
+)
+
+// apiUsageQuery selects the api_usage rows of [from, to) joined to the
+// partner or user API key they count, for its name.
+func apiUsageQuery(db *gorm.DB, from, to time.Time) *gorm.DB {
+	return db.Table("api_usage").
+		Joins("LEFT JOIN partners ON api_usage.key_type = ? AND partners.id = api_usage.key_id", models.APIKeyTypePartner).
+		Joins("LEFT JOIN api_keys ON api_usage.key_type = ? AND api_keys.id = api_usage.key_id", models.APIKeyTypeUser).
+		Where("api_usage.hour >= ? AND api_usage.hour < ?", from, to)
+}
+
+// ListReports godoc
+// @Summary List business reports
+// @Description List the predefined reports available from /admin/reports/{name}
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.ReportInfo
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/reports [get]
+func (h *Handler) ListReports(c *fiber.Ctx) error {
+	infos := make([]models.ReportInfo, 0, len(reports))
+	for name, r := range reports {
+		infos = append(infos, models.ReportInfo{Name: name, Description: r.description})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return c.JSON(infos)
+}
+
+// GetReport godoc
+// @Summary Run a business report
+// @Description Run a predefined report over an inclusive date range (default: last 30 days) as JSON or CSV
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json,text/csv
+// @Param name path string true "Report name"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} models.ReportResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/reports/{name} [get]
+func (h *Handler) GetReport(c *fiber.Ctx) error {
+	result, err := h.runReport(c)
+	if err != nil {
+		return err
+	}
+
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, reportFilename(result)))
+		return writeReportCSV(c, result)
+	}
+	return c.JSON(result)
+}
+
+// ExportReport godoc
+// @Summary Export a business report
+// @Description Queue a predefined report over an inclusive date range (default: last 30 days) to be stored as CSV. Poll GET /admin/jobs/{id} until the job has succeeded; its result is a models.ReportExportResponse with a download link valid for 15 minutes. Suits reports too slow to wait for in the browser or to be passed on by link.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param name path string true "Report name"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 202 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/reports/{name}/exports [post]
+func (h *Handler) ExportReport(c *fiber.Ctx) error {
+	req, err := parseReportRequest(c)
+	if err != nil {
+		return err
+	}
+	job, err := jobs.Enqueue(c.UserContext(), jobReportExport, req)
+	if err != nil {
+		log.Printf("[reports] queueing export of %s failed: %v", req.Report, err)
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Failed to queue export")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// exportReport is the report.export job. It runs the report, stores it as
+// CSV and returns a models.ReportExportResponse linking to it.
+func (h *Handler) exportReport(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var req reportRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	result, err := req.run(h.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeReportCSV(&buf, result); err != nil {
+		return nil, err
+	}
+	// The random part keeps links to one export from guessing another
+	key := fmt.Sprintf("reports/%s/%s", strings.ToLower(rand.Text()[:16]), reportFilename(result))
+	if err := h.storage.Put(ctx, key, "text/csv; charset=utf-8", &buf, int64(buf.Len())); err != nil {
+		return nil, fmt.Errorf("storing %s: %w", key, err)
+	}
+	link, err := h.storage.PresignedURL(key, reportExportTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ReportExportResponse{
+		Report:    result.Report,
+		From:      result.From,
+		To:        result.To,
+		URL:       link,
+		ExpiresAt: time.Now().Add(reportExportTTL).Truncate(time.Second),
+	}, nil
+}
+
+// reportRequest is a report to run over the inclusive range of dates From
+// to To.
+type reportRequest struct {
+	Report string `json:"report"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// runReport runs the report named in the path over the from and to query
+// parameters.
+func (h *Handler) runReport(c *fiber.Ctx) (models.ReportResponse, error) {
+	req, err := parseReportRequest(c)
+	if err != nil {
+		return models.ReportResponse{}, err
+	}
+	return req.run(h.db.WithContext(c.UserContext()))
+}
+
+// parseReportRequest checks the report named in the path and the from and
+// to query parameters.
+func parseReportRequest(c *fiber.Ctx) (reportRequest, error) {
+	name := c.Params("name")
+	if _, ok := reports[name]; !ok {
+		return reportRequest{}, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Report not found")
+	}
+
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		return reportRequest{}, err
+	}
+
+	return reportRequest{
+		Report: name,
+		From:   from.Format(reportDateLayout),
+		To:     to.Format(reportDateLayout),
+	}, nil
+}
+
+// parseDateRange parses the inclusive range of UTC days in the from and to
+// query parameters, which defaults to the last 30 days.
+func parseDateRange(c *fiber.Ctx) (from, to time.Time, err error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, err = parseReportDate(c.Query("from"), today.AddDate(0, 0, -29))
+	if err != nil {
+		return from, to, models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Invalid from date, expected YYYY-MM-DD")
+	}
+	to, err = parseReportDate(c.Query("to"), today)
+	if err != nil {
+		return from, to, models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Invalid to date, expected YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return from, to, models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "to must not be before from")
+	}
+	return from, to, nil
+}
+
+func (req reportRequest) run(db *gorm.DB) (models.ReportResponse, error) {
+	r, ok := reports[req.Report]
+	if !ok {
+		return models.ReportResponse{}, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Report not found")
+	}
+	from, err := time.Parse(reportDateLayout, req.From)
+	if err != nil {
+		return models.ReportResponse{}, err
+	}
+	to, err := time.Parse(reportDateLayout, req.To)
+	if err != nil {
+		return models.ReportResponse{}, err
+	}
+
+	rows, err := r.run(db, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("[reports] %s failed: %v", req.Report, err)
+		return models.ReportResponse{}, models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to run report")
+	}
+
+	return models.ReportResponse{
+		Report:  req.Report,
+		From:    req.From,
+		To:      req.To,
+		Columns: r.columns,
+		Rows:    rows,
+	}, nil
+}
+
+func parseReportDate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse(reportDateLayout, value)
+}
+
+func reportFilename(result models.ReportResponse) string {
+	return fmt.Sprintf("%s_%s_%s.csv", result.Report, result.From, result.To)
+}
+
+func writeReportCSV(out io.Writer, result models.ReportResponse) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(result.Columns); err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		record := make([]string, len(result.Columns))
+		for i, column := range result.Columns {
+			record[i] = fmt.Sprint(row[column])
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/thumbnail"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// adminRewardPages are the sort keys of GET /admin/rewards.
+var adminRewardPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "name": "name", "cost": "cost", "stock": "stock"},
+	DefaultSort: "id",
+}
+
+// adminRedemptionPages are the sort and filter keys of GET /admin/redemptions.
+var adminRedemptionPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"status":    "status",
+		"user_id":   "user_id",
+		"reward_id": "reward_id",
+		"code":      "code",
+	},
+}
+
+var errRedemptionClosed = errors.New("redemption is not pending")
+
+// rewardImageSize is the largest width and height of stored reward images
+// in pixels.
+const rewardImageSize = 800
+
+// AdminListRewards godoc
+// @Summary List all rewards
+// @Description List the rewards catalog including inactive rewards
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param sort query string false "id, name, cost or stock, - for descending (default id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Rewards per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Reward}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards [get]
+func (h *Handler) AdminListRewards(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, adminRewardPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Reward](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateReward godoc
+// @Summary Create a reward
+// @Description Add a reward to the catalog. Rewards are active unless active is false. image_url references an image hosted elsewhere, e.g. on the CDN; PUT /admin/rewards/{id}/image uploads one instead.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param reward body models.CreateRewardRequest true "Reward"
+// @Success 201 {object} models.Reward
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards [post]
+func (h *Handler) CreateReward(c *fiber.Ctx) error {
+	var req models.CreateRewardRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	item := models.Reward{
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		ImageURL:    strings.TrimSpace(req.ImageURL),
+		Cost:        req.Cost,
+		Stock:       req.Stock,
+		Active:      req.Active == nil || *req.Active,
+	}
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "reward.create",
+			Resource:   "rewards",
+			ResourceID: item.ID,
+			Fields:     []string{"name", "description", "image_url", "cost", "stock", "active"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// GetReward godoc
+// @Summary Get a reward
+// @Description Get one reward of the catalog, active or not
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Reward ID"
+// @Success 200 {object} models.Reward
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards/{id} [get]
+func (h *Handler) GetReward(c *fiber.Ctx) error {
+	var item models.Reward
+	if err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reward not found")
+	}
+
+	return c.JSON(item)
+}
+
+// UpdateReward godoc
+// @Summary Update a reward
+// @Description Change a reward's name, description, image, cost, stock or active flag; only fields present in the body are changed. Deactivating hides the reward from the catalog and stops redemptions. Pending redemptions keep the cost they were redeemed at.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Reward ID"
+// @Param reward body models.UpdateRewardRequest true "Fields to change"
+// @Success 200 {object} models.Reward
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards/{id} [patch]
+func (h *Handler) UpdateReward(c *fiber.Ctx) error {
+	var req models.UpdateRewardRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var item models.Reward
+	err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reward not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	var changed []string
+	if req.Name != nil {
+		item.Name = strings.TrimSpace(*req.Name)
+		if item.Name == "" {
+			return models.NewValidationError("Invalid reward", map[string]string{"name": "cannot be cleared"})
+		}
+		updates["name"] = item.Name
+		changed = append(changed, "name")
+	}
+	if req.Description != nil {
+		item.Description = strings.TrimSpace(*req.Description)
+		updates["description"] = item.Description
+		changed = append(changed, "description")
+	}
+	// An uploaded image is deleted once the new URL is saved
+	var previousImage string
+	if req.ImageURL != nil {
+		imageURL := strings.TrimSpace(*req.ImageURL)
+		if imageURL != item.ImageURL {
+			previousImage, item.ImageKey = item.ImageKey, ""
+			updates["image_key"] = ""
+		}
+		item.ImageURL = imageURL
+		updates["image_url"] = item.ImageURL
+		changed = append(changed, "image_url")
+	}
+	if req.Cost != nil {
+		item.Cost = *req.Cost
+		updates["cost"] = item.Cost
+		changed = append(changed, "cost")
+	}
+	if req.Stock != nil {
+		item.Stock = *req.Stock
+		updates["stock"] = item.Stock
+		changed = append(changed, "stock")
+	}
+	if req.Active != nil {
+		item.Active = *req.Active
+		updates["active"] = item.Active
+		changed = append(changed, "active")
+	}
+	if len(updates) == 0 {
+		return c.JSON(item)
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "reward.update",
+			Resource:   "rewards",
+			ResourceID: item.ID,
+			Fields:     changed,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	h.deleteStoredFile(previousImage)
+
+	return c.JSON(item)
+}
+
+// UploadRewardImage godoc
+// @Summary Upload a reward image
+// @Description Set a reward's image from a JPEG, PNG or GIF of up to 2 MB, sent as the image field of a multipart form. It is scaled down to fit 800×800 and stored as JPEG; image_url links to it. A previously uploaded image is deleted.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Reward ID"
+// @Param image formData file true "Image"
+// @Success 200 {object} models.Reward
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards/{id}/image [put]
+func (h *Handler) UploadRewardImage(c *fiber.Ctx) error {
+	var item models.Reward
+	err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reward not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	img, err := uploadedImage(c, "image")
+	if err != nil {
+		return err
+	}
+	data, err := thumbnail.JPEG(thumbnail.Fit(img, rewardImageSize))
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("rewards/%d/%s.jpg", item.ID, strings.ToLower(rand.Text()[:16]))
+	if err := h.storage.Put(c.UserContext(), key, "image/jpeg", bytes.NewReader(data), int64(len(data))); err != nil {
+		log.Printf("[rewards] storing %s failed: %v", key, err)
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Failed to store image")
+	}
+
+	previous := item.ImageKey
+	item.ImageURL = h.storage.URL(key)
+	item.ImageKey = key
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&item).Updates(map[string]interface{}{"image_url": item.ImageURL, "image_key": item.ImageKey}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "reward.update",
+			Resource:   "rewards",
+			ResourceID: item.ID,
+			Fields:     []string{"image_url"},
+		}).Error
+	})
+	if err != nil {
+		h.deleteStoredFile(key)
+		return err
+	}
+	h.deleteStoredFile(previous)
+
+	return c.JSON(item)
+}
+
+// DeleteReward godoc
+// @Summary Delete a reward
+// @Description Remove a reward from the catalog. It is soft-deleted and can be restored from /admin/trash/rewards; existing redemptions are kept.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Reward ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/rewards/{id} [delete]
+func (h *Handler) DeleteReward(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidID, "Invalid ID")
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := database.SoftDelete(tx, "rewards", uint(id)); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "reward.delete",
+			Resource:   "rewards",
+			ResourceID: uint(id),
+			Fields:     []string{"deleted_at"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reward not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reward deleted",
+	})
+}
+
+// AdminListRedemptions godoc
+// @Summary List redemptions
+// @Description List reward redemptions of all members, newest first. Filter by code to look up the redemption a member shows.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[status] query string false "pending, fulfilled or cancelled"
+// @Param filter[user_id] query int false "Member"
+// @Param filter[reward_id] query int false "Reward"
+// @Param filter[code] query string false "Collection code, e.g. RD7K3QMX2P"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Redemptions per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Redemption}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/redemptions [get]
+func (h *Handler) AdminListRedemptions(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, adminRedemptionPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Redemption](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// UpdateRedemption godoc
+// @Summary Fulfil or cancel a redemption
+// @Description Move a pending redemption to fulfilled once the member has the reward, or to cancelled, which refunds its points and returns the item to stock. Redemptions that are no longer pending cannot change. The member is told in the notification center and by push.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Redemption ID"
+// @Param redemption body models.UpdateRedemptionRequest true "New status"
+// @Success 200 {object} models.Redemption
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/redemptions/{id} [patch]
+func (h *Handler) UpdateRedemption(c *fiber.Ctx) error {
+	var req models.UpdateRedemptionRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var redemption models.Redemption
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&redemption, c.Params("id")).Error
+		if err != nil {
+			return err
+		}
+		if redemption.Status != models.RedemptionPending {
+			return errRedemptionClosed
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": req.Status}
+		if req.Status == models.RedemptionFulfilled {
+			updates["fulfilled_at"] = now
+		} else {
+			updates["cancelled_at"] = now
+			user := models.User{ID: redemption.UserID}
+			_, err := points.Post(tx, &user, models.PointTransaction{
+				Type:      models.PointTransactionAdjust,
+				Amount:    redemption.Points,
+				Reason:    "Refund: " + redemption.RewardName,
+				Reference: fmt.Sprintf("redemption:%d", redemption.ID),
+			})
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&models.Reward{}).Where("id = ?", redemption.RewardID).
+				Update("stock", gorm.Expr("stock + 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&redemption).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "redemption." + req.Status,
+			Resource:   "redemptions",
+			ResourceID: redemption.ID,
+			Fields:     []string{"status"},
+		}).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Redemption not found")
+	case errors.Is(err, errRedemptionClosed):
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Redemption is already "+redemption.Status)
+	case err != nil:
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to update redemption")
+	}
+	if req.Status != models.RedemptionFulfilled {
+		h.cache.InvalidateUser(c.UserContext(), redemption.UserID)
+	}
+
+	h.notifyRedemption(c, &redemption, req.Status)
+	return c.JSON(redemption)
+}
+
+// notifyRedemption tells the member that their redemption moved to status,
+// in the notification center and by push. Failures are only logged.
+func (h *Handler) notifyRedemption(c *fiber.Ctx, redemption *models.Redemption, status string) {
+	db := h.db.WithContext(c.UserContext())
+	var user models.User
+	if err := db.First(&user, redemption.UserID).Error; err != nil {
+		return
+	}
+
+	title := "Enjoy your reward"
+	body := fmt.Sprintf("Your %s has been handed over. Thank you for redeeming your points.", redemption.RewardName)
+	if status == models.RedemptionCancelled {
+		title = "Redemption cancelled"
+		body = fmt.Sprintf("Your redemption of %s was cancelled and its %d points are back in your balance.", redemption.RewardName, redemption.Points)
+	}
+
+	if err := notify.Inbox(db, user.ID, models.NotificationCategoryAccount, title, body); err != nil {
+		middleware.Logf(c, "[rewards] redemption notification for user %d not created: %v", user.ID, err)
+	}
+	if _, err := h.notify.Push(h.db.WithContext(c.UserContext()), &user, models.NotificationCategoryAccount, title, body); err != nil {
+		middleware.Logf(c, "[rewards] redemption push for user %d not sent: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/saga"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// sagaPages are the sort and filter keys of GET /admin/sagas.
+var sagaPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "updated_at": "updated_at", "next_attempt_at": "next_attempt_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"status":  "status",
+		"kind":    "kind",
+		"user_id": "user_id",
+	},
+}
+
+// ListSagas godoc
+// @Summary List sagas
+// @Description List the sagas running multi-step work such as redemptions. stuck=true lists those needing attention: sagas whose compensation gave up (failed) and running or compensating sagas whose current step has failed before and waits to be tried again.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param stuck query bool false "Only failed sagas and those retrying a step"
+// @Param filter[status] query string false "running, completed, compensating, compensated or failed"
+// @Param filter[kind] query string false "redemption"
+// @Param filter[user_id] query int false "Member the saga runs for"
+// @Param sort query string false "id, updated_at or next_attempt_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Sagas per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Saga}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/sagas [get]
+func (h *Handler) ListSagas(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, sagaPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext())
+	if c.QueryBool("stuck") {
+		query = query.Where("status = ? OR (status IN ? AND attempts > 0)",
+			models.SagaFailed, []string{models.SagaRunning, models.SagaCompensating})
+	}
+
+	page, err := pagination.Find[models.Saga](query, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// GetSaga godoc
+// @Summary Get a saga
+// @Description Return a saga with the step it is on, its last error and its state
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Saga ID"
+// @Success 200 {object} models.Saga
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/sagas/{id} [get]
+func (h *Handler) GetSaga(c *fiber.Ctx) error {
+	s, err := h.loadSaga(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(s)
+}
+
+// RetrySaga godoc
+// @Summary Retry a saga now
+// @Description Run a running or compensating saga's current step now, with its attempts started over. A failed saga resumes undoing its steps.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Saga ID"
+// @Success 200 {object} models.Saga
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/sagas/{id}/retry [post]
+func (h *Handler) RetrySaga(c *fiber.Ctx) error {
+	s, err := h.loadSaga(c)
+	if err != nil {
+		return err
+	}
+
+	err = saga.Retry(c.UserContext(), h.db, h.sagaRunner(s.Kind), s)
+	return h.sagaTaken(c, s, "saga.retry", err)
+}
+
+// CompensateSaga godoc
+// @Summary Undo a running saga
+// @Description Give up on a running saga, e.g. one waiting on a step that will not succeed: its steps are undone now, for a redemption by giving back the points and stock and failing the redemption.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Saga ID"
+// @Param compensation body models.CompensateSagaRequest true "Why the saga is undone"
+// @Success 200 {object} models.Saga
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/sagas/{id}/compensate [post]
+func (h *Handler) CompensateSaga(c *fiber.Ctx) error {
+	var req models.CompensateSagaRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	s, err := h.loadSaga(c)
+	if err != nil {
+		return err
+	}
+
+	err = saga.Compensate(c.UserContext(), h.db, h.sagaRunner(s.Kind), s, req.Reason)
+	return h.sagaTaken(c, s, "saga.compensate", err)
+}
+
+// loadSaga loads the saga of the :id parameter, of a kind the handlers run.
+func (h *Handler) loadSaga(c *fiber.Ctx) (*models.Saga, error) {
+	var s models.Saga
+	err := h.db.WithContext(c.UserContext()).First(&s, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && h.sagaRunner(s.Kind) == nil) {
+		return nil, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Saga not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// sagaTaken answers an admin action on s, which returned err. Errors of the
+// saga's steps are recorded in it, so only a saga the action did not apply
+// to fails the request.
+func (h *Handler) sagaTaken(c *fiber.Ctx, s *models.Saga, action string, err error) error {
+	switch {
+	case errors.Is(err, saga.ErrNotWaiting):
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Saga is "+s.Status)
+	case errors.Is(err, saga.ErrTaken):
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Saga is being run, try again")
+	case err != nil:
+		middleware.Logf(c, "[saga] %s %d after %s: %v", s.Kind, s.ID, action, err)
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	if err := db.Create(&models.AuditLog{
+		Actor:      auditActor(c),
+		Action:     action,
+		Resource:   "sagas",
+		ResourceID: s.ID,
+	}).Error; err != nil {
+		return err
+	}
+	h.cache.InvalidateUser(c.UserContext(), s.UserID)
+	if err := db.First(s, s.ID).Error; err != nil {
+		return err
+	}
+	return c.JSON(s)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scheduledRunPages are the sort and filter keys of GET /admin/schedules/runs.
+var scheduledRunPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "due_at": "due_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"job":    "job",
+		"status": "status",
+	},
+}
+
+// ListSchedules godoc
+// @Summary List recurring jobs
+// @Description List the jobs the scheduler runs, such as points.expire and tiers.recalculate, with their cron expression, when each is due next and its latest run. Jobs that are off in the configuration are not listed.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.RecurringJob
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/schedules [get]
+func (h *Handler) ListSchedules(c *fiber.Ctx) error {
+	jobs, err := scheduler.Jobs(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(jobs)
+}
+
+// GetScheduleLeader godoc
+// @Summary Show the scheduler's leader
+// @Description Show the instance that runs the scheduled jobs, with when it took the lease and when the lease runs out unless renewed, and whether the instance answering is that leader. The lease is null while no instance holds one, for up to 40 seconds after a leader dies.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.SchedulerLeader
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/schedules/leader [get]
+func (h *Handler) GetScheduleLeader(c *fiber.Ctx) error {
+	leader, err := scheduler.Leader(c.UserContext(), h.db)
+	if err != nil {
+		return err
+	}
+	return c.JSON(leader)
+}
+
+// ListScheduledRuns godoc
+// @Summary List runs of recurring jobs
+// @Description List the due times of the recurring jobs, newest first, with the instance that claimed each, its background job and the outcome of the latest attempt. Runs are kept for 30 days.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[job] query string false "Recurring job, e.g. points.expire"
+// @Param filter[status] query string false "claimed, queued, running, succeeded or failed"
+// @Param sort query string false "id or due_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Runs per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.ScheduledRun}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/schedules/runs [get]
+func (h *Handler) ListScheduledRuns(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, scheduledRunPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.ScheduledRun](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
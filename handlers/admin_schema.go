@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSchema godoc
+// @Summary Get the schema version
+// @Description Show the migration the database is at, the newest one this build has, the pending migrations and every migration with when it was applied. drift lists tables and columns of the models the database lacks. Migrations are applied with the migrate command, not through the API.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.SchemaStatus
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/schema [get]
+func (h *Handler) GetSchema(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	states, err := database.MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	drift, err := database.SchemaDrift(db)
+	if err != nil {
+		return err
+	}
+
+	status := models.SchemaStatus{
+		Driver:     db.Dialector.Name(),
+		Pending:    []models.SchemaMigration{},
+		Migrations: make([]models.SchemaMigration, len(states)),
+		Drift:      drift,
+	}
+	if status.Drift == nil {
+		status.Drift = []string{}
+	}
+	for i, state := range states {
+		migration := models.SchemaMigration{
+			Version:   state.Version,
+			Name:      state.Name,
+			AppliedAt: state.AppliedAt,
+			Unknown:   state.Unknown,
+		}
+		status.Migrations[i] = migration
+		if !state.Unknown {
+			status.Latest = state.Version
+		}
+		if state.AppliedAt != nil {
+			status.Version = state.Version
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return c.JSON(status)
+}
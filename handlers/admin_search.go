@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/search"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxSearchResults caps the results of GET /admin/search per resource
+// type.
+const maxSearchResults = 20
+
+// likeEscaper escapes the wildcards of LIKE in user input, for patterns
+// compared with ESCAPE '!'. The escape character is not a backslash
+// because MySQL reads one in a string literal as an escape of its own.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// containsPattern is a LIKE pattern matching s anywhere, with the
+// wildcards in s matched literally.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// AdminSearch godoc
+// @Summary Search users and transactions
+// @Description Find users by partial name (including Thai), email, membership ID or phone number fragment, and points transactions by reason, reference or ID, through the search index. Every word of q must match; words of 4 or more characters with a letter tolerate a typo, or two from 8 characters, so "jonh" finds John. Phone numbers match however they are typed, with or without dashes, spaces, +66 or the leading 0. Closer matches come first, words found as typed ahead of typos, with up to 20 users and 20 transactions.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param q query string true "Search text (at least 2 characters)"
+// @Success 200 {object} models.SearchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/search [get]
+func (h *Handler) AdminSearch(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 2 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Query must be at least 2 characters long")
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	hits, err := h.search.Search(db, q, 2*maxSearchResults)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Search failed").Wrap(err)
+	}
+	ids := map[string][]uint{}
+	for _, hit := range hits {
+		if len(ids[hit.Kind]) < maxSearchResults {
+			ids[hit.Kind] = append(ids[hit.Kind], hit.ID)
+		}
+	}
+
+	users, err := searchUsers(db, ids[search.KindUser])
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Search failed").Wrap(err)
+	}
+	transactions, err := searchTransactions(db, ids[search.KindTransaction])
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Search failed").Wrap(err)
+	}
+
+	return c.JSON(models.SearchResponse{
+		Query:   q,
+		Results: append(users, transactions...),
+	})
+}
+
+// searchUsers returns the results of the users with ids, in their order.
+// Users deleted since they were indexed are left out.
+func searchUsers(db *gorm.DB, ids []uint) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	if len(ids) == 0 {
+		return results, nil
+	}
+	var users []models.User
+	if err := db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	for _, id := range ids {
+		user, ok := byID[id]
+		if !ok {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			Type:     search.KindUser,
+			ID:       user.ID,
+			Title:    user.FirstName + " " + user.LastName,
+			Subtitle: user.Email + " · " + user.MembershipID,
+		})
+	}
+	return results, nil
+}
+
+// searchTransactions returns the results of the points transactions with
+// ids, in their order, with their member's membership ID.
+func searchTransactions(db *gorm.DB, ids []uint) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	if len(ids) == 0 {
+		return results, nil
+	}
+	var rows []struct {
+		models.PointTransaction
+		MembershipID string
+	}
+	err := db.Model(&models.PointTransaction{}).
+		Select("point_transactions.*, users.membership_id").
+		Joins("JOIN users ON users.id = point_transactions.user_id").
+		Where("point_transactions.id IN ?", ids).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]int, len(rows))
+	for i, row := range rows {
+		byID[row.ID] = i
+	}
+
+	for _, id := range ids {
+		i, ok := byID[id]
+		if !ok {
+			continue
+		}
+		row := rows[i]
+		results = append(results, models.SearchResult{
+			Type:     search.KindTransaction,
+			ID:       row.ID,
+			UserID:   row.UserID,
+			Title:    fmt.Sprintf("%+d points · %s", row.Amount, row.Reason),
+			Subtitle: row.MembershipID + " · " + row.CreatedAt.UTC().Format("2006-01-02 15:04"),
+		})
+	}
+	return results, nil
+}
+
+// userSearchCondition matches users by partial name, email, membership ID or
+// phone fragment. It is a group condition, so it can be combined with other
+// filters.
+func (h *Handler) userSearchCondition(q string) *gorm.DB {
+	like := containsPattern(strings.ToLower(q))
+
+	// CONCAT rather than ||, which MySQL reads as OR
+	cond := h.db.Where(
+		"LOWER(email) LIKE @like ESCAPE '!' OR LOWER(first_name) LIKE @like ESCAPE '!' OR LOWER(last_name) LIKE @like ESCAPE '!' OR "+
+			"LOWER(CONCAT(first_name, ' ', last_name)) LIKE @like ESCAPE '!' OR LOWER(membership_id) LIKE @like ESCAPE '!'",
+		sql.Named("like", like),
+	)
+	if digits := digitsOnly(q); len(digits) >= 3 {
+		// Phones are stored as E.164, so a local "08..." fragment is also
+		// matched against the "+668..." form
+		cond = cond.Or("REPLACE(REPLACE(REPLACE(phone, '-', ''), ' ', ''), '+', '') LIKE ?", "%"+digits+"%")
+		if strings.HasPrefix(digits, "0") {
+			cond = cond.Or("phone LIKE ?", "+66"+digits[1:]+"%")
+		}
+	}
+	return cond
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestAdminSearch(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	admin := testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin })
+	auth := testutil.AuthHeader(t, admin)
+
+	somchai := testutil.CreateUser(t, db, testutil.WithEmail("somchai_k@example.com"), func(u *models.User) {
+		u.FirstName, u.LastName = "Somchai", "Jaidee"
+	})
+	percent := testutil.CreateUser(t, db, testutil.WithEmail("somchaiXk@example.com"), func(u *models.User) {
+		u.FirstName, u.LastName = "Napat", "100% Sure"
+	})
+	testutil.CreateUser(t, db, func(u *models.User) { u.FirstName, u.LastName = "Mile", "1000" })
+	john := testutil.CreateUser(t, db, func(u *models.User) {
+		u.FirstName, u.LastName, u.Phone = "John", "Smith", "+66891112233"
+	})
+	malee := testutil.CreateUser(t, db, func(u *models.User) { u.FirstName, u.LastName = "มาลี", "สมชาย" })
+	transaction := models.PointTransaction{ID: 90417, UserID: somchai.ID, Type: "earn", Amount: 120, BalanceAfter: 120, Reason: "Coffee at Café Amazon", Reference: "pos:ORDER-7781"}
+	if err := db.Create(&transaction).Error; err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+
+	user := func(u models.User) string { return fmt.Sprintf("user:%d", u.ID) }
+	tx := fmt.Sprintf("transaction:%d", transaction.ID)
+	tests := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		{name: "full name across columns", q: "somchai jai", want: []string{user(somchai)}},
+		{name: "exact match first", q: "somchai_k", want: []string{user(somchai), user(percent)}},
+		{name: "percent is literal", q: "100%", want: []string{user(percent)}},
+		{name: "transaction reason", q: "café amazon", want: []string{tx}},
+		{name: "transaction reference", q: "order-7781", want: []string{tx}},
+		{name: "transaction ID", q: fmt.Sprint(transaction.ID), want: []string{tx}},
+		{name: "swapped letters", q: "somhcai", want: []string{user(somchai), user(percent)}},
+		{name: "typo", q: "jonh", want: []string{user(john)}},
+		{name: "typo in a short word", q: "jhn", want: nil},
+		{name: "Thai fragment", q: "มาล", want: []string{user(malee)}},
+		{name: "Thai typo", q: "สมชัย", want: []string{user(malee)}},
+		{name: "no typos in numbers", q: "1001", want: nil},
+		{name: "local phone number", q: "089-111", want: []string{user(john)}},
+		{name: "international phone number", q: "+66 89 111 2233", want: []string{user(john)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/admin/search?q="+url.QueryEscape(tt.q), "", auth)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var resp models.SearchResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			var got []string
+			for _, result := range resp.Results {
+				key := fmt.Sprintf("%s:%d", result.Type, result.ID)
+				if key != user(admin) {
+					got = append(got, key)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("results %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAdminSearchSync checks that the index follows the users as they are
+// changed and deleted.
+func TestAdminSearchSync(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	auth := testutil.AuthHeader(t, testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin }))
+	member := testutil.CreateUser(t, db, func(u *models.User) { u.FirstName, u.LastName = "Napat", "Wong" })
+
+	find := func(q string) int {
+		t.Helper()
+		status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/admin/search?q="+url.QueryEscape(q), "", auth)
+		if status != http.StatusOK {
+			t.Fatalf("search %q: status %d: %s", q, status, body)
+		}
+		var resp models.SearchResponse
+		json.Unmarshal([]byte(body), &resp)
+		return len(resp.Results)
+	}
+
+	path := fmt.Sprintf("/api/v1/admin/users/%d", member.ID)
+	if status, body := testutil.Request(t, app, http.MethodPatch, path, `{"update_mask":["last_name"],"user":{"last_name":"Srisuk"}}`, auth); status != http.StatusOK {
+		t.Fatalf("update: status %d: %s", status, body)
+	}
+	if n := find("wong"); n != 0 {
+		t.Errorf("old name found %d results", n)
+	}
+	if n := find("srisuk"); n != 1 {
+		t.Errorf("new name found %d results, want 1", n)
+	}
+
+	if status, body := testutil.Request(t, app, http.MethodDelete, path, "", auth); status != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", status, body)
+	}
+	if n := find("srisuk"); n != 0 {
+		t.Errorf("deleted user found %d results", n)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/points"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// errRollback aborts the self-test transaction after its checks have run.
+var errRollback = errors.New("selftest rollback")
+
+// SelfTest godoc
+// @Summary Run post-deploy self-test
+// @Description Run a scripted check of critical paths against this instance: register a throwaway user, log in, read the profile, and earn and redeem points in a rolled-back transaction. The throwaway user is deleted afterwards.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.SelfTestResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 503 {object} models.SelfTestResponse
+// @Router /api/v1/admin/selftest [get]
+func (h *Handler) SelfTest(c *fiber.Ctx) error {
+	email := fmt.Sprintf("selftest-%s@selftest.invalid", uuid.NewString())
+	password := uuid.NewString()
+
+	var token string
+	var userID uint
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"register", func() error {
+			body := fmt.Sprintf(`{"email":%q,"password":%q,"first_name":"Self","last_name":"Test"}`, email, password)
+			var resp models.AuthResponse
+			if err := selfTestRequest(c.App(), fiber.MethodPost, "/api/v1/auth/register", body, "", fiber.StatusCreated, &resp); err != nil {
+				return err
+			}
+			userID = resp.User.ID
+			// Skip the emailed link so REQUIRE_EMAIL_VERIFICATION does not
+			// block the later steps
+			return h.db.WithContext(c.UserContext()).Model(&models.User{}).Where("id = ?", userID).Update("email_verified_at", time.Now()).Error
+		}},
+		{"login", func() error {
+			body := fmt.Sprintf(`{"email":%q,"password":%q}`, email, password)
+			var resp models.AuthResponse
+			if err := selfTestRequest(c.App(), fiber.MethodPost, "/api/v1/auth/login", body, "", fiber.StatusOK, &resp); err != nil {
+				return err
+			}
+			token = resp.Token
+			return nil
+		}},
+		{"read_profile", func() error {
+			var resp models.ProfileResponse
+			if err := selfTestRequest(c.App(), fiber.MethodGet, "/api/v1/profile", "", token, fiber.StatusOK, &resp); err != nil {
+				return err
+			}
+			if resp.User.Email != email {
+				return fmt.Errorf("profile returned %q, want %q", resp.User.Email, email)
+			}
+			return nil
+		}},
+		{"earn_and_redeem_points", func() error {
+			return h.selfTestPoints(userID)
+		}},
+	}
+
+	result := models.SelfTestResponse{Passed: true}
+	for _, step := range steps {
+		started := time.Now()
+		err := step.run()
+
+		outcome := models.SelfTestStep{
+			Name:       step.name,
+			Passed:     err == nil,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		if err != nil {
+			outcome.Error = err.Error()
+			result.Passed = false
+		}
+		result.Steps = append(result.Steps, outcome)
+
+		// Later steps depend on earlier ones
+		if err != nil {
+			break
+		}
+	}
+
+	err := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Delete(&models.CampaignAward{}).Error
+	if err == nil {
+		err = h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Delete(&models.EmailVerification{}).Error
+	}
+	if err == nil {
+		err = h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+	}
+	if err == nil {
+		err = h.db.WithContext(c.UserContext()).Unscoped().Where("email = ?", email).Delete(&models.User{}).Error
+	}
+	if err != nil {
+		result.Passed = false
+		result.Steps = append(result.Steps, models.SelfTestStep{Name: "cleanup", Error: err.Error()})
+	}
+
+	status := fiber.StatusOK
+	if !result.Passed {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(result)
+}
+
+// selfTestRequest sends a request through the app's full middleware and
+// routing stack without going over the network.
+func selfTestRequest(app *fiber.App, method, path, body, token string, wantStatus int, out interface{}) error {
+	req := httptest.NewRequest(method, middleware.BasePath()+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := app.Test(req, 10000)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, respBody)
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// selfTestPoints credits and debits points inside a transaction that is
+// always rolled back.
+func (h *Handler) selfTestPoints(userID uint) error {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		start := user.Points
+
+		earn := models.PointTransaction{Type: models.PointTransactionEarn, Amount: 100, Reason: "Self-test"}
+		if _, err := points.Post(tx, &user, earn); err != nil {
+			return fmt.Errorf("earn: %w", err)
+		}
+		redeem := models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -100, Reason: "Self-test"}
+		if _, err := points.Post(tx, &user, redeem); err != nil {
+			return fmt.Errorf("redeem: %w", err)
+		}
+
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.Points != start {
+			return fmt.Errorf("balance is %d after earn and redeem, want %d", user.Points, start)
+		}
+
+		return errRollback
+	})
+	if errors.Is(err, errRollback) {
+		return nil
+	}
+	return err
+}
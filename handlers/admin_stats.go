@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/shard"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// statsTimeout bounds how long GET /admin/stats waits for a shard; the
+// shards that take longer are reported as failed.
+const statsTimeout = 5 * time.Second
+
+// GetStats godoc
+// @Summary Show loyalty program statistics
+// @Description Count the members, by tier, the points they hold and the points earned and redeemed in the last 30 days, in each tenant's shard and in total. The shards are read at once; one that cannot be read within 5 seconds is listed with its error and left out of the total, and partial is set.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param tenant query string false "Only this tenant's shard"
+// @Success 200 {object} models.AdminStats
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/stats [get]
+func (h *Handler) GetStats(c *fiber.Ctx) error {
+	shards := h.shards
+	if tenant := c.Query("tenant"); tenant != "" {
+		s, err := shards.For(tenant)
+		if err != nil {
+			return err
+		}
+		shards = shard.New(s)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), statsTimeout)
+	defer cancel()
+
+	tenants, errs := shard.Gather(ctx, shards, func(ctx context.Context, s *shard.Shard) (models.TenantStats, error) {
+		return tenantStats(s.DB.WithContext(ctx))
+	})
+
+	result := models.AdminStats{
+		Total:   models.TenantStats{MembersByTier: map[string]int64{}},
+		Tenants: tenants,
+	}
+	for i, s := range shards.Shards() {
+		stats := &result.Tenants[i]
+		if errs[i] != nil {
+			*stats = models.TenantStats{Tenant: s.Tenant, MembersByTier: map[string]int64{}, Error: errs[i].Error()}
+			result.Partial = true
+			continue
+		}
+		stats.Tenant = s.Tenant
+		result.Total.Members += stats.Members
+		result.Total.Points += stats.Points
+		result.Total.PointsEarned += stats.PointsEarned
+		result.Total.PointsRedeemed += stats.PointsRedeemed
+		for tier, n := range stats.MembersByTier {
+			result.Total.MembersByTier[tier] += n
+		}
+	}
+	return c.JSON(result)
+}
+
+// tenantStats reads the figures of one shard.
+func tenantStats(db *gorm.DB) (models.TenantStats, error) {
+	stats := models.TenantStats{MembersByTier: map[string]int64{}}
+	members := db.Model(&models.User{}).Where("role = ?", models.RoleMember)
+
+	var tiers []struct {
+		MemberLevel string
+		Members     int64
+		Points      int64
+	}
+	err := members.Select("member_level, COUNT(*) AS members, COALESCE(SUM(points), 0) AS points").
+		Group("member_level").Scan(&tiers).Error
+	if err != nil {
+		return stats, err
+	}
+	for _, tier := range tiers {
+		stats.MembersByTier[tier.MemberLevel] = tier.Members
+		stats.Members += tier.Members
+		stats.Points += tier.Points
+	}
+
+	var moved struct {
+		Earned   int64
+		Redeemed int64
+	}
+	err = db.Model(&models.PointTransaction{}).
+		Select("COALESCE(SUM(CASE WHEN type = ? THEN amount END), 0) AS earned, COALESCE(-SUM(CASE WHEN type = ? THEN amount END), 0) AS redeemed",
+			models.PointTransactionEarn, models.PointTransactionRedeem).
+		Where("created_at >= ?", time.Now().AddDate(0, 0, -30)).
+		Scan(&moved).Error
+	if err != nil {
+		return stats, err
+	}
+	stats.PointsEarned, stats.PointsRedeemed = moved.Earned, moved.Redeemed
+	return stats, nil
+}
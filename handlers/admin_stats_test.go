@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/routes"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/testutil"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminStats(t *testing.T) {
+	env := testutil.NewEnv(t)
+	admin := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Role = models.RoleAdmin })
+	member := testutil.CreateUser(t, env.DB, testutil.WithPoints(300))
+	testutil.CreateTransaction(t, env.DB, &member)
+	testutil.CreateTransaction(t, env.DB, &member, testutil.Redeemed(50))
+
+	// Another tenant's shard, and one whose database is gone
+	acme := testutil.NewDB(t)
+	acmeMember := testutil.CreateUser(t, acme, testutil.WithPoints(1000), testutil.WithMemberLevel("Gold"))
+	testutil.CreateTransaction(t, acme, &acmeMember, testutil.WithAmount(500))
+	gone := testutil.NewDB(t)
+	database.Close(gone)
+
+	h := handlers.New(handlers.Deps{
+		DB:     env.DB,
+		Config: env.Config,
+		Shards: shard.New(
+			&shard.Shard{Tenant: "default", DB: env.DB},
+			&shard.Shard{Tenant: "acme", DB: acme},
+			&shard.Shard{Tenant: "gone", DB: gone},
+		),
+	})
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	routes.Setup(app, env.Config, env.DB, h)
+	auth := testutil.AuthHeader(t, admin)
+
+	status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/admin/stats", "", auth)
+	if status != http.StatusOK {
+		t.Fatalf("stats: %d %s", status, body)
+	}
+	var stats models.AdminStats
+	if err := json.Unmarshal([]byte(body), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Tenants) != 3 || !stats.Partial {
+		t.Fatalf("stats = %+v", stats)
+	}
+	home, acmeStats, failed := stats.Tenants[0], stats.Tenants[1], stats.Tenants[2]
+	if home.Tenant != "default" || home.Members != 1 || home.Points != int64(member.Points) || home.PointsEarned != 100 || home.PointsRedeemed != 50 {
+		t.Errorf("default tenant = %+v", home)
+	}
+	if acmeStats.Tenant != "acme" || acmeStats.Members != 1 || acmeStats.MembersByTier["Gold"] != 1 || acmeStats.PointsEarned != 500 {
+		t.Errorf("acme = %+v", acmeStats)
+	}
+	if failed.Tenant != "gone" || failed.Error == "" || failed.Members != 0 {
+		t.Errorf("unreachable shard = %+v", failed)
+	}
+	if total := stats.Total; total.Members != 2 || total.Points != home.Points+acmeStats.Points || total.PointsEarned != 600 || total.PointsRedeemed != 50 {
+		t.Errorf("total = %+v", total)
+	}
+
+	status, body = testutil.Request(t, app, http.MethodGet, "/api/v1/admin/stats?tenant=acme", "", auth)
+	if status != http.StatusOK {
+		t.Fatalf("acme stats: %d %s", status, body)
+	}
+	stats = models.AdminStats{}
+	json.Unmarshal([]byte(body), &stats)
+	if len(stats.Tenants) != 1 || stats.Partial || stats.Total.Members != 1 || stats.Total.PointsEarned != 500 {
+		t.Errorf("acme stats = %+v", stats)
+	}
+
+	status, body = testutil.Request(t, app, http.MethodGet, "/api/v1/admin/stats?tenant=nope", "", auth)
+	if status != http.StatusNotFound {
+		t.Errorf("unknown tenant: %d %s", status, body)
+	}
+
+	status, _ = testutil.Request(t, app, http.MethodGet, "/api/v1/admin/stats", "", testutil.AuthHeader(t, member))
+	if status != http.StatusForbidden {
+		t.Errorf("member: %d, want 403", status)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ListDeletedRecords godoc
+// @Summary List soft-deleted records
+// @Description List soft-deleted rows of a resource type (e.g. users)
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param resource path string true "Resource type, e.g. users"
+// @Success 200 {array} models.DeletedRecord
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/trash/{resource} [get]
+func (h *Handler) ListDeletedRecords(c *fiber.Ctx) error {
+	records, err := database.ListDeleted(h.db.WithContext(c.UserContext()), c.Params("resource"))
+	if err != nil {
+		return trashError(c, err)
+	}
+
+	return c.JSON(records)
+}
+
+// RestoreDeletedRecord godoc
+// @Summary Restore a soft-deleted record
+// @Description Restore a soft-deleted row and the child rows deleted with it
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param resource path string true "Resource type, e.g. users"
+// @Param id path int true "Record ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/trash/{resource}/{id}/restore [post]
+func (h *Handler) RestoreDeletedRecord(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidID, "Invalid ID")
+	}
+
+	if err := database.Restore(h.db.WithContext(c.UserContext()), c.Params("resource"), uint(id)); err != nil {
+		return trashError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Record restored",
+	})
+}
+
+// storedFiles names the column holding the storage key of the file kept for
+// a record of each resource.
+var storedFiles = map[string]struct {
+	model  interface{}
+	column string
+}{
+	"users":   {&models.User{}, "avatar_key"},
+	"rewards": {&models.Reward{}, "image_key"},
+}
+
+// PurgeDeletedRecord godoc
+// @Summary Permanently delete a soft-deleted record
+// @Description Permanently remove a soft-deleted row and all of its child rows
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param resource path string true "Resource type, e.g. users"
+// @Param id path int true "Record ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/trash/{resource}/{id} [delete]
+func (h *Handler) PurgeDeletedRecord(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidID, "Invalid ID")
+	}
+
+	// Stored files of the record are deleted once the rows are gone
+	var fileKey string
+	if file, ok := storedFiles[c.Params("resource")]; ok {
+		h.db.WithContext(c.UserContext()).Unscoped().Model(file.model).Where("id = ?", id).Pluck(file.column, &fileKey)
+	}
+	if err := database.Purge(h.db.WithContext(c.UserContext()), c.Params("resource"), uint(id)); err != nil {
+		return trashError(c, err)
+	}
+	h.deleteStoredFile(fileKey)
+
+	return c.JSON(fiber.Map{
+		"message": "Record permanently deleted",
+	})
+}
+
+func trashError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, database.ErrUnknownResource):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Unknown resource type")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Deleted record not found")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return models.NewAppError(fiber.StatusConflict, models.CodeDuplicateRecord, "An active record with the same unique values already exists")
+	default:
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to update deleted records")
+	}
+}
@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestAdjustUserPoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		balance    int
+	}{
+		{name: "credit", body: `{"amount":250,"reason":"Goodwill credit"}`, wantStatus: http.StatusCreated, balance: 350},
+		{name: "debit", body: `{"amount":-100,"reason":"Duplicate earn"}`, wantStatus: http.StatusCreated, balance: 0},
+		{name: "below zero", body: `{"amount":-101,"reason":"Duplicate earn"}`, wantStatus: http.StatusUnprocessableEntity, wantCode: models.CodeInsufficientPoints, balance: 100},
+		{name: "no reason", body: `{"amount":10,"reason":"  "}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed, balance: 100},
+		{name: "no amount", body: `{"reason":"Goodwill credit"}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed, balance: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := testutil.NewApp(t)
+			admin := testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin })
+			member := testutil.CreateUser(t, db)
+			testutil.CreateTransaction(t, db, &member)
+
+			path := fmt.Sprintf("/api/v1/admin/users/%d/points/adjustments", member.ID)
+			status, resp := testutil.Request(t, app, http.MethodPost, path, tt.body, testutil.AuthHeader(t, admin))
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, resp)
+			}
+			if tt.wantCode != "" {
+				var failure models.ErrorResponse
+				if err := json.Unmarshal([]byte(resp), &failure); err != nil || failure.Code != tt.wantCode {
+					t.Errorf("error %s, want code %s", resp, tt.wantCode)
+				}
+			} else {
+				var entry models.PointTransaction
+				if err := json.Unmarshal([]byte(resp), &entry); err != nil {
+					t.Fatalf("decode %s: %v", resp, err)
+				}
+				if entry.Type != models.PointTransactionAdjust || entry.BalanceAfter != tt.balance {
+					t.Errorf("entry %s, want an adjustment to %d", resp, tt.balance)
+				}
+			}
+
+			var stored models.User
+			db.First(&stored, member.ID)
+			if stored.Points != tt.balance {
+				t.Errorf("balance %d, want %d", stored.Points, tt.balance)
+			}
+		})
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		app, db := testutil.NewApp(t)
+		admin := testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin })
+		status, resp := testutil.Request(t, app, http.MethodPost, "/api/v1/admin/users/999/points/adjustments", `{"amount":10,"reason":"Goodwill credit"}`, testutil.AuthHeader(t, admin))
+		if status != http.StatusNotFound {
+			t.Errorf("status %d, want 404: %s", status, resp)
+		}
+	})
+}
+
+// TestAdjustUserPointsConcurrently has admins adjust a balance at the same
+// time: every adjustment counts, where setting the balance would keep only
+// the last.
+func TestAdjustUserPointsConcurrently(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	admin := testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin })
+	auth := testutil.AuthHeader(t, admin)
+	member := testutil.CreateUser(t, db)
+	testutil.CreateTransaction(t, db, &member)
+	path := fmt.Sprintf("/api/v1/admin/users/%d/points/adjustments", member.ID)
+
+	const adjustments = 8
+	var wg sync.WaitGroup
+	for range adjustments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"amount":10,"reason":"Goodwill credit"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", auth)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				t.Errorf("status %d, want 201", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var stored models.User
+	db.First(&stored, member.ID)
+	var entries int64
+	db.Model(&models.PointTransaction{}).Where("user_id = ? AND type = ?", member.ID, models.PointTransactionAdjust).Count(&entries)
+	if stored.Points != 100+10*adjustments || entries != adjustments {
+		t.Errorf("balance %d with %d adjustments, want %d with %d", stored.Points, entries, 100+10*adjustments, adjustments)
+	}
+}
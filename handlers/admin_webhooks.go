@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// webhookPages are the sort keys of GET /admin/webhooks.
+var webhookPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "url": "url"},
+	DefaultSort: "id",
+}
+
+// webhookDeliveryPages are the sort and filter keys of
+// GET /admin/webhooks/:id/deliveries.
+var webhookDeliveryPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"status":   "status",
+		"event":    "event",
+		"event_id": "event_id",
+	},
+}
+
+// ListWebhooks godoc
+// @Summary List webhook endpoints
+// @Description List the endpoints events are posted to, with their subscribed events and secret prefixes
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param sort query string false "id or url, - for descending (default id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Endpoints per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.WebhookEndpoint}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks [get]
+func (h *Handler) ListWebhooks(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, webhookPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.WebhookEndpoint](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateWebhook godoc
+// @Summary Register a webhook endpoint
+// @Description Register a URL to be posted the events it subscribes to: user.registered, points.earned and reward.redeemed. Each request carries X-Webhook-ID, X-Webhook-Event, X-Webhook-Timestamp and X-Webhook-Signature, sha256= and the hex HMAC-SHA256 of the timestamp, a dot and the body under the endpoint's secret. The secret is only returned in this response. Responses other than 2xx are retried with exponential backoff up to 10 attempts.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param webhook body models.CreateWebhookRequest true "Endpoint"
+// @Success 201 {object} models.CreateWebhookResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks [post]
+func (h *Handler) CreateWebhook(c *fiber.Ctx) error {
+	var req models.CreateWebhookRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	events, err := webhookEvents(req.Events)
+	if err != nil {
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	secret := "whsec_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	endpoint := models.WebhookEndpoint{
+		URL:          strings.TrimSpace(req.URL),
+		Description:  strings.TrimSpace(req.Description),
+		Events:       events,
+		Secret:       secret,
+		SecretPrefix: secret[:10],
+		Active:       req.Active == nil || *req.Active,
+	}
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&endpoint).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "webhook.create",
+			Resource:   "webhook_endpoints",
+			ResourceID: endpoint.ID,
+			Fields:     []string{"url", "description", "events", "active"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.CreateWebhookResponse{
+		Endpoint: endpoint,
+		Secret:   secret,
+	})
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook endpoint
+// @Description Get one webhook endpoint
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Success 200 {object} models.WebhookEndpoint
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [get]
+func (h *Handler) GetWebhook(c *fiber.Ctx) error {
+	var endpoint models.WebhookEndpoint
+	if err := h.db.WithContext(c.UserContext()).First(&endpoint, c.Params("id")).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Webhook not found")
+	}
+
+	return c.JSON(endpoint)
+}
+
+// UpdateWebhook godoc
+// @Summary Update a webhook endpoint
+// @Description Change an endpoint's URL, description, events or active flag; only fields present in the body are changed. Deliveries to an inactive endpoint wait until it is active again. The secret cannot be changed; register a new endpoint to rotate it.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Param webhook body models.UpdateWebhookRequest true "Fields to change"
+// @Success 200 {object} models.WebhookEndpoint
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [patch]
+func (h *Handler) UpdateWebhook(c *fiber.Ctx) error {
+	var req models.UpdateWebhookRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var endpoint models.WebhookEndpoint
+	err := h.db.WithContext(c.UserContext()).First(&endpoint, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Webhook not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	if req.URL != nil {
+		endpoint.URL = strings.TrimSpace(*req.URL)
+		if endpoint.URL == "" {
+			return models.NewValidationError("Invalid webhook", map[string]string{"url": "cannot be cleared"})
+		}
+		changed = append(changed, "url")
+	}
+	if req.Description != nil {
+		endpoint.Description = strings.TrimSpace(*req.Description)
+		changed = append(changed, "description")
+	}
+	if req.Events != nil {
+		events, err := webhookEvents(req.Events)
+		if err != nil {
+			return err
+		}
+		endpoint.Events = events
+		changed = append(changed, "events")
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+		changed = append(changed, "active")
+	}
+	if len(changed) == 0 {
+		return c.JSON(endpoint)
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		// Events needs the serializer, which only applies to struct updates
+		if err := tx.Model(&endpoint).Select(changed).Updates(&endpoint).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "webhook.update",
+			Resource:   "webhook_endpoints",
+			ResourceID: endpoint.ID,
+			Fields:     changed,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(endpoint)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook endpoint
+// @Description Stop posting events to an endpoint and delete it with its delivery log. Set active to false instead to pause deliveries.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidID, "Invalid ID")
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.WebhookEndpoint{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("endpoint_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "webhook.delete",
+			Resource:   "webhook_endpoints",
+			ResourceID: uint(id),
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Webhook not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook deleted",
+	})
+}
+
+// ListWebhookDeliveries godoc
+// @Summary List an endpoint's deliveries
+// @Description List the events sent, or waiting to be sent, to a webhook endpoint, newest first, with the payload, attempts and the outcome of the latest attempt
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Param filter[status] query string false "pending, succeeded or failed"
+// @Param filter[event] query string false "user.registered, points.earned or reward.redeemed"
+// @Param filter[event_id] query string false "Event ID, the X-Webhook-ID header"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Deliveries per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.WebhookDelivery}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id}/deliveries [get]
+func (h *Handler) ListWebhookDeliveries(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, webhookDeliveryPages)
+	if err != nil {
+		return err
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	var endpoint models.WebhookEndpoint
+	if err := db.First(&endpoint, c.Params("id")).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Webhook not found")
+	}
+
+	page, err := pagination.Find[models.WebhookDelivery](db.Where("endpoint_id = ?", endpoint.ID), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// RetryWebhookDelivery godoc
+// @Summary Retry a webhook delivery
+// @Description Send a delivery again at once, e.g. after fixing the endpoint. A failed delivery gets one more attempt; a succeeded one is sent again with the same X-Webhook-ID.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/webhooks/deliveries/{id}/retry [post]
+func (h *Handler) RetryWebhookDelivery(c *fiber.Ctx) error {
+	var delivery models.WebhookDelivery
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&delivery, c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := webhook.Redeliver(tx, &delivery); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "webhook_delivery.retry",
+			Resource:   "webhook_deliveries",
+			ResourceID: delivery.ID,
+			Fields:     []string{"status", "next_attempt_at"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Delivery not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(delivery)
+}
+
+// webhookEvents checks that events are known and drops repeats.
+func webhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, models.NewValidationError("Invalid webhook", map[string]string{"events": "is required"})
+	}
+	var unique []string
+	for _, event := range events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return nil, models.NewValidationError("Invalid webhook", map[string]string{
+				"events": "unknown event " + event + ", must be one of " + strings.Join(models.WebhookEvents, ", "),
+			})
+		}
+		if !slices.Contains(unique, event) {
+			unique = append(unique, event)
+		}
+	}
+	return unique, nil
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// ExportAnalytics writes the days that ended since the last run to the
+// analytics warehouse: the member snapshot, the points ledger and the domain
+// events.
+func (h *Handler) ExportAnalytics(ctx context.Context) error {
+	return h.analytics.Run(ctx, h.db, time.Now())
+}
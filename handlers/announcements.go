@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// announcementPages are the sort keys of GET /admin/announcements.
+var announcementPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "starts_at": "starts_at"},
+	DefaultSort: "-starts_at",
+}
+
+// ListAnnouncements godoc
+// @Summary List the current announcements
+// @Description List the announcements shown to members now, those that have started and not yet ended, newest first
+// @Tags Announcements
+// @Produce json
+// @Success 200 {array} models.Announcement
+// @Router /api/v1/announcements [get]
+func (h *Handler) ListAnnouncements(c *fiber.Ctx) error {
+	now := time.Now()
+	var items []models.Announcement
+	err := h.db.WithContext(c.UserContext()).
+		Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", now, now).
+		Order("starts_at DESC, id DESC").
+		Find(&items).Error
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(items)
+}
+
+// AdminListAnnouncements godoc
+// @Summary List announcements
+// @Description List every announcement, past, current and scheduled
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param sort query string false "id or starts_at, - for descending (default -starts_at)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Announcements per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Announcement}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/announcements [get]
+func (h *Handler) AdminListAnnouncements(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, announcementPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Announcement](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateAnnouncement godoc
+// @Summary Create an announcement
+// @Description Show an announcement to members from starts_at, or at once without it, until the optional ends_at
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param announcement body models.CreateAnnouncementRequest true "Announcement"
+// @Success 201 {object} models.Announcement
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/announcements [post]
+func (h *Handler) CreateAnnouncement(c *fiber.Ctx) error {
+	var req models.CreateAnnouncementRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	item := models.Announcement{
+		Title:    strings.TrimSpace(req.Title),
+		Body:     strings.TrimSpace(req.Body),
+		StartsAt: time.Now(),
+		EndsAt:   req.EndsAt,
+	}
+	if req.StartsAt != nil {
+		item.StartsAt = *req.StartsAt
+	}
+	if fields := announcementProblems(item); len(fields) > 0 {
+		return models.NewValidationError("Invalid announcement", fields)
+	}
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "announcement.create",
+			Resource:   "announcements",
+			ResourceID: item.ID,
+			Fields:     []string{"title", "body", "starts_at", "ends_at"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// UpdateAnnouncement godoc
+// @Summary Update an announcement
+// @Description Change an announcement's text or dates; only fields present in the body are changed
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Announcement ID"
+// @Param announcement body models.UpdateAnnouncementRequest true "Fields to change"
+// @Success 200 {object} models.Announcement
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/announcements/{id} [patch]
+func (h *Handler) UpdateAnnouncement(c *fiber.Ctx) error {
+	var req models.UpdateAnnouncementRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	var item models.Announcement
+	err := h.db.WithContext(c.UserContext()).First(&item, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Announcement not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	var changed []string
+	if req.Title != nil {
+		item.Title = strings.TrimSpace(*req.Title)
+		updates["title"] = item.Title
+		changed = append(changed, "title")
+	}
+	if req.Body != nil {
+		item.Body = strings.TrimSpace(*req.Body)
+		updates["body"] = item.Body
+		changed = append(changed, "body")
+	}
+	if req.StartsAt != nil {
+		item.StartsAt = *req.StartsAt
+		updates["starts_at"] = item.StartsAt
+		changed = append(changed, "starts_at")
+	}
+	if req.EndsAt != nil {
+		item.EndsAt = req.EndsAt
+		updates["ends_at"] = item.EndsAt
+		changed = append(changed, "ends_at")
+	}
+
+	if fields := announcementProblems(item); len(fields) > 0 {
+		return models.NewValidationError("Invalid announcement", fields)
+	}
+	if len(updates) == 0 {
+		return c.JSON(item)
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "announcement.update",
+			Resource:   "announcements",
+			ResourceID: item.ID,
+			Fields:     changed,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+// DeleteAnnouncement godoc
+// @Summary Delete an announcement
+// @Description Stop showing an announcement and remove it
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Announcement ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/announcements/{id} [delete]
+func (h *Handler) DeleteAnnouncement(c *fiber.Ctx) error {
+	var item models.Announcement
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "announcement.delete",
+			Resource:   "announcements",
+			ResourceID: item.ID,
+			Fields:     []string{"title"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Announcement not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Announcement deleted",
+	})
+}
+
+// announcementProblems validates the fields shared by create and update.
+func announcementProblems(item models.Announcement) map[string]string {
+	fields := requiredFields(map[string]string{"title": item.Title, "body": item.Body})
+	if item.EndsAt != nil && !item.EndsAt.After(item.StartsAt) {
+		fields["ends_at"] = "must be after starts_at"
+	}
+	return fields
+}
@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestAnnouncements(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	admin := testutil.AuthHeader(t, testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin }))
+	member := testutil.AuthHeader(t, testutil.CreateUser(t, db))
+	at := func(d time.Duration) string { return time.Now().Add(d).UTC().Format(time.RFC3339) }
+
+	create := func(body string) models.Announcement {
+		t.Helper()
+		status, resp := testutil.Request(t, app, http.MethodPost, "/api/v1/admin/announcements", body, admin)
+		if status != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", body, status, resp)
+		}
+		var item models.Announcement
+		if err := json.Unmarshal([]byte(resp), &item); err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+	current := func() []string {
+		t.Helper()
+		status, resp := testutil.Request(t, app, http.MethodGet, "/api/v1/announcements", "", "")
+		if status != http.StatusOK {
+			t.Fatalf("list: status %d: %s", status, resp)
+		}
+		var items []models.Announcement
+		if err := json.Unmarshal([]byte(resp), &items); err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+		return titles
+	}
+
+	create(`{"title":"Now","body":"Started already"}`)
+	create(fmt.Sprintf(`{"title":"Later","body":"Not yet","starts_at":%q}`, at(time.Hour)))
+	create(fmt.Sprintf(`{"title":"Over","body":"Ended","starts_at":%q,"ends_at":%q}`, at(-2*time.Hour), at(-time.Hour)))
+	ending := create(fmt.Sprintf(`{"title":"Ending","body":"Ends soon","starts_at":%q,"ends_at":%q}`, at(-time.Hour), at(time.Hour)))
+	if got := current(); len(got) != 2 || got[0] != "Now" || got[1] != "Ending" {
+		t.Errorf("current announcements %q, want Now and Ending", got)
+	}
+
+	path := fmt.Sprintf("/api/v1/admin/announcements/%d", ending.ID)
+	if status, resp := testutil.Request(t, app, http.MethodPatch, path, fmt.Sprintf(`{"ends_at":%q}`, at(-time.Hour)), admin); status != http.StatusBadRequest {
+		t.Errorf("ending before the start: status %d: %s", status, resp)
+	}
+	if status, resp := testutil.Request(t, app, http.MethodPatch, path, `{"title":"Ending soon"}`, admin); status != http.StatusOK {
+		t.Errorf("update: status %d: %s", status, resp)
+	}
+	if got := current(); len(got) != 2 || got[1] != "Ending soon" {
+		t.Errorf("current announcements after the update %q", got)
+	}
+	if status, resp := testutil.Request(t, app, http.MethodDelete, path, "", admin); status != http.StatusOK {
+		t.Errorf("delete: status %d: %s", status, resp)
+	}
+	if got := current(); len(got) != 1 || got[0] != "Now" {
+		t.Errorf("current announcements after the delete %q", got)
+	}
+	if status, _ := testutil.Request(t, app, http.MethodDelete, path, "", admin); status != http.StatusNotFound {
+		t.Errorf("delete again: status %d, want 404", status)
+	}
+
+	status, resp := testutil.Request(t, app, http.MethodGet, "/api/v1/admin/announcements", "", admin)
+	var page models.PagedResponse
+	json.Unmarshal([]byte(resp), &page)
+	if status != http.StatusOK || page.Total != 3 {
+		t.Errorf("admin list: status %d: %s", status, resp)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		auth string
+		want int
+	}{
+		{name: "no title", body: `{"body":"Text"}`, auth: admin, want: http.StatusBadRequest},
+		{name: "member", body: `{"title":"Hi","body":"Text"}`, auth: member, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status, resp := testutil.Request(t, app, http.MethodPost, "/api/v1/admin/announcements", tt.body, tt.auth); status != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, status, tt.want, resp)
+		}
+	}
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("resource = ?", "announcements").Count(&audits)
+	if audits != 6 {
+		t.Errorf("%d audit log entries, want 6", audits)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxAPIKeys caps the unrevoked API keys a user can hold.
+const maxAPIKeys = 10
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the current user's API keys, newest first, including revoked and expired ones. Only the key prefix is shown.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/profile/api-keys [get]
+func (h *Handler) ListAPIKeys(c *fiber.Ctx) error {
+	var keys []models.APIKey
+	err := h.db.WithContext(c.UserContext()).
+		Where("user_id = ?", c.Locals("user_id")).
+		Order("id DESC").
+		Find(&keys).Error
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(keys)
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Issue an API key that lets a machine client call the API as the current user by sending it in X-API-Key. Scopes: profile:read, profile:write, sync:read, rewards:read. The key is only returned in this response. A user can hold up to 10 unrevoked keys.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param api_key body models.CreateAPIKeyRequest true "Key settings"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/profile/api-keys [post]
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	fields := map[string]string{}
+	if req.Name == "" {
+		fields["name"] = "is required"
+	}
+	if len(req.Scopes) == 0 {
+		fields["scopes"] = "is required"
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			fields["scopes"] = "unknown scope " + scope
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		fields["expires_in_days"] = "must not be negative"
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid API key", fields)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	key := "uk_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	apiKey := models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		KeyHash:   middleware.HashAPIKey(key),
+		KeyPrefix: key[:10],
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		err := tx.Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active >= maxAPIKeys {
+			return models.NewAppError(fiber.StatusConflict, models.CodeAPIKeyLimitReached, "API key limit reached; revoke an unused key first")
+		}
+
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "api_key.create",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"api_keys"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.CreateAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Stop accepting one of the current user's API keys immediately
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/api-keys/{id} [delete]
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.APIKey{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), userID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "API key not found or already revoked")
+		}
+
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "api_key.revoke",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"api_keys"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func TestAPIKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes string
+		// before changes the key or its user before the request
+		before     func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey)
+		method     string
+		path       string
+		body       string
+		key        func(key string) string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "read scope reads", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile", wantStatus: http.StatusOK},
+		{name: "read scope cannot write", scopes: `["profile:read"]`, method: http.MethodPut, path: "/api/v1/profile", body: `{"first_name":"Mallory"}`,
+			wantStatus: http.StatusForbidden, wantCode: models.CodeInsufficientScope},
+		{name: "write scope writes", scopes: `["profile:write"]`, method: http.MethodPut, path: "/api/v1/profile", body: `{"first_name":"Somchai"}`, wantStatus: http.StatusOK},
+		{name: "write scope cannot read", scopes: `["profile:write"]`, method: http.MethodGet, path: "/api/v1/profile",
+			wantStatus: http.StatusForbidden, wantCode: models.CodeInsufficientScope},
+		{name: "scope of another resource", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/rewards",
+			wantStatus: http.StatusForbidden, wantCode: models.CodeInsufficientScope},
+		{name: "account security needs a login", scopes: `["profile:read","profile:write"]`, method: http.MethodGet, path: "/api/v1/profile/api-keys",
+			wantStatus: http.StatusForbidden, wantCode: models.CodeUserLoginRequired},
+		{name: "admin routes take no keys", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/admin/users",
+			before: func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey) {
+				db.Model(&user).Update("role", models.RoleAdmin)
+			},
+			wantStatus: http.StatusUnauthorized},
+		{name: "key with a character changed", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			key:        func(key string) string { return key[:len(key)-1] + string(key[len(key)-1]^1) },
+			wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidAPIKey},
+		{name: "stored hash as the key", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			key:        middleware.HashAPIKey,
+			wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidAPIKey},
+		{name: "revoked", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			before: func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey) {
+				db.Model(&apiKey).Update("revoked_at", time.Now())
+			},
+			wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidAPIKey},
+		{name: "expired", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			before: func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey) {
+				db.Model(&apiKey).Update("expires_at", time.Now().Add(-time.Minute))
+			},
+			wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidAPIKey},
+		{name: "suspended user", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			before: func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey) {
+				db.Model(&user).Update("suspended_at", time.Now())
+			},
+			wantStatus: http.StatusForbidden, wantCode: models.CodeAccountSuspended},
+		{name: "deleted user", scopes: `["profile:read"]`, method: http.MethodGet, path: "/api/v1/profile",
+			before: func(t *testing.T, db *gorm.DB, user models.User, apiKey models.APIKey) {
+				db.Delete(&user)
+			},
+			wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := testutil.NewApp(t)
+			user := testutil.CreateUser(t, db)
+			key, apiKey := createAPIKey(t, app, user, tt.scopes)
+			if tt.before != nil {
+				tt.before(t, db, user, apiKey)
+			}
+			if tt.key != nil {
+				key = tt.key(key)
+			}
+
+			status, body := testutil.RequestWithHeaders(t, app, tt.method, tt.path, tt.body, map[string]string{middleware.HeaderAPIKey: key})
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				var failure models.ErrorResponse
+				if err := json.Unmarshal([]byte(body), &failure); err != nil || failure.Code != tt.wantCode {
+					t.Errorf("error %s, want code %s", body, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeyStorage(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	user := testutil.CreateUser(t, db)
+	key, apiKey := createAPIKey(t, app, user, `["profile:read","sync:read","profile:read"]`)
+
+	var stored models.APIKey
+	if err := db.First(&stored, apiKey.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.KeyHash != middleware.HashAPIKey(key) || stored.KeyHash == key {
+		t.Errorf("key hash %q is not the hash of the key", stored.KeyHash)
+	}
+	if stored.KeyPrefix != key[:10] {
+		t.Errorf("key prefix %q, want %q", stored.KeyPrefix, key[:10])
+	}
+	if len(stored.Scopes) != 2 || stored.Scopes[0] != "profile:read" || stored.Scopes[1] != "sync:read" {
+		t.Errorf("scopes %q, want sorted without duplicates", stored.Scopes)
+	}
+
+	// Listings show the prefix, never the key or its hash
+	status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/profile/api-keys", "", testutil.AuthHeader(t, user))
+	if status != http.StatusOK {
+		t.Fatalf("list: status %d: %s", status, body)
+	}
+	for _, secret := range []string{key, stored.KeyHash} {
+		if strings.Contains(body, secret) {
+			t.Errorf("listing reveals %q: %s", secret, body)
+		}
+	}
+
+	// Every key is new
+	other, _ := createAPIKey(t, app, user, `["profile:read"]`)
+	if other == key {
+		t.Error("two keys are equal")
+	}
+
+	for _, scopes := range []string{`[]`, `["admin"]`, `["profile:read","points:earn"]`} {
+		status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/profile/api-keys", `{"name":"CI","scopes":`+scopes+`}`, testutil.AuthHeader(t, user))
+		if status != http.StatusBadRequest {
+			t.Errorf("scopes %s: status %d: %s", scopes, status, body)
+		}
+	}
+}
+
+// createAPIKey creates an API key of user with scopes, a JSON array, and
+// returns the key and its record.
+func createAPIKey(t *testing.T, app *fiber.App, user models.User, scopes string) (string, models.APIKey) {
+	t.Helper()
+
+	status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/profile/api-keys", `{"name":"CI","scopes":`+scopes+`}`, testutil.AuthHeader(t, user))
+	var created models.CreateAPIKeyResponse
+	if status != http.StatusCreated || json.Unmarshal([]byte(body), &created) != nil || created.Key == "" {
+		t.Fatalf("create API key: status %d: %s", status, body)
+	}
+	return created.Key, created.APIKey
+}
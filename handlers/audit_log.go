@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+)
+
+// PruneAuditLogs deletes the audit log entries older than
+// audit_log.retention_days. It is scheduled only when the retention is set.
+func (h *Handler) PruneAuditLogs(ctx context.Context) error {
+	days := h.cfg.AuditLog.RetentionDays
+	if days <= 0 {
+		return nil
+	}
+	result := h.db.WithContext(ctx).
+		Where("created_at < ?", time.Now().AddDate(0, 0, -days)).
+		Delete(&models.AuditLog{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[audit] pruned %d audit log entries older than %d days", result.RowsAffected, days)
+	}
+	return nil
+}
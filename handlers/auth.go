@@ -1,152 +1,180 @@
 package handlers
 
 import (
-	"fmt"
-	"temp-backend-at-kbtg/database"
 	"temp-backend-at-kbtg/middleware"
 	"temp-backend-at-kbtg/models"
-	"time"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/validation"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email, password, and profile information
+// @Description Register a new user with email, password, and profile information. A referral_code links the account to the member who referred it; both are paid the referral bonus once the email address is verified.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param user body models.RegisterRequest true "User registration data"
 // @Success 201 {object} models.AuthResponse
-// @Failure 400 {object} map[string]string
-// @Failure 409 {object} map[string]string
-// @Router /auth/register [post]
-func Register(c *fiber.Ctx) error {
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/auth/register [post]
+func (h *Handler) Register(c *fiber.Ctx) error {
 	var req models.RegisterRequest
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
-	}
-
-	// Basic validation
-	if req.Email == "" || req.Password == "" || req.FirstName == "" || req.LastName == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Email, password, first name, and last name are required",
-		})
-	}
-
-	if len(req.Password) < 6 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Password must be at least 6 characters long",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error": "User with this email already exists",
-		})
-	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	user, err := h.accounts.Register(c.UserContext(), req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to hash password",
-		})
+		return err
 	}
 
-	// Generate membership ID
-	membershipID := fmt.Sprintf("LBK%05d", time.Now().Unix()%100000)
-
-	// Create user
-	user := models.User{
-		Email:        req.Email,
-		Password:     string(hashedPassword),
-		FirstName:    req.FirstName,
-		LastName:     req.LastName,
-		Phone:        req.Phone,
-		MembershipID: membershipID,
-		MemberLevel:  "Gold",
-		Points:       0,
+	// The account is usable even if the email fails; the user can ask for
+	// another link
+	if err := h.sendEmailVerification(c, user); err != nil {
+		middleware.Logf(c, "[auth] verification email for user %d not sent: %v", user.ID, err)
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create user",
-		})
-	}
-
-	// Generate JWT token
-	token, err := middleware.GenerateJWT(user.ID, user.Email)
+	tokens, err := h.issueTokens(c, user)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate token",
-		})
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to generate token")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(models.AuthResponse{
-		Token: token,
-		User:  user,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         *user,
 	})
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Login user with email and password
+// @Description Login user with email and password. Accounts with two-factor authentication get 202 with a challenge token to complete at /auth/2fa/verify instead of the tokens.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param credentials body models.LoginRequest true "User login credentials"
 // @Success 200 {object} models.AuthResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Router /auth/login [post]
-func Login(c *fiber.Ctx) error {
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/auth/login [post]
+func (h *Handler) Login(c *fiber.Ctx) error {
 	var req models.LoginRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	user, err := h.accounts.Authenticate(c.UserContext(), req.Email, req.Password)
+	if err != nil {
+		return err
 	}
 
-	// Basic validation
-	if req.Email == "" || req.Password == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Email and password are required",
-		})
+	return h.loginResponse(c, user, fiber.StatusOK)
+}
+
+// Refresh godoc
+// @Summary Refresh the access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token works once; presenting a used one again revokes every token issued from the same login, and the user has to log in again.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshRequest true "Refresh token from login, registration or the previous refresh"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/auth/refresh [post]
+func (h *Handler) Refresh(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
 	}
 
-	// Find user
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
-		})
+	tokens, err := h.accounts.Refresh(c.UserContext(), req.RefreshToken, clientOf(c))
+	if err != nil {
+		return err
 	}
 
-	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
-		})
+	return c.JSON(tokens)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the access token sent in the Authorization header and the refresh token in the body, together with every refresh token rotated from the same login. Either one may be omitted, but not both.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "Bearer access token to revoke"
+// @Param token body models.RefreshRequest false "Refresh token to revoke"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Router /api/v1/auth/logout [post]
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+		}
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateJWT(user.ID, user.Email)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate token",
-		})
+	if err := h.accounts.Logout(c.UserContext(), c.Get(fiber.HeaderAuthorization), req.RefreshToken); err != nil {
+		return err
 	}
 
-	return c.JSON(models.AuthResponse{
-		Token: token,
-		User:  user,
+	return c.JSON(fiber.Map{
+		"message": "Logged out",
 	})
 }
+
+// issueTokens starts a session for the user from the client of c and
+// returns its access and refresh tokens.
+func (h *Handler) issueTokens(c *fiber.Ctx, user *models.User) (models.TokenResponse, error) {
+	return h.accounts.IssueTokens(c.UserContext(), user, clientOf(c))
+}
+
+// clientOf is the device c comes from.
+func clientOf(c *fiber.Ctx) service.Client {
+	return service.Client{IP: middleware.ClientIP(c), UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
+
+// errAccountSuspended is returned instead of tokens for suspended accounts;
+// ErrorHandler answers it with 403.
+var errAccountSuspended = service.ErrAccountSuspended
+
+// passwordProblem returns why password does not meet the password policy,
+// or "" when it does.
+func passwordProblem(password string) string {
+	if len(password) < 6 {
+		return "must be at least 6 characters long"
+	}
+	return ""
+}
+
+// parseBody parses the request body into req, a pointer to a request model,
+// and checks the model's validate tags. Unparsable bodies fail with
+// INVALID_REQUEST_BODY and broken rules with VALIDATION_FAILED listing every
+// rejected field.
+func parseBody(c *fiber.Ctx, req interface{}) error {
+	if err := c.BodyParser(req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := validation.Struct(req); len(fields) > 0 {
+		return models.NewValidationError("Validation failed", fields)
+	}
+	return nil
+}
+
+// requiredFields returns a "is required" entry for every empty value, keyed
+// by JSON field name.
+func requiredFields(values map[string]string) map[string]string {
+	fields := map[string]string{}
+	for name, value := range values {
+		if value == "" {
+			fields[name] = "is required"
+		}
+	}
+	return fields
+}
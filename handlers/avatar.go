@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/thumbnail"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// avatarSize is the width and height of stored avatars in pixels.
+const avatarSize = 256
+
+// UploadAvatar godoc
+// @Summary Upload an avatar
+// @Description Set the current user's avatar from a JPEG, PNG or GIF image of up to 2 MB, sent as the avatar field of a multipart form. The centre square of the image is scaled to 256×256 and stored as JPEG; avatar_url in the profile links to it. The previous avatar is deleted. The new avatar is then checked by the moderation provider in the background; if it is flagged it is taken down until an admin has reviewed it, and the member is told.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Image"
+// @Success 200 {object} models.ProfileResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/avatar [post]
+func (h *Handler) UploadAvatar(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	img, err := uploadedImage(c, "avatar")
+	if err != nil {
+		return err
+	}
+	avatar, err := thumbnail.JPEG(thumbnail.Square(img, avatarSize))
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	// A new key per upload, so caches never serve the previous avatar
+	key := fmt.Sprintf("avatars/%d/%s.jpg", userID, strings.ToLower(rand.Text()[:16]))
+	if err := h.storage.Put(c.UserContext(), key, "image/jpeg", bytes.NewReader(avatar), int64(len(avatar))); err != nil {
+		log.Printf("[avatar] storing %s failed: %v", key, err)
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Failed to store avatar")
+	}
+
+	previous := user.AvatarKey
+	user.AvatarURL = h.storage.URL(key)
+	user.AvatarKey = key
+	err = h.db.WithContext(c.UserContext()).Model(&user).
+		Updates(map[string]interface{}{"avatar_url": user.AvatarURL, "avatar_key": user.AvatarKey}).Error
+	if err != nil {
+		h.deleteStoredFile(key)
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to update avatar")
+	}
+	h.cache.InvalidateUser(c.UserContext(), user.ID)
+	h.deleteStoredFile(previous)
+	h.queueAvatarCheck(c, user.ID, key)
+
+	return c.JSON(models.ProfileResponse{
+		User: user,
+	})
+}
+
+// DeleteAvatar godoc
+// @Summary Remove the avatar
+// @Description Remove the current user's avatar; avatar_url becomes empty.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} models.ProfileResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/avatar [delete]
+func (h *Handler) DeleteAvatar(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	if user.AvatarKey == "" && user.AvatarURL == "" {
+		return c.JSON(models.ProfileResponse{User: user})
+	}
+
+	previous := user.AvatarKey
+	user.AvatarURL, user.AvatarKey = "", ""
+	err := h.db.WithContext(c.UserContext()).Model(&user).
+		Updates(map[string]interface{}{"avatar_url": "", "avatar_key": ""}).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to remove avatar")
+	}
+	h.cache.InvalidateUser(c.UserContext(), user.ID)
+	h.deleteStoredFile(previous)
+
+	return c.JSON(models.ProfileResponse{
+		User: user,
+	})
+}
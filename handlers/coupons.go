@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/points"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// couponPages are the sort and filter keys of GET /profile/coupons.
+var couponPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"type": "type"},
+}
+
+var (
+	errCouponNotActive = errors.New("coupon is not active")
+	errCouponUsedUp    = errors.New("coupon has no uses left")
+	errCouponApplied   = errors.New("coupon already applied")
+)
+
+// ApplyCoupon godoc
+// @Summary Apply a coupon
+// @Description Apply a coupon code. A points coupon credits its value to the balance; a discount coupon is claimed for its percentage off at partner stores. Each member can apply a coupon once, and the use is counted in the same statement that checks the limit, so a single-use code is applied by one member even when several try at once.
+// @Tags Coupons
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.ApplyCouponRequest true "Coupon code"
+// @Success 201 {object} models.ApplyCouponResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /api/v1/coupons/apply [post]
+func (h *Handler) ApplyCoupon(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.ApplyCouponRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+
+	user := models.User{ID: userID}
+	var use models.CouponUse
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.Where("code = ?", code).First(&coupon).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if !coupon.Active || (coupon.StartsAt != nil && now.Before(*coupon.StartsAt)) ||
+			(coupon.EndsAt != nil && !now.Before(*coupon.EndsAt)) {
+			return errCouponNotActive
+		}
+
+		use = models.CouponUse{
+			CouponID: coupon.ID,
+			UserID:   userID,
+			Code:     coupon.Code,
+			Name:     coupon.Name,
+			Type:     coupon.Type,
+			Value:    coupon.Value,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&use)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCouponApplied
+		}
+
+		// The limit check and the count are one statement so two members
+		// cannot both take the last use
+		result = tx.Model(&models.Coupon{}).
+			Where("id = ? AND active = ? AND (max_uses = 0 OR uses < max_uses)", coupon.ID, true).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCouponUsedUp
+		}
+
+		if coupon.Type == models.CouponPoints {
+			_, err := points.Post(tx, &user, models.PointTransaction{
+				Type:      models.PointTransactionEarn,
+				Amount:    coupon.Value,
+				Reason:    coupon.Name,
+				Reference: "coupon:" + coupon.Code,
+			})
+			return err
+		}
+		return tx.Select("points").First(&user, userID).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Coupon not found")
+	case errors.Is(err, errCouponNotActive):
+		return models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeCouponNotActive, "Coupon is not valid at this time")
+	case errors.Is(err, errCouponApplied):
+		return models.NewAppError(fiber.StatusConflict, models.CodeCouponAlreadyApplied, "Coupon has already been applied")
+	case errors.Is(err, errCouponUsedUp):
+		return models.NewAppError(fiber.StatusConflict, models.CodeCouponUsedUp, "Coupon has been used up")
+	case err != nil:
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to apply coupon")
+	}
+	h.cache.InvalidateUser(c.UserContext(), userID)
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApplyCouponResponse{
+		Use:     use,
+		Balance: user.Points,
+	})
+}
+
+// ListCoupons godoc
+// @Summary List my coupons
+// @Description List the coupons the current user applied, newest first. Discount coupons are shown at partner stores.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param filter[type] query string false "points or discount"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Coupons per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.CouponUse}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/coupons [get]
+func (h *Handler) ListCoupons(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, couponPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID)
+	page, err := pagination.Find[models.CouponUse](query, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestApplyCoupon(t *testing.T) {
+	yesterday, tomorrow := time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1)
+	tests := []struct {
+		name string
+		// coupon is applied as code, or as the code of the created coupon
+		// when code is empty
+		coupon     []testutil.CouponOption
+		code       func(models.Coupon) string
+		usedBy     int
+		usedBySelf bool
+		wantStatus int
+		wantCode   string
+		balance    int
+	}{
+		{name: "points coupon", wantStatus: http.StatusCreated, balance: 600},
+		{name: "code in any case", code: func(c models.Coupon) string { return "  " + strings.ToLower(c.Code) + " " }, wantStatus: http.StatusCreated, balance: 600},
+		{name: "discount coupon", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.Type, c.Value = models.CouponDiscount, 10 }}, wantStatus: http.StatusCreated, balance: 500},
+		{name: "within its dates", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.StartsAt, c.EndsAt = &yesterday, &tomorrow }}, wantStatus: http.StatusCreated, balance: 600},
+		{name: "last use", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.MaxUses = 2 }}, usedBy: 1, wantStatus: http.StatusCreated, balance: 600},
+		{name: "unknown code", code: func(models.Coupon) string { return "NO-SUCH-CODE" }, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound, balance: 500},
+		{name: "inactive", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.Active = false }}, wantStatus: http.StatusUnprocessableEntity, wantCode: models.CodeCouponNotActive, balance: 500},
+		{name: "not started", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.StartsAt = &tomorrow }}, wantStatus: http.StatusUnprocessableEntity, wantCode: models.CodeCouponNotActive, balance: 500},
+		{name: "ended", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.EndsAt = &yesterday }}, wantStatus: http.StatusUnprocessableEntity, wantCode: models.CodeCouponNotActive, balance: 500},
+		{name: "applied before", usedBySelf: true, wantStatus: http.StatusConflict, wantCode: models.CodeCouponAlreadyApplied, balance: 600},
+		{name: "used up", coupon: []testutil.CouponOption{func(c *models.Coupon) { c.MaxUses = 2 }}, usedBy: 2, wantStatus: http.StatusConflict, wantCode: models.CodeCouponUsedUp, balance: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := testutil.NewApp(t)
+			user := testutil.CreateUser(t, db)
+			testutil.CreateTransaction(t, db, &user, testutil.WithAmount(500))
+			auth := testutil.AuthHeader(t, user)
+			coupon := testutil.CreateCoupon(t, db, tt.coupon...)
+			code := coupon.Code
+			if tt.code != nil {
+				code = tt.code(coupon)
+			}
+			body := fmt.Sprintf(`{"code":%q}`, code)
+
+			for range tt.usedBy {
+				other := testutil.CreateUser(t, db)
+				if status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/coupons/apply", body, testutil.AuthHeader(t, other)); status != http.StatusCreated {
+					t.Fatalf("apply for another member: status %d: %s", status, body)
+				}
+			}
+			if tt.usedBySelf {
+				if status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/coupons/apply", body, auth); status != http.StatusCreated {
+					t.Fatalf("apply first: status %d: %s", status, body)
+				}
+			}
+
+			status, resp := testutil.Request(t, app, http.MethodPost, "/api/v1/coupons/apply", body, auth)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, resp)
+			}
+			if tt.wantCode != "" {
+				var failure models.ErrorResponse
+				if err := json.Unmarshal([]byte(resp), &failure); err != nil || failure.Code != tt.wantCode {
+					t.Errorf("error %s, want code %s", resp, tt.wantCode)
+				}
+			} else {
+				var applied models.ApplyCouponResponse
+				if err := json.Unmarshal([]byte(resp), &applied); err != nil {
+					t.Fatalf("decode %s: %v", resp, err)
+				}
+				if applied.Balance != tt.balance || applied.Use.Code != coupon.Code || applied.Use.CouponID != coupon.ID {
+					t.Errorf("response %s, want coupon %s and balance %d", resp, coupon.Code, tt.balance)
+				}
+			}
+
+			var stored models.User
+			if err := db.First(&stored, user.ID).Error; err != nil {
+				t.Fatalf("load user: %v", err)
+			}
+			if stored.Points != tt.balance {
+				t.Errorf("balance %d, want %d", stored.Points, tt.balance)
+			}
+		})
+	}
+}
+
+// TestApplyCouponRace has members apply a single-use coupon at the same
+// time: exactly one gets it.
+func TestApplyCouponRace(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	coupon := testutil.CreateCoupon(t, db, func(c *models.Coupon) { c.MaxUses = 1 })
+	body := fmt.Sprintf(`{"code":%q}`, coupon.Code)
+
+	const members = 8
+	var auths []string
+	for range members {
+		auths = append(auths, testutil.AuthHeader(t, testutil.CreateUser(t, db)))
+	}
+	statuses := make(chan int, members)
+	var wg sync.WaitGroup
+	for _, auth := range auths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/coupons/apply", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", auth)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != members-1 {
+		t.Errorf("statuses %v, want one %d and %d %d", counts, http.StatusCreated, members-1, http.StatusConflict)
+	}
+	var stored models.Coupon
+	db.First(&stored, coupon.ID)
+	var uses int64
+	db.Model(&models.CouponUse{}).Where("coupon_id = ?", coupon.ID).Count(&uses)
+	if stored.Uses != 1 || uses != 1 {
+		t.Errorf("coupon counts %d uses and has %d recorded, want 1", stored.Uses, uses)
+	}
+}
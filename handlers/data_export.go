@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	jobDataExport = "users.export"
+	// dataExportLinkTTL is how long the download link of a data export
+	// works.
+	dataExportLinkTTL = 15 * time.Minute
+)
+
+// dataExportPayload is the payload of a users.export job.
+type dataExportPayload struct {
+	ExportID uint `json:"export_id"`
+	// BaseURL is the public URL of the API, for the links in the email
+	// sent when the export is ready
+	BaseURL string `json:"base_url"`
+}
+
+// RequestDataExport godoc
+// @Summary Export my data
+// @Description Queue a copy of everything kept about the current user: the profile, the points ledger, redemptions and the audit history of the account, as JSON files in a ZIP archive. Poll GET /profile/data-export/{id} until the export is ready; the member also gets an email then. While an export is pending the same export is returned.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 202 {object} models.DataExport
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/profile/data-export [post]
+func (h *Handler) RequestDataExport(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	db := h.db.WithContext(c.UserContext())
+
+	var pending models.DataExport
+	err := db.Where("user_id = ? AND status = ?", userID, models.DataExportPending).Order("id DESC").First(&pending).Error
+	if err == nil {
+		h.checkDataExportJob(c, &pending)
+		if pending.Status == models.DataExportPending {
+			return c.Status(fiber.StatusAccepted).JSON(pending)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load data export").Wrap(err)
+	}
+
+	export := models.DataExport{UserID: userID, Status: models.DataExportPending}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&export).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "user.export",
+			Resource:   "users",
+			ResourceID: userID,
+		}).Error
+	})
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to create data export").Wrap(err)
+	}
+
+	job, err := jobs.Enqueue(c.UserContext(), jobDataExport, dataExportPayload{ExportID: export.ID, BaseURL: h.cfg.BaseURL()})
+	if err != nil {
+		middleware.Logf(c, "[accounts] queueing data export %d failed: %v", export.ID, err)
+		db.Model(&export).Update("status", models.DataExportFailed)
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Failed to queue data export")
+	}
+	export.JobID = job.ID
+	if err := db.Model(&export).Update("job_id", job.ID).Error; err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to create data export").Wrap(err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// GetDataExport godoc
+// @Summary Get a data export
+// @Description Get the status of one of the current user's data exports and, once it is ready, a download link valid for 15 minutes. Archives are deleted ACCOUNT_DATA_EXPORT_RETENTION_DAYS after they are ready.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Data export ID"
+// @Success 200 {object} models.DataExport
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/data-export/{id} [get]
+func (h *Handler) GetDataExport(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Data export not found")
+	}
+	var export models.DataExport
+	if err := h.db.WithContext(c.UserContext()).Where("id = ? AND user_id = ?", id, userID).First(&export).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Data export not found")
+	}
+
+	switch export.Status {
+	case models.DataExportPending:
+		h.checkDataExportJob(c, &export)
+	case models.DataExportReady:
+		link, err := h.storage.PresignedURL(export.StorageKey, dataExportLinkTTL)
+		if err != nil {
+			return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to link data export").Wrap(err)
+		}
+		export.URL = link
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(export)
+}
+
+// checkDataExportJob marks a pending export failed once its job has failed
+// for good or is no longer known to the queue. Jobs have no hook for their
+// last failure, so the export learns of it when it is next looked at.
+func (h *Handler) checkDataExportJob(c *fiber.Ctx, export *models.DataExport) {
+	if export.JobID == "" {
+		return
+	}
+	job, err := jobs.Get(export.JobID)
+	if err != nil {
+		middleware.Logf(c, "[accounts] loading job %s of data export %d failed: %v", export.JobID, export.ID, err)
+		return
+	}
+	if job != nil && job.Status != models.JobFailed {
+		return
+	}
+	err = h.db.WithContext(c.UserContext()).Model(export).
+		Where("status = ?", models.DataExportPending).
+		Update("status", models.DataExportFailed).Error
+	if err != nil {
+		middleware.Logf(c, "[accounts] marking data export %d failed: %v", export.ID, err)
+		return
+	}
+	export.Status = models.DataExportFailed
+}
+
+// exportUserData is the users.export job. It compiles the member's data
+// into a ZIP of JSON files, stores it and emails the member that it is
+// ready.
+func (h *Handler) exportUserData(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var p dataExportPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	db := h.db.WithContext(ctx)
+
+	var export models.DataExport
+	if err := db.First(&export, p.ExportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, jobs.Permanent(fmt.Errorf("data export %d not found", p.ExportID))
+		}
+		return nil, err
+	}
+	if export.Status != models.DataExportPending {
+		return nil, nil
+	}
+	var user models.User
+	if err := db.First(&user, export.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, jobs.Permanent(fmt.Errorf("user %d of data export %d not found", export.UserID, export.ID))
+		}
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeUserData(&buf, db, &user); err != nil {
+		return nil, err
+	}
+	// The random part keeps links to one export from guessing another
+	key := fmt.Sprintf("exports/%s/data_export_%s_%s.zip",
+		strings.ToLower(rand.Text()[:16]), user.MembershipID, time.Now().UTC().Format(reportDateLayout))
+	size := int64(buf.Len())
+	if err := h.storage.Put(ctx, key, "application/zip", &buf, size); err != nil {
+		return nil, fmt.Errorf("storing %s: %w", key, err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	expiresAt := now.AddDate(0, 0, h.cfg.Accounts.DataExportRetentionDays)
+	err := db.Model(&export).Updates(map[string]interface{}{
+		"status":      models.DataExportReady,
+		"storage_key": key,
+		"size":        size,
+		"ready_at":    now,
+		"expires_at":  expiresAt,
+	}).Error
+	if err != nil {
+		h.deleteStoredFile(key)
+		return nil, err
+	}
+
+	// The email only says where to find the export: a link in it would
+	// hand the member's data to anyone who can read their mail
+	body := fmt.Sprintf("The copy of your data you asked for is ready. Download it from your profile in the app until %s.",
+		expiresAt.Format("2 January 2006"))
+	if err := h.notify.Email(db, p.BaseURL, &user, models.NotificationCategoryAccount, "Your data export is ready", body); err != nil {
+		log.Printf("[accounts] data export notice for user %d not sent: %v", user.ID, err)
+	}
+	return nil, nil
+}
+
+// writeUserData writes the ZIP archive of a data export for user to out.
+func writeUserData(out *bytes.Buffer, db *gorm.DB, user *models.User) error {
+	var points []models.PointTransaction
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&points).Error; err != nil {
+		return err
+	}
+	var redemptions []models.Redemption
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&redemptions).Error; err != nil {
+		return err
+	}
+	var auditLogs []models.AuditLog
+	err := db.Where("(resource = ? AND resource_id = ?) OR actor = ?", "users", user.ID, fmt.Sprintf("user:%d", user.ID)).
+		Order("id").Find(&auditLogs).Error
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"points.json", points},
+		{"redemptions.json", redemptions},
+		{"audit_log.json", auditLogs},
+	}
+	now := time.Now()
+	w := zip.NewWriter(out)
+	for _, file := range files {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// PruneDataExports deletes the data exports whose archives have expired,
+// and those requested more than a retention period ago that never became
+// ready.
+func (h *Handler) PruneDataExports(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	now := time.Now()
+	retention := time.Duration(h.cfg.Accounts.DataExportRetentionDays) * 24 * time.Hour
+
+	var exports []models.DataExport
+	err := db.Select("id", "storage_key").
+		Where("expires_at <= ? OR (status <> ? AND created_at <= ?)", now, models.DataExportReady, now.Add(-retention)).
+		Find(&exports).Error
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.StorageKey != "" {
+			if err := h.storage.Delete(ctx, export.StorageKey); err != nil {
+				return fmt.Errorf("deleting %s: %w", export.StorageKey, err)
+			}
+		}
+		if err := db.Delete(&models.DataExport{}, export.ID).Error; err != nil {
+			return err
+		}
+	}
+	if len(exports) > 0 {
+		log.Printf("[accounts] pruned %d data exports", len(exports))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/outbox"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOutbox godoc
+// @Summary List mock provider messages
+// @Description List messages captured from email, SMS, payment and push providers while PROVIDERS_MODE=mock. Not available in production.
+// @Tags Debug
+// @Produce json
+// @Param channel query string false "Filter by channel (email, sms, payment, push, event)"
+// @Param to query string false "Filter by recipient"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/debug/outbox [get]
+func (h *Handler) GetOutbox(c *fiber.Ctx) error {
+	messages := outbox.List(c.Query("channel"), c.Query("to"))
+
+	return c.JSON(fiber.Map{
+		"mock_mode": outbox.MockMode(),
+		"count":     len(messages),
+		"messages":  messages,
+	})
+}
+
+// ClearOutbox godoc
+// @Summary Clear mock provider messages
+// @Description Remove all captured mock provider messages. Not available in production.
+// @Tags Debug
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /api/v1/debug/outbox [delete]
+func (h *Handler) ClearOutbox(c *fiber.Ctx) error {
+	outbox.Clear()
+
+	return c.JSON(fiber.Map{
+		"message": "Outbox cleared",
+	})
+}
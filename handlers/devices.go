@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	maxDeviceFieldLength = 128
+	maxPushTokenLength   = 4096
+)
+
+// ListDevices godoc
+// @Summary List signed-in devices
+// @Description List the devices the current user has used the app on, most recently seen first. Devices are registered automatically from the X-Device-ID header.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {array} models.Device
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/devices [get]
+func (h *Handler) ListDevices(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var devices []models.Device
+	if err := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(devices)
+}
+
+// RegisterDevice godoc
+// @Summary Register a device for push notifications
+// @Description Register the app installation with its FCM push token, or update it when the user has it already; answers 201 for a new device. device_id defaults to the X-Device-ID header. A push token belongs to one device: registering it takes it off any other device, e.g. after another member used the same phone.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param device body models.RegisterDeviceRequest true "Device"
+// @Success 200 {object} models.Device
+// @Success 201 {object} models.Device
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/devices [post]
+func (h *Handler) RegisterDevice(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.RegisterDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if req.DeviceID == "" {
+		req.DeviceID = c.Get(middleware.HeaderDeviceID)
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.PushToken = strings.TrimSpace(req.PushToken)
+
+	fields := map[string]string{}
+	if req.DeviceID == "" {
+		fields["device_id"] = "is required"
+	}
+	for field, value := range map[string]string{"device_id": req.DeviceID, "platform": req.Platform, "model": req.Model, "app_version": req.AppVersion} {
+		if len(value) > maxDeviceFieldLength {
+			fields[field] = "must be at most 128 characters"
+		}
+	}
+	if len([]rune(req.Name)) > 100 {
+		fields["name"] = "must be at most 100 characters"
+	}
+	if len(req.PushToken) > maxPushTokenLength {
+		fields["push_token"] = "is too long"
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid device", fields)
+	}
+
+	status := fiber.StatusOK
+	var device models.Device
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND device_id = ?", userID, req.DeviceID).First(&device).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			device = models.Device{UserID: userID, DeviceID: req.DeviceID}
+			status = fiber.StatusCreated
+		} else if err != nil {
+			return err
+		}
+
+		for _, field := range []struct{ value, target *string }{
+			{&req.Platform, &device.Platform},
+			{&req.Model, &device.Model},
+			{&req.AppVersion, &device.AppVersion},
+			{&req.Name, &device.Name},
+		} {
+			if *field.value != "" {
+				*field.target = *field.value
+			}
+		}
+		if device.Name == "" {
+			device.Name = device.Model
+		}
+		device.PushToken = req.PushToken
+		device.LastSeenAt = time.Now()
+		if err := tx.Save(&device).Error; err != nil {
+			return err
+		}
+		return releasePushToken(tx, &device)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(status).JSON(device)
+}
+
+// releasePushToken takes the push token of device off every other device,
+// so a phone passed on or shared by members only notifies whoever
+// registered it last.
+func releasePushToken(tx *gorm.DB, device *models.Device) error {
+	if device.PushToken == "" {
+		return nil
+	}
+	return tx.Model(&models.Device{}).
+		Where("push_token = ? AND id <> ?", device.PushToken, device.ID).
+		Update("push_token", "").Error
+}
+
+// UpdateDevice godoc
+// @Summary Rename a device or set its push token
+// @Description Update the name and/or push token of one of the current user's devices. An empty push_token turns off push notifications for the device; a token is taken off any other device that had it.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param id path int true "Device ID"
+// @Param device body models.UpdateDeviceRequest true "Fields to change"
+// @Success 200 {object} models.Device
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/devices/{id} [patch]
+func (h *Handler) UpdateDevice(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.UpdateDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	var device models.Device
+	if err := h.db.WithContext(c.UserContext()).Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&device).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Device not found")
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len([]rune(name)) > 100 {
+			return models.NewValidationError("Invalid device name", map[string]string{"name": "must be 1 to 100 characters"})
+		}
+		updates["name"] = name
+	}
+	if req.PushToken != nil {
+		updates["push_token"] = strings.TrimSpace(*req.PushToken)
+	}
+
+	if len(updates) > 0 {
+		err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&device).Updates(updates).Error; err != nil {
+				return err
+			}
+			return releasePushToken(tx, &device)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(device)
+}
+
+// DeleteDevice godoc
+// @Summary Remove a device
+// @Description Remove one of the current user's devices and its push token. The device is registered again if the app keeps sending its X-Device-ID.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param id path int true "Device ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/devices/{id} [delete]
+func (h *Handler) DeleteDevice(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	// The row stays as a sync tombstone, without its push token
+	result := h.db.WithContext(c.UserContext()).Model(&models.Device{}).
+		Where("id = ? AND user_id = ?", c.Params("id"), userID).
+		Updates(map[string]interface{}{"push_token": "", "deleted_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Device not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Device removed",
+	})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/referral"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL      = 24 * time.Hour
+	emailVerificationCooldown = time.Minute
+)
+
+// sendEmailVerification emails the user a link to verify their current
+// address. Earlier links stop working.
+func (h *Handler) sendEmailVerification(c *fiber.Ctx, user *models.User) error {
+	return h.SendEmailVerification(c.UserContext(), user)
+}
+
+// SendEmailVerification is sendEmailVerification outside an HTTP request,
+// e.g. for a registration over gRPC.
+func (h *Handler) SendEmailVerification(ctx context.Context, user *models.User) error {
+	baseURL := h.cfg.BaseURL()
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.EmailVerification{}).
+			Where("user_id = ? AND consumed_at IS NULL", user.ID).
+			Update("consumed_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerification{
+			UserID:    user.ID,
+			Email:     user.Email,
+			TokenHash: hashCode(token),
+			ExpiresAt: time.Now().Add(emailVerificationTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	body := "Please confirm your email address by opening this link within 24 hours:\n\n" +
+		emailLink(baseURL, h.cfg.EmailVerificationURL, "/api/v1/auth/verify-email", token) +
+		"\n\nIf you did not create an account, ignore this email."
+	return h.notify.Email(h.db.WithContext(ctx), baseURL, user, models.NotificationCategoryAccount, "Confirm your email address", body)
+}
+
+// sendWelcomeEmail welcomes a member whose email address is confirmed,
+// either by the verification link or by the identity provider they signed
+// up with.
+func (h *Handler) sendWelcomeEmail(c *fiber.Ctx, user *models.User) {
+	err := h.notify.EmailTemplate(h.db.WithContext(c.UserContext()), h.cfg.BaseURL(), user, models.NotificationCategoryAccount, mailer.TemplateWelcome, mailer.WelcomeData{
+		Name:         user.FirstName,
+		MembershipID: user.MembershipID,
+		Tier:         h.tierContent(c.UserContext(), user.MemberLevel, supportedLocales[0].String()).Name,
+		Points:       user.Points,
+		ReferralCode: user.ReferralCode,
+	})
+	if err != nil {
+		middleware.Logf(c, "[auth] welcome email for user %d not sent: %v", user.ID, err)
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify the email address
+// @Description Confirm the account's email address with the token from the verification email. The token works once and only while the account still has the address it was sent to. Verifying completes a pending referral, paying the bonus to both members.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/auth/verify-email [post]
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	var req models.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"token": req.Token}); len(fields) > 0 {
+		return models.NewValidationError("Token is required", fields)
+	}
+
+	now := time.Now()
+	var verification models.EmailVerification
+	var firstVerification bool
+	var completed *models.Referral
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ?", hashCode(req.Token), now).
+			First(&verification).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&verification).Where("consumed_at IS NULL").Update("consumed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// The address may have changed since the link was sent
+		result = tx.Model(&models.User{}).
+			Where("id = ? AND email = ?", verification.UserID, verification.Email).
+			Update("email_verified_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// Members are welcomed once, not again after changing their address
+		var verified int64
+		err = tx.Model(&models.AuditLog{}).
+			Where("resource = ? AND resource_id = ? AND action = ?", "users", verification.UserID, "email.verify").
+			Count(&verified).Error
+		if err != nil {
+			return err
+		}
+		firstVerification = verified == 0
+
+		err = tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", verification.UserID),
+			Action:     "email.verify",
+			Resource:   "users",
+			ResourceID: verification.UserID,
+			Fields:     []string{"email_verified_at"},
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		completed, err = referral.Complete(tx, verification.UserID)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Verification link is invalid or has expired")
+	}
+	if err != nil {
+		return err
+	}
+	h.cache.InvalidateUser(c.UserContext(), verification.UserID)
+	if completed != nil {
+		h.cache.InvalidateUser(c.UserContext(), completed.ReferrerID)
+	}
+
+	if firstVerification {
+		var user models.User
+		if err := h.db.WithContext(c.UserContext()).First(&user, verification.UserID).Error; err == nil {
+			h.sendWelcomeEmail(c, &user)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email address verified",
+	})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Send a new verification link to an account that has not verified its email address. It needs no login so accounts blocked for being unverified can ask for it. The response is the same whether or not such an account exists.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ResendVerificationRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Router /api/v1/auth/resend-verification [post]
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	var req models.ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"email": req.Email}); len(fields) > 0 {
+		return models.NewValidationError("Email is required", fields)
+	}
+
+	// Never reveal whether the account exists or is verified
+	response := fiber.Map{
+		"message": "If an unverified account exists for this email, a verification link has been sent",
+	}
+
+	email := normalize.Email(req.Email)
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).
+		Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", normalize.CanonicalEmail(email), email).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(response)
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return c.JSON(response)
+	}
+
+	var recent int64
+	h.db.WithContext(c.UserContext()).Model(&models.EmailVerification{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-emailVerificationCooldown)).
+		Count(&recent)
+	if recent > 0 {
+		return c.JSON(response)
+	}
+
+	if err := h.sendEmailVerification(c, &user); err != nil {
+		middleware.Logf(c, "[auth] verification email for user %d not sent: %v", user.ID, err)
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorHandler is the app-wide Fiber error handler. Errors that handlers or
+// middleware return (models.AppError, unknown routes, GORM errors, recovered
+// panics) are rendered as models.ErrorResponse with a machine-readable
+// code, or as models.ValidationErrorResponse for invalid fields. Causes of
+// server errors are logged but never returned.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	appErr := middleware.AsAppError(err)
+	if appErr.Status >= fiber.StatusInternalServerError && appErr.Err != nil {
+		middleware.Logf(c, "Unhandled error on %s %s: %v", c.Method(), c.Path(), appErr.Err)
+	}
+
+	if fields, ok := appErr.Details.(map[string]string); ok && appErr.Code == models.CodeValidationFailed {
+		return c.Status(appErr.Status).JSON(models.ValidationErrorResponse{
+			Error:     appErr.Message,
+			Code:      appErr.Code,
+			Fields:    fields,
+			RequestID: middleware.GetRequestID(c),
+		})
+	}
+
+	return c.Status(appErr.Status).JSON(models.ErrorResponse{
+		Error:     appErr.Message,
+		Code:      appErr.Code,
+		Details:   appErr.Details,
+		RequestID: middleware.GetRequestID(c),
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/experiment"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetExperiments godoc
+// @Summary Get experiment assignments
+// @Description The current user's variant of each running A/B experiment. Assignments are stable for a user and experiment.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} models.ExperimentsResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/experiments [get]
+func (h *Handler) GetExperiments(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	return c.JSON(models.ExperimentsResponse{
+		Assignments: experiment.Assignments(userID),
+	})
+}
+
+// ListExperiments godoc
+// @Summary List experiments
+// @Description All experiments with their variants, weights and the number of users exposed to each variant so far
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.ExperimentSummary
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/experiments [get]
+func (h *Handler) ListExperiments(c *fiber.Ctx) error {
+	var counts []struct {
+		Experiment string
+		Variant    string
+		Exposures  int64
+	}
+	err := h.db.WithContext(c.UserContext()).Model(&models.ExperimentExposure{}).
+		Select("experiment, variant, COUNT(*) AS exposures").
+		Group("experiment, variant").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	exposures := map[[2]string]int64{}
+	for _, count := range counts {
+		exposures[[2]string{count.Experiment, count.Variant}] = count.Exposures
+	}
+
+	summaries := []models.ExperimentSummary{}
+	for _, exp := range experiment.Experiments {
+		summary := models.ExperimentSummary{
+			Key:         exp.Key,
+			Description: exp.Description,
+			Active:      exp.Active,
+		}
+		for _, v := range exp.Variants {
+			summary.Variants = append(summary.Variants, models.ExperimentVariantSummary{
+				Name:      v.Name,
+				Weight:    v.Weight,
+				Exposures: exposures[[2]string{exp.Key, v.Name}],
+			})
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return c.JSON(summaries)
+}
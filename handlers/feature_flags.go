@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// featureFlagKey is the form of a feature flag's key.
+var featureFlagKey = regexp.MustCompile(`^[a-z0-9_.-]{1,64}$`)
+
+// GetFeatureFlags godoc
+// @Summary Get the feature flags
+// @Description Get every feature flag, keyed by name, with whether it is enabled. Clients treat flags missing from the map as disabled.
+// @Tags Feature Flags
+// @Produce json
+// @Success 200 {object} map[string]bool
+// @Router /api/v1/feature-flags [get]
+func (h *Handler) GetFeatureFlags(c *fiber.Ctx) error {
+	var flags []models.FeatureFlag
+	if err := h.db.WithContext(c.UserContext()).Find(&flags).Error; err != nil {
+		return err
+	}
+
+	enabled := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		enabled[flag.Key] = flag.Enabled
+	}
+	return c.JSON(enabled)
+}
+
+// AdminListFeatureFlags godoc
+// @Summary List feature flags
+// @Description List the feature flags with their descriptions, by key
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.FeatureFlag
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/feature-flags [get]
+func (h *Handler) AdminListFeatureFlags(c *fiber.Ctx) error {
+	var flags []models.FeatureFlag
+	if err := h.db.WithContext(c.UserContext()).Order("key").Find(&flags).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(flags)
+}
+
+// SetFeatureFlag godoc
+// @Summary Set a feature flag
+// @Description Create the feature flag or replace its setting. Keys are 1 to 64 lowercase letters, digits, dots, dashes and underscores.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param flag body models.SetFeatureFlagRequest true "Flag setting"
+// @Success 200 {object} models.FeatureFlag
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/feature-flags/{key} [put]
+func (h *Handler) SetFeatureFlag(c *fiber.Ctx) error {
+	var req models.SetFeatureFlagRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	key := c.Params("key")
+	if !featureFlagKey.MatchString(key) {
+		return models.NewValidationError("Invalid feature flag", map[string]string{
+			"key": "must be 1 to 64 lowercase letters, digits, dots, dashes or underscores",
+		})
+	}
+
+	flag := models.FeatureFlag{Key: key, Enabled: req.Enabled, Description: req.Description}
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled", "description", "updated_at"}),
+		}).Create(&flag).Error
+		if err != nil {
+			return err
+		}
+		// Flags have no numeric ID; the key is recorded with the fields
+		return tx.Create(&models.AuditLog{
+			Actor:    auditActor(c),
+			Action:   "feature_flag.set",
+			Resource: "feature_flags",
+			Fields:   []string{"key:" + key, "enabled", "description"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := h.db.WithContext(c.UserContext()).First(&flag, "key = ?", key).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(flag)
+}
+
+// DeleteFeatureFlag godoc
+// @Summary Delete a feature flag
+// @Description Remove a feature flag; clients then treat it as disabled
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param key path string true "Flag key"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/feature-flags/{key} [delete]
+func (h *Handler) DeleteFeatureFlag(c *fiber.Ctx) error {
+	key := c.Params("key")
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.FeatureFlag{}, "key = ?", key)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:    auditActor(c),
+			Action:   "feature_flag.delete",
+			Resource: "feature_flags",
+			Fields:   []string{"key:" + key},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Feature flag not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Feature flag deleted",
+	})
+}
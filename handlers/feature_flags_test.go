@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	admin := testutil.AuthHeader(t, testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin }))
+	member := testutil.AuthHeader(t, testutil.CreateUser(t, db))
+
+	flags := func() map[string]bool {
+		t.Helper()
+		status, resp := testutil.Request(t, app, http.MethodGet, "/api/v1/feature-flags", "", "")
+		if status != http.StatusOK {
+			t.Fatalf("flags: status %d: %s", status, resp)
+		}
+		var got map[string]bool
+		if err := json.Unmarshal([]byte(resp), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		body string
+		auth string
+		want int
+	}{
+		{name: "create", key: "new_checkout", body: `{"enabled":true,"description":"Redesigned checkout"}`, auth: admin, want: http.StatusOK},
+		{name: "create disabled", key: "dark-mode", body: `{"enabled":false}`, auth: admin, want: http.StatusOK},
+		{name: "replace", key: "new_checkout", body: `{"enabled":false,"description":"Redesigned checkout"}`, auth: admin, want: http.StatusOK},
+		{name: "invalid key", key: "New%20Checkout", body: `{"enabled":true}`, auth: admin, want: http.StatusBadRequest},
+		{name: "member", key: "wallet", body: `{"enabled":true}`, auth: member, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status, resp := testutil.Request(t, app, http.MethodPut, "/api/v1/admin/feature-flags/"+tt.key, tt.body, tt.auth); status != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, status, tt.want, resp)
+		}
+	}
+	if got := flags(); len(got) != 2 || got["new_checkout"] || got["dark-mode"] {
+		t.Errorf("flags %v, want new_checkout and dark-mode disabled", got)
+	}
+
+	status, resp := testutil.Request(t, app, http.MethodGet, "/api/v1/admin/feature-flags", "", admin)
+	var listed []models.FeatureFlag
+	json.Unmarshal([]byte(resp), &listed)
+	if status != http.StatusOK || len(listed) != 2 || listed[1].Key != "new_checkout" || listed[1].Description != "Redesigned checkout" {
+		t.Errorf("admin list: status %d: %s", status, resp)
+	}
+
+	if status, resp := testutil.Request(t, app, http.MethodDelete, "/api/v1/admin/feature-flags/dark-mode", "", admin); status != http.StatusOK {
+		t.Errorf("delete: status %d: %s", status, resp)
+	}
+	if status, _ := testutil.Request(t, app, http.MethodDelete, "/api/v1/admin/feature-flags/dark-mode", "", admin); status != http.StatusNotFound {
+		t.Errorf("delete again: status %d, want 404", status)
+	}
+	if got := flags(); len(got) != 1 {
+		t.Errorf("flags after the delete %v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"path"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/storage"
+	"temp-backend-at-kbtg/thumbnail"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DownloadFile godoc
+// @Summary Download a stored file
+// @Description Download a file through a presigned link of the local storage driver, such as a report export. The link carries its expiry and signature; the S3 driver links to the bucket instead.
+// @Tags General
+// @Produce octet-stream
+// @Param key path string true "Storage key"
+// @Param expires query int true "Expiry as a Unix time"
+// @Param signature query string true "Signature"
+// @Success 200 {file} binary
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /files/{key} [get]
+func (h *Handler) DownloadFile(c *fiber.Ctx) error {
+	local, ok := h.storage.(*storage.Local)
+	if !ok {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "File not found")
+	}
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Download link is invalid or has expired")
+	}
+	if err := local.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Download link is invalid or has expired")
+	}
+
+	file, err := local.Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "File not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(path.Base(key))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	// Fiber closes the file once it is sent
+	return c.SendStream(file)
+}
+
+// imageMaxBytes is the largest image upload accepted, below the server's
+// 4 MB body limit.
+const imageMaxBytes = 2 << 20
+
+// uploadedImage decodes the image in the multipart form field, answering
+// with a validation error when it is missing, too big or not an image.
+func uploadedImage(c *fiber.Ctx, field string) (image.Image, error) {
+	header, err := c.FormFile(field)
+	if err != nil {
+		return nil, models.NewValidationError("Missing "+field, map[string]string{field: "is required"})
+	}
+	if header.Size > imageMaxBytes {
+		return nil, models.NewValidationError("Invalid "+field, map[string]string{field: "must be at most 2 MB"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, imageMaxBytes))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := thumbnail.Decode(data)
+	switch {
+	case errors.Is(err, thumbnail.ErrTooLarge):
+		return nil, models.NewValidationError("Invalid "+field, map[string]string{field: "must be at most 25 megapixels"})
+	case err != nil:
+		return nil, models.NewValidationError("Invalid "+field, map[string]string{field: "must be a JPEG, PNG or GIF image"})
+	}
+	return img, nil
+}
+
+// deleteStoredFile removes a file no row refers to any more. A failure only
+// leaves an orphaned file, so it is logged rather than returned.
+func (h *Handler) deleteStoredFile(key string) {
+	if key == "" {
+		return
+	}
+	if err := h.storage.Delete(context.Background(), key); err != nil {
+		log.Printf("[storage] deleting %s failed: %v", key, err)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HelloWorld godoc
+// @Summary Get hello world message
+// @Description Get a simple hello world message
+// @Tags General
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router / [get]
+func (h *Handler) HelloWorld(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"message": "hello world",
+	})
+}
+
+// GetJWKS godoc
+// @Summary Get the token verification keys
+// @Description The public keys access tokens are verified with, as a JSON Web Key Set, so other services can verify tokens without calling this API. Keys are selected by the token's kid header. During a key rotation the retired keys are listed after the current one. The set is empty while tokens are signed with the shared HS256 secret.
+// @Tags General
+// @Produce json
+// @Success 200 {object} models.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(middleware.JWKS())
+}
+
+// ProtectedRoute godoc
+// @Summary Protected route example
+// @Description Example of a protected route that requires authentication
+// @Tags General
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/protected [get]
+func (h *Handler) ProtectedRoute(c *fiber.Ctx) error {
+	userID := c.Locals("user_id")
+	email := c.Locals("email")
+
+	return c.JSON(fiber.Map{
+		"message": "This is a protected route",
+		"user_id": userID,
+		"email":   email,
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/analytics"
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/moderation"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/payment"
+	"temp-backend-at-kbtg/push"
+	"temp-backend-at-kbtg/realtime"
+	"temp-backend-at-kbtg/repository"
+	"temp-backend-at-kbtg/search"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/sms"
+	"temp-backend-at-kbtg/storage"
+	"temp-backend-at-kbtg/voucher"
+
+	"gorm.io/gorm"
+)
+
+// Handler serves the HTTP API and runs the background jobs of the handlers.
+// It holds everything they depend on, so several can coexist, e.g. in tests
+// with their own database or fake services.
+type Handler struct {
+	db         *gorm.DB
+	cfg        *config.Config
+	cache      cache.Cache
+	mailer     mailer.Sender
+	sms        sms.Sender
+	push       push.Sender
+	storage    storage.Service
+	payments   payment.Gateway
+	moderation moderation.Checker
+	vouchers   voucher.Issuer
+	locks      lock.Locker
+	balances   *realtime.Hub
+	events     events.Publisher
+	notify     notify.Notifier
+	accounts   *service.Accounts
+	membership *service.Membership
+	points     *service.Points
+	analytics  *analytics.Exporter
+	shards     *shard.Registry
+	search     search.Index
+}
+
+// Deps are what a Handler is built from. DB and Config are required. The
+// providers left nil are the ones Init configured in their packages, with
+// email queued through mailer.Queue; services left nil are built on the
+// GORM repositories of DB and the Cache.
+type Deps struct {
+	DB      *gorm.DB
+	Config  *config.Config
+	Cache   cache.Cache
+	Mailer  mailer.Sender
+	SMS     sms.Sender
+	Push    push.Sender
+	Storage storage.Service
+	// Payments charges the wallet top-ups
+	Payments payment.Gateway
+	// Moderation checks uploaded images
+	Moderation moderation.Checker
+	// Vouchers issues the vouchers of redeemed rewards
+	Vouchers voucher.Issuer
+	// Locks keeps scheduled jobs, redemptions and account linking from
+	// running twice at once
+	Locks lock.Locker
+	// Balances pushes new balances to the members' open streams
+	Balances *realtime.Hub
+	// Events is the broker events are relayed to, for the health check
+	Events events.Publisher
+	// Analytics writes the warehouse export
+	Analytics *analytics.Exporter
+	// Shards are the tenants' databases the admin stats add up; without
+	// them the stats are DB's alone
+	Shards *shard.Registry
+	// Search is the index of the admin search; database.Open keeps
+	// search.Default in sync
+	Search     search.Index
+	Accounts   *service.Accounts
+	Membership *service.Membership
+	Points     *service.Points
+}
+
+// New returns a Handler on deps.
+func New(deps Deps) *Handler {
+	h := &Handler{
+		db:         deps.DB,
+		cfg:        deps.Config,
+		cache:      deps.Cache,
+		mailer:     deps.Mailer,
+		sms:        deps.SMS,
+		push:       deps.Push,
+		storage:    deps.Storage,
+		payments:   deps.Payments,
+		moderation: deps.Moderation,
+		vouchers:   deps.Vouchers,
+		locks:      deps.Locks,
+		balances:   deps.Balances,
+		events:     deps.Events,
+		accounts:   deps.Accounts,
+		membership: deps.Membership,
+		points:     deps.Points,
+		analytics:  deps.Analytics,
+		shards:     deps.Shards,
+		search:     deps.Search,
+	}
+	if h.cache == nil {
+		h.cache = cache.Default
+	}
+	if h.mailer == nil {
+		h.mailer = mailer.Queue{}
+	}
+	if h.sms == nil {
+		h.sms = sms.Default
+	}
+	if h.push == nil {
+		h.push = push.Default
+	}
+	if h.storage == nil {
+		h.storage = storage.Default
+	}
+	if h.payments == nil {
+		h.payments = payment.Default
+	}
+	if h.moderation == nil {
+		h.moderation = moderation.Default
+	}
+	if h.vouchers == nil {
+		h.vouchers = voucher.Default
+	}
+	if h.locks == nil {
+		h.locks = lock.Default
+	}
+	if h.balances == nil {
+		h.balances = realtime.Default
+	}
+	if h.events == nil {
+		h.events = events.Default
+	}
+	if h.analytics == nil {
+		h.analytics = analytics.Default
+	}
+	if h.search == nil {
+		h.search = search.Default
+	}
+	if h.shards == nil {
+		h.shards = shard.New(&shard.Shard{Tenant: deps.Config.Sharding.Tenant, DB: deps.DB})
+	}
+	h.notify = notify.New(h.mailer, h.push, h.sms)
+
+	store := repository.New(deps.DB)
+	if h.accounts == nil {
+		h.accounts = service.NewAccounts(store, deps.Config)
+	}
+	if h.membership == nil {
+		h.membership = service.NewMembership(store, h.cache)
+	}
+	if h.points == nil {
+		h.points = service.NewPoints(store, h.cache)
+	}
+	return h
+}
+
+// Shards is the registry of the tenants the handlers serve.
+func (h *Handler) Shards() *shard.Registry {
+	return h.shards
+}
+
+// Storage is the service the handlers keep files in.
+func (h *Handler) Storage() storage.Service {
+	return h.storage
+}
+
+// Accounts is the account service the handlers sign members in with.
+func (h *Handler) Accounts() *service.Accounts {
+	return h.accounts
+}
+
+// Membership is the profile and tier service of the handlers.
+func (h *Handler) Membership() *service.Membership {
+	return h.membership
+}
+
+// Points is the points service of the handlers.
+func (h *Handler) Points() *service.Points {
+	return h.points
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/text/language"
+)
+
+// supportedLocales lists the locales content is translated into; the first
+// one is the fallback.
+var supportedLocales = []language.Tag{language.English, language.Thai}
+
+var localeMatcher = language.NewMatcher(supportedLocales)
+
+// requestLocale picks the best supported locale from the Accept-Language
+// header, e.g. "th" for "th-TH,th;q=0.9,en;q=0.8".
+func requestLocale(c *fiber.Ctx) string {
+	tags, _, _ := language.ParseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage))
+	_, index, _ := localeMatcher.Match(tags...)
+	base, _ := supportedLocales[index].Base()
+	return base.String()
+}
+
+// tierContent returns the display copy of a tier in locale, falling back to
+// the default locale and finally to the raw tier code.
+func (h *Handler) tierContent(ctx context.Context, code, locale string) models.TierContent {
+	fallback := supportedLocales[0].String()
+	content := models.TierContent{Code: code, Locale: fallback, Name: code, Benefits: []string{}}
+
+	var translations []models.MemberTierTranslation
+	h.db.WithContext(ctx).Where("tier_code = ? AND locale IN ?", code, []string{locale, fallback}).Find(&translations)
+
+	for _, translation := range translations {
+		if translation.Locale == locale || content.Locale != locale {
+			content.Locale = translation.Locale
+			content.Name = translation.Name
+			content.Description = translation.Description
+			content.Benefits = translation.Benefits
+		}
+	}
+	return content
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// memberEventPages are the sort and filter keys of
+// GET /admin/users/:id/events.
+var memberEventPages = pagination.Options{
+	Sorts:       map[string]string{"version": "version", "occurred_at": "occurred_at"},
+	DefaultSort: "version",
+	Filters:     map[string]string{"type": "type"},
+}
+
+// GetPointsBalance godoc
+// @Summary Get the points balance at a time
+// @Description The current user's points balance and tier as they stood at a time, replayed from their event stream, e.g. at=2026-03-01 for the balance as of March 1. A date means the end of that day in UTC. Without at, the current balance. Version is the number of events replayed; 0 means the account did not exist yet.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param at query string false "Date (YYYY-MM-DD) or RFC 3339 time (default now)"
+// @Success 200 {object} models.MemberState
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/points/balance [get]
+func (h *Handler) GetPointsBalance(c *fiber.Ctx) error {
+	return h.memberStateAt(c, c.Locals("user_id").(uint))
+}
+
+// ListUserEvents godoc
+// @Summary List a user's events
+// @Description The user's event stream, oldest first: joining, each points transaction and each change of tier, with what changed. The user's balance and tier are these events added up, and replaying them gives the balance at any time.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Param filter[type] query string false "Event type, e.g. PointsEarned"
+// @Param sort query string false "version or occurred_at, - for descending (default version)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Events per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.DomainEvent}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/events [get]
+func (h *Handler) ListUserEvents(c *fiber.Ctx) error {
+	user, err := h.adminUser(c)
+	if err != nil {
+		return err
+	}
+	params, err := pagination.Parse(c, memberEventPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("user_id = ?", user.ID)
+	page, err := pagination.Find[models.DomainEvent](query, params)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load events")
+	}
+	return c.JSON(page)
+}
+
+// GetUserBalance godoc
+// @Summary Get a user's balance at a time
+// @Description The user's points balance and tier as they stood at a time, replayed from their event stream. A date means the end of that day in UTC. Without at, the current balance as the events add up, which should equal the balance on the user.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Param at query string false "Date (YYYY-MM-DD) or RFC 3339 time (default now)"
+// @Success 200 {object} models.MemberState
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/balance [get]
+func (h *Handler) GetUserBalance(c *fiber.Ctx) error {
+	user, err := h.adminUser(c)
+	if err != nil {
+		return err
+	}
+	return h.memberStateAt(c, user.ID)
+}
+
+// adminUser loads the user named by the id parameter.
+func (h *Handler) adminUser(c *fiber.Ctx) (*models.User, error) {
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).Select("id").First(&user, c.Params("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	return &user, err
+}
+
+// memberStateAt responds with the state of userID at the time of the at
+// query parameter.
+func (h *Handler) memberStateAt(c *fiber.Ctx, userID uint) error {
+	at, err := parseAsOf(c.Query("at"))
+	if err != nil {
+		return models.NewValidationError("Invalid time", map[string]string{"at": "must be a date (YYYY-MM-DD) or an RFC 3339 time"})
+	}
+	state, err := eventstore.StateAt(h.db.WithContext(c.UserContext()), userID, at)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to replay events").Wrap(err)
+	}
+	return c.JSON(state)
+}
+
+// parseAsOf parses the at of a balance query: now when empty, the end of
+// the day for a date.
+func parseAsOf(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	if day, err := time.Parse(reportDateLayout, value); err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
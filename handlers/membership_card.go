@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/qrcode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// membershipCardTTL is how long a membership card token is accepted. It is
+// short so a screenshot of the card is of little use to anyone else.
+const membershipCardTTL = 5 * time.Minute
+
+// membershipCardScale is the size in pixels of a QR code module in the PNG.
+const membershipCardScale = 8
+
+// membershipCardKey signs membership card tokens.
+func membershipCardKey() []byte {
+	return config.DeriveKey(middleware.JWTSecret(), "membership-card")
+}
+
+// signMembershipCard returns a token for the card of membershipID and its
+// expiry.
+func signMembershipCard(membershipID string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(membershipCardTTL).Truncate(time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   membershipID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString(membershipCardKey())
+	return token, expiresAt, err
+}
+
+// parseMembershipCard returns the membership ID and expiry of a card token
+// made by signMembershipCard that has not expired.
+func parseMembershipCard(token string) (string, time.Time, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return membershipCardKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if claims.Subject == "" {
+		return "", time.Time{}, errors.New("membership card token has no subject")
+	}
+	return claims.Subject, claims.ExpiresAt.Time, nil
+}
+
+// GetMembershipCard godoc
+// @Summary Get the membership card QR code
+// @Description Return a signed token identifying the current member, valid for 5 minutes, and a QR code of it for stores to scan. Clients should fetch a new card before expires_at. With format=png the response is the QR code image alone. Requires a user login.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Produce png
+// @Param format query string false "png for the QR code image instead of JSON" Enums(json, png)
+// @Success 200 {object} models.MembershipCardResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/membership/card [get]
+func (h *Handler) GetMembershipCard(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Select("id", "membership_id").First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	token, expiresAt, err := signMembershipCard(user.MembershipID, time.Now())
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to sign membership card")
+	}
+	code, err := qrcode.Encode([]byte(token))
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to encode membership card")
+	}
+	png, err := code.PNG(membershipCardScale)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to encode membership card")
+	}
+
+	// Every card is different and expires soon
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if c.Query("format") == "png" {
+		c.Set(fiber.HeaderContentType, "image/png")
+		c.Set(fiber.HeaderExpires, expiresAt.UTC().Format(http.TimeFormat))
+		return c.Send(png)
+	}
+	return c.JSON(models.MembershipCardResponse{
+		MembershipID: user.MembershipID,
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		QRCode:       png,
+	})
+}
+
+// VerifyMembershipCard godoc
+// @Summary Verify a scanned membership card
+// @Description Check the token of a membership card QR code scanned at the point of sale and return the member it identifies, with the fields configured for the calling partner. Tokens are accepted until they expire, 5 minutes after the card was shown. Rate-limited per partner.
+// @Tags Partner
+// @Security PartnerKey
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyCardRequest true "Scanned token"
+// @Success 200 {object} models.VerifyCardResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/membership/verify-card [post]
+func (h *Handler) VerifyMembershipCard(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+
+	var req models.VerifyCardRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	membershipID, expiresAt, err := parseMembershipCard(req.Token)
+	if err != nil {
+		return models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeInvalidCard, "Membership card is invalid or expired")
+	}
+
+	var user models.User
+	err = h.db.WithContext(c.UserContext()).Unscoped().Where("membership_id = ?", membershipID).
+		Order("deleted_at IS NOT NULL").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "Member not found")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load member")
+	}
+
+	return c.JSON(models.VerifyCardResponse{
+		Member:    h.partnerMemberView(c, partner, &user),
+		ExpiresAt: expiresAt,
+	})
+}
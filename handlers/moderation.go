@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	jobModerationCheck = "moderation.check"
+	// moderationPreviewTTL is how long the preview link of an item in the
+	// review queue works.
+	moderationPreviewTTL = 15 * time.Minute
+)
+
+// moderationPages are the sort and filter keys of GET /admin/moderation.
+var moderationPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "updated_at": "updated_at"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"status":  "status",
+		"kind":    "kind",
+		"user_id": "user_id",
+	},
+}
+
+// moderationPayload is the payload of a moderation.check job.
+type moderationPayload struct {
+	ItemID uint `json:"item_id"`
+}
+
+// queueAvatarCheck puts the avatar just stored under key in the moderation
+// queue and queues its check. An item whose check cannot be queued stays
+// pending, where admins find it in the review queue.
+func (h *Handler) queueAvatarCheck(c *fiber.Ctx, userID uint, key string) {
+	item := models.ModerationItem{UserID: userID, Kind: models.ModerationKindAvatar, Key: key, Status: models.ModerationPending}
+	if err := h.db.WithContext(c.UserContext()).Create(&item).Error; err != nil {
+		middleware.Logf(c, "[moderation] recording avatar %s failed: %v", key, err)
+		return
+	}
+	if _, err := jobs.Enqueue(c.UserContext(), jobModerationCheck, moderationPayload{ItemID: item.ID}); err != nil {
+		middleware.Logf(c, "[moderation] queueing the check of item %d failed: %v", item.ID, err)
+	}
+}
+
+// checkModeration is the moderation.check job.
+func (h *Handler) checkModeration(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var p moderationPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	return nil, h.CheckModerationItem(ctx, p.ItemID)
+}
+
+// CheckModerationItem runs the pending moderation item id through the
+// moderation provider. Content that passes is approved; flagged content is
+// moved to quarantine, taken down and its owner notified. An avatar the
+// member replaced or removed in the meantime is withdrawn unchecked.
+func (h *Handler) CheckModerationItem(ctx context.Context, id uint) error {
+	db := h.db.WithContext(ctx)
+
+	var item models.ModerationItem
+	if err := db.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(fmt.Errorf("moderation item %d not found", id))
+		}
+		return err
+	}
+	if item.Status != models.ModerationPending {
+		return nil
+	}
+	if !h.avatarInUse(db, &item) {
+		return setModerationStatus(db, &item, models.ModerationWithdrawn)
+	}
+
+	image, err := h.readStoredFile(ctx, item.Key)
+	if err != nil {
+		return err
+	}
+	verdict, err := h.moderation.CheckImage(ctx, "image/jpeg", image)
+	if err != nil {
+		return err
+	}
+	if !verdict.Flagged {
+		return setModerationStatus(db, &item, models.ModerationApproved)
+	}
+
+	quarantineKey := fmt.Sprintf("quarantine/avatars/%d/%s.jpg", item.UserID, strings.ToLower(rand.Text()[:16]))
+	if err := h.storage.Put(ctx, quarantineKey, "image/jpeg", bytes.NewReader(image), int64(len(image))); err != nil {
+		return fmt.Errorf("storing %s: %w", quarantineKey, err)
+	}
+	taken := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND avatar_key = ?", item.UserID, item.Key).
+			Updates(map[string]interface{}{"avatar_url": "", "avatar_key": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Replaced while it was being checked
+			return setModerationStatus(tx, &item, models.ModerationWithdrawn)
+		}
+		taken = true
+		err := tx.Model(&item).Where("status = ?", models.ModerationPending).Updates(models.ModerationItem{
+			Status:        models.ModerationQuarantined,
+			QuarantineKey: quarantineKey,
+			Labels:        verdict.Labels,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      "job:" + jobModerationCheck,
+			Action:     "avatar.quarantine",
+			Resource:   "users",
+			ResourceID: item.UserID,
+			Fields:     []string{"avatar_url"},
+		}).Error
+	})
+	if err != nil || !taken {
+		h.deleteStoredFile(quarantineKey)
+		return err
+	}
+	h.cache.InvalidateUser(ctx, item.UserID)
+	h.deleteStoredFile(item.Key)
+	h.notifyModeration(ctx, item.UserID, "Your avatar is hidden",
+		"Your new avatar may break our community guidelines, so it is hidden until our team has reviewed it.")
+	return nil
+}
+
+// avatarInUse reports whether the avatar of item is still its owner's.
+func (h *Handler) avatarInUse(db *gorm.DB, item *models.ModerationItem) bool {
+	var count int64
+	db.Model(&models.User{}).Where("id = ? AND avatar_key = ?", item.UserID, item.Key).Count(&count)
+	return count > 0
+}
+
+// setModerationStatus moves the pending item to status.
+func setModerationStatus(db *gorm.DB, item *models.ModerationItem, status string) error {
+	return db.Model(item).Where("status = ?", models.ModerationPending).Update("status", status).Error
+}
+
+// readStoredFile returns the content of the stored file under key.
+func (h *Handler) readStoredFile(ctx context.Context, key string) ([]byte, error) {
+	r, err := h.storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", key, err)
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, imageMaxBytes))
+}
+
+// notifyModeration tells a member what became of their upload, in the app
+// and by push.
+func (h *Handler) notifyModeration(ctx context.Context, userID uint, title, body string) {
+	var user models.User
+	if err := h.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return
+	}
+	if err := notify.Inbox(h.db.WithContext(ctx), user.ID, models.NotificationCategoryAccount, title, body); err != nil {
+		log.Printf("[moderation] notification for user %d not created: %v", user.ID, err)
+	}
+	if _, err := h.notify.Push(h.db.WithContext(ctx), &user, models.NotificationCategoryAccount, title, body); err != nil {
+		log.Printf("[moderation] push for user %d not sent: %v", user.ID, err)
+	}
+}
+
+// errModerationDecided answers a review of an item that is no longer
+// pending or quarantined.
+var errModerationDecided = models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Moderation item was already decided")
+
+// loadModerationItem returns the moderation item in the id parameter.
+func (h *Handler) loadModerationItem(c *fiber.Ctx) (*models.ModerationItem, error) {
+	var item models.ModerationItem
+	if err := h.db.WithContext(c.UserContext()).First(&item, "id = ?", c.Params("id")).Error; err != nil {
+		return nil, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Moderation item not found")
+	}
+	return &item, nil
+}
+
+// loadModerationReview returns the moderation item in the id parameter if
+// it awaits a decision.
+func (h *Handler) loadModerationReview(c *fiber.Ctx) (*models.ModerationItem, error) {
+	item, err := h.loadModerationItem(c)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != models.ModerationPending && item.Status != models.ModerationQuarantined {
+		return nil, errModerationDecided
+	}
+	return item, nil
+}
+
+// ListModerationItems godoc
+// @Summary List the moderation queue
+// @Description List uploaded content going through moderation. The review queue is filter[status]=quarantined, content the provider flagged and took down, and filter[status]=pending, content whose check has not run yet.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[status] query string false "pending, approved, quarantined, rejected or withdrawn"
+// @Param filter[kind] query string false "avatar"
+// @Param filter[user_id] query int false "Owner"
+// @Param sort query string false "id or updated_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.ModerationItem}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/moderation [get]
+func (h *Handler) ListModerationItems(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, moderationPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.ModerationItem](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// GetModerationItem godoc
+// @Summary Get a moderation item
+// @Description Return an item of the moderation queue. Pending and quarantined items have a preview_url to the content, valid for 15 minutes.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Moderation item ID"
+// @Success 200 {object} models.ModerationItem
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/moderation/{id} [get]
+func (h *Handler) GetModerationItem(c *fiber.Ctx) error {
+	item, err := h.loadModerationItem(c)
+	if err != nil {
+		return err
+	}
+
+	key := ""
+	switch item.Status {
+	case models.ModerationPending:
+		key = item.Key
+	case models.ModerationQuarantined:
+		key = item.QuarantineKey
+	}
+	if key != "" {
+		link, err := h.storage.PresignedURL(key, moderationPreviewTTL)
+		if err != nil {
+			return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to link content").Wrap(err)
+		}
+		item.PreviewURL = link
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(item)
+}
+
+// ApproveModerationItem godoc
+// @Summary Approve moderated content
+// @Description Approve a pending or quarantined item. A quarantined avatar is restored, unless the member has set another one since, and the member is told.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Moderation item ID"
+// @Success 200 {object} models.ModerationItem
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/moderation/{id}/approve [post]
+func (h *Handler) ApproveModerationItem(c *fiber.Ctx) error {
+	item, err := h.loadModerationReview(c)
+	if err != nil {
+		return err
+	}
+	quarantined, quarantineKey := item.Status == models.ModerationQuarantined, item.QuarantineKey
+
+	// A quarantined avatar is published again under a new key
+	key := item.Key
+	if quarantined {
+		image, err := h.readStoredFile(c.UserContext(), quarantineKey)
+		if err != nil {
+			return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Failed to read quarantined content").Wrap(err)
+		}
+		key = fmt.Sprintf("avatars/%d/%s.jpg", item.UserID, strings.ToLower(rand.Text()[:16]))
+		if err := h.storage.Put(c.UserContext(), key, "image/jpeg", bytes.NewReader(image), int64(len(image))); err != nil {
+			return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Failed to restore content").Wrap(err)
+		}
+	}
+
+	restored := false
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := reviewModerationItem(c, tx, item, models.ModerationApproved, map[string]interface{}{"key": key}); err != nil {
+			return err
+		}
+		if quarantined {
+			result := tx.Model(&models.User{}).
+				Where("id = ? AND (avatar_key = '' OR avatar_key IS NULL)", item.UserID).
+				Updates(map[string]interface{}{"avatar_url": h.storage.URL(key), "avatar_key": key})
+			if result.Error != nil {
+				return result.Error
+			}
+			restored = result.RowsAffected > 0
+		}
+		return nil
+	})
+	if err != nil {
+		if quarantined {
+			h.deleteStoredFile(key)
+		}
+		return err
+	}
+	if quarantined {
+		h.deleteStoredFile(quarantineKey)
+		if !restored {
+			h.deleteStoredFile(key)
+		}
+		h.cache.InvalidateUser(c.UserContext(), item.UserID)
+		h.notifyModeration(c.UserContext(), item.UserID, "Your avatar was approved",
+			"Our team reviewed your avatar and found nothing wrong with it. Sorry for hiding it meanwhile.")
+	}
+
+	return c.JSON(item)
+}
+
+// RejectModerationItem godoc
+// @Summary Reject moderated content
+// @Description Reject a pending or quarantined item: the content is deleted, a pending avatar is taken down too, and the member is told.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Moderation item ID"
+// @Success 200 {object} models.ModerationItem
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/moderation/{id}/reject [post]
+func (h *Handler) RejectModerationItem(c *fiber.Ctx) error {
+	item, err := h.loadModerationReview(c)
+	if err != nil {
+		return err
+	}
+	quarantineKey := item.QuarantineKey
+
+	takenDown := false
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := reviewModerationItem(c, tx, item, models.ModerationRejected, nil); err != nil {
+			return err
+		}
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND avatar_key = ?", item.UserID, item.Key).
+			Updates(map[string]interface{}{"avatar_url": "", "avatar_key": ""})
+		takenDown = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return err
+	}
+	h.deleteStoredFile(quarantineKey)
+	if takenDown {
+		h.cache.InvalidateUser(c.UserContext(), item.UserID)
+		h.deleteStoredFile(item.Key)
+	}
+	h.notifyModeration(c.UserContext(), item.UserID, "Your avatar was removed",
+		"Our team reviewed your avatar and removed it because it breaks our community guidelines. You can upload another one.")
+
+	return c.JSON(item)
+}
+
+// reviewModerationItem records an admin's decision on item, with the other
+// columns in fields, and audits it. The item must still have the status it
+// was loaded with, so a check finishing meanwhile is not overruled unseen.
+func reviewModerationItem(c *fiber.Ctx, tx *gorm.DB, item *models.ModerationItem, status string, fields map[string]interface{}) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":         status,
+		"quarantine_key": "",
+		"reviewed_at":    now,
+		"reviewed_by":    auditActor(c),
+	}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	result := tx.Model(item).Where("status = ?", item.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errModerationDecided
+	}
+	item.Status, item.ReviewedAt, item.ReviewedBy = status, &now, auditActor(c)
+
+	action := "moderation.approve"
+	if status == models.ModerationRejected {
+		action = "moderation.reject"
+	}
+	return tx.Create(&models.AuditLog{
+		Actor:      auditActor(c),
+		Action:     action,
+		Resource:   "moderation_items",
+		ResourceID: item.ID,
+		Fields:     []string{"status"},
+	}).Error
+}
@@ -0,0 +1,130 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/moderation"
+	"temp-backend-at-kbtg/testutil"
+)
+
+// checker is a moderation.Checker with a set verdict.
+type checker struct {
+	verdict moderation.Verdict
+	err     error
+}
+
+func (c checker) CheckImage(context.Context, string, []byte) (moderation.Verdict, error) {
+	return c.verdict, c.err
+}
+
+func TestAvatarModeration(t *testing.T) {
+	flagged := moderation.Verdict{Flagged: true, Labels: []string{"adult"}}
+	tests := []struct {
+		name    string
+		checker checker
+		// replace removes the avatar before it is checked
+		replace bool
+		// review is the admin's decision, approve or reject, and
+		// reviewStatus the answer to it
+		review       string
+		reviewStatus int
+		status       string
+		avatar       bool
+		notices      int
+	}{
+		{name: "passes", status: models.ModerationApproved, avatar: true},
+		{name: "flagged", checker: checker{verdict: flagged}, status: models.ModerationQuarantined, notices: 1},
+		{name: "flagged, approved", checker: checker{verdict: flagged}, review: "approve", reviewStatus: http.StatusOK, status: models.ModerationApproved, avatar: true, notices: 2},
+		{name: "flagged, rejected", checker: checker{verdict: flagged}, review: "reject", reviewStatus: http.StatusOK, status: models.ModerationRejected, notices: 2},
+		{name: "removed before the check", checker: checker{verdict: flagged}, replace: true, status: models.ModerationWithdrawn},
+		{name: "check failed, rejected", checker: checker{err: errors.New("provider down")}, review: "reject", reviewStatus: http.StatusOK, status: models.ModerationRejected, notices: 1},
+		{name: "decided items are not reviewed", review: "reject", reviewStatus: http.StatusConflict, status: models.ModerationApproved, avatar: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			admin := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Role = models.RoleAdmin })
+			member := testutil.CreateUser(t, env.DB)
+
+			var form bytes.Buffer
+			w := multipart.NewWriter(&form)
+			part, _ := w.CreateFormFile("avatar", "avatar.png")
+			if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 300, 300))); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+			status, body := testutil.RequestWithHeaders(t, env.App, http.MethodPost, "/api/v1/profile/avatar", form.String(), map[string]string{
+				"Authorization": testutil.AuthHeader(t, member),
+				"Content-Type":  w.FormDataContentType(),
+			})
+			if status != http.StatusOK {
+				t.Fatalf("upload: status %d: %s", status, body)
+			}
+			if tt.replace {
+				status, body := testutil.Request(t, env.App, http.MethodDelete, "/api/v1/profile/avatar", "", testutil.AuthHeader(t, member))
+				if status != http.StatusOK {
+					t.Fatalf("delete: status %d: %s", status, body)
+				}
+			}
+
+			var item models.ModerationItem
+			if err := env.DB.Where("user_id = ?", member.ID).First(&item).Error; err != nil {
+				t.Fatal(err)
+			}
+			h := handlers.New(handlers.Deps{DB: env.DB, Config: config.Default(), Storage: env.Storage, Moderation: tt.checker})
+			if err := h.CheckModerationItem(context.Background(), item.ID); (err != nil) != (tt.checker.err != nil) {
+				t.Fatalf("check: %v", err)
+			}
+			env.DB.First(&item, item.ID)
+
+			if tt.review != "" {
+				path := fmt.Sprintf("/api/v1/admin/moderation/%d/%s", item.ID, tt.review)
+				status, body := testutil.Request(t, env.App, http.MethodPost, path, "", testutil.AuthHeader(t, admin))
+				if status != tt.reviewStatus {
+					t.Fatalf("%s: status %d, want %d: %s", tt.review, status, tt.reviewStatus, body)
+				}
+			}
+
+			var got models.ModerationItem
+			env.DB.First(&got, item.ID)
+			if got.Status != tt.status {
+				t.Errorf("status %s, want %s", got.Status, tt.status)
+			}
+			if item.Status == models.ModerationQuarantined && (len(item.Labels) != 1 || item.Labels[0] != "adult") {
+				t.Errorf("labels %v, want adult", item.Labels)
+			}
+			env.DB.First(&member, member.ID)
+			if (member.AvatarKey != "") != tt.avatar {
+				t.Errorf("avatar %q, want one: %v", member.AvatarKey, tt.avatar)
+			}
+			if member.AvatarKey != "" {
+				if _, err := env.Storage.Get(context.Background(), member.AvatarKey); err != nil {
+					t.Errorf("avatar file: %v", err)
+				}
+			}
+			// Quarantined content is kept only while it waits for review
+			if item.QuarantineKey != "" {
+				_, err := env.Storage.Get(context.Background(), item.QuarantineKey)
+				if kept := err == nil; kept != (got.Status == models.ModerationQuarantined) {
+					t.Errorf("quarantined file kept: %v with the item %s", kept, got.Status)
+				}
+			}
+			var notices int64
+			env.DB.Model(&models.Notification{}).Where("user_id = ?", member.ID).Count(&notices)
+			if int(notices) != tt.notices {
+				t.Errorf("%d notifications, want %d", notices, tt.notices)
+			}
+		})
+	}
+}
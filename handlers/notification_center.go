@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// notificationRetention is how long notifications stay in the notification
+// center.
+const notificationRetention = 180 * 24 * time.Hour
+
+// notificationPages are the sort and filter keys of GET /notifications.
+var notificationPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"category": "category"},
+}
+
+// ListNotifications godoc
+// @Summary List notifications
+// @Description List the current user's notification center, newest first, with the number of unread notifications in total and per category. unread=true lists only unread ones.
+// @Tags Notifications
+// @Security BearerAuth
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param filter[category] query string false "account, points or marketing"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Notifications per page (default 20, max 100)"
+// @Success 200 {object} models.NotificationPage{items=[]models.Notification}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/notifications [get]
+func (h *Handler) ListNotifications(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, notificationPages)
+	if err != nil {
+		return err
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	query := db.Where("user_id = ?", userID)
+	if c.QueryBool("unread") {
+		query = query.Where("read_at IS NULL")
+	}
+	page, err := pagination.Find[models.Notification](query, params)
+	if err != nil {
+		return err
+	}
+
+	var counts []struct {
+		Category string
+		Count    int64
+	}
+	err = db.Model(&models.Notification{}).
+		Select("category, COUNT(*) AS count").
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Group("category").
+		Find(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	result := models.NotificationPage{PagedResponse: page, UnreadByCategory: map[string]int64{}}
+	for _, count := range counts {
+		result.Unread += count.Count
+		result.UnreadByCategory[count.Category] = count.Count
+	}
+	return c.JSON(result)
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification read
+// @Description Mark one of the current user's notifications read. Marking a read notification again keeps the time it was first read.
+// @Tags Notifications
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} models.Notification
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/notifications/{id}/read [post]
+func (h *Handler) MarkNotificationRead(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var notification models.Notification
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&notification).Error; err != nil {
+			return err
+		}
+		if notification.ReadAt != nil {
+			return nil
+		}
+		now := time.Now()
+		notification.ReadAt = &now
+		return tx.Model(&notification).Update("read_at", now).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Notification not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(notification)
+}
+
+// MarkAllNotificationsRead godoc
+// @Summary Mark all notifications read
+// @Description Mark every unread notification of the current user read
+// @Tags Notifications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.MarkAllNotificationsReadResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/notifications/read-all [post]
+func (h *Handler) MarkAllNotificationsRead(c *fiber.Ctx) error {
+	result := h.db.WithContext(c.UserContext()).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", c.Locals("user_id")).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return c.JSON(models.MarkAllNotificationsReadResponse{
+		Updated: result.RowsAffected,
+	})
+}
+
+// PruneNotifications deletes notifications older than the retention period,
+// read or not. It runs nightly; the rows are kept as sync tombstones until
+// PruneSyncTombstones removes them.
+func (h *Handler) PruneNotifications(ctx context.Context) error {
+	result := h.db.WithContext(ctx).
+		Where("created_at < ?", time.Now().Add(-notificationRetention)).
+		Delete(&models.Notification{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[notifications] pruned %d old notifications", result.RowsAffected)
+	}
+	return nil
+}
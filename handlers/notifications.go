@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetNotificationPreferences godoc
+// @Summary Get notification preferences
+// @Description Whether the current user receives points updates and marketing by email and push. Account messages such as security alerts are always sent.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} models.NotificationPreferencesResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/notification-preferences [get]
+func (h *Handler) GetNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	prefs, err := notify.Preferences(h.db.WithContext(c.UserContext()), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(models.NotificationPreferencesResponse{Preferences: prefs})
+}
+
+// UpdateNotificationPreferences godoc
+// @Summary Update notification preferences
+// @Description Turn categories on or off per channel; pairs not listed are left unchanged. Use this to subscribe again after an unsubscribe link.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param preferences body models.UpdateNotificationPreferencesRequest true "Preferences to change"
+// @Success 200 {object} models.NotificationPreferencesResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/notification-preferences [put]
+func (h *Handler) UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.UpdateNotificationPreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	fields := map[string]string{}
+	for i, pref := range req.Preferences {
+		key := fmt.Sprintf("preferences[%d]", i)
+		switch optional, known := notify.Categories[pref.Category]; {
+		case !notify.Channels[pref.Channel]:
+			fields[key] = "unknown channel " + pref.Channel
+		case !known:
+			fields[key] = "unknown category " + pref.Category
+		case !optional:
+			fields[key] = pref.Category + " notifications cannot be turned off"
+		}
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid notification preferences", fields)
+	}
+
+	if len(req.Preferences) > 0 {
+		err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+			changed := make([]string, len(req.Preferences))
+			for i, pref := range req.Preferences {
+				if err := notify.SetPreference(tx, userID, pref.Channel, pref.Category, pref.Enabled); err != nil {
+					return err
+				}
+				changed[i] = "notifications." + pref.Channel + "." + pref.Category
+			}
+			return tx.Create(&models.AuditLog{
+				Actor:      auditActor(c),
+				Action:     "notifications.update",
+				Resource:   "users",
+				ResourceID: userID,
+				Fields:     changed,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return h.GetNotificationPreferences(c)
+}
+
+// GetUnsubscribe godoc
+// @Summary Describe an unsubscribe link
+// @Description Show which notifications an unsubscribe token from an email turns off, for the confirmation page. No login is needed.
+// @Tags Notifications
+// @Produce json
+// @Param token query string true "Unsubscribe token from the email"
+// @Success 200 {object} models.UnsubscribeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/notifications/unsubscribe [get]
+func (h *Handler) GetUnsubscribe(c *fiber.Ctx) error {
+	user, channel, category, err := h.unsubscribeTarget(c.UserContext(), c.Query("token"))
+	if errors.Is(err, errInvalidUnsubscribe) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Invalid unsubscribe link")
+	}
+	if err != nil {
+		return err
+	}
+
+	enabled, err := notify.Enabled(h.db.WithContext(c.UserContext()), user.ID, channel, category)
+	if err != nil {
+		return err
+	}
+	return c.JSON(models.UnsubscribeResponse{
+		Channel:  channel,
+		Category: category,
+		Email:    middleware.MaskString(user.Email),
+		Enabled:  enabled,
+	})
+}
+
+// Unsubscribe godoc
+// @Summary Unsubscribe with a link from an email
+// @Description Turn off the notifications an unsubscribe token names, without logging in. Mail clients call this directly for one-click unsubscribe (RFC 8058, body List-Unsubscribe=One-Click). Repeating it is harmless.
+// @Tags Notifications
+// @Produce json
+// @Param token query string true "Unsubscribe token from the email"
+// @Success 200 {object} models.UnsubscribeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/notifications/unsubscribe [post]
+func (h *Handler) Unsubscribe(c *fiber.Ctx) error {
+	user, channel, category, err := h.unsubscribeTarget(c.UserContext(), c.Query("token"))
+	if errors.Is(err, errInvalidUnsubscribe) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Invalid unsubscribe link")
+	}
+	if err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := notify.SetPreference(tx, user.ID, channel, category, false); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", user.ID),
+			Action:     "notifications.unsubscribe",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"notifications." + channel + "." + category},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(models.UnsubscribeResponse{
+		Channel:  channel,
+		Category: category,
+		Email:    middleware.MaskString(user.Email),
+		Enabled:  false,
+	})
+}
+
+// errInvalidUnsubscribe is returned by unsubscribeTarget for bad tokens and
+// tokens of accounts that no longer exist.
+var errInvalidUnsubscribe = errors.New("invalid unsubscribe link")
+
+// unsubscribeTarget resolves an unsubscribe token to the user, channel and
+// category it names.
+func (h *Handler) unsubscribeTarget(ctx context.Context, token string) (*models.User, string, string, error) {
+	userID, channel, category, err := notify.ParseUnsubscribeToken(token)
+	if err != nil {
+		return nil, "", "", errInvalidUnsubscribe
+	}
+
+	var user models.User
+	err = h.db.WithContext(ctx).First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", "", errInvalidUnsubscribe
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	return &user, channel, category, nil
+}
+
+// EmailWebhook godoc
+// @Summary Receive email delivery events
+// @Description Endpoint for the email provider's bounce and complaint webhooks. Hard bounces and spam complaints add the address to the suppression list; other events are acknowledged and ignored.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param X-Webhook-Secret header string true "Shared secret from EMAIL_WEBHOOK_SECRET"
+// @Param events body []models.EmailWebhookEvent true "Delivery events"
+// @Success 200 {object} models.EmailWebhookResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /webhooks/email [post]
+func (h *Handler) EmailWebhook(c *fiber.Ctx) error {
+	var events []models.EmailWebhookEvent
+	if err := c.BodyParser(&events); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	result := models.EmailWebhookResponse{Received: len(events)}
+	for _, event := range events {
+		reason := suppressionReason(event)
+		if reason == "" || strings.TrimSpace(event.Email) == "" {
+			continue
+		}
+
+		added, err := notify.Suppress(h.db, event.Email, reason, event.Detail)
+		if err != nil {
+			return err
+		}
+		if added {
+			result.Suppressed++
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// suppressionReason returns why event should suppress its address, or ""
+// when it should not.
+func suppressionReason(event models.EmailWebhookEvent) string {
+	switch strings.ToLower(event.Event) {
+	case "bounce", "bounced":
+		if strings.EqualFold(event.BounceType, "soft") {
+			return ""
+		}
+		return "bounce"
+	case "complaint", "spamreport", "spam_report":
+		return "complaint"
+	}
+	return ""
+}
+
+// suppressionPages are the sort and filter keys of GET /admin/suppressions.
+var suppressionPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at", "address": "address"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"reason": "reason"},
+}
+
+// ListSuppressions godoc
+// @Summary List suppressed email addresses
+// @Description Addresses no email is sent to, newest first
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[reason] query string false "Why the address is suppressed, e.g. bounce"
+// @Param sort query string false "id, created_at or address, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Addresses per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.SuppressedAddress}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/suppressions [get]
+func (h *Handler) ListSuppressions(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, suppressionPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.SuppressedAddress](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateSuppression godoc
+// @Summary Suppress an email address
+// @Description Stop sending any email to an address, e.g. when a member asks by phone
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param suppression body models.CreateSuppressionRequest true "Address to suppress"
+// @Success 201 {object} models.SuppressedAddress
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/suppressions [post]
+func (h *Handler) CreateSuppression(c *fiber.Ctx) error {
+	var req models.CreateSuppressionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	req.Address = normalize.Email(req.Address)
+	if !strings.Contains(req.Address, "@") {
+		return models.NewValidationError("Invalid suppression", map[string]string{"address": "must be an email address"})
+	}
+
+	var suppression models.SuppressedAddress
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if _, err := notify.Suppress(tx, req.Address, "manual", req.Detail); err != nil {
+			return err
+		}
+		if err := tx.Where("address = ?", req.Address).First(&suppression).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "suppression.create",
+			Resource:   "suppressed_addresses",
+			ResourceID: suppression.ID,
+			Fields:     []string{"address"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(suppression)
+}
+
+// DeleteSuppression godoc
+// @Summary Lift an email suppression
+// @Description Allow email to an address again, e.g. after the member fixed their mailbox
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Suppression ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/suppressions/{id} [delete]
+func (h *Handler) DeleteSuppression(c *fiber.Ctx) error {
+	var suppression models.SuppressedAddress
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&suppression, c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&suppression).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "suppression.delete",
+			Resource:   "suppressed_addresses",
+			ResourceID: suppression.ID,
+			Fields:     []string{"address"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Suppression not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Suppression removed",
+	})
+}
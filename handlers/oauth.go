@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/oauth"
+	"temp-backend-at-kbtg/referral"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/tiers"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const oauthNonceCookie = "oauth_nonce"
+
+var (
+	// errEmailTaken is returned when a provider account has the email of a
+	// member it cannot be linked to automatically.
+	errEmailTaken = errors.New("email belongs to another account")
+	// errIdentityTaken is returned when the provider account is linked to
+	// another member.
+	errIdentityTaken = errors.New("identity linked to another account")
+	// errProviderLinked is returned when the member already has a
+	// different account at the provider.
+	errProviderLinked = errors.New("provider already linked")
+)
+
+// OAuthLogin godoc
+// @Summary Sign in with an identity provider
+// @Description Redirect the browser to the provider's consent page (google, github, facebook or line). The provider sends the user back to /auth/{provider}/callback, which answers like login.
+// @Tags Authentication
+// @Param provider path string true "Identity provider" Enums(google, github, facebook, line)
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/auth/{provider} [get]
+func (h *Handler) OAuthLogin(c *fiber.Ctx) error {
+	provider, err := configuredProvider(c)
+	if err != nil {
+		return err
+	}
+
+	authURL, err := startOAuth(c, provider, 0)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OAuthCallback godoc
+// @Summary Identity provider callback
+// @Description Finish signing in with, or linking, a provider account. On sign-in the provider account is matched by its ID, then by email: a member with the same verified email is linked, a member whose email is not verified gets 409 and has to sign in with the password and link the provider from the profile, and otherwise a new member is registered (201). The provider must have verified the email. Members with two-factor authentication get a challenge (202) as with login. When linking, the linked identity is returned.
+// @Tags Authentication
+// @Produce json
+// @Param provider path string true "Identity provider" Enums(google, github, facebook, line)
+// @Param code query string true "Authorization code from the provider"
+// @Param state query string true "State from the start of the sign-in"
+// @Success 200 {object} models.AuthResponse
+// @Success 201 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/auth/{provider}/callback [get]
+func (h *Handler) OAuthCallback(c *fiber.Ctx) error {
+	provider, err := configuredProvider(c)
+	if err != nil {
+		return err
+	}
+
+	// The nonce is single-use
+	nonce := c.Cookies(oauthNonceCookie)
+	setOAuthNonceCookie(c, "", -time.Hour)
+	state, err := oauth.ParseState(c.Query("state"))
+	if err != nil || state.Provider != provider.Name() || nonce == "" ||
+		subtle.ConstantTimeCompare([]byte(nonce), []byte(state.Nonce)) != 1 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Sign-in session expired or invalid; start again")
+	}
+	if reason := c.Query("error"); reason != "" {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Sign-in was not completed: "+reason)
+	}
+	if c.Query("code") == "" {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Authorization code is required")
+	}
+
+	profile, err := provider.Exchange(c.UserContext(), c.Query("code"), oauthCallbackURL(c, provider))
+	if err != nil {
+		middleware.Logf(c, "[auth] %s sign-in failed: %v", provider.Name(), err)
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Sign-in with the provider failed")
+	}
+
+	if state.UserID != 0 {
+		identity, err := h.linkIdentity(c.UserContext(), state.UserID, provider.Name(), profile)
+		switch {
+		case errors.Is(err, errIdentityTaken):
+			return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "This "+provider.Name()+" account is linked to another member")
+		case errors.Is(err, errProviderLinked):
+			return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Another "+provider.Name()+" account is linked; unlink it first")
+		case err != nil:
+			return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to link account")
+		}
+		return c.Status(fiber.StatusCreated).JSON(identity)
+	}
+
+	if profile.Email == "" || !profile.EmailVerified {
+		return models.NewAppError(fiber.StatusForbidden, models.CodeForbidden, "Your "+provider.Name()+" account has no verified email address")
+	}
+
+	// Two callbacks for one email, e.g. from two providers at once, would
+	// both link the member or both register one
+	var user models.User
+	var created bool
+	lockErr := lock.Do(c.UserContext(), h.locks, "account:"+normalize.CanonicalEmail(profile.Email), lockTTL, func(ctx context.Context) error {
+		user, created, err = h.signInWithIdentity(ctx, provider.Name(), profile)
+		return nil
+	})
+	if errors.Is(lockErr, lock.ErrHeld) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Another sign-in with this email is in progress; try again")
+	}
+	if lockErr != nil && user.ID == 0 && err == nil {
+		err = lockErr
+	}
+	if errors.Is(err, errEmailTaken) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeEmailTaken, "An account with this email already exists; sign in with your password and link "+provider.Name()+" from your profile")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to sign in")
+	}
+
+	status := fiber.StatusOK
+	if created {
+		status = fiber.StatusCreated
+		h.sendWelcomeEmail(c, &user)
+	}
+	return h.loginResponse(c, &user, status)
+}
+
+// ListIdentities godoc
+// @Summary List linked sign-in providers
+// @Description Provider accounts linked to the current user, and the providers that are available
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.IdentitiesResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/identities [get]
+func (h *Handler) ListIdentities(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	identities := []models.UserIdentity{}
+	if err := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Order("provider").Find(&identities).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(models.IdentitiesResponse{
+		Identities: identities,
+		Providers:  oauth.Configured(),
+	})
+}
+
+// LinkIdentity godoc
+// @Summary Link a sign-in provider
+// @Description Start linking a provider account to the current user. Open the returned URL in the same browser that made this request; the provider redirects to /auth/{provider}/callback, which links the account.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Identity provider" Enums(google, github, facebook, line)
+// @Success 200 {object} models.AuthorizationURLResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/profile/identities/{provider} [post]
+func (h *Handler) LinkIdentity(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	provider, err := configuredProvider(c)
+	if err != nil {
+		return err
+	}
+
+	var linked int64
+	h.db.WithContext(c.UserContext()).Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, provider.Name()).Count(&linked)
+	if linked > 0 {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "A "+provider.Name()+" account is already linked")
+	}
+
+	authURL, err := startOAuth(c, provider, userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(models.AuthorizationURLResponse{
+		AuthorizationURL: authURL,
+	})
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink a sign-in provider
+// @Description Remove the current user's account at the provider. Members registered through a provider have no password of their own and need a password reset to sign in without one.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Identity provider" Enums(google, github, facebook, line)
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/identities/{provider} [delete]
+func (h *Handler) UnlinkIdentity(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	name := c.Params("provider")
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("user_id = ? AND provider = ?", userID, name).Delete(&models.UserIdentity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "identity.unlink",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"user_identities." + name},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "No linked account for this provider")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to unlink account")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Account unlinked",
+	})
+}
+
+// configuredProvider returns the provider named in the URL. The error is a
+// 404 or 503 AppError rendered by ErrorHandler.
+func configuredProvider(c *fiber.Ctx) (oauth.Provider, error) {
+	provider, ok := oauth.Lookup(c.Params("provider"))
+	if !ok {
+		return nil, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Unknown sign-in provider")
+	}
+	if !provider.Configured() {
+		return nil, models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Sign-in with "+provider.Name()+" is not configured")
+	}
+	return provider, nil
+}
+
+// startOAuth returns the provider URL that starts signing in, or linking for
+// userID when it is not zero. The state sent to the provider is tied to
+// this browser through a nonce cookie.
+func startOAuth(c *fiber.Ctx, provider oauth.Provider, userID uint) (string, error) {
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	state, err := oauth.SignState(oauth.State{
+		Provider: provider.Name(),
+		UserID:   userID,
+		Nonce:    nonce,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	setOAuthNonceCookie(c, nonce, oauth.StateTTL)
+	return provider.AuthCodeURL(state, oauthCallbackURL(c, provider)), nil
+}
+
+// setOAuthNonceCookie stores the nonce that ties the provider's callback to
+// the browser that started the sign-in. A negative ttl deletes the cookie.
+func setOAuthNonceCookie(c *fiber.Ctx, nonce string, ttl time.Duration) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     middleware.BasePath() + "/auth",
+		Expires:  time.Now().Add(ttl),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// oauthCallbackURL keeps the unversioned path: it is registered with the
+// providers, and the nonce cookie is scoped to it.
+func oauthCallbackURL(c *fiber.Ctx, provider oauth.Provider) string {
+	return provider.CallbackURL(middleware.AbsoluteURL(c, "/auth/"+provider.Name()+"/callback"))
+}
+
+// linkIdentity links the provider account to the user. Linking the same
+// account again is a no-op.
+func (h *Handler) linkIdentity(ctx context.Context, userID uint, provider string, profile oauth.Profile) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := h.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity).Error
+	if err == nil {
+		if identity.UserID != userID {
+			return identity, errIdentityTaken
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return identity, err
+	}
+
+	identity = models.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  profile.Subject,
+		Email:    normalize.Email(profile.Email),
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var linked int64
+		if err := tx.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, provider).Count(&linked).Error; err != nil {
+			return err
+		}
+		if linked > 0 {
+			return errProviderLinked
+		}
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", userID),
+			Action:     "identity.link",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"user_identities." + provider},
+		}).Error
+	})
+	return identity, err
+}
+
+// signInWithIdentity returns the user linked to the provider account,
+// linking the member with the same email or registering a new member when
+// there is none. The provider must have verified profile.Email. A member
+// whose own email is unverified is not linked (errEmailTaken): anyone could
+// have registered with that address. created reports whether a new user was
+// registered.
+func (h *Handler) signInWithIdentity(ctx context.Context, provider string, profile oauth.Profile) (user models.User, created bool, err error) {
+	var identity models.UserIdentity
+	err = h.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity).Error
+	if err == nil {
+		err = h.db.WithContext(ctx).First(&user, identity.UserID).Error
+		return user, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, err
+	}
+
+	email := normalize.Email(profile.Email)
+	identity = models.UserIdentity{
+		Provider: provider,
+		Subject:  profile.Subject,
+		Email:    email,
+	}
+
+	err = h.db.WithContext(ctx).
+		Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", normalize.CanonicalEmail(email), email).
+		First(&user).Error
+	if err == nil {
+		if user.EmailVerifiedAt == nil {
+			return user, false, errEmailTaken
+		}
+		err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var linked int64
+			if err := tx.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", user.ID, provider).Count(&linked).Error; err != nil {
+				return err
+			}
+			if linked > 0 {
+				return errEmailTaken
+			}
+			identity.UserID = user.ID
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.AuditLog{
+				Actor:      "oauth:" + provider,
+				Action:     "identity.link",
+				Resource:   "users",
+				ResourceID: user.ID,
+				Fields:     []string{"user_identities." + provider},
+			}).Error
+		})
+		return user, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, err
+	}
+
+	user, err = h.newIdentityUser(email, profile)
+	if err != nil {
+		return user, false, err
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		level, err := tiers.Initial(tx)
+		if err != nil {
+			return err
+		}
+		user.MemberLevel = level
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		if err := events.Publish(tx, models.WebhookEventUserRegistered, events.UserData(&user)); err != nil {
+			return err
+		}
+		_, err = campaign.Award(tx, &user, models.CampaignEventRegistration)
+		return err
+	})
+	return user, err == nil, err
+}
+
+// newIdentityUser builds a member from a provider profile. Names the
+// provider sends that are not acceptable are left for the user to fill in.
+// The password is random, so signing in with a password needs a reset first.
+func (h *Handler) newIdentityUser(email string, profile oauth.Profile) (models.User, error) {
+	password, err := randomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	firstName, lastName := profile.FirstName, profile.LastName
+	for name, problem := range service.NormalizeNames(map[string]*string{
+		"first_name": &firstName,
+		"last_name":  &lastName,
+	}) {
+		log.Printf("[auth] ignoring %s from identity provider: %s", name, problem)
+		if name == "first_name" {
+			firstName = ""
+		} else {
+			lastName = ""
+		}
+	}
+
+	romanizedName := ""
+	if firstName != "" && lastName != "" && normalize.IsLatin(firstName+lastName) {
+		romanizedName = fmt.Sprintf("%s %s", firstName, lastName)
+	}
+
+	now := time.Now()
+	return models.User{
+		Email:           email,
+		EmailCanonical:  normalize.CanonicalEmail(email),
+		EmailVerifiedAt: &now,
+		Password:        string(hashedPassword),
+		FirstName:       firstName,
+		LastName:        lastName,
+		RomanizedName:   romanizedName,
+		MembershipID:    service.NewMembershipID(),
+		ReferralCode:    referral.NewCode(),
+		Points:          0,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/service"
+	"temp-backend-at-kbtg/sms"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	loginCodeTTL         = 5 * time.Minute
+	loginCodeCooldown    = time.Minute
+	loginCodeMaxAttempts = 5
+)
+
+// RequestLoginOTP godoc
+// @Summary Send a login code by SMS
+// @Description Send a 6-digit code, valid for 5 minutes, to log in with a verified phone number. The response is the same whether or not a member has verified the number. One code per number per minute; each client IP may request 5 codes per 10 minutes.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.OTPRequest true "Verified phone number"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/auth/otp/request [post]
+func (h *Handler) RequestLoginOTP(c *fiber.Ctx) error {
+	var req models.OTPRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	phone, problem := service.NormalizePhone(req.Phone)
+	if req.Phone == "" {
+		problem = "is required"
+	}
+	if problem != "" {
+		return models.NewValidationError("Invalid phone number", map[string]string{"phone": problem})
+	}
+
+	// Never reveal whether the number belongs to a member
+	response := fiber.Map{
+		"message": "If a member has verified this number, a login code has been sent",
+	}
+
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).Where("phone = ? AND phone_verified_at IS NOT NULL", phone).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(response)
+	}
+	if err != nil {
+		return err
+	}
+
+	var recent int64
+	h.db.WithContext(c.UserContext()).Model(&models.LoginOTP{}).
+		Where("phone = ? AND created_at > ?", phone, time.Now().Add(-loginCodeCooldown)).
+		Count(&recent)
+	if recent > 0 {
+		return c.JSON(response)
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		// Only the newest code works
+		err := tx.Model(&models.LoginOTP{}).
+			Where("phone = ? AND consumed_at IS NULL", phone).
+			Update("consumed_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.LoginOTP{
+			UserID:    user.ID,
+			Phone:     phone,
+			CodeHash:  hashCode(code),
+			ExpiresAt: time.Now().Add(loginCodeTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sms.Send(h.sms, h.db.WithContext(c.UserContext()), user.ID, phone, models.SMSPurposeLoginCode, fmt.Sprintf("Your login code is %s. Do not share it with anyone.", code)); err != nil {
+		middleware.Logf(c, "[auth] login code for user %d not sent: %v", user.ID, err)
+	}
+
+	return c.JSON(response)
+}
+
+// VerifyLoginOTP godoc
+// @Summary Log in with an SMS code
+// @Description Log in with the phone number and the code from /auth/otp/request. A code works once; after 5 wrong tries a new one is needed. Accounts with two-factor authentication get 202 with a challenge, as with login.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param credentials body models.OTPVerifyRequest true "Phone number and code"
+// @Success 200 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/auth/otp/verify [post]
+func (h *Handler) VerifyLoginOTP(c *fiber.Ctx) error {
+	var req models.OTPVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"phone": req.Phone, "code": req.Code}); len(fields) > 0 {
+		return models.NewValidationError("Phone number and code are required", fields)
+	}
+
+	phone, problem := service.NormalizePhone(req.Phone)
+	if problem != "" {
+		return models.NewValidationError("Invalid phone number", map[string]string{"phone": problem})
+	}
+
+	var otp models.LoginOTP
+	err := h.db.WithContext(c.UserContext()).
+		Where("phone = ? AND consumed_at IS NULL AND expires_at > ?", phone, time.Now()).
+		Order("id DESC").
+		First(&otp).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCode, "Invalid or expired code")
+	}
+
+	// Reserve an attempt before comparing, so that concurrent guesses
+	// cannot all be checked against the same count
+	result := h.db.WithContext(c.UserContext()).Model(&models.LoginOTP{}).
+		Where("id = ? AND attempts < ?", otp.ID, loginCodeMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeTooManyAttempts, "Too many attempts, request a new code")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(req.Code)), []byte(otp.CodeHash)) != 1 {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCode, "Invalid or expired code")
+	}
+
+	// Consume the code only once, even with concurrent requests
+	result = h.db.WithContext(c.UserContext()).Model(&models.LoginOTP{}).
+		Where("id = ? AND consumed_at IS NULL", otp.ID).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCode, "Invalid or expired code")
+	}
+
+	// The number may have moved to another account since the code was sent
+	var user models.User
+	err = h.db.WithContext(c.UserContext()).Where("id = ? AND phone = ? AND phone_verified_at IS NOT NULL", otp.UserID, phone).First(&user).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCode, "Invalid or expired code")
+	}
+
+	return h.loginResponse(c, &user, fiber.StatusOK)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Scopes a partner key can be granted: partnerScopeMembersRead allows looking
+// up members by membership ID and partnerScopePointsEarn crediting them.
+const (
+	partnerScopeMembersRead = "members:read"
+	partnerScopePointsEarn  = "points:earn"
+)
+
+// partnerFields are the optional member fields a partner can be configured
+// to see. The membership ID is always returned.
+var partnerFields = map[string]bool{
+	"member_level":    true,
+	"earn_multiplier": true,
+	"points_eligible": true,
+	"display_name":    true,
+}
+
+// defaultPartnerFields apply to partners created without visible_fields.
+var defaultPartnerFields = []string{"member_level", "earn_multiplier", "points_eligible"}
+
+// GetPartnerMember godoc
+// @Summary Look up a member for a partner
+// @Description Return a minimal view of a member for merchants validating customers at the point of sale. Only the fields configured for the calling partner are included. Rate-limited per partner.
+// @Tags Partner
+// @Security PartnerKey
+// @Produce json
+// @Param membership_id path string true "Membership ID" example(LBK12345)
+// @Success 200 {object} models.PartnerMember
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/members/{membership_id} [get]
+func (h *Handler) GetPartnerMember(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	membershipID := strings.ToUpper(c.Params("membership_id"))
+
+	// A closed account is reported as not eligible rather than unknown so
+	// the cashier can tell the customer why
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).Unscoped().Where("membership_id = ?", membershipID).
+		Order("deleted_at IS NOT NULL").First(&user).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "Member not found")
+	}
+
+	return c.JSON(h.partnerMemberView(c, partner, &user))
+}
+
+// partnerMemberView is the view of user that partner is configured to see.
+// Closed accounts only show that they are not eligible for points.
+func (h *Handler) partnerMemberView(c *fiber.Ctx, partner *models.Partner, user *models.User) models.PartnerMember {
+	visible := map[string]bool{}
+	for _, field := range partner.VisibleFields {
+		visible[field] = true
+	}
+
+	member := models.PartnerMember{MembershipID: user.MembershipID}
+	eligible := !user.DeletedAt.Valid
+	if visible["points_eligible"] {
+		member.PointsEligible = &eligible
+	}
+	if !eligible {
+		return member
+	}
+
+	if visible["member_level"] {
+		member.MemberLevel = user.MemberLevel
+	}
+	if visible["earn_multiplier"] {
+		var tier models.MemberTier
+		if err := h.db.WithContext(c.UserContext()).Where("code = ?", user.MemberLevel).First(&tier).Error; err == nil {
+			member.EarnMultiplier = &tier.EarnMultiplier
+		}
+	}
+	if visible["display_name"] {
+		member.DisplayName = shortName(user)
+	}
+	return member
+}
+
+// shortName is the first name and last initial of user, e.g. "Somchai J.",
+// for showing a member to others.
+func shortName(user *models.User) string {
+	name := user.FirstName
+	if initial, _ := utf8.DecodeRuneInString(user.LastName); initial != utf8.RuneError {
+		name += " " + string(initial) + "."
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"sort"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPartnerUsage godoc
+// @Summary Get the partner's API usage
+// @Description Report the requests made with the partner's API key over an inclusive range of UTC days (default: last 30 days), in total, per day and per endpoint, with the share answered with an error. Requests turned away by the rate limit count as client errors. Any partner key can read its usage, whatever its scopes.
+// @Tags Partner
+// @Security PartnerKey
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} models.APIUsageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/usage [get]
+func (h *Handler) GetPartnerUsage(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		return err
+	}
+
+	var rows []models.APIUsage
+	err = h.db.WithContext(c.UserContext()).
+		Where("key_type = ? AND key_id = ?", models.APIKeyTypePartner, partner.ID).
+		Where("hour >= ? AND hour < ?", from, to.AddDate(0, 0, 1)).
+		Order("hour").
+		Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	resp := models.APIUsageResponse{
+		From:      from.Format(reportDateLayout),
+		To:        to.Format(reportDateLayout),
+		Days:      []models.APIUsageDay{},
+		Endpoints: []models.APIUsageEndpoint{},
+	}
+	endpoints := map[[2]string]int{}
+	for _, row := range rows {
+		addAPIUsage(&resp.APIUsageCounts, row)
+
+		day := row.Hour.UTC().Format(reportDateLayout)
+		if n := len(resp.Days); n == 0 || resp.Days[n-1].Day != day {
+			resp.Days = append(resp.Days, models.APIUsageDay{Day: day})
+		}
+		addAPIUsage(&resp.Days[len(resp.Days)-1].APIUsageCounts, row)
+
+		key := [2]string{row.Method, row.Route}
+		i, ok := endpoints[key]
+		if !ok {
+			i = len(resp.Endpoints)
+			endpoints[key] = i
+			resp.Endpoints = append(resp.Endpoints, models.APIUsageEndpoint{Method: row.Method, Route: row.Route})
+		}
+		addAPIUsage(&resp.Endpoints[i].APIUsageCounts, row)
+	}
+	sort.SliceStable(resp.Endpoints, func(i, j int) bool {
+		return resp.Endpoints[i].Requests > resp.Endpoints[j].Requests
+	})
+
+	return c.JSON(resp)
+}
+
+// addAPIUsage adds the counts of row to counts and updates its error rate.
+func addAPIUsage(counts *models.APIUsageCounts, row models.APIUsage) {
+	counts.Requests += row.Requests
+	counts.ClientErrors += row.ClientErrors
+	counts.ServerErrors += row.ServerErrors
+	if counts.Requests > 0 {
+		counts.ErrorRate = float64(counts.ClientErrors+counts.ServerErrors) / float64(counts.Requests)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestPartnerUsage(t *testing.T) {
+	const lookup = "/api/v1/partner/members/:membership_id"
+	tests := []struct {
+		name   string
+		scopes []string
+		// requests are made with the partner's key before the usage is read
+		requests func(t *testing.T, env *testutil.Env, key string, member models.User)
+		want     models.APIUsageCounts
+		lookups  *models.APIUsageCounts
+	}{
+		{
+			name:     "no requests",
+			scopes:   []string{"members:read"},
+			requests: func(*testing.T, *testutil.Env, string, models.User) {},
+		},
+		{
+			name:   "lookups and misses",
+			scopes: []string{"members:read"},
+			requests: func(t *testing.T, env *testutil.Env, key string, member models.User) {
+				partnerRequest(t, env, key, "/api/v1/partner/members/"+member.MembershipID, http.StatusOK)
+				partnerRequest(t, env, key, "/api/v1/partner/members/"+member.MembershipID, http.StatusOK)
+				partnerRequest(t, env, key, "/api/v1/partner/members/LBK99999", http.StatusNotFound)
+			},
+			want:    models.APIUsageCounts{Requests: 3, ClientErrors: 1, ErrorRate: 1.0 / 3},
+			lookups: &models.APIUsageCounts{Requests: 3, ClientErrors: 1, ErrorRate: 1.0 / 3},
+		},
+		{
+			name:   "usage reads count, requests without the scope do not",
+			scopes: []string{"points:earn"},
+			requests: func(t *testing.T, env *testutil.Env, key string, member models.User) {
+				partnerRequest(t, env, key, "/api/v1/partner/members/"+member.MembershipID, http.StatusForbidden)
+				partnerRequest(t, env, key, "/api/v1/partner/usage", http.StatusOK)
+			},
+			want: models.APIUsageCounts{Requests: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			member := testutil.CreateUser(t, env.DB)
+			partner, key := testutil.CreatePartner(t, env.DB, tt.scopes...)
+			// Another partner's requests are not counted
+			_, otherKey := testutil.CreatePartner(t, env.DB, "members:read")
+			partnerRequest(t, env, otherKey, "/api/v1/partner/members/"+member.MembershipID, http.StatusOK)
+
+			tt.requests(t, env, key, member)
+
+			var usage models.APIUsageResponse
+			if err := json.Unmarshal([]byte(partnerRequest(t, env, key, "/api/v1/partner/usage", http.StatusOK)), &usage); err != nil {
+				t.Fatal(err)
+			}
+			if usage.APIUsageCounts != tt.want {
+				t.Errorf("usage %+v, want %+v", usage.APIUsageCounts, tt.want)
+			}
+			if tt.want.Requests > 0 && (len(usage.Days) != 1 || usage.Days[0].APIUsageCounts != tt.want) {
+				t.Errorf("days %+v, want one day of %+v", usage.Days, tt.want)
+			}
+			var lookups *models.APIUsageCounts
+			for _, endpoint := range usage.Endpoints {
+				if endpoint.Method == http.MethodGet && endpoint.Route == lookup {
+					lookups = &endpoint.APIUsageCounts
+				}
+			}
+			if (lookups == nil) != (tt.lookups == nil) || lookups != nil && *lookups != *tt.lookups {
+				t.Errorf("endpoints %+v, want %s with %+v", usage.Endpoints, lookup, tt.lookups)
+			}
+
+			// The admin report counts the partner's usage, this read included
+			admin := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Role = models.RoleAdmin })
+			status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/admin/reports/api_usage", "", testutil.AuthHeader(t, admin))
+			if status != http.StatusOK {
+				t.Fatalf("report: status %d: %s", status, body)
+			}
+			var report models.ReportResponse
+			if err := json.Unmarshal([]byte(body), &report); err != nil {
+				t.Fatal(err)
+			}
+			requests := -1
+			for _, row := range report.Rows {
+				if row["key_type"] == models.APIKeyTypePartner && row["name"] == partner.Name {
+					requests = int(row["requests"].(float64))
+				}
+			}
+			if requests != tt.want.Requests+1 {
+				t.Errorf("report rows %v, want %s with %d requests", report.Rows, partner.Name, tt.want.Requests+1)
+			}
+		})
+	}
+}
+
+// partnerRequest makes a GET request with a partner key and returns the body.
+func partnerRequest(t *testing.T, env *testutil.Env, key, path string, want int) string {
+	t.Helper()
+
+	status, body := testutil.RequestWithHeaders(t, env.App, http.MethodGet, path, "", map[string]string{"X-API-Key": key})
+	if status != want {
+		t.Fatalf("GET %s: status %d, want %d: %s", path, status, want, body)
+	}
+	return body
+}
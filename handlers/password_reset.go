@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordResetTTL      = time.Hour
+	passwordResetCooldown = time.Minute
+)
+
+// ForgotPassword godoc
+// @Summary Request a password reset email
+// @Description Email a single-use link to reset the password, valid for one hour. The response is the same whether or not an account exists for the address.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Router /api/v1/auth/forgot-password [post]
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	var req models.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"email": req.Email}); len(fields) > 0 {
+		return models.NewValidationError("Email is required", fields)
+	}
+
+	// Never reveal whether the account exists
+	response := fiber.Map{
+		"message": "If an account exists for this email, a reset link has been sent",
+	}
+
+	email := normalize.Email(req.Email)
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).
+		Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", normalize.CanonicalEmail(email), email).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(response)
+	}
+	if err != nil {
+		return err
+	}
+
+	var recent int64
+	h.db.WithContext(c.UserContext()).Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-passwordResetCooldown)).
+		Count(&recent)
+	if recent > 0 {
+		return c.JSON(response)
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		// Only the newest link works
+		err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND consumed_at IS NULL", user.ID).
+			Update("consumed_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: hashCode(token),
+			ExpiresAt: time.Now().Add(passwordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	err = h.notify.EmailTemplate(h.db.WithContext(c.UserContext()), h.cfg.BaseURL(), &user, models.NotificationCategoryAccount, mailer.TemplatePasswordReset, mailer.PasswordResetData{
+		Name: user.FirstName,
+		Link: emailLink(h.cfg.BaseURL(), h.cfg.PasswordResetURL, "/api/v1/auth/reset-password", token),
+	})
+	if err != nil {
+		middleware.Logf(c, "[auth] password reset email for user %d not sent: %v", user.ID, err)
+	}
+
+	return c.JSON(response)
+}
+
+// randomToken returns a random URL-safe token for emailed links.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// emailLink builds the link for an emailed token. It points at page, the
+// app page that posts the token to the API, or at the API path under
+// baseURL when page is empty.
+func emailLink(baseURL, page, path, token string) string {
+	base := page
+	if base == "" {
+		base = baseURL + path
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// ResetPassword godoc
+// @Summary Reset the password
+// @Description Set a new password with the token from the reset email. The token works once. All tokens of the account are revoked, so every session has to log in again.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Router /api/v1/auth/reset-password [post]
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	fields := requiredFields(map[string]string{
+		"token":    req.Token,
+		"password": req.Password,
+	})
+	if problem := passwordProblem(req.Password); req.Password != "" && problem != "" {
+		fields["password"] = problem
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid password reset", fields)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.cfg.BcryptCost)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to hash password")
+	}
+
+	now := time.Now()
+	var reset models.PasswordReset
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ?", hashCode(req.Token), now).
+			First(&reset).Error
+		if err != nil {
+			return err
+		}
+
+		// The consumed_at condition keeps two concurrent resets with the
+		// same token from both succeeding
+		result := tx.Model(&reset).Where("consumed_at IS NULL").Update("consumed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		result = tx.Model(&models.User{}).Where("id = ?", reset.UserID).Update("password", string(hashedPassword))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := middleware.RevokeUserTokens(tx, reset.UserID); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", reset.UserID),
+			Action:     "password.reset",
+			Resource:   "users",
+			ResourceID: reset.UserID,
+			Fields:     []string{"password"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidLink, "Reset link is invalid or has expired")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset",
+	})
+}
@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"temp-backend-at-kbtg/testutil"
+)
+
+var resetTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	env := testutil.NewEnv(t)
+	user := testutil.CreateUser(t, env.DB, testutil.WithEmail("reset@example.com"))
+
+	status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/auth/forgot-password", `{"email":"Reset@Example.com"}`, "")
+	if status != http.StatusOK {
+		t.Fatalf("forgot password: status %d: %s", status, body)
+	}
+	sent := env.Mailer.Messages()
+	if len(sent) != 1 || sent[0].To != user.Email {
+		t.Fatalf("sent %+v, want one email to %s", sent, user.Email)
+	}
+	match := resetTokenPattern.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("no reset link in %q", sent[0].Body)
+	}
+	token := match[1]
+
+	tests := []struct {
+		name       string
+		token      string
+		password   string
+		wantStatus int
+	}{
+		{name: "unknown token", token: "not-a-token", password: "new-secret", wantStatus: http.StatusBadRequest},
+		{name: "password too short", token: token, password: "short", wantStatus: http.StatusBadRequest},
+		{name: "emailed token", token: token, password: "new-secret", wantStatus: http.StatusOK},
+		{name: "token used twice", token: token, password: "other-secret", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/auth/reset-password",
+				fmt.Sprintf(`{"token":%q,"password":%q}`, tt.token, tt.password), "")
+			if status != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+		})
+	}
+
+	status, body = testutil.Request(t, env.App, http.MethodPost, "/api/v1/auth/login", `{"email":"reset@example.com","password":"new-secret"}`, "")
+	if status != http.StatusOK {
+		t.Errorf("login with the new password: status %d: %s", status, body)
+	}
+
+	// Unknown addresses get the same answer and no email
+	status, _ = testutil.Request(t, env.App, http.MethodPost, "/api/v1/auth/forgot-password", `{"email":"nobody@example.com"}`, "")
+	if status != http.StatusOK || len(env.Mailer.Messages()) != 1 {
+		t.Errorf("unknown address: status %d, %d emails, want 200 and no new email", status, len(env.Mailer.Messages()))
+	}
+}
+
+func TestEmailLinksIgnoreTheHostHeader(t *testing.T) {
+	env := testutil.NewEnv(t)
+	env.Config.PublicURL = "https://loyalty.example.com/"
+	testutil.CreateUser(t, env.DB, testutil.WithEmail("reset@example.com"))
+	forged := map[string]string{
+		"Host":             "attacker.example",
+		"X-Forwarded-Host": "attacker.example",
+		"Content-Type":     "application/json",
+	}
+
+	status, body := testutil.RequestWithHeaders(t, env.App, http.MethodPost, "/api/v1/auth/forgot-password", `{"email":"reset@example.com"}`, forged)
+	if status != http.StatusOK {
+		t.Fatalf("forgot password: status %d: %s", status, body)
+	}
+	status, body = testutil.RequestWithHeaders(t, env.App, http.MethodPost, "/api/v1/auth/register",
+		`{"email":"new@example.com","password":"secret123","first_name":"Somchai","last_name":"Jaidee"}`, forged)
+	if status != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", status, body)
+	}
+
+	links := []string{
+		"https://loyalty.example.com/api/v1/auth/reset-password?token=",
+		"https://loyalty.example.com/api/v1/auth/verify-email?token=",
+	}
+	sent := env.Mailer.Messages()
+	if len(sent) < len(links) {
+		t.Fatalf("sent %d emails, want %d", len(sent), len(links))
+	}
+	for i, link := range links {
+		if strings.Contains(sent[i].Body, "attacker.example") || !strings.Contains(sent[i].Body, link) {
+			t.Errorf("email %d links elsewhere than %s: %q", i, link, sent[i].Body)
+		}
+	}
+}
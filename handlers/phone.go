@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/sms"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	phoneCodeTTL         = 10 * time.Minute
+	phoneCodeCooldown    = time.Minute
+	phoneCodeMaxAttempts = 5
+)
+
+// errCodeConsumed is returned from a transaction that lost the race to
+// consume a verification code.
+var errCodeConsumed = errors.New("code already used")
+
+// RequestPhoneVerification godoc
+// @Summary Send phone verification code
+// @Description Send a 6-digit code by SMS to the phone number on the current user's profile. One code per minute; 429 also when the account has had its hourly limit of text messages.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/profile/phone/verification [post]
+func (h *Handler) RequestPhoneVerification(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	if user.Phone == "" {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Add a phone number to your profile first")
+	}
+	if user.PhoneVerifiedAt != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Phone number is already verified")
+	}
+
+	var recent int64
+	h.db.WithContext(c.UserContext()).Model(&models.PhoneVerification{}).
+		Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-phoneCodeCooldown)).
+		Count(&recent)
+	if recent > 0 {
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeRateLimited, "Please wait before requesting another code")
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to generate code")
+	}
+
+	verification := models.PhoneVerification{
+		UserID:    userID,
+		Phone:     user.Phone,
+		CodeHash:  hashCode(code),
+		ExpiresAt: time.Now().Add(phoneCodeTTL),
+	}
+	if err := h.db.WithContext(c.UserContext()).Create(&verification).Error; err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to create verification")
+	}
+
+	err = sms.Send(h.sms, h.db.WithContext(c.UserContext()), userID, user.Phone, models.SMSPurposePhoneVerification, fmt.Sprintf("Your verification code is %s", code))
+	if errors.Is(err, sms.ErrRateLimited) {
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeRateLimited, "Too many text messages sent to this account, try again later")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Failed to send verification code")
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Verification code sent",
+		"expires_at": verification.ExpiresAt,
+	})
+}
+
+// ConfirmPhoneVerification godoc
+// @Summary Confirm phone verification code
+// @Description Verify the current user's phone number with the code sent by SMS. If another account has already verified the number, the request fails with 409 unless claim is true, in which case the number is detached from the other account. Both accounts are audited.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param verification body models.ConfirmPhoneRequest true "Verification code"
+// @Success 200 {object} models.ProfileResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/profile/phone/verification/confirm [post]
+func (h *Handler) ConfirmPhoneVerification(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.ConfirmPhoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	var verification models.PhoneVerification
+	err := h.db.WithContext(c.UserContext()).
+		Where("user_id = ? AND phone = ? AND consumed_at IS NULL AND expires_at > ?", userID, user.Phone, time.Now()).
+		Order("id DESC").
+		First(&verification).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "No pending verification for this phone number")
+	}
+
+	// Reserve an attempt before comparing, so that concurrent guesses
+	// cannot all be checked against the same count
+	result := h.db.WithContext(c.UserContext()).Model(&models.PhoneVerification{}).
+		Where("id = ? AND attempts < ?", verification.ID, phoneCodeMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeTooManyAttempts, "Too many attempts, request a new code")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(req.Code)), []byte(verification.CodeHash)) != 1 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidCode, "Invalid code")
+	}
+
+	var owner models.User
+	err = h.db.WithContext(c.UserContext()).Where("phone = ? AND phone_verified_at IS NOT NULL AND id <> ?", user.Phone, userID).First(&owner).Error
+	hasOwner := err == nil
+	if hasOwner && !req.Claim {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Phone number is verified on another account; confirm with claim=true to move it to this account")
+	}
+
+	now := time.Now()
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		action := "phone.verify"
+		if hasOwner {
+			action = "phone.claim"
+			err := tx.Model(&owner).Updates(map[string]interface{}{"phone": "", "phone_verified_at": nil}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&models.AuditLog{
+				Actor:      fmt.Sprintf("user:%d", userID),
+				Action:     "phone.detach",
+				Resource:   "users",
+				ResourceID: owner.ID,
+				Fields:     []string{"phone", "phone_verified_at"},
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&user).Update("phone_verified_at", now).Error; err != nil {
+			return err
+		}
+		// Consume the code only once, even with concurrent requests
+		consumed := tx.Model(&verification).Where("consumed_at IS NULL").Update("consumed_at", now)
+		if consumed.Error != nil {
+			return consumed.Error
+		}
+		if consumed.RowsAffected == 0 {
+			return errCodeConsumed
+		}
+		err := tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", userID),
+			Action:     action,
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"phone_verified_at"},
+		}).Error
+		if err != nil {
+			return err
+		}
+		_, err = campaign.Award(tx, &user, models.CampaignEventPhoneVerified)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Phone number is verified on another account")
+	}
+	if errors.Is(err, errCodeConsumed) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "No pending verification for this phone number")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to verify phone number")
+	}
+	h.cache.InvalidateUser(c.UserContext(), userID)
+	if hasOwner {
+		h.cache.InvalidateUser(c.UserContext(), owner.ID)
+	}
+
+	return c.JSON(models.ProfileResponse{
+		User: user,
+	})
+}
+
+// generateCode returns a random 6-digit numeric code.
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
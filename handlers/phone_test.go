@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+var phoneCodePattern = regexp.MustCompile(`\b(\d{6})\b`)
+
+func TestPhoneVerification(t *testing.T) {
+	env := testutil.NewEnv(t)
+	user := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Phone = "+66891234567" })
+	auth := testutil.AuthHeader(t, user)
+
+	status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/profile/phone/verification", "", auth)
+	if status != http.StatusOK {
+		t.Fatalf("request code: status %d: %s", status, body)
+	}
+	sent := env.SMS.Messages()
+	if len(sent) != 1 || sent[0].To != user.Phone {
+		t.Fatalf("sent %+v, want one message to %s", sent, user.Phone)
+	}
+	match := phoneCodePattern.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("no code in %q", sent[0].Body)
+	}
+	code := match[1]
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+	}{
+		{name: "wrong code", code: wrong, wantStatus: http.StatusBadRequest},
+		{name: "texted code", code: code, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/profile/phone/verification/confirm", fmt.Sprintf(`{"code":%q}`, tt.code), auth)
+			if status != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+		})
+	}
+
+	var verified models.User
+	if err := env.DB.First(&verified, user.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if verified.PhoneVerifiedAt == nil {
+		t.Error("phone not verified")
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPointsHistory godoc
+// @Summary Get points history
+// @Description List the current user's points transactions, newest first. Each entry has a signed amount, the reason and the balance after it was applied; type is earn, redeem, adjust or expire.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param filter[type] query string false "earn, redeem, adjust or expire"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Entries per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.PointTransaction}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/points/history [get]
+func (h *Handler) GetPointsHistory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, service.HistoryPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.points.History(c.UserContext(), userID, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// headerIdempotencyKey identifies a request so retries of it take effect once.
+const headerIdempotencyKey = "Idempotency-Key"
+
+// EarnPoints godoc
+// @Summary Credit points to a member
+// @Description Credit points to a member, e.g. for a purchase at the point of sale. Requires the points:earn scope. The Idempotency-Key header identifies the request: a retry with the same key and body returns the original transaction with Idempotent-Replayed: true instead of crediting again, and the same key with a different body is rejected.
+// @Tags Partner
+// @Security PartnerKey
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string true "Unique key for this credit, e.g. the order ID"
+// @Param request body models.EarnPointsRequest true "Member, points and what they are for"
+// @Success 200 {object} models.EarnPointsResponse "Replay of an earlier request"
+// @Success 201 {object} models.EarnPointsResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/points/earn [post]
+func (h *Handler) EarnPoints(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+
+	key, err := idempotencyKey(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.EarnPointsRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	result, err := h.points.Earn(c.UserContext(), partner, key, req)
+	if err != nil {
+		return err
+	}
+
+	response := models.EarnPointsResponse{
+		MembershipID: result.User.MembershipID,
+		Transaction:  *result.Transaction,
+	}
+	if result.Replayed {
+		c.Set("Idempotent-Replayed", "true")
+		return c.JSON(response)
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// idempotencyKey returns the required Idempotency-Key header of c.
+func idempotencyKey(c *fiber.Ctx) (string, error) {
+	key := strings.TrimSpace(c.Get(headerIdempotencyKey))
+	switch {
+	case key == "":
+		return "", models.NewValidationError("Missing Idempotency-Key", map[string]string{headerIdempotencyKey: "is required"})
+	case len(key) > 255:
+		return "", models.NewValidationError("Invalid Idempotency-Key", map[string]string{headerIdempotencyKey: "must be at most 255 characters long"})
+	}
+	return key, nil
+}
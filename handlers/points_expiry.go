@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/points"
+
+	"gorm.io/gorm"
+)
+
+// ExpirePoints is the scheduled points expiry job. It takes the points left
+// in lots past their expiry date off the members' balances, telling them in
+// the notification center, and, when
+// points.expiry_notice_days is set, tells members about points that expire
+// within that many days. Every member is handled in a transaction of their
+// own with their balance locked, so a run that fails part way, or runs on
+// several instances at once, expires nothing twice.
+func (h *Handler) ExpirePoints(ctx context.Context) error {
+	cfg := h.cfg.Points
+	db := h.db.WithContext(ctx)
+	now := time.Now()
+
+	var userIDs []uint
+	err := db.Model(&models.PointTransaction{}).
+		Where("remaining > 0 AND expires_at <= ?", now).
+		Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	expired, members := 0, 0
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var entry *models.PointTransaction
+		err := db.Transaction(func(tx *gorm.DB) error {
+			user := models.User{ID: userID}
+			var err error
+			entry, err = points.Expire(tx, &user, now)
+			if err != nil || entry == nil {
+				return err
+			}
+			return notify.Inbox(tx, userID, models.NotificationCategoryPoints, "Your points have expired",
+				fmt.Sprintf("%d points reached their expiry date and were taken off your balance.", -entry.Amount))
+		})
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Deleted accounts keep their lots until they are restored
+		case err != nil:
+			errs = append(errs, fmt.Errorf("expiring points of user %d: %w", userID, err))
+		case entry != nil:
+			h.cache.InvalidateUser(ctx, userID)
+			expired -= entry.Amount
+			members++
+		}
+	}
+	if members > 0 {
+		log.Printf("[points] expired %d points of %d members", expired, members)
+	}
+
+	if cfg.ExpiryNoticeDays > 0 {
+		if err := h.sendExpiryNotices(ctx, now, now.AddDate(0, 0, cfg.ExpiryNoticeDays)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendExpiryNotices emails and pushes a notice to every member with points
+// that expire between now and until and were not announced yet. The lots are
+// marked before the notice goes out, so a member hears about each lot once
+// even when the notice cannot be delivered.
+func (h *Handler) sendExpiryNotices(ctx context.Context, now, until time.Time) error {
+	db := h.db.WithContext(ctx)
+	due := db.Where("remaining > 0 AND expires_at > ? AND expires_at <= ? AND expiry_notice_at IS NULL", now, until)
+
+	var userIDs []uint
+	if err := due.Session(&gorm.Session{}).Model(&models.PointTransaction{}).Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	baseURL := h.cfg.BaseURL()
+	sent := 0
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			continue
+		}
+
+		var lots []models.PointTransaction
+		if err := due.Session(&gorm.Session{}).Where("user_id = ?", userID).Find(&lots).Error; err != nil {
+			return err
+		}
+		ids := make([]uint, len(lots))
+		total, soonest := 0, until
+		for i, lot := range lots {
+			ids[i] = lot.ID
+			total += lot.Remaining
+			if lot.ExpiresAt.Before(soonest) {
+				soonest = *lot.ExpiresAt
+			}
+		}
+
+		// Another instance running the job at the same time claims the
+		// lots first and sends the notice instead
+		claim := db.Model(&models.PointTransaction{}).
+			Where("id IN ? AND expiry_notice_at IS NULL", ids).
+			Update("expiry_notice_at", now)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		subject := "Your points are about to expire"
+		body := fmt.Sprintf("%d of your points expire on %s. Redeem them for a reward before then.",
+			total, soonest.Format("2 January 2006"))
+		if err := notify.Inbox(db, user.ID, models.NotificationCategoryPoints, subject, body); err != nil {
+			log.Printf("[points] expiry notice notification for user %d not created: %v", user.ID, err)
+		}
+		if err := h.notify.Email(h.db, baseURL, &user, models.NotificationCategoryPoints, subject, body); err != nil {
+			log.Printf("[points] expiry notice email for user %d not sent: %v", user.ID, err)
+		}
+		if _, err := h.notify.Push(h.db, &user, models.NotificationCategoryPoints, subject, body); err != nil {
+			log.Printf("[points] expiry notice push for user %d not sent: %v", user.ID, err)
+		}
+		if _, err := h.notify.SMS(h.db, &user, models.NotificationCategoryPoints, body); err != nil && !errors.Is(err, notify.ErrOptedOut) {
+			log.Printf("[points] expiry notice SMS for user %d not sent: %v", user.ID, err)
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("[points] sent %d expiry notices", sent)
+	}
+	return nil
+}
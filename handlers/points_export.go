@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/tenant"
+	"temp-backend-at-kbtg/xlsx"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// pointsExportColumns are the columns of a points history export.
+var pointsExportColumns = []string{"id", "created_at", "type", "amount", "balance_after", "reason", "reference", "expires_at"}
+
+// ExportPointsHistory godoc
+// @Summary Export points history
+// @Description Download the current user's points transactions between two dates (inclusive, UTC; by default since the account was created until today), oldest first, as a CSV or Excel file. The file is streamed, so whole histories can be exported at once.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "csv (default) or xlsx"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/points/history/export [get]
+func (h *Handler) ExportPointsHistory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		return models.NewValidationError("Invalid export format", map[string]string{"format": "must be csv or xlsx"})
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Select("id", "created_at").First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	fields := map[string]string{}
+	from, err := parseReportDate(c.Query("from"), user.CreatedAt.UTC().Truncate(24*time.Hour))
+	if err != nil {
+		fields["from"] = "must be a date (YYYY-MM-DD)"
+	}
+	to, err := parseReportDate(c.Query("to"), time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		fields["to"] = "must be a date (YYYY-MM-DD)"
+	}
+	if len(fields) == 0 && to.Before(from) {
+		fields["to"] = "must not be before from"
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid date range", fields)
+	}
+
+	filename := fmt.Sprintf("points_history_%s_%s.%s", from.Format(reportDateLayout), to.Format(reportDateLayout), format)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if format == "xlsx" {
+		c.Set(fiber.HeaderContentType, xlsx.ContentType)
+	} else {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	}
+
+	// The rows are read while the response is sent, after the handler has
+	// returned, so the query cannot use the request context; it keeps the
+	// tenant of the request
+	ctx := tenant.NewContext(context.Background(), tenant.FromContext(c.UserContext()))
+	query := h.db.WithContext(ctx).Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, from, to.AddDate(0, 0, 1))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if format == "xlsx" {
+			err = writePointsXLSX(w, query)
+		} else {
+			err = writePointsCSV(w, query)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		// The status has been sent; a failed export ends as a truncated file
+		if err != nil {
+			log.Printf("[points] history export for user %d failed: %v", userID, err)
+		}
+	})
+	return nil
+}
+
+// exportBatch is how many transactions an export reads at a time.
+const exportBatch = 500
+
+func writePointsCSV(w *bufio.Writer, query *gorm.DB) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(pointsExportColumns); err != nil {
+		return err
+	}
+
+	var entries []models.PointTransaction
+	err := query.FindInBatches(&entries, exportBatch, func(*gorm.DB, int) error {
+		for _, entry := range entries {
+			expiresAt := ""
+			if entry.ExpiresAt != nil {
+				expiresAt = entry.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+			err := cw.Write([]string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				entry.Type,
+				strconv.Itoa(entry.Amount),
+				strconv.Itoa(entry.BalanceAfter),
+				csvText(entry.Reason),
+				csvText(entry.Reference),
+				expiresAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		return w.Flush()
+	}).Error
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writePointsXLSX(w *bufio.Writer, query *gorm.DB) error {
+	xw, err := xlsx.NewWriter(w, "Points history")
+	if err != nil {
+		return err
+	}
+	header := make([]interface{}, len(pointsExportColumns))
+	for i, column := range pointsExportColumns {
+		header[i] = column
+	}
+	if err := xw.WriteRow(header...); err != nil {
+		return err
+	}
+
+	var entries []models.PointTransaction
+	err = query.FindInBatches(&entries, exportBatch, func(*gorm.DB, int) error {
+		for _, entry := range entries {
+			var expiresAt interface{}
+			if entry.ExpiresAt != nil {
+				expiresAt = *entry.ExpiresAt
+			}
+			err := xw.WriteRow(entry.ID, entry.CreatedAt, entry.Type, entry.Amount, entry.BalanceAfter,
+				entry.Reason, entry.Reference, expiresAt)
+			if err != nil {
+				return err
+			}
+		}
+		if err := xw.Flush(); err != nil {
+			return err
+		}
+		return w.Flush()
+	}).Error
+	if err != nil {
+		return err
+	}
+	return xw.Close()
+}
+
+// csvText keeps spreadsheets from running text that starts like a formula,
+// such as a reason partners or admins wrote, by prefixing a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/points"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// reconciliationPages are the sort and filter keys of GET
+// /admin/points/reconciliations.
+var reconciliationPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "mismatches": "mismatches"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"policy": "policy"},
+}
+
+// ReconcilePoints is the scheduled reconciliation job. It compares every
+// member's balance with the total of their ledger and the balance after
+// their latest entry, records the run and each mismatch, and with
+// points.reconcile_policy fix corrects balances the ledger accounts for.
+// Every member is compared in a transaction of their own with their balance
+// locked, so entries posted meanwhile are not taken for mismatches.
+func (h *Handler) ReconcilePoints(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	fix := h.cfg.Points.ReconcilePolicy == "fix"
+
+	run := models.PointsReconciliation{Policy: h.cfg.Points.ReconcilePolicy}
+	if err := db.Create(&run).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	var users []models.User
+	err := db.Select("id").FindInBatches(&users, 500, func(*gorm.DB, int) error {
+		for i := range users {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var mismatch *models.PointsMismatch
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				mismatch, err = points.Reconcile(tx, &users[i], fix)
+				if err != nil || mismatch == nil {
+					return err
+				}
+				mismatch.ReconciliationID = run.ID
+				if err := tx.Create(mismatch).Error; err != nil {
+					return err
+				}
+				if !mismatch.Fixed {
+					return nil
+				}
+				return tx.Create(&models.AuditLog{
+					Actor:      "job:points.reconcile",
+					Action:     "points.reconcile",
+					Resource:   "users",
+					ResourceID: users[i].ID,
+					Fields:     []string{"points"},
+				}).Error
+			})
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("reconciling the points of user %d: %w", users[i].ID, err))
+				continue
+			case mismatch != nil && mismatch.Fixed:
+				h.cache.InvalidateUser(ctx, users[i].ID)
+				run.Fixed++
+				run.Mismatches++
+			case mismatch != nil:
+				run.Mismatches++
+			}
+			run.Members++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// A run that missed members is recorded unfinished
+	updates := map[string]interface{}{"members": run.Members, "mismatches": run.Mismatches, "fixed": run.Fixed}
+	if len(errs) == 0 {
+		updates["finished_at"] = time.Now()
+	}
+	if err := h.db.Model(&run).Updates(updates).Error; err != nil {
+		errs = append(errs, err)
+	}
+
+	if run.Mismatches > 0 {
+		log.Printf("[points] reconciliation %d found %d of %d balances out of step with the ledger and fixed %d",
+			run.ID, run.Mismatches, run.Members, run.Fixed)
+	}
+	return errors.Join(errs...)
+}
+
+// ListPointsReconciliations godoc
+// @Summary List points reconciliations
+// @Description List the runs of the nightly job that compares every member's balance with their points ledger, newest first, with how many balances were compared, found out of step and fixed. Runs still going or that failed part way have no finished_at.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[policy] query string false "flag or fix"
+// @Param sort query string false "id or mismatches, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Runs per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.PointsReconciliation}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/points/reconciliations [get]
+func (h *Handler) ListPointsReconciliations(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, reconciliationPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.PointsReconciliation](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// GetPointsReconciliation godoc
+// @Summary Get a points reconciliation
+// @Description Report a run of the reconciliation job with every balance it found out of step: users.points as found, the total of the member's ledger, the balance after their latest entry and whether the run set the balance to the ledger's total. Balances are only fixed with points.reconcile_policy fix, and only where the ledger adds up to its latest balance; the others are left for an admin to investigate.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Reconciliation ID"
+// @Success 200 {object} models.PointsReconciliation
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/points/reconciliations/{id} [get]
+func (h *Handler) GetPointsReconciliation(c *fiber.Ctx) error {
+	var run models.PointsReconciliation
+	err := h.db.WithContext(c.UserContext()).
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&run, c.Params("id")).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reconciliation not found")
+	}
+
+	return c.JSON(run)
+}
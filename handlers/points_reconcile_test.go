@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+func TestReconcilePoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// corrupt breaks the account of a member holding 150 points in
+		// two entries, the latest of which is last
+		corrupt func(db *gorm.DB, user models.User, last models.PointTransaction)
+		want    *models.PointsMismatch
+		balance int
+	}{
+		{name: "in step", policy: "fix", balance: 150},
+		{
+			name:    "balance off, flagged",
+			policy:  "flag",
+			corrupt: func(db *gorm.DB, user models.User, _ models.PointTransaction) { db.Model(&user).Update("points", 400) },
+			want:    &models.PointsMismatch{Balance: 400, LedgerTotal: 150, LastBalance: 150},
+			balance: 400,
+		},
+		{
+			name:    "balance off, fixed",
+			policy:  "fix",
+			corrupt: func(db *gorm.DB, user models.User, _ models.PointTransaction) { db.Model(&user).Update("points", 400) },
+			want:    &models.PointsMismatch{Balance: 400, LedgerTotal: 150, LastBalance: 150, Fixed: true},
+			balance: 150,
+		},
+		{
+			name:    "ledger that does not add up is not fixed",
+			policy:  "fix",
+			corrupt: func(db *gorm.DB, _ models.User, last models.PointTransaction) { db.Model(&last).Update("amount", 80) },
+			want:    &models.PointsMismatch{Balance: 150, LedgerTotal: 180, LastBalance: 150},
+			balance: 150,
+		},
+		{
+			// The event store still has the entry, so the balance it
+			// rebuilds stays and the ledger is left for an admin
+			name:    "entry deleted",
+			policy:  "fix",
+			corrupt: func(db *gorm.DB, _ models.User, last models.PointTransaction) { db.Delete(&last) },
+			want:    &models.PointsMismatch{Balance: 150, LedgerTotal: 100, LastBalance: 100},
+			balance: 150,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			db := env.DB
+			admin := testutil.CreateUser(t, db, func(u *models.User) { u.Role = models.RoleAdmin })
+			user := testutil.CreateUser(t, db)
+			testutil.CreateTransaction(t, db, &user)
+			last := testutil.CreateTransaction(t, db, &user, testutil.WithAmount(50))
+			if tt.corrupt != nil {
+				tt.corrupt(db, user, last)
+			}
+
+			cfg := config.Default()
+			cfg.Points.ReconcilePolicy = tt.policy
+			h := handlers.New(handlers.Deps{DB: db, Config: cfg})
+			if err := h.ReconcilePoints(context.Background()); err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			var run models.PointsReconciliation
+			status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/admin/points/reconciliations", "", testutil.AuthHeader(t, admin))
+			var page struct {
+				Items []models.PointsReconciliation `json:"items"`
+			}
+			if status != http.StatusOK || json.Unmarshal([]byte(body), &page) != nil || len(page.Items) != 1 {
+				t.Fatalf("list: status %d: %s", status, body)
+			}
+			status, body = testutil.Request(t, env.App, http.MethodGet, fmt.Sprintf("/api/v1/admin/points/reconciliations/%d", page.Items[0].ID), "", testutil.AuthHeader(t, admin))
+			if status != http.StatusOK || json.Unmarshal([]byte(body), &run) != nil {
+				t.Fatalf("get: status %d: %s", status, body)
+			}
+
+			wantMismatches, wantFixed := 0, 0
+			if tt.want != nil {
+				wantMismatches = 1
+				if tt.want.Fixed {
+					wantFixed = 1
+				}
+			}
+			if run.Policy != tt.policy || run.FinishedAt == nil || run.Members != 2 || run.Mismatches != wantMismatches || run.Fixed != wantFixed {
+				t.Errorf("run %s, want policy %s, 2 members, %d mismatches and %d fixed", body, tt.policy, wantMismatches, wantFixed)
+			}
+			if tt.want == nil {
+				if len(run.Details) != 0 {
+					t.Errorf("mismatches %+v, want none", run.Details)
+				}
+			} else if len(run.Details) != 1 {
+				t.Errorf("mismatches %+v, want one", run.Details)
+			} else {
+				got := run.Details[0]
+				want := *tt.want
+				want.ID, want.CreatedAt, want.ReconciliationID, want.UserID = got.ID, got.CreatedAt, run.ID, user.ID
+				if got != want {
+					t.Errorf("mismatch %+v, want %+v", got, want)
+				}
+			}
+
+			var stored models.User
+			if err := db.First(&stored, user.ID).Error; err != nil {
+				t.Fatalf("load user: %v", err)
+			}
+			if stored.Points != tt.balance {
+				t.Errorf("balance %d, want %d", stored.Points, tt.balance)
+			}
+			var audited int64
+			db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "points.reconcile", user.ID).Count(&audited)
+			if audited != int64(wantFixed) {
+				t.Errorf("%d audit log entries, want %d", audited, wantFixed)
+			}
+		})
+	}
+}
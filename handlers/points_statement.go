@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// SendPointsStatements is the scheduled job that emails members a statement
+// of their points in the previous month: the opening and closing balance
+// with the points earned, redeemed, expired and adjusted in between, and the
+// points that expire by the end of the current month. Members with neither
+// a balance nor movements in the month get none, nor do suspended ones. A
+// statement is recorded before it is sent, so each member gets one per
+// month even when the job runs again or on several instances.
+func (h *Handler) SendPointsStatements(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	start := end.AddDate(0, -1, 0)
+	period := start.Format("2006-01")
+	expiringBy := end.AddDate(0, 1, 0)
+
+	active := db.Model(&models.PointTransaction{}).
+		Select("user_id").
+		Where("created_at >= ? AND created_at < ?", start, end)
+	var userIDs []uint
+	err := db.Model(&models.User{}).
+		Where("suspended_at IS NULL AND (points > 0 OR id IN (?))", active).
+		Where("id NOT IN (?)", db.Model(&models.PointsStatement{}).Select("user_id").Where("period = ?", period)).
+		Order("id").Pluck("id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+
+	baseURL := h.cfg.BaseURL()
+	sent := 0
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			continue
+		}
+
+		var totals []struct {
+			Type   string
+			Amount int
+		}
+		err := db.Model(&models.PointTransaction{}).
+			Select("type, SUM(amount) AS amount").
+			Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+			Group("type").Find(&totals).Error
+		if err != nil {
+			return err
+		}
+		// The balance at the end of the month is today's less what
+		// happened since
+		var since int
+		err = db.Model(&models.PointTransaction{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("user_id = ? AND created_at >= ?", userID, end).
+			Scan(&since).Error
+		if err != nil {
+			return err
+		}
+
+		statement := models.PointsStatement{UserID: userID, Period: period, Closing: user.Points - since}
+		net := 0
+		for _, total := range totals {
+			net += total.Amount
+			switch total.Type {
+			case models.PointTransactionEarn:
+				statement.Earned += total.Amount
+			case models.PointTransactionRedeem:
+				statement.Redeemed -= total.Amount
+			case models.PointTransactionExpire:
+				statement.Expired -= total.Amount
+			default:
+				statement.Adjusted += total.Amount
+			}
+		}
+		statement.Opening = statement.Closing - net
+		if len(totals) == 0 && statement.Closing == 0 {
+			// Everything happened after the month
+			continue
+		}
+
+		var expiring int
+		err = db.Model(&models.PointTransaction{}).
+			Select("COALESCE(SUM(remaining), 0)").
+			Where("user_id = ? AND remaining > 0 AND expires_at > ? AND expires_at <= ?", userID, now, expiringBy).
+			Scan(&expiring).Error
+		if err != nil {
+			return err
+		}
+
+		claim := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&statement)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		err = h.notify.EmailTemplate(h.db, baseURL, &user, models.NotificationCategoryPoints, mailer.TemplatePointsStatement, mailer.PointsStatementData{
+			Name:         user.FirstName,
+			Period:       start.Format("January 2006"),
+			Opening:      statement.Opening,
+			Earned:       statement.Earned,
+			Redeemed:     statement.Redeemed,
+			Expired:      statement.Expired,
+			Adjusted:     statement.Adjusted,
+			Closing:      statement.Closing,
+			ExpiringSoon: expiring,
+			ExpiringBy:   expiringBy.AddDate(0, 0, -1).Format("2 January 2006"),
+		})
+		if err != nil {
+			log.Printf("[points] statement email for user %d not sent: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("[points] sent %d statements for %s", sent, period)
+	}
+	return nil
+}
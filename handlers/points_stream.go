@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamHeartbeat is how often an idle balance stream sends a comment, so
+// proxies keep the connection open and a client that went away is noticed.
+const streamHeartbeat = 25 * time.Second
+
+// StreamPoints godoc
+// @Summary Stream the points balance
+// @Description Server-sent events with the current user's points balance, for a balance display that updates as points are earned, redeemed, adjusted or expire. Each event is a balance event whose data is a BalanceUpdate: first the balance when the stream opens, then the balance after each new points transaction with the transaction. Updates arrive within a second of the transaction, whichever instance the stream is open on. Idle streams get a comment every 25 seconds. After a reconnect the first event has the current balance again.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce text/event-stream
+// @Success 200 {object} models.BalanceUpdate "A stream of balance events"
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/points/stream [get]
+func (h *Handler) StreamPoints(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	// The latest entry is read before the balance, so an entry posted in
+	// between is sent again rather than missed
+	var after uint
+	err := h.db.WithContext(c.UserContext()).Model(&models.PointTransaction{}).
+		Where("user_id = ?", userID).Select("COALESCE(MAX(id), 0)").Scan(&after).Error
+	if err != nil {
+		return err
+	}
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Select("id", "points").First(&user, userID).Error; err != nil {
+		return err
+	}
+	sub := h.balances.Subscribe(userID, after)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	// Keeps nginx from buffering the events
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		err := writeBalanceEvent(w, models.BalanceUpdate{Balance: user.Points})
+		for err == nil {
+			select {
+			case update, ok := <-sub.Updates:
+				if !ok {
+					// The server is shutting down; the client reconnects
+					return
+				}
+				err = writeBalanceEvent(w, update)
+			case <-heartbeat.C:
+				if _, err = w.WriteString(": ping\n\n"); err == nil {
+					err = w.Flush()
+				}
+			}
+		}
+		// Most often the client went away
+		log.Printf("[points] balance stream of user %d ended: %v", userID, err)
+	})
+	return nil
+}
+
+// writeBalanceEvent sends update as a balance event.
+func writeBalanceEvent(w *bufio.Writer, update models.BalanceUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: balance\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestStreamPoints(t *testing.T) {
+	env := testutil.NewEnv(t)
+	member := testutil.CreateUser(t, env.DB, testutil.WithPoints(500))
+	other := testutil.CreateUser(t, env.DB)
+
+	// The stream is only sent once the handler has returned, so it is read
+	// from a server rather than through app.Test
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go env.App.Listener(listener)
+	t.Cleanup(func() { env.App.Shutdown() })
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/api/v1/profile/points/stream", nil)
+	req.Header.Set("Authorization", testutil.AuthHeader(t, member))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	updates := make(chan models.BalanceUpdate)
+	go func() {
+		defer close(updates)
+		r := bufio.NewReader(res.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var update models.BalanceUpdate
+				if err := json.Unmarshal([]byte(data), &update); err != nil {
+					t.Errorf("event %q: %v", data, err)
+				}
+				updates <- update
+			}
+		}
+	}()
+	next := func() (models.BalanceUpdate, bool) {
+		t.Helper()
+		select {
+		case update, ok := <-updates:
+			return update, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event within 5s")
+			return models.BalanceUpdate{}, false
+		}
+	}
+	poll := func() {
+		t.Helper()
+		if err := env.Balances.Poll(context.Background(), env.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if update, _ := next(); update.Balance != 500 || update.Transaction != nil {
+		t.Errorf("first event %+v, want the balance of 500", update)
+	}
+
+	// Entries of other members are not sent; the member's are, in order
+	testutil.CreateTransaction(t, env.DB, &other)
+	testutil.CreateTransaction(t, env.DB, &member)
+	testutil.CreateTransaction(t, env.DB, &member, testutil.Redeemed(250))
+	poll()
+	poll()
+	for _, want := range []struct {
+		kind    string
+		amount  int
+		balance int
+	}{
+		{models.PointTransactionEarn, 100, 600},
+		{models.PointTransactionRedeem, -250, 350},
+	} {
+		update, _ := next()
+		if update.Balance != want.balance || update.Transaction == nil || update.Transaction.Type != want.kind || update.Transaction.Amount != want.amount {
+			t.Errorf("event %+v, want %s of %d leaving %d", update, want.kind, want.amount, want.balance)
+		}
+	}
+
+	// Closing the hub, as at shutdown, ends the stream
+	env.Balances.Close()
+	if update, ok := next(); ok {
+		t.Errorf("event %+v after close, want the end of the stream", update)
+	}
+	if n := env.Balances.Subscribers(); n != 0 {
+		t.Errorf("%d subscribers, want none", n)
+	}
+}
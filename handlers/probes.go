@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readinessChecks decide whether the instance should receive traffic. Only
+// a down check takes it out of rotation; a degraded rate limit store lets
+// requests through.
+func (h *Handler) readinessChecks() []healthCheck {
+	return []healthCheck{
+		{"database", h.checkDatabase},
+		{"rate_limit_store", checkRateLimitStore},
+		{"migrations", h.checkMigrations},
+	}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Report that the process is running and serving requests. It checks no dependencies, so a database outage does not get the instance restarted.
+// @Tags General
+// @Produce json
+// @Success 200 {object} models.ProbeResponse
+// @Router /healthz [get]
+func (h *Handler) Liveness(c *fiber.Ctx) error {
+	return c.JSON(models.ProbeResponse{Status: "ok"})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Check the database, the rate limit store and that the schema is fully migrated. Returns 503 when the instance should be taken out of rotation; an unreachable rate limit store is reported as degraded but keeps the instance ready.
+// @Tags General
+// @Produce json
+// @Success 200 {object} models.ProbeResponse
+// @Failure 503 {object} models.ProbeResponse
+// @Router /readyz [get]
+func (h *Handler) Readiness(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), healthCheckTimeout)
+	defer cancel()
+
+	var result models.ProbeResponse
+	result.Checks, result.Status = runHealthChecks(ctx, h.readinessChecks())
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	code := fiber.StatusOK
+	if result.Status == "down" {
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(result)
+}
+
+// checkMigrations reports the instance down while the database has
+// migrations pending or lacks tables or columns its models need.
+func (h *Handler) checkMigrations(ctx context.Context) (string, string) {
+	db := h.db.WithContext(ctx)
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		return "down", err.Error()
+	}
+	if len(pending) > 0 {
+		return "down", fmt.Sprintf("%d pending: %s", len(pending), strings.Join(pending, ", "))
+	}
+	missing, err := database.SchemaDrift(db)
+	if err != nil {
+		return "down", err.Error()
+	}
+	if len(missing) > 0 {
+		return "down", fmt.Sprintf("missing without a migration: %s", strings.Join(missing, ", "))
+	}
+	return "ok", ""
+}
@@ -1,34 +1,36 @@
 package handlers
 
 import (
-	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/middleware"
 	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // GetProfile godoc
 // @Summary Get user profile
-// @Description Get current user's profile information
+// @Description Get current user's profile information. It is cached for up to cache.ttl and refreshed when the profile or the points change.
 // @Tags Profile
 // @Security BearerAuth
+// @Security APIKey
 // @Produce json
 // @Success 200 {object} models.ProfileResponse
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /profile [get]
-func GetProfile(c *fiber.Ctx) error {
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile [get]
+func (h *Handler) GetProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+	user, err := h.membership.Profile(c.UserContext(), userID)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(models.ProfileResponse{
-		User: user,
+		User: *user,
 	})
 }
 
@@ -37,81 +39,148 @@ func GetProfile(c *fiber.Ctx) error {
 // @Description Update current user's profile information
 // @Tags Profile
 // @Security BearerAuth
+// @Security APIKey
 // @Accept json
 // @Produce json
 // @Param profile body models.UpdateProfileRequest true "Profile update data"
 // @Success 200 {object} models.ProfileResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /profile [put]
-func UpdateProfile(c *fiber.Ctx) error {
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile [put]
+func (h *Handler) UpdateProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	var req models.UpdateProfileRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
-	}
-
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
-	// Update user fields
-	if req.FirstName != "" {
-		user.FirstName = req.FirstName
-	}
-	if req.LastName != "" {
-		user.LastName = req.LastName
-	}
-	if req.Phone != "" {
-		user.Phone = req.Phone
-	}
-
-	// Save updated user
-	if err := database.DB.Save(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update profile",
-		})
+	user, err := h.membership.UpdateProfile(c.UserContext(), userID, req)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(models.ProfileResponse{
-		User: user,
+		User: *user,
 	})
 }
 
 // GetMembershipInfo godoc
 // @Summary Get membership information
-// @Description Get current user's membership details including points and level
+// @Description Get current user's membership details including points and level, the points earned in the tier qualifying period and the next tier with its threshold (null at the top tier). The tier name, description and benefits and the phone number format are localized from Accept-Language (en, th). The data is cached for up to cache.ttl and refreshed when the profile, points or tier change.
 // @Tags Profile
 // @Security BearerAuth
+// @Security APIKey
 // @Produce json
+// @Param Accept-Language header string false "Preferred language, e.g. th-TH"
 // @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /profile/membership [get]
-func GetMembershipInfo(c *fiber.Ctx) error {
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/membership [get]
+func (h *Handler) GetMembershipInfo(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+	info, err := h.membership.Info(c.UserContext(), userID)
+	if err != nil {
+		return err
 	}
+	user := info.User
+
+	locale := requestLocale(c)
+	c.Set(fiber.HeaderContentLanguage, locale)
+	c.Vary(fiber.HeaderAcceptLanguage)
 
 	return c.JSON(fiber.Map{
-		"membership_id": user.MembershipID,
-		"member_level":  user.MemberLevel,
-		"points":        user.Points,
-		"member_since":  user.CreatedAt.Format("2/1/2006"),
-		"full_name":     user.FirstName + " " + user.LastName,
-		"email":         user.Email,
-		"phone":         user.Phone,
+		"membership_id":     user.MembershipID,
+		"member_level":      user.MemberLevel,
+		"tier":              h.tierContent(c.UserContext(), user.MemberLevel, locale),
+		"qualifying_points": info.Qualifying,
+		"next_tier":         info.Next,
+		"points":            user.Points,
+		"member_since":      user.CreatedAt.Format("2/1/2006"),
+		"full_name":         user.FirstName + " " + user.LastName,
+		"email":             user.Email,
+		"phone":             normalize.FormatPhone(user.Phone, locale),
+	})
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the current user's password after checking the current one. Unless keep_other_sessions is true, every other session is logged out; the response carries new tokens for this session either way. A notice is emailed to the account.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param password body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/password [put]
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	fields := requiredFields(map[string]string{
+		"current_password": req.CurrentPassword,
+		"new_password":     req.NewPassword,
+	})
+	if problem := passwordProblem(req.NewPassword); req.NewPassword != "" && problem != "" {
+		fields["new_password"] = problem
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Invalid password change", fields)
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return models.NewValidationError("Current password is incorrect", map[string]string{"current_password": "is incorrect"})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.cfg.BcryptCost)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to hash password")
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		if !req.KeepOtherSessions {
+			if err := middleware.RevokeUserTokens(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "password.change",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"password"},
+		}).Error
 	})
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to change password")
+	}
+
+	body := "The password of your account was just changed. If this was not you, reset your password right away and contact support."
+	if err := h.notify.Email(h.db.WithContext(c.UserContext()), h.cfg.BaseURL(), &user, models.NotificationCategoryAccount, "Your password was changed", body); err != nil {
+		middleware.Logf(c, "[auth] password change notice for user %d not sent: %v", user.ID, err)
+	}
+
+	tokens, err := h.issueTokens(c, &user)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to generate token")
+	}
+
+	return c.JSON(tokens)
 }
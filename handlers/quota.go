@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetQuota godoc
+// @Summary Get the API quota
+// @Description Report the caller's request limit for their member level (rate_limit.tiers, else rate_limit.user), the requests made in the current window, this one included, and when the window ends; the same figures come with every profile, rewards, coupons, wallet, notifications and sync response as X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset (seconds) and X-RateLimit-Plan. A limit of 0 means no limit. API keys share the allowance of their user.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} models.Quota
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/profile/quota [get]
+func (h *Handler) GetQuota(c *fiber.Ctx) error {
+	if quota, ok := c.Locals("quota").(*models.Quota); ok {
+		return c.JSON(quota)
+	}
+
+	// The user rate limit is off or its store cannot be reached
+	level, _ := c.Locals("member_level").(string)
+	return c.JSON(models.Quota{Plan: level})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/saga"
+	"temp-backend-at-kbtg/voucher"
+
+	"gorm.io/gorm"
+)
+
+// sagaRedemption is the kind of the sagas redeeming rewards.
+const sagaRedemption = "redemption"
+
+// redemptionState is what the steps of a redemption saga pass on.
+type redemptionState struct {
+	RewardID     uint   `json:"reward_id"`
+	RedemptionID uint   `json:"redemption_id,omitempty"`
+	VoucherCode  string `json:"voucher_code,omitempty"`
+}
+
+// redemptionSaga redeems a reward in steps: the redemption is recorded as
+// processing, a unit of stock taken, the points spent, a voucher issued and
+// the member told. Out of stock and too few points fail the redemption at
+// once; other failures are tried again and, when they persist, the stock
+// and points taken are given back and the redemption marked failed.
+func (h *Handler) redemptionSaga() saga.Definition[redemptionState] {
+	return saga.Definition[redemptionState]{
+		Kind:   sagaRedemption,
+		Policy: saga.Policy{MaxAttempts: 5, RetryDelay: 30 * time.Second, MaxRetryDelay: 10 * time.Minute},
+		Steps: []saga.Step[redemptionState]{
+			{Name: "record_redemption", Do: recordRedemption, Compensate: failRedemption},
+			{Name: "reserve_stock", Do: reserveStock, Compensate: restock},
+			{Name: "spend_points", Do: spendPoints, Compensate: h.refundPoints},
+			{Name: "issue_voucher", Call: h.issueVoucher, Do: openRedemption},
+			{Name: "notify", Call: h.notifyRedeemed},
+		},
+	}
+}
+
+// ResumeSagas is the sagas.resume job. It takes up the sagas waiting for
+// another attempt and those left behind by a process that died.
+func (h *Handler) ResumeSagas(ctx context.Context) error {
+	return saga.Resume(ctx, h.db, h.sagaRunners()...)
+}
+
+// sagaRunners are the kinds of saga of the handlers.
+func (h *Handler) sagaRunners() []saga.Runner {
+	return []saga.Runner{h.redemptionSaga()}
+}
+
+// sagaRunner returns the runner of the sagas of kind.
+func (h *Handler) sagaRunner(kind string) saga.Runner {
+	switch kind {
+	case sagaRedemption:
+		return h.redemptionSaga()
+	}
+	return nil
+}
+
+func recordRedemption(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	var reward models.Reward
+	if err := tx.Where("active = ?", true).First(&reward, state.RewardID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return saga.Abort(err)
+		}
+		return err
+	}
+	redemption := models.Redemption{
+		UserID:     s.UserID,
+		RewardID:   reward.ID,
+		RewardName: reward.Name,
+		Points:     reward.Cost,
+		Status:     models.RedemptionProcessing,
+		Code:       newRedemptionCode(),
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return err
+	}
+	state.RedemptionID = redemption.ID
+	return nil
+}
+
+func failRedemption(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	return tx.Model(&models.Redemption{}).Where("id = ?", state.RedemptionID).
+		Updates(map[string]interface{}{"status": models.RedemptionFailed, "cancelled_at": time.Now()}).Error
+}
+
+func reserveStock(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	// The stock check and the decrement are one statement so two members
+	// cannot both take the last item
+	result := tx.Model(&models.Reward{}).Where("id = ? AND stock > 0", state.RewardID).
+		Update("stock", gorm.Expr("stock - 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return saga.Abort(errOutOfStock)
+	}
+	return nil
+}
+
+func restock(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	return tx.Model(&models.Reward{}).Where("id = ?", state.RewardID).
+		Update("stock", gorm.Expr("stock + 1")).Error
+}
+
+func spendPoints(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	var redemption models.Redemption
+	if err := tx.First(&redemption, state.RedemptionID).Error; err != nil {
+		return err
+	}
+	user := models.User{ID: s.UserID}
+	_, err := points.Post(tx, &user, models.PointTransaction{
+		Type:      models.PointTransactionRedeem,
+		Amount:    -redemption.Points,
+		Reason:    redemption.RewardName,
+		Reference: fmt.Sprintf("redemption:%d", redemption.ID),
+	})
+	if errors.Is(err, points.ErrInsufficientPoints) {
+		return saga.Abort(err)
+	}
+	return err
+}
+
+// refundPoints gives the points of the redemption back. The member's
+// cached profile is dropped before the refund commits, as compensations
+// have no step after them; a read in between is cached for CACHE_TTL.
+func (h *Handler) refundPoints(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	var redemption models.Redemption
+	if err := tx.First(&redemption, state.RedemptionID).Error; err != nil {
+		return err
+	}
+	user := models.User{ID: s.UserID}
+	_, err := points.Post(tx, &user, models.PointTransaction{
+		Type:      models.PointTransactionAdjust,
+		Amount:    redemption.Points,
+		Reason:    "Refund: " + redemption.RewardName,
+		Reference: fmt.Sprintf("redemption:%d", redemption.ID),
+	})
+	h.cache.InvalidateUser(tx.Statement.Context, s.UserID)
+	return err
+}
+
+// issueVoucher asks the voucher issuer for the redemption's voucher. The
+// reference is the same on every attempt, so the issuer can return the
+// voucher it issued before.
+func (h *Handler) issueVoucher(ctx context.Context, s *models.Saga, state *redemptionState) error {
+	code, err := h.vouchers.Issue(ctx, voucher.Request{
+		Reference: fmt.Sprintf("redemption:%d", state.RedemptionID),
+		RewardID:  state.RewardID,
+		UserID:    s.UserID,
+	})
+	if errors.Is(err, voucher.ErrRefused) {
+		return saga.Abort(err)
+	}
+	if err != nil {
+		return err
+	}
+	state.VoucherCode = code
+	return nil
+}
+
+// openRedemption makes the redemption pending with its voucher, ready to
+// be collected.
+func openRedemption(tx *gorm.DB, s *models.Saga, state *redemptionState) error {
+	redemption := models.Redemption{ID: state.RedemptionID}
+	err := tx.Model(&redemption).Updates(map[string]interface{}{
+		"status":       models.RedemptionPending,
+		"voucher_code": state.VoucherCode,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.First(&redemption).Error; err != nil {
+		return err
+	}
+	return events.Publish(tx, models.WebhookEventRewardRedeemed, redemption)
+}
+
+// notifyRedeemed tells the member their reward is ready to collect, and
+// drops their cached profile with the balance before the redemption.
+// Failures are only logged, so they never undo the redemption.
+func (h *Handler) notifyRedeemed(ctx context.Context, s *models.Saga, state *redemptionState) error {
+	h.cache.InvalidateUser(ctx, s.UserID)
+	db := h.db.WithContext(ctx)
+	var redemption models.Redemption
+	var user models.User
+	if db.First(&redemption, state.RedemptionID).Error != nil || db.First(&user, s.UserID).Error != nil {
+		return nil
+	}
+
+	code := redemption.Code
+	if redemption.VoucherCode != "" {
+		code = redemption.VoucherCode
+	}
+	title := "Your reward is ready"
+	body := fmt.Sprintf("Show the code %s to collect your %s.", code, redemption.RewardName)
+	if err := notify.Inbox(db, user.ID, models.NotificationCategoryAccount, title, body); err != nil {
+		log.Printf("[rewards] redemption notification for user %d not created: %v", user.ID, err)
+	}
+	if _, err := h.notify.Push(h.db.WithContext(ctx), &user, models.NotificationCategoryAccount, title, body); err != nil {
+		log.Printf("[rewards] redemption push for user %d not sent: %v", user.ID, err)
+	}
+	return nil
+}
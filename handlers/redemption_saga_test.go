@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+	"temp-backend-at-kbtg/voucher"
+)
+
+func TestRedemptionSaga(t *testing.T) {
+	unreachable := errors.New("voucher service unreachable")
+	tests := []struct {
+		name   string
+		points int
+		stock  int
+		// voucherErr fails the voucher requests of the redemption
+		voucherErr error
+		status     int
+		// then is what happens to a redemption waiting for another attempt:
+		// recover (the issuer works again, then resume), persist (it keeps
+		// failing through every resume), retry or compensate (by an admin
+		// with the issuer working again)
+		then       string
+		redemption string
+		saga       string
+		balance    int
+		notices    int
+	}{
+		{name: "redeemed", points: 500, stock: 10, status: http.StatusCreated, redemption: models.RedemptionPending, saga: models.SagaCompleted, balance: 400, notices: 1},
+		{name: "out of stock", points: 500, stock: 0, status: http.StatusConflict, redemption: models.RedemptionFailed, saga: models.SagaCompensated, balance: 500},
+		{name: "too few points", points: 50, stock: 10, status: http.StatusUnprocessableEntity, redemption: models.RedemptionFailed, saga: models.SagaCompensated, balance: 50},
+		{name: "voucher refused", points: 500, stock: 10, voucherErr: voucher.ErrRefused, status: http.StatusBadGateway, redemption: models.RedemptionFailed, saga: models.SagaCompensated, balance: 500},
+		{name: "voucher failure resumed", points: 500, stock: 10, voucherErr: unreachable, status: http.StatusAccepted, then: "recover", redemption: models.RedemptionPending, saga: models.SagaCompleted, balance: 400, notices: 1},
+		{name: "voucher failure persists", points: 500, stock: 10, voucherErr: unreachable, status: http.StatusAccepted, then: "persist", redemption: models.RedemptionFailed, saga: models.SagaCompensated, balance: 500},
+		{name: "voucher failure retried by an admin", points: 500, stock: 10, voucherErr: unreachable, status: http.StatusAccepted, then: "retry", redemption: models.RedemptionPending, saga: models.SagaCompleted, balance: 400, notices: 1},
+		{name: "voucher failure compensated by an admin", points: 500, stock: 10, voucherErr: unreachable, status: http.StatusAccepted, then: "compensate", redemption: models.RedemptionFailed, saga: models.SagaCompensated, balance: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			admin := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Role = models.RoleAdmin })
+			member := testutil.CreateUser(t, env.DB, testutil.WithPoints(tt.points))
+			reward := testutil.CreateReward(t, env.DB, func(r *models.Reward) { r.Stock = tt.stock })
+			env.Vouchers.SetErr(tt.voucherErr)
+
+			status, body := testutil.Request(t, env.App, http.MethodPost, fmt.Sprintf("/api/v1/rewards/%d/redeem", reward.ID), "", testutil.AuthHeader(t, member))
+			if status != tt.status {
+				t.Fatalf("redeem: status %d, want %d: %s", status, tt.status, body)
+			}
+
+			var s models.Saga
+			if err := env.DB.Where("user_id = ?", member.ID).First(&s).Error; err != nil {
+				t.Fatal(err)
+			}
+			if status == http.StatusAccepted {
+				if s.Status != models.SagaRunning || s.Step != "issue_voucher" || s.Attempts != 1 {
+					t.Fatalf("saga %s at %s after %d attempts, want running at issue_voucher after 1", s.Status, s.Step, s.Attempts)
+				}
+				var res models.RedeemResponse
+				if err := json.Unmarshal([]byte(body), &res); err != nil || res.Redemption.Status != models.RedemptionProcessing {
+					t.Fatalf("redemption %s, want processing: %s", res.Redemption.Status, body)
+				}
+				if stuck := stuckSagas(t, env, admin); len(stuck) != 1 || stuck[0].ID != s.ID {
+					t.Errorf("stuck sagas %v, want %d", stuck, s.ID)
+				}
+			}
+
+			h := handlers.New(handlers.Deps{DB: env.DB, Config: config.Default(), Vouchers: env.Vouchers})
+			resume := func() {
+				t.Helper()
+				env.DB.Model(&models.Saga{}).Where("id = ?", s.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+				if err := h.ResumeSagas(context.Background()); err != nil {
+					t.Fatalf("resume: %v", err)
+				}
+			}
+			switch tt.then {
+			case "recover":
+				env.Vouchers.SetErr(nil)
+				resume()
+			case "persist":
+				for i := 0; i < 5; i++ {
+					resume()
+				}
+			case "retry", "compensate":
+				env.Vouchers.SetErr(nil)
+				path := fmt.Sprintf("/api/v1/admin/sagas/%d/%s", s.ID, tt.then)
+				status, body := testutil.Request(t, env.App, http.MethodPost, path, `{"reason":"Reward discontinued"}`, testutil.AuthHeader(t, admin))
+				if status != http.StatusOK {
+					t.Fatalf("%s: status %d: %s", tt.then, status, body)
+				}
+			}
+
+			env.DB.First(&s, s.ID)
+			if s.Status != tt.saga {
+				t.Errorf("saga %s, want %s (last error %q)", s.Status, tt.saga, s.LastError)
+			}
+			var redemption models.Redemption
+			if err := env.DB.Where("user_id = ?", member.ID).First(&redemption).Error; err != nil {
+				t.Fatal(err)
+			}
+			if redemption.Status != tt.redemption {
+				t.Errorf("redemption %s, want %s", redemption.Status, tt.redemption)
+			}
+			if (redemption.VoucherCode != "") != (tt.redemption == models.RedemptionPending) {
+				t.Errorf("voucher code %q with the redemption %s", redemption.VoucherCode, redemption.Status)
+			}
+			env.DB.First(&member, member.ID)
+			if member.Points != tt.balance {
+				t.Errorf("balance %d, want %d", member.Points, tt.balance)
+			}
+			env.DB.First(&reward, reward.ID)
+			wantStock := tt.stock
+			if tt.balance < tt.points {
+				wantStock--
+			}
+			if reward.Stock != wantStock {
+				t.Errorf("stock %d, want %d", reward.Stock, wantStock)
+			}
+			var notices int64
+			env.DB.Model(&models.Notification{}).Where("user_id = ?", member.ID).Count(&notices)
+			if int(notices) != tt.notices {
+				t.Errorf("%d notifications, want %d", notices, tt.notices)
+			}
+
+			// Only sagas needing attention are stuck, and an undone saga is
+			// not taken up again
+			if stuck := stuckSagas(t, env, admin); len(stuck) != 0 {
+				t.Errorf("stuck sagas %v, want none", stuck)
+			}
+			status, body = testutil.Request(t, env.App, http.MethodPost, fmt.Sprintf("/api/v1/admin/sagas/%d/retry", s.ID), "", testutil.AuthHeader(t, admin))
+			if status != http.StatusConflict {
+				t.Errorf("retry of a %s saga: status %d, want 409: %s", s.Status, status, body)
+			}
+		})
+	}
+}
+
+func TestRedeemWhileRedeeming(t *testing.T) {
+	env := testutil.NewEnv(t)
+	member := testutil.CreateUser(t, env.DB, testutil.WithPoints(500))
+	reward := testutil.CreateReward(t, env.DB)
+
+	// Another instance is redeeming for the member
+	lease, err := env.Locks.Acquire(context.Background(), fmt.Sprintf("redeem:user:%d", member.ID), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/api/v1/rewards/%d/redeem", reward.ID)
+	status, body := testutil.Request(t, env.App, http.MethodPost, path, "", testutil.AuthHeader(t, member))
+	if status != http.StatusConflict {
+		t.Fatalf("redeem: status %d, want 409: %s", status, body)
+	}
+	var sagas int64
+	env.DB.Model(&models.Saga{}).Where("user_id = ?", member.ID).Count(&sagas)
+	if sagas != 0 {
+		t.Errorf("%d sagas, want none", sagas)
+	}
+
+	lease.Release(context.Background())
+	if status, body := testutil.Request(t, env.App, http.MethodPost, path, "", testutil.AuthHeader(t, member)); status != http.StatusCreated {
+		t.Errorf("redeem after release: status %d, want 201: %s", status, body)
+	}
+}
+
+// stuckSagas lists the sagas of GET /admin/sagas?stuck=true.
+func stuckSagas(t *testing.T, env *testutil.Env, admin models.User) []models.Saga {
+	t.Helper()
+	status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/admin/sagas?stuck=true", "", testutil.AuthHeader(t, admin))
+	if status != http.StatusOK {
+		t.Fatalf("list: status %d: %s", status, body)
+	}
+	var page struct {
+		Items []models.Saga `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(body), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page.Items
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetReferrals godoc
+// @Summary Get referral stats
+// @Description Return the current user's referral code, how many members registered with it and the bonus points paid for them, with the referred members newest first. A referral stays pending until the referred member verifies their email address.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Success 200 {object} models.ReferralStatsResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/referrals [get]
+func (h *Handler) GetReferrals(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	db := h.db.WithContext(c.UserContext())
+
+	var user models.User
+	if err := db.Select("id", "referral_code").First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	var referrals []models.Referral
+	if err := db.Where("referrer_id = ?", userID).Order("id DESC").Find(&referrals).Error; err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load referrals")
+	}
+
+	ids := make([]uint, len(referrals))
+	for i, referral := range referrals {
+		ids[i] = referral.ReferredID
+	}
+	var referred []models.User
+	if err := db.Unscoped().Select("id", "first_name", "last_name").Where("id IN ?", ids).Find(&referred).Error; err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load referrals")
+	}
+	names := make(map[uint]string, len(referred))
+	for i := range referred {
+		names[referred[i].ID] = shortName(&referred[i])
+	}
+
+	stats := models.ReferralStatsResponse{
+		ReferralCode: user.ReferralCode,
+		Referrals:    make([]models.ReferralEntry, len(referrals)),
+	}
+	for i, referral := range referrals {
+		if referral.Status == models.ReferralCompleted {
+			stats.Completed++
+		} else {
+			stats.Pending++
+		}
+		stats.PointsEarned += referral.ReferrerPoints
+		stats.Referrals[i] = models.ReferralEntry{
+			ID:          referral.ID,
+			DisplayName: names[referral.ReferredID],
+			Status:      referral.Status,
+			CreatedAt:   referral.CreatedAt,
+			CompletedAt: referral.CompletedAt,
+			Points:      referral.ReferrerPoints,
+		}
+	}
+	return c.JSON(stats)
+}
@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// refreshStep presents the refresh token saved as token and expects
+// status, with code for errors; a new token is saved as save.
+type refreshStep struct {
+	token  string
+	save   string
+	status int
+	code   string
+}
+
+func TestRefreshRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		// before runs after the logins, which are saved as "a" and "b"
+		before func(t *testing.T, app *fiber.App, db *gorm.DB, tokens map[string]string)
+		steps  []refreshStep
+		after  func(t *testing.T, db *gorm.DB)
+	}{
+		{
+			name: "rotates",
+			steps: []refreshStep{
+				{token: "a", save: "a1", status: http.StatusOK},
+				{token: "a1", save: "a2", status: http.StatusOK},
+				{token: "a2", status: http.StatusOK},
+			},
+		},
+		{
+			name: "reuse revokes the family",
+			steps: []refreshStep{
+				{token: "a", save: "a1", status: http.StatusOK},
+				{token: "a", status: http.StatusUnauthorized, code: models.CodeRefreshTokenReused},
+				{token: "a1", status: http.StatusUnauthorized, code: models.CodeInvalidRefreshToken},
+			},
+		},
+		{
+			name: "reuse leaves other sessions alone",
+			steps: []refreshStep{
+				{token: "a", save: "a1", status: http.StatusOK},
+				{token: "a", status: http.StatusUnauthorized, code: models.CodeRefreshTokenReused},
+				{token: "b", save: "b1", status: http.StatusOK},
+				{token: "b1", status: http.StatusOK},
+			},
+		},
+		{
+			name: "expired",
+			before: func(t *testing.T, _ *fiber.App, db *gorm.DB, _ map[string]string) {
+				db.Model(&models.RefreshToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+			},
+			steps: []refreshStep{{token: "a", status: http.StatusUnauthorized, code: models.CodeInvalidRefreshToken}},
+		},
+		{
+			name: "rotation keeps the expiry",
+			before: func(t *testing.T, _ *fiber.App, db *gorm.DB, _ map[string]string) {
+				db.Model(&models.RefreshToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(time.Minute))
+			},
+			steps: []refreshStep{{token: "a", save: "a1", status: http.StatusOK}},
+			after: func(t *testing.T, db *gorm.DB) {
+				var extended int64
+				db.Model(&models.RefreshToken{}).Where("expires_at > ?", time.Now().Add(2*time.Minute)).Count(&extended)
+				if extended > 0 {
+					t.Errorf("%d refresh tokens outlive their family", extended)
+				}
+			},
+		},
+		{
+			name: "logged out",
+			before: func(t *testing.T, app *fiber.App, _ *gorm.DB, tokens map[string]string) {
+				t.Helper()
+				if status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/logout", fmt.Sprintf(`{"refresh_token":%q}`, tokens["a"]), ""); status != http.StatusOK {
+					t.Fatalf("logout: status %d: %s", status, body)
+				}
+			},
+			steps: []refreshStep{
+				{token: "a", status: http.StatusUnauthorized, code: models.CodeInvalidRefreshToken},
+				{token: "b", status: http.StatusOK},
+			},
+		},
+		{
+			name:  "unknown token",
+			steps: []refreshStep{{token: "unknown", status: http.StatusUnauthorized, code: models.CodeInvalidRefreshToken}},
+		},
+		{
+			name:  "no token",
+			steps: []refreshStep{{token: "none", status: http.StatusBadRequest}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := testutil.NewApp(t)
+			user := testutil.CreateUser(t, db)
+
+			tokens := map[string]string{"unknown": "rt_unknown", "none": ""}
+			for _, session := range []string{"a", "b"} {
+				status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"email":%q,"password":%q}`, user.Email, testutil.DefaultPassword), "")
+				var resp models.AuthResponse
+				if status != http.StatusOK || json.Unmarshal([]byte(body), &resp) != nil || resp.RefreshToken == "" {
+					t.Fatalf("login: status %d: %s", status, body)
+				}
+				tokens[session] = resp.RefreshToken
+			}
+			if tt.before != nil {
+				tt.before(t, app, db, tokens)
+			}
+
+			for i, step := range tt.steps {
+				status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/refresh", fmt.Sprintf(`{"refresh_token":%q}`, tokens[step.token]), "")
+				if status != step.status {
+					t.Fatalf("step %d, token %s: status %d, want %d: %s", i+1, step.token, status, step.status, body)
+				}
+				if step.code != "" {
+					var failure models.ErrorResponse
+					if err := json.Unmarshal([]byte(body), &failure); err != nil || failure.Code != step.code {
+						t.Fatalf("step %d, token %s: error %s, want code %s", i+1, step.token, body, step.code)
+					}
+					continue
+				}
+				if status != http.StatusOK {
+					continue
+				}
+
+				var resp models.TokenResponse
+				if err := json.Unmarshal([]byte(body), &resp); err != nil {
+					t.Fatalf("decode %s: %v", body, err)
+				}
+				if resp.RefreshToken == "" || resp.RefreshToken == tokens[step.token] {
+					t.Fatalf("step %d: refresh token %q not rotated", i+1, resp.RefreshToken)
+				}
+				if status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/profile", "", "Bearer "+resp.Token); status != http.StatusOK {
+					t.Errorf("step %d: new access token refused: status %d: %s", i+1, status, body)
+				}
+				if step.save != "" {
+					tokens[step.save] = resp.RefreshToken
+				}
+			}
+			if tt.after != nil {
+				tt.after(t, db)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/saga"
+	"temp-backend-at-kbtg/voucher"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// rewardPages are the sort keys of GET /rewards.
+var rewardPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "name": "name", "cost": "cost"},
+	DefaultSort: "cost,id",
+}
+
+// redemptionPages are the sort and filter keys of GET /profile/redemptions.
+var redemptionPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"status": "status"},
+}
+
+var errOutOfStock = errors.New("reward out of stock")
+
+// ListRewards godoc
+// @Summary List rewards
+// @Description List the active rewards of the catalog, cheapest first. Rewards with stock 0 are listed but cannot be redeemed.
+// @Tags Rewards
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param sort query string false "id, name or cost, - for descending (default cost,id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Rewards per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Reward}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/rewards [get]
+func (h *Handler) ListRewards(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, rewardPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("active = ?", true)
+	page, err := pagination.Find[models.Reward](query, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// RedeemReward godoc
+// @Summary Redeem a reward
+// @Description Spend the reward's cost in points and take one from its stock, then have its voucher issued and tell the member. The steps commit one by one: a redemption that runs out of stock or points is refused and everything it took is given back. When a later step fails, such as the voucher issuer being unreachable, the answer is 202 with the redemption processing; it is tried again in the background and becomes pending once complete, or failed with the points and stock returned. A voucher the issuer refuses fails the redemption with 502. A member redeems one reward at a time: a request sent while another of theirs is being redeemed answers 409. A pending redemption is collected with its code, or its voucher_code when one was issued.
+// @Tags Rewards
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Reward ID"
+// @Success 201 {object} models.RedeemResponse
+// @Success 202 {object} models.RedeemResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/rewards/{id}/redeem [post]
+func (h *Handler) RedeemReward(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidID, "Invalid ID")
+	}
+
+	// A member redeems one reward at a time, so requests sent at once, such
+	// as a double tap, do not race each other for the last points
+	var s *models.Saga
+	lockErr := lock.Do(c.UserContext(), h.locks, fmt.Sprintf("redeem:user:%d", userID), lockTTL, func(ctx context.Context) error {
+		s, err = h.redemptionSaga().Start(ctx, h.db, userID, redemptionState{RewardID: uint(id)})
+		return nil
+	})
+	switch {
+	case errors.Is(lockErr, lock.ErrHeld):
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Another redemption of yours is in progress")
+	case lockErr != nil && s == nil && err == nil:
+		middleware.Logf(c, "[rewards] redemption lock failed: %v", lockErr)
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Redemptions are unavailable, try again later")
+	}
+	if s == nil || (s.Status != models.SagaCompleted && s.Status != models.SagaRunning) {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Reward not found")
+		case errors.Is(err, errOutOfStock):
+			return models.NewAppError(fiber.StatusConflict, models.CodeOutOfStock, "Reward is out of stock")
+		case errors.Is(err, points.ErrInsufficientPoints):
+			return models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeInsufficientPoints, "Not enough points for this reward")
+		case errors.Is(err, voucher.ErrRefused):
+			return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "No voucher could be issued for this reward")
+		default:
+			return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to redeem reward").Wrap(err)
+		}
+	}
+
+	state, err := saga.State[redemptionState](s)
+	if err != nil {
+		return err
+	}
+	db := h.db.WithContext(c.UserContext())
+	var redemption models.Redemption
+	if err := db.First(&redemption, state.RedemptionID).Error; err != nil {
+		return err
+	}
+	var user models.User
+	if err := db.Select("id", "points").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	status := fiber.StatusCreated
+	if s.Status == models.SagaRunning {
+		// A step failed and is tried again in the background
+		status = fiber.StatusAccepted
+	}
+	return c.Status(status).JSON(models.RedeemResponse{
+		Redemption: redemption,
+		Balance:    user.Points,
+	})
+}
+
+// ListRedemptions godoc
+// @Summary List my redemptions
+// @Description List the current user's reward redemptions, newest first, with their status (processing, pending, fulfilled, cancelled or failed), collection code and voucher code
+// @Tags Rewards
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param filter[status] query string false "processing, pending, fulfilled, cancelled or failed"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Redemptions per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Redemption}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/redemptions [get]
+func (h *Handler) ListRedemptions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, redemptionPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID)
+	page, err := pagination.Find[models.Redemption](query, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// newRedemptionCode returns a code such as RD7K3QMX2P that is easy to read
+// out at a counter.
+func newRedemptionCode() string {
+	return "RD" + rand.Text()[:8]
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxLoginHistory caps the entries returned by GET /profile/login-history.
+const maxLoginHistory = 50
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the current user's logins that can still be refreshed, most recently used first. The session of the calling token has current set.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.SessionResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/sessions [get]
+func (h *Handler) ListSessions(c *fiber.Ctx) error {
+	var sessions []models.Session
+	err := h.db.WithContext(c.UserContext()).
+		Where("user_id = ? AND expires_at > ?", c.Locals("user_id"), time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	responses, err := h.sessionResponses(c, sessions)
+	if err != nil {
+		return err
+	}
+
+	active := make([]models.SessionResponse, 0, len(responses))
+	for _, session := range responses {
+		if session.Active {
+			active = append(active, session)
+		}
+	}
+	return c.JSON(active)
+}
+
+// GetLoginHistory godoc
+// @Summary List recent logins
+// @Description List the current user's 50 most recent logins with IP address and user agent, including sessions that have ended. Ended sessions are kept for 90 days after they expire.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.SessionResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/login-history [get]
+func (h *Handler) GetLoginHistory(c *fiber.Ctx) error {
+	var sessions []models.Session
+	err := h.db.WithContext(c.UserContext()).
+		Where("user_id = ?", c.Locals("user_id")).
+		Order("created_at DESC").
+		Limit(maxLoginHistory).
+		Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	responses, err := h.sessionResponses(c, sessions)
+	if err != nil {
+		return err
+	}
+	return c.JSON(responses)
+}
+
+// RevokeSession godoc
+// @Summary End a session
+// @Description Log out one of the current user's sessions, e.g. on a lost phone. Its refresh token stops working and its access tokens are rejected from the next request on. Ending the current session logs the caller out.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/profile/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := tx.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&session).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", session.FamilyID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", userID),
+			Action:     "session.revoke",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"sessions"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Session not found or already ended")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session ended",
+	})
+}
+
+func (h *Handler) sessionResponses(c *fiber.Ctx, sessions []models.Session) ([]models.SessionResponse, error) {
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.FamilyID
+	}
+	active, err := middleware.ActiveSessionIDs(h.db.WithContext(c.UserContext()), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := c.Locals("session_id").(string)
+	responses := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		responses[i] = models.SessionResponse{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			IP:         session.IP,
+			LastIP:     session.LastIP,
+			UserAgent:  session.UserAgent,
+			ExpiresAt:  session.ExpiresAt,
+			Active:     active[session.FamilyID],
+			Current:    current != "" && session.FamilyID == current,
+		}
+	}
+	return responses, nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+	// Time zones are checked against the embedded database, so validation
+	// does not depend on the host's zoneinfo files
+	_ "time/tzdata"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Defaults of the settings a user has not set. The language defaults to the
+// request's Accept-Language.
+const (
+	defaultTimezone = "Asia/Bangkok"
+	defaultTheme    = "system"
+)
+
+// GetSettings godoc
+// @Summary Get app settings
+// @Description Get the current user's app settings: language (en, th), IANA timezone, marketing consent and theme (system, light, dark). Settings the user has not set have their defaults: the Accept-Language of the request, Asia/Bangkok and system. marketing_consent is null until the user has been asked.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param Accept-Language header string false "Preferred language, e.g. th-TH"
+// @Success 200 {object} models.SettingsResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/settings [get]
+func (h *Handler) GetSettings(c *fiber.Ctx) error {
+	var stored models.UserSettings
+	err := h.db.WithContext(c.UserContext()).Where("user_id = ?", c.Locals("user_id")).Limit(1).Find(&stored).Error
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(settingsResponse(c, stored))
+}
+
+// UpdateSettings godoc
+// @Summary Change app settings
+// @Description Change the settings present in the body; the others keep their values. An empty string resets a setting to its default. Unknown settings are rejected. Setting marketing_consent to false stops marketing by email and push whatever the notification preferences say.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Accept json
+// @Produce json
+// @Param settings body models.UpdateSettingsRequest true "Settings to change"
+// @Success 200 {object} models.SettingsResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/settings [put]
+func (h *Handler) UpdateSettings(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.UpdateSettingsRequest
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return models.NewValidationError("Validation failed", map[string]string{strings.Trim(field, `"`): "is not a known setting"})
+		}
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	fields := validation.Struct(&req)
+	if req.Timezone != nil && *req.Timezone != "" && fields["timezone"] == "" {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			fields["timezone"] = "must be an IANA time zone such as Asia/Bangkok"
+		}
+	}
+	if len(fields) > 0 {
+		return models.NewValidationError("Validation failed", fields)
+	}
+
+	var stored models.UserSettings
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.UserSettings{UserID: userID}).FirstOrInit(&stored).Error; err != nil {
+			return err
+		}
+		settings := &stored.Settings
+		if req.Language != nil {
+			settings.Language = strings.TrimSpace(*req.Language)
+		}
+		if req.Timezone != nil {
+			settings.Timezone = strings.TrimSpace(*req.Timezone)
+		}
+		if req.Theme != nil {
+			settings.Theme = strings.TrimSpace(*req.Theme)
+		}
+		if req.MarketingConsent != nil && (settings.MarketingConsent == nil || *settings.MarketingConsent != *req.MarketingConsent) {
+			now := time.Now()
+			settings.MarketingConsent = req.MarketingConsent
+			settings.MarketingConsentAt = &now
+		}
+		return tx.Save(&stored).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(settingsResponse(c, stored))
+}
+
+// settingsResponse fills in the defaults of the settings the user has not
+// set.
+func settingsResponse(c *fiber.Ctx, stored models.UserSettings) models.SettingsResponse {
+	resp := models.SettingsResponse{Settings: stored.Settings}
+	if stored.ID != 0 {
+		resp.UpdatedAt = &stored.UpdatedAt
+	}
+	if resp.Settings.Language == "" {
+		resp.Settings.Language = requestLocale(c)
+	}
+	if resp.Settings.Timezone == "" {
+		resp.Settings.Timezone = defaultTimezone
+	}
+	if resp.Settings.Theme == "" {
+		resp.Settings.Theme = defaultTheme
+	}
+	return resp
+}
@@ -0,0 +1,748 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// settlementPeriodLayout formats the month a settlement covers.
+const settlementPeriodLayout = "2006-01"
+
+// settlementFileColumns are the columns of a settlement's reconciliation
+// file.
+var settlementFileColumns = []string{"type", "id", "created_at", "membership_id", "points", "reference", "description"}
+
+// settlementPages are the sort and filter keys of GET /admin/settlements.
+var settlementPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "period": "period", "total": "total"},
+	DefaultSort: "-id",
+	Filters: map[string]string{
+		"partner_id": "partner_id",
+		"period":     "period",
+		"status":     "status",
+	},
+}
+
+// partnerSettlementPages are the sort and filter keys of GET
+// /partner/settlements.
+var partnerSettlementPages = pagination.Options{
+	Sorts:       map[string]string{"period": "period"},
+	DefaultSort: "-period",
+	Filters:     map[string]string{"status": "status"},
+}
+
+// GenerateMonthlySettlements is the scheduled settlement job. It settles the
+// previous calendar month (UTC) for every partner that credited points in
+// it, leaving settlements already signed off as they are.
+func (h *Handler) GenerateMonthlySettlements(ctx context.Context) error {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+
+	settlements, err := h.settle(h.db.WithContext(ctx), start)
+	if err != nil {
+		return err
+	}
+	log.Printf("[settlements] %d partners settled for %s", len(settlements), start.Format(settlementPeriodLayout))
+	return nil
+}
+
+// settle calculates the settlements of the month starting at start from
+// the earn entries the partners posted in it. Open settlements are
+// recalculated, keeping their adjustments, and signed-off ones are left as
+// they are. It returns every settlement of the month.
+func (h *Handler) settle(db *gorm.DB, start time.Time) ([]models.Settlement, error) {
+	period := start.Format(settlementPeriodLayout)
+
+	var totals []struct {
+		Reference    string
+		Transactions int
+		Points       int
+	}
+	err := db.Model(&models.PointTransaction{}).
+		Select("reference, COUNT(*) AS transactions, SUM(amount) AS points").
+		Where("type = ? AND reference LIKE ?", models.PointTransactionEarn, "partner:%").
+		Where("created_at >= ? AND created_at < ?", start, start.AddDate(0, 1, 0)).
+		Group("reference").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Settlements already made for the month are recalculated too, in case
+	// their entries went with a purged member
+	var existing []uint
+	if err := db.Model(&models.Settlement{}).Where("period = ?", period).Pluck("partner_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	partners := map[uint]models.Settlement{}
+	for _, id := range existing {
+		partners[id] = models.Settlement{}
+	}
+	for _, t := range totals {
+		var id uint
+		if _, err := fmt.Sscanf(t.Reference, "partner:%d", &id); err != nil {
+			continue
+		}
+		partners[id] = models.Settlement{Transactions: t.Transactions, Points: t.Points}
+	}
+	ids := make([]uint, 0, len(partners))
+	for id := range partners {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		counted := partners[id]
+		result := db.Model(&models.Settlement{}).
+			Where("partner_id = ? AND period = ? AND status = ?", id, period, models.SettlementOpen).
+			Updates(map[string]interface{}{
+				"transactions": counted.Transactions,
+				"points":       counted.Points,
+				"total":        gorm.Expr("? + adjusted", counted.Points),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+
+		// No open settlement: the partner is new to the month, unless it
+		// has been signed off
+		settlement := models.Settlement{
+			PartnerID:    id,
+			Period:       period,
+			Status:       models.SettlementOpen,
+			Transactions: counted.Transactions,
+			Points:       counted.Points,
+			Total:        counted.Points,
+		}
+		err := db.Create(&settlement).Error
+		if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, err
+		}
+	}
+
+	var settlements []models.Settlement
+	err = db.Where("period = ?", period).Order("partner_id").Find(&settlements).Error
+	return settlements, err
+}
+
+// settlementMonth parses the period of a settlement into the start of the
+// month. Months that have not begun have no settlement.
+func settlementMonth(period string) (time.Time, bool) {
+	start, err := time.Parse(settlementPeriodLayout, period)
+	if err != nil || start.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// errSettlementLocked answers changes to a settlement that was signed off.
+var errSettlementLocked = models.NewAppError(fiber.StatusConflict, models.CodeSettlementLocked, "Settlement is signed off")
+
+// touchSettlement marks the open settlement id as changed, which holds its
+// row until tx ends so it cannot be signed off meanwhile.
+func touchSettlement(tx *gorm.DB, id uint) error {
+	result := tx.Model(&models.Settlement{}).
+		Where("id = ? AND status = ?", id, models.SettlementOpen).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSettlementLocked
+	}
+	return nil
+}
+
+// adjustSettlement records adjustment and adds it to the total of its open
+// settlement.
+func adjustSettlement(tx *gorm.DB, adjustment *models.SettlementAdjustment) error {
+	result := tx.Model(&models.Settlement{}).
+		Where("id = ? AND status = ?", adjustment.SettlementID, models.SettlementOpen).
+		Updates(map[string]interface{}{
+			"adjusted":   gorm.Expr("adjusted + ?", adjustment.Points),
+			"total":      gorm.Expr("total + ?", adjustment.Points),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSettlementLocked
+	}
+	return tx.Create(adjustment).Error
+}
+
+// loadSettlement returns the settlement matching query with its
+// adjustments and disputes.
+func (h *Handler) loadSettlement(c *fiber.Ctx, query string, args ...interface{}) (*models.Settlement, error) {
+	var settlement models.Settlement
+	err := h.db.WithContext(c.UserContext()).
+		Preload("Adjustments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Disputes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where(query, args...).
+		First(&settlement).Error
+	if err != nil {
+		return nil, models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Settlement not found")
+	}
+	return &settlement, nil
+}
+
+// ListSettlements godoc
+// @Summary List partner settlements
+// @Description List the monthly settlements of the points partners credited members, with the points of their earn entries, the net of the adjustments and the total the partner is billed for
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param filter[partner_id] query int false "Partner ID"
+// @Param filter[period] query string false "Month (YYYY-MM)"
+// @Param filter[status] query string false "open or signed_off"
+// @Param sort query string false "id, period or total, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Settlements per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Settlement}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements [get]
+func (h *Handler) ListSettlements(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, settlementPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Settlement](h.db.WithContext(c.UserContext()), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// GenerateSettlements godoc
+// @Summary Calculate the settlements of a month
+// @Description Settle a month for every partner that credited points in it, as the monthly job does for the previous month: new settlements are created, open ones recalculated from the ledger with their adjustments kept, and signed-off ones left as they are. The current month can be settled so far, to follow it.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.GenerateSettlementsRequest true "Month"
+// @Success 200 {array} models.Settlement
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements [post]
+func (h *Handler) GenerateSettlements(c *fiber.Ctx) error {
+	var req models.GenerateSettlementsRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	start, ok := settlementMonth(req.Period)
+	if !ok {
+		return models.NewValidationError("Invalid period", map[string]string{"period": "must be a month that has begun (YYYY-MM)"})
+	}
+
+	settlements, err := h.settle(h.db.WithContext(c.UserContext()), start)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(settlements)
+}
+
+// GetSettlement godoc
+// @Summary Get a partner settlement
+// @Description Return a settlement with its adjustments and the partner's disputes
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Settlement ID"
+// @Success 200 {object} models.Settlement
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements/{id} [get]
+func (h *Handler) GetSettlement(c *fiber.Ctx) error {
+	settlement, err := h.loadSettlement(c, "id = ?", c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(settlement)
+}
+
+// GetSettlementFile godoc
+// @Summary Download a settlement's reconciliation file
+// @Description Download the CSV partners reconcile a settlement with: one earn row per credit with the member, points, the Idempotency-Key the partner sent as reference and the source, one adjustment row per adjustment, and a total row with the status
+// @Tags Admin
+// @Security BearerAuth
+// @Produce text/csv
+// @Param id path int true "Settlement ID"
+// @Success 200 {file} file
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements/{id}/file [get]
+func (h *Handler) GetSettlementFile(c *fiber.Ctx) error {
+	settlement, err := h.loadSettlement(c, "id = ?", c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return h.sendSettlementFile(c, settlement)
+}
+
+// CreateSettlementAdjustment godoc
+// @Summary Adjust a partner settlement
+// @Description Add points to an open settlement, or take them off with negative points, e.g. for a refunded purchase. Signed-off settlements are locked.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Settlement ID"
+// @Param request body models.CreateSettlementAdjustmentRequest true "Adjustment"
+// @Success 201 {object} models.SettlementAdjustment
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements/{id}/adjustments [post]
+func (h *Handler) CreateSettlementAdjustment(c *fiber.Ctx) error {
+	var req models.CreateSettlementAdjustmentRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	settlement, err := h.loadSettlement(c, "id = ?", c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	adjustment := models.SettlementAdjustment{
+		SettlementID: settlement.ID,
+		Points:       req.Points,
+		Reason:       strings.TrimSpace(req.Reason),
+		CreatedBy:    auditActor(c),
+	}
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := adjustSettlement(tx, &adjustment); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "settlement.adjust",
+			Resource:   "settlements",
+			ResourceID: settlement.ID,
+			Fields:     []string{"adjusted", "total"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(adjustment)
+}
+
+// ResolveSettlementDispute godoc
+// @Summary Resolve a settlement dispute
+// @Description Accept or reject a partner's open dispute with an answer the partner sees. Accepting it with non-zero points adjusts the settlement by them in the same step. Signed-off settlements are locked.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Settlement ID"
+// @Param dispute_id path int true "Dispute ID"
+// @Param request body models.ResolveSettlementDisputeRequest true "Decision"
+// @Success 200 {object} models.SettlementDispute
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements/{id}/disputes/{dispute_id}/resolve [post]
+func (h *Handler) ResolveSettlementDispute(c *fiber.Ctx) error {
+	var req models.ResolveSettlementDisputeRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Status == models.DisputeRejected && req.Points != 0 {
+		return models.NewValidationError("Invalid resolution", map[string]string{"points": "must be 0 when the dispute is rejected"})
+	}
+
+	var dispute models.SettlementDispute
+	err := h.db.WithContext(c.UserContext()).
+		Where("id = ? AND settlement_id = ?", c.Params("dispute_id"), c.Params("id")).
+		First(&dispute).Error
+	if err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Dispute not found")
+	}
+
+	now := time.Now()
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := touchSettlement(tx, dispute.SettlementID); err != nil {
+			return err
+		}
+		result := tx.Model(&dispute).Where("status = ?", models.DisputeOpen).Updates(map[string]interface{}{
+			"status":      req.Status,
+			"resolution":  strings.TrimSpace(req.Resolution),
+			"resolved_at": now,
+			"resolved_by": auditActor(c),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Dispute was already resolved")
+		}
+		if req.Points != 0 {
+			err := adjustSettlement(tx, &models.SettlementAdjustment{
+				SettlementID: dispute.SettlementID,
+				Points:       req.Points,
+				Reason:       fmt.Sprintf("Dispute %d: %s", dispute.ID, strings.TrimSpace(req.Resolution)),
+				DisputeID:    &dispute.ID,
+				CreatedBy:    auditActor(c),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "settlement.resolve_dispute",
+			Resource:   "settlements",
+			ResourceID: dispute.SettlementID,
+			Fields:     []string{"disputes", "adjusted", "total"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	dispute.Status, dispute.Resolution = req.Status, strings.TrimSpace(req.Resolution)
+	dispute.ResolvedAt, dispute.ResolvedBy = &now, auditActor(c)
+	return c.JSON(dispute)
+}
+
+// SignOffSettlement godoc
+// @Summary Sign off a partner settlement
+// @Description Lock a settlement once its month has ended and its disputes are resolved. A signed-off settlement is no longer recalculated and takes no more adjustments or disputes.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Settlement ID"
+// @Success 200 {object} models.Settlement
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/settlements/{id}/sign-off [post]
+func (h *Handler) SignOffSettlement(c *fiber.Ctx) error {
+	settlement, err := h.loadSettlement(c, "id = ?", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if start, _ := time.Parse(settlementPeriodLayout, settlement.Period); start.AddDate(0, 1, 0).After(time.Now()) {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Settlement's month has not ended")
+	}
+
+	// The open disputes are checked in the update, so a dispute raised
+	// meanwhile keeps the settlement open
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Settlement{}).
+			Where("id = ? AND status = ?", settlement.ID, models.SettlementOpen).
+			Where("NOT EXISTS (?)", tx.Model(&models.SettlementDispute{}).Select("1").
+				Where("settlement_id = ? AND status = ?", settlement.ID, models.DisputeOpen)).
+			Updates(map[string]interface{}{
+				"status":        models.SettlementSignedOff,
+				"signed_off_at": time.Now(),
+				"signed_off_by": auditActor(c),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if settlement.Status != models.SettlementOpen {
+				return errSettlementLocked
+			}
+			return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Settlement has open disputes")
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "settlement.sign_off",
+			Resource:   "settlements",
+			ResourceID: settlement.ID,
+			Fields:     []string{"status"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	settlement, err = h.loadSettlement(c, "id = ?", settlement.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(settlement)
+}
+
+// ListPartnerSettlements godoc
+// @Summary List the partner's settlements
+// @Description List the monthly settlements of the points the partner credited members, newest month first. Any partner key can read them, whatever its scopes.
+// @Tags Partner
+// @Security PartnerKey
+// @Produce json
+// @Param filter[status] query string false "open or signed_off"
+// @Param sort query string false "period, - for descending (default -period)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Settlements per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.Settlement}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/settlements [get]
+func (h *Handler) ListPartnerSettlements(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	params, err := pagination.Parse(c, partnerSettlementPages)
+	if err != nil {
+		return err
+	}
+
+	page, err := pagination.Find[models.Settlement](h.db.WithContext(c.UserContext()).Where("partner_id = ?", partner.ID), params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// GetPartnerSettlement godoc
+// @Summary Get a settlement of the partner
+// @Description Return the partner's settlement of a month with its adjustments and the partner's disputes
+// @Tags Partner
+// @Security PartnerKey
+// @Produce json
+// @Param period path string true "Month (YYYY-MM)" example(2026-09)
+// @Success 200 {object} models.Settlement
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/settlements/{period} [get]
+func (h *Handler) GetPartnerSettlement(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	settlement, err := h.loadSettlement(c, "partner_id = ? AND period = ?", partner.ID, c.Params("period"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(settlement)
+}
+
+// GetPartnerSettlementFile godoc
+// @Summary Download the reconciliation file of a settlement
+// @Description Download the CSV to reconcile a settlement with the partner's own records: one earn row per credit with the member, points, the Idempotency-Key sent as reference and the source, one adjustment row per adjustment, and a total row with the status
+// @Tags Partner
+// @Security PartnerKey
+// @Produce text/csv
+// @Param period path string true "Month (YYYY-MM)" example(2026-09)
+// @Success 200 {file} file
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/settlements/{period}/file [get]
+func (h *Handler) GetPartnerSettlementFile(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	settlement, err := h.loadSettlement(c, "partner_id = ? AND period = ?", partner.ID, c.Params("period"))
+	if err != nil {
+		return err
+	}
+
+	return h.sendSettlementFile(c, settlement)
+}
+
+// CreateSettlementDispute godoc
+// @Summary Dispute a settlement
+// @Description Object to an open settlement, or to one of its credits by transaction_id, e.g. for a purchase that was refunded. An admin accepts the dispute, possibly with an adjustment, or rejects it; the settlement cannot be signed off while disputes are open.
+// @Tags Partner
+// @Security PartnerKey
+// @Accept json
+// @Produce json
+// @Param period path string true "Month (YYYY-MM)" example(2026-09)
+// @Param request body models.CreateSettlementDisputeRequest true "Dispute"
+// @Success 201 {object} models.SettlementDispute
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/partner/settlements/{period}/disputes [post]
+func (h *Handler) CreateSettlementDispute(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*models.Partner)
+	var req models.CreateSettlementDisputeRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	settlement, err := h.loadSettlement(c, "partner_id = ? AND period = ?", partner.ID, c.Params("period"))
+	if err != nil {
+		return err
+	}
+
+	if req.TransactionID != nil {
+		start, _ := time.Parse(settlementPeriodLayout, settlement.Period)
+		var found int64
+		err := settlementEntries(h.db.WithContext(c.UserContext()), settlement.PartnerID, start).
+			Where("point_transactions.id = ?", *req.TransactionID).
+			Count(&found).Error
+		if err != nil {
+			return err
+		}
+		if found == 0 {
+			return models.NewValidationError("Invalid dispute", map[string]string{"transaction_id": "is not a credit of this settlement"})
+		}
+	}
+
+	dispute := models.SettlementDispute{
+		SettlementID:  settlement.ID,
+		TransactionID: req.TransactionID,
+		Reason:        strings.TrimSpace(req.Reason),
+		Status:        models.DisputeOpen,
+	}
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := touchSettlement(tx, settlement.ID); err != nil {
+			return err
+		}
+		if err := tx.Create(&dispute).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      fmt.Sprintf("partner:%d", partner.ID),
+			Action:     "settlement.dispute",
+			Resource:   "settlements",
+			ResourceID: settlement.ID,
+			Fields:     []string{"disputes"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dispute)
+}
+
+// settlementEntries selects the earn entries of partnerID in the month
+// starting at start, with the membership ID of their member.
+func settlementEntries(db *gorm.DB, partnerID uint, start time.Time) *gorm.DB {
+	return db.Table("point_transactions").
+		Joins("JOIN users ON users.id = point_transactions.user_id").
+		Where("point_transactions.type = ? AND point_transactions.reference = ?", models.PointTransactionEarn, fmt.Sprintf("partner:%d", partnerID)).
+		Where("point_transactions.created_at >= ? AND point_transactions.created_at < ?", start, start.AddDate(0, 1, 0))
+}
+
+// settlementEntry is a row of a reconciliation file read from the ledger.
+type settlementEntry struct {
+	ID             uint
+	CreatedAt      time.Time
+	MembershipID   string
+	Amount         int
+	IdempotencyKey string
+	Reason         string
+}
+
+// sendSettlementFile streams the reconciliation file of settlement.
+func (h *Handler) sendSettlementFile(c *fiber.Ctx, settlement *models.Settlement) error {
+	start, err := time.Parse(settlementPeriodLayout, settlement.Period)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("settlement_%d_%s.csv", settlement.PartnerID, settlement.Period)
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	// The rows are read while the response is sent, after the handler has
+	// returned, so the query cannot use the request context
+	query := settlementEntries(h.db.WithContext(c.UserContext()), settlement.PartnerID, start).
+		Select("point_transactions.id, point_transactions.created_at, users.membership_id, point_transactions.amount, point_transactions.idempotency_key, point_transactions.reason").
+		Order("point_transactions.id")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := writeSettlementCSV(w, query, settlement)
+		if err == nil {
+			err = w.Flush()
+		}
+		// The status has been sent; a failed file ends truncated
+		if err != nil {
+			log.Printf("[settlements] file of settlement %d failed: %v", settlement.ID, err)
+		}
+	})
+	return nil
+}
+
+func writeSettlementCSV(w *bufio.Writer, query *gorm.DB, settlement *models.Settlement) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(settlementFileColumns); err != nil {
+		return err
+	}
+
+	var entries []settlementEntry
+	err := query.FindInBatches(&entries, exportBatch, func(*gorm.DB, int) error {
+		for _, entry := range entries {
+			err := cw.Write([]string{
+				models.PointTransactionEarn,
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				entry.MembershipID,
+				strconv.Itoa(entry.Amount),
+				csvText(entry.IdempotencyKey),
+				csvText(entry.Reason),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	for _, adjustment := range settlement.Adjustments {
+		reference := ""
+		if adjustment.DisputeID != nil {
+			reference = fmt.Sprintf("dispute:%d", *adjustment.DisputeID)
+		}
+		err := cw.Write([]string{
+			"adjustment",
+			strconv.FormatUint(uint64(adjustment.ID), 10),
+			adjustment.CreatedAt.UTC().Format(time.RFC3339),
+			"",
+			strconv.Itoa(adjustment.Points),
+			reference,
+			csvText(adjustment.Reason),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := cw.Write([]string{"total", "", "", "", strconv.Itoa(settlement.Total), settlement.Period, settlement.Status}); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,183 @@
+package handlers_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestSettlements(t *testing.T) {
+	type step struct {
+		// admin steps go to /admin/settlements/<id>, the others to
+		// /partner/settlements/<period> with the partner's key
+		admin  bool
+		method string
+		path   string
+		body   string
+		status int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		// credit posts another credit in the month before the settlement
+		// is calculated again
+		credit   bool
+		status   string
+		adjusted int
+		total    int
+	}{
+		{name: "calculated from the month's credits", status: models.SettlementOpen, total: 300},
+		{
+			name:     "adjusted",
+			steps:    []step{{admin: true, method: http.MethodPost, path: "/adjustments", body: `{"points":-50,"reason":"Refund"}`, status: http.StatusCreated}},
+			status:   models.SettlementOpen,
+			adjusted: -50,
+			total:    250,
+		},
+		{
+			name:     "recalculated while open",
+			steps:    []step{{admin: true, method: http.MethodPost, path: "/adjustments", body: `{"points":-50,"reason":"Refund"}`, status: http.StatusCreated}},
+			credit:   true,
+			status:   models.SettlementOpen,
+			adjusted: -50,
+			total:    290,
+		},
+		{
+			name: "dispute accepted before sign-off",
+			steps: []step{
+				{method: http.MethodPost, path: "/disputes", body: `{"reason":"Order refunded"}`, status: http.StatusCreated},
+				{admin: true, method: http.MethodPost, path: "/sign-off", status: http.StatusConflict},
+				{admin: true, method: http.MethodPost, path: "/disputes/1/resolve", body: `{"status":"accepted","resolution":"Refund confirmed","points":-100}`, status: http.StatusOK},
+				{admin: true, method: http.MethodPost, path: "/disputes/1/resolve", body: `{"status":"rejected","resolution":"Again"}`, status: http.StatusConflict},
+				{admin: true, method: http.MethodPost, path: "/sign-off", status: http.StatusOK},
+			},
+			status:   models.SettlementSignedOff,
+			adjusted: -100,
+			total:    200,
+		},
+		{
+			name: "dispute rejected",
+			steps: []step{
+				{method: http.MethodPost, path: "/disputes", body: `{"reason":"Too many points"}`, status: http.StatusCreated},
+				{admin: true, method: http.MethodPost, path: "/disputes/1/resolve", body: `{"status":"rejected","resolution":"Credits match the orders","points":-10}`, status: http.StatusBadRequest},
+				{admin: true, method: http.MethodPost, path: "/disputes/1/resolve", body: `{"status":"rejected","resolution":"Credits match the orders"}`, status: http.StatusOK},
+			},
+			status: models.SettlementOpen,
+			total:  300,
+		},
+		{
+			name: "locked once signed off",
+			steps: []step{
+				{admin: true, method: http.MethodPost, path: "/sign-off", status: http.StatusOK},
+				{admin: true, method: http.MethodPost, path: "/sign-off", status: http.StatusConflict},
+				{admin: true, method: http.MethodPost, path: "/adjustments", body: `{"points":-50,"reason":"Refund"}`, status: http.StatusConflict},
+				{method: http.MethodPost, path: "/disputes", body: `{"reason":"Order refunded"}`, status: http.StatusConflict},
+			},
+			credit: true,
+			status: models.SettlementSignedOff,
+			total:  300,
+		},
+		{
+			name:   "other partners' credits cannot be disputed",
+			steps:  []step{{method: http.MethodPost, path: "/disputes", body: `{"reason":"Not ours","transaction_id":3}`, status: http.StatusBadRequest}},
+			status: models.SettlementOpen,
+			total:  300,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			admin := testutil.CreateUser(t, env.DB, func(u *models.User) { u.Role = models.RoleAdmin })
+			member := testutil.CreateUser(t, env.DB)
+			partner, key := testutil.CreatePartner(t, env.DB, "points:earn")
+			other, _ := testutil.CreatePartner(t, env.DB, "points:earn")
+
+			now := time.Now().UTC()
+			thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+			lastMonth := thisMonth.AddDate(0, -1, 0)
+			period := lastMonth.Format("2006-01")
+			credit := func(p models.Partner, amount int, at time.Time) {
+				entry := testutil.CreateTransaction(t, env.DB, &member, testutil.WithAmount(amount), func(e *models.PointTransaction) {
+					e.Reference, e.IdempotencyKey = fmt.Sprintf("partner:%d", p.ID), fmt.Sprintf("order-%d-%d", p.ID, amount)
+				})
+				env.DB.Model(&entry).Update("created_at", at)
+			}
+			// Transactions 1 and 2 are the partner's in the month, 3 the
+			// other partner's and 4 the partner's in the current month
+			credit(partner, 100, lastMonth.Add(time.Hour))
+			credit(partner, 200, thisMonth.Add(-time.Hour))
+			credit(other, 400, lastMonth.Add(2*time.Hour))
+			credit(partner, 800, thisMonth)
+
+			auth := testutil.AuthHeader(t, admin)
+			generate := func() {
+				status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/admin/settlements", fmt.Sprintf(`{"period":%q}`, period), auth)
+				if status != http.StatusOK {
+					t.Fatalf("generate: status %d: %s", status, body)
+				}
+			}
+			generate()
+			var settlement models.Settlement
+			if err := env.DB.Where("partner_id = ? AND period = ?", partner.ID, period).First(&settlement).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range tt.steps {
+				var status int
+				var body string
+				if s.admin {
+					path := fmt.Sprintf("/api/v1/admin/settlements/%d%s", settlement.ID, s.path)
+					status, body = testutil.Request(t, env.App, s.method, path, s.body, auth)
+				} else {
+					path := "/api/v1/partner/settlements/" + period + s.path
+					status, body = testutil.RequestWithHeaders(t, env.App, s.method, path, s.body, map[string]string{"X-API-Key": key})
+				}
+				if status != s.status {
+					t.Fatalf("step %d: %s %s: status %d, want %d: %s", i+1, s.method, s.path, status, s.status, body)
+				}
+			}
+			if tt.credit {
+				credit(partner, 40, lastMonth.Add(3*time.Hour))
+				generate()
+			}
+
+			status, body := testutil.RequestWithHeaders(t, env.App, http.MethodGet, "/api/v1/partner/settlements/"+period, "", map[string]string{"X-API-Key": key})
+			if status != http.StatusOK {
+				t.Fatalf("get: status %d: %s", status, body)
+			}
+			if err := json.Unmarshal([]byte(body), &settlement); err != nil {
+				t.Fatal(err)
+			}
+			if settlement.Status != tt.status || settlement.Adjusted != tt.adjusted || settlement.Total != tt.total || settlement.Points != settlement.Total-settlement.Adjusted {
+				t.Errorf("settlement %s, want %s with %d adjusted and %d in total", body, tt.status, tt.adjusted, tt.total)
+			}
+
+			// The file lists the credits and adjustments and ends with the
+			// total
+			status, body = testutil.RequestWithHeaders(t, env.App, http.MethodGet, "/api/v1/partner/settlements/"+period+"/file", "", map[string]string{"X-API-Key": key})
+			if status != http.StatusOK {
+				t.Fatalf("file: status %d: %s", status, body)
+			}
+			rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRows := 1 + settlement.Transactions + len(settlement.Adjustments) + 1
+			if tt.credit && tt.status == models.SettlementSignedOff {
+				// The late credit is in the ledger but not settled
+				wantRows++
+			}
+			last := rows[len(rows)-1]
+			if len(rows) != wantRows || last[0] != "total" || last[4] != fmt.Sprint(tt.total) || last[6] != tt.status {
+				t.Errorf("file %q, want %d rows ending in a total of %d", rows, wantRows, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/url"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/sms"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SMSWebhook godoc
+// @Summary Receive SMS delivery reports
+// @Description Endpoint for the delivery reports of SMS aggregators such as ThaiBulkSMS. Reports marking a message delivered, or failed, undelivered, expired or rejected, update the message sent with that ID by the configured gateway; other statuses are acknowledged and ignored.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param X-Webhook-Secret header string true "Shared secret from SMS_WEBHOOK_SECRET"
+// @Param events body []models.SMSWebhookEvent true "Delivery reports"
+// @Success 200 {object} models.SMSWebhookResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /webhooks/sms [post]
+func (h *Handler) SMSWebhook(c *fiber.Ctx) error {
+	var events []models.SMSWebhookEvent
+	if err := c.BodyParser(&events); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	result := models.SMSWebhookResponse{Received: len(events)}
+	for _, event := range events {
+		updated, err := sms.UpdateStatus(h.db, sms.Provider(), event.MessageID, sms.AggregatorStatus(event.Status), event.Detail)
+		if err != nil {
+			return err
+		}
+		if updated {
+			result.Updated++
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// TwilioSMSWebhook godoc
+// @Summary Receive Twilio delivery reports
+// @Description Status callback Twilio posts for each message when sms.driver is twilio and PUBLIC_URL is set. The X-Twilio-Signature header must sign the callback URL and parameters with the account's auth token. Delivered, undelivered and failed reports update the message.
+// @Tags Notifications
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param X-Twilio-Signature header string true "Signature of the report"
+// @Param MessageSid formData string true "Twilio message SID"
+// @Param MessageStatus formData string true "queued, sent, delivered, undelivered or failed"
+// @Param ErrorCode formData string false "Twilio error code of a failed message"
+// @Success 200 {object} models.SMSWebhookResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /webhooks/sms/twilio [post]
+func (h *Handler) TwilioSMSWebhook(c *fiber.Ctx) error {
+	twilio, ok := h.sms.(*sms.Twilio)
+	if !ok || twilio.StatusCallback == "" {
+		return models.NewAppError(fiber.StatusForbidden, models.CodeForbidden, "Webhook is disabled")
+	}
+
+	params := url.Values{}
+	c.Request().PostArgs().VisitAll(func(key, value []byte) {
+		params.Add(string(key), string(value))
+	})
+	if !twilio.ValidSignature(params, c.Get("X-Twilio-Signature")) {
+		return models.NewAppError(fiber.StatusUnauthorized, models.CodeUnauthorized, "Invalid webhook signature")
+	}
+
+	detail := ""
+	if code := params.Get("ErrorCode"); code != "" {
+		detail = "Twilio error " + code
+	}
+	updated, err := sms.UpdateStatus(h.db, "twilio", params.Get("MessageSid"), sms.TwilioStatus(params.Get("MessageStatus")), detail)
+	if err != nil {
+		return err
+	}
+
+	result := models.SMSWebhookResponse{Received: 1}
+	if updated {
+		result.Updated = 1
+	}
+	return c.JSON(result)
+}
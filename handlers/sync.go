@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// syncSources report a user's changes to one resource since a point in time;
+// a zero since asks for every current record, without tombstones. Per-user
+// resources that offline clients keep a copy of are added here.
+var syncSources = []func(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error){
+	syncProfile,
+	syncPointTransactions,
+	syncNotifications,
+	syncAddresses,
+	syncDevices,
+}
+
+// Sync godoc
+// @Summary Get changes since a sync cursor
+// @Description Return the current user's records changed since the cursor from the previous sync: the profile, points transactions, notifications, addresses and devices, with tombstones for deleted records. Omit since for a full sync. Cursors older than SYNC_TOMBSTONE_RETENTION_DAYS get 410 and the client syncs again without since.
+// @Tags Sync
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param since query string false "Cursor returned by the previous sync"
+// @Success 200 {object} models.SyncResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 410 {object} models.ErrorResponse
+// @Router /api/v1/sync [get]
+func (h *Handler) Sync(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var since time.Time
+	if cursor := c.Query("since"); cursor != "" {
+		var err error
+		if since, err = decodeSyncCursor(cursor); err != nil {
+			return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Invalid sync cursor")
+		}
+		// Tombstones older than the retention are gone, so such a client
+		// could keep records deleted since
+		if since.Before(time.Now().AddDate(0, 0, -h.cfg.Sync.TombstoneRetentionDays)) {
+			return models.NewAppError(fiber.StatusGone, models.CodeSyncCursorExpired, "Sync cursor has expired; sync again without since")
+		}
+	}
+
+	// Take the next cursor before reading so a change made while the sync
+	// runs is returned again next time rather than missed
+	now := time.Now()
+
+	changes := []models.SyncChange{}
+	for _, source := range syncSources {
+		found, err := source(h.db.WithContext(c.UserContext()), userID, since)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, found...)
+	}
+
+	return c.JSON(models.SyncResponse{
+		Cursor:  encodeSyncCursor(now),
+		Changes: changes,
+	})
+}
+
+func syncProfile(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error) {
+	var user models.User
+	if err := db.Unscoped().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if user.DeletedAt.Valid {
+		if !user.DeletedAt.Time.After(since) {
+			return nil, nil
+		}
+		return []models.SyncChange{{
+			Resource:  "profile",
+			ID:        user.ID,
+			Deleted:   true,
+			ChangedAt: user.DeletedAt.Time,
+		}}, nil
+	}
+
+	if !user.UpdatedAt.After(since) {
+		return nil, nil
+	}
+	return []models.SyncChange{{
+		Resource:  "profile",
+		ID:        user.ID,
+		ChangedAt: user.UpdatedAt,
+		Data:      user,
+	}}, nil
+}
+
+func syncPointTransactions(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error) {
+	// Ledger entries are never changed or removed once posted
+	var entries []models.PointTransaction
+	if err := db.Where("user_id = ? AND created_at > ?", userID, since).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.SyncChange, len(entries))
+	for i, entry := range entries {
+		changes[i] = models.SyncChange{Resource: "point_transaction", ID: entry.ID, ChangedAt: entry.CreatedAt, Data: entry}
+	}
+	return changes, nil
+}
+
+func syncNotifications(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error) {
+	return syncSoftDeleted(db, "notification", userID, since, func(n *models.Notification) (uint, time.Time, gorm.DeletedAt) {
+		return n.ID, n.UpdatedAt, n.DeletedAt
+	})
+}
+
+func syncAddresses(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error) {
+	return syncSoftDeleted(db, "address", userID, since, func(a *models.Address) (uint, time.Time, gorm.DeletedAt) {
+		return a.ID, a.UpdatedAt, a.DeletedAt
+	})
+}
+
+func syncDevices(db *gorm.DB, userID uint, since time.Time) ([]models.SyncChange, error) {
+	return syncSoftDeleted(db, "device", userID, since, func(d *models.Device) (uint, time.Time, gorm.DeletedAt) {
+		return d.ID, d.UpdatedAt, d.DeletedAt
+	})
+}
+
+// syncSoftDeleted reports the rows of T owned by userID that changed since,
+// and tombstones for those deleted since. The rows of an account that is
+// itself deleted are left to the profile's tombstone. meta returns the ID,
+// update time and deletion mark of a row.
+func syncSoftDeleted[T any](db *gorm.DB, resource string, userID uint, since time.Time, meta func(*T) (uint, time.Time, gorm.DeletedAt)) ([]models.SyncChange, error) {
+	query := db.Where("user_id = ? AND updated_at > ?", userID, since)
+	if !since.IsZero() {
+		query = db.Unscoped().Where("user_id = ? AND (updated_at > ? OR deleted_at > ?)", userID, since, since)
+	}
+	var rows []T
+	if err := query.Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.SyncChange, 0, len(rows))
+	for i := range rows {
+		id, updatedAt, deletedAt := meta(&rows[i])
+		if deletedAt.Valid {
+			changes = append(changes, models.SyncChange{Resource: resource, ID: id, Deleted: true, ChangedAt: deletedAt.Time})
+			continue
+		}
+		changes = append(changes, models.SyncChange{Resource: resource, ID: id, ChangedAt: updatedAt, Data: rows[i]})
+	}
+	return changes, nil
+}
+
+// PruneSyncTombstones removes the addresses, devices and notifications
+// deleted longer ago than the tombstone retention, which no cursor still
+// accepted by GET /sync can need. Rows deleted with their account wait for
+// the account to be restored or purged.
+func (h *Handler) PruneSyncTombstones(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	cutoff := time.Now().AddDate(0, 0, -h.cfg.Sync.TombstoneRetentionDays)
+	activeUsers := db.Model(&models.User{}).Select("id")
+
+	var pruned int64
+	for _, model := range []interface{}{&models.Address{}, &models.Device{}, &models.Notification{}} {
+		result := db.Unscoped().Where("deleted_at < ? AND user_id IN (?)", cutoff, activeUsers).Delete(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		pruned += result.RowsAffected
+	}
+	if pruned > 0 {
+		log.Printf("[sync] pruned %d tombstones", pruned)
+	}
+	return nil
+}
+
+// Cursors are opaque to clients; they encode a timestamp in nanoseconds.
+func encodeSyncCursor(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+func decodeSyncCursor(cursor string) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanos, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
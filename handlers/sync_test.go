@@ -0,0 +1,152 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestSyncReportsChangesAndTombstones(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	user := testutil.CreateUser(t, db)
+	auth := testutil.AuthHeader(t, user)
+
+	_, body := testutil.Request(t, app, http.MethodGet, "/api/v1/sync", "", auth)
+	var first models.SyncResponse
+	if err := json.Unmarshal([]byte(body), &first); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+
+	kept := models.Address{UserID: user.ID, Label: "Home", Line1: "1 Road", District: "Watthana", Province: "Bangkok", PostalCode: "10110", IsDefault: true}
+	removed := models.Address{UserID: user.ID, Label: "Work", Line1: "2 Road", District: "Watthana", Province: "Bangkok", PostalCode: "10110"}
+	for _, address := range []*models.Address{&kept, &removed} {
+		if err := db.Create(address).Error; err != nil {
+			t.Fatalf("create address: %v", err)
+		}
+	}
+	if err := db.Create(&models.Notification{UserID: user.ID, Category: models.NotificationCategoryPoints, Title: "Hello"}).Error; err != nil {
+		t.Fatalf("create notification: %v", err)
+	}
+	status, body := testutil.Request(t, app, http.MethodDelete, fmt.Sprintf("/api/v1/profile/addresses/%d", removed.ID), "", auth)
+	if status != http.StatusOK {
+		t.Fatalf("delete address: %d %s", status, body)
+	}
+
+	tests := []struct {
+		name  string
+		since string
+		want  map[string]bool
+	}{
+		{
+			name: "full sync has no tombstones",
+			want: map[string]bool{
+				fmt.Sprintf("profile:%d", user.ID): false,
+				fmt.Sprintf("address:%d", kept.ID): false,
+				"notification:1":                   false,
+			},
+		},
+		{
+			name:  "incremental sync has the deleted address",
+			since: first.Cursor,
+			want: map[string]bool{
+				fmt.Sprintf("address:%d", kept.ID):    false,
+				fmt.Sprintf("address:%d", removed.ID): true,
+				"notification:1":                      false,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/v1/sync"
+			if tt.since != "" {
+				path += "?since=" + tt.since
+			}
+			status, body := testutil.Request(t, app, http.MethodGet, path, "", auth)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var resp models.SyncResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+
+			got := map[string]bool{}
+			for _, change := range resp.Changes {
+				got[fmt.Sprintf("%s:%d", change.Resource, change.ID)] = change.Deleted
+			}
+			for key, deleted := range tt.want {
+				if gotDeleted, ok := got[key]; !ok || gotDeleted != deleted {
+					t.Errorf("change %s: got deleted=%v present=%v, want deleted=%v", key, gotDeleted, ok, deleted)
+				}
+			}
+			if _, ok := got[fmt.Sprintf("address:%d", removed.ID)]; tt.since == "" && ok {
+				t.Errorf("full sync returned the deleted address")
+			}
+		})
+	}
+}
+
+func TestSyncRejectsExpiredCursor(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	user := testutil.CreateUser(t, db)
+
+	// The cursor of 2001-09-09, long before any tombstone still kept
+	status, body := testutil.Request(t, app, http.MethodGet, "/api/v1/sync?since=MTAwMDAwMDAwMDAwMDAwMDAwMA", "", testutil.AuthHeader(t, user))
+	if status != http.StatusGone {
+		t.Fatalf("status %d, want %d: %s", status, http.StatusGone, body)
+	}
+}
+
+func TestPruneSyncTombstones(t *testing.T) {
+	db := testutil.NewDB(t)
+	cfg := config.Default()
+	h := handlers.New(handlers.Deps{DB: db, Config: cfg})
+
+	active := testutil.CreateUser(t, db)
+	deletedUser := testutil.CreateUser(t, db)
+	old := time.Now().AddDate(0, 0, -cfg.Sync.TombstoneRetentionDays-1)
+	recent := time.Now().Add(-time.Hour)
+
+	devices := []struct {
+		userID    uint
+		deletedAt time.Time
+		pruned    bool
+	}{
+		{active.ID, old, true},
+		{active.ID, recent, false},
+		{deletedUser.ID, old, false},
+	}
+	ids := make([]uint, len(devices))
+	for i, d := range devices {
+		device := models.Device{UserID: d.userID, DeviceID: fmt.Sprintf("device-%d", i)}
+		if err := db.Create(&device).Error; err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+		if err := db.Model(&device).Update("deleted_at", d.deletedAt).Error; err != nil {
+			t.Fatalf("delete device: %v", err)
+		}
+		ids[i] = device.ID
+	}
+	if err := db.Model(&deletedUser).Update("deleted_at", old).Error; err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+
+	if err := h.PruneSyncTombstones(context.Background()); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	for i, d := range devices {
+		var count int64
+		db.Unscoped().Model(&models.Device{}).Where("id = ?", ids[i]).Count(&count)
+		if pruned := count == 0; pruned != d.pruned {
+			t.Errorf("device %d: pruned=%v, want %v", i, pruned, d.pruned)
+		}
+	}
+}
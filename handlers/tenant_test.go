@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+func TestTenantRouting(t *testing.T) {
+	env, dbs := testutil.NewShardedEnv(t, "acme")
+	acme := dbs["acme"]
+
+	request := func(method, path, body, tenant, auth string) (int, string) {
+		t.Helper()
+		headers := map[string]string{"Content-Type": "application/json"}
+		if tenant != "" {
+			headers["X-Tenant-ID"] = tenant
+		}
+		if auth != "" {
+			headers["Authorization"] = auth
+		}
+		return testutil.RequestWithHeaders(t, env.App, method, path, body, headers)
+	}
+	login := func(email, tenant string) string {
+		t.Helper()
+		register := `{"email":"` + email + `","password":"secret123","first_name":"Somchai","last_name":"Jaidee"}`
+		if status, body := request(http.MethodPost, "/api/v1/auth/register", register, tenant, ""); status != http.StatusCreated {
+			t.Fatalf("register %s at %q: %d %s", email, tenant, status, body)
+		}
+		status, body := request(http.MethodPost, "/api/v1/auth/login", `{"email":"`+email+`","password":"secret123"}`, tenant, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s at %q: %d %s", email, tenant, status, body)
+		}
+		var tokens models.TokenResponse
+		if err := json.Unmarshal([]byte(body), &tokens); err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + tokens.Token
+	}
+	emails := func(db *gorm.DB) []string {
+		t.Helper()
+		var users []models.User
+		if err := db.Order("id").Find(&users).Error; err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, user := range users {
+			found = append(found, user.Email+" "+user.FirstName)
+		}
+		return found
+	}
+
+	home := login("home@example.com", "")
+	other := login("acme@example.com", "acme")
+	// The server's own tenant may be named too
+	if status, body := request(http.MethodGet, "/api/v1/profile", "", "default", home); status != http.StatusOK {
+		t.Errorf("profile at default: %d %s", status, body)
+	}
+
+	status, body := request(http.MethodPut, "/api/v1/profile", `{"first_name":"Malee"}`, "acme", other)
+	if status != http.StatusOK {
+		t.Fatalf("update at acme: %d %s", status, body)
+	}
+	if got := emails(env.DB); len(got) != 1 || got[0] != "home@example.com Somchai" {
+		t.Errorf("server's database holds %q", got)
+	}
+	if got := emails(acme); len(got) != 1 || got[0] != "acme@example.com Malee" {
+		t.Errorf("acme's shard holds %q", got)
+	}
+
+	status, body = request(http.MethodGet, "/api/v1/profile", "", "acme", other)
+	var profile models.ProfileResponse
+	json.Unmarshal([]byte(body), &profile)
+	if status != http.StatusOK || profile.User.Email != "acme@example.com" {
+		t.Errorf("profile at acme: %d %s", status, body)
+	}
+
+	// A token is only good for the tenant it was issued by, though both
+	// accounts have the same ID in their own database
+	tests := []struct {
+		name   string
+		tenant string
+		auth   string
+		want   int
+	}{
+		{name: "acme token without the tenant", auth: other, want: http.StatusUnauthorized},
+		{name: "server token at acme", tenant: "acme", auth: home, want: http.StatusUnauthorized},
+		{name: "unknown tenant", tenant: "nope", auth: other, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, body := request(http.MethodGet, "/api/v1/profile", "", tt.tenant, tt.auth); status != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, status, body, tt.want)
+		}
+	}
+}
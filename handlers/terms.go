@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AcceptTerms godoc
+// @Summary Accept the terms of service
+// @Description Record that the current user accepted the given terms version. Only the current version (TERMS_VERSION) can be accepted; other authenticated routes answer 428 until it is.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param terms body models.AcceptTermsRequest true "Accepted terms version"
+// @Success 200 {object} models.ProfileResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.TermsRequiredResponse
+// @Router /api/v1/profile/accept-terms [post]
+func (h *Handler) AcceptTerms(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.AcceptTermsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if req.Version == "" {
+		return models.NewValidationError("Terms version is required", map[string]string{"version": "is required"})
+	}
+
+	// The app may have shown an older version than the one now in force
+	current := middleware.CurrentTermsVersion()
+	if req.Version != current {
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "Only the current terms version can be accepted").WithDetails(models.TermsDetails{TermsVersion: current})
+	}
+
+	var user models.User
+	err := h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		user.AcceptedTermsVersion = req.Version
+		user.TermsAcceptedAt = &now
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"accepted_terms_version": user.AcceptedTermsVersion,
+			"terms_accepted_at":      user.TermsAcceptedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "terms.accept",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"accepted_terms_version"},
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	if err != nil {
+		return err
+	}
+	h.cache.InvalidateUser(c.UserContext(), user.ID)
+
+	return c.JSON(models.ProfileResponse{
+		User: user,
+	})
+}
@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestTermsGate(t *testing.T) {
+	env := testutil.NewEnv(t)
+	env.Config.TermsVersion = "2026-10"
+	user := testutil.CreateUser(t, env.DB)
+	auth := testutil.AuthHeader(t, user)
+
+	// The error handler renders the gate's error with the version to accept
+	status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/profile/points/balance", "", auth)
+	var failure models.TermsRequiredResponse
+	if status != http.StatusPreconditionRequired || json.Unmarshal([]byte(body), &failure) != nil {
+		t.Fatalf("status %d: %s, want 428", status, body)
+	}
+	if failure.Code != models.CodeTermsNotAccepted || failure.Details.TermsVersion != "2026-10" {
+		t.Errorf("error %s, want %s for 2026-10", body, models.CodeTermsNotAccepted)
+	}
+
+	if status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/profile", "", auth); status != http.StatusOK {
+		t.Errorf("profile before accepting: status %d: %s", status, body)
+	}
+
+	status, body = testutil.Request(t, env.App, http.MethodPost, "/api/v1/profile/accept-terms", `{"version":"2026-09"}`, auth)
+	if status != http.StatusConflict || json.Unmarshal([]byte(body), &failure) != nil || failure.Details.TermsVersion != "2026-10" {
+		t.Fatalf("accepting an old version: status %d: %s, want 409 naming 2026-10", status, body)
+	}
+
+	if status, body := testutil.Request(t, env.App, http.MethodPost, "/api/v1/profile/accept-terms", `{"version":"2026-10"}`, auth); status != http.StatusOK {
+		t.Fatalf("accept: status %d: %s", status, body)
+	}
+	if status, body := testutil.Request(t, env.App, http.MethodGet, "/api/v1/profile/points/balance", "", auth); status != http.StatusOK {
+		t.Errorf("after accepting: status %d: %s", status, body)
+	}
+}
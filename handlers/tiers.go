@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/notify"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/tiers"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// tierHistoryPages are the sort and filter keys of GET /profile/tier/history.
+var tierHistoryPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+}
+
+// GetTierHistory godoc
+// @Summary Get tier history
+// @Description List the current user's tier changes, newest first, with the qualifying points at the time and why the tier changed.
+// @Tags Profile
+// @Security BearerAuth
+// @Security APIKey
+// @Produce json
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Entries per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.TierChange}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/profile/tier/history [get]
+func (h *Handler) GetTierHistory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, tierHistoryPages)
+	if err != nil {
+		return err
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID)
+	page, err := pagination.Find[models.TierChange](query, params)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load tier history")
+	}
+	return c.JSON(page)
+}
+
+// RecalculateTiers is the scheduled tier job. It places every member in the
+// tier their qualifying points reach, which moves members down once the
+// points that earned them their tier leave the qualifying period. Each member
+// is evaluated in a transaction of their own.
+func (h *Handler) RecalculateTiers(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+
+	var errs []error
+	upgrades, downgrades := 0, 0
+	var users []models.User
+	err := db.Select("id").FindInBatches(&users, 500, func(*gorm.DB, int) error {
+		for i := range users {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var change *models.TierChange
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				change, err = tiers.Evaluate(tx, &users[i], false, tiers.ReasonRecalculated)
+				return err
+			})
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("recalculating the tier of user %d: %w", users[i].ID, err))
+			case change != nil && change.Upgrade:
+				h.cache.InvalidateUser(ctx, users[i].ID)
+				upgrades++
+			case change != nil:
+				h.cache.InvalidateUser(ctx, users[i].ID)
+				downgrades++
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if upgrades+downgrades > 0 {
+		log.Printf("[tiers] moved %d members up and %d down", upgrades, downgrades)
+	}
+	return errors.Join(errs...)
+}
+
+// SendTierNotices tells members about tier changes they have not heard of,
+// by push and, when PUBLIC_URL is set for the links, by email. A change is
+// marked before its notice goes out, so it is announced once even when the
+// job runs on several instances or the notice cannot be delivered.
+func (h *Handler) SendTierNotices(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+
+	var changes []models.TierChange
+	if err := db.Where("notified_at IS NULL").Order("id").Limit(100).Find(&changes).Error; err != nil {
+		return err
+	}
+
+	baseURL := h.cfg.BaseURL()
+	for _, change := range changes {
+		claim := db.Model(&models.TierChange{}).
+			Where("id = ? AND notified_at IS NULL", change.ID).
+			Update("notified_at", time.Now())
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		var user models.User
+		if err := db.First(&user, change.UserID).Error; err != nil {
+			continue
+		}
+
+		locale := supportedLocales[0].String()
+		to := h.tierContent(ctx, change.ToTier, locale).Name
+		subject := fmt.Sprintf("Your membership is now %s", to)
+		body := fmt.Sprintf("Your membership moved from %s to %s. The points you earn count towards moving up again.",
+			h.tierContent(ctx, change.FromTier, locale).Name, to)
+		if change.Upgrade {
+			subject = fmt.Sprintf("Welcome to %s", to)
+			body = fmt.Sprintf("Congratulations, you are now a %s member. See your new benefits in the app.", to)
+		}
+
+		if err := notify.Inbox(db, user.ID, models.NotificationCategoryPoints, subject, body); err != nil {
+			log.Printf("[tiers] tier change notification for user %d not created: %v", user.ID, err)
+		}
+		if baseURL != "" {
+			if err := h.notify.Email(h.db, baseURL, &user, models.NotificationCategoryPoints, subject, body); err != nil {
+				log.Printf("[tiers] tier change email for user %d not sent: %v", user.ID, err)
+			}
+		}
+		if _, err := h.notify.Push(h.db, &user, models.NotificationCategoryPoints, subject, body); err != nil {
+			log.Printf("[tiers] tier change push for user %d not sent: %v", user.ID, err)
+		}
+		if _, err := h.notify.SMS(h.db, &user, models.NotificationCategoryPoints, body); err != nil && !errors.Is(err, notify.ErrOptedOut) {
+			log.Printf("[tiers] tier change SMS for user %d not sent: %v", user.ID, err)
+		}
+	}
+	return nil
+}
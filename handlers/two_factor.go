@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/totp"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorMaxAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+
+	recoveryCodeCount      = 10
+	recoveryCodeHalfLength = 4
+	// No 0/o, 1/l: recovery codes are often copied from paper
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+// errTwoFactorLocked is returned after too many wrong codes.
+var errTwoFactorLocked = errors.New("too many wrong two-factor codes")
+
+// errTwoFactorCodeUsed is returned from the transaction enabling two-factor
+// authentication when a concurrent request enabled it or used the code first.
+var errTwoFactorCodeUsed = errors.New("two-factor code already used")
+
+// SetupTwoFactor godoc
+// @Summary Start two-factor setup
+// @Description Create a new authenticator secret for the current user. Show provisioning_uri as a QR code (or the secret for manual entry), then confirm with /profile/2fa/enable. Calling setup again replaces a secret that has not been enabled.
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.TwoFactorSetupResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/profile/2fa/setup [post]
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+
+	var enrollment models.TwoFactor
+	err := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).First(&enrollment).Error
+	if err == nil && enrollment.EnabledAt != nil {
+		return models.NewAppError(fiber.StatusConflict, models.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	sealed, err := totp.Seal(secret)
+	if err != nil {
+		return err
+	}
+
+	enrollment.UserID = userID
+	enrollment.SecretEncrypted = sealed
+	if err := h.db.WithContext(c.UserContext()).Save(&enrollment).Error; err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to start two-factor setup")
+	}
+
+	return c.JSON(models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, h.cfg.TOTP.Issuer, user.Email),
+	})
+}
+
+// EnableTwoFactor godoc
+// @Summary Enable two-factor authentication
+// @Description Confirm the secret from /profile/2fa/setup with a code from the authenticator app. From then on login asks for a code. The response holds single-use recovery codes for when the device is lost; they are shown only once.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body models.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/profile/2fa/enable [post]
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	var enrollment models.TwoFactor
+	if err := h.db.WithContext(c.UserContext()).Where("user_id = ?", userID).First(&enrollment).Error; err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeBadRequest, "Start two-factor setup first")
+	}
+	if enrollment.EnabledAt != nil {
+		return models.NewAppError(fiber.StatusConflict, models.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.Open(enrollment.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidCode, "Invalid code")
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		// Enable only once, and with a code not used before, even with
+		// concurrent requests
+		result := tx.Model(&enrollment).
+			Where("enabled_at IS NULL AND last_used_step < ?", step).
+			Updates(map[string]interface{}{
+				"enabled_at":      time.Now(),
+				"last_used_step":  step,
+				"failed_attempts": 0,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTwoFactorCodeUsed
+		}
+		if err := replaceRecoveryCodes(tx, userID, codes); err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "2fa.enable",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"two_factor"},
+		}).Error
+	})
+	if errors.Is(err, errTwoFactorCodeUsed) {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidCode, "Invalid code")
+	}
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to enable two-factor authentication")
+	}
+
+	return c.JSON(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor authentication with the password and an authenticator or recovery code. The authenticator secret and recovery codes are deleted and the account is notified by email.
+// @Tags Profile
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param credentials body models.DisableTwoFactorRequest true "Password and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/profile/2fa/disable [post]
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req models.DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"password": req.Password, "code": req.Code}); len(fields) > 0 {
+		return models.NewValidationError("Password and code are required", fields)
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return models.NewValidationError("Password is incorrect", map[string]string{"password": "is incorrect"})
+	}
+
+	ok, err := h.checkSecondFactor(c.UserContext(), userID, req.Code)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeTwoFactorNotEnabled, "Two-factor authentication is not enabled")
+	case errors.Is(err, errTwoFactorLocked):
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeTooManyAttempts, "Too many wrong codes; try again later")
+	case err != nil:
+		return err
+	case !ok:
+		return models.NewValidationError("Invalid code", map[string]string{"code": "is invalid"})
+	}
+
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditLog{
+			Actor:      auditActor(c),
+			Action:     "2fa.disable",
+			Resource:   "users",
+			ResourceID: userID,
+			Fields:     []string{"two_factor"},
+		}).Error
+	})
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to disable two-factor authentication")
+	}
+
+	body := "Two-factor authentication was just turned off for your account. If this was not you, reset your password right away and contact support."
+	if err := h.notify.Email(h.db.WithContext(c.UserContext()), h.cfg.BaseURL(), &user, models.NotificationCategoryAccount, "Two-factor authentication turned off", body); err != nil {
+		middleware.Logf(c, "[auth] 2fa disabled notice for user %d not sent: %v", user.ID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete login with a second factor
+// @Description Exchange the challenge token from login and an authenticator or recovery code for the tokens. After 5 wrong codes the account's second factor is locked for 15 minutes.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param verification body models.TwoFactorVerifyRequest true "Challenge token and code"
+// @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/auth/2fa/verify [post]
+func (h *Handler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req models.TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return models.NewAppError(fiber.StatusBadRequest, models.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if fields := requiredFields(map[string]string{"challenge_token": req.ChallengeToken, "code": req.Code}); len(fields) > 0 {
+		return models.NewValidationError("Challenge token and code are required", fields)
+	}
+
+	user, err := h.VerifyTwoFactorChallenge(c.UserContext(), req.ChallengeToken, req.Code)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := h.issueTokens(c, user)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to generate token")
+	}
+
+	return c.JSON(models.AuthResponse{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         *user,
+	})
+}
+
+// VerifyTwoFactorChallenge returns the user who passes the second factor of
+// their login with challengeToken, from login, and code, for
+// POST /auth/2fa/verify and the gRPC API alike. Issuing the tokens is left
+// to the caller.
+func (h *Handler) VerifyTwoFactorChallenge(ctx context.Context, challengeToken, code string) (*models.User, error) {
+	userID, err := middleware.ParseTwoFactorChallenge(challengeToken)
+	if err != nil {
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeSessionExpired, "Login session expired; log in again")
+	}
+
+	ok, err := h.checkSecondFactor(ctx, userID, code)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Two-factor was turned off since the challenge was issued
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeSessionExpired, "Login session expired; log in again")
+	case errors.Is(err, errTwoFactorLocked):
+		return nil, models.NewAppError(fiber.StatusTooManyRequests, models.CodeTooManyAttempts, "Too many wrong codes; try again later")
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidCode, "Invalid code")
+	}
+
+	var user models.User
+	if err := h.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeSessionExpired, "Login session expired; log in again")
+	}
+	if user.SuspendedAt != nil {
+		return nil, errAccountSuspended
+	}
+	return &user, nil
+}
+
+// loginResponse finishes a successful first-factor login: users with
+// two-factor authentication get a challenge (202), everyone else their
+// tokens with the given status.
+func (h *Handler) loginResponse(c *fiber.Ctx, user *models.User, status int) error {
+	signIn, err := h.accounts.SignIn(c.UserContext(), user, clientOf(c))
+	if err != nil {
+		return err
+	}
+	if signIn.Challenge != nil {
+		return c.Status(fiber.StatusAccepted).JSON(signIn.Challenge)
+	}
+
+	return c.Status(status).JSON(models.AuthResponse{
+		Token:        signIn.Tokens.Token,
+		RefreshToken: signIn.Tokens.RefreshToken,
+		ExpiresIn:    signIn.Tokens.ExpiresIn,
+		User:         *user,
+	})
+}
+
+// checkSecondFactor accepts an authenticator code, or else an unused
+// recovery code, for the user's enabled two-factor enrollment. It returns
+// gorm.ErrRecordNotFound when two-factor is not enabled and
+// errTwoFactorLocked after too many wrong codes.
+func (h *Handler) checkSecondFactor(ctx context.Context, userID uint, code string) (bool, error) {
+	var enrollment models.TwoFactor
+	err := h.db.WithContext(ctx).Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&enrollment).Error
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	lockExpired := enrollment.LastFailedAt == nil || now.Sub(*enrollment.LastFailedAt) > twoFactorLockout
+	if enrollment.FailedAttempts >= twoFactorMaxAttempts && !lockExpired {
+		return false, errTwoFactorLocked
+	}
+
+	secret, err := totp.Open(enrollment.SecretEncrypted)
+	if err != nil {
+		return false, err
+	}
+	if step, ok := totp.Validate(secret, code, now); ok && step > enrollment.LastUsedStep {
+		// A code works once: of concurrent requests with it only the one
+		// that moves last_used_step on is accepted
+		result := h.db.WithContext(ctx).Model(&enrollment).
+			Where("last_used_step < ?", step).
+			Updates(map[string]interface{}{
+				"last_used_step":  step,
+				"failed_attempts": 0,
+			})
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return true, nil
+		}
+	}
+
+	result := h.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashCode(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		err := h.db.WithContext(ctx).Model(&enrollment).Update("failed_attempts", 0).Error
+		return err == nil, err
+	}
+
+	// Counted in the database so that concurrent wrong codes all count; a
+	// lockout that has expired starts the count again
+	err = h.db.WithContext(ctx).Model(&enrollment).Updates(map[string]interface{}{
+		"failed_attempts": gorm.Expr("CASE WHEN failed_attempts >= ? AND (last_failed_at IS NULL OR last_failed_at < ?) THEN 1 ELSE failed_attempts + 1 END",
+			twoFactorMaxAttempts, now.Add(-twoFactorLockout)),
+		"last_failed_at": now,
+	}).Error
+	return false, err
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as xxxx-xxxx.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 2*recoveryCodeHalfLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j, b := range raw {
+			raw[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(raw[:recoveryCodeHalfLength]) + "-" + string(raw[recoveryCodeHalfLength:])
+	}
+	return codes, nil
+}
+
+// replaceRecoveryCodes stores the hashes of codes for the user, dropping the
+// previous ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	rows := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: hashCode(normalizeRecoveryCode(code))}
+	}
+	return tx.Create(&rows).Error
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
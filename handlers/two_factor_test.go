@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+	"temp-backend-at-kbtg/totp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTwoFactor(t *testing.T) {
+	app, db := testutil.NewApp(t)
+	user := testutil.CreateUser(t, db)
+	auth := testutil.AuthHeader(t, user)
+
+	status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/profile/2fa/setup", "", auth)
+	var setup models.TwoFactorSetupResponse
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &setup) != nil || setup.Secret == "" {
+		t.Fatalf("setup: status %d: %s", status, body)
+	}
+	var enrollment models.TwoFactor
+	if err := db.Where("user_id = ?", user.ID).First(&enrollment).Error; err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.SecretEncrypted == setup.Secret {
+		t.Error("secret stored in the clear")
+	}
+
+	now := time.Now()
+	code := func(offset time.Duration) string {
+		t.Helper()
+		c, err := totp.Code(setup.Secret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	step := 30 * time.Second
+
+	if status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/profile/2fa/enable", `{"code":"000000"}`, auth); status != http.StatusBadRequest {
+		t.Fatalf("enable with a wrong code: status %d: %s", status, body)
+	}
+	status, body = testutil.Request(t, app, http.MethodPost, "/api/v1/profile/2fa/enable", fmt.Sprintf(`{"code":%q}`, code(0)), auth)
+	var recovery models.RecoveryCodesResponse
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &recovery) != nil || len(recovery.RecoveryCodes) == 0 {
+		t.Fatalf("enable: status %d: %s", status, body)
+	}
+	if status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/profile/2fa/enable", fmt.Sprintf(`{"code":%q}`, code(step)), auth); status != http.StatusConflict {
+		t.Fatalf("enable twice: status %d: %s", status, body)
+	}
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "code that enabled it is spent", code: code(0), wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidCode},
+		{name: "earlier code", code: code(-step), wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidCode},
+		{name: "code outside the window", code: code(3 * step), wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidCode},
+		{name: "next code", code: code(step), wantStatus: http.StatusOK},
+		{name: "next code again", code: code(step), wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidCode},
+		{name: "recovery code", code: recovery.RecoveryCodes[0], wantStatus: http.StatusOK},
+		{name: "recovery code again", code: recovery.RecoveryCodes[0], wantStatus: http.StatusUnauthorized, wantCode: models.CodeInvalidCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/2fa/verify",
+				fmt.Sprintf(`{"challenge_token":%q,"code":%q}`, loginChallenge(t, app, user), tt.code), "")
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				var failure models.ErrorResponse
+				if err := json.Unmarshal([]byte(body), &failure); err != nil || failure.Code != tt.wantCode {
+					t.Errorf("error %s, want code %s", body, tt.wantCode)
+				}
+			}
+		})
+	}
+
+	t.Run("locked after wrong codes", func(t *testing.T) {
+		// The wrong codes above count too
+		if err := db.Model(&models.TwoFactor{}).Where("user_id = ?", user.ID).Update("failed_attempts", 0).Error; err != nil {
+			t.Fatal(err)
+		}
+		challenge := loginChallenge(t, app, user)
+		verify := func() int {
+			status, _ := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/2fa/verify",
+				fmt.Sprintf(`{"challenge_token":%q,"code":"000000"}`, challenge), "")
+			return status
+		}
+		for i := 0; i < 5; i++ {
+			if status := verify(); status != http.StatusUnauthorized {
+				t.Fatalf("wrong code %d: status %d", i+1, status)
+			}
+		}
+		if status := verify(); status != http.StatusTooManyRequests {
+			t.Errorf("after 5 wrong codes: status %d, want %d", status, http.StatusTooManyRequests)
+		}
+	})
+}
+
+// loginChallenge logs user in with the password and returns the challenge
+// token of the second factor.
+func loginChallenge(t *testing.T, app *fiber.App, user models.User) string {
+	t.Helper()
+
+	status, body := testutil.Request(t, app, http.MethodPost, "/api/v1/auth/login",
+		fmt.Sprintf(`{"email":%q,"password":%q}`, user.Email, testutil.DefaultPassword), "")
+	var challenge models.TwoFactorChallengeResponse
+	if status != http.StatusAccepted || json.Unmarshal([]byte(body), &challenge) != nil || challenge.ChallengeToken == "" {
+		t.Fatalf("login: status %d: %s", status, body)
+	}
+	return challenge.ChallengeToken
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/payment"
+	"temp-backend-at-kbtg/wallet"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// walletStatementPages are the sort and filter keys of GET /wallet/statement.
+var walletStatementPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"type": "type"},
+}
+
+// GetWallet godoc
+// @Summary Get my wallet
+// @Description Get the current user's wallet balance in satang (1/100 THB). The wallet is separate from loyalty points; an empty one is opened on first use.
+// @Tags Wallet
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.WalletAccount
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/wallet [get]
+func (h *Handler) GetWallet(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	account, err := wallet.Account(h.db.WithContext(c.UserContext()), userID)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load wallet")
+	}
+	return c.JSON(account)
+}
+
+// GetWalletStatement godoc
+// @Summary Get my wallet statement
+// @Description List the entries of the current user's wallet, newest first: a signed amount and the balance after it for each top-up, payment and transfer.
+// @Tags Wallet
+// @Security BearerAuth
+// @Produce json
+// @Param filter[type] query string false "topup, payment or transfer"
+// @Param sort query string false "id or created_at, - for descending (default -id)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Entries per page (default 20, max 100)"
+// @Success 200 {object} models.PagedResponse{items=[]models.WalletEntry}
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/v1/wallet/statement [get]
+func (h *Handler) GetWalletStatement(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	params, err := pagination.Parse(c, walletStatementPages)
+	if err != nil {
+		return err
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	account, err := wallet.Account(db, userID)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load wallet statement")
+	}
+	page, err := pagination.Find[models.WalletEntry](db.Where("account_id = ?", account.ID), params)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to load wallet statement")
+	}
+	return c.JSON(page)
+}
+
+// TopUpWallet godoc
+// @Summary Top up my wallet
+// @Description Charge amount satang to the current user's payment method and credit it to their wallet. The Idempotency-Key header identifies the request: a retry with the same key and body returns the original transaction with Idempotent-Replayed: true instead of charging again, and the same key with a different body is rejected. Top-ups that would take the balance above the wallet limit are refused before charging.
+// @Tags Wallet
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string true "Unique key for this top-up"
+// @Param request body models.WalletTopUpRequest true "Amount in satang"
+// @Success 200 {object} models.WalletTransactionResponse "Replay of an earlier request"
+// @Success 201 {object} models.WalletTransactionResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 402 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/wallet/topup [post]
+func (h *Handler) TopUpWallet(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	key, err := idempotencyKey(c)
+	if err != nil {
+		return err
+	}
+	var req models.WalletTopUpRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	matches := func(txn models.WalletTransaction) bool {
+		return txn.Type == models.WalletTopUp && txn.Amount == req.Amount
+	}
+
+	if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+		return err
+	}
+
+	// Checked again when crediting; this only avoids charging for a top-up
+	// that would be refused
+	db := h.db.WithContext(c.UserContext())
+	account, err := wallet.Account(db, userID)
+	if err != nil {
+		return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Failed to top up wallet")
+	}
+	if maxBalance := h.cfg.Wallet.MaxBalance; maxBalance > 0 && account.Balance+req.Amount > maxBalance {
+		return walletError(wallet.ErrBalanceLimit, "")
+	}
+
+	chargeID, err := h.payments.Charge(userID, req.Amount, fmt.Sprintf("wallet-topup:%d:%s", userID, key))
+	switch {
+	case errors.Is(err, payment.ErrNotConfigured):
+		return models.NewAppError(fiber.StatusServiceUnavailable, models.CodeServiceUnavailable, "Top-ups are not available")
+	case errors.Is(err, payment.ErrDeclined):
+		return models.NewAppError(fiber.StatusPaymentRequired, models.CodePaymentDeclined, "Payment was declined")
+	case err != nil:
+		log.Printf("[wallet] top-up charge for user %d failed: %v", userID, err)
+		return models.NewAppError(fiber.StatusBadGateway, models.CodeUpstreamFailed, "Payment failed")
+	}
+
+	var txn *models.WalletTransaction
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		txn, account, err = wallet.TopUp(tx, userID, models.WalletTransaction{
+			Amount:         req.Amount,
+			Reference:      chargeID,
+			IdempotencyKey: key,
+		})
+		return err
+	})
+	if err != nil {
+		// The member paid; support has to credit or refund the charge
+		log.Printf("[wallet] charge %s of %d satang for user %d not credited: %v", chargeID, req.Amount, userID, err)
+	}
+	// A concurrent retry committed first
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return walletError(err, "Failed to top up wallet")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.WalletTransactionResponse{
+		Transaction: *txn,
+		Balance:     account.Balance,
+	})
+}
+
+// PayFromWallet godoc
+// @Summary Pay from my wallet
+// @Description Debit amount satang from the current user's wallet, e.g. for a purchase. The balance never goes below zero. The Idempotency-Key header identifies the request: a retry with the same key and body returns the original transaction with Idempotent-Replayed: true instead of paying again, and the same key with a different body is rejected.
+// @Tags Wallet
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string true "Unique key for this payment, e.g. the order ID"
+// @Param request body models.WalletPaymentRequest true "Amount in satang and what it is for"
+// @Success 200 {object} models.WalletTransactionResponse "Replay of an earlier request"
+// @Success 201 {object} models.WalletTransactionResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /api/v1/wallet/pay [post]
+func (h *Handler) PayFromWallet(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	key, err := idempotencyKey(c)
+	if err != nil {
+		return err
+	}
+	var req models.WalletPaymentRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	matches := func(txn models.WalletTransaction) bool {
+		return txn.Type == models.WalletPayment && txn.Amount == req.Amount && txn.Description == req.Description
+	}
+
+	if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+		return err
+	}
+
+	var txn *models.WalletTransaction
+	var account *models.WalletAccount
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var err error
+		txn, account, err = wallet.Pay(tx, userID, models.WalletTransaction{
+			Amount:         req.Amount,
+			Description:    req.Description,
+			IdempotencyKey: key,
+		})
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return walletError(err, "Failed to pay from wallet")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.WalletTransactionResponse{
+		Transaction: *txn,
+		Balance:     account.Balance,
+	})
+}
+
+// TransferFromWallet godoc
+// @Summary Transfer to another member
+// @Description Move amount satang from the current user's wallet to another member's, identified by membership ID. Both wallets change in one transaction. The Idempotency-Key header identifies the request: a retry with the same key and body returns the original transaction with Idempotent-Replayed: true instead of transferring again, and the same key with a different body is rejected.
+// @Tags Wallet
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string true "Unique key for this transfer"
+// @Param request body models.WalletTransferRequest true "Recipient, amount in satang and an optional note"
+// @Success 200 {object} models.WalletTransactionResponse "Replay of an earlier request"
+// @Success 201 {object} models.WalletTransactionResponse
+// @Failure 400 {object} models.ValidationErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /api/v1/wallet/transfer [post]
+func (h *Handler) TransferFromWallet(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	key, err := idempotencyKey(c)
+	if err != nil {
+		return err
+	}
+	var req models.WalletTransferRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	req.MembershipID = strings.ToUpper(strings.TrimSpace(req.MembershipID))
+	req.Description = strings.TrimSpace(req.Description)
+	matches := func(txn models.WalletTransaction) bool {
+		return txn.Type == models.WalletTransfer && txn.Amount == req.Amount &&
+			txn.Reference == req.MembershipID && txn.Description == req.Description
+	}
+
+	if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+		return err
+	}
+
+	db := h.db.WithContext(c.UserContext())
+	var sender, recipient models.User
+	if err := db.First(&sender, userID).Error; err != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "User not found")
+	}
+	err = db.Where("membership_id = ?", req.MembershipID).First(&recipient).Error
+	if err != nil || recipient.SuspendedAt != nil {
+		return models.NewAppError(fiber.StatusNotFound, models.CodeUserNotFound, "Member not found")
+	}
+
+	var txn *models.WalletTransaction
+	var account *models.WalletAccount
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		txn, account, err = wallet.Transfer(tx, &sender, &recipient, models.WalletTransaction{
+			Amount:         req.Amount,
+			Description:    req.Description,
+			IdempotencyKey: key,
+		})
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		if replayed, err := h.replayWallet(c, userID, key, matches); replayed || err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return walletError(err, "Failed to transfer")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.WalletTransactionResponse{
+		Transaction: *txn,
+		Balance:     account.Balance,
+	})
+}
+
+// replayWallet answers a retried wallet operation with the transaction its
+// Idempotency-Key already recorded, and the current balance. It reports
+// false when the key is new. A transaction matches rejects was recorded for
+// a different request.
+func (h *Handler) replayWallet(c *fiber.Ctx, userID uint, key string, matches func(models.WalletTransaction) bool) (bool, error) {
+	db := h.db.WithContext(c.UserContext())
+
+	var txn models.WalletTransaction
+	err := db.Where("initiator_id = ? AND idempotency_key = ?", userID, key).First(&txn).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	if !matches(txn) {
+		return true, models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeIdempotencyKeyReused,
+			"Idempotency-Key was already used for a different request")
+	}
+
+	account, err := wallet.Account(db, userID)
+	if err != nil {
+		return true, err
+	}
+	c.Set("Idempotent-Replayed", "true")
+	return true, c.JSON(models.WalletTransactionResponse{
+		Transaction: txn,
+		Balance:     account.Balance,
+	})
+}
+
+// walletError maps the errors of the wallet package to responses; other
+// errors become a 500 with message.
+func walletError(err error, message string) error {
+	switch {
+	case errors.Is(err, wallet.ErrInsufficientFunds):
+		return models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeInsufficientFunds, "Not enough money in the wallet")
+	case errors.Is(err, wallet.ErrBalanceLimit):
+		return models.NewAppError(fiber.StatusUnprocessableEntity, models.CodeWalletBalanceLimit, "Wallet balance limit reached")
+	case errors.Is(err, wallet.ErrSameWallet):
+		return models.NewValidationError("Invalid transfer", map[string]string{"membership_id": "cannot be your own"})
+	}
+	return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, message)
+}
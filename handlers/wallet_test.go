@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/payment"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestTopUpWallet(t *testing.T) {
+	tests := []struct {
+		name       string
+		chargeErr  error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "charged and credited", wantStatus: http.StatusCreated},
+		{name: "declined", chargeErr: payment.ErrDeclined, wantStatus: http.StatusPaymentRequired, wantCode: models.CodePaymentDeclined},
+		{name: "no gateway", chargeErr: payment.ErrNotConfigured, wantStatus: http.StatusServiceUnavailable, wantCode: models.CodeServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewEnv(t)
+			env.Payments.SetErr(tt.chargeErr)
+			user := testutil.CreateUser(t, env.DB)
+
+			status, body := testutil.RequestWithHeaders(t, env.App, http.MethodPost, "/api/v1/wallet/topup", `{"amount":50000}`, map[string]string{
+				"Authorization":   testutil.AuthHeader(t, user),
+				"Idempotency-Key": "topup-1",
+			})
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				var failure models.ErrorResponse
+				if err := json.Unmarshal([]byte(body), &failure); err != nil || failure.Code != tt.wantCode {
+					t.Errorf("error %s, want code %s", body, tt.wantCode)
+				}
+				if charges := env.Payments.Charges(); len(charges) != 0 {
+					t.Errorf("charges %v, want none", charges)
+				}
+				return
+			}
+
+			var resp models.WalletTransactionResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil {
+				t.Fatal(err)
+			}
+			charges := env.Payments.Charges()
+			want := testutil.Charge{UserID: user.ID, Amount: 50000, Reference: "wallet-topup:" + strconv.FormatUint(uint64(user.ID), 10) + ":topup-1"}
+			if len(charges) != 1 || charges[0] != want {
+				t.Fatalf("charges %v, want %v", charges, want)
+			}
+			if resp.Balance != 50000 || resp.Transaction.Reference != "ch_1" {
+				t.Errorf("balance %d after charge %q, want 50000 after ch_1", resp.Balance, resp.Transaction.Reference)
+			}
+		})
+	}
+}
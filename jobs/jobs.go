@@ -0,0 +1,317 @@
+// Package jobs runs background work, such as sending email and exporting
+// reports, outside the request that asked for it. Each job type is
+// registered with a Policy that says how often and how soon a failed job
+// is tried again.
+//
+// With jobs.backend memory the queue lives in the server, which runs the
+// jobs itself. With redis the queue is shared through Redis: servers only
+// enqueue, and `go run . worker` processes run the jobs, so queued work
+// survives restarts and workers scale apart from the API. A job whose
+// worker dies mid-run is taken up again once its lease runs out.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/retry"
+	"temp-backend-at-kbtg/tenant"
+	"temp-backend-at-kbtg/worker"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// pollInterval is how often an idle worker looks for due jobs.
+	pollInterval = time.Second
+	// leaseMargin is added to the longest timeout to get how long a running
+	// job is left to its worker before another may take it up.
+	leaseMargin = time.Minute
+	// recentJobs is how many jobs are kept for GET /admin/jobs, and
+	// retention how long finished ones are kept at most.
+	recentJobs = 1000
+	retention  = 7 * 24 * time.Hour
+)
+
+// Handler does the work of a job with the payload it was enqueued with. The
+// result, if any, is stored with the job as JSON. ctx carries the tenant
+// the job was queued for and is cancelled at the policy's timeout and when
+// the process shuts down.
+type Handler func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// Policy is how a job type is retried.
+type Policy struct {
+	// MaxAttempts is how often a job is tried before it is failed.
+	MaxAttempts int
+	// RetryDelay is the delay after the first failed attempt; it doubles
+	// with every further failure up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Timeout cancels an attempt that runs longer.
+	Timeout time.Duration
+}
+
+type jobType struct {
+	policy  Policy
+	handler Handler
+}
+
+var (
+	mu          sync.RWMutex
+	types       = map[string]jobType{}
+	concurrency = 4
+	// wake tells an idle worker of the memory backend that a job was
+	// queued, so it does not wait for the next poll.
+	wake = make(chan struct{}, 1)
+)
+
+// queue is the backend selected by Init.
+var queue backend = newMemoryBackend()
+
+// Init selects the backend of cfg, connecting to Redis at redisURL for the
+// redis backend.
+func Init(cfg config.JobsConfig, redisURL string) error {
+	concurrency = cfg.Concurrency
+	if cfg.Backend != "redis" {
+		return nil
+	}
+	store, err := newRedisBackend(redisURL)
+	if err != nil {
+		return err
+	}
+	queue = store
+	log.Printf("Queueing background jobs in Redis at %s", store.client.Addr)
+	return nil
+}
+
+// Register makes name a job type run by handler under policy. Servers and
+// workers register the same types at startup, before enqueueing any.
+func Register(name string, policy Policy, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	types[name] = jobType{policy: policy, handler: handler}
+}
+
+// Enqueue queues a job of type name with payload, marshalled as JSON, to
+// run as soon as a worker is free, for the tenant in ctx.
+func Enqueue(ctx context.Context, name string, payload interface{}) (*models.Job, error) {
+	t, ok := lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("jobs: unknown job type %q", name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rec := &record{
+		Job: models.Job{
+			ID:          uuid.NewString(),
+			Type:        name,
+			Status:      models.JobQueued,
+			MaxAttempts: t.policy.MaxAttempts,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			RunAt:       &now,
+		},
+		Payload: data,
+		Tenant:  tenant.FromContext(ctx),
+	}
+	if err := queue.add(rec); err != nil {
+		return nil, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return &rec.Job, nil
+}
+
+// Start runs queued jobs in the background, jobs.concurrency at a time,
+// until shutdown. With the memory backend the jobs still due at shutdown
+// are tried once more before the server exits; Redis keeps them for the
+// next worker.
+func Start() {
+	_, drain := queue.(*memoryBackend)
+	for i := 0; i < concurrency; i++ {
+		worker.Go("jobs", func(ctx context.Context) {
+			work(ctx, drain)
+		})
+	}
+}
+
+// Get returns the job with id, or nil when there is none or it was
+// finished too long ago.
+func Get(id string) (*models.Job, error) {
+	rec, err := queue.get(id)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	return &rec.Job, nil
+}
+
+// List returns the counts and up to limit of the most recent jobs, newest
+// first, keeping only those of status and type name when they are set.
+func List(status, name string, limit int) (models.JobListResponse, error) {
+	counts, err := queue.counts()
+	if err != nil {
+		return models.JobListResponse{}, err
+	}
+	recent, err := queue.recent(recentJobs)
+	if err != nil {
+		return models.JobListResponse{}, err
+	}
+	jobs := []models.Job{}
+	for _, job := range recent {
+		if len(jobs) == limit {
+			break
+		}
+		if (status == "" || job.Status == status) && (name == "" || job.Type == name) {
+			jobs = append(jobs, job)
+		}
+	}
+	return models.JobListResponse{Backend: queue.name(), Counts: counts, Jobs: jobs}, nil
+}
+
+// Backend is the name of the backend, memory or redis.
+func Backend() string { return queue.name() }
+
+// Counts returns the number of jobs in each status.
+func Counts() (models.JobCounts, error) { return queue.counts() }
+
+// Close releases the backend's connection at shutdown.
+func Close() error { return queue.close() }
+
+// permanentError is a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure retrying cannot fix, such as a rejected
+// email address; the job is failed without further attempts.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func lookup(name string) (jobType, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := types[name]
+	return t, ok
+}
+
+// lease is how long a job may run before it is presumed lost with its
+// worker: the longest timeout of any type plus a margin.
+func lease() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	longest := time.Duration(0)
+	for _, t := range types {
+		longest = max(longest, t.policy.Timeout)
+	}
+	return longest + leaseMargin
+}
+
+// work runs due jobs one at a time until ctx is cancelled, then, with
+// drain, until none is due.
+func work(ctx context.Context, drain bool) {
+	for {
+		if ctx.Err() != nil && !drain {
+			return
+		}
+		rec, err := queue.claim(lease())
+		if err != nil {
+			log.Printf("[jobs] taking a job failed: %v", err)
+		}
+		if rec != nil {
+			run(ctx, rec)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// run attempts the claimed job rec and records the outcome: succeeded,
+// retrying after a backoff, or failed once the attempts are used up.
+func run(ctx context.Context, rec *record) {
+	t, ok := lookup(rec.Type)
+	var err error
+	var result interface{}
+	switch {
+	case !ok:
+		err = Permanent(fmt.Errorf("unknown job type %q", rec.Type))
+	case rec.Status == models.JobRunning:
+		// The lease of the previous attempt ran out before it finished
+		err = errors.New("worker stopped during the attempt")
+	}
+	if err == nil {
+		now := time.Now()
+		rec.Status = models.JobRunning
+		rec.Attempts++
+		rec.UpdatedAt = now
+		rec.RunAt = nil
+		if err := queue.start(rec); err != nil {
+			log.Printf("[jobs] %s %s not started: %v", rec.Type, rec.ID, err)
+			return
+		}
+		result, err = call(tenant.NewContext(ctx, rec.Tenant), t, rec.Payload)
+	}
+
+	now := time.Now()
+	rec.UpdatedAt = now
+	rec.Error = ""
+	var permanent permanentError
+	switch {
+	case err == nil:
+		rec.Status = models.JobSucceeded
+		rec.FinishedAt = &now
+		if result != nil {
+			if rec.Result, err = json.Marshal(result); err != nil {
+				log.Printf("[jobs] result of %s %s dropped: %v", rec.Type, rec.ID, err)
+			}
+		}
+	case errors.As(err, &permanent) || rec.Attempts >= rec.MaxAttempts:
+		log.Printf("[jobs] %s %s failed after %d attempts: %v", rec.Type, rec.ID, rec.Attempts, err)
+		rec.Status = models.JobFailed
+		rec.Error = retry.Error(err)
+		rec.FinishedAt = &now
+	default:
+		next := now.Add(retry.Backoff{Delay: t.policy.RetryDelay, MaxDelay: t.policy.MaxRetryDelay}.After(rec.Attempts))
+		log.Printf("[jobs] %s %s failed (attempt %d), retrying at %s: %v", rec.Type, rec.ID, rec.Attempts, next.Format(time.TimeOnly), err)
+		rec.Status = models.JobRetrying
+		rec.Error = retry.Error(err)
+		rec.RunAt = &next
+	}
+	if err := queue.save(rec); err != nil {
+		log.Printf("[jobs] outcome of %s %s not recorded: %v", rec.Type, rec.ID, err)
+	}
+}
+
+// call runs the handler of t within its timeout. A panic fails the attempt
+// instead of the worker.
+func call(ctx context.Context, t jobType, payload json.RawMessage) (result interface{}, err error) {
+	ctx, cancel := context.WithTimeout(ctx, t.policy.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.handler(ctx, payload)
+}
@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+)
+
+// record is a job as the backends store it, with its payload.
+type record struct {
+	models.Job
+	Payload json.RawMessage `json:"payload"`
+	// Tenant is the tenant the job was queued for, whose shard it runs
+	// against
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// backend stores the jobs and hands them to workers.
+type backend interface {
+	// add stores rec and queues it for rec.RunAt.
+	add(rec *record) error
+	// claim returns the job due first, or nil when none is due, and leases
+	// it to the caller: another claim returns it again only when it is not
+	// saved within lease.
+	claim(lease time.Duration) (*record, error)
+	// start stores rec as running under the caller's lease.
+	start(rec *record) error
+	// save stores the outcome of an attempt. A retrying job is queued again
+	// for rec.RunAt; a finished one is kept for GET /admin/jobs.
+	save(rec *record) error
+	// get returns the job with id, or nil.
+	get(id string) (*record, error)
+	// recent returns up to limit jobs, newest first.
+	recent(limit int) ([]models.Job, error)
+	counts() (models.JobCounts, error)
+	close() error
+	name() string
+}
+
+// memoryBackend keeps the jobs in the server's memory; they are lost when
+// it exits.
+type memoryBackend struct {
+	mu    sync.Mutex
+	jobs  map[string]record
+	order []string
+	// succeeded and failed count the jobs finished since startup
+	succeeded int64
+	failed    int64
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{jobs: map[string]record{}}
+}
+
+func (b *memoryBackend) add(rec *record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.jobs[rec.ID] = *rec
+	b.order = append(b.order, rec.ID)
+	b.prune()
+	return nil
+}
+
+// prune drops the oldest finished jobs beyond recentJobs. Jobs still to
+// run are kept however many there are.
+func (b *memoryBackend) prune() {
+	excess := len(b.order) - recentJobs
+	kept := b.order[:0]
+	for _, id := range b.order {
+		if excess > 0 && finished(b.jobs[id].Status) {
+			delete(b.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	b.order = kept
+}
+
+func (b *memoryBackend) claim(time.Duration) (*record, error) {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var next *record
+	for _, id := range b.order {
+		rec := b.jobs[id]
+		if (rec.Status == models.JobQueued || rec.Status == models.JobRetrying) && !rec.RunAt.After(now) &&
+			(next == nil || rec.RunAt.Before(*next.RunAt)) {
+			next = &rec
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	// Nothing else runs the job until it is saved; there are no other
+	// processes to lose it to
+	claimed := b.jobs[next.ID]
+	claimed.Status = models.JobRunning
+	b.jobs[next.ID] = claimed
+	return next, nil
+}
+
+func (b *memoryBackend) start(rec *record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.jobs[rec.ID] = *rec
+	return nil
+}
+
+func (b *memoryBackend) save(rec *record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.jobs[rec.ID] = *rec
+	switch rec.Status {
+	case models.JobSucceeded:
+		b.succeeded++
+	case models.JobFailed:
+		b.failed++
+	}
+	return nil
+}
+
+func (b *memoryBackend) get(id string) (*record, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rec, ok := b.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (b *memoryBackend) recent(limit int) ([]models.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]models.Job, 0, min(limit, len(b.order)))
+	for i := len(b.order) - 1; i >= 0 && len(jobs) < limit; i-- {
+		jobs = append(jobs, b.jobs[b.order[i]].Job)
+	}
+	return jobs, nil
+}
+
+func (b *memoryBackend) counts() (models.JobCounts, error) {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counts := models.JobCounts{Succeeded: b.succeeded, Failed: b.failed}
+	for _, rec := range b.jobs {
+		switch {
+		case rec.Status == models.JobRunning:
+			counts.Running++
+		case finished(rec.Status):
+		case rec.RunAt.After(now):
+			counts.Retrying++
+		default:
+			counts.Queued++
+		}
+	}
+	return counts, nil
+}
+
+func (b *memoryBackend) close() error { return nil }
+
+func (b *memoryBackend) name() string { return "memory" }
+
+func finished(status string) bool {
+	return status == models.JobSucceeded || status == models.JobFailed
+}
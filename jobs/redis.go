@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/redis"
+)
+
+// Redis keys. Each job is a JSON string under jobKey; jobs to run are in
+// the due sorted set scored by their due time in milliseconds, and jobs
+// being run in the running set scored by the end of their lease.
+const (
+	keyPrefix    = "jobs:"
+	dueKey       = keyPrefix + "due"
+	runningKey   = keyPrefix + "running"
+	recentKey    = keyPrefix + "recent"
+	succeededKey = keyPrefix + "succeeded"
+	failedKey    = keyPrefix + "failed"
+)
+
+func jobKey(id string) string { return keyPrefix + "job:" + id }
+
+// addScript stores a job, queues it and lists it among the recent ones.
+const addScript = `redis.call('SET', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+redis.call('LPUSH', KEYS[3], ARGV[2])
+redis.call('LTRIM', KEYS[3], 0, tonumber(ARGV[4]) - 1)
+return 1`
+
+// claimScript first queues again the jobs whose lease ran out, then moves
+// the job due first from the due set to the running set.
+const claimScript = `local now = tonumber(ARGV[1])
+local lost = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, 100)
+for _, id in ipairs(lost) do
+  redis.call('ZREM', KEYS[2], id)
+  redis.call('ZADD', KEYS[1], now, id)
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, 1)
+if #due == 0 then return false end
+redis.call('ZREM', KEYS[1], due[1])
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[2]), due[1])
+return due[1]`
+
+// saveScript stores the outcome of an attempt: a job to retry goes back to
+// the due set, a finished one expires after the retention and is counted.
+const saveScript = `redis.call('ZREM', KEYS[2], ARGV[2])
+if ARGV[3] ~= '' then
+  redis.call('SET', KEYS[1], ARGV[1])
+  redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2])
+else
+  redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[4])
+  redis.call('INCR', KEYS[4])
+end
+return 1`
+
+// redisBackend shares the queue between servers and workers through Redis.
+type redisBackend struct {
+	client *redis.Client
+}
+
+func newRedisBackend(rawURL string) (*redisBackend, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisBackend{client: client}, nil
+}
+
+func (b *redisBackend) add(rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Do("EVAL", addScript, "3", jobKey(rec.ID), dueKey, recentKey,
+		string(data), rec.ID, millis(*rec.RunAt), strconv.Itoa(recentJobs))
+	return err
+}
+
+func (b *redisBackend) claim(lease time.Duration) (*record, error) {
+	reply, err := b.client.Do("EVAL", claimScript, "2", dueKey, runningKey,
+		millis(time.Now()), strconv.FormatInt(lease.Milliseconds(), 10))
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	id, _ := reply.(string)
+	rec, err := b.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		// Expired or never stored completely; nothing to run
+		_, err := b.client.Do("ZREM", runningKey, id)
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (b *redisBackend) start(rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Do("SET", jobKey(rec.ID), string(data))
+	return err
+}
+
+func (b *redisBackend) save(rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	runAt, counter := "", succeededKey
+	switch {
+	case rec.Status == models.JobFailed:
+		counter = failedKey
+	case !finished(rec.Status):
+		runAt = millis(*rec.RunAt)
+	}
+	_, err = b.client.Do("EVAL", saveScript, "4", jobKey(rec.ID), runningKey, dueKey, counter,
+		string(data), rec.ID, runAt, strconv.Itoa(int(retention.Seconds())))
+	return err
+}
+
+func (b *redisBackend) get(id string) (*record, error) {
+	reply, err := b.client.Do("GET", jobKey(id))
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	return decode(reply)
+}
+
+func (b *redisBackend) recent(limit int) ([]models.Job, error) {
+	reply, err := b.client.Do("LRANGE", recentKey, "0", strconv.Itoa(limit-1))
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := reply.([]interface{})
+	if len(ids) == 0 {
+		return []models.Job{}, nil
+	}
+
+	args := []string{"MGET"}
+	for _, id := range ids {
+		args = append(args, jobKey(fmt.Sprint(id)))
+	}
+	reply, err = b.client.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]interface{})
+	jobs := make([]models.Job, 0, len(values))
+	for _, value := range values {
+		// Finished jobs past the retention are gone
+		if value == nil {
+			continue
+		}
+		rec, err := decode(value)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, rec.Job)
+	}
+	return jobs, nil
+}
+
+func (b *redisBackend) counts() (models.JobCounts, error) {
+	now := millis(time.Now())
+	var counts models.JobCounts
+	for _, c := range []struct {
+		count *int64
+		args  []string
+	}{
+		{&counts.Queued, []string{"ZCOUNT", dueKey, "-inf", now}},
+		{&counts.Retrying, []string{"ZCOUNT", dueKey, "(" + now, "+inf"}},
+		{&counts.Running, []string{"ZCARD", runningKey}},
+		{&counts.Succeeded, []string{"GET", succeededKey}},
+		{&counts.Failed, []string{"GET", failedKey}},
+	} {
+		reply, err := b.client.Do(c.args...)
+		if err != nil {
+			return counts, err
+		}
+		switch v := reply.(type) {
+		case int64:
+			*c.count = v
+		case string:
+			*c.count, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return counts, nil
+}
+
+func (b *redisBackend) close() error { return b.client.Close() }
+
+func (b *redisBackend) name() string { return "redis" }
+
+func decode(reply interface{}) (*record, error) {
+	data, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
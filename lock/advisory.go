@@ -0,0 +1,96 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Advisory takes locks as PostgreSQL transaction-level advisory locks. Each
+// held lock keeps a transaction open on a connection of its own, so the
+// pool must have room for them. A worker that dies drops its connection and
+// with it the lock; one that hangs leaves its transaction idle, which the
+// server ends after the TTL through idle_in_transaction_session_timeout.
+type Advisory struct {
+	db *sql.DB
+}
+
+// NewAdvisory returns a locker over the PostgreSQL database db.
+func NewAdvisory(db *gorm.DB) (*Advisory, error) {
+	if db.Dialector.Name() != "postgres" {
+		return nil, fmt.Errorf("lock: advisory locks need PostgreSQL, not %s", db.Dialector.Name())
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Advisory{db: sqlDB}, nil
+}
+
+// advisoryKey is the 64-bit key of the lock name.
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(keyPrefix + name))
+	return int64(h.Sum64())
+}
+
+func (a *Advisory) Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	// The transaction outlives ctx, which only bounds the acquisition
+	tx, err := a.db.BeginTx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return nil, err
+	}
+	lease := &advisoryLease{tx: tx}
+	if err := lease.setTimeout(ctx, ttl); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var ok bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", advisoryKey(name)).Scan(&ok); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !ok {
+		tx.Rollback()
+		return nil, ErrHeld
+	}
+	return lease, nil
+}
+
+func (a *Advisory) Ping(ctx context.Context) error { return a.db.PingContext(ctx) }
+
+func (a *Advisory) Name() string { return "postgres advisory locks" }
+
+type advisoryLease struct {
+	tx *sql.Tx
+}
+
+// Extend restarts the idle timeout of the lock's transaction. Any error
+// means the transaction, and the lock with it, is gone: the server ended
+// it, or the connection broke.
+func (l *advisoryLease) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := l.setTimeout(ctx, ttl); err != nil {
+		return fmt.Errorf("%w: %v", ErrLost, err)
+	}
+	return nil
+}
+
+// setTimeout sets the idle timeout of the lock's transaction to ttl.
+func (l *advisoryLease) setTimeout(ctx context.Context, ttl time.Duration) error {
+	_, err := l.tx.ExecContext(ctx, "SELECT set_config('idle_in_transaction_session_timeout', $1, true)",
+		strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (l *advisoryLease) Release(context.Context) error {
+	if err := l.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
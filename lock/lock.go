@@ -0,0 +1,146 @@
+// Package lock takes named locks shared by every instance and worker, such
+// as the lock a scheduled job holds while it runs so a slow run and the
+// next one never overlap.
+//
+// Every lock expires after its TTL unless its holder extends it, so a
+// worker that crashed or hangs cannot hold it forever. Do extends the lock
+// while its function runs and cancels the function's context when the lock
+// is lost. The locker is chosen by lock.driver: memory for a single
+// instance, redis for Redlock over one or more Redis servers, database for
+// PostgreSQL advisory locks.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+
+	"gorm.io/gorm"
+)
+
+// ErrHeld is returned when the lock is held by someone else.
+var ErrHeld = errors.New("lock is held elsewhere")
+
+// ErrLost is returned by Lease.Extend when the lock expired and may have
+// been taken by someone else.
+var ErrLost = errors.New("lock was lost")
+
+// Locker takes named locks.
+type Locker interface {
+	// Acquire takes the lock name for ttl, or fails with ErrHeld without
+	// waiting.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error)
+	// Ping reports whether the locks can be taken.
+	Ping(ctx context.Context) error
+	Name() string
+}
+
+// Lease is a lock taken by Acquire.
+type Lease interface {
+	// Extend keeps the lock for ttl from now, or fails with ErrLost.
+	Extend(ctx context.Context, ttl time.Duration) error
+	// Release gives the lock up; releasing a lost lock does nothing.
+	Release(ctx context.Context) error
+}
+
+// Default is the locker of the handlers unless they are given another.
+var Default Locker = NewMemory()
+
+// Init sets Default to the locker of cfg: Redlock over cfg.RedisURLs, or
+// redisURL when there are none, or advisory locks in db.
+func Init(cfg config.LockConfig, redisURL string, db *gorm.DB) error {
+	switch cfg.Driver {
+	case "redis":
+		urls := cfg.RedisURLs
+		if len(urls) == 0 {
+			urls = []string{redisURL}
+		}
+		l, err := NewRedlock(urls...)
+		if err != nil {
+			return err
+		}
+		Default = l
+		log.Printf("Taking locks in Redis on %d servers", len(urls))
+	case "database":
+		l, err := NewAdvisory(db)
+		if err != nil {
+			return err
+		}
+		Default = l
+		log.Printf("Taking locks as PostgreSQL advisory locks")
+	}
+	return nil
+}
+
+// Acquire takes the lock name from l for ttl and records it in the stats.
+func Acquire(ctx context.Context, l Locker, name string, ttl time.Duration) (Lease, error) {
+	lease, err := l.Acquire(ctx, name, ttl)
+	switch {
+	case err == nil:
+		acquired(name)
+		return &recordedLease{Lease: lease, name: name, since: time.Now()}, nil
+	case errors.Is(err, ErrHeld):
+		record(name, func(s *stat) { s.contended++ })
+	default:
+		record(name, func(s *stat) { s.errors++ })
+	}
+	return nil, err
+}
+
+// Do runs fn holding the lock name of l. The lock is taken for ttl and
+// extended every third of it until fn returns; when an extension fails,
+// fn's context is cancelled and Do returns ErrLost unless fn failed. A lock
+// held elsewhere fails with ErrHeld without running fn.
+func Do(ctx context.Context, l Locker, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lease, err := Acquire(ctx, l, name, ttl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The release must happen even when ctx is what ended fn
+		if err := lease.Release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("[lock] releasing %s failed: %v", name, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := lease.Extend(ctx, ttl); err != nil {
+					log.Printf("[lock] extending %s failed: %v", name, err)
+					cancel(fmt.Errorf("%w: %s", ErrLost, name))
+					return
+				}
+			}
+		}
+	}()
+
+	err = fn(ctx)
+	if cause := context.Cause(ctx); err == nil && errors.Is(cause, ErrLost) {
+		return cause
+	}
+	return err
+}
+
+// family is the part of a lock name before its first colon, e.g. job for
+// job:points.expire, under which it is counted.
+func family(name string) string {
+	f, _, _ := strings.Cut(name, ":")
+	return f
+}
@@ -0,0 +1,306 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+)
+
+func TestLockers(t *testing.T) {
+	lockers := []struct {
+		name string
+		new  func(t *testing.T) Locker
+		// down is the number of servers that cannot be reached
+		down    int
+		wantErr bool
+	}{
+		{name: "memory", new: func(*testing.T) Locker { return NewMemory() }},
+		{name: "redis", new: func(t *testing.T) Locker { return newRedlock(t, 1, 0) }},
+		{name: "redlock", new: func(t *testing.T) Locker { return newRedlock(t, 3, 0) }},
+		{name: "redlock, one server down", new: func(t *testing.T) Locker { return newRedlock(t, 3, 1) }},
+		{name: "redlock, two servers down", new: func(t *testing.T) Locker { return newRedlock(t, 3, 2) }, wantErr: true},
+	}
+	ctx := context.Background()
+	for _, tt := range lockers {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.new(t)
+			first, err := l.Acquire(ctx, "job:points.expire", time.Minute)
+			if tt.wantErr {
+				if err == nil || errors.Is(err, ErrHeld) {
+					t.Fatalf("acquire: %v, want an error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("acquire: %v", err)
+			}
+			if _, err := l.Acquire(ctx, "job:points.expire", time.Minute); !errors.Is(err, ErrHeld) {
+				t.Errorf("second acquire: %v, want ErrHeld", err)
+			}
+			if _, err := l.Acquire(ctx, "job:tiers.notices", time.Minute); err != nil {
+				t.Errorf("other lock: %v", err)
+			}
+			if err := first.Extend(ctx, time.Minute); err != nil {
+				t.Errorf("extend: %v", err)
+			}
+			if err := first.Release(ctx); err != nil {
+				t.Errorf("release: %v", err)
+			}
+			if _, err := l.Acquire(ctx, "job:points.expire", time.Minute); err != nil {
+				t.Errorf("acquire after release: %v", err)
+			}
+
+			// A holder that stops extending its lock loses it
+			expired, err := l.Acquire(ctx, "redeem:user:1", 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("acquire: %v", err)
+			}
+			time.Sleep(80 * time.Millisecond)
+			next, err := l.Acquire(ctx, "redeem:user:1", time.Minute)
+			if err != nil {
+				t.Fatalf("acquire after expiry: %v", err)
+			}
+			if err := expired.Extend(ctx, time.Minute); !errors.Is(err, ErrLost) {
+				t.Errorf("extend of an expired lock: %v, want ErrLost", err)
+			}
+			// and cannot release the lock of the next holder
+			expired.Release(ctx)
+			if _, err := l.Acquire(ctx, "redeem:user:1", time.Minute); !errors.Is(err, ErrHeld) {
+				t.Errorf("acquire: %v, want ErrHeld", err)
+			}
+			next.Release(ctx)
+		})
+	}
+}
+
+// losing is a locker whose leases cannot be extended.
+type losing struct{ *Memory }
+
+func (l losing) Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	lease, err := l.Memory.Acquire(ctx, name, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return losingLease{lease}, nil
+}
+
+type losingLease struct{ Lease }
+
+func (losingLease) Extend(context.Context, time.Duration) error { return ErrLost }
+
+func TestDo(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name   string
+		locker Locker
+		// held takes the lock before Do
+		held bool
+		fn   func(ctx context.Context) error
+		want error
+		ran  bool
+	}{
+		{name: "runs", locker: NewMemory(), fn: func(context.Context) error { return nil }, ran: true},
+		{name: "returns the error", locker: NewMemory(), fn: func(context.Context) error { return boom }, want: boom, ran: true},
+		{name: "held", locker: NewMemory(), held: true, fn: func(context.Context) error { return nil }, want: ErrHeld},
+		{name: "outlives the TTL", locker: NewMemory(), fn: func(ctx context.Context) error {
+			time.Sleep(60 * time.Millisecond)
+			return ctx.Err()
+		}, ran: true},
+		{name: "lost", locker: losing{NewMemory()}, fn: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, want: ErrLost, ran: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.held {
+				if _, err := tt.locker.Acquire(ctx, "job:test", time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ran := false
+			err := Do(ctx, tt.locker, "job:test", 30*time.Millisecond, func(ctx context.Context) error {
+				ran = true
+				return tt.fn(ctx)
+			})
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Do: %v, want %v", err, tt.want)
+			}
+			if ran != tt.ran {
+				t.Errorf("ran %v, want %v", ran, tt.ran)
+			}
+			// Do releases the lock it took
+			if !tt.held {
+				if _, err := tt.locker.Acquire(ctx, "job:test", time.Minute); err != nil {
+					t.Errorf("acquire after Do: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	family := func() models.LockStats {
+		for _, s := range Stats() {
+			if s.Name == "stats" {
+				return s
+			}
+		}
+		return models.LockStats{}
+	}
+	before := family()
+
+	l := NewMemory()
+	ctx := context.Background()
+	Do(ctx, l, "stats:a", time.Minute, func(context.Context) error { return nil })
+	lease, _ := Acquire(ctx, l, "stats:b", time.Minute)
+	defer lease.Release(ctx)
+	Acquire(ctx, l, "stats:b", time.Minute)
+	Do(ctx, losing{l}, "stats:c", 30*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	s := family()
+	held, acquired, contended, lost := s.Held-before.Held, s.Acquired-before.Acquired, s.Contended-before.Contended, s.Lost-before.Lost
+	if held != 1 || acquired != 3 || contended != 1 || lost != 1 {
+		t.Errorf("%d held, %d acquired, %d contended and %d lost, want 1, 3, 1 and 1", held, acquired, contended, lost)
+	}
+}
+
+// newRedlock returns a Redlock over servers fake Redis servers, of which
+// the last down cannot be reached.
+func newRedlock(t *testing.T, servers, down int) *Redlock {
+	t.Helper()
+	urls := make([]string, servers)
+	for i := range urls {
+		addr := startFakeRedis(t)
+		if i >= servers-down {
+			// Nothing listens on a port taken and freed again
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr = listener.Addr().String()
+			listener.Close()
+		}
+		urls[i] = "redis://" + addr
+	}
+	l, err := NewRedlock(urls...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// startFakeRedis serves SET NX PX and the scripts of the lease.
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	data := map[string]entry{}
+	get := func(key string) (string, bool) {
+		e, ok := data[key]
+		if !ok || time.Now().After(e.expires) {
+			return "", false
+		}
+		return e.value, true
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch {
+					case args[0] == "SET":
+						if _, ok := get(args[1]); ok {
+							io.WriteString(conn, "$-1\r\n")
+							break
+						}
+						ms, _ := strconv.Atoi(args[5])
+						data[args[1]] = entry{value: args[2], expires: time.Now().Add(time.Duration(ms) * time.Millisecond)}
+						io.WriteString(conn, "+OK\r\n")
+					case args[0] == "EVAL":
+						if value, ok := get(args[3]); !ok || value != args[4] {
+							io.WriteString(conn, ":0\r\n")
+							break
+						}
+						if args[1] == extendScript {
+							ms, _ := strconv.Atoi(args[5])
+							data[args[3]] = entry{value: args[4], expires: time.Now().Add(time.Duration(ms) * time.Millisecond)}
+						} else {
+							delete(data, args[3])
+						}
+						io.WriteString(conn, ":1\r\n")
+					case args[0] == "PING":
+						io.WriteString(conn, "+PONG\r\n")
+					default:
+						fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad argument %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
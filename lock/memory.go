@@ -0,0 +1,65 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// Memory keeps locks in the process, so it only excludes the goroutines of
+// one instance.
+type Memory struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	token   string
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{locks: map[string]memoryLock{}}
+}
+
+func (m *Memory) Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.locks[name]; ok && time.Now().Before(held.expires) {
+		return nil, ErrHeld
+	}
+	token := rand.Text()
+	m.locks[name] = memoryLock{token: token, expires: time.Now().Add(ttl)}
+	return &memoryLease{m: m, name: name, token: token}, nil
+}
+
+func (m *Memory) Ping(context.Context) error { return nil }
+
+func (m *Memory) Name() string { return "memory" }
+
+type memoryLease struct {
+	m     *Memory
+	name  string
+	token string
+}
+
+// Extend also keeps a lock that expired as long as no one else took it.
+func (l *memoryLease) Extend(ctx context.Context, ttl time.Duration) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if held, ok := l.m.locks[l.name]; !ok || held.token != l.token {
+		return ErrLost
+	}
+	l.m.locks[l.name] = memoryLock{token: l.token, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (l *memoryLease) Release(context.Context) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if held, ok := l.m.locks[l.name]; ok && held.token == l.token {
+		delete(l.m.locks, l.name)
+	}
+	return nil
+}
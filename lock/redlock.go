@@ -0,0 +1,150 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/redis"
+)
+
+// keyPrefix keeps the locks apart from the other data in Redis.
+const keyPrefix = "lock:"
+
+// extendScript and releaseScript change a lock only while it holds the
+// token of the lease, so a lease whose lock expired and was taken by
+// another cannot touch the new holder's lock.
+const (
+	extendScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+	releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// Redlock takes locks with the Redlock algorithm: a lock is held once a
+// majority of independent Redis servers have set its key, within the TTL
+// less the time that took and an allowance for clock drift. With a single
+// server it is a plain SET NX PX lock.
+type Redlock struct {
+	clients []*redis.Client
+}
+
+// NewRedlock returns a locker over the Redis servers at urls, e.g.
+// redis://:password@redis-1:6379/0. The servers should fail independently;
+// replicas of one another do not make locks safer.
+func NewRedlock(urls ...string) (*Redlock, error) {
+	l := &Redlock{}
+	for _, u := range urls {
+		client, err := redis.New(u)
+		if err != nil {
+			return nil, err
+		}
+		l.clients = append(l.clients, client)
+	}
+	return l, nil
+}
+
+func (l *Redlock) quorum() int { return len(l.clients)/2 + 1 }
+
+func (l *Redlock) Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	lease := &redlockLease{l: l, key: keyPrefix + name, token: rand.Text()}
+	started := time.Now()
+	ok, failed := l.each(func(c *redis.Client) (bool, error) {
+		reply, err := c.Do("SET", lease.key, lease.token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+		return reply == "OK", err
+	})
+
+	// The servers' clocks may run a little faster than ours
+	drift := ttl/100 + 2*time.Millisecond
+	if ok >= l.quorum() && ttl-time.Since(started)-drift > 0 {
+		return lease, nil
+	}
+	// Servers that did set the key would otherwise keep it for ttl
+	lease.Release(ctx)
+	if failed > len(l.clients)-l.quorum() {
+		return nil, fmt.Errorf("lock: %d of %d Redis servers failed", failed, len(l.clients))
+	}
+	return nil, ErrHeld
+}
+
+func (l *Redlock) Ping(context.Context) error {
+	_, failed := l.each(func(c *redis.Client) (bool, error) {
+		return true, c.Ping()
+	})
+	if failed > len(l.clients)-l.quorum() {
+		return fmt.Errorf("%d of %d Redis servers unreachable", failed, len(l.clients))
+	}
+	return nil
+}
+
+func (l *Redlock) Name() string {
+	if len(l.clients) == 1 {
+		return "redis"
+	}
+	return fmt.Sprintf("redlock over %d servers", len(l.clients))
+}
+
+// each runs fn on every server at once and counts the servers where it
+// succeeded and those that failed.
+func (l *Redlock) each(fn func(c *redis.Client) (bool, error)) (ok, failed int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range l.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := fn(c)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failed++
+			case done:
+				ok++
+			}
+		}()
+	}
+	wg.Wait()
+	return ok, failed
+}
+
+type redlockLease struct {
+	l     *Redlock
+	key   string
+	token string
+}
+
+func (r *redlockLease) Extend(ctx context.Context, ttl time.Duration) error {
+	started := time.Now()
+	ok, failed := r.l.each(func(c *redis.Client) (bool, error) {
+		reply, err := c.Do("EVAL", extendScript, "1", r.key, r.token, strconv.FormatInt(ttl.Milliseconds(), 10))
+		return reply == int64(1), err
+	})
+	if ok >= r.l.quorum() && ttl-time.Since(started) > 0 {
+		return nil
+	}
+	if failed > len(r.l.clients)-r.l.quorum() {
+		return fmt.Errorf("lock: %d of %d Redis servers failed", failed, len(r.l.clients))
+	}
+	return ErrLost
+}
+
+func (r *redlockLease) Release(context.Context) error {
+	_, failed := r.l.each(func(c *redis.Client) (bool, error) {
+		_, err := c.Do("EVAL", releaseScript, "1", r.key, r.token)
+		return true, err
+	})
+	// The servers that failed alone cannot make up a majority to hold the
+	// lock, so it is free unless they are too many
+	if failed > len(r.l.clients)-r.l.quorum() {
+		return fmt.Errorf("lock: releasing %s failed on %d Redis servers; it expires on its own", r.key, failed)
+	}
+	return nil
+}
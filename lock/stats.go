@@ -0,0 +1,104 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+)
+
+// stat counts the locks of a family since the process started.
+type stat struct {
+	held      int
+	acquired  int64
+	contended int64
+	lost      int64
+	errors    int64
+	holdTotal time.Duration
+	holdMax   time.Duration
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = map[string]*stat{}
+)
+
+func record(name string, update func(s *stat)) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s, ok := stats[family(name)]
+	if !ok {
+		s = &stat{}
+		stats[family(name)] = s
+	}
+	update(s)
+}
+
+func acquired(name string) {
+	record(name, func(s *stat) {
+		s.acquired++
+		s.held++
+	})
+}
+
+// Stats returns the counts of each family of locks taken by this process,
+// by name.
+func Stats() []models.LockStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	result := make([]models.LockStats, 0, len(stats))
+	for name, s := range stats {
+		entry := models.LockStats{
+			Name:      name,
+			Held:      s.held,
+			Acquired:  s.acquired,
+			Contended: s.contended,
+			Lost:      s.lost,
+			Errors:    s.errors,
+			MaxHoldMs: s.holdMax.Milliseconds(),
+		}
+		if released := s.acquired - int64(s.held); released > 0 {
+			entry.AvgHoldMs = s.holdTotal.Milliseconds() / released
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// recordedLease counts the extensions that failed and how long the lock
+// was held.
+type recordedLease struct {
+	Lease
+	name  string
+	since time.Time
+	once  sync.Once
+}
+
+func (l *recordedLease) Extend(ctx context.Context, ttl time.Duration) error {
+	err := l.Lease.Extend(ctx, ttl)
+	switch {
+	case errors.Is(err, ErrLost):
+		record(l.name, func(s *stat) { s.lost++ })
+	case err != nil:
+		record(l.name, func(s *stat) { s.errors++ })
+	}
+	return err
+}
+
+func (l *recordedLease) Release(ctx context.Context) error {
+	l.once.Do(func() {
+		held := time.Since(l.since)
+		record(l.name, func(s *stat) {
+			s.held--
+			s.holdTotal += held
+			if held > s.holdMax {
+				s.holdMax = held
+			}
+		})
+	})
+	return l.Lease.Release(ctx)
+}
@@ -0,0 +1,91 @@
+// Package mailer sends email to users through SMTP or SendGrid, as selected
+// by mail.driver. Messages are usually built from the templates in
+// templates/ with Render and queued with Send, which delivers them in the
+// background and retries temporary failures.
+package mailer
+
+import (
+	"errors"
+	"log"
+	"net/mail"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/outbox"
+)
+
+// Message is one email. Body is the plain text part; HTML, when set, is
+// sent as the alternative most clients show. Headers carry extras such as
+// List-Unsubscribe.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Sender delivers an email.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Default is the sender used by Send. Email is only logged until Init
+// configures a driver, or the outbox in PROVIDERS_MODE=mock.
+var Default Sender = LogSender{}
+
+// Init sets Default to the driver in cfg. PROVIDERS_MODE=mock selects the
+// outbox whatever the driver.
+func Init(cfg config.MailConfig, smtp config.SMTPConfig) {
+	if outbox.MockMode() {
+		Default = OutboxSender{}
+		return
+	}
+	from, _ := mail.ParseAddress(cfg.From)
+	switch cfg.Driver {
+	case "smtp":
+		Default = &SMTP{Config: smtp, From: from}
+		log.Printf("Sending email through %s:%d", smtp.Host, smtp.Port)
+	case "sendgrid":
+		Default = NewSendGrid(cfg.SendGrid.APIKey, from)
+		log.Printf("Sending email through SendGrid")
+	}
+}
+
+// TemporaryError is a failure worth retrying, such as a timeout or a
+// provider asking to try again later.
+type TemporaryError struct {
+	Err error
+}
+
+func (e *TemporaryError) Error() string { return e.Err.Error() }
+func (e *TemporaryError) Unwrap() error { return e.Err }
+
+// Temporary reports whether err is worth retrying.
+func Temporary(err error) bool {
+	var temporary *TemporaryError
+	return errors.As(err, &temporary)
+}
+
+// OutboxSender records email in the mock provider outbox.
+type OutboxSender struct{}
+
+func (OutboxSender) Send(msg Message) error {
+	outbox.Record(outbox.Message{
+		Channel:  outbox.ChannelEmail,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Body:     msg.Body,
+		HTML:     msg.HTML,
+		Metadata: msg.Headers,
+	})
+	return nil
+}
+
+// LogSender writes a line to the log without the body, which may contain
+// links that sign the user in or change settings.
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("[mailer] %q to %s not delivered: no email provider configured", msg.Subject, msg.To)
+	return nil
+}
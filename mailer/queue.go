@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"temp-backend-at-kbtg/jobs"
+)
+
+const (
+	// jobType is the background job that delivers a queued email.
+	jobType = "email.send"
+	// maxRetryDelay caps the delay between attempts, which doubles from a
+	// second.
+	maxRetryDelay = time.Minute
+)
+
+// queueing is set by Start; until then Send delivers at once.
+var queueing atomic.Bool
+
+// Start registers the email.send job, which tries each message up to
+// attempts times, and makes Send queue email from then on. Without it, Send
+// delivers at once, as the CLI does.
+func Start(attempts int) {
+	jobs.Register(jobType, jobs.Policy{
+		MaxAttempts:   attempts,
+		RetryDelay:    time.Second,
+		MaxRetryDelay: maxRetryDelay,
+		Timeout:       time.Minute,
+	}, deliver)
+	queueing.Store(true)
+}
+
+// Send queues msg for delivery by Default. Failures are logged by the job;
+// the error is only the one of an immediate delivery, made when the queue
+// cannot be reached.
+func Send(msg Message) error {
+	if queueing.Load() {
+		_, err := jobs.Enqueue(context.Background(), jobType, msg)
+		if err == nil {
+			return nil
+		}
+		log.Printf("[mailer] queueing failed, sending %q to %s at once: %v", msg.Subject, msg.To, err)
+	}
+	return Default.Send(msg)
+}
+
+// Queue is the Sender that queues email with Send, so the handlers' email
+// is retried by the job and delivered by Default.
+type Queue struct{}
+
+func (Queue) Send(msg Message) error { return Send(msg) }
+
+// deliver is the email.send job. Only temporary failures are retried.
+func deliver(_ context.Context, payload json.RawMessage) (interface{}, error) {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	err := Default.Send(msg)
+	if err == nil {
+		return nil, nil
+	}
+	err = fmt.Errorf("%q to %s: %w", msg.Subject, msg.To, err)
+	if !Temporary(err) {
+		return nil, jobs.Permanent(err)
+	}
+	return nil, err
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+)
+
+// SendGridEndpoint is the v3 Mail Send API.
+const SendGridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGrid delivers email through the SendGrid Mail Send API.
+type SendGrid struct {
+	APIKey   string
+	From     *mail.Address
+	Endpoint string
+	client   *http.Client
+}
+
+// NewSendGrid returns a SendGrid sender using apiKey.
+func NewSendGrid(apiKey string, from *mail.Address) *SendGrid {
+	return &SendGrid{
+		APIKey:   apiKey,
+		From:     from,
+		Endpoint: SendGridEndpoint,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: requestid.Transport(tracing.Transport(nil))},
+	}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridMessage struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+func (s *SendGrid) Send(msg Message) error {
+	body := sendGridMessage{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: msg.To}}}},
+		From:             sendGridAddress{Email: s.From.Address, Name: s.From.Name},
+		Subject:          msg.Subject,
+		Content:          []sendGridContent{{Type: "text/plain", Value: msg.Body}},
+		Headers:          msg.Headers,
+	}
+	if msg.HTML != "" {
+		body.Content = append(body.Content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &TemporaryError{Err: fmt.Errorf("mailer: sendgrid: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("mailer: sendgrid: %s %s", resp.Status, strings.TrimSpace(string(detail)))
+	// SendGrid asks to slow down with 429 and is at fault with 5xx; other
+	// statuses mean the message itself was refused
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &TemporaryError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,372 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+)
+
+func TestBuildMIME(t *testing.T) {
+	from := &mail.Address{Name: "LBK Rewards", Address: "no-reply@rewards.example.com"}
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.FixedZone("ICT", 7*60*60))
+	long := strings.Repeat("points ", 20) + "= 100%"
+
+	tests := []struct {
+		name    string
+		msg     Message
+		headers map[string]string
+		parts   map[string]string
+	}{
+		{
+			name:  "plain text",
+			msg:   Message{To: "somchai@example.com", Subject: "Welcome", Body: "Hello\r\n"},
+			parts: map[string]string{"text/plain": "Hello\r\n"},
+		},
+		{
+			name:  "UTF-8 subject and body",
+			msg:   Message{To: "somchai@example.com", Subject: "ยินดีต้อนรับ", Body: "สวัสดีครับ"},
+			parts: map[string]string{"text/plain": "สวัสดีครับ"},
+		},
+		{
+			name:  "long lines are wrapped",
+			msg:   Message{To: "somchai@example.com", Subject: "Statement", Body: long},
+			parts: map[string]string{"text/plain": long},
+		},
+		{
+			name: "HTML alternative",
+			msg:  Message{To: "somchai@example.com", Subject: "Receipt", Body: "Paid 100 THB", HTML: `<p class="total">Paid 100 THB</p>`},
+			parts: map[string]string{
+				"text/plain": "Paid 100 THB",
+				"text/html":  `<p class="total">Paid 100 THB</p>`,
+			},
+		},
+		{
+			name: "custom headers",
+			msg: Message{To: "somchai@example.com", Subject: "News", Body: "Hi", Headers: map[string]string{
+				"List-Unsubscribe":      "<https://rewards.example.com/unsubscribe?t=abc>",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			}},
+			headers: map[string]string{
+				"List-Unsubscribe":      "<https://rewards.example.com/unsubscribe?t=abc>",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+			parts: map[string]string{"text/plain": "Hi"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildMIME(from, tt.msg, now)
+			if err != nil {
+				t.Fatalf("buildMIME: %v", err)
+			}
+			_, body, _ := strings.Cut(string(data), "\r\n\r\n")
+			for _, line := range strings.Split(body, "\r\n") {
+				if len(line) > 76 {
+					t.Errorf("body line is %d characters: %q", len(line), line)
+				}
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("parse: %v\n%s", err, data)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil {
+				t.Fatalf("decode subject: %v", err)
+			}
+			want := map[string]string{
+				"From":         `"LBK Rewards" <no-reply@rewards.example.com>`,
+				"To":           tt.msg.To,
+				"Subject":      tt.msg.Subject,
+				"Date":         "Sun, 01 Mar 2026 09:30:00 +0700",
+				"MIME-Version": "1.0",
+			}
+			for name, value := range tt.headers {
+				want[name] = value
+			}
+			for name, value := range want {
+				got := parsed.Header.Get(name)
+				if name == "Subject" {
+					got = subject
+				}
+				if got != value {
+					t.Errorf("%s %q, want %q", name, got, value)
+				}
+			}
+			if id := parsed.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@rewards.example.com>") {
+				t.Errorf("Message-ID %q", id)
+			}
+
+			got := readParts(t, textproto.MIMEHeader(parsed.Header), parsed.Body)
+			if len(got) != len(tt.parts) {
+				t.Errorf("parts %v, want %v", got, tt.parts)
+			}
+			for contentType, content := range tt.parts {
+				if got[contentType] != content {
+					t.Errorf("%s part %q, want %q", contentType, got[contentType], content)
+				}
+			}
+		})
+	}
+}
+
+// readParts decodes the body of a message or part by media type.
+func readParts(t *testing.T, header textproto.MIMEHeader, body io.Reader) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type %q: %v", header.Get("Content-Type"), err)
+	}
+	if mediaType == "multipart/alternative" {
+		parts := map[string]string{}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return parts
+			}
+			if err != nil {
+				t.Fatalf("next part: %v", err)
+			}
+			for contentType, content := range readParts(t, part.Header, part) {
+				parts[contentType] = content
+			}
+		}
+	}
+	if params["charset"] != "utf-8" || header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+		t.Errorf("%s part: charset %q, encoding %q", mediaType, params["charset"], header.Get("Content-Transfer-Encoding"))
+	}
+	content, err := io.ReadAll(quotedprintable.NewReader(body))
+	if err != nil {
+		t.Fatalf("decode %s part: %v", mediaType, err)
+	}
+	return map[string]string{mediaType: string(content)}
+}
+
+func TestSMTPError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		temporary bool
+	}{
+		{name: "mailbox busy", err: &textproto.Error{Code: 451, Msg: "try again later"}, temporary: true},
+		{name: "mailbox unknown", err: &textproto.Error{Code: 550, Msg: "no such user"}},
+		{name: "authentication failed", err: &textproto.Error{Code: 535, Msg: "bad credentials"}},
+		{name: "connection closed", err: io.EOF, temporary: true},
+		{name: "timeout", err: &net.OpError{Op: "read", Err: errors.New("i/o timeout")}, temporary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := smtpError(tt.err)
+			if Temporary(err) != tt.temporary {
+				t.Errorf("Temporary(%v) = %v, want %v", err, !tt.temporary, tt.temporary)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v does not wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	msg := Message{To: "somchai@example.com", Subject: "Your code", Body: "123456"}
+	tests := []struct {
+		name      string
+		username  string
+		replies   map[string]string
+		wantErr   bool
+		temporary bool
+		commands  []string
+	}{
+		{
+			name:     "delivered",
+			commands: []string{"EHLO", "MAIL FROM:<no-reply@rewards.example.com>", "RCPT TO:<somchai@example.com>", "DATA", "QUIT"},
+		},
+		{
+			name:     "authenticated",
+			username: "mailer",
+			commands: []string{"EHLO", "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret")), "MAIL FROM:<no-reply@rewards.example.com>", "RCPT TO:<somchai@example.com>", "DATA", "QUIT"},
+		},
+		{
+			name:     "bad credentials",
+			username: "mailer",
+			replies:  map[string]string{"AUTH": "535 5.7.8 authentication failed"},
+			wantErr:  true,
+		},
+		{
+			name:      "greylisted",
+			replies:   map[string]string{"RCPT": "451 4.7.1 greylisted, try again later"},
+			wantErr:   true,
+			temporary: true,
+		},
+		{
+			name:    "unknown mailbox",
+			replies: map[string]string{"RCPT": "550 5.1.1 no such user"},
+			wantErr: true,
+		},
+		{
+			name:      "message deferred",
+			replies:   map[string]string{"DATA.": "452 4.3.1 insufficient storage"},
+			wantErr:   true,
+			temporary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSMTP(t, tt.replies)
+			sender := &SMTP{
+				Config: config.SMTPConfig{Host: "127.0.0.1", Port: server.port, Username: tt.username, Password: "secret"},
+				From:   &mail.Address{Name: "LBK Rewards", Address: "no-reply@rewards.example.com"},
+			}
+
+			err := sender.Send(msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				if Temporary(err) != tt.temporary {
+					t.Errorf("Temporary(%v) = %v, want %v", err, !tt.temporary, tt.temporary)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			commands, data := server.session()
+			if !slices.Equal(commands, tt.commands) {
+				t.Errorf("commands %q, want %q", commands, tt.commands)
+			}
+			parsed, err := mail.ReadMessage(strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("parse message: %v", err)
+			}
+			if to := parsed.Header.Get("To"); to != msg.To {
+				t.Errorf("To %q, want %q", to, msg.To)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		sender := &SMTP{Config: config.SMTPConfig{Host: "127.0.0.1", Port: port}, From: &mail.Address{Address: "no-reply@rewards.example.com"}}
+		if err := sender.Send(msg); !Temporary(err) {
+			t.Errorf("send: %v, want a temporary error", err)
+		}
+	})
+}
+
+// fakeSMTP is a mail server for one session. It accepts everything unless
+// replies overrides the reply to a command, keyed by its verb; "DATA." is
+// the reply after the message.
+type fakeSMTP struct {
+	port    int
+	replies map[string]string
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTP(t *testing.T, replies map[string]string) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &fakeSMTP{port: listener.Addr().(*net.TCPAddr).Port, replies: replies, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *fakeSMTP) reply(verb, fallback string) string {
+	if reply, ok := s.replies[verb]; ok {
+		return reply
+	}
+	return fallback
+}
+
+func (s *fakeSMTP) serve(conn *textproto.Conn) {
+	conn.PrintfLine("220 mx.example.com ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		record := line
+		if verb == "EHLO" {
+			record = verb
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, record)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			conn.PrintfLine("250-mx.example.com")
+			conn.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			conn.PrintfLine("%s", s.reply(verb, "235 2.7.0 authenticated"))
+		case "DATA":
+			reply := s.reply(verb, "354 go ahead")
+			conn.PrintfLine("%s", reply)
+			if !strings.HasPrefix(reply, "354") {
+				continue
+			}
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			conn.PrintfLine("%s", s.reply("DATA.", "250 2.0.0 queued"))
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			conn.PrintfLine("%s", s.reply(verb, "250 ok"))
+		}
+	}
+}
+
+// session waits for the client to hang up and returns the commands it
+// sent and the message.
+func (s *fakeSMTP) session() ([]string, string) {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands, s.data
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates by name. Each has a subject and plain text body in
+// templates/<name>.txt and an HTML body in templates/<name>.html, filled
+// with the data type named after it.
+const (
+	TemplateWelcome         = "welcome"
+	TemplatePasswordReset   = "password_reset"
+	TemplatePointsStatement = "points_statement"
+)
+
+// WelcomeData fills the welcome template, sent once a member has verified
+// their email address.
+type WelcomeData struct {
+	Name         string
+	MembershipID string
+	Tier         string
+	Points       int
+	ReferralCode string
+}
+
+// PasswordResetData fills the password_reset template.
+type PasswordResetData struct {
+	Name string
+	Link string
+}
+
+// PointsStatementData fills the points_statement template with a member's
+// points movements in a month.
+type PointsStatementData struct {
+	Name string
+	// Period is the month covered, e.g. "September 2026"
+	Period   string
+	Opening  int
+	Earned   int
+	Redeemed int
+	Expired  int
+	// Adjusted is the net of corrections by the support team
+	Adjusted int
+	Closing  int
+	// ExpiringSoon points expire by ExpiringBy
+	ExpiringSoon int
+	ExpiringBy   string
+}
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = map[string]any{
+	"number": formatNumber,
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates are parsed at startup, so a broken template stops the server
+// rather than an email.
+var templates = parseTemplates(TemplateWelcome, TemplatePasswordReset, TemplatePointsStatement)
+
+func parseTemplates(names ...string) map[string]emailTemplate {
+	parsed := map[string]emailTemplate{}
+	for _, name := range names {
+		parsed[name] = emailTemplate{
+			text: texttemplate.Must(texttemplate.New("layout.txt").Funcs(templateFuncs).
+				ParseFS(templateFiles, "templates/layout.txt", "templates/"+name+".txt")),
+			html: htmltemplate.Must(htmltemplate.New("layout.html").Funcs(templateFuncs).
+				ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html")),
+		}
+	}
+	return parsed
+}
+
+// templateContent is what the layouts are executed with: the template's
+// data and the unsubscribe link of the footer, if any.
+type templateContent struct {
+	Data           any
+	UnsubscribeURL string
+}
+
+// Render fills the template called name with data and returns the email
+// without a recipient. unsubscribeURL, when set, is linked in the footer.
+func Render(name string, data any, unsubscribeURL string) (Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("mailer: no template %q", name)
+	}
+	content := templateContent{Data: data, UnsubscribeURL: unsubscribeURL}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.text.Execute(&text, content); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.html.Execute(&html, content); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimSpace(text.String()),
+		HTML:    html.String(),
+	}, nil
+}
+
+// formatNumber writes n with thousands separators, e.g. 12,500.
+func formatNumber(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return sign + digits
+}
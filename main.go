@@ -1,98 +1,442 @@
 // @title Training KBTG Backend API
 // @version 1.0
 // @description This is a training backend API with authentication
-// @host localhost:3000
 // @BasePath /
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey PartnerKey
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey APIKey
+// @in header
+// @name X-API-Key
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"temp-backend-at-kbtg/analytics"
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/cli"
+	"temp-backend-at-kbtg/config"
 	"temp-backend-at-kbtg/database"
-	_ "temp-backend-at-kbtg/docs"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/grpcapi"
 	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/jobs"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/mailer"
 	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/moderation"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/oauth"
+	"temp-backend-at-kbtg/outbox"
+	"temp-backend-at-kbtg/payment"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/push"
+	"temp-backend-at-kbtg/realtime"
+	"temp-backend-at-kbtg/referral"
+	"temp-backend-at-kbtg/routes"
+	"temp-backend-at-kbtg/scheduler"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/sms"
+	"temp-backend-at-kbtg/storage"
+	"temp-backend-at-kbtg/tiers"
+	"temp-backend-at-kbtg/totp"
+	"temp-backend-at-kbtg/tracing"
+	"temp-backend-at-kbtg/voucher"
+	"temp-backend-at-kbtg/wallet"
+	"temp-backend-at-kbtg/webhook"
+	"temp-backend-at-kbtg/worker"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	fiberSwagger "github.com/swaggo/fiber-swagger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
-// HelloWorld godoc
-// @Summary Get hello world message
-// @Description Get a simple hello world message
-// @Tags General
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Router / [get]
-func helloWorld(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"message": "hello world",
-	})
+func main() {
+	// Load and validate the settings before anything else uses them
+	cfg := config.Get()
+	// The maintenance commands need these as well as the server
+	normalize.Init(cfg.FoldEmailAliases)
+	outbox.Init(cfg.ProvidersMode)
+	middleware.Init(cfg)
+	points.Init(cfg.Points)
+	tiers.Init(cfg.Tiers)
+	wallet.Init(cfg.Wallet)
+	referral.Init(cfg.Referrals)
+
+	// `go run . worker` runs the background jobs without the HTTP server;
+	// other arguments run a maintenance subcommand instead, e.g. "dump"
+	workerMode := len(os.Args) == 2 && os.Args[1] == "worker"
+	if len(os.Args) > 1 && !workerMode {
+		if err := cli.Run(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if workerMode && cfg.Jobs.Backend != "redis" {
+		log.Fatal("Worker mode needs JOBS_BACKEND=redis; with the memory backend the server runs the jobs itself")
+	}
+
+	srv := newServer(cfg)
+
+	// Serve, or work, until SIGINT or SIGTERM, e.g. from the container
+	// runtime on redeploy, then shut down gracefully
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// With the memory backend the server runs the background jobs itself;
+	// with redis only the workers do
+	if workerMode || cfg.Jobs.Backend == "memory" {
+		srv.startBackgroundJobs()
+	}
+	if workerMode {
+		log.Printf("Worker running up to %d jobs at a time...", cfg.Jobs.Concurrency)
+		<-stop.Done()
+		cancel()
+		log.Printf("Shutting down, waiting up to %s for background jobs...", cfg.ShutdownTimeout)
+		srv.shutdown(cfg.ShutdownTimeout)
+		log.Println("Worker stopped")
+		return
+	}
+
+	srv.app = srv.newApp()
+
+	// Members' open balance streams get the new entries of the ledger,
+	// whichever instance or worker posted them
+	realtime.Default.Start(srv.db)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- srv.app.Listen(fmt.Sprintf(":%d", cfg.Port))
+	}()
+	log.Printf("Server starting on port %d...", cfg.Port)
+	if srv.swagger {
+		log.Printf("Swagger documentation available at http://localhost:%d%s/swagger/", cfg.Port, middleware.BasePath())
+	}
+
+	// Internal services call the same services over gRPC on a second port
+	if cfg.GRPCPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.grpc = srv.newGRPC()
+		go func() {
+			listenErr <- srv.grpc.Serve(lis)
+		}()
+		log.Printf("gRPC server starting on port %d...", cfg.GRPCPort)
+	}
+
+	select {
+	case err := <-listenErr:
+		log.Fatal(err)
+	case <-stop.Done():
+	}
+	cancel()
+	log.Printf("Shutting down, waiting up to %s for requests and background jobs...", cfg.ShutdownTimeout)
+	srv.shutdown(cfg.ShutdownTimeout)
+	log.Println("Server stopped")
 }
 
-// ProtectedRoute godoc
-// @Summary Protected route example
-// @Description Example of a protected route that requires authentication
-// @Tags General
-// @Security BearerAuth
-// @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]string
-// @Router /protected [get]
-func protectedRoute(c *fiber.Ctx) error {
-	userID := c.Locals("user_id")
-	email := c.Locals("email")
-
-	return c.JSON(fiber.Map{
-		"message": "This is a protected route",
-		"user_id": userID,
-		"email":   email,
-	})
+// Server owns the dependencies of one instance: the settings, the database
+// connection and the handlers built on them. The providers it initializes
+// (cache, mailer, job queue and so on) are closed again by shutdown.
+type Server struct {
+	cfg *config.Config
+	db  *gorm.DB
+	// shards are the databases of every tenant, db first
+	shards   *shard.Registry
+	handlers *handlers.Handler
+	// app is nil in worker mode
+	app *fiber.App
+	// grpc is nil without grpc_port
+	grpc    *grpc.Server
+	swagger bool
 }
 
-func main() {
+// newServer initializes the providers configured in cfg, connects to the
+// database and builds the handlers.
+func newServer(cfg *config.Config) *Server {
+	// Export spans when an OTLP collector is configured
+	tracing.Init(cfg.Tracing)
+
+	// Uploads go to the local directory or S3 bucket of storage.driver
+	storage.Init(cfg)
+
+	// The analytics export writes to the directory or bucket of
+	// analytics.driver
+	analytics.Init(cfg.Analytics)
+
+	// Background jobs are queued in memory or, with jobs.backend redis, in
+	// Redis for the worker processes
+	if err := jobs.Init(cfg.Jobs, cfg.Redis.URL); err != nil {
+		log.Fatalf("Invalid REDIS_URL: %v", err)
+	}
+
+	// Profile reads are cached in memory or, with cache.backend redis, in
+	// Redis, where the workers' points changes invalidate them too
+	if err := cache.Init(cfg.Cache, cfg.Redis.URL); err != nil {
+		log.Fatalf("Invalid REDIS_URL: %v", err)
+	}
+
+	// Email goes out through mail.driver from the job queue, which retries
+	// temporary failures
+	mailer.Init(cfg.Mail, cfg.SMTP)
+	mailer.Start(cfg.Mail.MaxAttempts)
+
+	// Text messages go out through sms.driver, within each member's hourly
+	// limit
+	sms.Init(cfg.SMS, cfg.PublicURL)
+	if err := push.Init(cfg.Push); err != nil {
+		log.Fatalf("Invalid FCM credentials: %v", err)
+	}
+
+	// Uploaded avatars are checked through moderation.driver
+	moderation.Init(cfg.Moderation)
+
+	// Wallet top-ups are charged through the outbox in mock mode and
+	// refused otherwise
+	payment.Init()
+
+	// Redemption vouchers come from the outbox in mock mode; otherwise the
+	// redemption code is the voucher
+	voucher.Init()
+
+	// Authenticator secrets are encrypted with totp.encryption_key
+	totp.Init(cfg.TOTP)
+
+	// Social sign-in is offered for the providers with client credentials
+	oauth.Init(cfg.OAuth)
+
+	// Domain events go to webhooks and, with events.broker set, to NATS or
+	// Kafka
+	if err := events.Init(cfg.Events); err != nil {
+		log.Fatalf("Invalid event broker: %v", err)
+	}
+
 	// Connect to database
-	database.Connect()
+	db := database.Connect(cfg.Database)
+
+	// The other tenants' databases; db routes the queries of requests for
+	// them to their shard
+	shards := shard.Connect(cfg, db)
+
+	// Scheduled jobs, redemptions and social sign-in take their locks
+	// through lock.driver
+	if err := lock.Init(cfg.Lock, cfg.Redis.URL, db); err != nil {
+		log.Fatalf("Invalid lock driver: %v", err)
+	}
+	h := handlers.New(handlers.Deps{DB: db, Config: cfg, Shards: shards})
+
+	// Report exports and the scheduled jobs of the handlers go through the
+	// job queue too
+	h.RegisterJobs()
+
+	return &Server{cfg: cfg, db: db, shards: shards, handlers: h}
+}
+
+// newApp returns the Fiber app serving every route under BASE_PATH.
+func (s *Server) newApp() *fiber.App {
+	cfg := s.cfg
 
 	// Create fiber app
 	app := fiber.New(fiber.Config{
-		AppName: "Training KBTG Backend API v1.0.0",
+		AppName:      "Training KBTG Backend API v1.0.0",
+		ErrorHandler: handlers.ErrorHandler,
+		// Only trust X-Forwarded-* headers set by our own reverse proxies
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableIPValidation:      true,
 	})
 
 	// Middleware
-	app.Use(logger.New())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestCounter())
+	app.Use(middleware.BodyLogger())
+	if cfg.CaptureFailedRequests {
+		app.Use(middleware.RequestRecorder(s.db))
+	}
+	// The logger renders errors returned by handlers through ErrorHandler,
+	// so the middleware above sees the final status and body
+	app.Use(logger.New(logger.Config{
+		Format: "[${time}] ${locals:request_id} ${ip} ${status} - ${latency} ${method} ${path} ${error}\n",
+		// Probes arrive every few seconds; keep them out of the access log
+		Next: func(c *fiber.Ctx) bool {
+			path := middleware.RoutePath(c)
+			return path == "/healthz" || path == "/readyz"
+		},
+	}))
+	// Panics become 500 INTERNAL_ERROR responses instead of crashing the
+	// server; the stack trace is logged
+	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, HEAD, PUT, DELETE, PATCH, OPTIONS",
+		AllowOrigins:  strings.Join(cfg.CORS.AllowOrigins, ","),
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Device-ID, X-Device-Platform, X-Device-Model, X-App-Version, X-API-Key, X-Request-ID, API-Version, traceparent, tracestate",
+		AllowMethods:  "GET, POST, HEAD, PUT, DELETE, PATCH, OPTIONS",
+		ExposeHeaders: "X-Request-ID, API-Version, Deprecation, Link",
 	}))
 
+	// Everything is served under BASE_PATH, if set
+	api := app.Group(middleware.BasePath())
+
 	// Swagger
-	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	s.swagger = routes.Swagger(api, cfg)
 
 	// Routes
-	app.Get("/", helloWorld)
-
-	// Auth routes
-	auth := app.Group("/auth")
-	auth.Post("/register", handlers.Register)
-	auth.Post("/login", handlers.Login)
-
-	// Protected routes
-	app.Get("/protected", middleware.JWTMiddleware(), protectedRoute)
-
-	// Profile routes
-	profile := app.Group("/profile", middleware.JWTMiddleware())
-	profile.Get("/", handlers.GetProfile)
-	profile.Put("/", handlers.UpdateProfile)
-	profile.Get("/membership", handlers.GetMembershipInfo)
-
-	// Start server on port 3000
-	log.Printf("Server starting on port 3000...")
-	log.Printf("Swagger documentation available at http://localhost:3000/swagger/")
-	log.Fatal(app.Listen(":3000"))
-}
\ No newline at end of file
+	routes.Setup(api, cfg, s.db, s.handlers)
+
+	return app
+}
+
+// newGRPC returns the gRPC server on the services of the handlers.
+func (s *Server) newGRPC() *grpc.Server {
+	return grpcapi.New(grpcapi.Deps{
+		DB:                    s.db,
+		Config:                s.cfg,
+		Accounts:              s.handlers.Accounts(),
+		Membership:            s.handlers.Membership(),
+		Points:                s.handlers.Points(),
+		SendEmailVerification: s.handlers.SendEmailVerification,
+		VerifyTwoFactor:       s.handlers.VerifyTwoFactorChallenge,
+		Tenants:               s.shards.Tenants(),
+	})
+}
+
+// startBackgroundJobs runs the job queue's workers, the webhook and event
+// relays and the scheduled jobs until shutdown.
+func (s *Server) startBackgroundJobs() {
+	cfg := s.cfg
+	jobs.Start()
+
+	// Events are posted to the registered webhook endpoints and relayed to
+	// the broker, retrying failures with backoff, and expired revoked and
+	// refresh tokens are deleted hourly, in every tenant's database. The
+	// scheduled jobs below only run against the server's own.
+	for _, sh := range s.shards.Shards() {
+		webhook.Start(sh.DB)
+		events.Start(sh.DB)
+		middleware.StartTokenCleanup(sh.DB, time.Hour)
+	}
+
+	// Earned points past their expiry date are expired on a schedule,
+	// nightly by default
+	if cfg.Points.ExpiryDays > 0 {
+		scheduler.Register("points.expire", scheduler.MustParse(cfg.Points.ExpirySchedule))
+	}
+
+	// Balances are compared with the points ledger nightly, after the
+	// expiry run
+	scheduler.Register("points.reconcile", scheduler.MustParse(cfg.Points.ReconcileSchedule))
+
+	// Partners are settled for the points they credited once a month ends
+	scheduler.Register("settlements.generate", scheduler.MustParse(cfg.Points.SettlementSchedule))
+
+	// Members get a monthly statement of their points when a schedule is
+	// set
+	if cfg.Points.StatementSchedule != "" {
+		scheduler.Register("points.statements", scheduler.MustParse(cfg.Points.StatementSchedule))
+	}
+
+	// Earning points moves members up a tier at once; the recalculation
+	// also moves them down as points leave the qualifying period. Members
+	// are told about changes within a minute.
+	scheduler.Register("tiers.recalculate", scheduler.MustParse(cfg.Tiers.Schedule))
+	scheduler.Register("tiers.notices", scheduler.MustParse("* * * * *"))
+
+	// Redemptions whose step failed are tried again, or undone, from here
+	scheduler.Register("sagas.resume", scheduler.MustParse("* * * * *"))
+
+	// The notification center keeps 180 days; deleted rows stay as sync
+	// tombstones for sync.tombstone_retention_days
+	scheduler.Register("notifications.prune", scheduler.MustParse("0 3 * * *"))
+	scheduler.Register("sync.prune_tombstones", scheduler.MustParse("15 3 * * *"))
+
+	// Accounts deleted by their owner are purged once they can no longer
+	// be restored
+	scheduler.Register("users.purge", scheduler.MustParse(cfg.Accounts.PurgeSchedule))
+
+	// Exported archives are deleted once they can no longer be downloaded
+	scheduler.Register("data_exports.prune", scheduler.MustParse("45 4 * * *"))
+
+	// The audit log is kept forever unless a retention is set
+	if cfg.AuditLog.RetentionDays > 0 {
+		scheduler.Register("audit_logs.prune", scheduler.MustParse(cfg.AuditLog.PruneSchedule))
+	}
+
+	// The warehouse gets the days that ended as Parquet files when a
+	// schedule is set
+	if cfg.Analytics.Schedule != "" {
+		scheduler.Register("analytics.export", scheduler.MustParse(cfg.Analytics.Schedule))
+	}
+
+	// One instance, elected through a lease, queues the jobs; each due
+	// time is also claimed in the scheduled_runs table, so every job is
+	// queued once however many instances run the scheduler
+	scheduler.Start(s.db, handlers.QueueScheduledRun)
+}
+
+// shutdown ends the balance streams, stops accepting connections and lets
+// in-flight requests and gRPC calls finish, then waits for background jobs
+// and closes the rate limit store, the job queue, the event broker
+// connection and the database. A second signal is not caught and ends the
+// process at once.
+func (s *Server) shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if s.app != nil {
+		// Open streams would otherwise hold the shutdown up to the timeout
+		realtime.Default.Close()
+		if err := s.app.ShutdownWithContext(ctx); err != nil {
+			log.Printf("Server shutdown: %v", err)
+		}
+	}
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	if err := worker.Shutdown(ctx); err != nil {
+		log.Printf("Background jobs did not finish: %v", err)
+	}
+	if err := middleware.RateStore().Close(); err != nil {
+		log.Printf("Closing rate limit store: %v", err)
+	}
+	if err := jobs.Close(); err != nil {
+		log.Printf("Closing job queue: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		log.Printf("Closing cache: %v", err)
+	}
+	if err := events.Close(); err != nil {
+		log.Printf("Closing event broker: %v", err)
+	}
+	if err := s.shards.Close(); err != nil {
+		log.Printf("Closing shards: %v", err)
+	}
+	if err := database.Close(s.db); err != nil {
+		log.Printf("Closing database: %v", err)
+	}
+}
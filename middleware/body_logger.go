@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultBodyLogMaxBytes caps each logged body when no limit is configured.
+const DefaultBodyLogMaxBytes = 2048
+
+// BodyLogConfig selects which requests have their bodies logged. A request is
+// logged when logging is enabled and it matches one of the route prefixes or
+// was made by UserID.
+type BodyLogConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Routes   []string `json:"routes" example:"/profile"`
+	UserID   uint     `json:"user_id"`
+	MaxBytes int      `json:"max_bytes" example:"2048"`
+}
+
+var bodyLog = struct {
+	sync.RWMutex
+	config BodyLogConfig
+}{
+	config: BodyLogConfig{MaxBytes: DefaultBodyLogMaxBytes},
+}
+
+// GetBodyLogConfig returns the current body logging configuration.
+func GetBodyLogConfig() BodyLogConfig {
+	bodyLog.RLock()
+	defer bodyLog.RUnlock()
+	return bodyLog.config
+}
+
+// SetBodyLogConfig replaces the body logging configuration at runtime.
+func SetBodyLogConfig(config BodyLogConfig) BodyLogConfig {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultBodyLogMaxBytes
+	}
+
+	bodyLog.Lock()
+	defer bodyLog.Unlock()
+	bodyLog.config = config
+	return config
+}
+
+// BodyLogger logs redacted request and response bodies for the routes or user
+// selected with SetBodyLogConfig. It must run before the JWT middleware so
+// the user ID it sets is visible once the handler chain returns.
+func BodyLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		config := GetBodyLogConfig()
+		if !config.Enabled {
+			return c.Next()
+		}
+
+		err := c.Next()
+
+		// A streamed response, such as the balance stream, is still being
+		// written and may never end
+		userID, _ := c.Locals("user_id").(uint)
+		if c.Response().IsBodyStream() || !bodyLogMatches(config, RoutePath(c), userID) {
+			return err
+		}
+
+		Logf(c, "[body] %s %s user=%d status=%d request=%s response=%s",
+			c.Method(), c.Path(), userID, c.Response().StatusCode(),
+			RedactBody(c.Body(), config.MaxBytes),
+			RedactBody(c.Response().Body(), config.MaxBytes))
+
+		return err
+	}
+}
+
+func bodyLogMatches(config BodyLogConfig, path string, userID uint) bool {
+	if config.UserID != 0 && config.UserID == userID {
+		return true
+	}
+	for _, prefix := range config.Routes {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
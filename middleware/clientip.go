@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIP returns the address of the client that made the request. When
+// the request comes from one of TRUSTED_PROXIES it is the right-most entry
+// of X-Forwarded-For that is not a trusted proxy itself: the entries left of
+// it were written by the client and can be anything. Otherwise, and when
+// X-Forwarded-For holds no valid address, it is the peer's address.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP().String()
+	if !c.IsProxyTrusted() {
+		return remote
+	}
+
+	hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// A hop we cannot read ends the chain we can trust
+			break
+		}
+		if !trustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return remote
+}
+
+// trustedProxy reports whether ip is one of TRUSTED_PROXIES, given as
+// addresses or CIDR ranges.
+func trustedProxy(ip net.IP) bool {
+	for _, proxy := range settings.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
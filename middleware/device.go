@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Headers mobile apps send to identify the installation.
+const (
+	HeaderDeviceID       = "X-Device-ID"
+	HeaderDevicePlatform = "X-Device-Platform"
+	HeaderDeviceModel    = "X-Device-Model"
+	HeaderAppVersion     = "X-App-Version"
+)
+
+// deviceSeenInterval limits last-seen writes to one per device per interval.
+const deviceSeenInterval = 5 * time.Minute
+
+const maxDeviceHeaderLength = 128
+
+// DeviceTracker registers the device named in X-Device-ID for the
+// authenticated user and keeps its platform, model, app version and last
+// seen time current. It must run after JWTMiddleware. Requests without the
+// header are passed through unchanged.
+func DeviceTracker(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(uint)
+		deviceID := c.Get(HeaderDeviceID)
+		if !ok || deviceID == "" || len(deviceID) > maxDeviceHeaderLength {
+			return c.Next()
+		}
+
+		seen := models.Device{
+			UserID:     userID,
+			DeviceID:   deviceID,
+			Platform:   truncateHeader(c.Get(HeaderDevicePlatform)),
+			Model:      truncateHeader(c.Get(HeaderDeviceModel)),
+			AppVersion: truncateHeader(c.Get(HeaderAppVersion)),
+			LastSeenAt: time.Now(),
+		}
+		if err := trackDevice(db.WithContext(c.UserContext()), seen); err != nil {
+			Logf(c, "Failed to track device for user %d: %v", userID, err)
+		}
+
+		return c.Next()
+	}
+}
+
+func trackDevice(db *gorm.DB, seen models.Device) error {
+	var device models.Device
+	err := db.Where("user_id = ? AND device_id = ?", seen.UserID, seen.DeviceID).First(&device).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		seen.Name = seen.Model
+		err = db.Create(&seen).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// A concurrent request registered it first
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	unchanged := device.Platform == seen.Platform && device.Model == seen.Model && device.AppVersion == seen.AppVersion
+	if unchanged && seen.LastSeenAt.Sub(device.LastSeenAt) < deviceSeenInterval {
+		return nil
+	}
+	return db.Model(&device).Updates(map[string]interface{}{
+		"platform":     seen.Platform,
+		"model":        seen.Model,
+		"app_version":  seen.AppVersion,
+		"last_seen_at": seen.LastSeenAt,
+	}).Error
+}
+
+func truncateHeader(value string) string {
+	if len(value) > maxDeviceHeaderLength {
+		return value[:maxDeviceHeaderLength]
+	}
+	return value
+}
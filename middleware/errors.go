@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"errors"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AsAppError returns err as a models.AppError: AppErrors as they are, Fiber
+// errors (such as unknown routes) and well-known GORM errors with their
+// status and code, and anything else as a 500 caused by err.
+func AsAppError(err error) *models.AppError {
+	var appErr *models.AppError
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.As(err, &fiberErr):
+		return models.NewAppError(fiberErr.Code, models.CodeForStatus(fiberErr.Code), fiberErr.Message)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewAppError(fiber.StatusNotFound, models.CodeNotFound, "Record not found")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return models.NewAppError(fiber.StatusConflict, models.CodeDuplicateRecord, "A record with the same unique values already exists")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return models.NewAppError(fiber.StatusConflict, models.CodeConflict, "The record is still referenced or refers to a missing record")
+	}
+	return models.NewAppError(fiber.StatusInternalServerError, models.CodeInternal, "Internal server error").Wrap(err)
+}
@@ -1,60 +1,162 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"strings"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/tenant"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-var JWTSecret = []byte("your-secret-key-change-in-production")
+// JWTSecret signs HS256 access tokens and keys the service's other signed
+// tokens, from JWT_SECRET.
+func JWTSecret() []byte {
+	return []byte(settings.JWT.Secret)
+}
+
+// JWTIssuer is the "iss" claim of access tokens, from JWT_ISSUER.
+func JWTIssuer() string {
+	return settings.JWT.Issuer
+}
+
+// JWTAudience is the "aud" claim of access tokens, from JWT_AUDIENCE.
+func JWTAudience() string {
+	return settings.JWT.Audience
+}
 
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
+	// SessionID names the login the token belongs to; revoking the session
+	// revokes the token
+	SessionID string `json:"sid,omitempty"`
+	// Tenant is the tenant the account belongs to, empty for the server's
+	// own; the token is only accepted in requests for it
+	Tenant string `json:"tenant,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uint, email string) (string, error) {
+func GenerateJWT(ctx context.Context, userID uint, email, sessionID string) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		Tenant:    tenant.FromContext(ctx),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			// The ID lets a single token be revoked before it expires
+			ID:        uuid.NewString(),
+			Issuer:    JWTIssuer(),
+			Audience:  jwt.ClaimStrings{JWTAudience()},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JWTSecret)
+	return accessTokenKeys().sign(claims)
 }
 
-func JWTMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
-		}
+// ParseToken validates an access token, with or without the "Bearer "
+// prefix, and returns its claims. Tokens must carry this service's issuer and
+// audience and an expiry. It does not check the revocation list.
+func ParseToken(tokenString string) (*Claims, error) {
+	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, accessTokenKeys().keyFunc,
+		jwt.WithIssuer(JWTIssuer()),
+		jwt.WithAudience(JWTAudience()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// RequireEmailVerification reports whether JWTMiddleware rejects accounts
+// that have not verified their email address (REQUIRE_EMAIL_VERIFICATION).
+func RequireEmailVerification() bool {
+	return settings.RequireEmailVerification
+}
+
+func JWTMiddleware(db *gorm.DB) fiber.Handler {
+	// Load the keys now so a bad key stops the server at startup
+	accessTokenKeys()
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JWTSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
-			})
+	return func(c *fiber.Ctx) error {
+		claims, user, err := Authenticate(c.UserContext(), db, c.Get("Authorization"))
+		if err != nil {
+			return err
 		}
 
 		c.Locals("user_id", claims.UserID)
 		c.Locals("email", claims.Email)
-		
+		c.Locals("role", user.Role)
+		c.Locals("member_level", user.MemberLevel)
+		c.Locals("session_id", claims.SessionID)
+
 		return c.Next()
 	}
 }
+
+// Authenticate checks the "Bearer <token>" value authorization as
+// JWTMiddleware does for HTTP requests and gRPC calls alike: the token must
+// be valid, issued for the tenant in ctx and not revoked, on its own, with
+// its session or by a logout of every device, and its account must not be
+// suspended or, when required, unverified. It returns the token's claims and
+// the account's ID, role and tier.
+func Authenticate(ctx context.Context, db *gorm.DB, authorization string) (*Claims, *models.User, error) {
+	if authorization == "" {
+		return nil, nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeMissingCredentials, "Missing authorization header")
+	}
+
+	claims, err := ParseToken(authorization)
+	if err != nil || claims.Tenant != tenant.FromContext(ctx) {
+		return nil, nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidToken, "Invalid token")
+	}
+
+	revoked, err := TokenRevoked(db.WithContext(ctx), claims.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !revoked {
+		revoked, err = SessionRevoked(db.WithContext(ctx), claims.SessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if revoked {
+		return nil, nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeTokenRevoked, "Token has been revoked")
+	}
+
+	// Soft-deleted accounts keep their tokens so clients can sync the
+	// deletion
+	var user models.User
+	err = db.WithContext(ctx).Unscoped().Select("id", "email_verified_at", "tokens_revoked_at", "role", "member_level", "suspended_at").First(&user, claims.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidToken, "Invalid token")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.TokensRevokedAt != nil && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(*user.TokensRevokedAt)) {
+		return nil, nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeTokenRevoked, "Token has been revoked")
+	}
+	if user.SuspendedAt != nil {
+		return nil, nil, models.NewAppError(fiber.StatusForbidden, models.CodeAccountSuspended, "Account is suspended")
+	}
+	if RequireEmailVerification() && user.EmailVerifiedAt == nil {
+		return nil, nil, models.NewAppError(fiber.StatusForbidden, models.CodeEmailNotVerified, "Email address is not verified")
+	}
+	return claims, &user, nil
+}
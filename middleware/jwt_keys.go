@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing or verifying
+// access tokens.
+const minRSAKeyBits = 2048
+
+// jwtKey is a public key access tokens are verified with.
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	jwk    models.JWK
+}
+
+// jwtKeyRing holds the keys access tokens are signed and verified with.
+// Without a signing key tokens use HS256 with JWTSecret.
+type jwtKeyRing struct {
+	signer  crypto.PrivateKey
+	signing *jwtKey
+	// keys are the verification keys by key ID, the signing key included
+	keys map[string]*jwtKey
+	// order lists the key IDs for the JWKS, the signing key first
+	order []string
+}
+
+var (
+	jwtKeysOnce sync.Once
+	jwtKeys     *jwtKeyRing
+)
+
+// accessTokenKeys loads the access token keys on first use: the private key in
+// the PEM file JWT_SIGNING_KEY signs new tokens (RS256 for RSA keys, ES256
+// for P-256 keys), and the comma-separated PEM files in
+// JWT_VERIFICATION_KEYS are retired keys whose tokens are still accepted.
+// Invalid keys stop the server.
+func accessTokenKeys() *jwtKeyRing {
+	jwtKeysOnce.Do(func() {
+		ring, err := loadJWTKeyRing(settings.JWT.SigningKey, settings.JWT.VerificationKeys)
+		if err != nil {
+			log.Fatalf("Invalid JWT keys: %v", err)
+		}
+		jwtKeys = ring
+	})
+	return jwtKeys
+}
+
+func loadJWTKeyRing(signingFile string, verificationFiles []string) (*jwtKeyRing, error) {
+	ring := &jwtKeyRing{keys: map[string]*jwtKey{}}
+	if signingFile == "" {
+		return ring, nil
+	}
+
+	parsed, err := readPEMKey(signingFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a private key", signingFile)
+	}
+	key, err := newJWTKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingFile, err)
+	}
+	ring.signer = signer
+	ring.signing = key
+	ring.add(key)
+
+	for _, file := range verificationFiles {
+		parsed, err := readPEMKey(file)
+		if err != nil {
+			return nil, err
+		}
+		// Private keys are accepted too, e.g. the previous signing key
+		if signer, ok := parsed.(crypto.Signer); ok {
+			parsed = signer.Public()
+		}
+		key, err := newJWTKey(parsed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ring.add(key)
+	}
+	return ring, nil
+}
+
+func (r *jwtKeyRing) add(key *jwtKey) {
+	if _, ok := r.keys[key.id]; ok {
+		return
+	}
+	r.keys[key.id] = key
+	r.order = append(r.order, key.id)
+}
+
+// sign signs claims with the signing key, or with JWTSecret when there is
+// none.
+func (r *jwtKeyRing) sign(claims jwt.Claims) (string, error) {
+	if r.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JWTSecret())
+	}
+	token := jwt.NewWithClaims(r.signing.method, claims)
+	token.Header["kid"] = r.signing.id
+	return token.SignedString(r.signer)
+}
+
+// keyFunc picks the verification key by the token's "kid" header. Once a
+// signing key is configured HS256 tokens are no longer accepted.
+func (r *jwtKeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	if r.signing == nil {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return JWTSecret(), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys access tokens are verified with, for other
+// services to verify tokens themselves. It is empty while tokens are signed
+// with the shared HS256 secret.
+func JWKS() models.JWKSet {
+	ring := accessTokenKeys()
+	set := models.JWKSet{Keys: make([]models.JWK, 0, len(ring.order))}
+	for _, id := range ring.order {
+		set.Keys = append(set.Keys, ring.keys[id].jwk)
+	}
+	return set
+}
+
+func readPEMKey(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", file)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return key, nil
+}
+
+// newJWTKey describes a public key as a JWK. The key ID is the key's
+// RFC 7638 thumbprint, so every instance derives the same ID from the same
+// key.
+func newJWTKey(public crypto.PublicKey) (*jwtKey, error) {
+	key := &jwtKey{public: public}
+	var thumbprintInput string
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must have at least %d bits", minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+		key.jwk = models.JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+		thumbprintInput = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, key.jwk.E, key.jwk.N)
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("EC keys must use the P-256 curve")
+		}
+		point, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		raw := point.Bytes()
+		key.method = jwt.SigningMethodES256
+		key.jwk = models.JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(raw[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(raw[33:]),
+		}
+		thumbprintInput = fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`, key.jwk.X, key.jwk.Y)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	key.id = base64.RawURLEncoding.EncodeToString(sum[:])
+	key.jwk.Kid = key.id
+	key.jwk.Use = "sig"
+	key.jwk.Alg = key.method.Alg()
+	return key, nil
+}
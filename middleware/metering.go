@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// meter runs the rest of the chain and counts the request against the API
+// key in api_usage, in the row of the current hour and the matched route.
+// A failed count is logged; the response is not held up by it.
+func meter(c *fiber.Ctx, db *gorm.DB, keyType string, keyID uint) error {
+	err := c.Next()
+
+	// Returned errors are rendered by the error handler later, so derive
+	// the status it will use
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = AsAppError(err).Status
+	}
+	if err := Meter(c.UserContext(), db, keyType, keyID, c.Method(), c.Route().Path, status); err != nil {
+		Logf(c, "[metering] %s key %d: %v", keyType, keyID, err)
+	}
+
+	return err
+}
+
+// Meter counts a request with status against the API key in api_usage, in
+// the row of the current hour, method and route. Callers log a failed count
+// rather than fail the request.
+func Meter(ctx context.Context, db *gorm.DB, keyType string, keyID uint, method, route string, status int) error {
+	usage := models.APIUsage{
+		KeyType:  keyType,
+		KeyID:    keyID,
+		Hour:     time.Now().UTC().Truncate(time.Hour),
+		Method:   method,
+		Route:    route,
+		Requests: 1,
+	}
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		usage.ServerErrors = 1
+	case status >= fiber.StatusBadRequest:
+		usage.ClientErrors = 1
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key_type"}, {Name: "key_id"}, {Name: "hour"}, {Name: "method"}, {Name: "route"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":      gorm.Expr("api_usage.requests + excluded.requests"),
+			"client_errors": gorm.Expr("api_usage.client_errors + excluded.client_errors"),
+			"server_errors": gorm.Expr("api_usage.server_errors + excluded.server_errors"),
+		}),
+	}).Create(&usage).Error
+}
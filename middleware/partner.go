@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// HeaderPartnerKey carries a partner's API key.
+const HeaderPartnerKey = "X-API-Key"
+
+// HashPartnerKey returns the stored form of a partner API key.
+func HashPartnerKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// PartnerKeyMiddleware authenticates partners by the API key in X-API-Key
+// and, unless scope is empty, requires the key to carry scope. The partner
+// is stored in Locals as "partner". Requests that pass are metered in
+// api_usage.
+func PartnerKeyMiddleware(db *gorm.DB, scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		partner, err := AuthenticatePartner(c.UserContext(), db, c.Get(HeaderPartnerKey), scope)
+		if err != nil {
+			return err
+		}
+		c.Locals("partner", partner)
+
+		return meter(c, db, models.APIKeyTypePartner, partner.ID)
+	}
+}
+
+// AuthenticatePartner returns the partner whose API key is key, as
+// PartnerKeyMiddleware checks it, and records that the key was used.
+func AuthenticatePartner(ctx context.Context, db *gorm.DB, key, scope string) (*models.Partner, error) {
+	if key == "" {
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeMissingCredentials, "Missing API key")
+	}
+
+	var partner models.Partner
+	err := db.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", HashPartnerKey(key)).First(&partner).Error
+	if err != nil {
+		return nil, models.NewAppError(fiber.StatusUnauthorized, models.CodeInvalidAPIKey, "Invalid API key")
+	}
+
+	if scope != "" && !hasScope(partner.Scopes, scope) {
+		return nil, models.NewAppError(fiber.StatusForbidden, models.CodeInsufficientScope, "API key lacks the "+scope+" scope")
+	}
+
+	db.WithContext(ctx).Model(&partner).UpdateColumn("last_used_at", time.Now())
+	return &partner, nil
+}
+
+// PartnerRateLimit allows each partner the requests per minute of its plan
+// in limits.Plans, from PARTNER_RATE_LIMIT_PLANS (default premium 300), or
+// else limits.Partner, from PARTNER_RATE_LIMIT (default 30). It must run
+// after PartnerKeyMiddleware.
+func PartnerRateLimit(limits config.RateLimitConfig) fiber.Handler {
+	return rateLimitBy("partner", func(c *fiber.Ctx) (string, string, config.Rate) {
+		partner := c.Locals("partner").(*models.Partner)
+		return strconv.FormatUint(uint64(partner.ID), 10), partner.Plan, partnerRate(limits, partner)
+	})
+}
+
+// LimitPartner counts a call of partner outside HTTP, e.g. over gRPC,
+// against the same limit as PartnerRateLimit and fails it with
+// RATE_LIMITED once the limit is exceeded.
+func LimitPartner(limits config.RateLimitConfig, partner *models.Partner) error {
+	return limit("partner", strconv.FormatUint(uint64(partner.ID), 10), partnerRate(limits, partner))
+}
+
+// partnerRate is the rate of partner's plan.
+func partnerRate(limits config.RateLimitConfig, partner *models.Partner) config.Rate {
+	limit, ok := limits.Plans[partner.Plan]
+	if !ok {
+		limit = limits.Partner
+	}
+	return config.Rate{Limit: limit, Window: time.Minute}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
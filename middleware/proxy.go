@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BasePath returns the prefix the API is mounted under, from BASE_PATH, e.g.
+// "/loyalty". It is empty when the API is served from the root.
+func BasePath() string {
+	path := strings.Trim(settings.BasePath, "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// AbsoluteURL returns the URL of an API path such as "/profile" as the
+// client reached it, for links in responses to that client. Scheme and host
+// follow X-Forwarded-Proto and X-Forwarded-Host when the request came
+// through a trusted proxy. Emailed links use config.BaseURL instead, as the
+// Host header is the client's to set.
+func AbsoluteURL(c *fiber.Ctx, path string) string {
+	return c.BaseURL() + BasePath() + path
+}
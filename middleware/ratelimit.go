@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimit allows limit requests per window for each key returned by keyFunc,
+// counted in fixed windows in RateStore(), and answers 429 with Retry-After
+// once the limit is reached. name keeps the counters of different limiters
+// apart. If the store cannot be reached the request is let through.
+func RateLimit(name string, limit int, window time.Duration, keyFunc func(c *fiber.Ctx) string) fiber.Handler {
+	return rateLimitBy(name, func(c *fiber.Ctx) (string, string, config.Rate) {
+		return keyFunc(c), "", config.Rate{Limit: limit, Window: window}
+	})
+}
+
+// rateLimitBy is RateLimit with the rate chosen per request: rateFunc
+// returns the key, the plan the rate is for, named in X-RateLimit-Plan, and
+// the rate, which may be off. The caller's models.Quota is stored in Locals
+// as "quota".
+func rateLimitBy(name string, rateFunc func(c *fiber.Ctx) (key, plan string, rate config.Rate)) fiber.Handler {
+	store := RateStore()
+
+	return func(c *fiber.Ctx) error {
+		key, plan, rate := rateFunc(c)
+		if plan != "" {
+			c.Set("X-RateLimit-Plan", plan)
+		}
+		if rate.Off() {
+			c.Locals("quota", &models.Quota{Plan: plan})
+			return c.Next()
+		}
+
+		count, resetAt, err := store.Hit(name+":"+key, rate.Window)
+		if err != nil {
+			Logf(c, "[ratelimit] %s: %v", name, err)
+			return c.Next()
+		}
+		c.Locals("quota", &models.Quota{
+			Plan:          plan,
+			Limit:         rate.Limit,
+			WindowSeconds: int(rate.Window.Seconds()),
+			Used:          count,
+			Remaining:     max(rate.Limit-count, 0),
+			ResetAt:       &resetAt,
+		})
+
+		resetIn := strconv.Itoa(int(time.Until(resetAt).Seconds()) + 1)
+		c.Set("X-RateLimit-Limit", strconv.Itoa(rate.Limit))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(max(rate.Limit-count, 0)))
+		c.Set("X-RateLimit-Reset", resetIn)
+		if count > rate.Limit {
+			c.Set(fiber.HeaderRetryAfter, resetIn)
+			return models.NewAppError(fiber.StatusTooManyRequests, models.CodeRateLimited, "Rate limit exceeded")
+		}
+
+		return c.Next()
+	}
+}
+
+// AuthRateLimit limits /auth requests per client IP to rate, from
+// AUTH_RATE_LIMIT (default 30/1m).
+func AuthRateLimit(rate config.Rate) fiber.Handler {
+	if rate.Off() {
+		return passThrough
+	}
+	return RateLimit("auth", rate.Limit, rate.Window, func(c *fiber.Ctx) string {
+		return ClientIP(c)
+	})
+}
+
+// LimitAuth counts a sign-in call from ip outside HTTP, e.g. over gRPC,
+// against the same limit as AuthRateLimit.
+func LimitAuth(rate config.Rate, ip string) error {
+	return limit("auth", ip, rate)
+}
+
+// UserRateLimit limits requests per logged-in user to the rate of their
+// member level in limits.Tiers, from USER_RATE_LIMIT_TIERS (default Gold
+// 240/1m, Platinum 600/1m), or else to limits.User, from USER_RATE_LIMIT
+// (default 120/1m). It must run after JWTMiddleware or APIKeyMiddleware.
+func UserRateLimit(limits config.RateLimitConfig) fiber.Handler {
+	if limits.User.Off() && len(limits.Tiers) == 0 {
+		return passThrough
+	}
+	return rateLimitBy("user", func(c *fiber.Ctx) (string, string, config.Rate) {
+		level, _ := c.Locals("member_level").(string)
+		return strconv.FormatUint(uint64(c.Locals("user_id").(uint)), 10), level, userRate(limits, level)
+	})
+}
+
+// LimitUser counts a call of user outside HTTP, e.g. over gRPC, against the
+// same limit as UserRateLimit.
+func LimitUser(limits config.RateLimitConfig, user *models.User) error {
+	return limit("user", strconv.FormatUint(uint64(user.ID), 10), userRate(limits, user.MemberLevel))
+}
+
+// userRate is the rate of the member level.
+func userRate(limits config.RateLimitConfig, level string) config.Rate {
+	if rate, ok := limits.Tiers[level]; ok {
+		return rate
+	}
+	return limits.User
+}
+
+// OTPRateLimit allows each client IP 5 login code requests per 10 minutes,
+// which caps the SMS cost of scripted requests.
+func OTPRateLimit() fiber.Handler {
+	return RateLimit("otp", 5, 10*time.Minute, func(c *fiber.Ctx) string {
+		return ClientIP(c)
+	})
+}
+
+// limit counts a call outside HTTP against the counter of name and key in
+// RateStore(), as rateLimitBy counts requests, and fails it with
+// RATE_LIMITED once rate is exceeded. If the store cannot be reached the
+// call is let through.
+func limit(name, key string, rate config.Rate) error {
+	if rate.Off() {
+		return nil
+	}
+	count, _, err := RateStore().Hit(name+":"+key, rate.Window)
+	if err != nil {
+		log.Printf("[ratelimit] %s: %v", name, err)
+		return nil
+	}
+	if count > rate.Limit {
+		return models.NewAppError(fiber.StatusTooManyRequests, models.CodeRateLimited, "Rate limit exceeded")
+	}
+	return nil
+}
+
+func passThrough(c *fiber.Ctx) error {
+	return c.Next()
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/redis"
+)
+
+// RateLimitStore counts requests in fixed windows. The in-memory store is
+// per process; the Redis store shares the counters between instances.
+type RateLimitStore interface {
+	// Hit counts one request for key and returns the number of requests in
+	// the current window and when that window ends.
+	Hit(key string, window time.Duration) (int, time.Time, error)
+	// Ping reports whether the store can be reached.
+	Ping() error
+	Name() string
+	// Close releases the store's connections at shutdown.
+	Close() error
+}
+
+var (
+	rateStoreOnce sync.Once
+	rateStore     RateLimitStore
+)
+
+// RateStore returns the store selected by RATE_LIMIT_STORE ("memory", the
+// default, or "redis" with REDIS_URL).
+func RateStore() RateLimitStore {
+	rateStoreOnce.Do(func() {
+		if settings.RateLimit.Store != "redis" {
+			rateStore = newMemoryRateStore()
+			return
+		}
+		store, err := newRedisRateStore(settings.Redis.URL)
+		if err != nil {
+			log.Fatalf("Invalid REDIS_URL: %v", err)
+		}
+		rateStore = store
+	})
+	return rateStore
+}
+
+type memoryRateStore struct {
+	mu       sync.Mutex
+	counters map[string]*rateWindow
+	sweepAt  time.Time
+}
+
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{counters: map[string]*rateWindow{}}
+}
+
+func (s *memoryRateStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired windows now and then so idle keys do not pile up
+	if now.After(s.sweepAt) {
+		for k, w := range s.counters {
+			if now.After(w.resetAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+
+	w, ok := s.counters[key]
+	if !ok || now.After(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(window)}
+		s.counters[key] = w
+	}
+	w.count++
+	return w.count, w.resetAt, nil
+}
+
+func (s *memoryRateStore) Ping() error { return nil }
+
+func (s *memoryRateStore) Name() string { return "memory" }
+
+func (s *memoryRateStore) Close() error { return nil }
+
+// redisHitScript increments the counter and starts its window on the first
+// request, in one round trip. It returns the count and the milliseconds
+// left in the window.
+const redisHitScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return {n, redis.call('PTTL', KEYS[1])}`
+
+// redisRateStore keeps the counters in Redis, shared by every instance.
+type redisRateStore struct {
+	client *redis.Client
+}
+
+func newRedisRateStore(rawURL string) (*redisRateStore, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisRateStore{client: client}, nil
+}
+
+func (s *redisRateStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	reply, err := s.client.Do("EVAL", redisHitScript, "1", "ratelimit:"+key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, time.Time{}, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	count, _ := values[0].(int64)
+	ttl, _ := values[1].(int64)
+	if ttl < 0 {
+		ttl = window.Milliseconds()
+	}
+	return int(count), time.Now().Add(time.Duration(ttl) * time.Millisecond), nil
+}
+
+func (s *redisRateStore) Ping() error { return s.client.Ping() }
+
+func (s *redisRateStore) Name() string { return "redis" }
+
+func (s *redisRateStore) Close() error { return s.client.Close() }
@@ -0,0 +1,223 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// callerID keeps the counters of the tests apart in the shared rate store.
+var callerID atomic.Uint32
+
+func TestPlanRateLimits(t *testing.T) {
+	limits := config.RateLimitConfig{
+		User:    config.Rate{Limit: 2, Window: time.Minute},
+		Tiers:   map[string]config.Rate{"Gold": {Limit: 3, Window: time.Minute}, "Platinum": {}},
+		Partner: 2,
+		Plans:   map[string]int{"premium": 4},
+	}
+	tests := []struct {
+		name    string
+		limiter fiber.Handler
+		// caller stores the user or partner in Locals, as the
+		// authentication middleware does
+		caller  func(c *fiber.Ctx, id uint)
+		plan    string
+		allowed int
+	}{
+		{
+			name:    "member level without its own rate",
+			limiter: middleware.UserRateLimit(limits),
+			caller:  func(c *fiber.Ctx, id uint) { c.Locals("user_id", id); c.Locals("member_level", "Bronze") },
+			plan:    "Bronze",
+			allowed: 2,
+		},
+		{
+			name:    "member level with a higher rate",
+			limiter: middleware.UserRateLimit(limits),
+			caller:  func(c *fiber.Ctx, id uint) { c.Locals("user_id", id); c.Locals("member_level", "Gold") },
+			plan:    "Gold",
+			allowed: 3,
+		},
+		{
+			name:    "member level without a limit",
+			limiter: middleware.UserRateLimit(limits),
+			caller:  func(c *fiber.Ctx, id uint) { c.Locals("user_id", id); c.Locals("member_level", "Platinum") },
+			plan:    "Platinum",
+		},
+		{
+			name:    "user limits off",
+			limiter: middleware.UserRateLimit(config.RateLimitConfig{}),
+			caller:  func(c *fiber.Ctx, id uint) { c.Locals("user_id", id); c.Locals("member_level", "Gold") },
+		},
+		{
+			name:    "standard partner",
+			limiter: middleware.PartnerRateLimit(limits),
+			caller: func(c *fiber.Ctx, id uint) {
+				c.Locals("partner", &models.Partner{ID: id, Plan: models.PartnerPlanStandard})
+			},
+			plan:    models.PartnerPlanStandard,
+			allowed: 2,
+		},
+		{
+			name:    "premium partner",
+			limiter: middleware.PartnerRateLimit(limits),
+			caller:  func(c *fiber.Ctx, id uint) { c.Locals("partner", &models.Partner{ID: id, Plan: "premium"}) },
+			plan:    "premium",
+			allowed: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uint(callerID.Add(1))
+			app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+				return c.SendStatus(err.(*models.AppError).Status)
+			}})
+			app.Get("/", func(c *fiber.Ctx) error {
+				tt.caller(c, id)
+				return c.Next()
+			}, tt.limiter, func(c *fiber.Ctx) error {
+				quota, _ := c.Locals("quota").(*models.Quota)
+				return c.JSON(quota)
+			})
+
+			// Unlimited callers are let through however many requests
+			// they make
+			requests := tt.allowed + 1
+			if tt.allowed == 0 {
+				requests = 5
+			}
+			for i := 1; i <= requests; i++ {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if got := resp.Header.Get("X-RateLimit-Plan"); got != tt.plan {
+					t.Errorf("request %d: X-RateLimit-Plan %q, want %q", i, got, tt.plan)
+				}
+				if tt.allowed == 0 {
+					if resp.StatusCode != http.StatusOK || resp.Header.Get("X-RateLimit-Limit") != "" {
+						t.Fatalf("request %d: status %d, limit %q, want no limit", i, resp.StatusCode, resp.Header.Get("X-RateLimit-Limit"))
+					}
+					continue
+				}
+				if i > tt.allowed {
+					if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+						t.Errorf("request %d: status %d, want %d with Retry-After", i, resp.StatusCode, http.StatusTooManyRequests)
+					}
+					continue
+				}
+
+				remaining := strconv.Itoa(tt.allowed - i)
+				if resp.StatusCode != http.StatusOK || resp.Header.Get("X-RateLimit-Limit") != strconv.Itoa(tt.allowed) || resp.Header.Get("X-RateLimit-Remaining") != remaining {
+					t.Fatalf("request %d: status %d, limit %q, remaining %q, want %d and %s", i, resp.StatusCode,
+						resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Remaining"), tt.allowed, remaining)
+				}
+				var quota models.Quota
+				if err := json.Unmarshal(body, &quota); err != nil {
+					t.Fatalf("decode %s: %v", body, err)
+				}
+				if quota.Plan != tt.plan || quota.Limit != tt.allowed || quota.Used != i || quota.Remaining != tt.allowed-i || quota.WindowSeconds != 60 || quota.ResetAt == nil {
+					t.Errorf("request %d: quota %s", i, body)
+				}
+			}
+		})
+	}
+}
+
+// proxiedApp returns an app behind the trusted proxies 0.0.0.0, the peer
+// address of app.Test, and 10.0.0.0/8, configured as main.go does.
+func proxiedApp(t *testing.T, handlers ...fiber.Handler) *fiber.App {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.TrustedProxies = []string{"0.0.0.0", "10.0.0.0/8"}
+	middleware.Init(cfg)
+	t.Cleanup(func() { middleware.Init(config.Default()) })
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.SendStatus(err.(*models.AppError).Status)
+		},
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableIPValidation:      true,
+	})
+	app.Get("/", handlers...)
+	return app
+}
+
+func TestClientIP(t *testing.T) {
+	app := proxiedApp(t, func(c *fiber.Ctx) error {
+		return c.SendString(middleware.ClientIP(c))
+	})
+
+	tests := []struct {
+		forwardedFor string
+		want         string
+	}{
+		{forwardedFor: "", want: "0.0.0.0"},
+		{forwardedFor: "203.0.113.7", want: "203.0.113.7"},
+		// The client's own entries are left of the one our proxy added
+		{forwardedFor: "1.2.3.4, 203.0.113.7", want: "203.0.113.7"},
+		{forwardedFor: "1.2.3.4, 203.0.113.7, 10.0.0.2", want: "203.0.113.7"},
+		{forwardedFor: "2001:db8::1,10.1.2.3", want: "2001:db8::1"},
+		{forwardedFor: "10.0.0.5, 10.0.0.2", want: "0.0.0.0"},
+		{forwardedFor: "1.2.3.4, junk", want: "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.want {
+			t.Errorf("X-Forwarded-For %q: client IP %q, want %q", tt.forwardedFor, body, tt.want)
+		}
+	}
+}
+
+func TestAuthRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	app := proxiedApp(t, middleware.AuthRateLimit(config.Rate{Limit: 2, Window: time.Minute}), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	// A new made-up address on every request, in front of the one the
+	// proxy saw
+	client := "203.0.113." + strconv.Itoa(int(callerID.Add(1)))
+	for i := 1; i <= 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, "198.51.100."+strconv.Itoa(i)+", "+client+", 10.0.0.2")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		want := http.StatusOK
+		if i > 2 {
+			want = http.StatusTooManyRequests
+		}
+		if resp.StatusCode != want {
+			t.Errorf("request %d: status %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxCapturedBodyBytes caps stored request and response bodies.
+const maxCapturedBodyBytes = 16 * 1024
+
+// Headers that carry credentials and are never stored verbatim.
+var redactedHeaders = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"x-admin-key":   true,
+	"x-api-key":     true,
+}
+
+// RequestRecorder persists anonymized copies of requests that fail with a 4xx
+// or 5xx status. It is only installed when CAPTURE_FAILED_REQUESTS=true.
+// Admin and Swagger traffic is never captured.
+func RequestRecorder(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if status < fiber.StatusBadRequest || isUncapturedPath(RoutePath(c)) {
+			return err
+		}
+
+		headers := map[string]string{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			name := string(key)
+			if redactedHeaders[strings.ToLower(name)] {
+				headers[name] = "[REDACTED]"
+				return
+			}
+			headers[name] = string(value)
+		})
+
+		userID, _ := c.Locals("user_id").(uint)
+		captured := models.CapturedRequest{
+			Method:   c.Method(),
+			Path:     c.Path(),
+			Query:    string(c.Request().URI().QueryString()),
+			Headers:  headers,
+			Body:     RedactBody(c.Body(), maxCapturedBodyBytes),
+			Status:   status,
+			UserID:   userID,
+			Response: RedactBody(c.Response().Body(), maxCapturedBodyBytes),
+		}
+		if dbErr := db.WithContext(c.UserContext()).Create(&captured).Error; dbErr != nil {
+			Logf(c, "Failed to capture request %s %s: %v", c.Method(), c.Path(), dbErr)
+		}
+
+		return err
+	}
+}
+
+func isUncapturedPath(path string) bool {
+	return strings.HasPrefix(path, "/admin") || strings.HasPrefix(path, "/swagger")
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Fields whose values are never written to logs or captured requests.
+var secretFields = map[string]bool{
+	"password":         true,
+	"current_password": true,
+	"new_password":     true,
+	"token":            true,
+	"access_token":     true,
+	"refresh_token":    true,
+	"code":             true,
+	"otp":              true,
+	"secret":           true,
+	"challenge_token":  true,
+	"recovery_codes":   true,
+	"provisioning_uri": true,
+	"key":              true,
+	"api_key":          true,
+	"push_token":       true,
+}
+
+// Fields that identify a person and are partially masked.
+var piiFields = map[string]bool{
+	"email":      true,
+	"phone":      true,
+	"first_name": true,
+	"last_name":  true,
+}
+
+// RedactBody masks secrets and PII in a JSON body and truncates the result to
+// maxBytes. Non-JSON bodies are only truncated.
+func RedactBody(body []byte, maxBytes int) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		if redacted, err := json.Marshal(redactValue(data)); err == nil {
+			body = redacted
+		}
+	}
+
+	if maxBytes > 0 && len(body) > maxBytes {
+		return string(body[:maxBytes]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			name := strings.ToLower(key)
+			_, nested := field.(map[string]interface{})
+			switch {
+			// An object under a secret name, e.g. the api_key record next to
+			// the key itself, is redacted field by field
+			case secretFields[name] && !nested:
+				v[key] = "[REDACTED]"
+			case piiFields[name]:
+				if s, ok := field.(string); ok {
+					v[key] = MaskString(s)
+				}
+			default:
+				v[key] = redactValue(field)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// MaskString keeps the first character (and the domain of an email) and
+// replaces the rest with asterisks.
+func MaskString(s string) string {
+	if s == "" {
+		return s
+	}
+	local, domain, isEmail := strings.Cut(s, "@")
+	runes := []rune(local)
+	masked := local
+	if len(runes) > 0 {
+		masked = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	}
+	if isEmail {
+		return masked + "@" + domain
+	}
+	return masked
+}
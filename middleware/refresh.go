@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired and revoked
+	// refresh tokens.
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh
+	// token is presented again. Its family has been revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// AccessTokenTTL is the lifetime of access tokens, from ACCESS_TOKEN_TTL
+// (a Go duration such as "15m"; default 15 minutes).
+func AccessTokenTTL() time.Duration {
+	return settings.JWT.AccessTokenTTL
+}
+
+// RefreshTokenTTL is the lifetime of refresh tokens, from REFRESH_TOKEN_TTL
+// (default 30 days). Rotation does not extend the family beyond it.
+func RefreshTokenTTL() time.Duration {
+	return settings.JWT.RefreshTokenTTL
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func createRefreshToken(tx *gorm.DB, userID uint, familyID string, expiresAt time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := "rt_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	err := tx.Create(&models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: expiresAt,
+	}).Error
+	return token, err
+}
+
+// RotateRefreshToken exchanges token for a new one in the same family and
+// returns the stored token it replaces, which names the user and the
+// session (family). Reusing a rotated token revokes the family
+// and returns ErrRefreshTokenReused; the revocation is committed even though
+// an error is returned, so callers must not run it in a transaction that
+// rolls back on error.
+func RotateRefreshToken(db *gorm.DB, token string) (models.RefreshToken, string, error) {
+	var stored models.RefreshToken
+	err := db.Where("token_hash = ?", hashRefreshToken(token)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return stored, "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return stored, "", err
+	}
+
+	now := time.Now()
+	if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		return stored, "", ErrRefreshTokenInvalid
+	}
+	if stored.UsedAt != nil {
+		if err := RevokeRefreshFamily(db, stored.FamilyID); err != nil {
+			return stored, "", err
+		}
+		return stored, "", ErrRefreshTokenReused
+	}
+
+	var next string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The used_at condition makes concurrent rotations of one token
+		// count as reuse
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		next, err = createRefreshToken(tx, stored.UserID, stored.FamilyID, stored.ExpiresAt)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := RevokeRefreshFamily(db, stored.FamilyID); err != nil {
+			return stored, "", err
+		}
+		return stored, "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return stored, "", err
+	}
+	return stored, next, nil
+}
+
+// RevokeRefreshFamily revokes every token of a refresh token family.
+func RevokeRefreshFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserTokens revokes every refresh token of the user and every access
+// token issued before now, e.g. after a password change, so all sessions
+// have to log in again.
+func RevokeUserTokens(db *gorm.DB, userID uint) error {
+	// Access tokens carry their issue time in whole seconds; truncating
+	// keeps tokens issued later in the same second valid
+	now := time.Now().Truncate(time.Second)
+	err := db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("tokens_revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeRefreshToken revokes the family of token, e.g. on logout. Unknown
+// tokens are ignored.
+func RevokeRefreshToken(db *gorm.DB, token string) error {
+	var stored models.RefreshToken
+	err := db.Where("token_hash = ?", hashRefreshToken(token)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeRefreshFamily(db, stored.FamilyID)
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength bounds request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// RequestID takes the request ID from the X-Request-ID header, or generates
+// one when it is missing or malformed, and stores it in Locals as
+// "request_id" and in the user context for outbound calls. The ID is echoed
+// in the response header and added to JSON error bodies.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(requestid.Header)
+		if !ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Locals("request_id", id)
+		c.SetUserContext(requestid.NewContext(c.UserContext(), id))
+		c.Set(requestid.Header, id)
+		tracing.FromContext(c.UserContext()).SetAttribute("http.request.id", id)
+
+		err := c.Next()
+
+		// Errors returned up the chain are rendered by the error handler,
+		// which adds the ID itself
+		if err == nil && c.Response().StatusCode() >= fiber.StatusBadRequest {
+			addRequestIDToBody(c, id)
+		}
+		return err
+	}
+}
+
+// GetRequestID returns the ID set by RequestID, or "".
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("request_id").(string)
+	return id
+}
+
+// Logf logs like log.Printf with the request ID appended, so that log lines
+// can be matched to the response a client reports.
+func Logf(c *fiber.Ctx, format string, args ...interface{}) {
+	log.Printf(format+" request_id=%s", append(args, GetRequestID(c))...)
+}
+
+// ValidRequestID accepts IDs of letters, digits and -_.: so that client
+// values cannot forge log lines or headers.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// addRequestIDToBody adds a request_id field to a JSON object response that
+// does not have one.
+func addRequestIDToBody(c *fiber.Ctx, id string) {
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+	body := bytes.TrimSpace(c.Response().Body())
+	if len(body) < 2 || body[0] != '{' || bytes.Contains(body, []byte(`"request_id"`)) || !json.Valid(body) {
+		return
+	}
+
+	field, _ := json.Marshal(id)
+	patched := append([]byte{}, body[:len(body)-1]...)
+	if len(bytes.TrimSpace(patched)) > 1 {
+		patched = append(patched, ',')
+	}
+	patched = append(patched, `"request_id":`...)
+	patched = append(patched, field...)
+	patched = append(patched, '}')
+	c.Response().SetBodyRaw(patched)
+}
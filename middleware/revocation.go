@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/worker"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevokeToken blacklists the access token with claims until it expires.
+// Tokens issued before access tokens carried an ID cannot be revoked and
+// are ignored.
+func RevokeToken(db *gorm.DB, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}).Error
+}
+
+// TokenRevoked reports whether the access token with ID jti was revoked.
+func TokenRevoked(db *gorm.DB, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// StartTokenCleanup deletes expired revocation entries and refresh tokens,
+// and sessions that expired long ago, every interval in the background until
+// shutdown. Expired tokens are rejected anyway, so this only keeps the
+// tables small.
+func StartTokenCleanup(db *gorm.DB, interval time.Duration) {
+	worker.Go("token cleanup", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				pruneExpiredTokens(db, now)
+			}
+		}
+	})
+}
+
+func pruneExpiredTokens(db *gorm.DB, now time.Time) {
+	revoked := db.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	if revoked.Error != nil {
+		log.Printf("[auth] pruning revoked tokens failed: %v", revoked.Error)
+	}
+	refresh := db.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+	if refresh.Error != nil {
+		log.Printf("[auth] pruning refresh tokens failed: %v", refresh.Error)
+	}
+	if n := revoked.RowsAffected + refresh.RowsAffected; n > 0 {
+		log.Printf("[auth] pruned %d expired tokens", n)
+	}
+	sessions := db.Where("expires_at < ?", now.Add(-sessionHistoryRetention)).Delete(&models.Session{})
+	if sessions.Error != nil {
+		log.Printf("[auth] pruning sessions failed: %v", sessions.Error)
+	}
+}
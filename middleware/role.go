@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole lets the request through only when the logged-in user has one
+// of the given roles. It must run after JWTMiddleware, which loads the role
+// from the database, so a role change takes effect on the next request.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, allowed := range roles {
+			if role == allowed {
+				return c.Next()
+			}
+		}
+
+		return models.NewAppError(fiber.StatusForbidden, models.CodeInsufficientPermissions, "Insufficient permissions")
+	}
+}
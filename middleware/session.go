@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sessionHistoryRetention is how long ended sessions stay in the login
+// history.
+const sessionHistoryRetention = 90 * 24 * time.Hour
+
+const maxUserAgentLength = 256
+
+// StartSession records a login from ip and userAgent and starts its refresh
+// token family. It returns the session ID for the access token's "sid" claim
+// and the refresh token.
+func StartSession(db *gorm.DB, userID uint, ip, userAgent string) (string, string, error) {
+	familyID := uuid.NewString()
+	now := time.Now()
+	expiresAt := now.Add(RefreshTokenTTL())
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	var refreshToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&models.Session{
+			UserID:     userID,
+			FamilyID:   familyID,
+			IP:         ip,
+			UserAgent:  userAgent,
+			LastSeenAt: now,
+			LastIP:     ip,
+			ExpiresAt:  expiresAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		refreshToken, err = createRefreshToken(tx, userID, familyID, expiresAt)
+		return err
+	})
+	return familyID, refreshToken, err
+}
+
+// TouchSession notes that the session was refreshed from ip.
+func TouchSession(db *gorm.DB, sessionID, ip string) error {
+	return db.Model(&models.Session{}).
+		Where("family_id = ?", sessionID).
+		Updates(map[string]interface{}{"last_seen_at": time.Now(), "last_ip": ip}).Error
+}
+
+// SessionRevoked reports whether the session's refresh token family was
+// revoked, by logout, refresh token reuse or DELETE /profile/sessions/:id.
+func SessionRevoked(db *gorm.DB, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NOT NULL", sessionID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ActiveSessionIDs returns which of the given sessions can still be
+// refreshed.
+func ActiveSessionIDs(db *gorm.DB, sessionIDs []string) (map[string]bool, error) {
+	var families []string
+	err := db.Model(&models.RefreshToken{}).
+		Where("family_id IN ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", sessionIDs, time.Now()).
+		Distinct().Pluck("family_id", &families).Error
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]bool, len(families))
+	for _, family := range families {
+		active[family] = true
+	}
+	return active, nil
+}
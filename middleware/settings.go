@@ -0,0 +1,13 @@
+package middleware
+
+import "temp-backend-at-kbtg/config"
+
+// settings is the configuration given to Init, with the defaults until then.
+var settings = config.Default()
+
+// Init sets the configuration the middleware and the token functions read:
+// the JWT keys and lifetimes, BASE_PATH, TERMS_VERSION, whether email must
+// be verified and the rate limit store.
+func Init(cfg *config.Config) {
+	settings = cfg
+}
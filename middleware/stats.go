@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// statsMinutes is how far back request counts are kept.
+const statsMinutes = 15
+
+type minuteBucket struct {
+	minute       int64
+	total        int
+	clientErrors int
+	serverErrors int
+}
+
+var (
+	statsMu sync.Mutex
+	buckets [statsMinutes]minuteBucket
+)
+
+// RequestCounter counts responses by status class in per-minute buckets for
+// RecentRequestStats.
+func RequestCounter() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		// Returned errors are rendered by the error handler later, so derive
+		// the status it will use
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = AsAppError(err).Status
+		}
+		recordStatus(status, time.Now())
+
+		return err
+	}
+}
+
+func recordStatus(status int, now time.Time) {
+	minute := now.Unix() / 60
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	bucket := &buckets[minute%statsMinutes]
+	if bucket.minute != minute {
+		*bucket = minuteBucket{minute: minute}
+	}
+	bucket.total++
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		bucket.serverErrors++
+	case status >= fiber.StatusBadRequest:
+		bucket.clientErrors++
+	}
+}
+
+// RecentRequestStats sums the request counts of the last statsMinutes
+// minutes on this instance.
+func RecentRequestStats() models.RequestStats {
+	oldest := time.Now().Unix()/60 - statsMinutes + 1
+	stats := models.RequestStats{WindowMinutes: statsMinutes}
+
+	statsMu.Lock()
+	for _, bucket := range buckets {
+		if bucket.minute < oldest {
+			continue
+		}
+		stats.Total += bucket.total
+		stats.ClientErrors += bucket.clientErrors
+		stats.ServerErrors += bucket.serverErrors
+	}
+	statsMu.Unlock()
+
+	if stats.Total > 0 {
+		stats.ServerErrorRate = float64(stats.ServerErrors) / float64(stats.Total)
+	}
+	return stats
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"slices"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/tenant"
+	"temp-backend-at-kbtg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tenant serves the request for the tenant named in the X-Tenant-ID header,
+// one of tenants, or for sharding.tenant without it. Another tenant than
+// the server's own is put in the user context, where it routes the
+// request's queries to its shard (see shard.Route) and binds the access
+// tokens issued to it.
+func Tenant(tenants []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name, err := ResolveTenant(tenants, c.Get(tenant.Header))
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			c.SetUserContext(tenant.NewContext(c.UserContext(), name))
+			tracing.FromContext(c.UserContext()).SetAttribute("tenant", name)
+		}
+		return c.Next()
+	}
+}
+
+// ResolveTenant returns the tenant a request naming name is served for: ""
+// for the server's own, when name is empty or sharding.tenant, or name when
+// it is another of tenants. Other names are a 404 TENANT_NOT_FOUND error.
+func ResolveTenant(tenants []string, name string) (string, error) {
+	if name == "" || name == settings.Sharding.Tenant {
+		return "", nil
+	}
+	if !slices.Contains(tenants, name) {
+		return "", models.NewAppError(fiber.StatusNotFound, models.CodeTenantNotFound, "Tenant not found")
+	}
+	return name, nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// termsExemptRoutes stay reachable before the latest terms are accepted, so
+// the app can load the user and record the acceptance, or the user can
+// delete their account instead.
+var termsExemptRoutes = map[string]bool{
+	"GET /profile":               true,
+	"POST /profile/accept-terms": true,
+	"DELETE /profile":            true,
+}
+
+// CurrentTermsVersion returns the terms-of-service version users must have
+// accepted, from TERMS_VERSION. Gating is off when it is empty.
+func CurrentTermsVersion() string {
+	return settings.TermsVersion
+}
+
+// TermsGate fails authenticated routes with the error of CheckTerms until
+// the user has accepted the current terms version. It must run after
+// JWTMiddleware.
+func TermsGate(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		current := CurrentTermsVersion()
+		if current == "" {
+			return c.Next()
+		}
+
+		path := strings.TrimSuffix(RoutePath(c), "/")
+		if termsExemptRoutes[c.Method()+" "+path] {
+			return c.Next()
+		}
+
+		if err := CheckTerms(c.UserContext(), db, c.Locals("user_id").(uint)); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// CheckTerms fails with 428 TERMS_NOT_ACCEPTED, detailing the version to
+// accept, unless userID has accepted the current terms version. TermsGate
+// uses it for HTTP and the gRPC API calls it directly. It passes while
+// gating is off.
+func CheckTerms(ctx context.Context, db *gorm.DB, userID uint) error {
+	current := CurrentTermsVersion()
+	if current == "" {
+		return nil
+	}
+
+	var user models.User
+	err := db.WithContext(ctx).Select("accepted_terms_version").First(&user, userID).Error
+	if err == nil && user.AcceptedTermsVersion == current {
+		return nil
+	}
+	return models.NewAppError(fiber.StatusPreconditionRequired, models.CodeTermsNotAccepted, "The latest terms of service must be accepted").WithDetails(models.TermsDetails{TermsVersion: current})
+}
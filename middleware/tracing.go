@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+
+	"temp-backend-at-kbtg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tracing starts a server span for each request, continuing the caller's
+// trace from its traceparent header, and stores it in the request's user
+// context. Handlers pass c.UserContext() to the database and outbound HTTP
+// calls so their spans join the trace.
+func Tracing() fiber.Handler {
+	if !tracing.Enabled() {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		// Probes arrive every few seconds and would crowd out real traces
+		path := RoutePath(c)
+		if path == "/healthz" || path == "/readyz" {
+			return c.Next()
+		}
+
+		ctx, span := tracing.StartServer(c.UserContext(), c.Get("traceparent"), c.Method())
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = AsAppError(err).Status
+		}
+
+		// Name the span after the route pattern, not the path, so that
+		// IDs in URLs do not make every span name unique
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttribute("http.request.method", c.Method())
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("url.path", c.Path())
+		span.SetAttribute("client.address", ClientIP(c))
+		span.SetAttribute("user_agent.original", c.Get(fiber.HeaderUserAgent))
+		span.SetAttribute("http.response.status_code", status)
+		if status >= fiber.StatusInternalServerError {
+			if err == nil {
+				err = fmt.Errorf("status %d", status)
+			}
+			span.SetError(err)
+		}
+		if id, ok := c.Locals("user_id").(uint); ok {
+			span.SetAttribute("enduser.id", fmt.Sprint(id))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TwoFactorChallengeTTL is how long a user has to enter the second factor
+// after the password was accepted.
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// ErrInvalidChallenge is returned for challenge tokens that are malformed,
+// expired or not signed by this service.
+var ErrInvalidChallenge = errors.New("invalid two-factor challenge")
+
+// challengeKey signs two-factor challenge tokens.
+func challengeKey() []byte {
+	return config.DeriveKey(JWTSecret(), "2fa-challenge")
+}
+
+// IssueTwoFactorChallenge signs a token saying the user has passed the first
+// factor.
+func IssueTwoFactorChallenge(userID uint) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(TwoFactorChallengeTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(challengeKey())
+}
+
+// ParseTwoFactorChallenge returns the user of a token made by
+// IssueTwoFactorChallenge.
+func ParseTwoFactorChallenge(token string) (uint, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return challengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, ErrInvalidChallenge
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidChallenge
+	}
+	return uint(userID), nil
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIVersionHeader carries the version of the API that served a response.
+// On the unversioned paths clients may send it to pick a version other
+// than the oldest.
+const APIVersionHeader = "API-Version"
+
+// versionPrefix matches the /api/<version> prefix of a path.
+var versionPrefix = regexp.MustCompile(`^/api/v[0-9]+`)
+
+// RoutePath returns the path of the request without BASE_PATH and the
+// /api/<version> prefix, e.g. "/profile" for /loyalty/api/v1/profile, so
+// that checks on paths hold for every version and the unversioned paths.
+func RoutePath(c *fiber.Ctx) string {
+	path := strings.TrimPrefix(c.Path(), BasePath())
+	if prefix := versionPrefix.FindString(path); prefix != "" && (len(path) == len(prefix) || path[len(prefix)] == '/') {
+		path = path[len(prefix):]
+	}
+	return path
+}
+
+// APIVersion marks the responses of the routes of version, e.g. "v1".
+func APIVersion(version string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(APIVersionHeader, version)
+		return c.Next()
+	}
+}
+
+// LegacyPaths serves the paths the API had before it was versioned, those
+// under prefixes such as "/profile", from /api/<version>. The version is
+// the one named in the API-Version header, "v2" or "2", or else the first
+// of versions, which the unversioned paths always meant. The request is
+// rewritten before it is routed, and the response is marked deprecated
+// with a Link to the versioned path. Other paths pass through unchanged.
+func LegacyPaths(prefixes, versions []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := strings.TrimPrefix(c.Path(), BasePath())
+		if !hasPathPrefix(path, prefixes) {
+			return c.Next()
+		}
+
+		version := versions[0]
+		if requested := c.Get(APIVersionHeader); requested != "" {
+			if !strings.HasPrefix(requested, "v") {
+				requested = "v" + requested
+			}
+			if !slices.Contains(versions, requested) {
+				return models.NewAppError(fiber.StatusBadRequest, models.CodeUnsupportedAPIVersion,
+					fmt.Sprintf("Unsupported API version; use one of %s", strings.Join(versions, ", ")))
+			}
+			version = requested
+		}
+
+		versioned := "/api/" + version + path
+		c.Set("Deprecation", "true")
+		c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="successor-version"`, AbsoluteURL(c, versioned)))
+		c.Path(BasePath() + versioned)
+		return c.Next()
+	}
+}
+
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
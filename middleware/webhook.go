@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderWebhookSecret carries the shared secret providers send with
+// webhook calls.
+const HeaderWebhookSecret = "X-Webhook-Secret"
+
+// WebhookSecretMiddleware accepts webhook calls whose X-Webhook-Secret
+// header matches secret, and audits them as actor, e.g. email-provider.
+// The webhook is disabled when secret is empty.
+func WebhookSecretMiddleware(secret, actor string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if secret == "" {
+			return models.NewAppError(fiber.StatusForbidden, models.CodeForbidden, "Webhook is disabled")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.Get(HeaderWebhookSecret)), []byte(secret)) != 1 {
+			return models.NewAppError(fiber.StatusUnauthorized, models.CodeUnauthorized, "Invalid webhook secret")
+		}
+
+		c.Locals("actor", actor)
+		return c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Address is a Thai postal address in a member's address book, used to ship
+// physical rewards and on invoices. At most one of a member's addresses is
+// the default, and whenever a member has addresses one of them is.
+type Address struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID    uint           `gorm:"index;uniqueIndex:idx_addresses_user_default,where:is_default AND deleted_at IS NULL;not null" json:"-"`
+	// Label tells the member's addresses apart, e.g. Home or Office
+	Label      string `gorm:"not null" json:"label" example:"Home"`
+	Line1      string `gorm:"not null" json:"line1" example:"99/1 Sukhumvit Road"`
+	Line2      string `json:"line2" example:"Khlong Toei Nuea"`
+	District   string `gorm:"not null" json:"district" example:"Watthana"`
+	Province   string `gorm:"not null" json:"province" example:"Bangkok"`
+	PostalCode string `gorm:"not null" json:"postal_code" example:"10110"`
+	IsDefault  bool   `gorm:"not null;default:false" json:"is_default"`
+}
+
+// AddressRequest is the body of creating or replacing an address. Setting
+// is_default makes the address the default; the default stays so until
+// another address is made the default.
+type AddressRequest struct {
+	Label      string `json:"label" validate:"required,max=50" example:"Home"`
+	Line1      string `json:"line1" validate:"required,max=200" example:"99/1 Sukhumvit Road"`
+	Line2      string `json:"line2" validate:"max=200" example:"Khlong Toei Nuea"`
+	District   string `json:"district" validate:"required,max=100" example:"Watthana"`
+	Province   string `json:"province" validate:"required,max=100" example:"Bangkok"`
+	PostalCode string `json:"postal_code" validate:"required,len=5,numeric" example:"10110"`
+	IsDefault  bool   `json:"is_default"`
+}
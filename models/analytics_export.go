@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AnalyticsExport is the state of a dataset of the analytics export: the
+// schema its files are published with and how far it has been exported.
+type AnalyticsExport struct {
+	Dataset string `gorm:"primarykey" json:"dataset" example:"point_transactions"`
+	// Version is the table the files go to, <dataset>/v<version>/; a column
+	// whose type changes starts a new one
+	Version int `gorm:"not null" json:"version" example:"1"`
+	// Columns are the columns of the files in order: those of the code, and
+	// any the code dropped, which are written as null
+	Columns []AnalyticsColumn `gorm:"serializer:json" json:"columns"`
+	// ExportedThrough is the last day exported, YYYY-MM-DD in UTC
+	ExportedThrough string    `json:"exported_through" example:"2026-10-14"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// AnalyticsColumn is a column of an exported dataset.
+type AnalyticsColumn struct {
+	Name string `json:"name" example:"amount"`
+	// Type is INT64, STRING, BOOLEAN or TIMESTAMP
+	Type string `json:"type" example:"INT64"`
+}
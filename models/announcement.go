@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Announcement is a message shown to members from StartsAt until the
+// optional EndsAt.
+type Announcement struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Title     string     `gorm:"not null" json:"title" example:"Double points weekend"`
+	Body      string     `gorm:"not null" json:"body" example:"Earn twice the points on every purchase this Saturday and Sunday."`
+	StartsAt  time.Time  `gorm:"index;not null" json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+}
+
+// CreateAnnouncementRequest publishes an announcement, at once when
+// StartsAt is left out.
+type CreateAnnouncementRequest struct {
+	Title    string     `json:"title" validate:"required,max=200" example:"Double points weekend"`
+	Body     string     `json:"body" validate:"required,max=5000" example:"Earn twice the points on every purchase this Saturday and Sunday."`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// UpdateAnnouncementRequest changes only the fields present in the body.
+type UpdateAnnouncementRequest struct {
+	Title    *string    `json:"title" validate:"omitempty,max=200" example:"Double points weekend"`
+	Body     *string    `json:"body" validate:"omitempty,max=5000"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// API key scopes. Read scopes allow GET requests to the resource, write
+// scopes everything else.
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeSyncRead     = "sync:read"
+	ScopeRewardsRead  = "rewards:read"
+)
+
+// APIKeyScopes lists the scopes a user can grant an API key.
+var APIKeyScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeSyncRead, ScopeRewardsRead}
+
+// APIKey lets a machine client act as the user who created it, limited to
+// its scopes. Only a hash of the key is stored.
+type APIKey struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	Name      string    `gorm:"not null" json:"name" example:"Expense tracker"`
+	KeyHash   string    `gorm:"uniqueIndex;not null" json:"-"`
+	// KeyPrefix identifies the key in listings without revealing it
+	KeyPrefix  string     `json:"key_prefix" example:"uk_Q2xx8Vd"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes" example:"profile:read,sync:read"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required" example:"Expense tracker"`
+	Scopes []string `json:"scopes" validate:"required" example:"profile:read,sync:read"`
+	// ExpiresInDays limits the key's lifetime; keys without it do not expire
+	ExpiresInDays int `json:"expires_in_days" example:"90"`
+}
+
+// CreateAPIKeyResponse is the only time the key itself is shown.
+type CreateAPIKeyResponse struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key" example:"uk_Q2xx8VdY..."`
+}
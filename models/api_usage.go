@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Kinds of API key metered in api_usage: a partner's key or a user's.
+const (
+	APIKeyTypePartner = "partner"
+	APIKeyTypeUser    = "user"
+)
+
+// APIUsage counts the requests made with one API key to one route in one
+// UTC hour. Rejected requests count too, as client errors (4xx, including
+// 429 from the rate limit) or server errors (5xx).
+type APIUsage struct {
+	ID      uint   `gorm:"primarykey" json:"-"`
+	KeyType string `gorm:"uniqueIndex:idx_api_usage_bucket,priority:1;not null" json:"key_type" example:"partner"`
+	// KeyID is the partner, for partner keys, or the api_keys row
+	KeyID uint `gorm:"uniqueIndex:idx_api_usage_bucket,priority:2;not null" json:"key_id" example:"3"`
+	// Hour is the start of the hour the requests were made in
+	Hour         time.Time `gorm:"uniqueIndex:idx_api_usage_bucket,priority:3;index;not null" json:"hour"`
+	Method       string    `gorm:"uniqueIndex:idx_api_usage_bucket,priority:4;not null" json:"method" example:"GET"`
+	Route        string    `gorm:"uniqueIndex:idx_api_usage_bucket,priority:5;not null" json:"route" example:"/api/v1/partner/members/:membership_id"`
+	Requests     int       `gorm:"not null;default:0" json:"requests" example:"120"`
+	ClientErrors int       `gorm:"not null;default:0" json:"client_errors" example:"3"`
+	ServerErrors int       `gorm:"not null;default:0" json:"server_errors" example:"0"`
+}
+
+func (APIUsage) TableName() string { return "api_usage" }
+
+// APIUsageCounts are request counts with their error rate, the share of
+// requests answered with a client or server error.
+type APIUsageCounts struct {
+	Requests     int     `json:"requests" example:"120"`
+	ClientErrors int     `json:"client_errors" example:"3"`
+	ServerErrors int     `json:"server_errors" example:"0"`
+	ErrorRate    float64 `json:"error_rate" example:"0.025"`
+}
+
+// APIUsageDay is a day's usage of a key.
+type APIUsageDay struct {
+	Day string `json:"day" example:"2026-10-01"`
+	APIUsageCounts
+}
+
+// APIUsageEndpoint is a key's usage of one endpoint.
+type APIUsageEndpoint struct {
+	Method string `json:"method" example:"GET"`
+	Route  string `json:"route" example:"/api/v1/partner/members/:membership_id"`
+	APIUsageCounts
+}
+
+// APIUsageResponse is a partner's usage of its key over the inclusive range
+// of UTC days From to To, in total, per day and per endpoint.
+type APIUsageResponse struct {
+	From string `json:"from" example:"2026-09-16"`
+	To   string `json:"to" example:"2026-10-15"`
+	APIUsageCounts
+	Days      []APIUsageDay      `json:"days"`
+	Endpoints []APIUsageEndpoint `json:"endpoints"`
+}
@@ -0,0 +1,156 @@
+package models
+
+import "net/http"
+
+// Machine-readable error codes returned in ErrorResponse.Code. Clients branch
+// on the code; the message is for people and may change. Codes are never
+// renamed once released.
+const (
+	// Generic codes, one per status, for errors without a more specific one
+	CodeBadRequest         = "BAD_REQUEST"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeNotFound           = "NOT_FOUND"
+	CodeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	CodeConflict           = "CONFLICT"
+	CodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeInternal           = "INTERNAL_ERROR"
+	CodeUpstreamFailed     = "UPSTREAM_FAILED"
+	CodeServiceUnavailable = "SERVICE_UNAVAILABLE"
+
+	// Requests
+	CodeValidationFailed   = "VALIDATION_FAILED"
+	CodeInvalidRequestBody = "INVALID_REQUEST_BODY"
+	CodeInvalidID          = "INVALID_ID"
+	CodeDuplicateRecord    = "DUPLICATE_RECORD"
+	// The Idempotency-Key was already used for a request with another body
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	// The API-Version header names a version the server does not serve
+	CodeUnsupportedAPIVersion = "UNSUPPORTED_API_VERSION"
+	// The sync cursor is older than the tombstones kept; sync from scratch
+	CodeSyncCursorExpired = "SYNC_CURSOR_EXPIRED"
+
+	// Authentication
+	CodeMissingCredentials  = "MISSING_CREDENTIALS"
+	CodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	CodeInvalidToken        = "INVALID_TOKEN"
+	CodeTokenRevoked        = "TOKEN_REVOKED"
+	CodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	CodeRefreshTokenReused  = "REFRESH_TOKEN_REUSED"
+	CodeSessionExpired      = "SESSION_EXPIRED"
+	CodeInvalidAPIKey       = "INVALID_API_KEY"
+	CodeInsufficientScope   = "INSUFFICIENT_SCOPE"
+	CodeUserLoginRequired   = "USER_LOGIN_REQUIRED"
+	CodeInvalidCode         = "INVALID_CODE"
+	CodeTooManyAttempts     = "TOO_MANY_ATTEMPTS"
+	CodeInvalidLink         = "INVALID_OR_EXPIRED_LINK"
+
+	// Accounts
+	CodeUserNotFound            = "USER_NOT_FOUND"
+	CodeEmailTaken              = "EMAIL_TAKEN"
+	CodeAccountSuspended        = "ACCOUNT_SUSPENDED"
+	CodeEmailNotVerified        = "EMAIL_NOT_VERIFIED"
+	CodeInsufficientPermissions = "INSUFFICIENT_PERMISSIONS"
+	CodeTermsNotAccepted        = "TERMS_NOT_ACCEPTED"
+	CodeTwoFactorEnabled        = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled     = "TWO_FACTOR_NOT_ENABLED"
+	CodeAPIKeyLimitReached      = "API_KEY_LIMIT_REACHED"
+	CodeAddressLimitReached     = "ADDRESS_LIMIT_REACHED"
+	CodeInvalidCard             = "INVALID_OR_EXPIRED_CARD"
+
+	// Points and rewards
+	CodeInsufficientPoints = "INSUFFICIENT_POINTS"
+	CodeOutOfStock         = "OUT_OF_STOCK"
+
+	// Coupons
+	CodeCouponNotActive      = "COUPON_NOT_ACTIVE"
+	CodeCouponUsedUp         = "COUPON_USED_UP"
+	CodeCouponAlreadyApplied = "COUPON_ALREADY_APPLIED"
+
+	// Wallet
+	CodeInsufficientFunds  = "INSUFFICIENT_FUNDS"
+	CodeWalletBalanceLimit = "WALLET_BALANCE_LIMIT"
+	CodePaymentDeclined    = "PAYMENT_DECLINED"
+
+	// Partner settlements
+	CodeSettlementLocked = "SETTLEMENT_LOCKED"
+
+	// Tenants
+	CodeTenantNotFound = "TENANT_NOT_FOUND"
+)
+
+// statusCodes are the generic codes by HTTP status.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusBadGateway:            CodeUpstreamFailed,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+}
+
+// CodeForStatus returns the generic code of an HTTP error status.
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// AppError is a failed request. Handlers and middleware return it instead of
+// writing the response; handlers.ErrorHandler renders it as ErrorResponse,
+// or as ValidationErrorResponse for CodeValidationFailed.
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+	// Details are returned to the client as ErrorResponse.Details.
+	Details interface{}
+	// Err is the underlying cause; it is logged, never returned.
+	Err error
+}
+
+// NewAppError returns an error answered with status, code and message.
+func NewAppError(status int, code, message string) *AppError {
+	return &AppError{Status: status, Code: code, Message: message}
+}
+
+// NewValidationError returns a 400 VALIDATION_FAILED error listing the
+// rejected fields and why.
+func NewValidationError(message string, fields map[string]string) *AppError {
+	return &AppError{Status: http.StatusBadRequest, Code: CodeValidationFailed, Message: message, Details: fields}
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *AppError) WithDetails(details interface{}) *AppError {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *AppError) Wrap(err error) *AppError {
+	copied := *e
+	copied.Err = err
+	return &copied
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AuditLog records who changed which attributes of a resource. Values are
+// not stored so the log does not duplicate personal data.
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Actor      string    `json:"actor" example:"user:1"`
+	Action     string    `gorm:"index" json:"action" example:"user.update"`
+	Resource   string    `gorm:"index:idx_audit_resource" json:"resource" example:"users"`
+	ResourceID uint      `gorm:"index:idx_audit_resource" json:"resource_id"`
+	Fields     []string  `gorm:"serializer:json" json:"fields"`
+}
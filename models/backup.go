@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// BackupInfo describes an encrypted database snapshot in the backup
+// directory.
+type BackupInfo struct {
+	Name      string    `json:"name" example:"backup-20251018-020000.db.enc"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupJob is the state of an admin-triggered backup.
+type BackupJob struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status" example:"running"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Backup     *BackupInfo `json:"backup,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type BackupListResponse struct {
+	Backups []BackupInfo `json:"backups"`
+	// LastJob is the most recent backup started through the admin API
+	LastJob *BackupJob `json:"last_job"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Campaign events that can award points.
+const (
+	CampaignEventRegistration     = "registration"
+	CampaignEventProfileCompleted = "profile_completed"
+	CampaignEventPhoneVerified    = "phone_verified"
+)
+
+// Campaign awards Points once per user when Event happens while the
+// campaign is active and within its optional start and end dates.
+type Campaign struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Code      string     `gorm:"uniqueIndex;not null" json:"code" example:"welcome"`
+	Name      string     `json:"name" example:"Welcome bonus"`
+	Event     string     `gorm:"index;not null" json:"event" example:"registration"`
+	Points    int        `gorm:"not null" json:"points" example:"100"`
+	Active    bool       `gorm:"not null;default:true" json:"active"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+}
+
+// CampaignAward records that a user received a campaign's points. The
+// unique index makes awarding idempotent.
+type CampaignAward struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	CampaignID uint      `gorm:"uniqueIndex:idx_campaign_awards_user;not null" json:"campaign_id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_campaign_awards_user;index;not null" json:"user_id"`
+	Points     int       `json:"points"`
+}
+
+type CreateCampaignRequest struct {
+	Code     string     `json:"code" example:"welcome"`
+	Name     string     `json:"name" example:"Welcome bonus"`
+	Event    string     `json:"event" example:"registration"`
+	Points   int        `json:"points" example:"100"`
+	Active   *bool      `json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// UpdateCampaignRequest changes only the fields present in the body.
+type UpdateCampaignRequest struct {
+	Name     *string    `json:"name" example:"Welcome bonus"`
+	Points   *int       `json:"points" example:"150"`
+	Active   *bool      `json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// CapturedRequest is an anonymized copy of a request that failed with a 4xx
+// or 5xx status, kept so it can be inspected and replayed against staging.
+type CapturedRequest struct {
+	ID        uint              `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time         `gorm:"index" json:"created_at"`
+	Method    string            `json:"method"`
+	Path      string            `gorm:"index" json:"path"`
+	Query     string            `json:"query"`
+	Headers   map[string]string `gorm:"serializer:json" json:"headers"`
+	Body      string            `json:"body"`
+	Status    int               `gorm:"index" json:"status"`
+	UserID    uint              `json:"user_id"`
+	Response  string            `json:"response"`
+}
+
+type ReplayRequest struct {
+	// Authorization replaces the redacted Authorization header, e.g. a token
+	// valid on the staging instance.
+	Authorization string `json:"authorization"`
+}
+
+type ReplayResponse struct {
+	Target     string `json:"target"`
+	Status     int    `json:"status"`
+	Body       string `json:"body"`
+	DurationMs int64  `json:"duration_ms"`
+}
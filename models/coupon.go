@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Coupon types. A points coupon credits Value points when applied; a
+// discount coupon is claimed for Value percent off at partner stores.
+const (
+	CouponPoints   = "points"
+	CouponDiscount = "discount"
+)
+
+// Coupon is a code members apply once each, while it is active and within
+// its optional start and end dates, until MaxUses members have applied it.
+type Coupon struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Code is stored upper-case; codes are matched case-insensitively
+	Code string `gorm:"uniqueIndex;not null" json:"code" example:"SONGKRAN-7K3QMX2PAB"`
+	// Batch names the bulk generation a coupon came from
+	Batch string `gorm:"index" json:"batch,omitempty" example:"songkran-2026"`
+	Name  string `gorm:"not null" json:"name" example:"Songkran bonus"`
+	Type  string `gorm:"not null" json:"type" example:"points"`
+	// Value is the points credited or the percentage off
+	Value int `gorm:"not null" json:"value" example:"100"`
+	// MaxUses is how many members can apply the coupon; 0 is unlimited
+	MaxUses  int        `gorm:"not null" json:"max_uses" example:"1"`
+	Uses     int        `gorm:"not null;default:0" json:"uses" example:"0"`
+	Active   bool       `gorm:"not null;default:true" json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// CouponUse records that a member applied a coupon. The unique index lets
+// each member apply a coupon once.
+type CouponUse struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CouponID  uint      `gorm:"uniqueIndex:idx_coupon_uses_user;not null" json:"coupon_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_coupon_uses_user;index;not null" json:"-"`
+	// Code, Name, Type and Value are copied from the coupon when applied
+	Code  string `gorm:"not null" json:"code" example:"SONGKRAN-7K3QMX2PAB"`
+	Name  string `json:"name" example:"Songkran bonus"`
+	Type  string `gorm:"not null" json:"type" example:"points"`
+	Value int    `json:"value" example:"100"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" validate:"required,max=64" example:"SONGKRAN-7K3QMX2PAB"`
+}
+
+// ApplyCouponResponse is returned by POST /coupons/apply.
+type ApplyCouponResponse struct {
+	Use CouponUse `json:"coupon"`
+	// Balance is the member's points balance after applying the coupon
+	Balance int `json:"balance" example:"1600"`
+}
+
+type CreateCouponRequest struct {
+	Code  string `json:"code" validate:"required,max=40" example:"WELCOME10"`
+	Name  string `json:"name" validate:"required,max=100" example:"10% off for new members"`
+	Type  string `json:"type" validate:"required,oneof=points discount" example:"discount"`
+	Value int    `json:"value" validate:"required,min=1" example:"10"`
+	// MaxUses defaults to 0, unlimited
+	MaxUses  int        `json:"max_uses" validate:"min=0" example:"500"`
+	Active   *bool      `json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// GenerateCouponsRequest creates Count coupons with random codes that share
+// the other settings.
+type GenerateCouponsRequest struct {
+	Batch string `json:"batch" validate:"required,max=40" example:"songkran-2026"`
+	// Prefix starts every code, e.g. SONGKRAN-
+	Prefix string `json:"prefix" validate:"max=20" example:"SONGKRAN-"`
+	Count  int    `json:"count" validate:"required,min=1,max=10000" example:"500"`
+	Name   string `json:"name" validate:"required,max=100" example:"Songkran bonus"`
+	Type   string `json:"type" validate:"required,oneof=points discount" example:"points"`
+	Value  int    `json:"value" validate:"required,min=1" example:"100"`
+	// MaxUses defaults to 1, single-use codes
+	MaxUses  *int       `json:"max_uses" validate:"omitempty,min=0" example:"1"`
+	Active   *bool      `json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+type GenerateCouponsResponse struct {
+	Batch string   `json:"batch" example:"songkran-2026"`
+	Codes []string `json:"codes" example:"SONGKRAN-7K3QMX2PAB,SONGKRAN-Q2MZ6T4WXC"`
+}
+
+// UpdateCouponRequest changes the fields present in the body.
+type UpdateCouponRequest struct {
+	Name     *string    `json:"name" validate:"omitempty,max=100"`
+	MaxUses  *int       `json:"max_uses" validate:"omitempty,min=0"`
+	Active   *bool      `json:"active"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Data export statuses. An export is pending until its job has stored the
+// archive, and failed when the job gave up.
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a member's request for a copy of everything the service
+// keeps about them. The archive is deleted, with the export, at ExpiresAt.
+type DataExport struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	Status    string    `gorm:"not null" json:"status" example:"ready"`
+	// JobID is the background job that compiles the archive
+	JobID      string `json:"-"`
+	StorageKey string `json:"-"`
+	// Size is the size of the archive in bytes
+	Size    int64      `json:"size,omitempty" example:"18342"`
+	ReadyAt *time.Time `json:"ready_at,omitempty"`
+	// ExpiresAt is when the archive is deleted
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	// URL downloads the archive, a ZIP of JSON files, while the export is
+	// ready; each request for the export gets a new link valid for 15
+	// minutes
+	URL string `gorm:"-" json:"url,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// DeletedRecord is a soft-deleted row as shown in the admin trash view.
+type DeletedRecord struct {
+	Resource  string    `json:"resource" example:"users"`
+	ID        uint      `json:"id"`
+	Label     string    `json:"label" example:"john@example.com (LBK12345)"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
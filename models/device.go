@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Device is an app installation a user has signed in from. It is keyed by
+// the client-generated X-Device-ID header and kept up to date from the
+// device headers on every authenticated request.
+type Device struct {
+	ID         uint           `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID     uint           `gorm:"uniqueIndex:idx_devices_user_device,where:deleted_at IS NULL;not null" json:"-"`
+	DeviceID   string         `gorm:"uniqueIndex:idx_devices_user_device,where:deleted_at IS NULL;not null" json:"device_id" example:"6f1c2d7e-3b9a-4c55-9e0f-2a4b8c1d5e7f"`
+	Name       string         `json:"name" example:"My iPhone"`
+	Platform   string         `json:"platform" example:"ios"`
+	Model      string         `json:"model" example:"iPhone15,2"`
+	AppVersion string         `json:"app_version" example:"2.4.0"`
+	PushToken  string         `gorm:"index" json:"push_token,omitempty"`
+	LastSeenAt time.Time      `json:"last_seen_at"`
+}
+
+// RegisterDeviceRequest registers the app installation the request comes
+// from, or updates it when the user has it already. DeviceID defaults to the
+// X-Device-ID header.
+type RegisterDeviceRequest struct {
+	DeviceID   string `json:"device_id" example:"6f1c2d7e-3b9a-4c55-9e0f-2a4b8c1d5e7f"`
+	Name       string `json:"name" example:"My iPhone"`
+	Platform   string `json:"platform" example:"ios"`
+	Model      string `json:"model" example:"iPhone15,2"`
+	AppVersion string `json:"app_version" example:"2.4.0"`
+	// PushToken is the FCM registration token; empty for no notifications
+	PushToken string `json:"push_token" example:"dQw4w9WgXcQ:APA91bH..."`
+}
+
+// UpdateDeviceRequest changes only the fields that are present.
+type UpdateDeviceRequest struct {
+	Name      *string `json:"name" example:"Work phone"`
+	PushToken *string `json:"push_token"`
+}
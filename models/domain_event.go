@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Types of domain events. A member's stream starts with MemberJoined;
+// each points transaction appends the event of its type and each change of
+// tier a TierChanged.
+const (
+	EventMemberJoined   = "MemberJoined"
+	EventPointsEarned   = "PointsEarned"
+	EventPointsRedeemed = "PointsRedeemed"
+	EventPointsAdjusted = "PointsAdjusted"
+	EventPointsExpired  = "PointsExpired"
+	EventTierChanged    = "TierChanged"
+)
+
+// DomainEvent is one event of a member's stream in the event store.
+// Version numbers the events of a member from 1 without gaps; users.points
+// and users.member_level are the projection of the stream.
+type DomainEvent struct {
+	ID         uint            `gorm:"primarykey" json:"id"`
+	UserID     uint            `gorm:"uniqueIndex:idx_domain_events_stream;not null" json:"-"`
+	Version    int             `gorm:"uniqueIndex:idx_domain_events_stream;not null" json:"version" example:"3"`
+	Type       string          `gorm:"not null" json:"type" example:"PointsEarned"`
+	OccurredAt time.Time       `gorm:"index;not null" json:"occurred_at"`
+	Data       DomainEventData `gorm:"serializer:json" json:"data"`
+}
+
+// DomainEventData is what happened, with the fields of the event's type.
+type DomainEventData struct {
+	// Points is the opening balance of MemberJoined
+	Points int `json:"points,omitempty"`
+	// Amount is the signed change of a points event
+	Amount int `json:"amount,omitempty" example:"120"`
+	// TransactionID is the ledger entry of a points event
+	TransactionID uint   `json:"transaction_id,omitempty" example:"42"`
+	FromTier      string `json:"from_tier,omitempty" example:"Silver"`
+	// ToTier is the tier of MemberJoined and TierChanged
+	ToTier    string `json:"to_tier,omitempty" example:"Gold"`
+	Reason    string `json:"reason,omitempty" example:"Purchase #10025"`
+	Reference string `json:"reference,omitempty" example:"partner:3"`
+}
+
+// MemberState is the projection of a member's events up to a time: their
+// balance and tier then, and the version of the last event applied.
+type MemberState struct {
+	At          time.Time `json:"at"`
+	Points      int       `json:"points" example:"1500"`
+	MemberLevel string    `json:"member_level" example:"Silver"`
+	Version     int       `json:"version" example:"12"`
+}
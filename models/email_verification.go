@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// EmailVerification is a single-use token emailed to prove ownership of an
+// address. It only verifies the address it was sent to. Only a hash of the
+// token is stored.
+type EmailVerification struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint      `gorm:"index;not null"`
+	Email      string    `gorm:"not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required" example:"Vw3kR..."`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
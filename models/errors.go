@@ -0,0 +1,20 @@
+package models
+
+// ErrorResponse is the body returned for every failed request. Error is a
+// message for people; Code is stable and meant for clients to branch on.
+// RequestID echoes X-Request-ID.
+type ErrorResponse struct {
+	Error     string      `json:"error" example:"User not found"`
+	Code      string      `json:"code" example:"USER_NOT_FOUND"`
+	Details   interface{} `json:"details,omitempty" swaggertype:"object"`
+	RequestID string      `json:"request_id,omitempty" example:"0b6f1c1e-6d2a-4c59-9a0e-2f1f3c1d7e44"`
+}
+
+// ValidationErrorResponse is returned when one or more request fields are
+// invalid. Fields maps the JSON field name to the reason it was rejected.
+type ValidationErrorResponse struct {
+	Error     string            `json:"error" example:"Validation failed"`
+	Code      string            `json:"code" example:"VALIDATION_FAILED"`
+	Fields    map[string]string `json:"fields"`
+	RequestID string            `json:"request_id,omitempty" example:"0b6f1c1e-6d2a-4c59-9a0e-2f1f3c1d7e44"`
+}
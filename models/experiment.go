@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ExperimentExposure records the first time a user was served a variant of
+// an experiment. Analysis compares outcomes of exposed users by variant.
+type ExperimentExposure struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     uint      `gorm:"uniqueIndex:idx_experiment_exposures_user;not null" json:"user_id"`
+	Experiment string    `gorm:"uniqueIndex:idx_experiment_exposures_user;index;not null" json:"experiment" example:"points_statement_layout"`
+	Variant    string    `gorm:"not null" json:"variant" example:"compact"`
+}
+
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment" example:"points_statement_layout"`
+	Variant    string `json:"variant" example:"compact"`
+}
+
+type ExperimentsResponse struct {
+	Assignments []ExperimentAssignment `json:"assignments"`
+}
+
+type ExperimentVariantSummary struct {
+	Name      string `json:"name" example:"compact"`
+	Weight    int    `json:"weight" example:"50"`
+	Exposures int64  `json:"exposures"`
+}
+
+// ExperimentSummary describes an experiment and how many users were exposed
+// to each variant.
+type ExperimentSummary struct {
+	Key         string                     `json:"key" example:"points_statement_layout"`
+	Description string                     `json:"description"`
+	Active      bool                       `json:"active"`
+	Variants    []ExperimentVariantSummary `json:"variants"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// FeatureFlag turns a client feature on or off for every member without
+// a release.
+type FeatureFlag struct {
+	Key         string    `gorm:"primarykey" json:"key" example:"new_checkout"`
+	Enabled     bool      `gorm:"not null" json:"enabled"`
+	Description string    `json:"description" example:"Show the redesigned checkout"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SetFeatureFlagRequest creates or replaces a feature flag.
+type SetFeatureFlagRequest struct {
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description" validate:"max=200" example:"Show the redesigned checkout"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// DependencyHealth is the result of checking one dependency. Status is ok,
+// degraded, down or not_configured.
+type DependencyHealth struct {
+	Name      string `json:"name" example:"database"`
+	Status    string `json:"status" example:"ok"`
+	LatencyMs int64  `json:"latency_ms"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// RequestStats counts responses over the last few minutes.
+type RequestStats struct {
+	WindowMinutes   int     `json:"window_minutes"`
+	Total           int     `json:"total"`
+	ClientErrors    int     `json:"client_errors"`
+	ServerErrors    int     `json:"server_errors"`
+	ServerErrorRate float64 `json:"server_error_rate"`
+}
+
+// JobHealth reports when a scheduled or background job last ran.
+type JobHealth struct {
+	Name       string     `json:"name" example:"backup"`
+	Status     string     `json:"status" example:"ok"`
+	LastRunAt  *time.Time `json:"last_run_at"`
+	LastResult string     `json:"last_result,omitempty"`
+}
+
+type HealthDetailsResponse struct {
+	Status       string             `json:"status" example:"ok"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyHealth `json:"dependencies"`
+	Requests     RequestStats       `json:"requests"`
+	Jobs         []JobHealth        `json:"jobs"`
+	Locks        []LockStats        `json:"locks"`
+}
+
+// ProbeResponse answers the liveness and readiness probes. Status is ok,
+// degraded (still serving) or down.
+type ProbeResponse struct {
+	Status string             `json:"status" example:"ok"`
+	Checks []DependencyHealth `json:"checks,omitempty"`
+}
+
+// LockStats counts the locks of one family, such as job for the locks of
+// scheduled jobs, taken by this instance since it started.
+type LockStats struct {
+	Name string `json:"name" example:"job"`
+	// Held is the number held now
+	Held     int   `json:"held" example:"1"`
+	Acquired int64 `json:"acquired" example:"1440"`
+	// Contended counts the attempts that found the lock held elsewhere
+	Contended int64 `json:"contended" example:"3"`
+	// Lost counts the locks that expired while held, e.g. after a pause
+	Lost      int64 `json:"lost" example:"0"`
+	Errors    int64 `json:"errors" example:"0"`
+	AvgHoldMs int64 `json:"avg_hold_ms" example:"820"`
+	MaxHoldMs int64 `json:"max_hold_ms" example:"61200"`
+}
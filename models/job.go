@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Background job statuses. A job is queued until a worker takes it and
+// retrying while it waits for its next attempt after a failure.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobRetrying  = "retrying"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a unit of background work such as an email or a report export,
+// with the outcome of its latest attempt.
+type Job struct {
+	ID          string `json:"id" example:"0b7c6f1e-8f5d-4d3a-9a43-2f1f6c1d7e90"`
+	Type        string `json:"type" example:"report.export"`
+	Status      string `json:"status" example:"succeeded"`
+	Attempts    int    `json:"attempts" example:"1"`
+	MaxAttempts int    `json:"max_attempts" example:"3"`
+	// Error is why the latest attempt failed
+	Error string `json:"error,omitempty"`
+	// Result is what the job produced, e.g. the ReportExportResponse of a
+	// report export
+	Result    json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// RunAt is when a queued or retrying job is due
+	RunAt      *time.Time `json:"run_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobCounts counts the jobs in each status. Queued counts the jobs due now
+// and Retrying those waiting for a later attempt; Succeeded and Failed
+// count the jobs finished since the queue was created.
+type JobCounts struct {
+	Queued    int64 `json:"queued"`
+	Running   int64 `json:"running"`
+	Retrying  int64 `json:"retrying"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+type JobListResponse struct {
+	// Backend is memory (jobs run in the server) or redis (jobs run in
+	// worker processes)
+	Backend string    `json:"backend" example:"redis"`
+	Counts  JobCounts `json:"counts"`
+	// Jobs are the most recent jobs, newest first
+	Jobs []Job `json:"jobs"`
+}
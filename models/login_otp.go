@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LoginOTP is a one-time code sent by SMS to log in with a verified phone
+// number instead of a password. Only a hash of the code is stored.
+type LoginOTP struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint      `gorm:"index;not null"`
+	Phone      string    `gorm:"index;not null"`
+	CodeHash   string    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ConsumedAt *time.Time
+}
+
+type OTPRequest struct {
+	Phone string `json:"phone" validate:"required" example:"081-234-5678"`
+}
+
+type OTPVerifyRequest struct {
+	Phone string `json:"phone" validate:"required" example:"081-234-5678"`
+	Code  string `json:"code" validate:"required,len=6" example:"123456"`
+}
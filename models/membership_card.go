@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// MembershipCardResponse is the digital membership card stores scan from
+// the member's phone.
+type MembershipCardResponse struct {
+	MembershipID string `json:"membership_id" example:"LBK00001"`
+	// Token is the signed content of the QR code; it is only accepted until
+	// ExpiresAt
+	Token     string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresAt time.Time `json:"expires_at"`
+	// QRCode is a PNG image of the QR code, base64-encoded
+	QRCode []byte `json:"qr_png" swaggertype:"string" format:"base64"`
+}
+
+type VerifyCardRequest struct {
+	Token string `json:"token" validate:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// VerifyCardResponse identifies the member whose card was scanned, limited
+// to the fields the partner may see.
+type VerifyCardResponse struct {
+	Member    PartnerMember `json:"member"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
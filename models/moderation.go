@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Moderation item statuses. A pending item waits for its automatic check
+// or, when the check could not run, for an admin; a quarantined one was
+// flagged and its content taken down until an admin approves or rejects it.
+// A withdrawn item was replaced or removed by its owner before the check.
+const (
+	ModerationPending     = "pending"
+	ModerationApproved    = "approved"
+	ModerationQuarantined = "quarantined"
+	ModerationRejected    = "rejected"
+	ModerationWithdrawn   = "withdrawn"
+)
+
+// ModerationKindAvatar is the kind of moderation items for avatars.
+const ModerationKindAvatar = "avatar"
+
+// ModerationItem is a piece of uploaded content going through moderation.
+// Key is where the content is published; once it is quarantined it moves to
+// the private QuarantineKey.
+type ModerationItem struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	UserID        uint      `gorm:"index;not null" json:"user_id" example:"42"`
+	Kind          string    `gorm:"not null" json:"kind" example:"avatar"`
+	Key           string    `gorm:"not null" json:"-"`
+	QuarantineKey string    `json:"-"`
+	Status        string    `gorm:"index;not null;default:pending" json:"status" example:"quarantined"`
+	// Labels are the categories the content was flagged for
+	Labels     []string   `gorm:"serializer:json" json:"labels" example:"adult"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	ReviewedBy string     `json:"reviewed_by,omitempty" example:"user:2"`
+	// PreviewURL links to the content for a few minutes, in the admin view
+	// of a single item
+	PreviewURL string `gorm:"-" json:"preview_url,omitempty"`
+}
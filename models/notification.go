@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification channels a user can set preferences for. SMS costs money
+// per message, so it is off until the user turns it on.
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelPush  = "push"
+	NotificationChannelSMS   = "sms"
+)
+
+// NotificationChannelInApp is the notification center in the app. Users
+// cannot turn it off; only withdrawn marketing consent keeps messages out.
+const NotificationChannelInApp = "in_app"
+
+// Notification categories. Account messages (security alerts, codes,
+// receipts) are always sent; the others can be turned off per channel.
+const (
+	NotificationCategoryAccount   = "account"
+	NotificationCategoryPoints    = "points"
+	NotificationCategoryMarketing = "marketing"
+)
+
+// NotificationPreference stores a user's choice for one channel and
+// category. Without a row the category is enabled.
+type NotificationPreference struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_notification_preferences_user;not null" json:"-"`
+	Channel   string    `gorm:"uniqueIndex:idx_notification_preferences_user;not null" json:"channel" example:"email"`
+	Category  string    `gorm:"uniqueIndex:idx_notification_preferences_user;not null" json:"category" example:"marketing"`
+	Enabled   bool      `json:"enabled"`
+}
+
+// SuppressedAddress is an email address nothing is sent to, after a hard
+// bounce or spam complaint reported by the email provider or by an admin.
+type SuppressedAddress struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Address   string    `gorm:"uniqueIndex;not null" json:"address" example:"user@example.com"`
+	Reason    string    `json:"reason" example:"bounce"`
+	Detail    string    `json:"detail,omitempty" example:"550 5.1.1 mailbox does not exist"`
+}
+
+type NotificationPreferenceItem struct {
+	Channel  string `json:"channel" example:"email"`
+	Category string `json:"category" example:"marketing"`
+	Enabled  bool   `json:"enabled"`
+}
+
+type NotificationPreferencesResponse struct {
+	Preferences []NotificationPreferenceItem `json:"preferences"`
+}
+
+// UpdateNotificationPreferencesRequest changes only the listed channel and
+// category pairs.
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreferenceItem `json:"preferences"`
+}
+
+// UnsubscribeResponse describes the preference an unsubscribe token turns
+// off.
+type UnsubscribeResponse struct {
+	Channel  string `json:"channel" example:"email"`
+	Category string `json:"category" example:"marketing"`
+	Email    string `json:"email" example:"u***@example.com"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// EmailWebhookEvent is one delivery event from the email provider. Hard
+// bounces and complaints suppress the address; soft bounces are ignored.
+type EmailWebhookEvent struct {
+	Event      string `json:"event" example:"bounce"`
+	Email      string `json:"email" example:"user@example.com"`
+	BounceType string `json:"bounce_type,omitempty" example:"hard"`
+	Detail     string `json:"detail,omitempty" example:"550 5.1.1 mailbox does not exist"`
+}
+
+type EmailWebhookResponse struct {
+	Received   int `json:"received"`
+	Suppressed int `json:"suppressed"`
+}
+
+type CreateSuppressionRequest struct {
+	Address string `json:"address" example:"user@example.com"`
+	Detail  string `json:"detail" example:"requested by phone"`
+}
+
+// Notification is a message in a user's notification center. Features
+// create them through notify.Inbox, usually next to an email or push.
+type Notification struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+	// DeletedAt marks pruned notifications, kept as sync tombstones until
+	// sync.tombstone_retention_days have passed
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID    uint           `gorm:"index:idx_notifications_user_read;not null" json:"-"`
+	Category  string         `gorm:"not null" json:"category" example:"points"`
+	Title     string         `gorm:"not null" json:"title" example:"Welcome to Gold"`
+	Body      string         `json:"body" example:"Congratulations, you are now a Gold member. See your new benefits in the app."`
+	// ReadAt is when the user read the notification, null while unread
+	ReadAt *time.Time `gorm:"index:idx_notifications_user_read" json:"read_at"`
+}
+
+// NotificationPage is a page of the notification center with the unread
+// counts, which ignore the filters.
+type NotificationPage struct {
+	PagedResponse
+	Unread int64 `json:"unread" example:"3"`
+	// UnreadByCategory counts the unread notifications of each category
+	// that has any
+	UnreadByCategory map[string]int64 `json:"unread_by_category"`
+}
+
+type MarkAllNotificationsReadResponse struct {
+	// Updated is the number of notifications that were unread
+	Updated int64 `json:"updated" example:"3"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// PagedResponse is one page of a list endpoint. Items holds the records of
+// the page; Total counts every record matching the filters and Pages is the
+// number of pages of Limit records they fill.
+type PagedResponse struct {
+	Items interface{} `json:"items" swaggertype:"array,object"`
+	Total int64       `json:"total" example:"42"`
+	Page  int         `json:"page" example:"1"`
+	Pages int         `json:"pages" example:"3"`
+	Limit int         `json:"limit" example:"20"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// PartnerPlanStandard is the plan of partners not given another; its rate
+// limit is rate_limit.partner.
+const PartnerPlanStandard = "standard"
+
+// Partner is a merchant that looks up members through the partner API with
+// its own API key. Only a hash of the key is stored.
+type Partner struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"not null" json:"name" example:"Coffee Corner"`
+	KeyHash   string    `gorm:"uniqueIndex;not null" json:"-"`
+	// KeyPrefix identifies the key in listings without revealing it
+	KeyPrefix string   `json:"key_prefix" example:"pk_3fZ9qL"`
+	Scopes    []string `gorm:"serializer:json" json:"scopes" example:"members:read"`
+	// VisibleFields are the optional member fields this partner may see
+	VisibleFields []string `gorm:"serializer:json" json:"visible_fields" example:"member_level,earn_multiplier,points_eligible"`
+	// Plan sets the partner's rate limit: standard, or a plan of
+	// rate_limit.plans
+	Plan       string     `gorm:"not null;default:standard" json:"plan" example:"premium"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type CreatePartnerRequest struct {
+	Name          string   `json:"name" example:"Coffee Corner"`
+	Scopes        []string `json:"scopes" example:"members:read"`
+	VisibleFields []string `json:"visible_fields" example:"member_level,earn_multiplier,points_eligible"`
+	// Plan defaults to standard
+	Plan string `json:"plan" example:"premium"`
+}
+
+// UpdatePartnerRequest changes only the fields present in the body.
+type UpdatePartnerRequest struct {
+	Plan *string `json:"plan" example:"premium"`
+}
+
+// CreatePartnerResponse is the only time the API key is shown.
+type CreatePartnerResponse struct {
+	Partner Partner `json:"partner"`
+	APIKey  string  `json:"api_key" example:"pk_3fZ9qLx..."`
+}
+
+// PartnerMember is the minimal member view for partners. Fields the partner
+// is not configured to see are omitted.
+type PartnerMember struct {
+	MembershipID   string   `json:"membership_id" example:"LBK12345"`
+	MemberLevel    string   `json:"member_level,omitempty" example:"Gold"`
+	EarnMultiplier *float64 `json:"earn_multiplier,omitempty" example:"1.5"`
+	PointsEligible *bool    `json:"points_eligible,omitempty"`
+	DisplayName    string   `json:"display_name,omitempty" example:"Somchai J."`
+}
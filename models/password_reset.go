@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// PasswordReset is a single-use token emailed to reset a forgotten
+// password. Only a hash of the token is stored.
+type PasswordReset struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint      `gorm:"index;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required" example:"Vw3kR..."`
+	Password string `json:"password" validate:"required,min=6" example:"new-secret"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PendingEvent is a domain event waiting to be published to the message
+// broker. Rows are written in the transaction of the change and deleted
+// once the broker has the event, so the table only holds events the broker
+// has not accepted yet.
+type PendingEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	EventID   string    `gorm:"not null"`
+	Event     string    `gorm:"not null"`
+	Payload   string    `gorm:"not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	// NextAttemptAt is when the event is tried next
+	NextAttemptAt time.Time `gorm:"index;not null"`
+	LastError     string
+}
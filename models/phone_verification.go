@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// PhoneVerification is a one-time code sent to prove ownership of a phone
+// number. Only a hash of the code is stored.
+type PhoneVerification struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint      `gorm:"index;not null"`
+	Phone      string    `gorm:"not null"`
+	CodeHash   string    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ConsumedAt *time.Time
+}
+
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" validate:"required,len=6" example:"123456"`
+	// Claim moves the number from another account that has already verified
+	// it, after ownership is proven with the code.
+	Claim bool `json:"claim"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// Types of point transactions. Earn adds points, redeem and expire take them
+// away, and adjust is a correction by an admin in either direction.
+const (
+	PointTransactionEarn   = "earn"
+	PointTransactionRedeem = "redeem"
+	PointTransactionAdjust = "adjust"
+	PointTransactionExpire = "expire"
+)
+
+// PointTransaction is one entry of a user's points ledger. Amount is signed;
+// BalanceAfter is the balance once the entry was applied, which users.points
+// caches for the latest entry.
+//
+// Every credit is also a lot: Remaining is the part not yet spent or expired.
+// Debits use up the lots that expire first. Earned lots expire at ExpiresAt;
+// adjustments and refunds never do.
+type PointTransaction struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	UserID       uint      `gorm:"index;not null" json:"-"`
+	Type         string    `gorm:"not null" json:"type" example:"earn"`
+	Amount       int       `gorm:"not null" json:"amount" example:"100"`
+	BalanceAfter int       `gorm:"not null" json:"balance_after" example:"1600"`
+	Reason       string    `json:"reason" example:"Welcome bonus"`
+	// Reference identifies what caused the entry, e.g. campaign:welcome
+	Reference string `gorm:"index;uniqueIndex:idx_point_transactions_idempotency,where:idempotency_key <> ''" json:"reference,omitempty" example:"campaign:welcome"`
+	// IdempotencyKey is the Idempotency-Key of the request that posted the
+	// entry; it is unique per reference so retries are not credited twice
+	IdempotencyKey string `gorm:"uniqueIndex:idx_point_transactions_idempotency,where:idempotency_key <> ''" json:"-"`
+	Remaining      int    `gorm:"not null;default:0" json:"-"`
+	// ExpiresAt is when the unspent part of an earned lot expires
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	// ExpiryNoticeAt is when the member was told the lot is about to expire
+	ExpiryNoticeAt *time.Time `json:"-"`
+}
+
+// EarnPointsRequest credits a member from a partner's system, e.g. for a
+// purchase at the point of sale.
+type EarnPointsRequest struct {
+	MembershipID string `json:"membership_id" validate:"required" example:"LBK00001"`
+	Amount       int    `json:"amount" validate:"required,min=1,max=100000" example:"120"`
+	// Source describes what the points are for; members see it in their
+	// points history
+	Source string `json:"source" validate:"required,max=100" example:"Purchase #10025 at Coffee Corner Siam"`
+}
+
+// AdjustPointsRequest adds Amount points to a member's balance, or takes
+// them off when negative, as an adjustment in the ledger.
+type AdjustPointsRequest struct {
+	Amount int `json:"amount" validate:"required,min=-1000000,max=1000000" example:"-500"`
+	// Reason is shown to the member in their points history
+	Reason string `json:"reason" validate:"required,max=100" example:"Goodwill credit for a late delivery"`
+}
+
+type EarnPointsResponse struct {
+	MembershipID string           `json:"membership_id" example:"LBK00001"`
+	Transaction  PointTransaction `json:"transaction"`
+}
+
+// BalanceUpdate is an event of GET /profile/points/stream: the balance when
+// the stream opens, then the balance after each new entry of the ledger
+// with the entry.
+type BalanceUpdate struct {
+	Balance     int               `json:"balance" example:"1600"`
+	Transaction *PointTransaction `json:"transaction,omitempty"`
+}
+
+// PointsStatement is the monthly statement of a member's points movements,
+// recorded before it is emailed; the unique period per member keeps it from
+// being sent twice. Redeemed and Expired are positive; Adjusted is the net
+// of admin corrections.
+type PointsStatement struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_points_statements_period;not null" json:"-"`
+	// Period is the month covered, e.g. 2026-09
+	Period   string `gorm:"uniqueIndex:idx_points_statements_period;not null" json:"period" example:"2026-09"`
+	Opening  int    `json:"opening"`
+	Earned   int    `json:"earned"`
+	Redeemed int    `json:"redeemed"`
+	Expired  int    `json:"expired"`
+	Adjusted int    `json:"adjusted"`
+	Closing  int    `json:"closing"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// PointsReconciliation is a run of the nightly job that compares every
+// member's balance with their points ledger. Policy is the
+// points.reconcile_policy it ran with; FinishedAt stays empty when the run
+// failed part way.
+type PointsReconciliation struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Policy     string     `gorm:"not null" json:"policy" example:"flag"`
+	// Members is how many balances were compared
+	Members    int `gorm:"not null;default:0" json:"members" example:"1250"`
+	Mismatches int `gorm:"not null;default:0" json:"mismatches" example:"1"`
+	Fixed      int `gorm:"not null;default:0" json:"fixed" example:"0"`
+	// Details lists the mismatches; only GET
+	// /admin/points/reconciliations/{id} includes them
+	Details []PointsMismatch `gorm:"foreignKey:ReconciliationID" json:"details,omitempty"`
+}
+
+// PointsMismatch is a balance a reconciliation found out of step with the
+// ledger. Balance is users.points, LedgerTotal the sum of the entries and
+// LastBalance the balance after the latest entry; the three agree for a
+// healthy account. Fixed is set when the run corrected users.points to
+// LedgerTotal.
+type PointsMismatch struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	ReconciliationID uint      `gorm:"index;not null" json:"reconciliation_id"`
+	UserID           uint      `gorm:"index;not null" json:"user_id" example:"42"`
+	Balance          int       `gorm:"not null" json:"balance" example:"1500"`
+	LedgerTotal      int       `gorm:"not null" json:"ledger_total" example:"1400"`
+	LastBalance      int       `gorm:"not null" json:"last_balance" example:"1400"`
+	Fixed            bool      `gorm:"not null;default:false" json:"fixed"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Quota is a caller's allowance in the current rate limit window, as also
+// sent in the X-RateLimit-* headers. Limit is 0 when the caller has no
+// limit, and Used counts the request that returned it.
+type Quota struct {
+	// Plan is the member level or partner plan the limit is set for
+	Plan          string     `json:"plan" example:"Platinum"`
+	Limit         int        `json:"limit" example:"600"`
+	WindowSeconds int        `json:"window_seconds" example:"60"`
+	Used          int        `json:"used" example:"12"`
+	Remaining     int        `json:"remaining" example:"588"`
+	ResetAt       *time.Time `json:"reset_at,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Referral statuses. A referral is pending until the referred member
+// verifies their email address.
+const (
+	ReferralPending   = "pending"
+	ReferralCompleted = "completed"
+)
+
+// Referral records a member who registered with another member's referral
+// code. Both are paid the referral bonus once, when it completes.
+type Referral struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReferrerID uint      `gorm:"index;not null" json:"-"`
+	// ReferredID is unique: a member can only be referred once
+	ReferredID  uint       `gorm:"uniqueIndex;not null" json:"-"`
+	Code        string     `gorm:"not null" json:"-"`
+	Status      string     `gorm:"index;not null;default:pending" json:"status" example:"completed"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// ReferrerPoints and ReferredPoints are the bonuses paid on completion
+	ReferrerPoints int `json:"referrer_points" example:"200"`
+	ReferredPoints int `json:"-"`
+}
+
+// ReferralEntry is a member the current user referred, as listed in their
+// referral stats.
+type ReferralEntry struct {
+	ID uint `json:"id"`
+	// DisplayName is the referred member's first name and last initial
+	DisplayName string     `json:"display_name" example:"Somchai J."`
+	Status      string     `json:"status" example:"completed"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// Points is what the current user was paid for this referral
+	Points int `json:"points" example:"200"`
+}
+
+type ReferralStatsResponse struct {
+	ReferralCode string `json:"referral_code" example:"K7QM2XPA"`
+	Pending      int    `json:"pending" example:"1"`
+	Completed    int    `json:"completed" example:"3"`
+	// PointsEarned is the total referral bonus paid to the current user
+	PointsEarned int             `json:"points_earned" example:"600"`
+	Referrals    []ReferralEntry `json:"referrals"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived token exchanged for new access tokens. Each
+// exchange rotates it: the old token is marked used and a new one in the
+// same family is issued. Presenting a used token again means it leaked, and
+// the whole family is revoked. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"index;not null" json:"family_id"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"rt_Vw3k..."`
+}
+
+// TokenResponse is returned by POST /auth/refresh.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int `json:"expires_in" example:"900"`
+}
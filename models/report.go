@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type ReportInfo struct {
+	Name        string `json:"name" example:"daily_registrations"`
+	Description string `json:"description"`
+}
+
+// ReportResponse holds a report as ordered columns and one map per row.
+type ReportResponse struct {
+	Report  string                   `json:"report"`
+	From    string                   `json:"from" example:"2025-09-01"`
+	To      string                   `json:"to" example:"2025-09-30"`
+	Columns []string                 `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// ReportExportResponse links to a stored report export.
+type ReportExportResponse struct {
+	Report string `json:"report" example:"daily_registrations"`
+	From   string `json:"from" example:"2025-09-01"`
+	To     string `json:"to" example:"2025-09-30"`
+	// URL downloads the CSV file until ExpiresAt
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken blacklists an access token by its JWT ID until the token
+// would have expired anyway.
+type RevokedToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	JTI       string    `gorm:"uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reward is an item of the rewards catalog that members redeem points for.
+type Reward struct {
+	ID          uint           `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	Name        string         `gorm:"not null" json:"name" example:"Free coffee"`
+	Description string         `json:"description" example:"Any hot or iced coffee at partner cafes"`
+	// ImageURL points at the picture shown in the catalog, either uploaded
+	// to storage or hosted elsewhere, e.g. on the CDN
+	ImageURL string `json:"image_url" example:"https://cdn.example.com/rewards/coffee.jpg"`
+	// ImageKey is the storage key of an uploaded image, empty for images
+	// hosted elsewhere
+	ImageKey string `json:"-"`
+	// Cost is the price in points
+	Cost int `gorm:"not null" json:"cost" example:"300"`
+	// Stock is the number of redemptions left
+	Stock  int  `gorm:"not null" json:"stock" example:"120"`
+	Active bool `gorm:"not null;default:true" json:"active"`
+}
+
+// Redemption statuses. A redemption is processing until its points are
+// spent, its stock taken and its voucher issued, then pending until it is
+// fulfilled when the member receives the reward, or cancelled, which
+// refunds the points. A redemption that could not be completed is failed,
+// with anything it took given back.
+const (
+	RedemptionProcessing = "processing"
+	RedemptionPending    = "pending"
+	RedemptionFulfilled  = "fulfilled"
+	RedemptionCancelled  = "cancelled"
+	RedemptionFailed     = "failed"
+)
+
+// Redemption records that a member spent points on a reward.
+type Redemption struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	RewardID  uint      `gorm:"index;not null" json:"reward_id"`
+	// RewardName and Points are copied from the reward when it is redeemed
+	RewardName string `json:"reward_name" example:"Free coffee"`
+	Points     int    `gorm:"not null" json:"points" example:"300"`
+	Status     string `gorm:"index;not null" json:"status" example:"pending"`
+	// Code is shown by the member to collect the reward
+	Code string `gorm:"uniqueIndex;not null" json:"code" example:"RD7K3QMX2P"`
+	// VoucherCode is the voucher issued for the reward, when it is
+	// collected with one rather than with Code
+	VoucherCode string     `json:"voucher_code,omitempty" example:"VC8M2KQ7TR4D"`
+	FulfilledAt *time.Time `json:"fulfilled_at"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+}
+
+type CreateRewardRequest struct {
+	Name        string `json:"name" validate:"required,max=100" example:"Free coffee"`
+	Description string `json:"description" validate:"max=500" example:"Any hot or iced coffee at partner cafes"`
+	ImageURL    string `json:"image_url" validate:"omitempty,url,max=500" example:"https://cdn.example.com/rewards/coffee.jpg"`
+	Cost        int    `json:"cost" validate:"required,min=1" example:"300"`
+	Stock       int    `json:"stock" validate:"min=0" example:"120"`
+	Active      *bool  `json:"active"`
+}
+
+// UpdateRewardRequest changes the fields present in the body.
+type UpdateRewardRequest struct {
+	Name        *string `json:"name" validate:"omitempty,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+	// An empty image_url removes the image
+	ImageURL *string `json:"image_url" validate:"omitempty,url,max=500"`
+	Cost     *int    `json:"cost" validate:"omitempty,min=1"`
+	Stock    *int    `json:"stock" validate:"omitempty,min=0"`
+	Active   *bool   `json:"active"`
+}
+
+type UpdateRedemptionRequest struct {
+	Status string `json:"status" validate:"required,oneof=fulfilled cancelled" example:"fulfilled"`
+}
+
+// RedeemResponse is returned by POST /rewards/:id/redeem.
+type RedeemResponse struct {
+	Redemption Redemption `json:"redemption"`
+	// Balance is the member's points balance after the redemption
+	Balance int `json:"balance" example:"1200"`
+}
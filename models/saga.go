@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Saga statuses. A running saga does its steps in order and a compensating
+// one undoes those done, newest first; both wait for NextAttemptAt after a
+// failure. A saga whose compensation gave up is failed and waits for an
+// admin.
+const (
+	SagaRunning      = "running"
+	SagaCompleted    = "completed"
+	SagaCompensating = "compensating"
+	SagaCompensated  = "compensated"
+	SagaFailed       = "failed"
+)
+
+// Saga is the progress of work spanning several steps that commit on their
+// own, such as a redemption, so it can be resumed or undone after a failure.
+type Saga struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Kind      string    `gorm:"index;not null" json:"kind" example:"redemption"`
+	UserID    uint      `gorm:"index;not null" json:"user_id" example:"42"`
+	Status    string    `gorm:"index;not null" json:"status" example:"running"`
+	// Completed counts the steps done and not undone; Step names the one to
+	// do next or, while compensating, to undo next
+	Completed int    `gorm:"not null;default:0" json:"completed" example:"3"`
+	Step      string `json:"step,omitempty" example:"issue_voucher"`
+	// Attempts counts the failures of Step; LastError is the latest
+	Attempts  int    `gorm:"not null;default:0" json:"attempts" example:"2"`
+	LastError string `json:"last_error,omitempty" example:"voucher service: 503 Service Unavailable"`
+	// Failure is why the saga is being undone
+	Failure string `json:"failure,omitempty" example:"reward out of stock"`
+	// NextAttemptAt is when a waiting saga is resumed; while a step runs it
+	// is the end of the runner's lease
+	NextAttemptAt time.Time `gorm:"index;not null" json:"next_attempt_at"`
+	// State is what the steps pass on, e.g. the redemption ID
+	State json.RawMessage `gorm:"serializer:json" json:"state" swaggertype:"object"`
+	// Version changes with every write, so a runner that lost the saga to
+	// another cannot record a step twice
+	Version int `gorm:"not null;default:0" json:"-"`
+}
+
+// CompensateSagaRequest gives up on a running saga.
+type CompensateSagaRequest struct {
+	Reason string `json:"reason" validate:"required,max=200" example:"Voucher partner discontinued the reward"`
+}
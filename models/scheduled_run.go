@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Scheduled run statuses. A run is claimed by the instance that inserted
+// it, queued once its job is enqueued, and running while a worker attempts
+// the job.
+const (
+	ScheduledRunClaimed   = "claimed"
+	ScheduledRunQueued    = "queued"
+	ScheduledRunRunning   = "running"
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+)
+
+// ScheduledRun is one due time of a recurring job. The scheduler's leader
+// inserts the row when the job is due; the unique index on job and due
+// time lets only one instance run it, even while the leader changes.
+type ScheduledRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Job       string    `gorm:"uniqueIndex:idx_scheduled_runs_due,priority:1;not null" json:"job" example:"points.expire"`
+	DueAt     time.Time `gorm:"uniqueIndex:idx_scheduled_runs_due,priority:2;not null" json:"due_at"`
+	// Instance is the host name and process ID of the instance that
+	// claimed the run
+	Instance string `json:"instance" example:"api-7f9c4:12"`
+	// JobID is the background job the run was queued as
+	JobID    string `json:"job_id,omitempty" example:"0b7c6f1e-8f5d-4d3a-9a43-2f1f6c1d7e90"`
+	Status   string `gorm:"index;not null" json:"status" example:"succeeded"`
+	Attempts int    `gorm:"not null;default:0" json:"attempts" example:"1"`
+	// Error is why the latest attempt failed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// RecurringJob is a job the scheduler runs, with its latest run.
+type RecurringJob struct {
+	Name string `json:"name" example:"points.expire"`
+	// Schedule is the cron expression of the job
+	Schedule  string        `json:"schedule" example:"0 2 * * *"`
+	NextRunAt *time.Time    `json:"next_run_at"`
+	LastRun   *ScheduledRun `json:"last_run"`
+}
+
+// SchedulerLease is the lease on running the scheduled jobs. The instance
+// named by Holder is the leader until ExpiresAt; it renews the lease while
+// it runs, and any instance may take it over once it has expired.
+type SchedulerLease struct {
+	Name string `gorm:"primarykey" json:"-"`
+	// Holder is the host name and process ID of the leader
+	Holder     string    `gorm:"not null" json:"holder" example:"api-7f9c4:12"`
+	AcquiredAt time.Time `gorm:"not null" json:"acquired_at"`
+	RenewedAt  time.Time `gorm:"not null" json:"renewed_at"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+}
+
+// SchedulerLeader is the instance that runs the scheduled jobs, as seen by
+// the instance that answers.
+type SchedulerLeader struct {
+	// Instance is the host name and process ID of the instance that answers
+	Instance string `json:"instance" example:"api-7f9c4:12"`
+	// IsLeader is whether the answering instance is the leader
+	IsLeader bool `json:"is_leader"`
+	// Lease is the current lease, null when no instance holds one
+	Lease *SchedulerLease `json:"lease"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// SchemaMigration is a versioned migration with when it was applied, nil
+// while it is pending.
+type SchemaMigration struct {
+	Version   int        `json:"version" example:"4"`
+	Name      string     `json:"name" example:"add_notifications_sync_columns"`
+	AppliedAt *time.Time `json:"applied_at"`
+	// Unknown is set for applied versions this build has no files for,
+	// e.g. after a rollback to an older release
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// SchemaStatus is the migration state of the database.
+type SchemaStatus struct {
+	Driver string `json:"driver" example:"sqlite"`
+	// Version is the newest applied migration, 0 before the first
+	Version int `json:"version" example:"4"`
+	// Latest is the newest migration this build has
+	Latest  int               `json:"latest" example:"4"`
+	Pending []SchemaMigration `json:"pending"`
+	// Migrations lists every known or applied migration in version order
+	Migrations []SchemaMigration `json:"migrations"`
+	// Drift lists the tables and columns of the models missing from the
+	// database, i.e. model changes that came without a migration
+	Drift []string `json:"drift"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// SearchResult is one hit from the admin search. Type, "user" or
+// "transaction", tells clients which resource ID refers to.
+type SearchResult struct {
+	Type string `json:"type" example:"user"`
+	ID   uint   `json:"id"`
+	// UserID is the member a transaction belongs to
+	UserID   uint   `json:"user_id,omitempty"`
+	Title    string `json:"title" example:"John Doe"`
+	Subtitle string `json:"subtitle" example:"john@example.com · LBK12345"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
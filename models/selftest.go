@@ -0,0 +1,13 @@
+package models
+
+type SelfTestStep struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SelfTestResponse struct {
+	Passed bool           `json:"passed"`
+	Steps  []SelfTestStep `json:"steps"`
+}
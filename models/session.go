@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Session is one login: the refresh token family it started and where it
+// came from. Access tokens carry the family ID as their "sid" claim, so
+// revoking the family ends the session at once. Rows are kept after the
+// session ends as the user's login history.
+type Session struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	UserID     uint      `gorm:"index;not null"`
+	FamilyID   string    `gorm:"uniqueIndex;not null"`
+	IP         string
+	UserAgent  string
+	LastSeenAt time.Time
+	LastIP     string
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+// SessionResponse is a session as shown to its user. Active sessions can
+// still be refreshed; Current marks the session of the calling token.
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	LastIP     string    `json:"last_ip" example:"203.0.113.7"`
+	UserAgent  string    `json:"user_agent" example:"LoyaltyApp/2.4.0 (iPhone; iOS 18.1)"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Active     bool      `json:"active"`
+	Current    bool      `json:"current"`
+}
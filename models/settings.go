@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Settings are a user's app preferences. Empty fields have not been set;
+// the API answers with their defaults.
+type Settings struct {
+	// Language is the language of the app and of messages sent to the user
+	Language string `json:"language,omitempty" example:"th"`
+	// Timezone is an IANA time zone name
+	Timezone string `json:"timezone,omitempty" example:"Asia/Bangkok"`
+	// MarketingConsent is null until the user has been asked; false stops
+	// marketing on every channel
+	MarketingConsent *bool `json:"marketing_consent"`
+	// MarketingConsentAt is when MarketingConsent last changed
+	MarketingConsentAt *time.Time `json:"marketing_consent_at"`
+	Theme              string     `json:"theme,omitempty" example:"dark"`
+}
+
+// UserSettings stores a user's settings as one JSON document, so settings
+// can be added without a migration.
+type UserSettings struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"uniqueIndex;not null" json:"-"`
+	Settings  Settings  `gorm:"serializer:json;not null" json:"settings"`
+}
+
+// UpdateSettingsRequest changes the settings present in the body. Unknown
+// settings are rejected.
+type UpdateSettingsRequest struct {
+	Language         *string `json:"language" validate:"omitempty,oneof=en th" example:"th"`
+	Timezone         *string `json:"timezone" validate:"omitempty,max=64" example:"Asia/Bangkok"`
+	MarketingConsent *bool   `json:"marketing_consent"`
+	Theme            *string `json:"theme" validate:"omitempty,oneof=system light dark" example:"dark"`
+}
+
+type SettingsResponse struct {
+	Settings  Settings   `json:"settings"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// Settlement statuses. An open settlement is recalculated and takes
+// adjustments and disputes; a signed-off one is locked.
+const (
+	SettlementOpen      = "open"
+	SettlementSignedOff = "signed_off"
+)
+
+// Settlement dispute statuses.
+const (
+	DisputeOpen     = "open"
+	DisputeAccepted = "accepted"
+	DisputeRejected = "rejected"
+)
+
+// Settlement is what a partner owes for the points it credited members in
+// a calendar month (UTC). Points are the partner's earn entries in the
+// month, Adjusted the net of the adjustments agreed since; the partner is
+// billed for Total, their sum.
+type Settlement struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	PartnerID uint      `gorm:"uniqueIndex:idx_settlements_partner_period;not null" json:"partner_id" example:"3"`
+	// Period is the month covered, e.g. 2026-09
+	Period       string `gorm:"uniqueIndex:idx_settlements_partner_period;index;not null" json:"period" example:"2026-09"`
+	Status       string `gorm:"not null;default:open" json:"status" example:"open"`
+	Transactions int    `gorm:"not null;default:0" json:"transactions" example:"412"`
+	Points       int    `gorm:"not null;default:0" json:"points" example:"48120"`
+	Adjusted     int    `gorm:"not null;default:0" json:"adjusted" example:"-120"`
+	Total        int    `gorm:"not null;default:0" json:"total" example:"48000"`
+	// SignedOffBy is the admin who locked the settlement
+	SignedOffAt *time.Time             `json:"signed_off_at"`
+	SignedOffBy string                 `json:"signed_off_by,omitempty" example:"user:2"`
+	Adjustments []SettlementAdjustment `json:"adjustments,omitempty"`
+	Disputes    []SettlementDispute    `json:"disputes,omitempty"`
+}
+
+// SettlementAdjustment corrects the points of a settlement, by an admin or
+// in accepting a dispute.
+type SettlementAdjustment struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	SettlementID uint      `gorm:"index;not null" json:"-"`
+	Points       int       `gorm:"not null" json:"points" example:"-120"`
+	Reason       string    `gorm:"not null" json:"reason" example:"Order #10025 was refunded"`
+	// DisputeID is the dispute whose acceptance made the adjustment
+	DisputeID *uint  `json:"dispute_id,omitempty" example:"7"`
+	CreatedBy string `gorm:"not null" json:"created_by" example:"user:2"`
+}
+
+// SettlementDispute is a partner's objection to a settlement, optionally to
+// one of its transactions, until an admin accepts or rejects it.
+type SettlementDispute struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	SettlementID  uint      `gorm:"index;not null" json:"-"`
+	TransactionID *uint     `json:"transaction_id,omitempty" example:"9182"`
+	Reason        string    `gorm:"not null" json:"reason" example:"Order #10025 was refunded"`
+	Status        string    `gorm:"not null;default:open" json:"status" example:"open"`
+	// Resolution is the admin's answer once the dispute is decided
+	Resolution string     `json:"resolution,omitempty" example:"Refund confirmed"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy string     `json:"resolved_by,omitempty" example:"user:2"`
+}
+
+// GenerateSettlementsRequest recalculates the settlements of a month.
+type GenerateSettlementsRequest struct {
+	Period string `json:"period" validate:"required" example:"2026-09"`
+}
+
+type CreateSettlementAdjustmentRequest struct {
+	// Points are added to the settlement; negative points credit the partner
+	Points int    `json:"points" validate:"required,min=-10000000,max=10000000" example:"-120"`
+	Reason string `json:"reason" validate:"required,max=200" example:"Order #10025 was refunded"`
+}
+
+type CreateSettlementDisputeRequest struct {
+	// TransactionID names the disputed earn entry, if there is one
+	TransactionID *uint  `json:"transaction_id" example:"9182"`
+	Reason        string `json:"reason" validate:"required,max=500" example:"Order #10025 was refunded"`
+}
+
+// ResolveSettlementDisputeRequest decides a dispute. Accepting it with
+// non-zero Points adjusts the settlement by them.
+type ResolveSettlementDisputeRequest struct {
+	Status     string `json:"status" validate:"required,oneof=accepted rejected" example:"accepted"`
+	Resolution string `json:"resolution" validate:"required,max=500" example:"Refund confirmed"`
+	Points     int    `json:"points" validate:"min=-10000000,max=10000000" example:"-120"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// SMS delivery statuses. Messages are sent once the gateway accepts them and
+// move to delivered or failed when it reports back.
+const (
+	SMSStatusSent      = "sent"
+	SMSStatusDelivered = "delivered"
+	SMSStatusFailed    = "failed"
+)
+
+// What an SMS was sent for.
+const (
+	SMSPurposeLoginCode         = "login_code"
+	SMSPurposePhoneVerification = "phone_verification"
+	SMSPurposeNotification      = "notification"
+)
+
+// SMSMessage records a text message sent to a member, without its text,
+// which may hold a one-time code. The rows count towards the member's hourly
+// limit and are updated by the gateway's delivery callbacks.
+type SMSMessage struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_sms_messages_user" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"index:idx_sms_messages_user;not null" json:"user_id"`
+	Phone     string    `gorm:"not null" json:"phone" example:"+66812345678"`
+	Purpose   string    `gorm:"not null" json:"purpose" example:"login_code"`
+	// Provider is the driver that sent the message, e.g. twilio
+	Provider string `gorm:"index:idx_sms_messages_provider;not null" json:"provider" example:"twilio"`
+	// ProviderID is the gateway's message ID, matched by delivery callbacks
+	ProviderID string `gorm:"index:idx_sms_messages_provider" json:"provider_id,omitempty" example:"SM3f1c9d2e"`
+	Status     string `gorm:"not null" json:"status" example:"delivered"`
+	// Error is why the gateway refused or could not deliver the message
+	Error string `json:"error,omitempty" example:"30003 unreachable handset"`
+}
+
+// SMSWebhookEvent is one delivery report from an SMS aggregator.
+type SMSWebhookEvent struct {
+	MessageID string `json:"message_id" example:"8f2b3c1d"`
+	// Status is delivered, or failed, undelivered, expired or rejected
+	Status string `json:"status" example:"delivered"`
+	Detail string `json:"detail,omitempty" example:"handset unreachable"`
+}
+
+type SMSWebhookResponse struct {
+	Received int `json:"received"`
+	Updated  int `json:"updated"`
+}
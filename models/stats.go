@@ -0,0 +1,29 @@
+package models
+
+// AdminStats are the figures of the loyalty program in each tenant's shard
+// and in total.
+type AdminStats struct {
+	Total TenantStats `json:"total"`
+	// Tenants has a shard per tenant, the server's own first
+	Tenants []TenantStats `json:"tenants"`
+	// Partial is set when a shard could not be read; its figures are left
+	// out of Total
+	Partial bool `json:"partial"`
+}
+
+// TenantStats are the figures of a tenant's shard, or of all of them.
+type TenantStats struct {
+	Tenant string `json:"tenant,omitempty" example:"default"`
+	// Members are the member accounts that are not deleted
+	Members int64 `json:"members" example:"1250"`
+	// MembersByTier counts the members by member level
+	MembersByTier map[string]int64 `json:"members_by_tier"`
+	// Points is the points members hold
+	Points int64 `json:"points" example:"482300"`
+	// PointsEarned and PointsRedeemed are the points earned and redeemed
+	// in the last 30 days
+	PointsEarned   int64 `json:"points_earned_30d" example:"91000"`
+	PointsRedeemed int64 `json:"points_redeemed_30d" example:"40500"`
+	// Error is why the shard could not be read
+	Error string `json:"error,omitempty"`
+}
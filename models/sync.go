@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SyncChange is one record changed since the client's cursor. Deleted
+// changes are tombstones and carry no data.
+type SyncChange struct {
+	Resource  string      `json:"resource" example:"profile"`
+	ID        uint        `json:"id"`
+	Deleted   bool        `json:"deleted"`
+	ChangedAt time.Time   `json:"changed_at"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// SyncResponse lists changes since the requested cursor. Clients store
+// Cursor and send it as ?since= on their next sync.
+type SyncResponse struct {
+	Cursor  string       `json:"cursor" example:"MTc2MDUxMjM0NTY3ODkwMTIzNA"`
+	Changes []SyncChange `json:"changes"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// MemberTier is the configuration of a membership level. User.MemberLevel
+// holds the tier Code.
+type MemberTier struct {
+	ID   uint   `gorm:"primarykey" json:"-"`
+	Code string `gorm:"uniqueIndex;not null" json:"code"`
+	Rank int    `gorm:"not null;default:0" json:"rank"`
+	// MinPoints is the qualifying points a member needs for the tier; members
+	// are placed in the highest-ranked tier they reach
+	MinPoints int `gorm:"not null;default:0" json:"min_points"`
+	// EarnMultiplier is the points earn rate relative to the base tier
+	EarnMultiplier float64                 `gorm:"not null;default:1" json:"earn_multiplier"`
+	Translations   []MemberTierTranslation `gorm:"foreignKey:TierCode;references:Code" json:"-"`
+}
+
+// MemberTierTranslation holds the display copy of a tier for one locale.
+type MemberTierTranslation struct {
+	ID          uint     `gorm:"primarykey" json:"-"`
+	TierCode    string   `gorm:"uniqueIndex:idx_tier_locale;not null" json:"-"`
+	Locale      string   `gorm:"uniqueIndex:idx_tier_locale;not null" json:"locale"`
+	Name        string   `gorm:"not null" json:"name"`
+	Description string   `json:"description"`
+	Benefits    []string `gorm:"serializer:json" json:"benefits"`
+}
+
+// TierContent is a tier's display copy in the caller's language.
+type TierContent struct {
+	Code        string   `json:"code" example:"Gold"`
+	Locale      string   `json:"locale" example:"th"`
+	Name        string   `json:"name" example:"โกลด์"`
+	Description string   `json:"description"`
+	Benefits    []string `json:"benefits"`
+}
+
+// TierChange records a member moving from one tier to another.
+type TierChange struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	FromTier  string    `json:"from" example:"Silver"`
+	ToTier    string    `gorm:"not null" json:"to" example:"Gold"`
+	Upgrade   bool      `json:"upgrade"`
+	// QualifyingPoints are the points the member had earned in the
+	// qualifying period when the tier changed
+	QualifyingPoints int    `json:"qualifying_points" example:"5200"`
+	Reason           string `json:"reason" example:"Points earned"`
+	// NotifiedAt is when the member was told about the change
+	NotifiedAt *time.Time `gorm:"index" json:"-"`
+}
+
+// NextTier is the tier above a member's and the qualifying points it needs.
+type NextTier struct {
+	Code      string `json:"code" example:"Platinum"`
+	MinPoints int    `json:"min_points" example:"15000"`
+}
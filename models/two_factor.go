@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// TwoFactor is a user's authenticator app enrollment. The TOTP secret is
+// stored encrypted. Until EnabledAt is set the enrollment is pending and
+// login does not ask for a code.
+type TwoFactor struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          uint   `gorm:"uniqueIndex;not null"`
+	SecretEncrypted string `gorm:"not null"`
+	EnabledAt       *time.Time
+	// LastUsedStep is the time step of the last accepted code, so a code
+	// cannot be used twice
+	LastUsedStep int64
+	// FailedAttempts counts wrong codes since the last successful one;
+	// too many lock the second factor for a while after LastFailedAt
+	FailedAttempts int
+	LastFailedAt   *time.Time
+}
+
+// RecoveryCode is a single-use code that replaces the authenticator code
+// when the device is lost. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/KBTG%20Loyalty:user@example.com?secret=...&issuer=KBTG+Loyalty"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required" example:"password123"`
+	// Code is an authenticator code or an unused recovery code
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k7d2-9xqa"`
+}
+
+// TwoFactorChallengeResponse is the login answer for accounts with two-factor
+// authentication. The challenge token and a code go to /auth/2fa/verify.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required" example:"true"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in" example:"300"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is an authenticator code or an unused recovery code
+	Code string `json:"code" validate:"required" example:"123456"`
+}
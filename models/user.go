@@ -7,18 +7,73 @@ import (
 )
 
 type User struct {
-	ID            uint           `gorm:"primarykey" json:"id"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
-	Email         string         `gorm:"uniqueIndex;not null" json:"email"`
-	Password      string         `gorm:"not null" json:"-"`
-	FirstName     string         `json:"first_name"`
-	LastName      string         `json:"last_name"`
-	Phone         string         `json:"phone"`
-	MembershipID  string         `gorm:"uniqueIndex" json:"membership_id"`
-	MemberLevel   string         `gorm:"default:Gold" json:"member_level"`
-	Points        int            `gorm:"default:0" json:"points"`
+	ID                   uint           `gorm:"primarykey" json:"id"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
+	Email                string         `gorm:"uniqueIndex:idx_users_email_active,where:deleted_at IS NULL;not null" json:"email"`
+	EmailCanonical       string         `gorm:"uniqueIndex:idx_users_email_canonical_active,where:deleted_at IS NULL AND email_canonical <> ''" json:"-"`
+	EmailVerifiedAt      *time.Time     `json:"email_verified_at"`
+	Password             string         `gorm:"not null" json:"-"`
+	FirstName            string         `json:"first_name"`
+	LastName             string         `json:"last_name"`
+	RomanizedName        string         `json:"romanized_name"`
+	Phone                string         `gorm:"uniqueIndex:idx_users_verified_phone,where:phone_verified_at IS NOT NULL AND deleted_at IS NULL" json:"phone"`
+	PhoneVerifiedAt      *time.Time     `json:"phone_verified_at"`
+	MembershipID         string         `gorm:"uniqueIndex:idx_users_membership_id_active,where:deleted_at IS NULL" json:"membership_id"`
+	ReferralCode         string         `gorm:"uniqueIndex:idx_users_referral_code,where:referral_code <> ''" json:"referral_code"`
+	MemberLevel          string         `gorm:"default:Gold" json:"member_level"`
+	Points               int            `gorm:"default:0" json:"points"`
+	AcceptedTermsVersion string         `json:"accepted_terms_version"`
+	TermsAcceptedAt      *time.Time     `json:"terms_accepted_at"`
+	TokensRevokedAt      *time.Time     `json:"-"`
+	Role                 string         `gorm:"not null;default:member" json:"role"`
+	// SuspendedAt blocks login and every authenticated request until an
+	// admin lifts the suspension
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	AvatarURL        string     `json:"avatar_url"`
+	// AvatarKey is where the avatar is kept in storage
+	AvatarKey string `json:"-"`
+	// PurgeAt is when an account its owner deleted is removed for good; it
+	// can be restored with POST /auth/restore until then
+	PurgeAt *time.Time `gorm:"index" json:"purge_at,omitempty"`
+}
+
+// AfterCreate starts the event stream of a new user, so every way of
+// creating members records it.
+func (u *User) AfterCreate(tx *gorm.DB) error {
+	return tx.Create(&DomainEvent{
+		UserID:     u.ID,
+		Version:    1,
+		Type:       EventMemberJoined,
+		OccurredAt: u.CreatedAt,
+		Data:       DomainEventData{Points: u.Points, ToTier: u.MemberLevel},
+	}).Error
+}
+
+// Roles a user can have. Admin routes require RoleAdmin.
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+// Roles lists the valid values of User.Role.
+var Roles = []string{RoleMember, RoleAdmin}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required" example:"password123"`
+}
+
+type DeleteAccountResponse struct {
+	Message string `json:"message" example:"Account deleted"`
+	// PurgeAt is the deadline for POST /auth/restore
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type RestoreAccountRequest struct {
+	Email    string `json:"email" validate:"required,email" example:"user@example.com"`
+	Password string `json:"password" validate:"required" example:"password123"`
 }
 
 type RegisterRequest struct {
@@ -27,6 +82,14 @@ type RegisterRequest struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	Phone     string `json:"phone"`
+	// RomanizedName is the full name in Latin letters for printed
+	// certificates; it defaults to the name when that is already Latin
+	RomanizedName string `json:"romanized_name" example:"Somchai Jaidee"`
+	// AcceptedTermsVersion records acceptance of the terms shown at sign-up;
+	// it only counts when it matches the current version
+	AcceptedTermsVersion string `json:"accepted_terms_version" example:"2025-10-01"`
+	// ReferralCode is the code of the member who referred the new one
+	ReferralCode string `json:"referral_code" example:"K7QM2XPA"`
 }
 
 type LoginRequest struct {
@@ -35,16 +98,70 @@ type LoginRequest struct {
 }
 
 type UpdateProfileRequest struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Phone     string `json:"phone"`
+	FirstName     string `json:"first_name" validate:"omitempty,max=100"`
+	LastName      string `json:"last_name" validate:"omitempty,max=100"`
+	Phone         string `json:"phone" validate:"omitempty,max=20"`
+	RomanizedName string `json:"romanized_name" validate:"omitempty,max=100"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int  `json:"expires_in" example:"900"`
+	User      User `json:"user"`
 }
 
 type ProfileResponse struct {
 	User User `json:"user"`
 }
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required" example:"old-secret"`
+	NewPassword     string `json:"new_password" validate:"required,min=6" example:"new-secret"`
+	// KeepOtherSessions leaves other devices logged in; by default every
+	// other access and refresh token is revoked
+	KeepOtherSessions bool `json:"keep_other_sessions"`
+}
+
+type AcceptTermsRequest struct {
+	Version string `json:"version" example:"2025-10-01"`
+}
+
+// TermsDetails are the details of the errors asking for the current terms
+// version to be accepted.
+type TermsDetails struct {
+	TermsVersion string `json:"terms_version" example:"2025-10-01"`
+}
+
+// TermsRequiredResponse is returned with 428 Precondition Required until the
+// user accepts Details.TermsVersion through POST /profile/accept-terms.
+type TermsRequiredResponse struct {
+	Error     string       `json:"error" example:"The latest terms of service must be accepted"`
+	Code      string       `json:"code" example:"TERMS_NOT_ACCEPTED"`
+	Details   TermsDetails `json:"details"`
+	RequestID string       `json:"request_id,omitempty" example:"0b6f1c1e-6d2a-4c59-9a0e-2f1f3c1d7e44"`
+}
+
+// AdminUserFields holds the values for PATCH /admin/users/:id. Only fields
+// named in the update mask are applied; a masked field left out of the body
+// is cleared.
+type AdminUserFields struct {
+	Email         string `json:"email"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	RomanizedName string `json:"romanized_name"`
+	Phone         string `json:"phone"`
+	MemberLevel   string `json:"member_level"`
+	Points        int    `json:"points"`
+	Role          string `json:"role" example:"member"`
+}
+
+type AdminUserPatchRequest struct {
+	UpdateMask []string        `json:"update_mask" example:"first_name,phone"`
+	User       AdminUserFields `json:"user"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason" validate:"required" example:"Chargeback fraud under investigation"`
+}
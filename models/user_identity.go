@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity links an account at an external identity provider to a user,
+// keyed by the provider's stable subject ID rather than the email address,
+// which can change on either side. A user has at most one account per
+// provider.
+type UserIdentity struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID    uint           `gorm:"uniqueIndex:idx_user_identities_user_provider,where:deleted_at IS NULL;not null" json:"-"`
+	Provider  string         `gorm:"uniqueIndex:idx_user_identities_provider_subject,where:deleted_at IS NULL;uniqueIndex:idx_user_identities_user_provider,where:deleted_at IS NULL;not null" json:"provider" example:"google"`
+	Subject   string         `gorm:"uniqueIndex:idx_user_identities_provider_subject,where:deleted_at IS NULL;not null" json:"-"`
+	Email     string         `json:"email" example:"user@gmail.com"`
+}
+
+// IdentitiesResponse lists the provider accounts linked to the current user
+// and the providers that can be linked.
+type IdentitiesResponse struct {
+	Identities []UserIdentity `json:"identities"`
+	Providers  []string       `json:"providers" example:"google,line"`
+}
+
+// AuthorizationURLResponse is the provider page the browser has to open to
+// continue.
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://accounts.google.com/o/oauth2/v2/auth?..."`
+}
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// WalletCurrency is the currency of every wallet. Amounts are in satang,
+// 1/100 of a baht.
+const WalletCurrency = "THB"
+
+// Wallet system accounts. Funding is where top-ups come from, so its balance
+// is minus the money paid in; spending receives wallet payments.
+const (
+	WalletAccountFunding  = "funding"
+	WalletAccountSpending = "spending"
+)
+
+// Wallet transaction types.
+const (
+	WalletTopUp    = "topup"
+	WalletPayment  = "payment"
+	WalletTransfer = "transfer"
+)
+
+// WalletAccount is a member's stored-value wallet, or a system account when
+// UserID is nil. Balance is the balance after the account's latest entry.
+type WalletAccount struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    *uint     `gorm:"uniqueIndex" json:"-"`
+	// Code names a system account
+	Code     string `gorm:"uniqueIndex:idx_wallet_accounts_code,where:code <> ''" json:"-"`
+	Currency string `gorm:"not null" json:"currency" example:"THB"`
+	Balance  int    `gorm:"not null;default:0" json:"balance" example:"25000"`
+}
+
+// WalletTransaction moves Amount between wallet accounts. Its entries, one
+// per account, add up to zero.
+type WalletTransaction struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Type      string    `gorm:"not null" json:"type" example:"transfer"`
+	Amount    int       `gorm:"not null" json:"amount" example:"15000"`
+	// Description is shown in the statements of both sides
+	Description string `json:"description" example:"Dinner"`
+	// Reference is the gateway charge of a top-up or the recipient's
+	// membership ID of a transfer
+	Reference string `json:"reference,omitempty" example:"mock_12"`
+	// InitiatorID is the member who asked for the transaction
+	InitiatorID uint `gorm:"not null;uniqueIndex:idx_wallet_transactions_idempotency,where:idempotency_key <> ''" json:"-"`
+	// IdempotencyKey is unique per initiator so a retried request moves the
+	// money once
+	IdempotencyKey string `gorm:"uniqueIndex:idx_wallet_transactions_idempotency,where:idempotency_key <> ''" json:"-"`
+}
+
+// WalletEntry is one side of a wallet transaction: a signed change to one
+// account's balance. Type is copied from the transaction for statements;
+// the Description of a transfer names the other member.
+type WalletEntry struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+	TransactionID uint      `gorm:"index;not null" json:"transaction_id"`
+	AccountID     uint      `gorm:"index;not null" json:"-"`
+	Type          string    `gorm:"not null" json:"type" example:"transfer"`
+	Description   string    `json:"description" example:"Transfer to LBK00002: Dinner"`
+	Amount        int       `gorm:"not null" json:"amount" example:"-15000"`
+	BalanceAfter  int       `gorm:"not null" json:"balance_after" example:"10000"`
+}
+
+type WalletTopUpRequest struct {
+	// Amount is in satang
+	Amount int `json:"amount" validate:"required,min=100" example:"50000"`
+}
+
+type WalletPaymentRequest struct {
+	Amount      int    `json:"amount" validate:"required,min=1" example:"12000"`
+	Description string `json:"description" validate:"required,max=100" example:"Coffee Corner Siam"`
+}
+
+type WalletTransferRequest struct {
+	// MembershipID is the recipient's
+	MembershipID string `json:"membership_id" validate:"required" example:"LBK00002"`
+	Amount       int    `json:"amount" validate:"required,min=1" example:"15000"`
+	Description  string `json:"description" validate:"max=100" example:"Dinner"`
+}
+
+// WalletTransactionResponse is returned by the wallet operations.
+type WalletTransactionResponse struct {
+	Transaction WalletTransaction `json:"transaction"`
+	// Balance is the member's wallet balance after the transaction
+	Balance int `json:"balance" example:"10000"`
+}
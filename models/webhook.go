@@ -0,0 +1,112 @@
+package models
+
+import "time"
+
+// Events integrators can subscribe webhook endpoints to.
+const (
+	WebhookEventUserRegistered = "user.registered"
+	WebhookEventPointsEarned   = "points.earned"
+	WebhookEventRewardRedeemed = "reward.redeemed"
+)
+
+// WebhookEvents lists the valid events of WebhookEndpoint.Events.
+var WebhookEvents = []string{WebhookEventUserRegistered, WebhookEventPointsEarned, WebhookEventRewardRedeemed}
+
+// Webhook delivery statuses. A delivery is pending until the endpoint
+// accepts it with a 2xx response, or failed once every attempt was refused.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is an integrator's URL that is posted the events it
+// subscribes to, signed with its secret.
+type WebhookEndpoint struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	URL         string    `gorm:"not null" json:"url" example:"https://crm.example.com/hooks/loyalty"`
+	Description string    `json:"description" example:"CRM sync"`
+	Events      []string  `gorm:"serializer:json" json:"events" example:"user.registered,points.earned"`
+	// Secret signs the deliveries; it is kept in full because signing needs
+	// it, and only shown when the endpoint is created
+	Secret string `gorm:"not null" json:"-"`
+	// SecretPrefix identifies the secret in listings without revealing it
+	SecretPrefix string `json:"secret_prefix" example:"whsec_3fZ9"`
+	// Inactive endpoints are sent nothing; deliveries already made for them
+	// are kept
+	Active bool `gorm:"not null;default:true" json:"active"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one endpoint, with
+// the outcome of the latest attempt.
+type WebhookDelivery struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	EndpointID uint      `gorm:"index;not null" json:"endpoint_id"`
+	// EventID is the X-Webhook-ID header, the same for every endpoint the
+	// event is sent to, so receivers can ignore repeats
+	EventID string `gorm:"index;not null" json:"event_id" example:"evt_9f86d081884c7d659a2feaa0c55ad015"`
+	Event   string `gorm:"not null" json:"event" example:"points.earned"`
+	// Payload is the JSON body posted to the endpoint
+	Payload  string `gorm:"not null" json:"payload"`
+	Status   string `gorm:"index:idx_webhook_deliveries_due,priority:1;not null" json:"status" example:"succeeded"`
+	Attempts int    `gorm:"not null;default:0" json:"attempts" example:"1"`
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt *time.Time `gorm:"index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at"`
+	// ResponseStatus is the HTTP status of the latest attempt, 0 when the
+	// endpoint could not be reached
+	ResponseStatus int        `json:"response_status" example:"200"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,url,max=500" example:"https://crm.example.com/hooks/loyalty"`
+	Description string   `json:"description" validate:"max=200" example:"CRM sync"`
+	Events      []string `json:"events" validate:"required" example:"user.registered,points.earned"`
+	Active      *bool    `json:"active"`
+}
+
+// UpdateWebhookRequest changes the fields present in the body.
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url" validate:"omitempty,url,max=500"`
+	Description *string  `json:"description" validate:"omitempty,max=200"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+// CreateWebhookResponse is the only time the signing secret is shown.
+type CreateWebhookResponse struct {
+	Endpoint WebhookEndpoint `json:"endpoint"`
+	Secret   string          `json:"secret" example:"whsec_3fZ9qLx..."`
+}
+
+// Event is a domain event as posted to webhook endpoints and published to
+// the message broker. Data depends on the event: WebhookUserData for
+// user.registered, WebhookPointsData for points.earned and the Redemption
+// for reward.redeemed.
+type Event struct {
+	ID        string      `json:"id" example:"evt_9f86d081884c7d659a2feaa0c55ad015"`
+	Event     string      `json:"event" example:"points.earned"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookUserData is the data of user.registered.
+type WebhookUserData struct {
+	UserID       uint   `json:"user_id" example:"42"`
+	MembershipID string `json:"membership_id" example:"LBK00042"`
+	Email        string `json:"email" example:"somchai@example.com"`
+	FirstName    string `json:"first_name" example:"Somchai"`
+	LastName     string `json:"last_name" example:"Jaidee"`
+	MemberLevel  string `json:"member_level" example:"Gold"`
+}
+
+// WebhookPointsData is the data of points.earned.
+type WebhookPointsData struct {
+	UserID      uint             `json:"user_id" example:"42"`
+	Transaction PointTransaction `json:"transaction"`
+}
@@ -0,0 +1,120 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// VisionEndpoint is the image annotation API of Google Cloud Vision.
+const VisionEndpoint = "https://vision.googleapis.com/v1/images:annotate"
+
+// likelihoods ranks the likelihoods SafeSearch reports.
+var likelihoods = map[string]int{
+	"UNKNOWN":       0,
+	"VERY_UNLIKELY": 1,
+	"UNLIKELY":      2,
+	"POSSIBLE":      3,
+	"LIKELY":        4,
+	"VERY_LIKELY":   5,
+}
+
+// Vision checks images with Cloud Vision SafeSearch and flags those rated
+// adult, violent or racy at Threshold or above.
+type Vision struct {
+	APIKey string
+	// Threshold is the lowest likelihood that flags an image, e.g. LIKELY.
+	Threshold string
+	Endpoint  string
+	client    *http.Client
+}
+
+// NewVision returns a Vision checker for the API key.
+func NewVision(apiKey, threshold string) *Vision {
+	return &Vision{
+		APIKey:    apiKey,
+		Threshold: threshold,
+		Endpoint:  VisionEndpoint,
+		client:    httpClient(),
+	}
+}
+
+type visionRequest struct {
+	Requests []visionImageRequest `json:"requests"`
+}
+
+type visionImageRequest struct {
+	Image    visionImage     `json:"image"`
+	Features []visionFeature `json:"features"`
+}
+
+type visionImage struct {
+	Content string `json:"content"`
+}
+
+type visionFeature struct {
+	Type string `json:"type"`
+}
+
+type visionResponse struct {
+	Responses []struct {
+		SafeSearch map[string]string `json:"safeSearchAnnotation"`
+		Error      *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"responses"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (v *Vision) CheckImage(ctx context.Context, contentType string, image []byte) (Verdict, error) {
+	body, err := json.Marshal(visionRequest{Requests: []visionImageRequest{{
+		Image:    visionImage{Content: base64.StdEncoding.EncodeToString(image)},
+		Features: []visionFeature{{Type: "SAFE_SEARCH_DETECTION"}},
+	}}})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Endpoint+"?key="+url.QueryEscape(v.APIKey), bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation: vision: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result visionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return Verdict{}, fmt.Errorf("moderation: vision: reading the response: %w", err)
+	}
+	switch {
+	case resp.StatusCode >= 300 && result.Error != nil:
+		return Verdict{}, fmt.Errorf("moderation: vision: %s: %s", resp.Status, result.Error.Message)
+	case resp.StatusCode >= 300:
+		return Verdict{}, fmt.Errorf("moderation: vision: %s", resp.Status)
+	case len(result.Responses) == 0:
+		return Verdict{}, fmt.Errorf("moderation: vision: empty response")
+	case result.Responses[0].Error != nil:
+		return Verdict{}, fmt.Errorf("moderation: vision: %s", result.Responses[0].Error.Message)
+	}
+
+	var verdict Verdict
+	threshold := likelihoods[v.Threshold]
+	for _, label := range []string{"adult", "violence", "racy"} {
+		if likelihoods[result.Responses[0].SafeSearch[label]] >= threshold {
+			verdict.Flagged = true
+			verdict.Labels = append(verdict.Labels, label)
+		}
+	}
+	return verdict, nil
+}
@@ -0,0 +1,54 @@
+// Package normalize converts user input such as emails into the canonical
+// forms used for storage and lookups.
+package normalize
+
+import (
+	"strings"
+)
+
+// Domains whose mailboxes ignore dots in the local part.
+var dotInsensitiveDomains = map[string]string{
+	"gmail.com":      "gmail.com",
+	"googlemail.com": "gmail.com",
+}
+
+// Email trims and lower-cases an address. This is the form that is stored
+// and that mail is sent to.
+func Email(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// foldAliases is the fold_email_aliases setting given to Init.
+var foldAliases bool
+
+// Init sets whether CanonicalEmail folds aliases into one account.
+func Init(foldEmailAliases bool) {
+	foldAliases = foldEmailAliases
+}
+
+// CanonicalEmail returns the key that identifies an account. It is Email(s)
+// and, with fold_email_aliases set, additionally drops a "+tag" from the
+// local part and, for Gmail, the dots in the local part, so
+// "John.Doe+news@googlemail.com" and "johndoe@gmail.com" are one account.
+func CanonicalEmail(s string) string {
+	email := Email(s)
+	if !foldAliases {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if canonicalDomain, ok := dotInsensitiveDomains[domain]; ok {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = canonicalDomain
+	}
+
+	return local + "@" + domain
+}
@@ -0,0 +1,61 @@
+package normalize
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxNameLength = 100
+
+var (
+	ErrNameCharacters = errors.New("may only contain letters, spaces, hyphens, apostrophes and periods")
+	ErrNameTooLong    = errors.New("must be at most 100 characters")
+	ErrNameNotLatin   = errors.New("must be written in Latin letters")
+)
+
+// Name NFC-normalizes a person's name and collapses runs of whitespace into
+// single spaces. Letters and combining marks of any script are accepted, so
+// Thai vowel and tone marks pass; digits, symbols, emoji and control or
+// zero-width characters are rejected.
+func Name(s string) (string, error) {
+	name := strings.Join(strings.Fields(norm.NFC.String(s)), " ")
+
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.Is(unicode.Mn, r), unicode.Is(unicode.Mc, r):
+		case r == ' ' || r == '-' || r == '\'' || r == '’' || r == '.':
+		default:
+			return "", ErrNameCharacters
+		}
+	}
+	if len([]rune(name)) > maxNameLength {
+		return "", ErrNameTooLong
+	}
+	return name, nil
+}
+
+// RomanizedName validates a name like Name and additionally requires every
+// letter to be in the Latin script, as used on printed certificates.
+func RomanizedName(s string) (string, error) {
+	name, err := Name(s)
+	if err != nil {
+		return "", err
+	}
+	if !IsLatin(name) {
+		return "", ErrNameNotLatin
+	}
+	return name, nil
+}
+
+// IsLatin reports whether every letter in s is in the Latin script.
+func IsLatin(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+	}
+	return true
+}
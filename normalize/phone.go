@@ -0,0 +1,122 @@
+package normalize
+
+import (
+	"errors"
+	"strings"
+)
+
+// PhoneType classifies a number by the Thai numbering plan.
+type PhoneType string
+
+const (
+	PhoneMobile   PhoneType = "mobile"
+	PhoneLandline PhoneType = "landline"
+	// PhoneOther is a valid international number outside Thailand whose
+	// type cannot be determined.
+	PhoneOther PhoneType = "other"
+)
+
+const thaiCountryCode = "66"
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// Phone is a parsed phone number in E.164 form, e.g. "+66812345678".
+type Phone struct {
+	E164 string
+	Type PhoneType
+}
+
+// ParsePhone converts Thai local formats ("081-234-5678", "02 123 4567") and
+// international formats ("+66 81 234 5678", "+1 415 555 0100") to E.164.
+// The international prefix may be written 00 instead of +, a Thai number may
+// keep its trunk 0 after the country code ("+66 (0)81 234 5678"), and Thai
+// digits are read as their Arabic equivalents. Numbers without a country
+// code are treated as Thai.
+func ParsePhone(input string) (Phone, error) {
+	s := strings.TrimSpace(input)
+	international := strings.HasPrefix(s, "+")
+	if international {
+		s = s[1:]
+	}
+
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= '๐' && r <= '๙':
+			digits.WriteRune('0' + r - '๐')
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return Phone{}, ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international, number = true, number[2:]
+	}
+
+	switch {
+	case international && strings.HasPrefix(number, thaiCountryCode):
+		return parseThaiNational(strings.TrimPrefix(number[len(thaiCountryCode):], "0"))
+	case international:
+		// E.164 allows at most 15 digits including the country code
+		if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+			return Phone{}, ErrInvalidPhone
+		}
+		return Phone{E164: "+" + number, Type: PhoneOther}, nil
+	case strings.HasPrefix(number, "0"):
+		return parseThaiNational(number[1:])
+	case strings.HasPrefix(number, thaiCountryCode) && (len(number) == 10 || len(number) == 11):
+		// "66812345678" typed without the plus sign
+		return parseThaiNational(number[len(thaiCountryCode):])
+	default:
+		return Phone{}, ErrInvalidPhone
+	}
+}
+
+// parseThaiNational validates a Thai national significant number (without
+// the trunk prefix 0): 9 digits starting 6, 8 or 9 for mobiles, 8 digits
+// starting 2-5 or 7 for landlines.
+func parseThaiNational(nsn string) (Phone, error) {
+	if nsn == "" {
+		return Phone{}, ErrInvalidPhone
+	}
+
+	switch {
+	case len(nsn) == 9 && strings.ContainsRune("689", rune(nsn[0])):
+		return Phone{E164: "+" + thaiCountryCode + nsn, Type: PhoneMobile}, nil
+	case len(nsn) == 8 && strings.ContainsRune("23457", rune(nsn[0])):
+		return Phone{E164: "+" + thaiCountryCode + nsn, Type: PhoneLandline}, nil
+	default:
+		return Phone{}, ErrInvalidPhone
+	}
+}
+
+// FormatPhone renders a stored E.164 number for display. Thai numbers use the
+// national format for the "th" locale ("081-234-5678") and the international
+// format otherwise ("+66 81 234 5678"). Other numbers are returned as is.
+func FormatPhone(e164, locale string) string {
+	prefix := "+" + thaiCountryCode
+	if !strings.HasPrefix(e164, prefix) {
+		return e164
+	}
+	nsn := e164[len(prefix):]
+
+	var groups []string
+	switch {
+	case len(nsn) == 9:
+		groups = []string{nsn[:2], nsn[2:5], nsn[5:]}
+	case len(nsn) == 8 && nsn[0] == '2':
+		groups = []string{nsn[:1], nsn[1:4], nsn[4:]}
+	case len(nsn) == 8:
+		groups = []string{nsn[:2], nsn[2:5], nsn[5:]}
+	default:
+		return e164
+	}
+
+	if locale == "th" {
+		return "0" + strings.Join(groups, "-")
+	}
+	return prefix + " " + strings.Join(groups, " ")
+}
@@ -0,0 +1,118 @@
+package normalize
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePhone(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantE164 string
+		wantType PhoneType
+		wantErr  error
+	}{
+		// Thai mobiles
+		{name: "mobile local", input: "0812345678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile local dashes", input: "081-234-5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile local dots", input: "081.234.5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile local spaces", input: " 081 234 5678 ", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile 06", input: "062-345-6789", wantE164: "+66623456789", wantType: PhoneMobile},
+		{name: "mobile 09", input: "0912345678", wantE164: "+66912345678", wantType: PhoneMobile},
+		{name: "mobile international", input: "+66812345678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile international spaces", input: "+66 81 234 5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile international parentheses", input: "+66 (81) 234-5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile international trunk zero", input: "+66 (0)81 234 5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile 00 prefix", input: "0066 81 234 5678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile without plus", input: "66812345678", wantE164: "+66812345678", wantType: PhoneMobile},
+		{name: "mobile Thai digits", input: "๐๘๑-๒๓๔-๕๖๗๘", wantE164: "+66812345678", wantType: PhoneMobile},
+
+		// Thai landlines
+		{name: "Bangkok local", input: "02 123 4567", wantE164: "+6621234567", wantType: PhoneLandline},
+		{name: "Bangkok local dashes", input: "02-123-4567", wantE164: "+6621234567", wantType: PhoneLandline},
+		{name: "Bangkok international", input: "+66 2 123 4567", wantE164: "+6621234567", wantType: PhoneLandline},
+		{name: "Bangkok without plus", input: "6621234567", wantE164: "+6621234567", wantType: PhoneLandline},
+		{name: "Chiang Mai local", input: "053-123-456", wantE164: "+6653123456", wantType: PhoneLandline},
+		{name: "Phuket international", input: "+66 76 123 456", wantE164: "+6676123456", wantType: PhoneLandline},
+
+		// Numbers outside Thailand
+		{name: "United States", input: "+1 415 555 0100", wantE164: "+14155550100", wantType: PhoneOther},
+		{name: "United States parentheses", input: "+1 (415) 555-0100", wantE164: "+14155550100", wantType: PhoneOther},
+		{name: "United Kingdom", input: "+44 20 7946 0958", wantE164: "+442079460958", wantType: PhoneOther},
+		{name: "Japan 00 prefix", input: "0081 3 1234 5678", wantE164: "+81312345678", wantType: PhoneOther},
+		{name: "longest", input: "+123456789012345", wantE164: "+123456789012345", wantType: PhoneOther},
+
+		// Invalid input
+		{name: "empty", input: "", wantErr: ErrInvalidPhone},
+		{name: "only separators", input: " - ( ) ", wantErr: ErrInvalidPhone},
+		{name: "plus alone", input: "+", wantErr: ErrInvalidPhone},
+		{name: "letters", input: "081-234-567a", wantErr: ErrInvalidPhone},
+		{name: "extension", input: "02 123 4567 ext 12", wantErr: ErrInvalidPhone},
+		{name: "plus inside", input: "081+2345678", wantErr: ErrInvalidPhone},
+		{name: "two pluses", input: "++66812345678", wantErr: ErrInvalidPhone},
+		{name: "mobile too short", input: "081234567", wantErr: ErrInvalidPhone},
+		{name: "mobile too long", input: "08123456789", wantErr: ErrInvalidPhone},
+		{name: "landline too long", input: "02-123-45678", wantErr: ErrInvalidPhone},
+		{name: "Thai leading 1", input: "0112345678", wantErr: ErrInvalidPhone},
+		{name: "Thai international too short", input: "+66 81 234 567", wantErr: ErrInvalidPhone},
+		{name: "no country code or trunk zero", input: "812345678", wantErr: ErrInvalidPhone},
+		{name: "foreign too short", input: "+1 415 555", wantErr: ErrInvalidPhone},
+		{name: "foreign too long", input: "+1234567890123456", wantErr: ErrInvalidPhone},
+		{name: "country code zero", input: "+0 415 555 0100", wantErr: ErrInvalidPhone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phone, err := ParsePhone(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePhone(%q) error %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if phone.E164 != tt.wantE164 || phone.Type != tt.wantType {
+				t.Errorf("ParsePhone(%q) = %s %s, want %s %s", tt.input, phone.E164, phone.Type, tt.wantE164, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestFormatPhone(t *testing.T) {
+	tests := []struct {
+		name   string
+		e164   string
+		locale string
+		want   string
+	}{
+		{name: "mobile Thai", e164: "+66812345678", locale: "th", want: "081-234-5678"},
+		{name: "mobile English", e164: "+66812345678", locale: "en", want: "+66 81 234 5678"},
+		{name: "Bangkok Thai", e164: "+6621234567", locale: "th", want: "02-123-4567"},
+		{name: "Bangkok English", e164: "+6621234567", locale: "en", want: "+66 2 123 4567"},
+		{name: "provincial Thai", e164: "+6653123456", locale: "th", want: "053-123-456"},
+		{name: "provincial English", e164: "+6653123456", locale: "en", want: "+66 53 123 456"},
+		{name: "foreign unchanged", e164: "+14155550100", locale: "th", want: "+14155550100"},
+		{name: "malformed Thai unchanged", e164: "+66123", locale: "th", want: "+66123"},
+		{name: "empty", e164: "", locale: "th", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatPhone(tt.e164, tt.locale); got != tt.want {
+				t.Errorf("FormatPhone(%q, %q) = %q, want %q", tt.e164, tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+// Every number ParsePhone accepts parses again to itself, in both its
+// stored and displayed forms.
+func TestParsePhoneRoundTrip(t *testing.T) {
+	for _, input := range []string{"0812345678", "02 123 4567", "053-123-456", "+1 415 555 0100"} {
+		phone, err := ParsePhone(input)
+		if err != nil {
+			t.Fatalf("ParsePhone(%q): %v", input, err)
+		}
+		for _, form := range []string{phone.E164, FormatPhone(phone.E164, "th"), FormatPhone(phone.E164, "en")} {
+			again, err := ParsePhone(form)
+			if err != nil || again != phone {
+				t.Errorf("ParsePhone(%q) = %+v, %v, want %+v", form, again, err, phone)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Package notify sends notifications to users by email, push and SMS,
+// honouring their notification preferences and the email suppression list.
+// Features should send through it rather than through mailer, push or sms
+// directly.
+package notify
+
+import (
+	"errors"
+	"net/url"
+
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/push"
+	"temp-backend-at-kbtg/sms"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOptedOut is returned when the user turned the category off for the
+	// channel.
+	ErrOptedOut = errors.New("user opted out of this notification")
+	// ErrSuppressed is returned when the email address is on the
+	// suppression list.
+	ErrSuppressed = errors.New("email address is suppressed")
+)
+
+// Notifier sends email, push notifications and text messages through its
+// senders: mailer.Queue, push.Default and sms.Default in the server, fakes
+// in tests.
+type Notifier struct {
+	mailer mailer.Sender
+	push   push.Sender
+	sms    sms.Sender
+}
+
+// New returns the Notifier sending through mail, pushes and texts.
+func New(mail mailer.Sender, pushes push.Sender, texts sms.Sender) Notifier {
+	return Notifier{mailer: mail, push: pushes, sms: texts}
+}
+
+// Channels lists the channels users have preferences for.
+var Channels = map[string]bool{
+	models.NotificationChannelEmail: true,
+	models.NotificationChannelPush:  true,
+	models.NotificationChannelSMS:   true,
+}
+
+// Categories maps each category to whether users may turn it off.
+var Categories = map[string]bool{
+	models.NotificationCategoryAccount:   false,
+	models.NotificationCategoryPoints:    true,
+	models.NotificationCategoryMarketing: true,
+}
+
+// UnsubscribePath is the API path of the one-click unsubscribe endpoint.
+const UnsubscribePath = "/api/v1/notifications/unsubscribe"
+
+// Enabled reports whether the user receives category on channel. Marketing
+// also needs the user not to have withdrawn marketing consent in their
+// settings. Optional categories are on by default except by SMS.
+func Enabled(db *gorm.DB, userID uint, channel, category string) (bool, error) {
+	if !Categories[category] {
+		return true, nil
+	}
+
+	if category == models.NotificationCategoryMarketing {
+		var settings models.UserSettings
+		if err := db.Where("user_id = ?", userID).Limit(1).Find(&settings).Error; err != nil {
+			return false, err
+		}
+		if consent := settings.Settings.MarketingConsent; consent != nil && !*consent {
+			return false, nil
+		}
+	}
+
+	var pref models.NotificationPreference
+	err := db.Where("user_id = ? AND channel = ? AND category = ?", userID, channel, category).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultEnabled(channel), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return pref.Enabled, nil
+}
+
+// defaultEnabled reports whether optional categories are on for channel
+// while the user has not chosen.
+func defaultEnabled(channel string) bool {
+	return channel != models.NotificationChannelSMS
+}
+
+// Preferences returns the user's setting for every optional channel and
+// category pair.
+func Preferences(db *gorm.DB, userID uint) ([]models.NotificationPreferenceItem, error) {
+	var prefs []models.NotificationPreference
+	if err := db.Where("user_id = ?", userID).Find(&prefs).Error; err != nil {
+		return nil, err
+	}
+	chosen := map[[2]string]bool{}
+	for _, pref := range prefs {
+		chosen[[2]string{pref.Channel, pref.Category}] = pref.Enabled
+	}
+
+	var items []models.NotificationPreferenceItem
+	for _, channel := range []string{models.NotificationChannelEmail, models.NotificationChannelPush, models.NotificationChannelSMS} {
+		for _, category := range []string{models.NotificationCategoryPoints, models.NotificationCategoryMarketing} {
+			enabled, ok := chosen[[2]string{channel, category}]
+			if !ok {
+				enabled = defaultEnabled(channel)
+			}
+			items = append(items, models.NotificationPreferenceItem{
+				Channel:  channel,
+				Category: category,
+				Enabled:  enabled,
+			})
+		}
+	}
+	return items, nil
+}
+
+// SetPreference turns category on channel on or off for the user.
+func SetPreference(tx *gorm.DB, userID uint, channel, category string, enabled bool) error {
+	pref := models.NotificationPreference{UserID: userID, Channel: channel, Category: category, Enabled: enabled}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "channel"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&pref).Error
+}
+
+// Suppressed reports whether address is on the suppression list.
+func Suppressed(db *gorm.DB, address string) (bool, error) {
+	var count int64
+	err := db.Model(&models.SuppressedAddress{}).Where("address = ?", normalize.Email(address)).Count(&count).Error
+	return count > 0, err
+}
+
+// Suppress adds address to the suppression list and reports whether it was
+// not on it yet.
+func Suppress(tx *gorm.DB, address, reason, detail string) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SuppressedAddress{
+		Address: normalize.Email(address),
+		Reason:  reason,
+		Detail:  detail,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Email sends an email in category to the user. baseURL is the public URL of
+// the API, config.BaseURL; optional categories get a
+// one-click unsubscribe link under it, both in the body and in the
+// List-Unsubscribe headers. With mailer.Queue the email is queued, so
+// delivery failures are only logged.
+func (n Notifier) Email(db *gorm.DB, baseURL string, user *models.User, category, subject, body string) error {
+	link, err := emailAllowed(db, baseURL, user, category)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{Subject: subject, Body: body}
+	if link != "" {
+		msg.Body += "\n\nUnsubscribe: " + link
+	}
+	return n.sendEmail(user, msg, link)
+}
+
+// EmailTemplate sends the email of the mailer template called name, filled
+// with data, like Email.
+func (n Notifier) EmailTemplate(db *gorm.DB, baseURL string, user *models.User, category, name string, data any) error {
+	link, err := emailAllowed(db, baseURL, user, category)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render(name, data, link)
+	if err != nil {
+		return err
+	}
+	return n.sendEmail(user, msg, link)
+}
+
+// emailAllowed checks the suppression list and the user's preferences, and
+// returns the unsubscribe link for optional categories.
+func emailAllowed(db *gorm.DB, baseURL string, user *models.User, category string) (string, error) {
+	suppressed, err := Suppressed(db, user.Email)
+	if err != nil {
+		return "", err
+	}
+	if suppressed {
+		return "", ErrSuppressed
+	}
+
+	enabled, err := Enabled(db, user.ID, models.NotificationChannelEmail, category)
+	if err != nil {
+		return "", err
+	}
+	if !enabled {
+		return "", ErrOptedOut
+	}
+
+	if !Categories[category] {
+		return "", nil
+	}
+	token, err := UnsubscribeToken(user.ID, models.NotificationChannelEmail, category)
+	if err != nil {
+		return "", err
+	}
+	return baseURL + UnsubscribePath + "?token=" + url.QueryEscape(token), nil
+}
+
+// sendEmail sends msg to the user, with the List-Unsubscribe headers when
+// there is an unsubscribe link.
+func (n Notifier) sendEmail(user *models.User, msg mailer.Message, unsubscribeLink string) error {
+	msg.To = user.Email
+	if unsubscribeLink != "" {
+		msg.Headers = map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeLink + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+	return n.mailer.Send(msg)
+}
+
+// Inbox adds a notification in category to the user's notification center
+// through tx, so it can be created in the transaction of the change it
+// reports. It returns ErrOptedOut for marketing the user has not consented
+// to.
+func Inbox(tx *gorm.DB, userID uint, category, title, body string) error {
+	enabled, err := Enabled(tx, userID, models.NotificationChannelInApp, category)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrOptedOut
+	}
+	return tx.Create(&models.Notification{
+		UserID:   userID,
+		Category: category,
+		Title:    title,
+		Body:     body,
+	}).Error
+}
+
+// Push sends a push notification in category to the user's devices and
+// returns the number of devices notified.
+func (n Notifier) Push(db *gorm.DB, user *models.User, category, title, body string) (int, error) {
+	enabled, err := Enabled(db, user.ID, models.NotificationChannelPush, category)
+	if err != nil {
+		return 0, err
+	}
+	if !enabled {
+		return 0, ErrOptedOut
+	}
+	return push.NotifyUser(n.push, db, user.ID, title, body)
+}
+
+// SMS sends a text message in category to the user's verified phone number
+// and reports whether it was sent; users without one get nothing. Messages
+// count towards the user's hourly SMS limit.
+func (n Notifier) SMS(db *gorm.DB, user *models.User, category, message string) (bool, error) {
+	if user.Phone == "" || user.PhoneVerifiedAt == nil {
+		return false, nil
+	}
+	enabled, err := Enabled(db, user.ID, models.NotificationChannelSMS, category)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, ErrOptedOut
+	}
+	if err := sms.Send(n.sms, db, user.ID, user.Phone, models.SMSPurposeNotification, message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
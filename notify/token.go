@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"errors"
+	"strconv"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for unsubscribe tokens that are malformed or
+// not signed by this service.
+var ErrInvalidToken = errors.New("invalid unsubscribe token")
+
+// unsubscribeClaims identify the preference an unsubscribe link turns off.
+// The tokens do not expire so links in old emails keep working.
+type unsubscribeClaims struct {
+	Channel  string `json:"ch"`
+	Category string `json:"cat"`
+	jwt.RegisteredClaims
+}
+
+// unsubscribeKey signs unsubscribe tokens.
+func unsubscribeKey() []byte {
+	return config.DeriveKey(middleware.JWTSecret(), "unsubscribe")
+}
+
+// UnsubscribeToken signs a token that turns category on channel off for the
+// user without logging in.
+func UnsubscribeToken(userID uint, channel, category string) (string, error) {
+	claims := unsubscribeClaims{
+		Channel:  channel,
+		Category: category,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatUint(uint64(userID), 10),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(unsubscribeKey())
+}
+
+// ParseUnsubscribeToken returns the user, channel and category of a token
+// made by UnsubscribeToken.
+func ParseUnsubscribeToken(token string) (uint, string, string, error) {
+	var claims unsubscribeClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return unsubscribeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, "", "", ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || !Channels[claims.Channel] || !Categories[claims.Category] {
+		return 0, "", "", ErrInvalidToken
+	}
+	return uint(userID), claims.Channel, claims.Category, nil
+}
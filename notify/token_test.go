@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	token, err := UnsubscribeToken(42, models.NotificationChannelEmail, models.NotificationCategoryMarketing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, channel, category, err := ParseUnsubscribeToken(token)
+	if err != nil || userID != 42 || channel != models.NotificationChannelEmail || category != models.NotificationCategoryMarketing {
+		t.Fatalf("ParseUnsubscribeToken = %d, %s, %s, %v", userID, channel, category, err)
+	}
+}
+
+func TestUnsubscribeTokenForgery(t *testing.T) {
+	claims := func(subject, channel, category string) unsubscribeClaims {
+		return unsubscribeClaims{
+			Channel:          channel,
+			Category:         category,
+			RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+		}
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.Claims, key interface{}) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	marketing := claims("42", models.NotificationChannelEmail, models.NotificationCategoryMarketing)
+
+	genuine, err := UnsubscribeToken(42, models.NotificationChannelEmail, models.NotificationCategoryMarketing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := UnsubscribeToken(7, models.NotificationChannelEmail, models.NotificationCategoryMarketing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, otherParts := strings.Split(genuine, "."), strings.Split(other, ".")
+	accessToken, err := middleware.GenerateJWT(context.Background(), 42, "user@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty"},
+		{name: "not a token", token: "unsubscribe-me"},
+		{name: "signed with the login key", token: sign(jwt.SigningMethodHS256, marketing, middleware.JWTSecret())},
+		{name: "signed with another key", token: sign(jwt.SigningMethodHS256, marketing, []byte("guessed"))},
+		{name: "other algorithm", token: sign(jwt.SigningMethodHS512, marketing, unsubscribeKey())},
+		{name: "unsigned", token: sign(jwt.SigningMethodNone, marketing, jwt.UnsafeAllowNoneSignatureType)},
+		{name: "another user's claims with this signature", token: parts[0] + "." + otherParts[1] + "." + parts[2]},
+		{name: "signature cut off", token: parts[0] + "." + parts[1] + "."},
+		{name: "access token", token: accessToken},
+		{name: "account notices cannot be turned off", token: sign(jwt.SigningMethodHS256, claims("42", models.NotificationChannelEmail, models.NotificationCategoryAccount), unsubscribeKey())},
+		{name: "unknown channel", token: sign(jwt.SigningMethodHS256, claims("42", "fax", models.NotificationCategoryMarketing), unsubscribeKey())},
+		{name: "unknown category", token: sign(jwt.SigningMethodHS256, claims("42", models.NotificationChannelEmail, "everything"), unsubscribeKey())},
+		{name: "no user", token: sign(jwt.SigningMethodHS256, claims("", models.NotificationChannelEmail, models.NotificationCategoryMarketing), unsubscribeKey())},
+		{name: "user not a number", token: sign(jwt.SigningMethodHS256, claims("admin", models.NotificationChannelEmail, models.NotificationCategoryMarketing), unsubscribeKey())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, channel, category, err := ParseUnsubscribeToken(tt.token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ParseUnsubscribeToken = %d, %s, %s, %v, want %v", userID, channel, category, err, ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// GitHub signs users in with their GitHub account.
+type GitHub struct {
+	Config
+	APIURL string
+}
+
+// NewGitHub returns the provider signing in with the client credentials in client.
+func NewGitHub(client config.OAuthClientConfig) GitHub {
+	return GitHub{
+		Config: newConfig(client,
+			"https://github.com/login/oauth/authorize",
+			"https://github.com/login/oauth/access_token",
+			"read:user", "user:email"),
+		APIURL: "https://api.github.com",
+	}
+}
+
+func (GitHub) Name() string { return "github" }
+
+// Exchange uses the primary address from the account's email list, which
+// unlike the public profile email says whether it is verified.
+func (g GitHub) Exchange(ctx context.Context, code, redirectURL string) (Profile, error) {
+	token, err := g.exchangeCode(ctx, code, redirectURL)
+	if err != nil {
+		return Profile{}, fmt.Errorf("github %w", err)
+	}
+
+	var user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := g.getJSON(ctx, g.APIURL+"/user", token.AccessToken, &user); err != nil {
+		return Profile{}, fmt.Errorf("github user: %w", err)
+	}
+	if user.ID == 0 {
+		return Profile{}, errors.New("github user: missing id")
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := g.getJSON(ctx, g.APIURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return Profile{}, fmt.Errorf("github emails: %w", err)
+	}
+
+	profile := Profile{Subject: strconv.FormatInt(user.ID, 10)}
+	profile.FirstName, profile.LastName, _ = strings.Cut(strings.TrimSpace(user.Name), " ")
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+		}
+	}
+	return profile, nil
+}
@@ -0,0 +1,62 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// Google signs users in with their Google account.
+type Google struct {
+	Config
+	UserInfoURL string
+}
+
+// NewGoogle returns the provider signing in with the client credentials in client.
+func NewGoogle(client config.OAuthClientConfig) Google {
+	return Google{
+		Config: newConfig(client,
+			"https://accounts.google.com/o/oauth2/v2/auth",
+			"https://oauth2.googleapis.com/token",
+			"openid", "email", "profile"),
+		UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+	}
+}
+
+func (Google) Name() string { return "google" }
+
+// AuthCodeURL lets users with several Google accounts pick one.
+func (g Google) AuthCodeURL(state, redirectURL string) string {
+	return g.Config.AuthCodeURL(state, redirectURL) + "&prompt=select_account"
+}
+
+func (g Google) Exchange(ctx context.Context, code, redirectURL string) (Profile, error) {
+	token, err := g.exchangeCode(ctx, code, redirectURL)
+	if err != nil {
+		return Profile{}, fmt.Errorf("google %w", err)
+	}
+
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := g.getJSON(ctx, g.UserInfoURL, token.AccessToken, &info); err != nil {
+		return Profile{}, fmt.Errorf("google userinfo: %w", err)
+	}
+	if info.Sub == "" {
+		return Profile{}, errors.New("google userinfo: missing subject")
+	}
+
+	return Profile{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		FirstName:     info.GivenName,
+		LastName:      info.FamilyName,
+	}, nil
+}
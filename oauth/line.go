@@ -0,0 +1,66 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// LINE signs users in with their LINE account.
+type LINE struct {
+	Config
+	VerifyURL string
+}
+
+// NewLINE returns the provider signing in with the channel ID and secret
+// in client. The channel needs the email permission for LINE to include
+// the address.
+func NewLINE(client config.OAuthClientConfig) LINE {
+	return LINE{
+		Config: newConfig(client,
+			"https://access.line.me/oauth2/v2.1/authorize",
+			"https://api.line.me/oauth2/v2.1/token",
+			"openid", "profile", "email"),
+		VerifyURL: "https://api.line.me/oauth2/v2.1/verify",
+	}
+}
+
+func (LINE) Name() string { return "line" }
+
+// Exchange reads the profile from the ID token, the only place LINE puts the
+// email address, after LINE has verified the token for this channel. LINE
+// confirms addresses when they are registered, so the email counts as
+// verified.
+func (l LINE) Exchange(ctx context.Context, code, redirectURL string) (Profile, error) {
+	token, err := l.exchangeCode(ctx, code, redirectURL)
+	if err != nil {
+		return Profile{}, fmt.Errorf("line %w", err)
+	}
+	if token.IDToken == "" {
+		return Profile{}, errors.New("line token exchange: no ID token")
+	}
+
+	var claims struct {
+		Sub   string `json:"sub"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	form := url.Values{"id_token": {token.IDToken}, "client_id": {l.ClientID}}
+	if err := l.postForm(ctx, l.VerifyURL, form, &claims); err != nil {
+		return Profile{}, fmt.Errorf("line verify: %w", err)
+	}
+	if claims.Sub == "" {
+		return Profile{}, errors.New("line verify: missing subject")
+	}
+
+	// LINE only has a display name, which is often a nickname
+	return Profile{
+		Subject:       claims.Sub,
+		Email:         claims.Email,
+		EmailVerified: claims.Email != "",
+		FirstName:     claims.Name,
+	}, nil
+}
@@ -0,0 +1,207 @@
+// Package oauth signs users in with external identity providers using the
+// OAuth 2.0 authorization code flow.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+)
+
+// ErrNotConfigured is returned when the provider's client credentials are
+// not set.
+var ErrNotConfigured = errors.New("oauth provider is not configured")
+
+// Profile is the identity a provider vouches for after a successful sign-in.
+type Profile struct {
+	Subject string
+	Email   string
+	// EmailVerified is true only when the provider has confirmed the
+	// user owns Email.
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// Provider is an identity provider users can sign in with.
+type Provider interface {
+	// Name is the provider's key in URLs and user_identities, e.g. "google".
+	Name() string
+	Configured() bool
+	// CallbackURL returns the redirect URL registered with the provider,
+	// or defaultURL when none is configured.
+	CallbackURL(defaultURL string) string
+	// AuthCodeURL returns the provider's consent page URL, which redirects
+	// back to redirectURL with the code and state.
+	AuthCodeURL(state, redirectURL string) string
+	// Exchange trades an authorization code for the profile of the
+	// signed-in account. redirectURL must be the one the code was
+	// requested with.
+	Exchange(ctx context.Context, code, redirectURL string) (Profile, error)
+}
+
+// providers builds each supported provider from its client settings. New
+// providers are added here and to config.OAuthConfig.
+var providers = map[string]func(config.OAuthConfig) Provider{
+	"google":   func(c config.OAuthConfig) Provider { return NewGoogle(c.Google) },
+	"github":   func(c config.OAuthConfig) Provider { return NewGitHub(c.GitHub) },
+	"facebook": func(c config.OAuthConfig) Provider { return NewFacebook(c.Facebook) },
+	"line":     func(c config.OAuthConfig) Provider { return NewLINE(c.LINE) },
+}
+
+// clients are the client settings of the providers; none is configured
+// until Init.
+var clients config.OAuthConfig
+
+// Init sets the client credentials of the providers.
+func Init(cfg config.OAuthConfig) {
+	clients = cfg
+}
+
+// Lookup returns the provider called name with the credentials given to
+// Init.
+func Lookup(name string) (Provider, bool) {
+	build, ok := providers[name]
+	if !ok {
+		return nil, false
+	}
+	return build(clients), true
+}
+
+// Configured returns the names of the providers whose credentials are set,
+// in alphabetical order.
+func Configured() []string {
+	names := []string{}
+	for name, build := range providers {
+		if build(clients).Configured() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config holds the OAuth 2.0 client settings shared by all providers.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL overrides the callback URL derived from the request, for
+	// deployments whose public URL differs from what the server sees.
+	RedirectURL string
+
+	AuthURL  string
+	TokenURL string
+	Scopes   []string
+	Client   *http.Client
+}
+
+// newConfig returns the settings of a provider with the endpoints and
+// scopes it uses and the credentials in client.
+func newConfig(client config.OAuthClientConfig, authURL, tokenURL string, scopes ...string) Config {
+	return Config{
+		ClientID:     client.ClientID,
+		ClientSecret: client.ClientSecret,
+		RedirectURL:  client.RedirectURL,
+		AuthURL:      authURL,
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second, Transport: requestid.Transport(tracing.Transport(nil))},
+	}
+}
+
+// Configured reports whether the client credentials are set.
+func (c Config) Configured() bool {
+	return c.ClientID != "" && c.ClientSecret != ""
+}
+
+func (c Config) CallbackURL(defaultURL string) string {
+	if c.RedirectURL != "" {
+		return c.RedirectURL
+	}
+	return defaultURL
+}
+
+// AuthCodeURL returns the consent page URL for the configured scopes.
+func (c Config) AuthCodeURL(state, redirectURL string) string {
+	params := url.Values{
+		"client_id":     {c.ClientID},
+		"redirect_uri":  {redirectURL},
+		"response_type": {"code"},
+		"scope":         {strings.Join(c.Scopes, " ")},
+		"state":         {state},
+	}
+	return c.AuthURL + "?" + params.Encode()
+}
+
+// tokenResponse is the token endpoint's answer. IDToken is only sent by
+// OpenID Connect providers.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func (c Config) exchangeCode(ctx context.Context, code, redirectURL string) (tokenResponse, error) {
+	var token tokenResponse
+	if !c.Configured() {
+		return token, ErrNotConfigured
+	}
+
+	form := url.Values{
+		"code":          {code},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"redirect_uri":  {redirectURL},
+		"grant_type":    {"authorization_code"},
+	}
+	if err := c.postForm(ctx, c.TokenURL, form, &token); err != nil {
+		return token, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.AccessToken == "" {
+		return token, errors.New("token exchange: no access token")
+	}
+	return token, nil
+}
+
+// getJSON fetches an API resource on behalf of the signed-in user.
+func (c Config) getJSON(ctx context.Context, resource, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resource, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return c.do(req, v)
+}
+
+func (c Config) postForm(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, v)
+}
+
+func (c Config) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,127 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"temp-backend-at-kbtg/config"
+)
+
+func TestAuthCodeURL(t *testing.T) {
+	google := NewGoogle(config.OAuthClientConfig{ClientID: "client", ClientSecret: "secret"})
+	u, err := url.Parse(google.AuthCodeURL("signed-state", "https://api.example.com/api/v1/auth/google/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"client_id":     "client",
+		"redirect_uri":  "https://api.example.com/api/v1/auth/google/callback",
+		"response_type": "code",
+		"scope":         "openid email profile",
+		"state":         "signed-state",
+		"prompt":        "select_account",
+	} {
+		if got := u.Query().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if u.Query().Has("client_secret") {
+		t.Error("client secret sent to the browser")
+	}
+}
+
+func TestGitHubExchange(t *testing.T) {
+	tests := []struct {
+		name string
+		// user and emails are the API's answers
+		user    string
+		emails  string
+		want    Profile
+		wantErr bool
+	}{
+		{
+			name:   "verified primary email",
+			user:   `{"id":583231,"name":"Somchai Jaidee"}`,
+			emails: `[{"email":"old@example.com","primary":false,"verified":true},{"email":"somchai@example.com","primary":true,"verified":true}]`,
+			want:   Profile{Subject: "583231", Email: "somchai@example.com", EmailVerified: true, FirstName: "Somchai", LastName: "Jaidee"},
+		},
+		{
+			name:   "unverified primary email",
+			user:   `{"id":583231,"name":"Somchai"}`,
+			emails: `[{"email":"verified@example.com","primary":false,"verified":true},{"email":"somchai@example.com","primary":true,"verified":false}]`,
+			want:   Profile{Subject: "583231", Email: "somchai@example.com", FirstName: "Somchai"},
+		},
+		{name: "no id", user: `{"name":"Somchai"}`, emails: `[]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/token":
+					r.ParseForm()
+					form = r.PostForm
+					json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token"})
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer gho_token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				switch r.URL.Path {
+				case "/user":
+					w.Write([]byte(tt.user))
+				case "/user/emails":
+					w.Write([]byte(tt.emails))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			github := NewGitHub(config.OAuthClientConfig{ClientID: "client", ClientSecret: "secret"})
+			github.TokenURL, github.APIURL = server.URL+"/token", server.URL
+			got, err := github.Exchange(context.Background(), "code", "https://api.example.com/callback")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Exchange = %+v, want %+v", got, tt.want)
+			}
+			for name, want := range map[string]string{
+				"code":          "code",
+				"client_id":     "client",
+				"client_secret": "secret",
+				"redirect_uri":  "https://api.example.com/callback",
+				"grant_type":    "authorization_code",
+			} {
+				if form.Get(name) != want {
+					t.Errorf("token request %s = %q, want %q", name, form.Get(name), want)
+				}
+			}
+		})
+	}
+}
+
+func TestExchangeNotConfigured(t *testing.T) {
+	for name := range providers {
+		provider, _ := Lookup(name)
+		if provider.Configured() {
+			t.Fatalf("%s configured without credentials", name)
+		}
+		if _, err := provider.Exchange(context.Background(), "code", "https://api.example.com/callback"); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("%s: error %v, want %v", name, err, ErrNotConfigured)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package oauth
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StateTTL is how long a user has to finish signing in at the provider.
+const StateTTL = 10 * time.Minute
+
+// ErrInvalidState is returned for state parameters that are malformed,
+// expired or not signed by this service.
+var ErrInvalidState = errors.New("invalid oauth state")
+
+// State is what the service needs to remember across the provider
+// redirect. Nonce must match the value stored in the browser that started
+// the sign-in, which stops a callback URL from being replayed in another
+// browser.
+type State struct {
+	Provider string
+	// UserID is set when a signed-in user is linking the provider account
+	// and zero for sign-in.
+	UserID uint
+	Nonce  string
+}
+
+type stateClaims struct {
+	Provider string `json:"prv"`
+	Nonce    string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// stateKey signs the state parameter.
+func stateKey() []byte {
+	return config.DeriveKey(middleware.JWTSecret(), "oauth-state")
+}
+
+// SignState encodes state as the signed state parameter sent to the
+// provider.
+func SignState(state State) (string, error) {
+	claims := stateClaims{
+		Provider: state.Provider,
+		Nonce:    state.Nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(StateTTL)),
+		},
+	}
+	if state.UserID != 0 {
+		claims.Subject = strconv.FormatUint(uint64(state.UserID), 10)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stateKey())
+}
+
+// ParseState returns the state signed by SignState.
+func ParseState(token string) (State, error) {
+	var claims stateClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return stateKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Provider == "" || claims.Nonce == "" {
+		return State{}, ErrInvalidState
+	}
+
+	state := State{Provider: claims.Provider, Nonce: claims.Nonce}
+	if claims.Subject != "" {
+		userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+		if err != nil {
+			return State{}, ErrInvalidState
+		}
+		state.UserID = uint(userID)
+	}
+	return state, nil
+}
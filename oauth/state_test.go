@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestState(t *testing.T) {
+	for _, want := range []State{
+		{Provider: "google", Nonce: "n0nce"},
+		{Provider: "line", UserID: 42, Nonce: "n0nce"},
+	} {
+		token, err := SignState(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseState(token)
+		if err != nil || got != want {
+			t.Errorf("ParseState = %+v, %v, want %+v", got, err, want)
+		}
+	}
+}
+
+func TestStateForgery(t *testing.T) {
+	valid := func(provider, nonce, subject string) stateClaims {
+		return stateClaims{
+			Provider: provider,
+			Nonce:    nonce,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   subject,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.Claims, key interface{}) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expired := valid("google", "n0nce", "")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second))
+	noExpiry := valid("google", "n0nce", "")
+	noExpiry.ExpiresAt = nil
+
+	// The claims of a link to another user under a sign-in's signature
+	signIn, err := SignState(State{Provider: "google", Nonce: "n0nce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := SignState(State{Provider: "google", UserID: 7, Nonce: "n0nce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signInParts, linkParts := strings.Split(signIn, "."), strings.Split(link, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty"},
+		{name: "not a token", token: "state"},
+		{name: "signed with the login key", token: sign(jwt.SigningMethodHS256, valid("google", "n0nce", ""), middleware.JWTSecret())},
+		{name: "other algorithm", token: sign(jwt.SigningMethodHS384, valid("google", "n0nce", ""), stateKey())},
+		{name: "unsigned", token: sign(jwt.SigningMethodNone, valid("google", "n0nce", ""), jwt.UnsafeAllowNoneSignatureType)},
+		{name: "link claims with a sign-in signature", token: signInParts[0] + "." + linkParts[1] + "." + signInParts[2]},
+		{name: "expired", token: sign(jwt.SigningMethodHS256, expired, stateKey())},
+		{name: "no expiry", token: sign(jwt.SigningMethodHS256, noExpiry, stateKey())},
+		{name: "no provider", token: sign(jwt.SigningMethodHS256, valid("", "n0nce", ""), stateKey())},
+		{name: "no nonce", token: sign(jwt.SigningMethodHS256, valid("google", "", ""), stateKey())},
+		{name: "user not a number", token: sign(jwt.SigningMethodHS256, valid("google", "n0nce", "admin"), stateKey())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if state, err := ParseState(tt.token); !errors.Is(err, ErrInvalidState) {
+				t.Errorf("ParseState = %+v, %v, want %v", state, err, ErrInvalidState)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package outbox keeps an in-memory record of messages that would have been
+// sent to external providers when PROVIDERS_MODE=mock, so QA can inspect
+// OTPs, verification links and notifications without real providers.
+package outbox
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Provider channels.
+const (
+	ChannelEmail      = "email"
+	ChannelSMS        = "sms"
+	ChannelPayment    = "payment"
+	ChannelPush       = "push"
+	ChannelEvent      = "event"
+	ChannelModeration = "moderation"
+	ChannelVoucher    = "voucher"
+)
+
+// maxMessages bounds memory use; the oldest messages are dropped first.
+const maxMessages = 500
+
+type Message struct {
+	ID       int               `json:"id"`
+	Channel  string            `json:"channel"`
+	To       string            `json:"to"`
+	Subject  string            `json:"subject,omitempty"`
+	Body     string            `json:"body"`
+	HTML     string            `json:"html,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	SentAt   time.Time         `json:"sent_at"`
+}
+
+var (
+	mu       sync.RWMutex
+	messages []Message
+	nextID   = 1
+)
+
+// mockMode is set by Init for providers_mode mock.
+var mockMode bool
+
+// Init sets whether providers deliver to the outbox, for providersMode
+// "mock", or call the real services.
+func Init(providersMode string) {
+	mockMode = providersMode == "mock"
+}
+
+// MockMode reports whether providers should deliver to the outbox instead of
+// calling the real services.
+func MockMode() bool {
+	return mockMode
+}
+
+// Record stores msg and returns it with its ID and timestamp filled in.
+func Record(msg Message) Message {
+	mu.Lock()
+	defer mu.Unlock()
+
+	msg.ID = nextID
+	nextID++
+	msg.SentAt = time.Now()
+
+	messages = append(messages, msg)
+	if len(messages) > maxMessages {
+		messages = messages[len(messages)-maxMessages:]
+	}
+
+	log.Printf("[outbox] %s to %s: %s", msg.Channel, msg.To, msg.Subject)
+	return msg
+}
+
+// List returns stored messages, newest first. Empty filters match everything.
+func List(channel, to string) []Message {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	result := make([]Message, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if channel != "" && msg.Channel != channel {
+			continue
+		}
+		if to != "" && msg.To != to {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// Clear removes all stored messages.
+func Clear() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	messages = nil
+}
@@ -0,0 +1,177 @@
+// Package pagination reads the page, limit, sort and filter query parameters
+// of list endpoints and applies them to GORM queries. Clients only ever name
+// sort and filter keys; each endpoint maps the keys it allows to columns, so
+// query strings never reach the SQL.
+//
+//	?page=2&limit=50&sort=-created_at,email&filter[role]=admin
+//
+// sort takes a comma-separated list of keys, each descending when prefixed
+// with "-". filter[key]=value keeps records whose column equals value.
+package pagination
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Options describes what an endpoint allows.
+type Options struct {
+	// DefaultLimit is used when limit is missing (20 when zero); MaxLimit is
+	// the largest limit accepted (100 when zero)
+	DefaultLimit int
+	MaxLimit     int
+	// Sorts maps sort keys to columns. DefaultSort applies when sort is
+	// missing, e.g. "-id"
+	Sorts       map[string]string
+	DefaultSort string
+	// Filters maps filter keys to the columns they must equal
+	Filters map[string]string
+}
+
+// Params is a parsed, validated page request.
+type Params struct {
+	Page    int
+	Limit   int
+	order   []clause.OrderByColumn
+	filters []filter
+}
+
+type filter struct {
+	column string
+	value  string
+}
+
+// Parse reads the pagination query parameters of c. Values that are out of
+// range or name keys opts does not allow are rejected with a validation
+// error keyed by the parameter.
+func Parse(c *fiber.Ctx, opts Options) (Params, error) {
+	return ParseQuery(c.Queries(), opts)
+}
+
+// ParseQuery is Parse for the query parameters in query, for transports
+// other than HTTP.
+func ParseQuery(query map[string]string, opts Options) (Params, error) {
+	if opts.DefaultLimit == 0 {
+		opts.DefaultLimit = 20
+	}
+	if opts.MaxLimit == 0 {
+		opts.MaxLimit = 100
+	}
+
+	fields := map[string]string{}
+	p := Params{Page: 1, Limit: opts.DefaultLimit}
+	if raw := query["page"]; raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			fields["page"] = "must be a positive number"
+		}
+		p.Page = page
+	}
+	if raw := query["limit"]; raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > opts.MaxLimit {
+			fields["limit"] = fmt.Sprintf("must be between 1 and %d", opts.MaxLimit)
+		}
+		p.Limit = limit
+	}
+
+	sort := query["sort"]
+	if sort == "" {
+		sort = opts.DefaultSort
+	}
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		desc := strings.HasPrefix(key, "-")
+		column, ok := opts.Sorts[strings.TrimPrefix(key, "-")]
+		if !ok {
+			fields["sort"] = "must be a comma-separated list of " + keyList(opts.Sorts)
+			break
+		}
+		p.order = append(p.order, clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: desc})
+	}
+
+	for key, value := range query {
+		name, ok := strings.CutPrefix(key, "filter[")
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, "]")
+		column, allowed := opts.Filters[name]
+		if !ok || !allowed {
+			fields[key] = "is not a filter; use one of " + keyList(opts.Filters)
+			continue
+		}
+		p.filters = append(p.filters, filter{column: column, value: value})
+	}
+	// Filters are applied in a stable order so equal requests build equal SQL
+	slices.SortFunc(p.filters, func(a, b filter) int { return strings.Compare(a.column, b.column) })
+
+	if len(fields) > 0 {
+		return Params{}, models.NewValidationError("Invalid pagination", fields)
+	}
+	return p, nil
+}
+
+func keyList(columns map[string]string) string {
+	if len(columns) == 0 {
+		return "nothing"
+	}
+	keys := make([]string, 0, len(columns))
+	for key := range columns {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ", ")
+}
+
+// Filter adds the filters of p to query.
+func (p Params) Filter(query *gorm.DB) *gorm.DB {
+	for _, f := range p.filters {
+		query = query.Where(clause.Eq{Column: clause.Column{Name: f.column}, Value: f.value})
+	}
+	return query
+}
+
+// Apply adds the ordering, offset and limit of p to query.
+func (p Params) Apply(query *gorm.DB) *gorm.DB {
+	if len(p.order) > 0 {
+		query = query.Order(clause.OrderBy{Columns: p.order})
+	}
+	return query.Offset((p.Page - 1) * p.Limit).Limit(p.Limit)
+}
+
+// Find loads the page of query described by p, which may already carry
+// conditions of its own, together with the number of matching records.
+func Find[T any](query *gorm.DB, p Params) (models.PagedResponse, error) {
+	query = p.Filter(query.Model(new(T))).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return models.PagedResponse{}, err
+	}
+
+	items := []T{}
+	if err := p.Apply(query).Find(&items).Error; err != nil {
+		return models.PagedResponse{}, err
+	}
+
+	return models.PagedResponse{
+		Items: items,
+		Total: total,
+		Page:  p.Page,
+		Pages: int(math.Ceil(float64(total) / float64(p.Limit))),
+		Limit: p.Limit,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package pagination_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/testutil"
+)
+
+var userPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "email": "email", "points": "points"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"role": "role", "level": "member_level"},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     map[string]string
+		opts      pagination.Options
+		wantPage  int
+		wantLimit int
+		// wantFields are the parameters rejected
+		wantFields []string
+	}{
+		{name: "defaults", wantPage: 1, wantLimit: 20},
+		{name: "endpoint default limit", opts: pagination.Options{DefaultLimit: 50}, wantPage: 1, wantLimit: 50},
+		{name: "page and limit", query: map[string]string{"page": "3", "limit": "100"}, wantPage: 3, wantLimit: 100},
+		{name: "endpoint max limit", query: map[string]string{"limit": "500"}, opts: pagination.Options{MaxLimit: 500}, wantPage: 1, wantLimit: 500},
+		{name: "sorts and filters", query: map[string]string{"sort": "-points, email", "filter[role]": "admin"}, wantPage: 1, wantLimit: 20},
+		{name: "page zero", query: map[string]string{"page": "0"}, wantFields: []string{"page"}},
+		{name: "page not a number", query: map[string]string{"page": "two"}, wantFields: []string{"page"}},
+		{name: "limit over the max", query: map[string]string{"limit": "101"}, wantFields: []string{"limit"}},
+		{name: "limit zero", query: map[string]string{"limit": "0"}, wantFields: []string{"limit"}},
+		{name: "unknown sort", query: map[string]string{"sort": "password"}, wantFields: []string{"sort"}},
+		{name: "SQL in sort", query: map[string]string{"sort": "id;DROP TABLE users"}, wantFields: []string{"sort"}},
+		{name: "unknown filter", query: map[string]string{"filter[password]": "x"}, wantFields: []string{"filter[password]"}},
+		{name: "column name as filter", query: map[string]string{"filter[member_level]": "Gold"}, wantFields: []string{"filter[member_level]"}},
+		{name: "unclosed filter", query: map[string]string{"filter[role": "admin"}, wantFields: []string{"filter[role"}},
+		{name: "every problem at once", query: map[string]string{"page": "-1", "limit": "x", "sort": "nope"}, wantFields: []string{"limit", "page", "sort"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Sorts, opts.DefaultSort, opts.Filters = userPages.Sorts, userPages.DefaultSort, userPages.Filters
+			p, err := pagination.ParseQuery(tt.query, opts)
+
+			var appErr *models.AppError
+			if len(tt.wantFields) > 0 {
+				if !errors.As(err, &appErr) || appErr.Code != models.CodeValidationFailed {
+					t.Fatalf("error %v, want a validation error", err)
+				}
+				var fields []string
+				for field := range appErr.Details.(map[string]string) {
+					fields = append(fields, field)
+				}
+				slices.Sort(fields)
+				if !slices.Equal(fields, tt.wantFields) {
+					t.Errorf("rejected %q, want %q", fields, tt.wantFields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Page != tt.wantPage || p.Limit != tt.wantLimit {
+				t.Errorf("page %d, limit %d, want %d, %d", p.Page, p.Limit, tt.wantPage, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	db := testutil.NewDB(t)
+	var users []models.User
+	for i, points := range []int{50, 10, 40, 30, 20} {
+		level := "Gold"
+		if i%2 == 1 {
+			level = "Silver"
+		}
+		users = append(users, testutil.CreateUser(t, db, testutil.WithPoints(points), testutil.WithMemberLevel(level)))
+	}
+	id := func(i int) uint { return users[i].ID }
+
+	tests := []struct {
+		name      string
+		query     map[string]string
+		wantIDs   []uint
+		wantTotal int64
+		wantPages int
+	}{
+		{name: "default sort", wantIDs: []uint{id(4), id(3), id(2), id(1), id(0)}, wantTotal: 5, wantPages: 1},
+		{name: "second page", query: map[string]string{"limit": "2", "page": "2", "sort": "id"}, wantIDs: []uint{id(2), id(3)}, wantTotal: 5, wantPages: 3},
+		{name: "last page", query: map[string]string{"limit": "2", "page": "3", "sort": "id"}, wantIDs: []uint{id(4)}, wantTotal: 5, wantPages: 3},
+		{name: "past the last page", query: map[string]string{"limit": "2", "page": "4"}, wantIDs: []uint{}, wantTotal: 5, wantPages: 3},
+		{name: "descending sort", query: map[string]string{"sort": "-points"}, wantIDs: []uint{id(0), id(2), id(3), id(4), id(1)}, wantTotal: 5, wantPages: 1},
+		{name: "filter", query: map[string]string{"filter[level]": "Silver", "sort": "points"}, wantIDs: []uint{id(1), id(3)}, wantTotal: 2, wantPages: 1},
+		{name: "filter matching nothing", query: map[string]string{"filter[level]": "Gold' OR '1'='1"}, wantIDs: []uint{}, wantTotal: 0, wantPages: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := pagination.ParseQuery(tt.query, userPages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := pagination.Find[models.User](db, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []uint{}
+			for _, user := range page.Items.([]models.User) {
+				ids = append(ids, user.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("IDs %v, want %v", ids, tt.wantIDs)
+			}
+			if page.Total != tt.wantTotal || page.Pages != tt.wantPages || page.Page != p.Page || page.Limit != p.Limit {
+				t.Errorf("total %d, pages %d, page %d, limit %d, want %d, %d, %d, %d",
+					page.Total, page.Pages, page.Page, page.Limit, tt.wantTotal, tt.wantPages, p.Page, p.Limit)
+			}
+		})
+	}
+
+	t.Run("keeps the query's own conditions", func(t *testing.T) {
+		p, err := pagination.ParseQuery(map[string]string{"filter[level]": "Gold"}, userPages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := pagination.Find[models.User](db.Where("points > ?", 30), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 2 {
+			t.Errorf("total %d, want 2", page.Total)
+		}
+	})
+}
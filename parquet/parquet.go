@@ -0,0 +1,378 @@
+// Package parquet writes Apache Parquet files that BigQuery, Athena, Spark
+// and DuckDB load. It only implements what the analytics export needs: a
+// flat schema of optional integer, string, boolean and timestamp columns,
+// plain-encoded and compressed with gzip, written row by row and flushed as
+// a row group every RowGroupSize rows so large tables are not held in
+// memory.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ContentType is the media type of the files the Writer produces.
+const ContentType = "application/vnd.apache.parquet"
+
+// RowGroupSize is how many rows a row group holds.
+const RowGroupSize = 100000
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("parquet: writer closed")
+
+// Type is the type of a column's values.
+type Type string
+
+const (
+	// Int64 columns take int, int64 and uint values
+	Int64 Type = "INT64"
+	// String columns take strings, stored as UTF-8
+	String Type = "STRING"
+	// Bool columns take bools
+	Bool Type = "BOOLEAN"
+	// Timestamp columns take time.Time and *time.Time, stored as
+	// microseconds since the Unix epoch in UTC
+	Timestamp Type = "TIMESTAMP"
+)
+
+// Valid reports whether t is one of the types above.
+func (t Type) Valid() bool {
+	switch t {
+	case Int64, String, Bool, Timestamp:
+		return true
+	}
+	return false
+}
+
+// Column is a column of the schema. Every column is optional, so a nil value
+// is written as null.
+type Column struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+}
+
+// Values of the Parquet format's enums, from parquet.thrift.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	repetitionOptional = 1
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecGzip          = 2
+	pageData           = 0
+)
+
+// Writer writes a Parquet file with the columns it was created with.
+type Writer struct {
+	w       *countingWriter
+	columns []Column
+	chunks  []*chunk
+	rows    int
+	total   int64
+	groups  []rowGroup
+	closed  bool
+}
+
+// chunk collects the values of a column in the current row group.
+type chunk struct {
+	present []bool
+	values  bytes.Buffer
+	bools   []bool
+}
+
+// rowGroup is what the footer records of a row group written.
+type rowGroup struct {
+	rows    int
+	size    int64
+	columns []columnChunk
+}
+
+// columnChunk is what the footer records of a column's page in a row group.
+type columnChunk struct {
+	offset       int64
+	values       int
+	uncompressed int64
+	compressed   int64
+}
+
+// NewWriter starts a file on w with columns. The file is complete once Close
+// returns.
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	for _, c := range columns {
+		if c.Name == "" || !c.Type.Valid() {
+			return nil, fmt.Errorf("parquet: invalid column %q of type %q", c.Name, c.Type)
+		}
+	}
+	cw := &countingWriter{w: w}
+	if _, err := io.WriteString(cw, magic); err != nil {
+		return nil, err
+	}
+	pw := &Writer{w: cw, columns: columns, chunks: make([]*chunk, len(columns))}
+	for i := range pw.chunks {
+		pw.chunks[i] = &chunk{}
+	}
+	return pw, nil
+}
+
+// WriteRow appends a row with a value for each column, in the order of the
+// columns; nil is null.
+func (w *Writer) WriteRow(values ...interface{}) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("parquet: %d values for %d columns", len(values), len(w.columns))
+	}
+	// Checked first, so a bad value leaves no partial row behind
+	for i, v := range values {
+		if !accepts(w.columns[i].Type, v) {
+			return fmt.Errorf("parquet: column %s: %T is not %s", w.columns[i].Name, v, w.columns[i].Type)
+		}
+	}
+	for i, v := range values {
+		w.chunks[i].add(v)
+	}
+	w.rows++
+	if w.rows == RowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.rows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	footer := w.footer()
+	if _, err := w.w.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, magic)
+	return err
+}
+
+// accepts reports whether v can be written to a column of type t.
+func accepts(t Type, v interface{}) bool {
+	switch v.(type) {
+	case nil:
+		return true
+	case int, int64, uint:
+		return t == Int64
+	case string:
+		return t == String
+	case bool:
+		return t == Bool
+	case time.Time, *time.Time:
+		return t == Timestamp
+	}
+	return false
+}
+
+// add appends v, which accepts allowed, to the chunk.
+func (c *chunk) add(v interface{}) {
+	if p, ok := v.(*time.Time); ok {
+		if p == nil {
+			v = nil
+		} else {
+			v = *p
+		}
+	}
+	c.present = append(c.present, v != nil)
+	switch v := v.(type) {
+	case int:
+		binary.Write(&c.values, binary.LittleEndian, int64(v))
+	case int64:
+		binary.Write(&c.values, binary.LittleEndian, v)
+	case uint:
+		binary.Write(&c.values, binary.LittleEndian, int64(v))
+	case string:
+		binary.Write(&c.values, binary.LittleEndian, uint32(len(v)))
+		c.values.WriteString(v)
+	case bool:
+		c.bools = append(c.bools, v)
+	case time.Time:
+		binary.Write(&c.values, binary.LittleEndian, v.UnixMicro())
+	}
+}
+
+// flush writes the rows collected as a row group, one gzipped data page per
+// column.
+func (w *Writer) flush() error {
+	group := rowGroup{rows: w.rows}
+	for i, c := range w.chunks {
+		// The page is the definition levels, 1 for a value and 0 for null,
+		// with their length, then the values
+		var page bytes.Buffer
+		levels := bitPacked(c.present)
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+		if w.columns[i].Type == Bool {
+			page.Write(packBits(c.bools))
+		} else {
+			page.Write(c.values.Bytes())
+		}
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(page.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		header := &thrift{}
+		header.i32(1, pageData)
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(compressed.Len()))
+		header.begin(5)
+		header.i32(1, int32(len(c.present)))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		header.end()
+
+		offset := w.w.n
+		if _, err := w.w.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(compressed.Bytes()); err != nil {
+			return err
+		}
+		written := columnChunk{
+			offset:       offset,
+			values:       len(c.present),
+			uncompressed: int64(header.buf.Len() + page.Len()),
+			compressed:   int64(header.buf.Len() + compressed.Len()),
+		}
+		group.columns = append(group.columns, written)
+		group.size += written.uncompressed
+		w.chunks[i] = &chunk{}
+	}
+	w.groups = append(w.groups, group)
+	w.total += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+// footer returns the file metadata.
+func (w *Writer) footer() []byte {
+	t := &thrift{}
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.element()
+	t.str(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.end()
+	for _, c := range w.columns {
+		t.element()
+		t.i32(1, physicalType(c.Type))
+		t.i32(3, repetitionOptional)
+		t.str(4, c.Name)
+		switch c.Type {
+		case String:
+			t.i32(6, convertedUTF8)
+		case Timestamp:
+			t.i32(6, convertedTimestampMicros)
+		}
+		t.end()
+	}
+	t.i64(3, w.total)
+	t.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.element()
+		t.list(1, thriftStruct, len(g.columns))
+		for i, c := range g.columns {
+			t.element()
+			t.i64(2, c.offset)
+			t.begin(3)
+			t.i32(1, physicalType(w.columns[i].Type))
+			t.list(2, thriftI32, 2)
+			t.rawI32(encodingPlain)
+			t.rawI32(encodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.rawStr(w.columns[i].Name)
+			t.i32(4, codecGzip)
+			t.i64(5, int64(c.values))
+			t.i64(6, c.uncompressed)
+			t.i64(7, c.compressed)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, g.size)
+		t.i64(3, int64(g.rows))
+		t.end()
+	}
+	t.str(6, "training-kbtg-backend")
+	t.end()
+	return t.buf.Bytes()
+}
+
+func physicalType(t Type) int32 {
+	switch t {
+	case String:
+		return typeByteArray
+	case Bool:
+		return typeBoolean
+	default:
+		return typeInt64
+	}
+}
+
+// bitPacked encodes levels of bit width 1 as a single bit-packed run of the
+// RLE/bit-packing hybrid encoding.
+func bitPacked(levels []bool) []byte {
+	groups := (len(levels) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	return append(out, packBits(levels)...)
+}
+
+// packBits packs bits eight to a byte, the first in the lowest bit.
+func packBits(bits []bool) []byte {
+	out := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// countingWriter counts the bytes written, for the offsets in the footer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,247 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readStruct decodes a Thrift compact struct into its fields by ID: int64
+// for integers, string for binary, []interface{} for lists and
+// map[int16]interface{} for structs.
+func readStruct(t *testing.T, r *bytes.Reader) map[int16]interface{} {
+	t.Helper()
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("reading field header: %v", err)
+		}
+		if b == 0 {
+			return fields
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, _ := binary.ReadVarint(r)
+			id = int16(v)
+		}
+		last = id
+		fields[id] = readValue(t, r, b&0x0f)
+	}
+}
+
+func readValue(t *testing.T, r *bytes.Reader, typ byte) interface{} {
+	t.Helper()
+	switch typ {
+	case thriftI32, thriftI64:
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			t.Fatalf("reading integer: %v", err)
+		}
+		return v
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(r)
+		s := make([]byte, n)
+		if _, err := io.ReadFull(r, s); err != nil {
+			t.Fatalf("reading string: %v", err)
+		}
+		return string(s)
+	case thriftList:
+		b, _ := r.ReadByte()
+		n := uint64(b >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = readValue(t, r, b&0x0f)
+		}
+		return list
+	case thriftStruct:
+		return readStruct(t, r)
+	}
+	t.Fatalf("unexpected Thrift type %d", typ)
+	return nil
+}
+
+// readFile decodes a file written by Writer into its column names and rows.
+func readFile(t *testing.T, data []byte) ([]string, [][]interface{}) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(magic)) || !bytes.HasSuffix(data, []byte(magic)) {
+		t.Fatalf("file does not start and end with %s", magic)
+	}
+	size := binary.LittleEndian.Uint32(data[len(data)-8:])
+	meta := readStruct(t, bytes.NewReader(data[len(data)-8-int(size):len(data)-8]))
+
+	schema := meta[2].([]interface{})
+	var names []string
+	var types []int64
+	for _, element := range schema[1:] {
+		e := element.(map[int16]interface{})
+		names = append(names, e[4].(string))
+		types = append(types, e[1].(int64))
+	}
+
+	var rows [][]interface{}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		n := int(group[3].(int64))
+		groupRows := make([][]interface{}, n)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(names))
+		}
+		for col, c := range group[1].([]interface{}) {
+			offset := c.(map[int16]interface{})[2].(int64)
+			r := bytes.NewReader(data[offset:])
+			header := readStruct(t, r)
+			compressed := make([]byte, header[3].(int64))
+			io.ReadFull(r, compressed)
+			zr, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("page of %s: %v", names[col], err)
+			}
+			page, _ := io.ReadAll(zr)
+
+			levelsSize := binary.LittleEndian.Uint32(page)
+			levels := bytes.NewReader(page[4 : 4+levelsSize])
+			binary.ReadUvarint(levels)
+			bits, _ := io.ReadAll(levels)
+			values := page[4+levelsSize:]
+			bit := 0
+			for i := 0; i < n; i++ {
+				if bits[i/8]&(1<<(i%8)) == 0 {
+					continue
+				}
+				switch types[col] {
+				case typeInt64:
+					groupRows[i][col] = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case typeByteArray:
+					l := binary.LittleEndian.Uint32(values)
+					groupRows[i][col] = string(values[4 : 4+l])
+					values = values[4+l:]
+				case typeBoolean:
+					groupRows[i][col] = values[bit/8]&(1<<(bit%8)) != 0
+					bit++
+				}
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if total := int(meta[3].(int64)); total != len(rows) {
+		t.Errorf("footer counts %d rows, row groups hold %d", total, len(rows))
+	}
+	return names, rows
+}
+
+func TestWriter(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	columns := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "name", Type: String},
+		{Name: "ok", Type: Bool},
+		{Name: "at", Type: Timestamp},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{1, "สมชาย", true, at},
+		{int64(2), nil, false, (*time.Time)(nil)},
+		{uint(3), "", nil, &at},
+		{nil, nil, nil, nil},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, got := readFile(t, buf.Bytes())
+	if want := []string{"id", "name", "ok", "at"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns %v, want %v", names, want)
+	}
+	want := [][]interface{}{
+		{int64(1), "สมชาย", true, at.UnixMicro()},
+		{int64(2), nil, false, nil},
+		{int64(3), "", nil, at.UnixMicro()},
+		{nil, nil, nil, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows %v, want %v", got, want)
+	}
+
+	if err := w.WriteRow(4, "late", true, at); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteRow after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestWriterRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{Name: "n", Type: Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := RowGroupSize + 10
+	for i := 0; i < total; i++ {
+		if err := w.WriteRow(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rows := readFile(t, buf.Bytes())
+	if len(rows) != total {
+		t.Fatalf("%d rows, want %d", len(rows), total)
+	}
+	for _, i := range []int{0, RowGroupSize - 1, RowGroupSize, total - 1} {
+		if rows[i][0] != int64(i) {
+			t.Errorf("row %d = %v", i, rows[i][0])
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	if _, err := NewWriter(io.Discard, nil); err == nil {
+		t.Error("NewWriter without columns: want an error")
+	}
+	if _, err := NewWriter(io.Discard, []Column{{Name: "n", Type: "FLOAT"}}); err == nil {
+		t.Error("NewWriter with an unknown type: want an error")
+	}
+
+	w, err := NewWriter(io.Discard, []Column{{Name: "n", Type: Int64}, {Name: "s", Type: String}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		values []interface{}
+	}{
+		{name: "too few values", values: []interface{}{1}},
+		{name: "string for int", values: []interface{}{"1", "a"}},
+		{name: "int for string", values: []interface{}{1, 2}},
+		{name: "float", values: []interface{}{1.5, "a"}},
+	}
+	for _, tt := range tests {
+		if err := w.WriteRow(tt.values...); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+	if w.rows != 0 {
+		t.Errorf("rejected rows were kept: %d rows", w.rows)
+	}
+}
@@ -0,0 +1,98 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol that the metadata uses.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thrift encodes structs in the Thrift compact protocol, which Parquet uses
+// for page headers and the footer. Fields are written in order of their ID;
+// the outermost struct is open from the start and ended with end.
+type thrift struct {
+	buf bytes.Buffer
+	// last is the ID of the last field written in each open struct
+	last []int16
+}
+
+// field writes the header of field id of type typ: the difference to the
+// previous field's ID when it is small, the full ID otherwise.
+func (t *thrift) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.buf.Write(binary.AppendVarint(nil, int64(id)))
+	}
+	*last = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.rawI32(v)
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (t *thrift) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.rawStr(s)
+}
+
+// begin starts the struct in field id.
+func (t *thrift) begin(id int16) {
+	t.field(id, thriftStruct)
+	t.last = append(t.last, 0)
+}
+
+// element starts a struct that is an element of a list.
+func (t *thrift) element() {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	t.last = append(t.last, 0)
+}
+
+// end ends the innermost open struct.
+func (t *thrift) end() {
+	t.buf.WriteByte(0)
+	if len(t.last) > 0 {
+		t.last = t.last[:len(t.last)-1]
+	}
+}
+
+// list starts the list in field id of n elements of type elem, which follow
+// as raw values or structs.
+func (t *thrift) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (t *thrift) rawI32(v int32) {
+	t.buf.Write(binary.AppendVarint(nil, int64(v)))
+}
+
+func (t *thrift) rawStr(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
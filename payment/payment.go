@@ -0,0 +1,61 @@
+// Package payment charges members through a payment gateway, e.g. to top up
+// their wallet.
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"temp-backend-at-kbtg/outbox"
+)
+
+// ErrNotConfigured is returned when no payment gateway is configured.
+var ErrNotConfigured = errors.New("no payment gateway configured")
+
+// ErrDeclined is returned when the gateway refuses a charge.
+var ErrDeclined = errors.New("payment declined")
+
+// Gateway charges a member's saved payment method. Amounts are in satang.
+// Reference identifies the charge so the gateway can refuse duplicates; it
+// returns the gateway's ID for the charge.
+type Gateway interface {
+	Charge(userID uint, amount int, reference string) (string, error)
+}
+
+// Default is the gateway of the handlers unless they are given another.
+// There is no gateway yet, so every charge fails with ErrNotConfigured,
+// except in PROVIDERS_MODE=mock, where Init sends charges to the outbox and
+// they always succeed.
+var Default Gateway = UnconfiguredGateway{}
+
+// Init sets Default to the outbox in PROVIDERS_MODE=mock.
+func Init() {
+	if outbox.MockMode() {
+		Default = OutboxGateway{}
+	}
+}
+
+// OutboxGateway records charges in the mock provider outbox.
+type OutboxGateway struct{}
+
+func (OutboxGateway) Charge(userID uint, amount int, reference string) (string, error) {
+	msg := outbox.Record(outbox.Message{
+		Channel: outbox.ChannelPayment,
+		To:      fmt.Sprintf("user:%d", userID),
+		Subject: "Charge",
+		Body:    fmt.Sprintf("%d.%02d THB", amount/100, amount%100),
+		Metadata: map[string]string{
+			"amount":    strconv.Itoa(amount),
+			"reference": reference,
+		},
+	})
+	return fmt.Sprintf("mock_%d", msg.ID), nil
+}
+
+// UnconfiguredGateway refuses every charge.
+type UnconfiguredGateway struct{}
+
+func (UnconfiguredGateway) Charge(userID uint, amount int, reference string) (string, error) {
+	return "", ErrNotConfigured
+}
@@ -0,0 +1,49 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"temp-backend-at-kbtg/outbox"
+)
+
+func TestOutboxGateway(t *testing.T) {
+	outbox.Clear()
+	t.Cleanup(outbox.Clear)
+
+	tests := []struct {
+		amount   int
+		wantBody string
+	}{
+		{amount: 1234, wantBody: "12.34 THB"},
+		{amount: 50000, wantBody: "500.00 THB"},
+		{amount: 5, wantBody: "0.05 THB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantBody, func(t *testing.T) {
+			reference := fmt.Sprintf("topup-%d", tt.amount)
+			id, err := OutboxGateway{}.Charge(7, tt.amount, reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := outbox.List(outbox.ChannelPayment, "user:7")
+			if len(msgs) == 0 {
+				t.Fatal("no charge recorded")
+			}
+			msg := msgs[0]
+			if id != fmt.Sprintf("mock_%d", msg.ID) {
+				t.Errorf("charge ID %q, want mock_%d", id, msg.ID)
+			}
+			if msg.Body != tt.wantBody || msg.Metadata["amount"] != fmt.Sprint(tt.amount) || msg.Metadata["reference"] != reference {
+				t.Errorf("recorded %q %v, want %q with amount %d and reference %q", msg.Body, msg.Metadata, tt.wantBody, tt.amount, reference)
+			}
+		})
+	}
+}
+
+func TestUnconfiguredGateway(t *testing.T) {
+	if id, err := (UnconfiguredGateway{}).Charge(7, 1234, "topup-1"); !errors.Is(err, ErrNotConfigured) || id != "" {
+		t.Errorf("Charge = %q, %v, want %v", id, err, ErrNotConfigured)
+	}
+}
@@ -0,0 +1,245 @@
+// Package points keeps the points balances of users. Every change is an
+// entry in the point_transactions ledger and a points event in the event
+// store, whose projection users.points holds the balance after the latest
+// entry; changes are only made here, with the user row locked, so
+// concurrent transactions cannot overwrite each other's changes or take a
+// balance below zero.
+//
+// Credits are lots that debits use up soonest-expiring first. Earned lots
+// expire after points.expiry_days; Expire takes the expired remainder off
+// the balance. Reconcile checks a balance against the ledger.
+package points
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/tiers"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInsufficientPoints is returned when a redemption or expiry would take
+// the balance below zero.
+var ErrInsufficientPoints = errors.New("insufficient points")
+
+// eventTypes are the domain events of the transaction types.
+var eventTypes = map[string]string{
+	models.PointTransactionEarn:   models.EventPointsEarned,
+	models.PointTransactionRedeem: models.EventPointsRedeemed,
+	models.PointTransactionAdjust: models.EventPointsAdjusted,
+	models.PointTransactionExpire: models.EventPointsExpired,
+}
+
+// expiryDays is the points.expiry_days setting given to Init.
+var expiryDays int
+
+// Init sets how long earned points stay valid.
+func Init(cfg config.PointsConfig) {
+	expiryDays = cfg.ExpiryDays
+}
+
+// Post applies entry to the balance of user: it records it in the ledger
+// and appends its points event, whose projection is the new balance.
+// Amount must be positive for earn, negative for redeem and expire, and
+// non-zero for adjust. Earned points get an expiry date unless entry has
+// one, may move the user up a tier and are published as events. It should
+// run in the same transaction as the change that caused it; user.Points and
+// user.MemberLevel are updated in place. The caller drops the cached reads
+// of the user with cache.InvalidateUser once the transaction has committed:
+// dropped earlier, they could be cached again from the old row.
+func Post(tx *gorm.DB, user *models.User, entry models.PointTransaction) (*models.PointTransaction, error) {
+	switch {
+	case entry.Type == models.PointTransactionEarn && entry.Amount > 0:
+	case entry.Type == models.PointTransactionRedeem && entry.Amount < 0:
+	case entry.Type == models.PointTransactionExpire && entry.Amount < 0:
+	case entry.Type == models.PointTransactionAdjust && entry.Amount != 0:
+	default:
+		return nil, fmt.Errorf("points: invalid %s amount %d", entry.Type, entry.Amount)
+	}
+
+	balance, err := lockBalance(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	balance += entry.Amount
+	if balance < 0 {
+		return nil, ErrInsufficientPoints
+	}
+
+	if entry.Amount > 0 {
+		entry.Remaining = entry.Amount
+		if days := expiryDays; entry.Type == models.PointTransactionEarn && entry.ExpiresAt == nil && days > 0 {
+			expiresAt := time.Now().AddDate(0, 0, days)
+			entry.ExpiresAt = &expiresAt
+		}
+	} else {
+		entry.Remaining = 0
+		if err := useLots(tx, user.ID, -entry.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	entry.ID = 0
+	entry.UserID = user.ID
+	entry.BalanceAfter = balance
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	_, err = eventstore.Append(tx, user, eventTypes[entry.Type], models.DomainEventData{
+		Amount:        entry.Amount,
+		TransactionID: entry.ID,
+		Reason:        entry.Reason,
+		Reference:     entry.Reference,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Type == models.PointTransactionEarn {
+		if _, err := tiers.Evaluate(tx, user, true, tiers.ReasonPointsEarned); err != nil {
+			return nil, err
+		}
+		if err := events.Publish(tx, models.WebhookEventPointsEarned, models.WebhookPointsData{UserID: user.ID, Transaction: entry}); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// SetBalance records the adjustment that brings the balance of user to
+// balance. It records nothing and returns nil when the balance already is
+// that value.
+func SetBalance(tx *gorm.DB, user *models.User, balance int, reason, reference string) (*models.PointTransaction, error) {
+	if balance < 0 {
+		return nil, ErrInsufficientPoints
+	}
+
+	current, err := lockBalance(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == balance {
+		user.Points = balance
+		return nil, nil
+	}
+
+	return Post(tx, user, models.PointTransaction{
+		Type:      models.PointTransactionAdjust,
+		Amount:    balance - current,
+		Reason:    reason,
+		Reference: reference,
+	})
+}
+
+// Expire takes the points left in the lots of user that expired by now off
+// the balance with one expire entry, which it returns. It returns nil when
+// no expired lot has points left.
+func Expire(tx *gorm.DB, user *models.User, now time.Time) (*models.PointTransaction, error) {
+	if _, err := lockBalance(tx, user.ID); err != nil {
+		return nil, err
+	}
+
+	var expired int
+	err := tx.Model(&models.PointTransaction{}).
+		Where("user_id = ? AND remaining > 0 AND expires_at <= ?", user.ID, now).
+		Select("COALESCE(SUM(remaining), 0)").Scan(&expired).Error
+	if err != nil || expired == 0 {
+		return nil, err
+	}
+
+	// The expired lots expire first, so the debit uses exactly them up
+	return Post(tx, user, models.PointTransaction{
+		Type:   models.PointTransactionExpire,
+		Amount: -expired,
+		Reason: "Points expired",
+	})
+}
+
+// Reconcile compares the balance of user with the ledger, with the balance
+// locked. It returns nil when users.points, the total of the entries and the
+// balance after the latest entry agree, and the mismatch otherwise, unsaved.
+// With fix it rebuilds a balance that differs from a ledger agreeing with
+// itself from the event store, which fixes it when the events add up to the
+// ledger's total; a ledger that does not add up to its own latest balance
+// is only reported, for an admin to investigate.
+func Reconcile(tx *gorm.DB, user *models.User, fix bool) (*models.PointsMismatch, error) {
+	balance, err := lockBalance(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	err = tx.Model(&models.PointTransaction{}).Where("user_id = ?", user.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&total).Error
+	if err != nil {
+		return nil, err
+	}
+	var latest models.PointTransaction
+	err = tx.Select("balance_after").Where("user_id = ?", user.ID).Order("id DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	user.Points = balance
+	if balance == total && latest.BalanceAfter == total {
+		return nil, nil
+	}
+
+	mismatch := &models.PointsMismatch{
+		UserID:      user.ID,
+		Balance:     balance,
+		LedgerTotal: total,
+		LastBalance: latest.BalanceAfter,
+	}
+	if fix && latest.BalanceAfter == total && total >= 0 {
+		_, rebuilt, err := eventstore.Rebuild(tx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		user.Points = rebuilt.Points
+		mismatch.Fixed = rebuilt.Points == total
+	}
+	return mismatch, nil
+}
+
+// useLots takes amount points from the lots of a user that expire first;
+// lots that never expire are used last.
+func useLots(tx *gorm.DB, userID uint, amount int) error {
+	var lots []models.PointTransaction
+	err := tx.Select("id", "remaining").
+		Where("user_id = ? AND remaining > 0", userID).
+		Order("expires_at IS NULL, expires_at, id").
+		Find(&lots).Error
+	if err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		if amount == 0 {
+			break
+		}
+		used := min(amount, lot.Remaining)
+		err := tx.Model(&models.PointTransaction{}).Where("id = ?", lot.ID).
+			Update("remaining", lot.Remaining-used).Error
+		if err != nil {
+			return err
+		}
+		amount -= used
+	}
+	return nil
+}
+
+// lockBalance reads the balance of a user and locks the row until tx ends.
+// SQLite has no row locks; its transactions take the database write lock.
+func lockBalance(tx *gorm.DB, userID uint) (int, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Select("id", "points").First(&user, userID).Error
+	return user.Points, err
+}
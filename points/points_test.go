@@ -0,0 +1,235 @@
+package points_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+// lot is an earned lot a test starts with; expiresIn is from now, zero for
+// a lot that never expires.
+type lot struct {
+	amount    int
+	expiresIn time.Duration
+}
+
+// setup creates a user holding lots, posted oldest first, and returns it
+// with the IDs of the lots.
+func setup(t *testing.T, lots []lot) (*gorm.DB, *models.User, []uint) {
+	t.Helper()
+	points.Init(config.PointsConfig{ExpiryDays: 365})
+	db := testutil.NewDB(t)
+	user := testutil.CreateUser(t, db)
+
+	var ids []uint
+	for _, l := range lots {
+		entry := testutil.CreateTransaction(t, db, &user, testutil.WithAmount(l.amount), func(e *models.PointTransaction) {
+			if l.expiresIn != 0 {
+				expiresAt := time.Now().Add(l.expiresIn)
+				e.ExpiresAt = &expiresAt
+			} else {
+				e.Type = models.PointTransactionAdjust
+			}
+		})
+		ids = append(ids, entry.ID)
+	}
+	return db, &user, ids
+}
+
+// check compares the balance of user, stored and in the ledger, and the
+// points left in lots with the expected ones.
+func check(t *testing.T, db *gorm.DB, user *models.User, lots []uint, balance int, remaining []int) {
+	t.Helper()
+	var stored models.User
+	if err := db.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.Points != balance || user.Points != balance {
+		t.Errorf("balance %d stored, %d in place, want %d", stored.Points, user.Points, balance)
+	}
+	var ledger int
+	db.Model(&models.PointTransaction{}).Where("user_id = ?", user.ID).Select("COALESCE(SUM(amount), 0)").Scan(&ledger)
+	if ledger != balance {
+		t.Errorf("ledger adds up to %d, want %d", ledger, balance)
+	}
+
+	var got []int
+	for _, id := range lots {
+		var entry models.PointTransaction
+		if err := db.First(&entry, id).Error; err != nil {
+			t.Fatalf("load lot %d: %v", id, err)
+		}
+		got = append(got, entry.Remaining)
+	}
+	if !slices.Equal(got, remaining) {
+		t.Errorf("lots hold %v, want %v", got, remaining)
+	}
+}
+
+func TestPost(t *testing.T) {
+	// The lots expire in 30 days, tomorrow and never
+	lots := []lot{{100, 30 * 24 * time.Hour}, {50, 24 * time.Hour}, {70, 0}}
+	tests := []struct {
+		name      string
+		entry     models.PointTransaction
+		wantErr   error
+		invalid   bool
+		balance   int
+		remaining []int
+	}{
+		{name: "earn", entry: models.PointTransaction{Type: models.PointTransactionEarn, Amount: 30}, balance: 250, remaining: []int{100, 50, 70}},
+		{name: "redeem from the soonest expiring lot", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -40}, balance: 180, remaining: []int{100, 10, 70}},
+		{name: "redeem across lots", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -120}, balance: 100, remaining: []int{30, 0, 70}},
+		{name: "lots that never expire go last", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -200}, balance: 20, remaining: []int{0, 0, 20}},
+		{name: "redeem everything", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -220}, balance: 0, remaining: []int{0, 0, 0}},
+		{name: "insufficient points", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: -221}, wantErr: points.ErrInsufficientPoints, balance: 220, remaining: []int{100, 50, 70}},
+		{name: "negative adjustment uses lots", entry: models.PointTransaction{Type: models.PointTransactionAdjust, Amount: -60}, balance: 160, remaining: []int{90, 0, 70}},
+		{name: "positive adjustment", entry: models.PointTransaction{Type: models.PointTransactionAdjust, Amount: 15}, balance: 235, remaining: []int{100, 50, 70}},
+		{name: "earn must be positive", entry: models.PointTransaction{Type: models.PointTransactionEarn, Amount: -5}, invalid: true, balance: 220, remaining: []int{100, 50, 70}},
+		{name: "redeem must be negative", entry: models.PointTransaction{Type: models.PointTransactionRedeem, Amount: 5}, invalid: true, balance: 220, remaining: []int{100, 50, 70}},
+		{name: "expire must be negative", entry: models.PointTransaction{Type: models.PointTransactionExpire, Amount: 5}, invalid: true, balance: 220, remaining: []int{100, 50, 70}},
+		{name: "adjustment must not be zero", entry: models.PointTransaction{Type: models.PointTransactionAdjust}, invalid: true, balance: 220, remaining: []int{100, 50, 70}},
+		{name: "unknown type", entry: models.PointTransaction{Type: "gift", Amount: 5}, invalid: true, balance: 220, remaining: []int{100, 50, 70}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, user, ids := setup(t, lots)
+
+			var posted *models.PointTransaction
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				posted, err = points.Post(tx, user, tt.entry)
+				return err
+			})
+			if tt.wantErr != nil || tt.invalid {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("post: error %v, want %v", err, tt.wantErr)
+				}
+				check(t, db, user, ids, tt.balance, tt.remaining)
+				return
+			}
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+
+			if posted.BalanceAfter != tt.balance || posted.UserID != user.ID {
+				t.Errorf("posted balance after %d for user %d, want %d for %d", posted.BalanceAfter, posted.UserID, tt.balance, user.ID)
+			}
+			check(t, db, user, ids, tt.balance, tt.remaining)
+
+			// Credits are new lots; only earned points expire
+			wantRemaining := max(tt.entry.Amount, 0)
+			if posted.Remaining != wantRemaining {
+				t.Errorf("new entry holds %d, want %d", posted.Remaining, wantRemaining)
+			}
+			if expires := posted.ExpiresAt != nil; expires != (tt.entry.Type == models.PointTransactionEarn) {
+				t.Errorf("new entry expires at %v", posted.ExpiresAt)
+			} else if expires {
+				want := time.Now().AddDate(0, 0, 365)
+				if posted.ExpiresAt.Sub(want).Abs() > time.Minute {
+					t.Errorf("earned points expire at %v, want about %v", posted.ExpiresAt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	tests := []struct {
+		name      string
+		lots      []lot
+		redeem    int
+		expired   int
+		balance   int
+		remaining []int
+	}{
+		{name: "nothing expired", lots: []lot{{100, time.Hour}, {50, 0}}, balance: 150, remaining: []int{100, 50}},
+		{name: "expired lot", lots: []lot{{100, time.Hour}, {50, 0}}, expired: 100, balance: 50, remaining: []int{0, 50}},
+		{name: "partly used lot", lots: []lot{{100, time.Hour}, {50, 2 * time.Hour}}, redeem: 30, expired: 70, balance: 50, remaining: []int{0, 50}},
+		{name: "used up lot", lots: []lot{{100, time.Hour}, {50, 0}}, redeem: 100, balance: 50, remaining: []int{0, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, user, ids := setup(t, tt.lots)
+			if tt.redeem > 0 {
+				testutil.CreateTransaction(t, db, user, testutil.Redeemed(tt.redeem))
+			}
+
+			// The first lot has expired by then, the others not
+			now := time.Now()
+			if tt.expired > 0 {
+				now = now.Add(90 * time.Minute)
+			}
+			var entry *models.PointTransaction
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				entry, err = points.Expire(tx, user, now)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("expire: %v", err)
+			}
+			switch {
+			case tt.expired == 0 && entry != nil:
+				t.Errorf("expired %d points, want none", -entry.Amount)
+			case tt.expired > 0 && (entry == nil || entry.Amount != -tt.expired || entry.Type != models.PointTransactionExpire):
+				t.Errorf("expire entry %+v, want %d expired points", entry, tt.expired)
+			}
+			check(t, db, user, ids, tt.balance, tt.remaining)
+		})
+	}
+}
+
+func TestSetBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int
+		amount  int
+		wantErr bool
+	}{
+		{name: "raise", balance: 250, amount: 100},
+		{name: "lower", balance: 40, amount: -110},
+		{name: "to zero", balance: 0, amount: -150},
+		{name: "unchanged", balance: 150},
+		{name: "negative", balance: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, user, _ := setup(t, []lot{{150, time.Hour}})
+
+			var entry *models.PointTransaction
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				entry, err = points.SetBalance(tx, user, tt.balance, "Correction", "ticket:42")
+				return err
+			})
+			if tt.wantErr {
+				if !errors.Is(err, points.ErrInsufficientPoints) {
+					t.Fatalf("set balance: error %v, want %v", err, points.ErrInsufficientPoints)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("set balance: %v", err)
+			}
+			if tt.amount == 0 {
+				if entry != nil {
+					t.Errorf("recorded %+v, want nothing", entry)
+				}
+			} else if entry == nil || entry.Type != models.PointTransactionAdjust || entry.Amount != tt.amount || entry.Reference != "ticket:42" {
+				t.Errorf("recorded %+v, want an adjustment of %d", entry, tt.amount)
+			}
+			if user.Points != tt.balance {
+				t.Errorf("balance %d, want %d", user.Points, tt.balance)
+			}
+		})
+	}
+}
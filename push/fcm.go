@@ -0,0 +1,199 @@
+package push
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// FCMEndpoint is the base URL of the FCM HTTP v1 API.
+	FCMEndpoint = "https://fcm.googleapis.com/v1"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCM sends notifications through Firebase Cloud Messaging with a service
+// account, which reaches both Android and iOS apps.
+type FCM struct {
+	ProjectID   string
+	ClientEmail string
+	TokenURL    string
+	Endpoint    string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// serviceAccount is the part of a Google service account key file FCM
+// needs.
+type serviceAccount struct {
+	Type        string `json:"type"`
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	ClientEmail string `json:"client_email"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCM returns an FCM sender for the service account in the JSON key file
+// credentialsFile, downloaded from the Firebase console.
+func NewFCM(credentialsFile string) (*FCM, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("%s: %w", credentialsFile, err)
+	}
+	if account.Type != "service_account" || account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, fmt.Errorf("%s: not a service account key", credentialsFile)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", credentialsFile, err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	return &FCM{
+		ProjectID:   account.ProjectID,
+		ClientEmail: account.ClientEmail,
+		TokenURL:    account.TokenURI,
+		Endpoint:    FCMEndpoint,
+		key:         key,
+		client:      &http.Client{Timeout: 30 * time.Second, Transport: requestid.Transport(tracing.Transport(nil))},
+	}, nil
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string          `json:"token"`
+	Notification fcmNotification `json:"notification"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmError struct {
+	Error struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (f *FCM) Send(token, title, body string) error {
+	accessToken, err := f.token()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(fcmRequest{Message: fcmMessage{
+		Token:        token,
+		Notification: fcmNotification{Title: title, Body: body},
+	}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.Endpoint+"/projects/"+url.PathEscape(f.ProjectID)+"/messages:send", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push: fcm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var result fcmError
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result)
+	// UNREGISTERED means the app was uninstalled or the token rotated;
+	// SENDER_ID_MISMATCH a token of another Firebase project
+	for _, detail := range result.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" || detail.ErrorCode == "SENDER_ID_MISMATCH" {
+			return ErrUnregistered
+		}
+	}
+	if result.Error.Status == "INVALID_ARGUMENT" && strings.Contains(result.Error.Message, "registration token") {
+		return ErrUnregistered
+	}
+	return fmt.Errorf("push: fcm: %s: %s", resp.Status, result.Error.Message)
+}
+
+// token returns an OAuth access token for the service account, fetching a
+// new one shortly before the current one expires.
+func (f *FCM) token() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Now().Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := f.client.PostForm(f.TokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("push: fcm access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("push: fcm access token: %s %s", resp.Status, result.Error)
+	}
+	if result.ExpiresIn <= 0 {
+		return "", errors.New("push: fcm access token without lifetime")
+	}
+
+	f.accessToken = result.AccessToken
+	f.expiresAt = now.Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return f.accessToken, nil
+}
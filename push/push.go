@@ -0,0 +1,96 @@
+// Package push sends push notifications to users' registered devices
+// through Firebase Cloud Messaging when push.driver is fcm.
+package push
+
+import (
+	"errors"
+	"log"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/outbox"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnregistered is returned by senders when the provider reports that a
+// token is no longer valid, e.g. FCM's UNREGISTERED error after the app was
+// uninstalled.
+var ErrUnregistered = errors.New("push token is no longer registered")
+
+// Sender delivers a notification to one device push token.
+type Sender interface {
+	Send(token, title, body string) error
+}
+
+// Default is the sender of the handlers unless they are given another.
+// Notifications are only logged until Init configures FCM, or the outbox in
+// PROVIDERS_MODE=mock.
+var Default Sender = LogSender{}
+
+// Init sets Default to the driver in cfg. PROVIDERS_MODE=mock selects the
+// outbox whatever the driver.
+func Init(cfg config.PushConfig) error {
+	if outbox.MockMode() {
+		Default = OutboxSender{}
+		return nil
+	}
+	if cfg.Driver != "fcm" {
+		return nil
+	}
+	fcm, err := NewFCM(cfg.FCM.CredentialsFile)
+	if err != nil {
+		return err
+	}
+	Default = fcm
+	log.Printf("Sending push notifications through FCM project %s", fcm.ProjectID)
+	return nil
+}
+
+// NotifyUser sends a notification with sender, usually Default, to every
+// device of the user that has a push token, and clears tokens the provider rejects as unregistered so they
+// are not tried again. It returns the number of devices notified.
+func NotifyUser(sender Sender, db *gorm.DB, userID uint, title, body string) (int, error) {
+	var devices []models.Device
+	if err := db.Where("user_id = ? AND push_token <> ''", userID).Find(&devices).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, device := range devices {
+		err := sender.Send(device.PushToken, title, body)
+		switch {
+		case errors.Is(err, ErrUnregistered):
+			log.Printf("[push] pruning unregistered token of device %d", device.ID)
+			if err := db.Model(&device).Update("push_token", "").Error; err != nil {
+				return sent, err
+			}
+		case err != nil:
+			log.Printf("[push] delivery to device %d failed: %v", device.ID, err)
+		default:
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// OutboxSender records notifications in the mock provider outbox.
+type OutboxSender struct{}
+
+func (OutboxSender) Send(token, title, body string) error {
+	outbox.Record(outbox.Message{
+		Channel: outbox.ChannelPush,
+		To:      token,
+		Subject: title,
+		Body:    body,
+	})
+	return nil
+}
+
+// LogSender writes a line to the log instead of delivering.
+type LogSender struct{}
+
+func (LogSender) Send(token, title, body string) error {
+	log.Printf("[push] %q not delivered: no push provider configured", title)
+	return nil
+}
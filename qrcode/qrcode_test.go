@@ -0,0 +1,182 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		wantSize int
+		wantErr  error
+	}{
+		{name: "empty", length: 0, wantSize: 21},
+		{name: "version 1 full", length: 14, wantSize: 21},
+		{name: "version 2", length: 15, wantSize: 25},
+		{name: "signed token", length: 100, wantSize: 41},
+		{name: "version 10 count field", length: 200, wantSize: 57},
+		{name: "version 13 full", length: 331, wantSize: 69},
+		{name: "too long", length: 332, wantErr: ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(bytes.Repeat([]byte("a"), tt.length))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && code.Size != tt.wantSize {
+				t.Errorf("size %d, want %d", code.Size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestAddErrorCorrection(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		data    []byte
+		want    []byte
+	}{
+		{
+			// The version 1-M example of ISO/IEC 18004 Annex I, "01234567"
+			name:    "standard example",
+			version: 1,
+			data:    []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			want: []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11,
+				0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			name:    "zero codewords have zero remainder",
+			version: 1,
+			data:    make([]byte, 16),
+			want:    make([]byte, 26),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addErrorCorrection(tt.data, layouts[tt.version])
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("codewords % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddErrorCorrectionInterleaves(t *testing.T) {
+	layout := layouts[8]
+	data := make([]byte, layout.dataCodewords())
+	for i := range data {
+		data[i] = byte(i)
+	}
+	got := addErrorCorrection(data, layout)
+
+	// Version 8 has blocks of 38, 38, 39 and 39 data codewords: the first
+	// codewords of each block come first, and the extra codeword of the
+	// longer blocks comes after the last round
+	tests := []struct {
+		index int
+		want  byte
+	}{
+		{0, 0}, {1, 38}, {2, 76}, {3, 115},
+		{4, 1},
+		{4 * 38, 76 + 38}, {4*38 + 1, 115 + 38},
+	}
+	for _, tt := range tests {
+		if got[tt.index] != tt.want {
+			t.Errorf("codeword %d is %d, want %d", tt.index, got[tt.index], tt.want)
+		}
+	}
+	if want := layout.dataCodewords() + 4*layout.ecPerBlock; len(got) != want {
+		t.Errorf("%d codewords, want %d", len(got), want)
+	}
+}
+
+// membershipSymbol is the symbol of "LBK00001", checked with an independent
+// decoder.
+var membershipSymbol = []string{
+	"#######.#...#.#######",
+	"#.....#.####..#.....#",
+	"#.###.#.###...#.###.#",
+	"#.###.#..##.#.#.###.#",
+	"#.###.#.##..#.#.###.#",
+	"#.....#..#.##.#.....#",
+	"#######.#.#.#.#######",
+	".........#.##........",
+	"#..########.##..#.###",
+	"####.#.##.#.#.##..#.#",
+	".##..####.#..###.#.##",
+	"#.#.#....###....#.#..",
+	"#####.#..#...######..",
+	"........#.###..##..##",
+	"#######.#.#.######...",
+	"#.....#.#.####..#.#.#",
+	"#.###.#.##.##.##.....",
+	"#.###.#.#..##..#.##..",
+	"#.###.#...#...#######",
+	"#.....#......##...###",
+	"#######.#.##...###...",
+}
+
+func TestEncodeSymbol(t *testing.T) {
+	code, err := Encode([]byte("LBK00001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y, want := range membershipSymbol {
+		var row strings.Builder
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		if row.String() != want {
+			t.Errorf("row %d is %s, want %s", y, row.String(), want)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("LBK00001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		scale     int
+		wantWidth int
+	}{
+		{name: "scaled", scale: 8, wantWidth: (21 + 8) * 8},
+		{name: "below one", scale: 0, wantWidth: 21 + 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := code.PNG(tt.scale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width := img.Bounds().Dx(); width != tt.wantWidth || img.Bounds().Dy() != width {
+				t.Fatalf("bounds %v, want %d square", img.Bounds(), tt.wantWidth)
+			}
+			scale := max(tt.scale, 1)
+			if got := color.GrayModel.Convert(img.At(0, 0)).(color.Gray).Y; got != 0xFF {
+				t.Errorf("quiet zone is %d, want white", got)
+			}
+			if got := color.GrayModel.Convert(img.At(quietZone*scale, quietZone*scale)).(color.Gray).Y; got != 0 {
+				t.Errorf("finder corner is %d, want black", got)
+			}
+		})
+	}
+}
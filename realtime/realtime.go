@@ -0,0 +1,197 @@
+// Package realtime pushes the points balances of members to the streams
+// they have open, such as the app's balance display at the cashier.
+//
+// The hub follows the point_transactions ledger rather than being told of
+// each entry: every pollInterval it reads the entries posted since the last
+// one each subscribed member has seen. Entries posted by any instance or
+// worker reach the member's streams on every instance, and only committed
+// entries are read, whichever code path posted them. A member's entries are
+// posted with their balance locked, so their IDs grow in the order they
+// commit and the last ID seen is all a subscription needs to remember.
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/worker"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// pollInterval is how often the ledger is read for new entries.
+	pollInterval = 500 * time.Millisecond
+	// usersPerQuery is how many members one read of the ledger covers.
+	usersPerQuery = 100
+	// buffer is how many updates a subscription holds for a stream that is
+	// slow to send them; further updates are dropped until it catches up.
+	buffer = 16
+)
+
+// Hub fans the new entries of the ledger out to the subscriptions of their
+// members.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[uint]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns a hub without subscriptions.
+func NewHub() *Hub {
+	return &Hub{subs: map[uint]map[*Subscription]struct{}{}}
+}
+
+// Default is the hub of the handlers unless they are given another.
+var Default = NewHub()
+
+// Subscription receives the balance updates of a member.
+type Subscription struct {
+	// Updates is closed when the subscription or the hub is closed
+	Updates <-chan models.BalanceUpdate
+
+	hub     *Hub
+	userID  uint
+	updates chan models.BalanceUpdate
+	// after is the ID of the last entry seen
+	after uint
+}
+
+// Subscribe returns a subscription to the entries of userID posted after the
+// entry with ID after. On a closed hub its Updates are closed at once.
+func (h *Hub) Subscribe(userID, after uint) *Subscription {
+	updates := make(chan models.BalanceUpdate, buffer)
+	sub := &Subscription{Updates: updates, hub: h, userID: userID, updates: updates, after: after}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(updates)
+		return sub
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Close ends the subscription. It may be called more than once.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s.userID][s]; !ok {
+		return
+	}
+	delete(h.subs[s.userID], s)
+	if len(h.subs[s.userID]) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.updates)
+}
+
+// Close ends every subscription and refuses new ones, so the streams end
+// before the server waits for its requests to finish at shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			close(sub.updates)
+		}
+	}
+	h.subs = map[uint]map[*Subscription]struct{}{}
+}
+
+// Subscribers is the number of open subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+// Start reads the ledger every pollInterval in the background until
+// shutdown.
+func (h *Hub) Start(db *gorm.DB) {
+	worker.Go("balance feed", func(ctx context.Context) {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := h.Poll(ctx, db); err != nil {
+					log.Printf("[realtime] reading the points ledger failed: %v", err)
+				}
+			}
+		}
+	})
+}
+
+// Poll sends the entries posted since the last poll to the subscriptions of
+// their members.
+func (h *Hub) Poll(ctx context.Context, db *gorm.DB) error {
+	// The earliest entry any of a member's subscriptions still waits for
+	h.mu.Lock()
+	after := make(map[uint]uint, len(h.subs))
+	for userID, subs := range h.subs {
+		first := true
+		for sub := range subs {
+			if first || sub.after < after[userID] {
+				after[userID] = sub.after
+			}
+			first = false
+		}
+	}
+	h.mu.Unlock()
+
+	// The reads repeat twice a second; only slow and failed ones are logged
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(logger.Warn)})
+	users := make([]uint, 0, len(after))
+	for userID := range after {
+		users = append(users, userID)
+	}
+	for start := 0; start < len(users); start += usersPerQuery {
+		query := db.WithContext(ctx).Where("1 = 0")
+		for _, userID := range users[start:min(start+usersPerQuery, len(users))] {
+			query = query.Or("user_id = ? AND id > ?", userID, after[userID])
+		}
+		var entries []models.PointTransaction
+		if err := query.Order("id").Find(&entries).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			h.send(entry)
+		}
+	}
+	return nil
+}
+
+// send gives entry to the subscriptions of its member that have not seen
+// it.
+func (h *Hub) send(entry models.PointTransaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[entry.UserID] {
+		if entry.ID <= sub.after {
+			continue
+		}
+		sub.after = entry.ID
+		select {
+		case sub.updates <- models.BalanceUpdate{Balance: entry.BalanceAfter, Transaction: &entry}:
+		default:
+			log.Printf("[realtime] stream of user %d is behind; dropped the update for entry %d", entry.UserID, entry.ID)
+		}
+	}
+}
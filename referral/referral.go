@@ -0,0 +1,135 @@
+// Package referral links new members to the member whose referral code they
+// registered with, and pays both the referral bonus once the new member has
+// verified their email address.
+package referral
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/points"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownCode is returned for referral codes no current member has.
+var ErrUnknownCode = errors.New("unknown referral code")
+
+// settings are the bonus points given to Init.
+var settings config.ReferralsConfig
+
+// Init sets the bonus points paid for completed referrals.
+func Init(cfg config.ReferralsConfig) {
+	settings = cfg
+}
+
+// NewCode returns a referral code such as K7QM2XPA: eight characters that
+// are easy to read out and type.
+func NewCode() string {
+	return rand.Text()[:8]
+}
+
+// Refer records that code referred the new member user. It should run in
+// the transaction that creates the user.
+func Refer(tx *gorm.DB, user *models.User, code string) (*models.Referral, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	var referrer models.User
+	err := tx.Select("id").Where("referral_code = ?", code).First(&referrer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || referrer.ID == user.ID {
+		return nil, ErrUnknownCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	referral := models.Referral{
+		ReferrerID: referrer.ID,
+		ReferredID: user.ID,
+		Code:       code,
+		Status:     models.ReferralPending,
+	}
+	return &referral, tx.Create(&referral).Error
+}
+
+// Complete pays the bonuses of the pending referral of the member userID
+// and returns it, or nil when there is none. It should run in the
+// transaction that verifies the member; a referral completes only once. A
+// referrer whose account was deleted in the meantime gets nothing.
+func Complete(tx *gorm.DB, userID uint) (*models.Referral, error) {
+	var referral models.Referral
+	err := tx.Where("referred_id = ? AND status = ?", userID, models.ReferralPending).First(&referral).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claim := tx.Model(&models.Referral{}).
+		Where("id = ? AND status = ?", referral.ID, models.ReferralPending).
+		Updates(map[string]interface{}{"status": models.ReferralCompleted, "completed_at": now})
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return nil, nil
+	}
+	referral.Status = models.ReferralCompleted
+	referral.CompletedAt = &now
+
+	if referral.ReferredPoints, err = pay(tx, &referral, userID, settings.ReferredPoints); err != nil {
+		return nil, err
+	}
+	if referral.ReferrerPoints, err = pay(tx, &referral, referral.ReferrerID, settings.ReferrerPoints); err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(&models.Referral{}).Where("id = ?", referral.ID).Updates(map[string]interface{}{
+		"referrer_points": referral.ReferrerPoints,
+		"referred_points": referral.ReferredPoints,
+	}).Error
+	return &referral, err
+}
+
+// pay credits amount to the member userID as the bonus of referral and
+// returns the points paid.
+func pay(tx *gorm.DB, referral *models.Referral, userID uint, amount int) (int, error) {
+	if amount == 0 {
+		return 0, nil
+	}
+
+	var user models.User
+	err := tx.First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = points.Post(tx, &user, models.PointTransaction{
+		Type:      models.PointTransactionEarn,
+		Amount:    amount,
+		Reason:    "Referral bonus",
+		Reference: fmt.Sprintf("referral:%d", referral.ID),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Create(&models.AuditLog{
+		Actor:      fmt.Sprintf("referral:%d", referral.ID),
+		Action:     "referral.award",
+		Resource:   "users",
+		ResourceID: userID,
+		Fields:     []string{"points"},
+	}).Error
+	return amount, err
+}
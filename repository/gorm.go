@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/referral"
+	"temp-backend-at-kbtg/tiers"
+
+	"gorm.io/gorm"
+)
+
+// gormStore implements every repository on one *gorm.DB, which is a
+// transaction inside Transaction.
+type gormStore struct {
+	db *gorm.DB
+}
+
+// New returns a Store backed by db.
+func New(db *gorm.DB) Store {
+	return gormStore{db: db}
+}
+
+func (s gormStore) Users() Users         { return gormUsers(s) }
+func (s gormStore) Points() Points       { return gormPoints(s) }
+func (s gormStore) Tiers() Tiers         { return gormTiers(s) }
+func (s gormStore) Campaigns() Campaigns { return gormCampaigns(s) }
+func (s gormStore) Referrals() Referrals { return gormReferrals(s) }
+func (s gormStore) Events() Events       { return gormEvents(s) }
+func (s gormStore) AuditLogs() AuditLogs { return gormAuditLogs(s) }
+func (s gormStore) Sessions() Sessions   { return gormSessions(s) }
+
+func (s gormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(gormStore{db: tx})
+	})
+}
+
+type gormUsers gormStore
+
+func (r gormUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r gormUsers) GetByMembershipID(ctx context.Context, membershipID string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("membership_id = ?", membershipID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmail also matches rows whose canonical email could not be
+// back-filled, on the exact address.
+func (r gormUsers) GetByEmail(ctx context.Context, email, canonical string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).
+		Where("email_canonical = ? OR (email_canonical = '' AND email = ?)", canonical, email).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r gormUsers) TwoFactorEnabled(ctx context.Context, userID uint) (bool, error) {
+	var enabled int64
+	err := r.db.WithContext(ctx).Model(&models.TwoFactor{}).
+		Where("user_id = ? AND enabled_at IS NOT NULL", userID).
+		Count(&enabled).Error
+	return enabled > 0, err
+}
+
+func (r gormUsers) EmailTaken(ctx context.Context, email, canonical string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("email_canonical = ? OR email = ?", canonical, email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r gormUsers) Update(ctx context.Context, user *models.User, columns ...string) error {
+	return r.db.WithContext(ctx).Model(user).Select(columns).Updates(user).Error
+}
+
+type gormPoints gormStore
+
+func (r gormPoints) Post(ctx context.Context, user *models.User, entry models.PointTransaction) (*models.PointTransaction, error) {
+	return points.Post(r.db.WithContext(ctx), user, entry)
+}
+
+func (r gormPoints) History(ctx context.Context, userID uint, params pagination.Params) (models.PagedResponse, error) {
+	return pagination.Find[models.PointTransaction](r.db.WithContext(ctx).Where("user_id = ?", userID), params)
+}
+
+func (r gormPoints) GetByIdempotencyKey(ctx context.Context, reference, key string) (*models.PointTransaction, error) {
+	var entry models.PointTransaction
+	err := r.db.WithContext(ctx).Where("reference = ? AND idempotency_key = ?", reference, key).First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+type gormTiers gormStore
+
+func (r gormTiers) Initial(ctx context.Context) (string, error) {
+	return tiers.Initial(r.db.WithContext(ctx))
+}
+
+func (r gormTiers) Qualifying(ctx context.Context, userID uint, now time.Time) (int, error) {
+	return tiers.Qualifying(r.db.WithContext(ctx), userID, now)
+}
+
+func (r gormTiers) Next(ctx context.Context, code string) (*models.MemberTier, error) {
+	return tiers.Next(r.db.WithContext(ctx), code)
+}
+
+type gormCampaigns gormStore
+
+func (r gormCampaigns) Award(ctx context.Context, user *models.User, event string) (int, error) {
+	return campaign.Award(r.db.WithContext(ctx), user, event)
+}
+
+type gormReferrals gormStore
+
+func (r gormReferrals) Refer(ctx context.Context, user *models.User, code string) error {
+	_, err := referral.Refer(r.db.WithContext(ctx), user, code)
+	return err
+}
+
+type gormEvents gormStore
+
+func (r gormEvents) Publish(ctx context.Context, event string, data interface{}) error {
+	return events.Publish(r.db.WithContext(ctx), event, data)
+}
+
+type gormAuditLogs gormStore
+
+func (r gormAuditLogs) Create(ctx context.Context, entry *models.AuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+type gormSessions gormStore
+
+func (r gormSessions) Start(ctx context.Context, userID uint, ip, userAgent string) (string, string, error) {
+	return middleware.StartSession(r.db.WithContext(ctx), userID, ip, userAgent)
+}
+
+func (r gormSessions) Rotate(ctx context.Context, token string) (models.RefreshToken, string, error) {
+	return middleware.RotateRefreshToken(r.db.WithContext(ctx), token)
+}
+
+func (r gormSessions) Touch(ctx context.Context, sessionID, ip string) error {
+	return middleware.TouchSession(r.db.WithContext(ctx), sessionID, ip)
+}
+
+func (r gormSessions) RevokeAccess(ctx context.Context, claims *middleware.Claims) error {
+	return middleware.RevokeToken(r.db.WithContext(ctx), claims)
+}
+
+func (r gormSessions) RevokeRefresh(ctx context.Context, token string) error {
+	return middleware.RevokeRefreshToken(r.db.WithContext(ctx), token)
+}
@@ -0,0 +1,125 @@
+// Package repository puts interfaces in front of the database reads and
+// writes of the service layer, so services can be exercised with fakes and
+// reused outside HTTP handlers. New returns the GORM implementation; every
+// repository of a Store works on the same connection or transaction.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned by repositories. They are the GORM errors, so callers
+// that still use GORM directly can match either.
+var (
+	ErrNotFound  = gorm.ErrRecordNotFound
+	ErrDuplicate = gorm.ErrDuplicatedKey
+)
+
+// Store gives access to the repositories.
+type Store interface {
+	Users() Users
+	Points() Points
+	Tiers() Tiers
+	Campaigns() Campaigns
+	Referrals() Referrals
+	Events() Events
+	AuditLogs() AuditLogs
+	Sessions() Sessions
+	// Transaction runs fn with a Store whose repositories all work in one
+	// transaction, committed when fn returns nil and rolled back otherwise.
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
+
+// Users reads and writes accounts.
+type Users interface {
+	// Get returns the user with id, or ErrNotFound.
+	Get(ctx context.Context, id uint) (*models.User, error)
+	// GetByMembershipID returns the user with the membership ID, or
+	// ErrNotFound.
+	GetByMembershipID(ctx context.Context, membershipID string) (*models.User, error)
+	// GetByEmail returns the user who signs in with email, matched on its
+	// canonical form, or ErrNotFound.
+	GetByEmail(ctx context.Context, email, canonical string) (*models.User, error)
+	// TwoFactorEnabled reports whether userID signs in with a second
+	// factor.
+	TwoFactorEnabled(ctx context.Context, userID uint) (bool, error)
+	// EmailTaken reports whether an account uses email or an address with
+	// the same canonical form.
+	EmailTaken(ctx context.Context, email, canonical string) (bool, error)
+	Create(ctx context.Context, user *models.User) error
+	// Update writes the named columns of user, leaving the others as they
+	// are in the database.
+	Update(ctx context.Context, user *models.User, columns ...string) error
+}
+
+// Points reads and writes the points ledger.
+type Points interface {
+	// Post applies entry to the balance of user, as points.Post does.
+	Post(ctx context.Context, user *models.User, entry models.PointTransaction) (*models.PointTransaction, error)
+	// History returns a page of the entries of userID.
+	History(ctx context.Context, userID uint, params pagination.Params) (models.PagedResponse, error)
+	// GetByIdempotencyKey returns the entry posted by reference with key,
+	// or ErrNotFound.
+	GetByIdempotencyKey(ctx context.Context, reference, key string) (*models.PointTransaction, error)
+}
+
+// Tiers reads the membership tiers.
+type Tiers interface {
+	// Initial returns the code of the tier of a new member.
+	Initial(ctx context.Context) (string, error)
+	// Qualifying returns the points userID earned in the qualifying period
+	// that ends at now.
+	Qualifying(ctx context.Context, userID uint, now time.Time) (int, error)
+	// Next returns the tier ranked just above code, or nil at the top tier.
+	Next(ctx context.Context, code string) (*models.MemberTier, error)
+}
+
+// Campaigns awards onboarding campaigns.
+type Campaigns interface {
+	// Award grants user the running campaigns for event, as campaign.Award
+	// does, and returns the points added.
+	Award(ctx context.Context, user *models.User, event string) (int, error)
+}
+
+// Referrals links new members to the members who referred them.
+type Referrals interface {
+	// Refer records that code referred user, or returns
+	// referral.ErrUnknownCode.
+	Refer(ctx context.Context, user *models.User, code string) error
+}
+
+// Events publishes domain events through the outbox.
+type Events interface {
+	Publish(ctx context.Context, event string, data interface{}) error
+}
+
+// AuditLogs records changes in the audit log.
+type AuditLogs interface {
+	Create(ctx context.Context, entry *models.AuditLog) error
+}
+
+// Sessions keeps the sign-ins of members: each session has a refresh token
+// that is rotated on every use, and the access tokens issued for it can be
+// revoked one by one.
+type Sessions interface {
+	// Start starts a session for userID from the client at ip and returns
+	// its ID and first refresh token.
+	Start(ctx context.Context, userID uint, ip, userAgent string) (string, string, error)
+	// Rotate exchanges a refresh token for the next one of its session, as
+	// middleware.RotateRefreshToken does.
+	Rotate(ctx context.Context, token string) (models.RefreshToken, string, error)
+	// Touch records that sessionID was used from ip.
+	Touch(ctx context.Context, sessionID, ip string) error
+	// RevokeAccess revokes the access token of claims.
+	RevokeAccess(ctx context.Context, claims *middleware.Claims) error
+	// RevokeRefresh revokes a refresh token with every token rotated from
+	// the same sign-in.
+	RevokeRefresh(ctx context.Context, token string) error
+}
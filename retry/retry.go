@@ -0,0 +1,42 @@
+// Package retry is the policy shared by work that is tried again after a
+// failure, such as webhook deliveries, published events, jobs and sagas:
+// how long to wait, and what of the error to keep.
+package retry
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// MaxErrorLength is how many bytes of an error Error keeps.
+const MaxErrorLength = 500
+
+// Backoff is how soon failed work is tried again: Delay after the first
+// failure, doubling with every further failure up to MaxDelay.
+type Backoff struct {
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// After returns the delay after the attempts-th failed attempt.
+func (b Backoff) After(attempts int) time.Duration {
+	delay := b.Delay
+	for i := 1; i < attempts && delay < b.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, b.MaxDelay)
+}
+
+// Error returns the message of err cut to MaxErrorLength bytes, for the
+// last_error and error columns.
+func Error(err error) string {
+	s := err.Error()
+	if len(s) <= MaxErrorLength {
+		return s
+	}
+	n := MaxErrorLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
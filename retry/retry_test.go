@@ -0,0 +1,52 @@
+package retry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffAfter(t *testing.T) {
+	b := Backoff{Delay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 5, want: 8 * time.Minute},
+		{attempts: 10, want: 256 * time.Minute},
+		{attempts: 11, want: 6 * time.Hour},
+		{attempts: 1000, want: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := b.After(tt.attempts); got != tt.want {
+			t.Errorf("After(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+	if got := (Backoff{Delay: time.Minute}).After(1); got != 0 {
+		t.Errorf("After without a max delay = %s, want 0", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{name: "short", msg: "connection refused", want: "connection refused"},
+		{name: "at the limit", msg: strings.Repeat("a", MaxErrorLength), want: strings.Repeat("a", MaxErrorLength)},
+		{name: "long", msg: strings.Repeat("a", MaxErrorLength+1), want: strings.Repeat("a", MaxErrorLength)},
+		// "ก" is three bytes, so the 167th ends past the limit
+		{name: "cut inside a character", msg: strings.Repeat("ก", 200), want: strings.Repeat("ก", 166)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Error(errors.New(tt.msg)); got != tt.want {
+				t.Errorf("Error = %q (%d bytes), want %d bytes", got, len(got), len(tt.want))
+			}
+		})
+	}
+}
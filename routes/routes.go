@@ -0,0 +1,304 @@
+package routes
+
+import (
+	"strings"
+
+	"temp-backend-at-kbtg/adminui"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// apiVersions are the versions of the API, oldest first. Each is served
+// under /api/<version>; a version is added when responses have to change
+// in ways existing clients would not expect.
+var apiVersions = []string{"v1"}
+
+// legacyPrefixes are the paths the API was served at before it was
+// versioned. They keep working, as the version the client asks for, for
+// clients built against them; routes added since exist only under /api.
+var legacyPrefixes = []string{
+	"/auth", "/protected", "/profile", "/rewards", "/coupons", "/wallet", "/notifications",
+	"/sync", "/partner", "/membership", "/points", "/admin", "/debug",
+}
+
+// Setup registers all routes on app, served by h and authenticated against
+// db: the probes, files and provider webhooks at the root, and the API
+// under /api/v1.
+func Setup(app fiber.Router, cfg *config.Config, db *gorm.DB, h *handlers.Handler) {
+	app.Get("/", h.HelloWorld)
+	app.Get("/.well-known/jwks.json", h.GetJWKS)
+
+	// Probes for Kubernetes and load balancers; no auth or rate limit
+	app.Get("/healthz", h.Liveness)
+	app.Get("/readyz", h.Readiness)
+
+	// Files of the local storage driver: public ones, which get a new
+	// random key on every upload and so can be cached, and presigned links
+	// to the others
+	if local, ok := h.Storage().(*storage.Local); ok {
+		app.Static("/uploads", local.Dir, fiber.Static{
+			MaxAge: 86400,
+			Next: func(c *fiber.Ctx) bool {
+				// The cleaned path the file server resolves
+				path := strings.TrimPrefix(string(c.Context().Path()), middleware.BasePath()+"/uploads/")
+				return !storage.IsPublic(path)
+			},
+		})
+		app.Get("/files/*", h.DownloadFile)
+	}
+
+	// The admin console is static; it signs in through /api/v1/auth/login
+	// and sends the access token with each API call, so it is mounted ahead
+	// of the admin routes' role check
+	app.Use("/admin/ui", adminui.Handler())
+
+	// Provider webhooks, authenticated by a shared secret. The providers
+	// are configured with these URLs, so they are not versioned.
+	webhooks := app.Group("/webhooks")
+	webhooks.Post("/email", middleware.WebhookSecretMiddleware(cfg.WebhookSecrets.Email, "email-provider"), h.EmailWebhook)
+	webhooks.Post("/sms", middleware.WebhookSecretMiddleware(cfg.WebhookSecrets.SMS, "sms-provider"), h.SMSWebhook)
+	// Twilio signs its reports with the account's auth token instead
+	webhooks.Post("/sms/twilio", h.TwilioSMSWebhook)
+
+	// The unversioned paths are rewritten to a version before routing, so
+	// this must come ahead of the versioned routes
+	app.Use(middleware.LegacyPaths(legacyPrefixes, apiVersions))
+
+	// The API serves the tenant named in X-Tenant-ID from its shard
+	setupV1(app.Group("/api/v1", middleware.APIVersion("v1"), middleware.Tenant(h.Shards().Tenants())), cfg, db, h)
+}
+
+// setupV1 registers the routes of version 1 of the API on app.
+func setupV1(app fiber.Router, cfg *config.Config, db *gorm.DB, h *handlers.Handler) {
+	// Auth routes
+	auth := app.Group("/auth", middleware.AuthRateLimit(cfg.RateLimit.Auth))
+	auth.Post("/register", h.Register)
+	auth.Post("/login", h.Login)
+	auth.Post("/refresh", h.Refresh)
+	auth.Post("/logout", h.Logout)
+	auth.Post("/forgot-password", h.ForgotPassword)
+	auth.Post("/reset-password", h.ResetPassword)
+	auth.Post("/verify-email", h.VerifyEmail)
+	auth.Post("/resend-verification", h.ResendVerification)
+	auth.Post("/restore", h.RestoreAccount)
+	auth.Post("/2fa/verify", h.VerifyTwoFactor)
+	auth.Post("/otp/request", middleware.OTPRateLimit(), h.RequestLoginOTP)
+	auth.Post("/otp/verify", h.VerifyLoginOTP)
+	auth.Get("/:provider", h.OAuthLogin)
+	auth.Get("/:provider/callback", h.OAuthCallback)
+
+	// Protected routes
+	app.Get("/protected", middleware.APIKeyMiddleware(db, "profile"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db), h.ProtectedRoute)
+
+	// Profile routes. API keys can use them too, except for the account
+	// security routes behind RequireUserLogin
+	profile := app.Group("/profile", middleware.APIKeyMiddleware(db, "profile"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db))
+	userLogin := middleware.RequireUserLogin()
+	profile.Get("/", h.GetProfile)
+	profile.Put("/", h.UpdateProfile)
+	profile.Delete("/", userLogin, h.DeleteAccount)
+	profile.Post("/avatar", h.UploadAvatar)
+	profile.Delete("/avatar", h.DeleteAvatar)
+	profile.Get("/membership", h.GetMembershipInfo)
+	profile.Get("/quota", h.GetQuota)
+	profile.Get("/membership/card", userLogin, h.GetMembershipCard)
+	profile.Get("/points/history", h.GetPointsHistory)
+	profile.Get("/points/history/export", h.ExportPointsHistory)
+	profile.Get("/points/stream", h.StreamPoints)
+	profile.Get("/points/balance", h.GetPointsBalance)
+	profile.Get("/tier/history", h.GetTierHistory)
+	profile.Get("/redemptions", h.ListRedemptions)
+	profile.Get("/referrals", h.GetReferrals)
+	profile.Get("/coupons", h.ListCoupons)
+	profile.Put("/password", userLogin, h.ChangePassword)
+	profile.Post("/2fa/setup", userLogin, h.SetupTwoFactor)
+	profile.Post("/2fa/enable", userLogin, h.EnableTwoFactor)
+	profile.Post("/2fa/disable", userLogin, h.DisableTwoFactor)
+	profile.Post("/accept-terms", userLogin, h.AcceptTerms)
+	profile.Post("/phone/verification", userLogin, h.RequestPhoneVerification)
+	profile.Post("/phone/verification/confirm", userLogin, h.ConfirmPhoneVerification)
+	profile.Get("/settings", h.GetSettings)
+	profile.Put("/settings", h.UpdateSettings)
+	profile.Get("/addresses", h.ListAddresses)
+	profile.Post("/addresses", h.CreateAddress)
+	profile.Get("/addresses/:id", h.GetAddress)
+	profile.Put("/addresses/:id", h.UpdateAddress)
+	profile.Delete("/addresses/:id", h.DeleteAddress)
+	profile.Get("/devices", h.ListDevices)
+	profile.Post("/devices", h.RegisterDevice)
+	profile.Patch("/devices/:id", h.UpdateDevice)
+	profile.Delete("/devices/:id", h.DeleteDevice)
+	profile.Get("/sessions", userLogin, h.ListSessions)
+	profile.Delete("/sessions/:id", userLogin, h.RevokeSession)
+	profile.Get("/login-history", userLogin, h.GetLoginHistory)
+	profile.Post("/data-export", userLogin, h.RequestDataExport)
+	profile.Get("/data-export/:id", userLogin, h.GetDataExport)
+	profile.Get("/api-keys", userLogin, h.ListAPIKeys)
+	profile.Post("/api-keys", userLogin, h.CreateAPIKey)
+	profile.Delete("/api-keys/:id", userLogin, h.RevokeAPIKey)
+	profile.Get("/notification-preferences", h.GetNotificationPreferences)
+	profile.Put("/notification-preferences", h.UpdateNotificationPreferences)
+	profile.Get("/experiments", h.GetExperiments)
+	profile.Get("/identities", userLogin, h.ListIdentities)
+	profile.Post("/identities/:provider", userLogin, h.LinkIdentity)
+	profile.Delete("/identities/:provider", userLogin, h.UnlinkIdentity)
+
+	// Rewards catalog; spending points needs a user login, not an API key
+	rewards := app.Group("/rewards", middleware.APIKeyMiddleware(db, "rewards"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db))
+	rewards.Get("/", h.ListRewards)
+	rewards.Post("/:id/redeem", userLogin, h.RedeemReward)
+
+	// Coupons are applied with a user login, like redemptions
+	coupons := app.Group("/coupons", middleware.APIKeyMiddleware(db, "coupons"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db))
+	coupons.Post("/apply", userLogin, h.ApplyCoupon)
+
+	// Wallet; no API key scope covers it, so every route needs a user login
+	walletGroup := app.Group("/wallet", middleware.APIKeyMiddleware(db, "wallet"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db))
+	walletGroup.Get("/", h.GetWallet)
+	walletGroup.Get("/statement", h.GetWalletStatement)
+	walletGroup.Post("/topup", userLogin, h.TopUpWallet)
+	walletGroup.Post("/pay", userLogin, h.PayFromWallet)
+	walletGroup.Post("/transfer", userLogin, h.TransferFromWallet)
+
+	// Unsubscribe links in emails work without logging in; the signed token
+	// identifies the user
+	app.Get("/notifications/unsubscribe", h.GetUnsubscribe)
+	app.Post("/notifications/unsubscribe", h.Unsubscribe)
+
+	// Notification center; registered after the unsubscribe routes, which
+	// must not go through its login. No API key scope covers it.
+	notifications := app.Group("/notifications", middleware.APIKeyMiddleware(db, "notifications"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db))
+	notifications.Get("/", h.ListNotifications)
+	notifications.Post("/read-all", h.MarkAllNotificationsRead)
+	notifications.Post("/:id/read", h.MarkNotificationRead)
+
+	// Announcements and feature flags are read before logging in
+	app.Get("/announcements", h.ListAnnouncements)
+	app.Get("/feature-flags", h.GetFeatureFlags)
+
+	// Offline sync for mobile clients
+	app.Get("/sync", middleware.APIKeyMiddleware(db, "sync"), middleware.UserRateLimit(cfg.RateLimit), middleware.DeviceTracker(db), middleware.TermsGate(db), h.Sync)
+
+	// Partners read their own API usage and settlements with a key of any
+	// scope, so these routes are registered ahead of the group, which needs
+	// members:read
+	app.Get("/partner/usage", middleware.PartnerKeyMiddleware(db, ""), middleware.PartnerRateLimit(cfg.RateLimit), h.GetPartnerUsage)
+	settlements := app.Group("/partner/settlements", middleware.PartnerKeyMiddleware(db, ""), middleware.PartnerRateLimit(cfg.RateLimit))
+	settlements.Get("/", h.ListPartnerSettlements)
+	settlements.Get("/:period", h.GetPartnerSettlement)
+	settlements.Get("/:period/file", h.GetPartnerSettlementFile)
+	settlements.Post("/:period/disputes", h.CreateSettlementDispute)
+
+	// Partner API for merchants, authenticated by partner API key
+	partner := app.Group("/partner", middleware.PartnerKeyMiddleware(db, "members:read"), middleware.PartnerRateLimit(cfg.RateLimit))
+	partner.Get("/members/:membership_id", h.GetPartnerMember)
+
+	// Stores verify the membership card QR code a member shows at checkout
+	app.Post("/membership/verify-card", middleware.PartnerKeyMiddleware(db, "members:read"), middleware.PartnerRateLimit(cfg.RateLimit), h.VerifyMembershipCard)
+
+	// Partners credit points with an Idempotency-Key so retries post once
+	app.Post("/points/earn", middleware.PartnerKeyMiddleware(db, "points:earn"), middleware.PartnerRateLimit(cfg.RateLimit), h.EarnPoints)
+
+	// Admin routes
+	admin := app.Group("/admin", middleware.JWTMiddleware(db), middleware.RequireRole(models.RoleAdmin))
+	admin.Get("/debug/body-logging", h.GetBodyLogging)
+	admin.Put("/debug/body-logging", h.UpdateBodyLogging)
+	admin.Get("/captured-requests", h.ListCapturedRequests)
+	admin.Delete("/captured-requests", h.DeleteCapturedRequests)
+	admin.Post("/captured-requests/:id/replay", h.ReplayCapturedRequest)
+	admin.Get("/selftest", h.SelfTest)
+	admin.Get("/health/details", h.HealthDetails)
+	admin.Get("/schema", h.GetSchema)
+	admin.Get("/search", h.AdminSearch)
+	admin.Get("/stats", h.GetStats)
+	admin.Get("/reports", h.ListReports)
+	admin.Get("/reports/:name", h.GetReport)
+	admin.Post("/reports/:name/exports", h.ExportReport)
+	admin.Get("/trash/:resource", h.ListDeletedRecords)
+	admin.Post("/trash/:resource/:id/restore", h.RestoreDeletedRecord)
+	admin.Delete("/trash/:resource/:id", h.PurgeDeletedRecord)
+	admin.Get("/users", h.ListUsers)
+	admin.Get("/users/:id", h.GetUser)
+	admin.Patch("/users/:id", h.PatchUser)
+	admin.Delete("/users/:id", h.DeleteUser)
+	admin.Post("/users/:id/points/adjustments", h.AdjustUserPoints)
+	admin.Post("/users/:id/suspend", h.SuspendUser)
+	admin.Post("/users/:id/unsuspend", h.UnsuspendUser)
+	admin.Get("/users/:id/events", h.ListUserEvents)
+	admin.Get("/users/:id/balance", h.GetUserBalance)
+	admin.Get("/audit-logs", h.ListAuditLogs)
+	admin.Get("/campaigns", h.ListCampaigns)
+	admin.Post("/campaigns", h.CreateCampaign)
+	admin.Patch("/campaigns/:id", h.UpdateCampaign)
+	admin.Get("/announcements", h.AdminListAnnouncements)
+	admin.Post("/announcements", h.CreateAnnouncement)
+	admin.Patch("/announcements/:id", h.UpdateAnnouncement)
+	admin.Delete("/announcements/:id", h.DeleteAnnouncement)
+	admin.Get("/feature-flags", h.AdminListFeatureFlags)
+	admin.Put("/feature-flags/:key", h.SetFeatureFlag)
+	admin.Delete("/feature-flags/:key", h.DeleteFeatureFlag)
+	admin.Get("/suppressions", h.ListSuppressions)
+	admin.Post("/suppressions", h.CreateSuppression)
+	admin.Delete("/suppressions/:id", h.DeleteSuppression)
+	admin.Get("/experiments", h.ListExperiments)
+	admin.Get("/partners", h.ListPartners)
+	admin.Post("/partners", h.CreatePartner)
+	admin.Patch("/partners/:id", h.UpdatePartner)
+	admin.Get("/moderation", h.ListModerationItems)
+	admin.Get("/moderation/:id", h.GetModerationItem)
+	admin.Post("/moderation/:id/approve", h.ApproveModerationItem)
+	admin.Post("/moderation/:id/reject", h.RejectModerationItem)
+	admin.Get("/settlements", h.ListSettlements)
+	admin.Post("/settlements", h.GenerateSettlements)
+	admin.Get("/settlements/:id", h.GetSettlement)
+	admin.Get("/settlements/:id/file", h.GetSettlementFile)
+	admin.Post("/settlements/:id/adjustments", h.CreateSettlementAdjustment)
+	admin.Post("/settlements/:id/disputes/:dispute_id/resolve", h.ResolveSettlementDispute)
+	admin.Post("/settlements/:id/sign-off", h.SignOffSettlement)
+	admin.Delete("/partners/:id", h.RevokePartner)
+	admin.Get("/webhooks", h.ListWebhooks)
+	admin.Post("/webhooks", h.CreateWebhook)
+	admin.Get("/webhooks/:id", h.GetWebhook)
+	admin.Patch("/webhooks/:id", h.UpdateWebhook)
+	admin.Delete("/webhooks/:id", h.DeleteWebhook)
+	admin.Get("/webhooks/:id/deliveries", h.ListWebhookDeliveries)
+	admin.Post("/webhooks/deliveries/:id/retry", h.RetryWebhookDelivery)
+	admin.Get("/rewards", h.AdminListRewards)
+	admin.Post("/rewards", h.CreateReward)
+	admin.Get("/rewards/:id", h.GetReward)
+	admin.Patch("/rewards/:id", h.UpdateReward)
+	admin.Delete("/rewards/:id", h.DeleteReward)
+	admin.Put("/rewards/:id/image", h.UploadRewardImage)
+	admin.Get("/redemptions", h.AdminListRedemptions)
+	admin.Patch("/redemptions/:id", h.UpdateRedemption)
+	admin.Get("/sagas", h.ListSagas)
+	admin.Get("/sagas/:id", h.GetSaga)
+	admin.Post("/sagas/:id/retry", h.RetrySaga)
+	admin.Post("/sagas/:id/compensate", h.CompensateSaga)
+	admin.Get("/coupons", h.AdminListCoupons)
+	admin.Post("/coupons", h.CreateCoupon)
+	admin.Post("/coupons/batch", h.GenerateCoupons)
+	admin.Patch("/coupons/:id", h.UpdateCoupon)
+	admin.Get("/backups", h.ListBackups)
+	admin.Post("/backups", h.StartBackup)
+	admin.Get("/jobs", h.ListJobs)
+	admin.Get("/jobs/:id", h.GetJob)
+	admin.Get("/schedules", h.ListSchedules)
+	admin.Get("/schedules/leader", h.GetScheduleLeader)
+	admin.Get("/schedules/runs", h.ListScheduledRuns)
+	admin.Get("/points/reconciliations", h.ListPointsReconciliations)
+	admin.Get("/points/reconciliations/:id", h.GetPointsReconciliation)
+
+	// Debug routes are never exposed in production
+	if !cfg.Production() {
+		debug := app.Group("/debug")
+		debug.Get("/outbox", h.GetOutbox)
+		debug.Delete("/outbox", h.ClearOutbox)
+	}
+}
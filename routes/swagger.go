@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/docs"
+	"temp-backend-at-kbtg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
+	fiberSwagger "github.com/swaggo/fiber-swagger"
+)
+
+// Swagger mounts the Swagger UI at /swagger/* according to swagger.mode:
+// "open" serves it to everyone (the default outside production), "basic"
+// requires swagger.user and swagger.password, and "disabled" (the default
+// in production) does not mount it. It reports whether the UI was mounted.
+//
+// The served spec uses swagger.host and swagger.base_path (default
+// base_path); with no host set, Swagger UI sends requests to the host it
+// was loaded from.
+func Swagger(app fiber.Router, cfg *config.Config) bool {
+	docs.SwaggerInfo.Host = cfg.Swagger.Host
+	docs.SwaggerInfo.BasePath = "/"
+	if cfg.Swagger.BasePath != "" {
+		docs.SwaggerInfo.BasePath = cfg.Swagger.BasePath
+	} else if middleware.BasePath() != "" {
+		docs.SwaggerInfo.BasePath = middleware.BasePath()
+	}
+
+	mode := cfg.Swagger.Mode
+	if mode == "" {
+		mode = "open"
+		if cfg.Production() {
+			mode = "disabled"
+		}
+	}
+
+	switch mode {
+	case "open":
+		app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	case "basic":
+		// Config.Validate makes sure both are set
+		app.Get("/swagger/*", basicauth.New(basicauth.Config{
+			Users: map[string]string{cfg.Swagger.User: cfg.Swagger.Password},
+			Realm: "Swagger",
+		}), fiberSwagger.WrapHandler)
+	default:
+		return false
+	}
+	return true
+}
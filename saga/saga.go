@@ -0,0 +1,414 @@
+// Package saga runs work spanning steps that cannot share one database
+// transaction, such as a redemption that spends points, takes stock and has
+// a voucher issued by another service.
+//
+// Each step commits on its own together with the saga's progress, so a
+// saga stopped by an error or a crash is resumed at the step it was on.
+// A step that fails for good, or too often, makes the saga compensate:
+// the steps done are undone, newest first. Sagas are kept in the sagas
+// table, and Resume, run every minute by the sagas.resume job, picks up
+// those waiting for another attempt or left behind by a dead process.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/retry"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// lease is how long a saga is left to the process running it before
+	// Resume takes it up.
+	lease = 5 * time.Minute
+	// resumeBatch is how many due sagas Resume loads at a time.
+	resumeBatch = 100
+)
+
+// ErrNotWaiting is returned by Retry and Compensate for sagas that are
+// finished, or in a status the action does not apply to.
+var ErrNotWaiting = errors.New("saga is not waiting")
+
+// ErrTaken is returned when another runner changed the saga since it was
+// loaded, e.g. an admin retried it while Resume was running it. The
+// changes of the step in hand are rolled back.
+var ErrTaken = errors.New("saga was taken over")
+
+// Step is a step of a saga. Call and Do may each be nil.
+type Step[T any] struct {
+	Name string
+	// Call does the part of the step outside the database, such as a
+	// request to another service, and keeps what it needs in the state. It
+	// runs again when the step is retried, so it must be safe to repeat,
+	// e.g. by sending an idempotency key.
+	Call func(ctx context.Context, s *models.Saga, state *T) error
+	// Do makes the step's changes in tx, which also records the step done.
+	Do func(tx *gorm.DB, s *models.Saga, state *T) error
+	// Compensate undoes Do in tx; nil for steps with nothing to undo.
+	Compensate func(tx *gorm.DB, s *models.Saga, state *T) error
+}
+
+// Policy is how often and how soon a failed step is tried again.
+type Policy struct {
+	// MaxAttempts is how often a step is tried before the saga compensates
+	// or, for a compensation, is failed.
+	MaxAttempts int
+	// RetryDelay is the delay after the first failure; it doubles with
+	// every further failure up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+// Definition is a kind of saga: its steps, whose state is a T kept as JSON,
+// and how they are retried.
+type Definition[T any] struct {
+	Kind   string
+	Steps  []Step[T]
+	Policy Policy
+}
+
+// Runner runs the sagas of one kind. Every Definition is one.
+type Runner interface {
+	Run(ctx context.Context, db *gorm.DB, s *models.Saga) error
+	kind() string
+}
+
+// abortError marks a step failure retrying cannot fix.
+type abortError struct{ err error }
+
+func (e abortError) Error() string { return e.err.Error() }
+func (e abortError) Unwrap() error { return e.err }
+
+// Abort wraps a step error to compensate the saga at once instead of
+// trying the step again.
+func Abort(err error) error {
+	return abortError{err}
+}
+
+// unwrapAbort returns the error Abort wrapped, or err.
+func unwrapAbort(err error) error {
+	var abort abortError
+	if errors.As(err, &abort) {
+		return abort.err
+	}
+	return err
+}
+
+// State returns the state of s.
+func State[T any](s *models.Saga) (T, error) {
+	var state T
+	if len(s.State) == 0 {
+		return state, nil
+	}
+	err := json.Unmarshal(s.State, &state)
+	return state, err
+}
+
+func (d Definition[T]) kind() string { return d.Kind }
+
+// Start starts a saga of user with state and runs it as far as it goes.
+// The first step runs in the transaction that creates the saga, so a saga
+// whose first step fails leaves nothing behind: Start returns no saga and
+// the error. Otherwise the error is the one that made the saga compensate,
+// or the failure it waits to try again after; its status says which.
+func (d Definition[T]) Start(ctx context.Context, db *gorm.DB, userID uint, state T) (*models.Saga, error) {
+	db = db.WithContext(ctx)
+	s := &models.Saga{Kind: d.Kind, UserID: userID, Status: models.SagaRunning, Step: d.Steps[0].Name, NextAttemptAt: time.Now().Add(lease)}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		return d.forward(ctx, tx, s, &state, d.Steps[0])
+	})
+	if err != nil {
+		return nil, unwrapAbort(err)
+	}
+	return s, d.Run(ctx, db, s)
+}
+
+// Run takes s on from where it is until it completes, is compensated, or
+// waits for another attempt. The caller holds s, by having started it or
+// claimed it through Resume, Retry or Compensate.
+func (d Definition[T]) Run(ctx context.Context, db *gorm.DB, s *models.Saga) error {
+	db = db.WithContext(ctx)
+	state, err := State[T](s)
+	if err != nil {
+		return d.fail(db, s, fmt.Errorf("reading state: %w", err))
+	}
+
+	for s.Status == models.SagaRunning && s.Completed < len(d.Steps) {
+		err := d.forward(ctx, db, s, &state, d.Steps[s.Completed])
+		if err == nil {
+			continue
+		}
+		var abort abortError
+		if errors.Is(err, ErrTaken) {
+			return err
+		}
+		if !errors.As(err, &abort) && s.Attempts+1 < d.Policy.MaxAttempts {
+			return d.retry(db, s, err)
+		}
+
+		// The step failed for good: undo the steps before it
+		cause := unwrapAbort(err)
+		s.Status, s.Attempts, s.LastError, s.Failure = models.SagaCompensating, 0, "", cause.Error()
+		if err := d.save(db, s, &state); err != nil {
+			return err
+		}
+		// A compensation that fails is recorded in s and retried
+		d.compensate(db, s, &state)
+		return cause
+	}
+
+	switch s.Status {
+	case models.SagaRunning:
+		s.Status = models.SagaCompleted
+		return d.save(db, s, &state)
+	case models.SagaCompensating:
+		if err := d.compensate(db, s, &state); err != nil {
+			return err
+		}
+		return errors.New(s.Failure)
+	}
+	return nil
+}
+
+// forward does step of s: its Call, then its Do in a transaction of db.
+// The state is left as it was when the step fails.
+func (d Definition[T]) forward(ctx context.Context, db *gorm.DB, s *models.Saga, state *T, step Step[T]) (err error) {
+	before := *state
+	defer func() {
+		if err != nil {
+			*state = before
+		}
+	}()
+	if step.Call != nil {
+		if err := step.Call(ctx, s, state); err != nil {
+			return err
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if step.Do != nil {
+			if err := step.Do(tx, s, state); err != nil {
+				return err
+			}
+		}
+		s.Completed++
+		s.Attempts, s.LastError = 0, ""
+		if err := d.save(tx, s, state); err != nil {
+			s.Completed--
+			return err
+		}
+		return nil
+	})
+}
+
+// compensate undoes the steps s has done, newest first. A compensation
+// that keeps failing leaves the saga failed for an admin.
+func (d Definition[T]) compensate(db *gorm.DB, s *models.Saga, state *T) error {
+	for s.Completed > 0 {
+		step := d.Steps[s.Completed-1]
+		before := *state
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if step.Compensate != nil {
+				if err := step.Compensate(tx, s, state); err != nil {
+					return err
+				}
+			}
+			s.Completed--
+			s.Attempts, s.LastError = 0, ""
+			if err := d.save(tx, s, state); err != nil {
+				s.Completed++
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			*state = before
+		}
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, ErrTaken):
+			return err
+		case s.Attempts+1 < d.Policy.MaxAttempts:
+			return d.retry(db, s, err)
+		default:
+			return d.fail(db, s, err)
+		}
+	}
+	s.Status = models.SagaCompensated
+	return d.save(db, s, state)
+}
+
+// retry records the failure err of the current step of s and when to try
+// it again.
+func (d Definition[T]) retry(db *gorm.DB, s *models.Saga, err error) error {
+	s.Attempts++
+	delay := retry.Backoff{Delay: d.Policy.RetryDelay, MaxDelay: d.Policy.MaxRetryDelay}.After(s.Attempts)
+	s.LastError = retry.Error(err)
+	if serr := update(db, s, map[string]interface{}{
+		"attempts":        s.Attempts,
+		"last_error":      s.LastError,
+		"next_attempt_at": time.Now().Add(delay),
+	}); serr != nil {
+		return serr
+	}
+	log.Printf("[saga] %s %d: %s failed, attempt %d: %v", s.Kind, s.ID, s.Step, s.Attempts, err)
+	return err
+}
+
+// fail leaves s failed for an admin, with err as its last error.
+func (d Definition[T]) fail(db *gorm.DB, s *models.Saga, err error) error {
+	s.Status, s.Attempts, s.LastError = models.SagaFailed, s.Attempts+1, retry.Error(err)
+	if serr := update(db, s, map[string]interface{}{
+		"status":     s.Status,
+		"attempts":   s.Attempts,
+		"last_error": s.LastError,
+	}); serr != nil {
+		return serr
+	}
+	log.Printf("[saga] %s %d failed at %s: %v", s.Kind, s.ID, s.Step, err)
+	return err
+}
+
+// save writes the progress and state of s and renews its lease.
+func (d Definition[T]) save(db *gorm.DB, s *models.Saga, state *T) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	step := ""
+	switch {
+	case s.Status == models.SagaRunning && s.Completed < len(d.Steps):
+		step = d.Steps[s.Completed].Name
+	case s.Status == models.SagaCompensating && s.Completed > 0:
+		step = d.Steps[s.Completed-1].Name
+	}
+	err = update(db, s, map[string]interface{}{
+		"status":          s.Status,
+		"completed":       s.Completed,
+		"step":            step,
+		"attempts":        s.Attempts,
+		"last_error":      s.LastError,
+		"failure":         s.Failure,
+		"next_attempt_at": time.Now().Add(lease),
+		"state":           json.RawMessage(data),
+	})
+	if err != nil {
+		return err
+	}
+	s.State, s.Step = data, step
+	return nil
+}
+
+// update writes fields of s if no one else has since it was loaded.
+func update(db *gorm.DB, s *models.Saga, fields map[string]interface{}) error {
+	fields["version"] = s.Version + 1
+	result := db.Model(&models.Saga{}).Where("id = ? AND version = ?", s.ID, s.Version).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaken
+	}
+	s.Version++
+	if at, ok := fields["next_attempt_at"].(time.Time); ok {
+		s.NextAttemptAt = at
+	}
+	return nil
+}
+
+// Resume runs the sagas of runners that wait for another attempt or whose
+// runner's lease ran out. Each is claimed first, so concurrent calls run
+// it once; their failures are recorded in the sagas and only logged.
+func Resume(ctx context.Context, db *gorm.DB, runners ...Runner) error {
+	db = db.WithContext(ctx)
+	byKind := map[string]Runner{}
+	kinds := make([]string, 0, len(runners))
+	for _, r := range runners {
+		byKind[r.kind()] = r
+		kinds = append(kinds, r.kind())
+	}
+
+	resumed := 0
+	var lastID uint
+	for {
+		var sagas []models.Saga
+		err := db.Where("id > ? AND kind IN ? AND status IN ? AND next_attempt_at <= ?",
+			lastID, kinds, []string{models.SagaRunning, models.SagaCompensating}, time.Now()).
+			Order("id").Limit(resumeBatch).Find(&sagas).Error
+		if err != nil {
+			return err
+		}
+		if len(sagas) == 0 {
+			break
+		}
+		for i := range sagas {
+			s := &sagas[i]
+			lastID = s.ID
+			err := update(db, s, map[string]interface{}{"next_attempt_at": time.Now().Add(lease)})
+			if errors.Is(err, ErrTaken) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			resumed++
+			if err := byKind[s.Kind].Run(ctx, db, s); err != nil {
+				log.Printf("[saga] %s %d: %v", s.Kind, s.ID, err)
+			}
+		}
+	}
+	if resumed > 0 {
+		log.Printf("[saga] resumed %d sagas", resumed)
+	}
+	return nil
+}
+
+// Retry runs the running, compensating or failed saga s now, with the
+// attempts of its step started over. A failed saga resumes its
+// compensation.
+func Retry(ctx context.Context, db *gorm.DB, r Runner, s *models.Saga) error {
+	status := s.Status
+	switch status {
+	case models.SagaRunning, models.SagaCompensating:
+	case models.SagaFailed:
+		status = models.SagaCompensating
+	default:
+		return ErrNotWaiting
+	}
+	return take(ctx, db, r, s, map[string]interface{}{"status": status, "attempts": 0})
+}
+
+// Compensate makes the running saga s undo its steps now, e.g. when the
+// step it waits on will not succeed; reason is kept as its failure.
+func Compensate(ctx context.Context, db *gorm.DB, r Runner, s *models.Saga, reason string) error {
+	if s.Status != models.SagaRunning {
+		return ErrNotWaiting
+	}
+	return take(ctx, db, r, s, map[string]interface{}{"status": models.SagaCompensating, "attempts": 0, "failure": reason})
+}
+
+// take moves s to fields for an admin and runs it. A runner holding s
+// meanwhile finds it taken at its next write.
+func take(ctx context.Context, db *gorm.DB, r Runner, s *models.Saga, fields map[string]interface{}) error {
+	db = db.WithContext(ctx)
+	fields["next_attempt_at"] = time.Now().Add(lease)
+	if err := update(db, s, fields); err != nil {
+		return err
+	}
+	s.Status, s.Attempts = fields["status"].(string), 0
+	if failure, ok := fields["failure"].(string); ok {
+		s.Failure = failure
+	}
+	return r.Run(ctx, db, s)
+}
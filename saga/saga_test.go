@@ -0,0 +1,245 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/saga"
+	"temp-backend-at-kbtg/testutil"
+
+	"gorm.io/gorm"
+)
+
+type trip struct {
+	Booked []string `json:"booked"`
+}
+
+// definition returns a saga booking a flight, a hotel and a car, whose
+// steps fail as often as failures says and for good when aborts says. Every
+// booking and cancellation is logged.
+func definition(failures map[string]int, aborts map[string]bool, log *[]string) saga.Definition[trip] {
+	fail := func(name string) error {
+		if aborts[name] {
+			return saga.Abort(errors.New(name + " unavailable"))
+		}
+		if failures[name] > 0 {
+			failures[name]--
+			return errors.New(name + " timed out")
+		}
+		return nil
+	}
+	step := func(name string) saga.Step[trip] {
+		return saga.Step[trip]{
+			Name: name,
+			Do: func(tx *gorm.DB, s *models.Saga, state *trip) error {
+				if err := fail(name); err != nil {
+					return err
+				}
+				state.Booked = append(state.Booked, name)
+				*log = append(*log, "book "+name)
+				return nil
+			},
+			Compensate: func(tx *gorm.DB, s *models.Saga, state *trip) error {
+				if err := fail("cancel " + name); err != nil {
+					return err
+				}
+				state.Booked = state.Booked[:len(state.Booked)-1]
+				*log = append(*log, "cancel "+name)
+				return nil
+			},
+		}
+	}
+	return saga.Definition[trip]{
+		Kind:   "trip",
+		Steps:  []saga.Step[trip]{step("flight"), step("hotel"), step("car")},
+		Policy: saga.Policy{MaxAttempts: 3, RetryDelay: time.Minute, MaxRetryDelay: time.Hour},
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   map[string]int
+		aborts     map[string]bool
+		wantErr    bool
+		wantStatus string
+		wantLog    []string
+		wantBooked []string
+	}{
+		{name: "completes", wantStatus: models.SagaCompleted,
+			wantLog: []string{"book flight", "book hotel", "book car"}, wantBooked: []string{"flight", "hotel", "car"}},
+		{name: "waits after a failure", failures: map[string]int{"hotel": 1}, wantErr: true, wantStatus: models.SagaRunning,
+			wantLog: []string{"book flight"}, wantBooked: []string{"flight"}},
+		{name: "compensates newest first", aborts: map[string]bool{"car": true}, wantErr: true, wantStatus: models.SagaCompensated,
+			wantLog: []string{"book flight", "book hotel", "cancel hotel", "cancel flight"}, wantBooked: []string{}},
+		{name: "waits after a compensation fails", aborts: map[string]bool{"hotel": true, "cancel flight": true}, wantErr: true, wantStatus: models.SagaCompensating,
+			wantLog: []string{"book flight"}, wantBooked: []string{"flight"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewDB(t)
+			var log []string
+			d := definition(tt.failures, tt.aborts, &log)
+
+			s, err := d.Start(context.Background(), db, 1, trip{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Start error %v, want error %v", err, tt.wantErr)
+			}
+			var stored models.Saga
+			if err := db.First(&stored, s.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			state, err := saga.State[trip](&stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if !slices.Equal(log, tt.wantLog) {
+				t.Errorf("log %q, want %q", log, tt.wantLog)
+			}
+			if !slices.Equal(state.Booked, tt.wantBooked) {
+				t.Errorf("booked %q, want %q", state.Booked, tt.wantBooked)
+			}
+		})
+	}
+}
+
+func TestStartFirstStepFails(t *testing.T) {
+	db := testutil.NewDB(t)
+	var log []string
+	d := definition(map[string]int{"flight": 1}, nil, &log)
+
+	s, err := d.Start(context.Background(), db, 1, trip{})
+	if err == nil || s != nil {
+		t.Fatalf("Start = %v, %v, want no saga and an error", s, err)
+	}
+	var sagas int64
+	if db.Model(&models.Saga{}).Count(&sagas); sagas != 0 {
+		t.Errorf("%d sagas left behind, want none", sagas)
+	}
+}
+
+func TestResume(t *testing.T) {
+	db := testutil.NewDB(t)
+	ctx := context.Background()
+	var log []string
+	failures := map[string]int{"hotel": 1}
+	d := definition(failures, nil, &log)
+
+	s, err := d.Start(ctx, db, 1, trip{})
+	if err == nil {
+		t.Fatal("Start succeeded, want the hotel to fail")
+	}
+	if s.Attempts != 1 || s.LastError != "hotel timed out" || !s.NextAttemptAt.After(time.Now().Add(50*time.Second)) {
+		t.Fatalf("attempts %d, last error %q, next attempt %v, want a retry in a minute", s.Attempts, s.LastError, s.NextAttemptAt)
+	}
+
+	// Not due yet
+	if err := saga.Resume(ctx, db, d); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 {
+		t.Fatalf("log %q, want the saga left to wait", log)
+	}
+
+	db.Model(&models.Saga{}).Where("id = ?", s.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if err := saga.Resume(ctx, db, d); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Saga
+	db.First(&stored, s.ID)
+	if stored.Status != models.SagaCompleted || !slices.Equal(log, []string{"book flight", "book hotel", "book car"}) {
+		t.Errorf("status %s, log %q, want completed", stored.Status, log)
+	}
+}
+
+func TestTooManyFailures(t *testing.T) {
+	db := testutil.NewDB(t)
+	ctx := context.Background()
+	var log []string
+	d := definition(map[string]int{"hotel": 3}, nil, &log)
+
+	s, _ := d.Start(ctx, db, 1, trip{})
+	for i := 0; i < 2; i++ {
+		db.Model(&models.Saga{}).Where("id = ?", s.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+		if err := saga.Resume(ctx, db, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored models.Saga
+	db.First(&stored, s.ID)
+	if stored.Status != models.SagaCompensated || stored.Failure != "hotel timed out" {
+		t.Errorf("status %s, failure %q, want compensated for the hotel", stored.Status, stored.Failure)
+	}
+	if !slices.Equal(log, []string{"book flight", "cancel flight"}) {
+		t.Errorf("log %q, want the flight booked and cancelled", log)
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	db := testutil.NewDB(t)
+	ctx := context.Background()
+	var log []string
+	aborts := map[string]bool{"car": true, "cancel hotel": true}
+	d := definition(nil, aborts, &log)
+
+	s, _ := d.Start(ctx, db, 1, trip{})
+	var stored models.Saga
+	for i := 0; i < 2; i++ {
+		db.Model(&models.Saga{}).Where("id = ?", s.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+		if err := saga.Resume(ctx, db, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.First(&stored, s.ID)
+	if stored.Status != models.SagaFailed || stored.Attempts != 3 || stored.Step != "hotel" {
+		t.Fatalf("status %s after %d attempts at %s, want failed at the hotel", stored.Status, stored.Attempts, stored.Step)
+	}
+
+	aborts["cancel hotel"] = false
+	if err := saga.Retry(ctx, db, d, &stored); err == nil || err.Error() != "car unavailable" {
+		t.Errorf("Retry error %v, want the failure that made it compensate", err)
+	}
+	db.First(&stored, s.ID)
+	if stored.Status != models.SagaCompensated {
+		t.Errorf("status %s, want compensated", stored.Status)
+	}
+	if err := saga.Retry(ctx, db, d, &stored); !errors.Is(err, saga.ErrNotWaiting) {
+		t.Errorf("Retry of a compensated saga: %v, want %v", err, saga.ErrNotWaiting)
+	}
+}
+
+func TestCompensate(t *testing.T) {
+	db := testutil.NewDB(t)
+	ctx := context.Background()
+	var log []string
+	d := definition(map[string]int{"car": 1}, nil, &log)
+
+	s, _ := d.Start(ctx, db, 1, trip{})
+	stale := *s
+	if err := saga.Compensate(ctx, db, d, s, "trip cancelled"); err == nil || err.Error() != "trip cancelled" {
+		t.Fatalf("Compensate error %v, want the reason", err)
+	}
+	if !slices.Equal(log, []string{"book flight", "book hotel", "cancel hotel", "cancel flight"}) {
+		t.Errorf("log %q, want the bookings cancelled newest first", log)
+	}
+
+	// A runner that loaded the saga before cannot record its step
+	if err := d.Run(ctx, db, &stale); !errors.Is(err, saga.ErrTaken) {
+		t.Errorf("Run of a stale saga: %v, want %v", err, saga.ErrTaken)
+	}
+	var stored models.Saga
+	db.First(&stored, s.ID)
+	if stored.Status != models.SagaCompensated || stored.Completed != 0 {
+		t.Errorf("status %s with %d steps done, want compensated", stored.Status, stored.Completed)
+	}
+	if err := saga.Compensate(ctx, db, d, s, "again"); !errors.Is(err, saga.ErrNotWaiting) {
+		t.Errorf("Compensate of a compensated saga: %v, want %v", err, saga.ErrNotWaiting)
+	}
+}
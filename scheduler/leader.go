@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// leaseName is the scheduler_leases row of the scheduler's leader.
+	leaseName = "scheduler"
+	// leaseTTL is how long the lease lasts from each renewal, and
+	// renewInterval how often the leader renews it. A leader that dies is
+	// replaced within leaseTTL plus renewInterval.
+	leaseTTL      = 30 * time.Second
+	renewInterval = 10 * time.Second
+)
+
+// leaseUntil is when the lease this instance holds runs out, in Unix
+// nanoseconds, or 0 while it is a follower.
+var leaseUntil atomic.Int64
+
+// elect takes the lease, or renews it while this instance is the leader,
+// every renewInterval until ctx is cancelled, when a leader gives the
+// lease up so another instance takes over at once. An instance that cannot
+// reach the database stays leader until its lease runs out.
+func elect(ctx context.Context) {
+	leading := false
+	for {
+		now := time.Now()
+		ok, err := acquire(ctx, store(), instance, now)
+		switch {
+		case err != nil:
+			log.Printf("[scheduler] leader lease not renewed: %v", err)
+		case ok:
+			leaseUntil.Store(now.Add(leaseTTL).UnixNano())
+		default:
+			leaseUntil.Store(0)
+		}
+		if isLeader() != leading {
+			leading = !leading
+			if leading {
+				log.Printf("[scheduler] %s is the leader", instance)
+			} else {
+				log.Printf("[scheduler] %s is no longer the leader", instance)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if leading {
+				resign()
+			}
+			return
+		case <-time.After(renewInterval):
+		}
+	}
+}
+
+// acquire gives holder the lease until now plus leaseTTL when it has none,
+// holder already holds it or it has expired, and reports whether holder
+// holds it.
+func acquire(ctx context.Context, conn *gorm.DB, holder string, now time.Time) (bool, error) {
+	lease := models.SchedulerLease{
+		Name:       leaseName,
+		Holder:     holder,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(leaseTTL),
+	}
+	result := conn.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error == nil, result.Error
+	}
+
+	result = conn.WithContext(ctx).Model(&models.SchedulerLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", leaseName, holder, now).
+		Updates(map[string]interface{}{
+			"holder":      holder,
+			"acquired_at": gorm.Expr("CASE WHEN holder = ? THEN acquired_at ELSE ? END", holder, now),
+			"renewed_at":  now,
+			"expires_at":  lease.ExpiresAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// resign ends the lease this instance holds.
+func resign() {
+	leaseUntil.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := store().WithContext(ctx).
+		Where("name = ? AND holder = ?", leaseName, instance).
+		Delete(&models.SchedulerLease{}).Error
+	if err != nil {
+		log.Printf("[scheduler] leader lease not released: %v", err)
+	}
+}
+
+// isLeader reports whether this instance holds an unexpired lease.
+func isLeader() bool {
+	return time.Now().UnixNano() < leaseUntil.Load()
+}
+
+// leads reports whether this instance is the leader when a job is due. A
+// follower keeps checking for as long as a dead leader's lease can last,
+// so a run due just as the leader died is made by the instance that takes
+// over; the claim keeps a run the old leader made from being made again.
+func leads(ctx context.Context) bool {
+	deadline := time.Now().Add(leaseTTL + renewInterval)
+	for !isLeader() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return true
+}
+
+// Leader returns the current lease on running the scheduled jobs, read
+// from conn, and whether this instance holds it. It works in instances
+// that do not run the scheduler too.
+func Leader(ctx context.Context, conn *gorm.DB) (models.SchedulerLeader, error) {
+	leader := models.SchedulerLeader{Instance: instance, IsLeader: isLeader()}
+
+	var leases []models.SchedulerLease
+	err := conn.WithContext(ctx).
+		Where("name = ? AND expires_at > ?", leaseName, time.Now()).
+		Limit(1).Find(&leases).Error
+	if err != nil {
+		return leader, err
+	}
+	if len(leases) > 0 {
+		leader.Lease = &leases[0]
+	}
+	return leader, nil
+}
@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newDB opens an in-memory database with the lease table. The migrations
+// live in the database package, which imports this one.
+func newDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SchedulerLease{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestAcquire(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	start := time.Now()
+
+	steps := []struct {
+		name   string
+		holder string
+		at     time.Duration
+		want   bool
+	}{
+		{name: "first instance takes the lease", holder: "a:1", at: 0, want: true},
+		{name: "second instance is a follower", holder: "b:2", at: time.Second, want: false},
+		{name: "leader renews", holder: "a:1", at: renewInterval, want: true},
+		{name: "follower waits for the renewed lease", holder: "b:2", at: leaseTTL, want: false},
+		{name: "follower takes over once it expires", holder: "b:2", at: renewInterval + leaseTTL + time.Second, want: true},
+		{name: "old leader is a follower", holder: "a:1", at: renewInterval + leaseTTL + 2*time.Second, want: false},
+	}
+	for _, step := range steps {
+		ok, err := acquire(ctx, db, step.holder, start.Add(step.at))
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if ok != step.want {
+			t.Errorf("%s: acquire = %v, want %v", step.name, ok, step.want)
+		}
+	}
+
+	var lease models.SchedulerLease
+	if err := db.First(&lease, "name = ?", leaseName).Error; err != nil {
+		t.Fatal(err)
+	}
+	takeover := start.Add(renewInterval + leaseTTL + time.Second)
+	if lease.Holder != "b:2" || !lease.AcquiredAt.Equal(takeover) || !lease.ExpiresAt.Equal(takeover.Add(leaseTTL)) {
+		t.Errorf("lease = %+v", lease)
+	}
+}
+
+func TestLeader(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	t.Cleanup(func() { leaseUntil.Store(0) })
+
+	leader, err := Leader(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader.Instance != instance || leader.IsLeader || leader.Lease != nil {
+		t.Errorf("without a lease: %+v", leader)
+	}
+
+	// An expired lease is no leader
+	if _, err := acquire(ctx, db, "a:1", time.Now().Add(-2*leaseTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if leader, _ := Leader(ctx, db); leader.Lease != nil {
+		t.Errorf("expired lease shown: %+v", leader.Lease)
+	}
+
+	now := time.Now()
+	if ok, err := acquire(ctx, db, instance, now); !ok || err != nil {
+		t.Fatalf("acquire = %v, %v", ok, err)
+	}
+	leaseUntil.Store(now.Add(leaseTTL).UnixNano())
+	leader, err = Leader(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !leader.IsLeader || leader.Lease == nil || leader.Lease.Holder != instance {
+		t.Errorf("as the leader: %+v", leader)
+	}
+	if !leads(ctx) {
+		t.Error("leads = false for the leader")
+	}
+}
@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/retry"
+	"temp-backend-at-kbtg/worker"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// historyRetention is how long runs are kept in scheduled_runs, and
+	// pruneInterval how often older ones are deleted.
+	historyRetention = 30 * 24 * time.Hour
+	pruneInterval    = 24 * time.Hour
+)
+
+// Dispatch hands a run that this instance claimed to whatever runs its
+// job, such as the job queue, setting run.JobID when the job was queued.
+// It returns once the job is handed over; the job reports its progress
+// with Track.
+type Dispatch func(ctx context.Context, run *models.ScheduledRun) error
+
+type recurring struct {
+	name     string
+	schedule Schedule
+}
+
+var (
+	mu        sync.RWMutex
+	recurrent []recurring
+	db        *gorm.DB
+	// instance identifies this process in the runs it claims.
+	instance = instanceName()
+)
+
+// Register makes name a recurring job due at the times of schedule. Jobs
+// are registered before Start.
+func Register(name string, schedule Schedule) {
+	mu.Lock()
+	defer mu.Unlock()
+	recurrent = append(recurrent, recurring{name: name, schedule: schedule})
+}
+
+// Start dispatches every registered job at each time it is due, in the
+// server's local time zone, until the server shuts down. The instances
+// that call Start elect a leader through a lease in database, and only
+// the leader dispatches runs. It also claims each due time by inserting
+// its ScheduledRun, so a run is dispatched once even while a new leader
+// takes over; instances must share the time zone. Runs older than 30
+// days are deleted daily.
+func Start(database *gorm.DB, dispatch Dispatch) {
+	mu.Lock()
+	db = database
+	jobs := append([]recurring(nil), recurrent...)
+	mu.Unlock()
+
+	for _, job := range jobs {
+		worker.Go(job.name, func(ctx context.Context) {
+			loop(ctx, job, dispatch)
+		})
+	}
+	worker.Go("scheduler.leader", elect)
+	worker.Go("scheduler", func(ctx context.Context) {
+		for {
+			prune(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pruneInterval):
+			}
+		}
+	})
+}
+
+// Track records an attempt of the run with id in its history: running
+// while fn runs, then succeeded or failed with fn's error. A job that is
+// retried records each attempt over the previous one. Without a run, as
+// for a job queued by hand, Track only calls fn.
+func Track(ctx context.Context, id uint, fn func(ctx context.Context) error) error {
+	conn := store()
+	if id == 0 || conn == nil {
+		return fn(ctx)
+	}
+
+	now := time.Now()
+	err := conn.Model(&models.ScheduledRun{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.ScheduledRunRunning,
+		"attempts":    gorm.Expr("attempts + 1"),
+		"started_at":  gorm.Expr("COALESCE(started_at, ?)", now),
+		"finished_at": nil,
+	}).Error
+	if err != nil {
+		log.Printf("[scheduler] start of run %d not recorded: %v", id, err)
+	}
+
+	err = fn(ctx)
+	outcome := map[string]interface{}{
+		"status":      models.ScheduledRunSucceeded,
+		"error":       "",
+		"finished_at": time.Now(),
+	}
+	if err != nil {
+		outcome["status"] = models.ScheduledRunFailed
+		outcome["error"] = retry.Error(err)
+	}
+	if err := conn.Model(&models.ScheduledRun{}).Where("id = ?", id).Updates(outcome).Error; err != nil {
+		log.Printf("[scheduler] outcome of run %d not recorded: %v", id, err)
+	}
+	return err
+}
+
+// Jobs returns the registered jobs, in the order they were registered,
+// with the time each is due next and its latest run.
+func Jobs(ctx context.Context) ([]models.RecurringJob, error) {
+	mu.RLock()
+	registered := append([]recurring(nil), recurrent...)
+	mu.RUnlock()
+
+	jobs := make([]models.RecurringJob, 0, len(registered))
+	for _, r := range registered {
+		job := models.RecurringJob{Name: r.name, Schedule: r.schedule.String()}
+		if next := r.schedule.Next(time.Now()); !next.IsZero() {
+			job.NextRunAt = &next
+		}
+		if conn := store(); conn != nil {
+			var runs []models.ScheduledRun
+			if err := conn.WithContext(ctx).Where("job = ?", r.name).Order("due_at DESC").Limit(1).Find(&runs).Error; err != nil {
+				return nil, err
+			}
+			if len(runs) > 0 {
+				job.LastRun = &runs[0]
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// loop claims and dispatches job at every time it is due while this
+// instance is the leader, until ctx is cancelled. Errors are logged and the
+// job is due again at its next time.
+func loop(ctx context.Context, job recurring, dispatch Dispatch) {
+	for {
+		due := job.schedule.Next(time.Now())
+		if due.IsZero() {
+			log.Printf("[scheduler] %s is never due", job.name)
+			return
+		}
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !leads(ctx) {
+			continue
+		}
+		if err := claim(ctx, job.name, due, dispatch); err != nil {
+			log.Printf("[scheduler] %s due at %s failed: %v", job.name, due.Format(time.DateTime), err)
+		}
+	}
+}
+
+// claim inserts the run of name at due and dispatches it, or does nothing
+// when another instance inserted it first.
+func claim(ctx context.Context, name string, due time.Time, dispatch Dispatch) error {
+	run := models.ScheduledRun{
+		Job:      name,
+		DueAt:    due,
+		Instance: instance,
+		Status:   models.ScheduledRunClaimed,
+	}
+	result := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	err := dispatch(ctx, &run)
+	if err != nil {
+		now := time.Now()
+		db.Model(&run).Updates(map[string]interface{}{
+			"status":      models.ScheduledRunFailed,
+			"error":       retry.Error(err),
+			"finished_at": now,
+		})
+		return err
+	}
+	// A worker may already have started the job and recorded it running
+	return db.Model(&models.ScheduledRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"job_id": run.JobID,
+		"status": gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", models.ScheduledRunClaimed, models.ScheduledRunQueued),
+	}).Error
+}
+
+// prune deletes the runs past historyRetention.
+func prune(ctx context.Context) {
+	result := db.WithContext(ctx).
+		Where("due_at < ?", time.Now().Add(-historyRetention)).
+		Delete(&models.ScheduledRun{})
+	if result.Error != nil {
+		log.Printf("[scheduler] pruning run history failed: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[scheduler] pruned %d old runs", result.RowsAffected)
+	}
+}
+
+func store() *gorm.DB {
+	mu.RLock()
+	defer mu.RUnlock()
+	return db
+}
+
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
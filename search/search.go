@@ -0,0 +1,324 @@
+// Package search indexes users and points transactions for the admin
+// search, which finds them by fragments of their text and tolerates typos.
+// The index is kept in sync by a GORM plugin as the records are written.
+package search
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of the indexed records.
+const (
+	KindUser        = "user"
+	KindTransaction = "transaction"
+)
+
+// Document is a record as the index holds it: what kind it is, its ID and
+// the text it is found by.
+type Document struct {
+	Kind string
+	ID   uint
+	Text string
+}
+
+// Hit is a record matching a search; a higher Score is a closer match.
+type Hit struct {
+	Kind  string
+	ID    uint
+	Score float64
+}
+
+// Index finds records by text. Its methods take the database of the
+// records, so an index kept in the database writes in the transaction that
+// changed them and reaches the request's tenant (see shard.Route); an index
+// kept elsewhere may ignore it.
+type Index interface {
+	// Put adds the documents or replaces those with their kind and ID.
+	Put(db *gorm.DB, docs ...Document) error
+	// Delete removes the documents of kind with ids.
+	Delete(db *gorm.DB, kind string, ids ...uint) error
+	// Search returns up to limit hits for q, closest first.
+	Search(db *gorm.DB, q string, limit int) ([]Hit, error)
+	// Reset removes every document.
+	Reset(db *gorm.DB) error
+}
+
+// Default is the index kept in the database.
+var Default Index = Trigram{}
+
+// UserDocument is the document of user: their email, name, membership ID
+// and phone number, digits only and, for a Thai number, in the local 0
+// form too.
+func UserDocument(user models.User) Document {
+	text := []string{user.Email, user.FirstName, user.LastName, user.MembershipID}
+	if digits := digitsOnly(user.Phone); digits != "" {
+		text = append(text, digits)
+		if national, ok := strings.CutPrefix(digits, "66"); ok && strings.HasPrefix(user.Phone, "+") {
+			text = append(text, "0"+national)
+		}
+	}
+	return Document{Kind: KindUser, ID: user.ID, Text: strings.Join(text, " ")}
+}
+
+// TransactionDocument is the document of entry: its reason, reference and
+// ID.
+func TransactionDocument(entry models.PointTransaction) Document {
+	return Document{
+		Kind: KindTransaction,
+		ID:   entry.ID,
+		Text: strings.Join([]string{entry.Reason, entry.Reference, strconv.FormatUint(uint64(entry.ID), 10)}, " "),
+	}
+}
+
+// Plugin keeps index in sync with the users and points transactions
+// written through the database it is used on. The records a statement
+// creates, updates or deletes, by the primary key of its model or by its
+// conditions, are read back after it, in its transaction, and put into the
+// index, or removed from it when they are gone or soft-deleted; a failure
+// fails the statement. Updates of a map of columns none of which is
+// indexed leave the index alone. Statements the plugin does not see, such
+// as raw SQL, call for `go run . reindex-search` to rebuild the index.
+func Plugin(index Index) gorm.Plugin {
+	return plugin{index: index}
+}
+
+// source is a model whose records are indexed.
+type source struct {
+	kind string
+	// columns are those read into the documents
+	columns []string
+	// document reads the documents of the records with ids
+	document func(tx *gorm.DB, ids []uint) ([]Document, error)
+}
+
+var sources = map[reflect.Type]source{
+	reflect.TypeOf(models.User{}): {
+		kind:    KindUser,
+		columns: userColumns,
+		document: func(tx *gorm.DB, ids []uint) ([]Document, error) {
+			var users []models.User
+			err := tx.Select(userColumns).Find(&users, ids).Error
+			docs := make([]Document, len(users))
+			for i, user := range users {
+				docs[i] = UserDocument(user)
+			}
+			return docs, err
+		},
+	},
+	reflect.TypeOf(models.PointTransaction{}): {
+		kind:    KindTransaction,
+		columns: transactionColumns,
+		document: func(tx *gorm.DB, ids []uint) ([]Document, error) {
+			var entries []models.PointTransaction
+			err := tx.Select(transactionColumns).Find(&entries, ids).Error
+			docs := make([]Document, len(entries))
+			for i, entry := range entries {
+				docs[i] = TransactionDocument(entry)
+			}
+			return docs, err
+		},
+	},
+}
+
+// The columns of the documents.
+var (
+	userColumns        = []string{"id", "email", "first_name", "last_name", "membership_id", "phone"}
+	transactionColumns = []string{"id", "reason", "reference"}
+)
+
+// idsKey holds the IDs of the records a statement's conditions select.
+const idsKey = "search:ids"
+
+type plugin struct {
+	index Index
+}
+
+func (plugin) Name() string {
+	return "search"
+}
+
+func (p plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("search:after_create", p.sync); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("search:before_update", p.selectIDs); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("search:after_update", p.sync); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("search:before_delete", p.selectIDs); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("search:after_delete", p.sync)
+}
+
+// selectIDs reads the IDs of the records the conditions of an update or
+// delete select, whatever their deletion, when its model has no primary
+// key.
+func (p plugin) selectIDs(db *gorm.DB) {
+	if _, ok := p.source(db); !ok || len(modelIDs(db)) > 0 {
+		return
+	}
+	where, ok := db.Statement.Clauses["WHERE"]
+	if !ok {
+		return
+	}
+	var ids []uint
+	err := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+		Model(db.Statement.Model).Clauses(where.Expression).Pluck("id", &ids).Error
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(idsKey, ids)
+}
+
+// sync reindexes the records the statement wrote.
+func (p plugin) sync(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	src, ok := p.source(db)
+	if !ok {
+		return
+	}
+	ids := modelIDs(db)
+	if selected, ok := db.InstanceGet(idsKey); ok {
+		ids = append(ids, selected.([]uint)...)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	docs, err := src.document(tx, ids)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	found := make(map[uint]bool, len(docs))
+	for _, doc := range docs {
+		found[doc.ID] = true
+	}
+	var gone []uint
+	for _, id := range ids {
+		if !found[id] {
+			gone = append(gone, id)
+		}
+	}
+	if len(gone) > 0 {
+		if err := p.index.Delete(tx, src.kind, gone...); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+	if len(docs) > 0 {
+		if err := p.index.Put(tx, docs...); err != nil {
+			db.AddError(err)
+		}
+	}
+}
+
+// source returns the source of the statement's model when the statement
+// may change what is indexed of it.
+func (p plugin) source(db *gorm.DB) (source, bool) {
+	if db.Statement.Schema == nil {
+		return source{}, false
+	}
+	src, ok := sources[db.Statement.Schema.ModelType]
+	if !ok {
+		return source{}, false
+	}
+	columns, isMap := db.Statement.Dest.(map[string]interface{})
+	if !isMap {
+		return src, true
+	}
+	for column := range columns {
+		if field := db.Statement.Schema.LookUpField(column); field != nil &&
+			(field.DBName == "deleted_at" || slices.Contains(src.columns, field.DBName)) {
+			return src, true
+		}
+	}
+	return source{}, false
+}
+
+// modelIDs returns the non-zero primary keys of the statement's model or
+// models.
+func modelIDs(db *gorm.DB) []uint {
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+	var ids []uint
+	add := func(value reflect.Value) {
+		if id, zero := field.ValueOf(db.Statement.Context, value); !zero {
+			if id, ok := id.(uint); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	value := reflect.Indirect(db.Statement.ReflectValue)
+	switch value.Kind() {
+	case reflect.Struct:
+		add(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			add(reflect.Indirect(value.Index(i)))
+		}
+	}
+	return ids
+}
+
+// rebuildBatch is how many records Rebuild reads at a time.
+const rebuildBatch = 500
+
+// Rebuild empties index and puts every user who is not deleted and every
+// points transaction into it again, reading only the indexed columns.
+func Rebuild(db *gorm.DB, index Index) error {
+	if err := index.Reset(db); err != nil {
+		return err
+	}
+
+	var users []models.User
+	err := db.Select(userColumns).
+		FindInBatches(&users, rebuildBatch, func(tx *gorm.DB, batch int) error {
+			docs := make([]Document, len(users))
+			for i, user := range users {
+				docs[i] = UserDocument(user)
+			}
+			return index.Put(db, docs...)
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	var entries []models.PointTransaction
+	return db.Select(transactionColumns).
+		FindInBatches(&entries, rebuildBatch, func(tx *gorm.DB, batch int) error {
+			docs := make([]Document, len(entries))
+			for i, entry := range entries {
+				docs[i] = TransactionDocument(entry)
+			}
+			return index.Put(db, docs...)
+		}).Error
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
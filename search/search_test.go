@@ -0,0 +1,138 @@
+package search_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/search"
+	"temp-backend-at-kbtg/testutil"
+)
+
+func TestTrigramSearch(t *testing.T) {
+	db := testutil.NewDB(t)
+	index := search.Trigram{}
+	err := index.Put(db,
+		search.Document{Kind: search.KindUser, ID: 1, Text: "Somchai Jaidee somchai@example.com"},
+		search.Document{Kind: search.KindUser, ID: 2, Text: "Somsak Jaidee"},
+		search.Document{Kind: search.KindUser, ID: 3, Text: "Alexander Hamilton"},
+		search.Document{Kind: search.KindTransaction, ID: 4, Text: "Coffee at Somchai's shop pos:ORDER-1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{q: "somchai", want: []string{"user:1", "transaction:4"}},
+		{q: "jaidee", want: []string{"user:2", "user:1"}},
+		{q: "somchai jaidee", want: []string{"user:1"}},
+		{q: "SOMCHAI", want: []string{"user:1", "transaction:4"}},
+		{q: "somsk", want: []string{"user:2"}},
+		{q: "alexnadre", want: []string{"user:3"}},
+		{q: "alxenadre", want: nil},
+		{q: "order-1", want: []string{"transaction:4"}},
+		{q: "nobody", want: nil},
+	}
+	for _, tt := range tests {
+		hits, err := index.Search(db, tt.q, 10)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.q, err)
+		}
+		var got []string
+		for _, hit := range hits {
+			got = append(got, fmt.Sprintf("%s:%d", hit.Kind, hit.ID))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q found %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if err := index.Delete(db, search.KindUser, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := index.Search(db, "jaidee", 10); len(hits) != 0 {
+		t.Errorf("deleted documents found: %v", hits)
+	}
+}
+
+// TestPlugin checks that the records written through the database are
+// indexed, and that Rebuild indexes them all again.
+func TestPlugin(t *testing.T) {
+	db := testutil.NewDB(t)
+	user := testutil.CreateUser(t, db, func(u *models.User) { u.FirstName = "Kanokwan" })
+	entry := testutil.CreateTransaction(t, db, &user, func(e *models.PointTransaction) { e.Reason = "Songkran bonus" })
+
+	found := func(q string) []search.Hit {
+		t.Helper()
+		hits, err := search.Default.Search(db, q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hits
+	}
+	if hits := found("kanokwan"); len(hits) != 1 || hits[0].ID != user.ID {
+		t.Errorf("created user: %v", hits)
+	}
+	if hits := found("songkran"); len(hits) != 1 || hits[0].ID != entry.ID {
+		t.Errorf("created transaction: %v", hits)
+	}
+
+	if err := db.Model(&user).Update("first_name", "Kanya").Error; err != nil {
+		t.Fatal(err)
+	}
+	if hits := found("kanokwan"); len(hits) != 0 {
+		t.Errorf("old name: %v", hits)
+	}
+	if hits := found("kanya"); len(hits) != 1 {
+		t.Errorf("new name: %v", hits)
+	}
+
+	if err := search.Default.Reset(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Rebuild(db, search.Default); err != nil {
+		t.Fatal(err)
+	}
+	if hits := found("kanya"); len(hits) != 1 {
+		t.Errorf("rebuilt user: %v", hits)
+	}
+	if hits := found("songkran"); len(hits) != 1 {
+		t.Errorf("rebuilt transaction: %v", hits)
+	}
+
+	// By conditions rather than the model's primary key, as
+	// database.SoftDelete, Restore and Purge do
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("last_name", "Boonmee").Error; err != nil {
+		t.Fatal(err)
+	}
+	if hits := found("boonmee"); len(hits) != 1 {
+		t.Errorf("renamed by condition: %v", hits)
+	}
+	if err := db.Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hits := found("kanya"); len(hits) != 0 {
+		t.Errorf("deleted user: %v", hits)
+	}
+	if err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Update("deleted_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hits := found("kanya"); len(hits) != 1 {
+		t.Errorf("restored user: %v", hits)
+	}
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.PointTransaction{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Where("id = ?", user.ID).Delete(&models.User{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var left int64
+	db.Table("search_documents").Count(&left)
+	if left != 0 {
+		t.Errorf("%d documents left after the purge", left)
+	}
+}
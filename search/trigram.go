@@ -0,0 +1,269 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// candidates is how many documents sharing the most trigrams with a query
+// Trigram scores.
+const candidates = 500
+
+// Trigram is an index kept in the database, in the search_documents and
+// search_grams tables, so that it is in the transaction and on the shard of
+// the records it indexes. Every word of a document is indexed by its
+// trigrams, the runs of three characters of the word padded with two
+// spaces in front and one behind, as pg_trgm does; Thai words, which are
+// not split into words by spaces, are found by their fragments like any
+// other. A search reads the documents sharing the most trigrams with the
+// query and keeps those matching every word of the query:
+//
+//   - words of the document containing it rank first, the word itself
+//     highest;
+//   - words of 4 or more characters with a letter also match a word of the
+//     document, or its start, with one typo, or two from 8 characters; a
+//     typo is a character added, missing, replaced or swapped with the next.
+//
+// Queries of digits, dashes, spaces, parentheses and + are searched as
+// their digits, which matches phone numbers however they were typed.
+type Trigram struct{}
+
+// document is a row of search_documents.
+type document struct {
+	Kind    string `gorm:"primaryKey"`
+	ID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Content string `gorm:"not null"`
+}
+
+func (document) TableName() string { return "search_documents" }
+
+// gram is a row of search_grams.
+type gram struct {
+	Kind       string `gorm:"primaryKey"`
+	DocumentID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Gram       string `gorm:"primaryKey"`
+}
+
+func (gram) TableName() string { return "search_grams" }
+
+func (Trigram) Put(db *gorm.DB, docs ...Document) error {
+	for _, doc := range docs {
+		if err := (Trigram{}).Delete(db, doc.Kind, doc.ID); err != nil {
+			return err
+		}
+		content := normalize(doc.Text)
+		if err := db.Create(&document{Kind: doc.Kind, ID: doc.ID, Content: content}).Error; err != nil {
+			return err
+		}
+		grams := trigrams(strings.Fields(content))
+		if len(grams) == 0 {
+			continue
+		}
+		rows := make([]gram, len(grams))
+		for i, g := range grams {
+			rows[i] = gram{Kind: doc.Kind, DocumentID: doc.ID, Gram: g}
+		}
+		if err := db.CreateInBatches(rows, 200).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (Trigram) Delete(db *gorm.DB, kind string, ids ...uint) error {
+	if err := db.Where("kind = ? AND document_id IN ?", kind, ids).Delete(&gram{}).Error; err != nil {
+		return err
+	}
+	return db.Where("kind = ? AND id IN ?", kind, ids).Delete(&document{}).Error
+}
+
+func (Trigram) Reset(db *gorm.DB) error {
+	if err := db.Where("1 = 1").Delete(&gram{}).Error; err != nil {
+		return err
+	}
+	return db.Where("1 = 1").Delete(&document{}).Error
+}
+
+func (Trigram) Search(db *gorm.DB, q string, limit int) ([]Hit, error) {
+	words := queryWords(q)
+	grams := trigrams(words)
+	if len(grams) == 0 {
+		return nil, nil
+	}
+
+	var shared []struct {
+		Kind       string
+		DocumentID uint
+	}
+	err := db.Model(&gram{}).
+		Select("kind, document_id").
+		Where("gram IN ?", grams).
+		Group("kind, document_id").
+		Order("COUNT(*) DESC, document_id DESC").
+		Limit(candidates).
+		Scan(&shared).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string][]uint{}
+	for _, s := range shared {
+		ids[s.Kind] = append(ids[s.Kind], s.DocumentID)
+	}
+
+	var hits []Hit
+	for kind, kindIDs := range ids {
+		var docs []document
+		if err := db.Where("kind = ? AND id IN ?", kind, kindIDs).Find(&docs).Error; err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if score, ok := match(words, strings.Fields(doc.Content)); ok {
+				hits = append(hits, Hit{Kind: doc.Kind, ID: doc.ID, Score: score})
+			}
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Kind != hits[j].Kind {
+			return hits[i].Kind > hits[j].Kind
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// normalize lowercases s.
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// queryWords splits q into the words to match, or returns its digits as
+// the only word when it is a phone number.
+func queryWords(q string) []string {
+	q = normalize(q)
+	if digits := digitsOnly(q); len(digits) >= 3 && strings.Trim(q, "0123456789+-() ") == "" {
+		return []string{digits}
+	}
+	return strings.Fields(q)
+}
+
+// trigrams returns the distinct trigrams of words.
+func trigrams(words []string) []string {
+	seen := map[string]bool{}
+	var grams []string
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			g := string(padded[i : i+3])
+			if !seen[g] {
+				seen[g] = true
+				grams = append(grams, g)
+			}
+		}
+	}
+	return grams
+}
+
+// match scores a document of words against the words of a query, which
+// must all match.
+func match(query, words []string) (float64, bool) {
+	total := 0.0
+	for _, q := range query {
+		best := 0.0
+		for _, w := range words {
+			if score := matchWord(q, w); score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// matchWord scores word w of a document against word q of a query, 0 when
+// it does not match.
+func matchWord(q, w string) float64 {
+	switch {
+	case q == w:
+		return 1
+	case strings.Contains(w, q):
+		return 0.9
+	}
+	qr, wr := []rune(q), []rune(w)
+	allowed := typos(qr)
+	if allowed == 0 || len(wr) < len(qr)-allowed {
+		return 0
+	}
+	// The whole word, or its start for a query of the first part of it
+	if d := distance(qr, wr); d <= allowed {
+		return 0.6 / float64(d)
+	}
+	best := allowed + 1
+	for n := len(qr) - allowed; n <= len(qr)+allowed && n < len(wr); n++ {
+		if d := distance(qr, wr[:n]); d < best {
+			best = d
+		}
+	}
+	if best <= allowed {
+		return 0.5 / float64(best)
+	}
+	return 0
+}
+
+// typos is how many typos a query word q may have.
+func typos(q []rune) int {
+	hasLetter := false
+	for _, r := range q {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			break
+		}
+	}
+	switch {
+	case !hasLetter || len(q) < 4:
+		return 0
+	case len(q) < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// distance is the optimal string alignment distance of a and b: the
+// characters added, removed, replaced or swapped with their neighbour to
+// turn a into b.
+func distance(a, b []rune) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
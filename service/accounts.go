@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/events"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/referral"
+	"temp-backend-at-kbtg/repository"
+	"temp-backend-at-kbtg/requestid"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Accounts creates member accounts and signs members in and out.
+type Accounts struct {
+	store repository.Store
+	// bcryptCost hashes new passwords
+	bcryptCost int
+	// termsVersion is recorded as accepted when the member accepted it
+	termsVersion string
+}
+
+// NewAccounts returns the account service on store, with the password cost
+// and terms version of cfg.
+func NewAccounts(store repository.Store, cfg *config.Config) *Accounts {
+	return &Accounts{store: store, bcryptCost: cfg.BcryptCost, termsVersion: cfg.TermsVersion}
+}
+
+// Register creates the account described by req, which has passed its
+// validate tags. The new member starts in the initial tier, is linked to
+// the member whose referral code they gave and gets the points of the
+// registration campaigns, all in one transaction, and user.registered is
+// published. Sending the verification email and issuing tokens is left to
+// the caller.
+func (s *Accounts) Register(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
+	if fields := NormalizeNames(map[string]*string{
+		"first_name":     &req.FirstName,
+		"last_name":      &req.LastName,
+		"romanized_name": &req.RomanizedName,
+	}); len(fields) > 0 {
+		return nil, models.NewValidationError("Invalid name", fields)
+	}
+
+	if req.RomanizedName == "" && normalize.IsLatin(req.FirstName+req.LastName) {
+		req.RomanizedName = req.FirstName + " " + req.LastName
+	}
+
+	if req.Phone != "" {
+		phone, problem := NormalizePhone(req.Phone)
+		if problem != "" {
+			return nil, models.NewValidationError("Invalid phone number", map[string]string{"phone": problem})
+		}
+		req.Phone = phone
+	}
+
+	req.Email = normalize.Email(req.Email)
+	canonicalEmail := normalize.CanonicalEmail(req.Email)
+
+	taken, err := s.store.Users().EmailTaken(ctx, req.Email, canonicalEmail)
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to create user").Wrap(err)
+	}
+	if taken {
+		return nil, models.NewAppError(http.StatusConflict, models.CodeEmailTaken, "User with this email already exists")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.bcryptCost)
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to hash password")
+	}
+
+	user := models.User{
+		Email:          req.Email,
+		EmailCanonical: canonicalEmail,
+		Password:       string(hashedPassword),
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		RomanizedName:  req.RomanizedName,
+		Phone:          req.Phone,
+		MembershipID:   NewMembershipID(),
+		ReferralCode:   referral.NewCode(),
+		Points:         0,
+	}
+	if current := s.termsVersion; current != "" && req.AcceptedTermsVersion == current {
+		now := time.Now()
+		user.AcceptedTermsVersion = current
+		user.TermsAcceptedAt = &now
+	}
+
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		level, err := tx.Tiers().Initial(ctx)
+		if err != nil {
+			return err
+		}
+		user.MemberLevel = level
+		if err := tx.Users().Create(ctx, &user); err != nil {
+			return err
+		}
+		if err := tx.Events().Publish(ctx, models.WebhookEventUserRegistered, events.UserData(&user)); err != nil {
+			return err
+		}
+		if req.ReferralCode != "" {
+			if err := tx.Referrals().Refer(ctx, &user, req.ReferralCode); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Campaigns().Award(ctx, &user, models.CampaignEventRegistration); err != nil {
+			return err
+		}
+		if campaign.ProfileComplete(&user) {
+			if _, err := tx.Campaigns().Award(ctx, &user, models.CampaignEventProfileCompleted); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, referral.ErrUnknownCode) {
+		return nil, models.NewValidationError("Invalid referral code", map[string]string{"referral_code": "is not a valid referral code"})
+	}
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to create user").Wrap(err)
+	}
+	return &user, nil
+}
+
+// Errors of signing in, shared by the transports.
+var (
+	errInvalidCredentials = models.NewAppError(http.StatusUnauthorized, models.CodeInvalidCredentials, "Invalid credentials")
+	errTokenFailed        = models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to generate token")
+	// ErrAccountSuspended is returned instead of tokens for suspended
+	// accounts.
+	ErrAccountSuspended = models.NewAppError(http.StatusForbidden, models.CodeAccountSuspended, "Account is suspended")
+)
+
+// Client is the device a member signs in from, recorded with the session.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// SignIn is the outcome of signing a member in: the tokens of a new
+// session or, for accounts with two-factor authentication, the challenge to
+// finish at /auth/2fa/verify instead.
+type SignIn struct {
+	Tokens    *models.TokenResponse
+	Challenge *models.TwoFactorChallengeResponse
+}
+
+// Authenticate returns the member who signs in with email and password, or
+// INVALID_CREDENTIALS whether the account or the password is wrong.
+func (s *Accounts) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	email = normalize.Email(email)
+	user, err := s.store.Users().GetByEmail(ctx, email, normalize.CanonicalEmail(email))
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+	return user, nil
+}
+
+// SignIn signs in user, whose first factor the caller has checked, from
+// client.
+func (s *Accounts) SignIn(ctx context.Context, user *models.User, client Client) (*SignIn, error) {
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+
+	enabled, err := s.store.Users().TwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		challenge, err := middleware.IssueTwoFactorChallenge(user.ID)
+		if err != nil {
+			return nil, errTokenFailed
+		}
+		return &SignIn{Challenge: &models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(middleware.TwoFactorChallengeTTL.Seconds()),
+		}}, nil
+	}
+
+	tokens, err := s.IssueTokens(ctx, user, client)
+	if err != nil {
+		return nil, errTokenFailed
+	}
+	return &SignIn{Tokens: &tokens}, nil
+}
+
+// IssueTokens starts a session for user from client and returns its access
+// and refresh tokens.
+func (s *Accounts) IssueTokens(ctx context.Context, user *models.User, client Client) (models.TokenResponse, error) {
+	sessionID, refreshToken, err := s.store.Sessions().Start(ctx, user.ID, client.IP, client.UserAgent)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+	token, err := middleware.GenerateJWT(ctx, user.ID, user.Email, sessionID)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	return models.TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// Refresh exchanges refreshToken for a new access token and the session's
+// next refresh token. Presenting a used refresh token again revokes the
+// whole session, which is audited.
+func (s *Accounts) Refresh(ctx context.Context, refreshToken string, client Client) (models.TokenResponse, error) {
+	if refreshToken == "" {
+		return models.TokenResponse{}, models.NewValidationError("Refresh token is required", map[string]string{"refresh_token": "is required"})
+	}
+
+	stored, next, err := s.store.Sessions().Rotate(ctx, refreshToken)
+	switch {
+	case errors.Is(err, middleware.ErrRefreshTokenReused):
+		s.store.AuditLogs().Create(ctx, &models.AuditLog{
+			Actor:      fmt.Sprintf("user:%d", stored.UserID),
+			Action:     "auth.refresh_reuse",
+			Resource:   "users",
+			ResourceID: stored.UserID,
+			Fields:     []string{"refresh_tokens"},
+		})
+		return models.TokenResponse{}, models.NewAppError(http.StatusUnauthorized, models.CodeRefreshTokenReused, "Refresh token was already used; log in again")
+	case errors.Is(err, middleware.ErrRefreshTokenInvalid):
+		return models.TokenResponse{}, models.NewAppError(http.StatusUnauthorized, models.CodeInvalidRefreshToken, "Invalid refresh token")
+	case err != nil:
+		return models.TokenResponse{}, err
+	}
+
+	user, err := s.store.Users().Get(ctx, stored.UserID)
+	if err != nil {
+		return models.TokenResponse{}, models.NewAppError(http.StatusUnauthorized, models.CodeInvalidRefreshToken, "Invalid refresh token")
+	}
+
+	if err := s.store.Sessions().Touch(ctx, stored.FamilyID, client.IP); err != nil {
+		log.Printf("[auth] session of user %d not updated: %v request_id=%s", user.ID, err, requestid.FromContext(ctx))
+	}
+
+	token, err := middleware.GenerateJWT(ctx, user.ID, user.Email, stored.FamilyID)
+	if err != nil {
+		return models.TokenResponse{}, errTokenFailed
+	}
+
+	return models.TokenResponse{
+		Token:        token,
+		RefreshToken: next,
+		ExpiresIn:    int(middleware.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// Logout revokes the access token in authorization ("Bearer <token>") and
+// refreshToken with every token rotated from the same sign-in. Either may
+// be empty, but not both; an expired or invalid access token needs no
+// revoking.
+func (s *Accounts) Logout(ctx context.Context, authorization, refreshToken string) error {
+	if authorization == "" && refreshToken == "" {
+		return models.NewValidationError("An access token or refresh token is required", map[string]string{"refresh_token": "is required without an Authorization header"})
+	}
+
+	if claims, err := middleware.ParseToken(authorization); err == nil {
+		if err := s.store.Sessions().RevokeAccess(ctx, claims); err != nil {
+			return err
+		}
+	}
+	if refreshToken != "" {
+		if err := s.store.Sessions().RevokeRefresh(ctx, refreshToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/campaign"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/repository"
+)
+
+// errUserNotFound is returned for a user that does not exist or was deleted.
+var errUserNotFound = models.NewAppError(http.StatusNotFound, models.CodeUserNotFound, "User not found")
+
+// Membership reads and changes a member's profile and tier standing.
+type Membership struct {
+	store repository.Store
+	cache cache.Cache
+}
+
+// NewMembership returns the membership service on store, caching reads in
+// c.
+func NewMembership(store repository.Store, c cache.Cache) *Membership {
+	return &Membership{store: store, cache: c}
+}
+
+// MembershipInfo is a member with their tier standing. It is cached per
+// user; transports render it, e.g. in the request's locale.
+type MembershipInfo struct {
+	User models.User `json:"user"`
+	// Qualifying is the points earned in the tier qualifying period
+	Qualifying int `json:"qualifying"`
+	// Next is the tier above the member's, nil at the top tier
+	Next *models.NextTier `json:"next"`
+}
+
+// Profile returns the user with userID. It is cached for up to cache.ttl.
+func (s *Membership) Profile(ctx context.Context, userID uint) (*models.User, error) {
+	key := cache.UserKey(ctx, cache.Profile, userID)
+	var user models.User
+	if s.cache.Get(key, &user) {
+		return &user, nil
+	}
+
+	found, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.cache.Set(key, *found)
+	return found, nil
+}
+
+// UpdateProfile changes the names and phone number of userID that req sets
+// and awards the profile campaigns once the profile is complete. A new phone
+// number has to be verified again.
+func (s *Membership) UpdateProfile(ctx context.Context, userID uint, req models.UpdateProfileRequest) (*models.User, error) {
+	if fields := NormalizeNames(map[string]*string{
+		"first_name":     &req.FirstName,
+		"last_name":      &req.LastName,
+		"romanized_name": &req.RomanizedName,
+	}); len(fields) > 0 {
+		return nil, models.NewValidationError("Invalid name", fields)
+	}
+
+	if req.Phone != "" {
+		phone, problem := NormalizePhone(req.Phone)
+		if problem != "" {
+			return nil, models.NewValidationError("Invalid phone number", map[string]string{"phone": problem})
+		}
+		req.Phone = phone
+	}
+
+	// The user is read in the transaction and only the columns changed here
+	// are written, so that a concurrent change to the balance or any other
+	// column is not overwritten with what was read
+	var user *models.User
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		if user, err = tx.Users().Get(ctx, userID); err != nil {
+			return err
+		}
+
+		columns := make([]string, 0, 5)
+		if req.FirstName != "" {
+			user.FirstName = req.FirstName
+			columns = append(columns, "first_name")
+		}
+		if req.LastName != "" {
+			user.LastName = req.LastName
+			columns = append(columns, "last_name")
+		}
+		if req.RomanizedName != "" {
+			user.RomanizedName = req.RomanizedName
+			columns = append(columns, "romanized_name")
+		}
+		if req.Phone != "" && req.Phone != user.Phone {
+			user.Phone = req.Phone
+			user.PhoneVerifiedAt = nil
+			columns = append(columns, "phone", "phone_verified_at")
+		}
+		if len(columns) > 0 {
+			if err := tx.Users().Update(ctx, user, columns...); err != nil {
+				return err
+			}
+		}
+
+		if campaign.ProfileComplete(user) {
+			if _, err := tx.Campaigns().Award(ctx, user, models.CampaignEventProfileCompleted); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to update profile").Wrap(err)
+	}
+	s.cache.InvalidateUser(ctx, user.ID)
+	return user, nil
+}
+
+// Info returns the membership of userID with the points qualifying for
+// their tier and the next tier. It is cached for up to cache.ttl.
+func (s *Membership) Info(ctx context.Context, userID uint) (*MembershipInfo, error) {
+	key := cache.UserKey(ctx, cache.Membership, userID)
+	var info MembershipInfo
+	if s.cache.Get(key, &info) {
+		return &info, nil
+	}
+
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	info.User = *user
+
+	info.Qualifying, err = s.store.Tiers().Qualifying(ctx, userID, time.Now())
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to load qualifying points").Wrap(err)
+	}
+	if tier, err := s.store.Tiers().Next(ctx, user.MemberLevel); err == nil && tier != nil {
+		info.Next = &models.NextTier{Code: tier.Code, MinPoints: tier.MinPoints}
+	}
+	s.cache.Set(key, info)
+	return &info, nil
+}
+
+// notFound turns a failed user lookup into errUserNotFound, keeping the
+// cause when it is not a missing row.
+func notFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return errUserNotFound
+	}
+	return errUserNotFound.Wrap(err)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"temp-backend-at-kbtg/cache"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/pagination"
+	"temp-backend-at-kbtg/repository"
+)
+
+// Points reads and credits members' points.
+type Points struct {
+	store repository.Store
+	cache cache.Cache
+}
+
+// NewPoints returns the points service on store, dropping the cached reads
+// of members it credits from c.
+func NewPoints(store repository.Store, c cache.Cache) *Points {
+	return &Points{store: store, cache: c}
+}
+
+// EarnResult is the outcome of Earn. Replayed is set when the idempotency
+// key had already credited the member and Transaction is that earlier
+// credit.
+type EarnResult struct {
+	User        *models.User
+	Transaction *models.PointTransaction
+	Replayed    bool
+}
+
+// HistoryPages are the sort and filter keys of History, as GET
+// /profile/points/history takes them.
+var HistoryPages = pagination.Options{
+	Sorts:       map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"type": "type"},
+}
+
+// History returns a page of the ledger entries of userID.
+func (s *Points) History(ctx context.Context, userID uint, params pagination.Params) (models.PagedResponse, error) {
+	return s.store.Points().History(ctx, userID, params)
+}
+
+// Earn credits the member named in req for partner. The credit takes
+// effect once per key: a retry with the same key and request returns the
+// original credit, and the same key with a different request is rejected
+// with IDEMPOTENCY_KEY_REUSED.
+func (s *Points) Earn(ctx context.Context, partner *models.Partner, key string, req models.EarnPointsRequest) (*EarnResult, error) {
+	user, err := s.store.Users().GetByMembershipID(ctx, strings.ToUpper(req.MembershipID))
+	if err != nil {
+		return nil, models.NewAppError(http.StatusNotFound, models.CodeUserNotFound, "Member not found")
+	}
+
+	reference := fmt.Sprintf("partner:%d", partner.ID)
+	if result, err := s.replayEarn(ctx, reference, key, user, req); result != nil || err != nil {
+		return result, err
+	}
+
+	var entry *models.PointTransaction
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		entry, err = tx.Points().Post(ctx, user, models.PointTransaction{
+			Type:           models.PointTransactionEarn,
+			Amount:         req.Amount,
+			Reason:         req.Source,
+			Reference:      reference,
+			IdempotencyKey: key,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.AuditLogs().Create(ctx, &models.AuditLog{
+			Actor:      reference,
+			Action:     "points.earn",
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"points"},
+		})
+	})
+	// A concurrent retry committed first
+	if errors.Is(err, repository.ErrDuplicate) {
+		if result, err := s.replayEarn(ctx, reference, key, user, req); result != nil || err != nil {
+			return result, err
+		}
+	}
+	if err != nil {
+		return nil, models.NewAppError(http.StatusInternalServerError, models.CodeInternal, "Failed to credit points").Wrap(err)
+	}
+	s.cache.InvalidateUser(ctx, user.ID)
+
+	return &EarnResult{User: user, Transaction: entry}, nil
+}
+
+// replayEarn returns the credit that key already posted for reference, or
+// nil when the key is new.
+func (s *Points) replayEarn(ctx context.Context, reference, key string, user *models.User, req models.EarnPointsRequest) (*EarnResult, error) {
+	entry, err := s.store.Points().GetByIdempotencyKey(ctx, reference, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.UserID != user.ID || entry.Amount != req.Amount || entry.Reason != req.Source {
+		return nil, models.NewAppError(http.StatusUnprocessableEntity, models.CodeIdempotencyKeyReused,
+			"Idempotency-Key was already used for a different request")
+	}
+	return &EarnResult{User: user, Transaction: entry, Replayed: true}, nil
+}
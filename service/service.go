@@ -0,0 +1,56 @@
+// Package service holds the business rules of registration, membership
+// and points independent of HTTP, so the REST handlers, the CLI and other
+// transports share them. Services read and write through the repository
+// package and report failures as *models.AppError, which every transport
+// knows how to answer.
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"temp-backend-at-kbtg/normalize"
+)
+
+// NormalizeNames normalizes the non-empty name values in place and returns
+// a problem for every value that is not an acceptable name, keyed by JSON
+// field name. The romanized_name field must also be written in Latin
+// letters.
+func NormalizeNames(values map[string]*string) map[string]string {
+	fields := map[string]string{}
+	for name, value := range values {
+		if *value == "" {
+			continue
+		}
+
+		normalized, err := normalize.Name(*value)
+		if name == "romanized_name" {
+			normalized, err = normalize.RomanizedName(*value)
+		}
+		if err != nil {
+			fields[name] = err.Error()
+			continue
+		}
+		*value = normalized
+	}
+	return fields
+}
+
+// NormalizePhone converts a submitted phone number to E.164, or returns a
+// reason it is not acceptable. Landlines are rejected because the number is
+// used for SMS verification.
+func NormalizePhone(raw string) (string, string) {
+	phone, err := normalize.ParsePhone(raw)
+	if err != nil {
+		return "", "must be a valid phone number, e.g. 081-234-5678 or +66812345678"
+	}
+	if phone.Type == normalize.PhoneLandline {
+		return "", "must be a mobile number"
+	}
+	return phone.E164, ""
+}
+
+// NewMembershipID returns the membership ID for a new account.
+func NewMembershipID() string {
+	return fmt.Sprintf("LBK%05d", time.Now().Unix()%100000)
+}
@@ -0,0 +1,177 @@
+// Package shard routes tenants to the databases their data lives in: the
+// server's own database for the tenant of sharding.tenant, and a
+// connection pool of its own for each shard of sharding.shards.
+package shard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Shard is the database of a tenant.
+type Shard struct {
+	Tenant string
+	DB     *gorm.DB
+}
+
+// Registry maps tenants to their shards. The first shard is the server's
+// own database.
+type Registry struct {
+	shards   []*Shard
+	byTenant map[string]*Shard
+}
+
+// New returns a registry of shards, the first being the server's own
+// database.
+func New(shards ...*Shard) *Registry {
+	r := &Registry{shards: shards, byTenant: make(map[string]*Shard, len(shards))}
+	for _, s := range shards {
+		r.byTenant[s.Tenant] = s
+	}
+	return r
+}
+
+// Connect returns the registry of cfg with db, the server's database, as
+// the shard of sharding.tenant. It connects to the other shards as
+// database.Connect does, applying their pending migrations with
+// database.auto_migrate and refusing to start while they have some
+// otherwise; demo data is only seeded into the server's database. db is
+// then routed to the shards with Route.
+func Connect(cfg *config.Config, db *gorm.DB) *Registry {
+	shards := []*Shard{{Tenant: cfg.Sharding.Tenant, DB: db}}
+	for _, s := range cfg.Sharding.Shards {
+		settings := cfg.Database
+		settings.Driver, settings.DSN = s.Driver, s.DSN
+		settings.MaxOpenConns, settings.MaxIdleConns = s.MaxOpenConns, s.MaxIdleConns
+		settings.Seed = false
+		shards = append(shards, &Shard{Tenant: s.Tenant, DB: database.Connect(settings)})
+	}
+	r := New(shards...)
+	Route(db, r)
+	return r
+}
+
+// Route makes the statements run through db, the server's database, go to
+// the shard of the tenant in their context (see tenant.NewContext), and to
+// db's own connection pool without one. The handlers, services and
+// repositories built on db so serve each request from its tenant's shard
+// without knowing of it. db.DB still returns db's own pool, for pings and
+// Close. The shards must use db's driver, whose dialect the statements are
+// built in.
+func Route(db *gorm.DB, r *Registry) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic(err)
+	}
+	pools := make(map[string]*sql.DB, len(r.shards))
+	for _, s := range r.shards[1:] {
+		pool, err := s.DB.DB()
+		if err != nil {
+			panic(err)
+		}
+		pools[s.Tenant] = pool
+	}
+	router := &router{own: sqlDB, pools: pools}
+	db.ConnPool = router
+	db.Statement.ConnPool = router
+}
+
+// router is the connection pool of a database routed to the shards.
+type router struct {
+	own   *sql.DB
+	pools map[string]*sql.DB
+}
+
+// pool returns the connection pool of the tenant in ctx.
+func (r *router) pool(ctx context.Context) *sql.DB {
+	if pool, ok := r.pools[tenant.FromContext(ctx)]; ok {
+		return pool
+	}
+	return r.own
+}
+
+func (r *router) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return r.pool(ctx).PrepareContext(ctx, query)
+}
+
+func (r *router) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.pool(ctx).ExecContext(ctx, query, args...)
+}
+
+func (r *router) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.pool(ctx).QueryContext(ctx, query, args...)
+}
+
+func (r *router) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.pool(ctx).QueryRowContext(ctx, query, args...)
+}
+
+func (r *router) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return r.pool(ctx).BeginTx(ctx, opts)
+}
+
+// GetDBConn is what gorm.DB.DB returns.
+func (r *router) GetDBConn() (*sql.DB, error) {
+	return r.own, nil
+}
+
+// For returns the shard of tenant, or a 404 TENANT_NOT_FOUND error.
+func (r *Registry) For(tenant string) (*Shard, error) {
+	if s, ok := r.byTenant[tenant]; ok {
+		return s, nil
+	}
+	return nil, models.NewAppError(fiber.StatusNotFound, models.CodeTenantNotFound, "Tenant not found")
+}
+
+// Tenants returns the names of the tenants, the server's own first.
+func (r *Registry) Tenants() []string {
+	tenants := make([]string, len(r.shards))
+	for i, s := range r.shards {
+		tenants[i] = s.Tenant
+	}
+	return tenants
+}
+
+// Shards returns the shards, the server's own database first.
+func (r *Registry) Shards() []*Shard {
+	return append([]*Shard(nil), r.shards...)
+}
+
+// Gather calls fn for every shard of r at once and returns the result and
+// error of each call, in the order of Shards. ctx carries the shard's
+// tenant, so a routed database reaches the shard too. A shard that cannot
+// be reached fails its call alone.
+func Gather[T any](ctx context.Context, r *Registry, fn func(ctx context.Context, s *Shard) (T, error)) ([]T, []error) {
+	results := make([]T, len(r.shards))
+	errs := make([]error, len(r.shards))
+	var wg sync.WaitGroup
+	for i, s := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = fn(tenant.NewContext(ctx, s.Tenant), s)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// Close closes the connection pools of the shards other than the server's
+// own database, which the server closes itself.
+func (r *Registry) Close() error {
+	var errs []error
+	for _, s := range r.shards[1:] {
+		errs = append(errs, database.Close(s.DB))
+	}
+	return errors.Join(errs...)
+}
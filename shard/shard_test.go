@@ -0,0 +1,99 @@
+package shard_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/tenant"
+	"temp-backend-at-kbtg/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// newRegistry routes a fresh database, the tenant "main"'s, to a shard of
+// "acme" and returns both.
+func newRegistry(t *testing.T) (*shard.Registry, *gorm.DB, *gorm.DB) {
+	t.Helper()
+	db, acme := testutil.NewDB(t), testutil.NewDB(t)
+	r := shard.New(&shard.Shard{Tenant: "main", DB: db}, &shard.Shard{Tenant: "acme", DB: acme})
+	shard.Route(db, r)
+	return r, db, acme
+}
+
+func TestRoute(t *testing.T) {
+	_, db, acme := newRegistry(t)
+	ctx := tenant.NewContext(context.Background(), "acme")
+
+	testutil.CreateUser(t, db.WithContext(ctx), testutil.WithEmail("acme@example.com"))
+	testutil.CreateUser(t, db, testutil.WithEmail("main@example.com"))
+	testutil.CreateUser(t, db.WithContext(tenant.NewContext(context.Background(), "unknown")), testutil.WithEmail("unknown@example.com"))
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		testutil.CreateUser(t, tx, testutil.WithEmail("tx@example.com"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := func(db *gorm.DB) []string {
+		var emails []string
+		db.Model(&models.User{}).Order("email").Pluck("email", &emails)
+		return emails
+	}
+	if got, want := emails(acme), []string{"acme@example.com", "tx@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("acme's shard has %q, want %q", got, want)
+	}
+	if got, want := emails(db.WithContext(ctx)), []string{"acme@example.com", "tx@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("acme reads %q, want %q", got, want)
+	}
+	// Without a shard of their own, tenants are served by the server's database
+	if got, want := emails(db), []string{"main@example.com", "unknown@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("the server's database has %q, want %q", got, want)
+	}
+}
+
+func TestFor(t *testing.T) {
+	r, db, acme := newRegistry(t)
+
+	for tenant, want := range map[string]*gorm.DB{"main": db, "acme": acme} {
+		if s, err := r.For(tenant); err != nil || s.DB != want {
+			t.Errorf("For(%q) = %v, %v, want its shard", tenant, s, err)
+		}
+	}
+	var appErr *models.AppError
+	if _, err := r.For("unknown"); !errors.As(err, &appErr) || appErr.Status != fiber.StatusNotFound || appErr.Code != models.CodeTenantNotFound {
+		t.Errorf("For(unknown) error %v, want a 404 %s", err, models.CodeTenantNotFound)
+	}
+	if got := r.Tenants(); !slices.Equal(got, []string{"main", "acme"}) {
+		t.Errorf("Tenants = %q, want the server's own first", got)
+	}
+}
+
+func TestGather(t *testing.T) {
+	r, db, _ := newRegistry(t)
+	testutil.CreateUser(t, db)
+	testutil.CreateUser(t, db.WithContext(tenant.NewContext(context.Background(), "acme")))
+	testutil.CreateUser(t, db.WithContext(tenant.NewContext(context.Background(), "acme")), testutil.WithEmail("second@example.com"))
+
+	failure := errors.New("shard down")
+	counts, errs := shard.Gather(context.Background(), r, func(ctx context.Context, s *shard.Shard) (int64, error) {
+		if s.Tenant == "main" {
+			return 0, failure
+		}
+		// Through the routed database, as the handlers query
+		var count int64
+		err := db.WithContext(ctx).Model(&models.User{}).Count(&count).Error
+		return count, err
+	})
+	if !errors.Is(errs[0], failure) || errs[1] != nil {
+		t.Errorf("errors %v, want the first shard's alone", errs)
+	}
+	if counts[1] != 2 {
+		t.Errorf("acme counted %d users, want 2", counts[1])
+	}
+}
@@ -0,0 +1,155 @@
+// Package sms sends text messages to users' phones through Twilio or the
+// Thai aggregator ThaiBulkSMS, as selected by sms.driver. Every message is
+// recorded in sms_messages, which enforces the per-member hourly limit and
+// is updated by the gateways' delivery callbacks.
+package sms
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/outbox"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/tracing"
+
+	"gorm.io/gorm"
+)
+
+// TwilioCallbackPath is the API path Twilio posts delivery reports to.
+const TwilioCallbackPath = "/webhooks/sms/twilio"
+
+// ErrRateLimited is returned by Send when the member has already been sent
+// sms.user_hourly_limit messages in the last hour.
+var ErrRateLimited = errors.New("sms: hourly limit of the member reached")
+
+// Sender delivers a text message to a phone number in E.164 format and
+// returns the gateway's ID for it, if any.
+type Sender interface {
+	Send(to, message string) (string, error)
+}
+
+// Default is the sender of the handlers unless they are given another.
+// Messages are only logged until Init configures a gateway, or the outbox
+// in PROVIDERS_MODE=mock.
+var Default Sender = LogSender{}
+
+var (
+	// provider names Default in sms_messages.
+	provider    = "log"
+	hourlyLimit = 0
+)
+
+// Init sets Default to the gateway in cfg and the hourly limit of Send.
+// publicURL, when set, is where Twilio sends delivery reports.
+// PROVIDERS_MODE=mock selects the outbox whatever the driver.
+func Init(cfg config.SMSConfig, publicURL string) {
+	hourlyLimit = cfg.UserHourlyLimit
+	if outbox.MockMode() {
+		Default, provider = OutboxSender{}, "outbox"
+		return
+	}
+	switch cfg.Driver {
+	case "twilio":
+		twilio := NewTwilio(cfg.Twilio.AccountSID, cfg.Twilio.AuthToken, cfg.Sender)
+		if publicURL != "" {
+			twilio.StatusCallback = strings.TrimSuffix(publicURL, "/") + TwilioCallbackPath
+		}
+		Default, provider = twilio, "twilio"
+		log.Printf("Sending SMS through Twilio")
+	case "thaibulksms":
+		Default, provider = NewThaiBulkSMS(cfg.ThaiBulkSMS.APIKey, cfg.ThaiBulkSMS.APISecret, cfg.Sender), "thaibulksms"
+		log.Printf("Sending SMS through ThaiBulkSMS")
+	}
+}
+
+// Send delivers message to the member's phone number to with sender, usually
+// Default, and records it for purpose, one of the models.SMSPurpose values.
+// It refuses with ErrRateLimited once the member has had the hourly limit
+// of messages; the count is not locked, so concurrent requests can go
+// slightly over it.
+func Send(sender Sender, db *gorm.DB, userID uint, to, purpose, message string) error {
+	if hourlyLimit > 0 {
+		var sent int64
+		err := db.Model(&models.SMSMessage{}).
+			Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-time.Hour)).
+			Count(&sent).Error
+		if err != nil {
+			return err
+		}
+		if sent >= int64(hourlyLimit) {
+			return ErrRateLimited
+		}
+	}
+
+	record := models.SMSMessage{
+		UserID:   userID,
+		Phone:    to,
+		Purpose:  purpose,
+		Provider: provider,
+		Status:   models.SMSStatusSent,
+	}
+	id, err := sender.Send(to, message)
+	record.ProviderID = id
+	if err != nil {
+		record.Status = models.SMSStatusFailed
+		record.Error = err.Error()
+	}
+	if err := db.Create(&record).Error; err != nil {
+		log.Printf("[sms] message to user %d not recorded: %v", userID, err)
+	}
+	return err
+}
+
+// UpdateStatus records a delivery report of provider for its message
+// providerID. Only delivered and failed are recorded, and only for messages
+// still marked sent, so a late report of an earlier stage changes nothing.
+// It reports whether a message was updated.
+func UpdateStatus(db *gorm.DB, provider, providerID, status, detail string) (bool, error) {
+	if providerID == "" || (status != models.SMSStatusDelivered && status != models.SMSStatusFailed) {
+		return false, nil
+	}
+	result := db.Model(&models.SMSMessage{}).
+		Where("provider = ? AND provider_id = ? AND status = ?", provider, providerID, models.SMSStatusSent).
+		Updates(map[string]interface{}{"status": status, "error": detail})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Provider returns the name of the Default sender in sms_messages, e.g.
+// twilio.
+func Provider() string {
+	return provider
+}
+
+// httpClient returns the client the gateway senders call their APIs with.
+func httpClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second, Transport: requestid.Transport(tracing.Transport(nil))}
+}
+
+// OutboxSender records messages in the mock provider outbox. The outbox
+// message ID serves as the gateway's, so delivery reports can be tried out
+// against the SMS webhook.
+type OutboxSender struct{}
+
+func (OutboxSender) Send(to, message string) (string, error) {
+	msg := outbox.Record(outbox.Message{
+		Channel: outbox.ChannelSMS,
+		To:      to,
+		Body:    message,
+	})
+	return strconv.Itoa(msg.ID), nil
+}
+
+// LogSender writes a line to the log without the message body, which may
+// contain one-time codes.
+type LogSender struct{}
+
+func (LogSender) Send(to, message string) (string, error) {
+	log.Printf("[sms] message to %s not delivered: no SMS gateway configured", to)
+	return "", nil
+}
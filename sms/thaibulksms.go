@@ -0,0 +1,91 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+)
+
+// ThaiBulkSMSEndpoint is the v2 SMS API of ThaiBulkSMS.
+const ThaiBulkSMSEndpoint = "https://api-v2.thaibulksms.com/sms"
+
+// ThaiBulkSMS sends messages through ThaiBulkSMS, a Thai aggregator whose
+// registered sender names reach every Thai network.
+type ThaiBulkSMS struct {
+	APIKey    string
+	APISecret string
+	// Sender is the sender name registered with ThaiBulkSMS.
+	Sender   string
+	Endpoint string
+	client   *http.Client
+}
+
+// NewThaiBulkSMS returns a ThaiBulkSMS sender for the API key.
+func NewThaiBulkSMS(apiKey, apiSecret, sender string) *ThaiBulkSMS {
+	return &ThaiBulkSMS{
+		APIKey:    apiKey,
+		APISecret: apiSecret,
+		Sender:    sender,
+		Endpoint:  ThaiBulkSMSEndpoint,
+		client:    httpClient(),
+	}
+}
+
+type thaiBulkSMSResponse struct {
+	PhoneNumbers []struct {
+		MessageID string `json:"message_id"`
+	} `json:"phone_number_list"`
+	Error struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func (t *ThaiBulkSMS) Send(to, message string) (string, error) {
+	// Numbers are given without the plus, e.g. 66812345678
+	form := url.Values{
+		"msisdn":  {strings.TrimPrefix(to, "+")},
+		"message": {message},
+		"sender":  {t.Sender},
+	}
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(t.APIKey, t.APISecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sms: thaibulksms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result thaiBulkSMSResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return "", fmt.Errorf("sms: thaibulksms: reading the response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("sms: thaibulksms: %s: %d %s", resp.Status, result.Error.Code, result.Error.Description)
+	}
+	if len(result.PhoneNumbers) == 0 {
+		return "", fmt.Errorf("sms: thaibulksms: %s refused as a bad number", to)
+	}
+	return result.PhoneNumbers[0].MessageID, nil
+}
+
+// AggregatorStatus maps the status of a delivery report relayed to the SMS
+// webhook to an SMS status, or "" for statuses that are not final.
+func AggregatorStatus(status string) string {
+	switch strings.ToLower(status) {
+	case "delivered":
+		return models.SMSStatusDelivered
+	case "failed", "undelivered", "expired", "rejected":
+		return models.SMSStatusFailed
+	}
+	return ""
+}
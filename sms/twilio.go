@@ -0,0 +1,120 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"temp-backend-at-kbtg/models"
+)
+
+// TwilioEndpoint is the base URL of the Twilio REST API.
+const TwilioEndpoint = "https://api.twilio.com/2010-04-01"
+
+// Twilio sends messages through the Twilio Programmable Messaging API.
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	// From is the sending number in E.164 format, or a messaging service
+	// SID (MG...).
+	From string
+	// StatusCallback is where Twilio posts delivery reports; none are
+	// requested when empty.
+	StatusCallback string
+	Endpoint       string
+	client         *http.Client
+}
+
+// NewTwilio returns a Twilio sender for the account.
+func NewTwilio(accountSID, authToken, from string) *Twilio {
+	return &Twilio{
+		AccountSID: accountSID,
+		AuthToken:  authToken,
+		From:       from,
+		Endpoint:   TwilioEndpoint,
+		client:     httpClient(),
+	}
+}
+
+type twilioMessage struct {
+	SID     string `json:"sid"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (t *Twilio) Send(to, message string) (string, error) {
+	form := url.Values{"To": {to}, "Body": {message}}
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+	if t.StatusCallback != "" {
+		form.Set("StatusCallback", t.StatusCallback)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint+"/Accounts/"+url.PathEscape(t.AccountSID)+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sms: twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result twilioMessage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return "", fmt.Errorf("sms: twilio: reading the response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("sms: twilio: %s: %d %s", resp.Status, result.Code, result.Message)
+	}
+	return result.SID, nil
+}
+
+// ValidSignature reports whether signature, the X-Twilio-Signature header,
+// signs params as posted to StatusCallback: the URL followed by each
+// parameter name and value in name order, signed with HMAC-SHA1 under the
+// auth token.
+func (t *Twilio) ValidSignature(params url.Values, signature string) bool {
+	if t.StatusCallback == "" || signature == "" {
+		return false
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(t.AuthToken))
+	mac.Write([]byte(t.StatusCallback))
+	for _, name := range names {
+		for _, value := range params[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// TwilioStatus maps a Twilio MessageStatus to an SMS status, or "" for the
+// stages before the final one.
+func TwilioStatus(status string) string {
+	switch status {
+	case "delivered":
+		return models.SMSStatusDelivered
+	case "undelivered", "failed":
+		return models.SMSStatusFailed
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// ErrInvalidSignature is returned by Verify for presigned links that were
+// altered, not made by this server, or have expired.
+var ErrInvalidSignature = errors.New("storage: invalid or expired link")
+
+// Local keeps files in Dir. The server serves the public ones under
+// /uploads and the others under /files for presigned links. It suits
+// development and single-instance deployments.
+type Local struct {
+	Dir string
+	// BaseURL is what URL puts before the key.
+	BaseURL string
+	// DownloadURL is what PresignedURL puts before the key.
+	DownloadURL string
+	// Secret is the JWT secret the signatures of presigned links are
+	// derived from.
+	Secret string
+}
+
+func (l *Local) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Written next to the target and renamed, so a file being replaced is
+	// never served half-written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, io.LimitReader(body, size)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(l.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(l.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+// PresignedURL returns a link to the file under key that Verify accepts
+// until it expires.
+func (l *Local) PresignedURL(key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := checkExpiry(expires); err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{"expires": {expiresAt}, "signature": {l.signature(key, expiresAt)}}
+	return l.DownloadURL + "/" + escapePath(key) + "?" + query.Encode(), nil
+}
+
+// Verify checks the expires and signature parameters of a link made by
+// PresignedURL for key.
+func (l *Local) Verify(key, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(l.signature(key, expires))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// signature signs a presigned link with a key derived from the JWT secret,
+// so the signature can never pass as a token or the other way round.
+func (l *Local) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, config.DeriveKey([]byte(l.Secret), "storage-download"))
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
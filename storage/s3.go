@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// unsignedPayload is the payload hash of requests whose body is streamed
+// rather than hashed up front.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 keeps files in a bucket of AWS S3 or a compatible service such as
+// MinIO, signing requests with AWS Signature Version 4.
+type S3 struct {
+	cfg      config.S3Config
+	endpoint *url.URL
+	// baseURL is what URL puts before the key.
+	baseURL string
+	client  *http.Client
+}
+
+// NewS3 returns the bucket in cfg. Files are linked at publicURL, e.g. a
+// CDN in front of the bucket, or at the bucket's own address when it is
+// empty.
+func NewS3(cfg config.S3Config, publicURL string) *S3 {
+	endpoint, _ := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	s := &S3{
+		cfg:      cfg,
+		endpoint: endpoint,
+		baseURL:  publicURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.baseURL == "" {
+		s.baseURL = s.objectURL("").String()
+	}
+	s.baseURL = strings.TrimSuffix(s.baseURL, "/")
+	return s
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	return s.do(req, http.StatusOK)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer resp.Body.Close()
+	return nil, responseError(req, resp)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	// S3 answers 204 whether or not the object existed
+	return s.do(req, http.StatusNoContent, http.StatusNotFound)
+}
+
+func (s *S3) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// PresignedURL returns a link signed with the query parameters of Signature
+// Version 4. It points at the bucket itself rather than the public URL, as
+// the signature covers the host.
+func (s *S3) PresignedURL(key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := checkExpiry(expires); err != nil {
+		return "", err
+	}
+	return s.presign(key, expires, time.Now()), nil
+}
+
+// presign returns the link of PresignedURL as signed at now.
+func (s *S3) presign(key string, expires time.Duration, now time.Time) string {
+	u := s.objectURL(key)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.cfg.AccessKey + "/" + s.scope(amzDate)},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		escapePath(u.Path),
+		query.Encode(),
+		"host:" + u.Host,
+		"",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(amzDate, canonical))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Ping checks that the bucket exists and the credentials can reach it.
+func (s *S3) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL("").String(), nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, http.StatusOK)
+}
+
+// objectURL returns the address of key in the bucket, or of the bucket when
+// key is empty.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		u.Path += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	if key != "" || !s.cfg.PathStyle {
+		u.Path += "/" + key
+	}
+	// Sent exactly as signed
+	u.RawPath = escapePath(u.Path)
+	return &u
+}
+
+// do signs and sends req and reports an error unless it is answered with
+// one of the ok statuses.
+func (s *S3) do(req *http.Request, ok ...int) error {
+	s.sign(req, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+	}
+	return responseError(req, resp)
+}
+
+// responseError describes a failed request with the start of the error
+// document S3 answered with.
+func responseError(req *http.Request, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("storage: %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// sign adds the AWS Signature Version 4 headers to req. The body is not
+// hashed.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, s.scope(amzDate), signedHeaders, s.signature(amzDate, canonical)))
+}
+
+// scope is the credential scope of a signature made at amzDate.
+func (s *S3) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived from the secret
+// key, the day and the region.
+func (s *S3) signature(amzDate, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath encodes every byte of path except unreserved characters and
+// slashes, as Signature Version 4 expects of S3 object keys.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
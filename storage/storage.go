@@ -0,0 +1,114 @@
+// Package storage keeps files, such as avatars, reward images and report
+// exports, in a directory served by this server or in an S3-compatible
+// bucket, as selected by storage.driver.
+//
+// Files under the prefixes in PublicPrefixes can be downloaded by anyone
+// from URL. Every other file is private and only reachable through a link
+// from PresignedURL, which expires.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// MaxPresignExpiry is the longest a presigned link can stay valid, the limit
+// S3 sets.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// ErrNotFound is returned by Get when there is no file under the key.
+var ErrNotFound = errors.New("storage: file not found")
+
+// PublicPrefixes are the key prefixes of files anyone may download. An S3
+// bucket needs a policy allowing public reads of the same prefixes.
+var PublicPrefixes = []string{"avatars/", "rewards/"}
+
+// Service stores files under slash-separated keys such as
+// avatars/12/K7QM2XPA.jpg.
+type Service interface {
+	// Put stores size bytes of body under key, replacing any file there.
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	// Get opens the file under key; the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key; a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients download the public file under key
+	// from.
+	URL(key string) string
+	// PresignedURL returns a link to the file under key, public or not,
+	// that works for expires, at most MaxPresignExpiry.
+	PresignedURL(key string, expires time.Duration) (string, error)
+}
+
+// IsPublic reports whether the file under key may be downloaded without a
+// presigned link.
+func IsPublic(key string) bool {
+	for _, prefix := range PublicPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Default is the service handlers store files with unless they are given
+// another. It keeps files in ./uploads until Init configures it.
+var Default Service = &Local{Dir: "uploads", BaseURL: "/uploads", DownloadURL: "/files"}
+
+// Init sets Default to the driver in the storage settings of app. Links of
+// the local driver are under app's public URL and signed with its JWT
+// secret.
+func Init(app *config.Config) {
+	cfg := app.Storage
+	switch cfg.Driver {
+	case "s3":
+		Default = NewS3(cfg.S3, cfg.PublicURL)
+		log.Printf("Storing uploads in bucket %s at %s", cfg.S3.Bucket, cfg.S3.Endpoint)
+	default:
+		// Without a public URL links are relative to this server
+		appURL := strings.TrimSuffix(app.PublicURL, "/")
+		if app.PublicURL == "" {
+			if path := strings.Trim(app.BasePath, "/"); path != "" {
+				appURL = "/" + path
+			}
+		}
+		baseURL := cfg.PublicURL
+		if baseURL == "" {
+			baseURL = appURL + "/uploads"
+		}
+		Default = &Local{
+			Dir:         cfg.Dir,
+			BaseURL:     strings.TrimSuffix(baseURL, "/"),
+			DownloadURL: appURL + "/files",
+			Secret:      app.JWT.Secret,
+		}
+	}
+}
+
+// checkExpiry rejects presigned link lifetimes S3 would refuse.
+func checkExpiry(expires time.Duration) error {
+	if expires < time.Second || expires > MaxPresignExpiry {
+		return fmt.Errorf("storage: presigned link expiry %s out of range", expires)
+	}
+	return nil
+}
+
+// checkKey rejects keys that could reach outside the storage root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// Package tenant carries the tenant a request is served for, which picks
+// the shard its queries run against.
+package tenant
+
+import "context"
+
+// Header is the request header naming the tenant; requests without it are
+// served for sharding.tenant.
+const Header = "X-Tenant-ID"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying name.
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// FromContext returns the tenant in ctx, or "" for sharding.tenant.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
@@ -0,0 +1,208 @@
+package testutil
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/normalize"
+	"temp-backend-at-kbtg/points"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DefaultPassword is the plain-text password of every factory-built user.
+const DefaultPassword = "password123"
+
+var sequence atomic.Int64
+
+// UserOption overrides fields of a factory-built user.
+type UserOption func(*models.User)
+
+// NewUser builds a valid, unsaved user with unique email and membership ID.
+func NewUser(t testing.TB, opts ...UserOption) models.User {
+	t.Helper()
+
+	n := sequence.Add(1)
+
+	// MinCost keeps factories fast; handlers verify with CompareHashAndPassword
+	// which accepts any cost.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(DefaultPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+
+	user := models.User{
+		Email:        fmt.Sprintf("user%d@example.com", n),
+		Password:     string(hashedPassword),
+		FirstName:    "Test",
+		LastName:     fmt.Sprintf("User%d", n),
+		Phone:        "+66812345678",
+		MembershipID: fmt.Sprintf("LBK%05d", n),
+		MemberLevel:  "Gold",
+		Points:       0,
+	}
+
+	for _, opt := range opts {
+		opt(&user)
+	}
+	user.EmailCanonical = normalize.CanonicalEmail(user.Email)
+
+	return user
+}
+
+// CreateUser builds a user with NewUser and inserts it into db.
+func CreateUser(t testing.TB, db *gorm.DB, opts ...UserOption) models.User {
+	t.Helper()
+
+	user := NewUser(t, opts...)
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// WithEmail sets the user's email.
+func WithEmail(email string) UserOption {
+	return func(u *models.User) { u.Email = email }
+}
+
+// WithPoints sets the user's points balance.
+func WithPoints(points int) UserOption {
+	return func(u *models.User) { u.Points = points }
+}
+
+// WithMemberLevel sets the user's member level.
+func WithMemberLevel(level string) UserOption {
+	return func(u *models.User) { u.MemberLevel = level }
+}
+
+// TransactionOption overrides fields of a factory-built points transaction.
+type TransactionOption func(*models.PointTransaction)
+
+// CreateTransaction posts a points transaction for user with points.Post,
+// so the balance, the lots and the tier follow as they do in the services:
+// by default 100 earned points. user is updated in place.
+func CreateTransaction(t testing.TB, db *gorm.DB, user *models.User, opts ...TransactionOption) models.PointTransaction {
+	t.Helper()
+
+	entry := models.PointTransaction{
+		Type:      models.PointTransactionEarn,
+		Amount:    100,
+		Reason:    "Test purchase",
+		Reference: fmt.Sprintf("test:%d", sequence.Add(1)),
+	}
+	for _, opt := range opts {
+		opt(&entry)
+	}
+
+	var posted *models.PointTransaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		posted, err = points.Post(tx, user, entry)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("post transaction: %v", err)
+	}
+	return *posted
+}
+
+// Redeemed makes the transaction a redemption of amount points.
+func Redeemed(amount int) TransactionOption {
+	return func(e *models.PointTransaction) {
+		e.Type, e.Amount, e.Reason = models.PointTransactionRedeem, -amount, "Test redemption"
+	}
+}
+
+// WithAmount sets the points of the transaction, negative for debits.
+func WithAmount(amount int) TransactionOption {
+	return func(e *models.PointTransaction) { e.Amount = amount }
+}
+
+// RewardOption overrides fields of a factory-built reward.
+type RewardOption func(*models.Reward)
+
+// CreateReward inserts an active reward into db: by default 100 points,
+// with 10 in stock.
+func CreateReward(t testing.TB, db *gorm.DB, opts ...RewardOption) models.Reward {
+	t.Helper()
+
+	reward := models.Reward{
+		Name:        fmt.Sprintf("Reward %d", sequence.Add(1)),
+		Description: "A test reward",
+		Cost:        100,
+		Stock:       10,
+		Active:      true,
+	}
+	for _, opt := range opts {
+		opt(&reward)
+	}
+	// Create leaves out zero values, so the column default would win
+	active := reward.Active
+	if err := db.Create(&reward).Error; err != nil {
+		t.Fatalf("create reward: %v", err)
+	}
+	if !active {
+		reward.Active = false
+		if err := db.Model(&reward).Update("active", false).Error; err != nil {
+			t.Fatalf("deactivate reward: %v", err)
+		}
+	}
+	return reward
+}
+
+// CouponOption overrides fields of a factory-built coupon.
+type CouponOption func(*models.Coupon)
+
+// CreateCoupon inserts an active coupon into db: by default 100 points,
+// for any number of members.
+func CreateCoupon(t testing.TB, db *gorm.DB, opts ...CouponOption) models.Coupon {
+	t.Helper()
+
+	n := sequence.Add(1)
+	coupon := models.Coupon{
+		Code:   fmt.Sprintf("TEST-%d", n),
+		Name:   fmt.Sprintf("Coupon %d", n),
+		Type:   models.CouponPoints,
+		Value:  100,
+		Active: true,
+	}
+	for _, opt := range opts {
+		opt(&coupon)
+	}
+	// Create leaves out zero values, so the column default would win
+	active := coupon.Active
+	if err := db.Create(&coupon).Error; err != nil {
+		t.Fatalf("create coupon: %v", err)
+	}
+	if !active {
+		coupon.Active = false
+		if err := db.Model(&coupon).Update("active", false).Error; err != nil {
+			t.Fatalf("deactivate coupon: %v", err)
+		}
+	}
+	return coupon
+}
+
+// CreatePartner inserts a partner with scopes into db and returns it with
+// its API key, to be sent as X-API-Key.
+func CreatePartner(t testing.TB, db *gorm.DB, scopes ...string) (models.Partner, string) {
+	t.Helper()
+
+	n := sequence.Add(1)
+	key := fmt.Sprintf("pk_test%d", n)
+	partner := models.Partner{
+		Name:      fmt.Sprintf("Partner %d", n),
+		KeyHash:   middleware.HashPartnerKey(key),
+		KeyPrefix: key,
+		Scopes:    scopes,
+	}
+	if err := db.Create(&partner).Error; err != nil {
+		t.Fatalf("create partner: %v", err)
+	}
+	return partner, key
+}
@@ -0,0 +1,139 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"temp-backend-at-kbtg/mailer"
+	"temp-backend-at-kbtg/voucher"
+)
+
+// Mailer is a mailer.Sender that keeps the email it is given instead of
+// sending it. Handlers built by NewEnv send through one synchronously, so
+// a test can read the email right after the request.
+type Mailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *Mailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the email sent so far, oldest first.
+func (m *Mailer) Messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.messages...)
+}
+
+// TextMessage is a text message sent through SMS.
+type TextMessage struct {
+	To   string
+	Body string
+}
+
+// SMS is an sms.Sender that keeps the text messages it is given instead of
+// sending them.
+type SMS struct {
+	mu       sync.Mutex
+	messages []TextMessage
+}
+
+func (s *SMS) Send(to, message string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, TextMessage{To: to, Body: message})
+	return fmt.Sprintf("fake_%d", len(s.messages)), nil
+}
+
+// Messages returns the text messages sent so far, oldest first.
+func (s *SMS) Messages() []TextMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TextMessage(nil), s.messages...)
+}
+
+// Vouchers is a voucher.Issuer that issues numbered codes, or fails with
+// Err while it is set.
+type Vouchers struct {
+	mu       sync.Mutex
+	Err      error
+	requests []voucher.Request
+}
+
+func (v *Vouchers) Issue(ctx context.Context, req voucher.Request) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.requests = append(v.requests, req)
+	if v.Err != nil {
+		return "", v.Err
+	}
+	return fmt.Sprintf("VC%d", len(v.requests)), nil
+}
+
+// SetErr makes the following requests fail with err, or succeed when nil.
+func (v *Vouchers) SetErr(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.Err = err
+}
+
+// Requests returns the requests made so far, oldest first.
+func (v *Vouchers) Requests() []voucher.Request {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]voucher.Request(nil), v.requests...)
+}
+
+// Charge is a charge made through Payments.
+type Charge struct {
+	UserID    uint
+	Amount    int
+	Reference string
+}
+
+// Payments is a payment.Gateway that accepts every charge, or fails with
+// Err while it is set.
+type Payments struct {
+	mu      sync.Mutex
+	Err     error
+	charges []Charge
+}
+
+func (p *Payments) Charge(userID uint, amount int, reference string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return "", p.Err
+	}
+	p.charges = append(p.charges, Charge{UserID: userID, Amount: amount, Reference: reference})
+	return fmt.Sprintf("ch_%d", len(p.charges)), nil
+}
+
+// SetErr makes the following charges fail with err, or succeed when nil.
+func (p *Payments) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Err = err
+}
+
+// Charges returns the charges made so far, oldest first.
+func (p *Payments) Charges() []Charge {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Charge(nil), p.charges...)
+}
+
+// noCache is a cache.Cache that never hits, so apps of parallel tests, with
+// users of the same IDs in their own databases, do not share reads.
+type noCache struct{}
+
+func (noCache) Get(string, interface{}) bool         { return false }
+func (noCache) Set(string, interface{})              {}
+func (noCache) Delete(...string)                     {}
+func (noCache) InvalidateUser(context.Context, uint) {}
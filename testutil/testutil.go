@@ -0,0 +1,205 @@
+// Package testutil provides helpers for handler-level tests: an isolated
+// in-memory database, a fully routed Fiber app with fake senders, and model
+// factories.
+package testutil
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/database"
+	"temp-backend-at-kbtg/handlers"
+	"temp-backend-at-kbtg/lock"
+	"temp-backend-at-kbtg/middleware"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/points"
+	"temp-backend-at-kbtg/realtime"
+	"temp-backend-at-kbtg/referral"
+	"temp-backend-at-kbtg/routes"
+	"temp-backend-at-kbtg/shard"
+	"temp-backend-at-kbtg/storage"
+	"temp-backend-at-kbtg/tiers"
+	"temp-backend-at-kbtg/wallet"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// NewDB opens a migrated in-memory database that is closed when the test
+// ends.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open(config.DatabaseConfig{Driver: "sqlite", DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return db
+}
+
+// Env is an app under test with the database and the fakes its handlers
+// send through.
+type Env struct {
+	App    *fiber.App
+	DB     *gorm.DB
+	Config *config.Config
+	// Handler serves App; other transports under test share its services
+	Handler *handlers.Handler
+	Mailer  *Mailer
+	SMS     *SMS
+	// Storage is where the handlers keep files
+	Storage storage.Service
+	// Vouchers issues the vouchers of redeemed rewards
+	Vouchers *Vouchers
+	// Payments charges the wallet top-ups
+	Payments *Payments
+	// Locks is where the handlers take their locks
+	Locks lock.Locker
+	// Balances is the hub of the balance streams, polled by the tests
+	Balances *realtime.Hub
+}
+
+// NewEnv returns a Fiber app with every route registered, backed by a fresh
+// database from NewDB. Its handlers send email and text messages to fakes,
+// have vouchers issued and top-ups charged by fakes, take locks of their
+// own, keep files in a temporary directory and cache nothing; the auth, user
+// and partner rate limits are off.
+func NewEnv(t testing.TB) *Env {
+	t.Helper()
+
+	env, _ := NewShardedEnv(t)
+	return env
+}
+
+// NewShardedEnv is NewEnv serving the tenants named, besides the server's
+// own, from fresh databases of their own, which it returns by tenant. The
+// env's database is routed to them as shard.Connect routes the server's.
+func NewShardedEnv(t testing.TB, tenants ...string) (*Env, map[string]*gorm.DB) {
+	t.Helper()
+
+	env := &Env{DB: NewDB(t), Mailer: &Mailer{}, SMS: &SMS{}, Vouchers: &Vouchers{}, Payments: &Payments{}, Locks: lock.NewMemory(), Balances: realtime.NewHub()}
+	env.App = fiber.New(fiber.Config{
+		ErrorHandler: handlers.ErrorHandler,
+	})
+	// The rate limit counters outlive the app, so with limits on, tests
+	// would use up each other's allowance
+	settings := *config.Get()
+	settings.RateLimit.Auth, settings.RateLimit.User = config.Rate{}, config.Rate{}
+	settings.RateLimit.Tiers = nil
+	settings.RateLimit.Partner, settings.RateLimit.Plans = 0, nil
+	cfg := &settings
+	env.Config = cfg
+	env.Storage = &storage.Local{Dir: t.TempDir(), BaseURL: "/uploads", DownloadURL: "/files", Secret: cfg.JWT.Secret}
+	middleware.Init(cfg)
+	points.Init(cfg.Points)
+	tiers.Init(cfg.Tiers)
+	wallet.Init(cfg.Wallet)
+	referral.Init(cfg.Referrals)
+	shards := []*shard.Shard{{Tenant: cfg.Sharding.Tenant, DB: env.DB}}
+	dbs := make(map[string]*gorm.DB, len(tenants))
+	for _, name := range tenants {
+		dbs[name] = NewDB(t)
+		shards = append(shards, &shard.Shard{Tenant: name, DB: dbs[name]})
+	}
+	registry := shard.New(shards...)
+	if len(tenants) > 0 {
+		shard.Route(env.DB, registry)
+	}
+	env.Handler = handlers.New(handlers.Deps{
+		DB:       env.DB,
+		Config:   cfg,
+		Shards:   registry,
+		Cache:    noCache{},
+		Mailer:   env.Mailer,
+		SMS:      env.SMS,
+		Storage:  env.Storage,
+		Vouchers: env.Vouchers,
+		Payments: env.Payments,
+		Locks:    env.Locks,
+		Balances: env.Balances,
+	})
+	routes.Setup(env.App, cfg, env.DB, env.Handler)
+
+	return env, dbs
+}
+
+// NewApp returns the app and database of NewEnv, for tests that do not look
+// at what was sent.
+func NewApp(t testing.TB) (*fiber.App, *gorm.DB) {
+	t.Helper()
+
+	env := NewEnv(t)
+	return env.App, env.DB
+}
+
+// AuthHeader returns an Authorization header value for user.
+func AuthHeader(t testing.TB, user models.User) string {
+	t.Helper()
+
+	token, err := middleware.GenerateJWT(context.Background(), user.ID, user.Email, "")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// Request performs an in-process request against app. A non-empty body is
+// sent as JSON and a non-empty authHeader is sent as Authorization.
+func Request(t testing.TB, app *fiber.App, method, path, body, authHeader string) (int, string) {
+	t.Helper()
+
+	var headers map[string]string
+	if authHeader != "" {
+		headers = map[string]string{"Authorization": authHeader}
+	}
+	return RequestWithHeaders(t, app, method, path, body, headers)
+}
+
+// RequestWithHeaders is Request with any headers, e.g. the X-API-Key of a
+// partner. A Host header replaces the host of the request.
+func RequestWithHeaders(t testing.TB, app *fiber.App, method, path, body string, headers map[string]string) (int, string) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		if name == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response body: %v", err)
+	}
+
+	return resp.StatusCode, string(respBody)
+}
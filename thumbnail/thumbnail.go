@@ -0,0 +1,125 @@
+// Package thumbnail decodes uploaded images and scales them to the sizes
+// the apps display, such as square avatars and reward pictures. It accepts JPEG, PNG and
+// GIF, the formats the standard library decodes.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// MaxPixels bounds the images Decode accepts, so a small file declaring a
+// huge canvas cannot exhaust memory.
+const MaxPixels = 25_000_000
+
+var (
+	// ErrUnsupported is returned for data that is not a JPEG, PNG or GIF
+	// image.
+	ErrUnsupported = errors.New("thumbnail: unsupported image format")
+	// ErrTooLarge is returned for images of more than MaxPixels pixels.
+	ErrTooLarge = errors.New("thumbnail: image too large")
+)
+
+// Decode decodes a JPEG, PNG or GIF image, checking its dimensions before
+// decoding the pixels. The first frame of an animated GIF is used.
+func Decode(data []byte) (image.Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return img, nil
+}
+
+// Square crops the centre square of src and scales it to size by size
+// pixels.
+func Square(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	return scale(src, image.Rect(x0, y0, x0+side, y0+side), size, size)
+}
+
+// Fit scales src down to fit within size by size pixels, keeping its aspect
+// ratio. Smaller images keep their size.
+func Fit(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	return scale(src, b, w, h)
+}
+
+// scale scales the area r of src to w by h pixels, averaging the source
+// pixels behind each target pixel. Transparent areas are filled with white,
+// as the result is meant for JPEG.
+func scale(src image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0, sy1 := span(y, h, r.Dy())
+		for x := 0; x < w; x++ {
+			sx0, sx1 := span(x, w, r.Dx())
+
+			var red, g, bl, a uint64
+			for sy := r.Min.Y + sy0; sy < r.Min.Y+sy1; sy++ {
+				for sx := r.Min.X + sx0; sx < r.Min.X+sx1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					red, g, bl, a = red+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+				}
+			}
+			n := uint64((sy1 - sy0) * (sx1 - sx0))
+			// The colours are premultiplied, so adding the missing alpha as
+			// white composites the pixel onto white
+			white := n*0xffff - a
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((red + white) / n >> 8),
+				G: uint8((g + white) / n >> 8),
+				B: uint8((bl + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels [from, to) behind target pixel i of n
+// when side source pixels are scaled to n; at least one pixel when
+// enlarging.
+func span(i, n, side int) (int, int) {
+	from := i * side / n
+	to := (i + 1) * side / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// JPEG encodes img as a JPEG of good quality.
+func JPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
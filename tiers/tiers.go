@@ -0,0 +1,205 @@
+// Package tiers places members in the membership tiers of the member_tiers
+// table. A member belongs to the highest-ranked tier whose min_points their
+// qualifying points reach, i.e. the points they earned over the last
+// tiers.qualifying_days. Earning points can only move a member up; the
+// scheduled recalculation also moves members down once earned points leave
+// the qualifying period. users.member_level is only changed here, by a
+// TierChanged event in the event store, and every change is recorded in
+// tier_changes.
+package tiers
+
+import (
+	"errors"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/eventstore"
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons recorded on tier changes.
+const (
+	ReasonPointsEarned = "Points earned"
+	ReasonRecalculated = "Qualifying period recalculated"
+	ReasonAdmin        = "Changed by an admin"
+)
+
+// rankColumn is member_tiers.rank, quoted by GORM in the queries because
+// RANK is a reserved word in MySQL.
+var rankColumn = clause.Column{Name: "rank"}
+
+// qualifyingDays is the tiers.qualifying_days setting given to Init.
+var qualifyingDays int
+
+// Init sets the qualifying period of the tiers.
+func Init(cfg config.TiersConfig) {
+	qualifyingDays = cfg.QualifyingDays
+}
+
+// Qualifying returns the points the user earned in the qualifying period
+// that ends at now.
+func Qualifying(tx *gorm.DB, userID uint, now time.Time) (int, error) {
+	query := tx.Model(&models.PointTransaction{}).
+		Where("user_id = ? AND type = ?", userID, models.PointTransactionEarn)
+	if days := qualifyingDays; days > 0 {
+		query = query.Where("created_at > ?", now.AddDate(0, 0, -days))
+	}
+
+	var total int
+	err := query.Select("COALESCE(SUM(amount), 0)").Scan(&total).Error
+	return total, err
+}
+
+// For returns the highest-ranked tier whose threshold qualifying reaches,
+// or nil when there is none.
+func For(tx *gorm.DB, qualifying int) (*models.MemberTier, error) {
+	var tier models.MemberTier
+	err := tx.Where("min_points <= ?", qualifying).Order(clause.OrderByColumn{Column: rankColumn, Desc: true}).First(&tier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &tier, err
+}
+
+// Next returns the tier ranked just above code, or nil when code is the top
+// tier.
+func Next(tx *gorm.DB, code string) (*models.MemberTier, error) {
+	var tier models.MemberTier
+	err := tx.Where("? > (?)", rankColumn, tx.Model(&models.MemberTier{}).Select("COALESCE(MAX(?), 0)", rankColumn).Where("code = ?", code)).
+		Order(clause.OrderByColumn{Column: rankColumn}).First(&tier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &tier, err
+}
+
+// Initial returns the tier of a new member, the one reached with no points.
+func Initial(tx *gorm.DB) (string, error) {
+	tier, err := For(tx, 0)
+	if err != nil {
+		return "", err
+	}
+	if tier == nil {
+		return "", errors.New("tiers: no tier has a threshold of 0")
+	}
+	return tier.Code, nil
+}
+
+// Evaluate moves user to the tier their qualifying points reach and returns
+// the change, or nil when the tier stays the same. With upOnly it leaves
+// members in a higher tier than their points reach. It should run in the
+// same transaction as the change that caused it; user.MemberLevel is updated
+// in place, and the caller invalidates the user's cached reads once the
+// transaction has committed.
+func Evaluate(tx *gorm.DB, user *models.User, upOnly bool, reason string) (*models.TierChange, error) {
+	current, err := lockLevel(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	qualifying, err := Qualifying(tx, user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	tier, err := For(tx, qualifying)
+	if err != nil || tier == nil || tier.Code == current {
+		user.MemberLevel = current
+		return nil, err
+	}
+
+	upgrade, err := ranksAbove(tx, tier, current)
+	if err != nil {
+		return nil, err
+	}
+	if upOnly && !upgrade {
+		user.MemberLevel = current
+		return nil, nil
+	}
+	return change(tx, user, current, tier.Code, upgrade, qualifying, reason, "tiers")
+}
+
+// Set moves user to the tier code, e.g. on an admin's request, and returns
+// the change, or nil when user already is in that tier. Unlike Evaluate it
+// writes no audit entry; the caller audits the request. The next
+// recalculation places the member by their points again.
+func Set(tx *gorm.DB, user *models.User, code, reason string) (*models.TierChange, error) {
+	current, err := lockLevel(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == code {
+		user.MemberLevel = code
+		return nil, nil
+	}
+
+	var tier models.MemberTier
+	if err := tx.Where("code = ?", code).First(&tier).Error; err != nil {
+		return nil, err
+	}
+	upgrade, err := ranksAbove(tx, &tier, current)
+	if err != nil {
+		return nil, err
+	}
+	qualifying, err := Qualifying(tx, user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return change(tx, user, current, code, upgrade, qualifying, reason, "")
+}
+
+// change records the move of user from one tier to another, audited with
+// actor unless it is empty.
+func change(tx *gorm.DB, user *models.User, from, to string, upgrade bool, qualifying int, reason, actor string) (*models.TierChange, error) {
+	_, err := eventstore.Append(tx, user, models.EventTierChanged, models.DomainEventData{FromTier: from, ToTier: to, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := models.TierChange{
+		UserID:           user.ID,
+		FromTier:         from,
+		ToTier:           to,
+		Upgrade:          upgrade,
+		QualifyingPoints: qualifying,
+		Reason:           reason,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	if actor != "" {
+		action := "tier.downgrade"
+		if upgrade {
+			action = "tier.upgrade"
+		}
+		err := tx.Create(&models.AuditLog{
+			Actor:      actor,
+			Action:     action,
+			Resource:   "users",
+			ResourceID: user.ID,
+			Fields:     []string{"member_level"},
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// ranksAbove reports whether tier ranks above the tier code. Unknown codes
+// rank below every tier.
+func ranksAbove(tx *gorm.DB, tier *models.MemberTier, code string) (bool, error) {
+	var count int64
+	err := tx.Model(&models.MemberTier{}).Where("code = ? AND ? >= ?", code, rankColumn, tier.Rank).Count(&count).Error
+	return count == 0, err
+}
+
+// lockLevel reads the tier of a user and locks the row until tx ends.
+func lockLevel(tx *gorm.DB, userID uint) (string, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Select("id", "member_level").First(&user, userID).Error
+	return user.MemberLevel, err
+}
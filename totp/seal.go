@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/middleware"
+)
+
+// ErrUnsealable is returned for stored secrets that cannot be decrypted,
+// usually because the encryption key changed.
+var ErrUnsealable = errors.New("totp secret cannot be decrypted")
+
+// encryptionKey is the totp.encryption_key given to Init.
+var encryptionKey string
+
+// Init sets the key secrets are encrypted with.
+func Init(cfg config.TOTPConfig) {
+	encryptionKey = cfg.EncryptionKey
+}
+
+// sealKey is derived from the encryption key, or from the JWT secret when
+// that is unset. Changing either makes existing secrets unreadable, so users
+// would have to enroll again.
+func sealKey() []byte {
+	secret := middleware.JWTSecret()
+	if encryptionKey != "" {
+		secret = []byte(encryptionKey)
+	}
+	return config.DeriveKey(secret, "totp-secret")
+}
+
+// Seal encrypts a secret for storage as base64(nonce | AES-256-GCM
+// ciphertext).
+func Seal(secret string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret encrypted by Seal.
+func Open(sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrUnsealable
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", ErrUnsealable
+	}
+
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrUnsealable
+	}
+	return string(plain), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sealKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,175 @@
+package totp
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/config"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, cut to the last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	// Apps show secrets in lowercase too
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("lowercase secret: %s", got)
+	}
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("want an error for a malformed secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := step(now)
+	codeAt := func(offset time.Duration) string {
+		code, err := Code(rfcSecret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: codeAt(0), wantStep: current, wantOK: true},
+		{name: "previous step", code: codeAt(-period * time.Second), wantStep: current - 1, wantOK: true},
+		{name: "next step", code: codeAt(period * time.Second), wantStep: current + 1, wantOK: true},
+		{name: "two steps ago", code: codeAt(-2 * period * time.Second)},
+		{name: "two steps ahead", code: codeAt(2 * period * time.Second)},
+		{name: "spaces", code: codeAt(0)[:3] + " " + codeAt(0)[3:], wantStep: current, wantOK: true},
+		{name: "wrong code", code: "000000"},
+		{name: "too short", code: codeAt(0)[:5]},
+		{name: "too long", code: codeAt(0) + "0"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", codeAt(0), now); ok {
+		t.Error("malformed secret accepted")
+	}
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(other, codeAt(0), now); ok {
+		t.Error("code of another secret accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("two secrets are equal")
+	}
+	// 160 bits are 32 base32 characters
+	if len(a) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", a, len(a))
+	}
+	if _, err := Code(a, time.Now()); err != nil {
+		t.Errorf("secret does not decode: %v", err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	u, err := url.Parse(ProvisioningURI(rfcSecret, "Loyalty App", "somchai@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Loyalty App:somchai@example.com" {
+		t.Errorf("URI %s", u)
+	}
+	query := u.Query()
+	for name, want := range map[string]string{"secret": rfcSecret, "issuer": "Loyalty App", "digits": "6", "period": "30", "algorithm": "SHA1"} {
+		if got := query.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSeal(t *testing.T) {
+	t.Cleanup(func() { Init(config.TOTPConfig{}) })
+	Init(config.TOTPConfig{EncryptionKey: "first-encryption-key"})
+
+	sealed, err := Seal(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == rfcSecret {
+		t.Fatal("secret stored in the clear")
+	}
+	again, err := Seal(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("sealing twice gives the same ciphertext")
+	}
+	opened, err := Open(sealed)
+	if err != nil || opened != rfcSecret {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+	for name, value := range map[string]string{
+		"tampered":    string(tampered),
+		"not base64":  "%%%",
+		"too short":   "AAAA",
+		"empty":       "",
+		"plain value": rfcSecret,
+	} {
+		if _, err := Open(value); !errors.Is(err, ErrUnsealable) {
+			t.Errorf("%s: error %v, want %v", name, err, ErrUnsealable)
+		}
+	}
+
+	Init(config.TOTPConfig{EncryptionKey: "second-encryption-key"})
+	if _, err := Open(sealed); !errors.Is(err, ErrUnsealable) {
+		t.Errorf("other key: error %v, want %v", err, ErrUnsealable)
+	}
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		traceID string
+		parent  string
+		sampled bool
+		ok      bool
+	}{
+		{name: "sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parent: "00f067aa0ba902b7", sampled: true, ok: true},
+		{name: "not sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parent: "00f067aa0ba902b7", ok: true},
+		{name: "other flags", header: " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03 ", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parent: "00f067aa0ba902b7", sampled: true, ok: true},
+		{name: "empty", header: ""},
+		{name: "unknown version", header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "short trace ID", header: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01"},
+		{name: "not hex", header: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01"},
+		{name: "bad flags", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x"},
+		{name: "zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero parent ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, parent, sampled, ok := parseTraceparent(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			span := &Span{traceID: traceID, spanID: parent, sampled: sampled}
+			if got, want := span.Traceparent(), "00-"+tt.traceID+"-"+tt.parent+"-"+map[bool]string{true: "01", false: "00"}[tt.sampled]; got != want {
+				t.Errorf("parsed as %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// startExporter makes spans go to an exporter posting to url, without the
+// background worker, and turns tracing off again after the test.
+func startExporter(t *testing.T, url string) *exporter {
+	t.Helper()
+	active = &exporter{
+		url:         url,
+		headers:     map[string]string{"Authorization": "Bearer collector-token"},
+		service:     "loyalty-api",
+		sampleRatio: 1,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		queue:       make(chan *Span, 4),
+	}
+	t.Cleanup(func() { active = nil })
+	return active
+}
+
+func TestExport(t *testing.T) {
+	var got otlpRequest
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	e := startExporter(t, server.URL)
+
+	ctx, request := StartServer(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "GET /api/v1/profile")
+	request.SetAttribute("http.status_code", 500)
+	request.SetAttribute("user.id", int64(42))
+	request.SetAttribute("cache.hit", false)
+	request.SetAttribute("db.rows_ratio", 0.5)
+	request.SetAttribute("http.route", "/api/v1/profile")
+	request.SetError(errors.New("database is locked"))
+	_, query := Start(ctx, "SELECT users", KindClient)
+	query.End()
+	request.End()
+	request.End()
+
+	var spans []*Span
+	for len(e.queue) > 0 {
+		spans = append(spans, <-e.queue)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("%d spans queued, want 2", len(spans))
+	}
+	if err := e.export(context.Background(), spans); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if header.Get("Content-Type") != "application/json" || header.Get("Authorization") != "Bearer collector-token" {
+		t.Errorf("headers %v", header)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("payload %+v", got)
+	}
+	resource := got.ResourceSpans[0].Resource.Attributes
+	if len(resource) == 0 || resource[0].Key != "service.name" || *resource[0].Value.StringValue != "loyalty-api" {
+		t.Errorf("resource %+v", resource)
+	}
+	exported := got.ResourceSpans[0].ScopeSpans[0].Spans
+	byName := map[string]otlpSpan{}
+	for _, span := range exported {
+		byName[span.Name] = span
+	}
+
+	root := byName["GET /api/v1/profile"]
+	child := byName["SELECT users"]
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "trace continued", got: root.TraceID, want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "remote parent", got: root.ParentSpanID, want: "00f067aa0ba902b7"},
+		{name: "server kind", got: root.Kind, want: KindServer},
+		{name: "child in trace", got: child.TraceID, want: root.TraceID},
+		{name: "child parent", got: child.ParentSpanID, want: root.SpanID},
+		{name: "client kind", got: child.Kind, want: KindClient},
+		{name: "error status", got: root.Status, want: otlpStatus{Code: 2, Message: "database is locked"}},
+		{name: "unset status", got: child.Status, want: otlpStatus{}},
+		{name: "attributes", got: attributes(root.Attributes), want: "http.status_code=int:500 user.id=int:42 cache.hit=bool:false db.rows_ratio=double:0.5 http.route=string:/api/v1/profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+// attributes renders OTLP attributes as "key=type:value" for comparison.
+func attributes(kvs []otlpKeyValue) string {
+	var out []string
+	for _, kv := range kvs {
+		v := kv.Value
+		switch {
+		case v.StringValue != nil:
+			out = append(out, kv.Key+"=string:"+*v.StringValue)
+		case v.IntValue != nil:
+			out = append(out, kv.Key+"=int:"+*v.IntValue)
+		case v.BoolValue != nil:
+			out = append(out, kv.Key+"=bool:"+map[bool]string{true: "true", false: "false"}[*v.BoolValue])
+		case v.DoubleValue != nil:
+			b, _ := json.Marshal(*v.DoubleValue)
+			out = append(out, kv.Key+"=double:"+string(b))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "partial success", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: "collector returned 400 Bad Request"},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: "collector returned 503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			t.Cleanup(server.Close)
+			e := startExporter(t, server.URL)
+
+			_, span := Start(context.Background(), "job", KindInternal)
+			span.End()
+			err := e.export(context.Background(), []*Span{<-e.queue})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("export: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("export: error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		ratio       float64
+		traceparent string
+		requests    int
+		queued      int
+		dropped     int64
+	}{
+		{name: "all sampled", ratio: 1, requests: 1, queued: 2},
+		{name: "none sampled", ratio: 0, requests: 1},
+		{name: "caller sampled", ratio: 0, traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", requests: 1, queued: 2},
+		{name: "caller not sampled", ratio: 1, traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", requests: 1},
+		{name: "full queue drops", ratio: 1, requests: 3, queued: 4, dropped: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := startExporter(t, "http://collector.invalid")
+			e.sampleRatio = tt.ratio
+			for range tt.requests {
+				ctx, span := StartServer(context.Background(), tt.traceparent, "request")
+				_, child := Start(ctx, "query", KindClient)
+				child.End()
+				span.End()
+			}
+			if len(e.queue) != tt.queued {
+				t.Errorf("%d spans queued, want %d", len(e.queue), tt.queued)
+			}
+			if dropped := e.dropped.Load(); dropped != tt.dropped {
+				t.Errorf("%d spans dropped, want %d", dropped, tt.dropped)
+			}
+		})
+	}
+}
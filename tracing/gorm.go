@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin records a client span for every statement run with a context
+// that carries a span, i.e. through db.WithContext(c.UserContext()) in a
+// traced request. Statements without one are not traced.
+func GormPlugin() gorm.Plugin {
+	return gormPlugin{}
+}
+
+type gormPlugin struct{}
+
+func (gormPlugin) Name() string {
+	return "tracing"
+}
+
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		name      string
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", "INSERT", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", "SELECT", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", "UPDATE", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", "DELETE", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", "ROW", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", "RAW", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, p := range processors {
+		if err := p.before("tracing:before_"+p.name, startStatement(p.operation)); err != nil {
+			return err
+		}
+		if err := p.after("tracing:after_"+p.name, endStatement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startStatement(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if FromContext(db.Statement.Context) == nil {
+			return
+		}
+		name := operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		_, span := Start(db.Statement.Context, name, KindClient)
+		span.SetAttribute("db.system", db.Dialector.Name())
+		span.SetAttribute("db.operation.name", operation)
+		if db.Statement.Table != "" {
+			span.SetAttribute("db.collection.name", db.Statement.Table)
+		}
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endStatement(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(*Span)
+	// The statement text has placeholders, not the values bound to them.
+	span.SetAttribute("db.query.text", db.Statement.SQL.String())
+	span.SetAttribute("db.response.returned_rows", db.Statement.RowsAffected)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.SetError(db.Error)
+	}
+	span.End()
+}
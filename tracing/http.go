@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Transport wraps base (http.DefaultTransport when nil) so that requests
+// made with a traced context get a client span and a traceparent header,
+// letting the called service continue the trace.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transport{base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if FromContext(req.Context()) == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Host, KindClient)
+	defer span.End()
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", span.Traceparent())
+
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	// Leave out the query string, which may carry credentials
+	span.SetAttribute("url.full", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetError(errors.New(resp.Status))
+	}
+	return resp, nil
+}
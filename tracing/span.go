@@ -0,0 +1,199 @@
+// Package tracing records spans for requests, SQL statements and outbound
+// HTTP calls and exports them to an OpenTelemetry collector over OTLP/HTTP.
+// Trace context travels in W3C traceparent headers, so a request can be
+// followed from the gateway through the handlers into the database.
+//
+// Spans are only recorded when an OTLP endpoint is configured; otherwise
+// Start returns a nil span and every Span method is a no-op.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind tells the collector which side of a call a span describes. The
+// values are those of the OTLP protocol.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is one timed operation of a trace.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+
+	mu     sync.Mutex
+	name   string
+	kind   SpanKind
+	start  time.Time
+	end    time.Time
+	attrs  []attribute
+	errMsg string
+	failed bool
+	ended  bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start begins a span as a child of the span in ctx, or as the root of a new
+// trace, sampled at the configured ratio. It returns a context carrying the
+// new span.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kind, start: time.Now()}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = mathrand.Float64() < active.sampleRatio
+	}
+	rand.Read(span.spanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartServer begins the span of an incoming request. It continues the
+// caller's trace and sampling decision when traceparent is valid.
+func StartServer(ctx context.Context, traceparent, name string) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	if traceID, parentID, sampled, ok := parseTraceparent(traceparent); ok {
+		remote := &Span{traceID: traceID, spanID: parentID, sampled: sampled}
+		ctx = ContextWithSpan(ctx, remote)
+	}
+	return Start(ctx, name, KindServer)
+}
+
+// SetName renames the span, e.g. once the matched route is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute records a string, bool, int, int64 or float64 value.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attribute{key, value})
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export if it is sampled. Later
+// calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sampled {
+		active.enqueue(s)
+	}
+}
+
+// TraceID returns the hex trace ID, or "" for a nil span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Traceparent returns the W3C traceparent header value that makes a
+// downstream service continue the trace below this span.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", s.traceID, s.spanID, flags)
+}
+
+// parseTraceparent reads a version 00 traceparent header:
+// "00-<32 hex trace ID>-<16 hex parent ID>-<2 hex flags>".
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	// All-zero IDs are invalid
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
@@ -0,0 +1,181 @@
+// Package validation checks request structs against their validate tags.
+// It understands the part of the go-playground/validator tag syntax that the
+// request models use:
+//
+//	required    not empty; strings of only whitespace count as empty
+//	omitempty   skip the other rules when the value is empty
+//	email       a bare address such as user@example.com
+//	url         an absolute http or https URL
+//	min=N       at least N characters, N items, or a value of at least N
+//	max=N       at most N characters, N items, or a value of at most N
+//	len=N       exactly N characters or N items
+//	numeric     only the digits 0-9
+//	oneof=a b   one of the space-separated values
+//
+// Problems are reported per JSON field name in the wording of
+// models.ValidationErrorResponse, e.g. "is required".
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Struct checks the validate tags of v, a struct or a pointer to one, and
+// returns the first problem of every invalid field keyed by its JSON name.
+// Embedded structs are checked as part of v. An unknown rule panics, as it
+// is a mistake in the model rather than in the request.
+func Struct(v interface{}) map[string]string {
+	problems := map[string]string{}
+	checkStruct(reflect.Indirect(reflect.ValueOf(v)), problems)
+	return problems
+}
+
+func checkStruct(v reflect.Value, problems map[string]string) {
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %s is not a struct", v.Type()))
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			checkStruct(v.Field(i), problems)
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		if problem := check(v.Field(i), tag, t.Name()+"."+field.Name); problem != "" {
+			problems[jsonName(field)] = problem
+		}
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// check applies the rules of tag to value and returns the first problem.
+func check(value reflect.Value, tag, fieldName string) string {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+
+	empty := isEmpty(value)
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if empty {
+				return "is required"
+			}
+		case "omitempty":
+			if empty {
+				return ""
+			}
+		case "email":
+			if problem := checkEmail(value); problem != "" {
+				return problem
+			}
+		case "url":
+			if problem := checkURL(value); problem != "" {
+				return problem
+			}
+		case "min", "max", "len":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				panic(fmt.Sprintf("validation: %s=%q on %s is not a number", name, param, fieldName))
+			}
+			if problem := checkSize(value, name, n); problem != "" {
+				return problem
+			}
+		case "numeric":
+			if strings.Trim(value.String(), "0123456789") != "" {
+				return "must contain only digits"
+			}
+		case "oneof":
+			options := strings.Fields(param)
+			if !slices.Contains(options, fmt.Sprint(value.Interface())) {
+				return "must be one of " + strings.Join(options, ", ")
+			}
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %q on %s", rule, fieldName))
+		}
+	}
+	return ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func checkEmail(value reflect.Value) string {
+	s := strings.TrimSpace(value.String())
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "must be an email address"
+	}
+	return ""
+}
+
+func checkURL(value reflect.Value) string {
+	u, err := url.Parse(strings.TrimSpace(value.String()))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be an http or https URL"
+	}
+	return ""
+}
+
+// checkSize compares the length of strings (in characters) and collections,
+// or the value of numbers, with n.
+func checkSize(value reflect.Value, rule string, n int) string {
+	var size float64
+	verb, unit := "be", ""
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters long"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size, verb, unit = float64(value.Len()), "have", " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		return ""
+	}
+
+	limit := float64(n)
+	switch {
+	case rule == "min" && size < limit:
+		return fmt.Sprintf("must %s at least %d%s", verb, n, unit)
+	case rule == "max" && size > limit:
+		return fmt.Sprintf("must %s at most %d%s", verb, n, unit)
+	case rule == "len" && size != limit:
+		return fmt.Sprintf("must %s %d%s", verb, n, unit)
+	}
+	return ""
+}
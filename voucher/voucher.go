@@ -0,0 +1,70 @@
+// Package voucher issues the vouchers members collect redeemed rewards
+// with, e.g. a code from the partner that hands the reward over.
+package voucher
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"temp-backend-at-kbtg/outbox"
+)
+
+// ErrRefused is returned, possibly wrapped, when the issuer will not issue a
+// voucher for the request, so trying again is pointless.
+var ErrRefused = errors.New("voucher refused")
+
+// Request asks for a voucher for one redemption. Reference identifies the
+// redemption so the issuer returns the same voucher when asked again.
+type Request struct {
+	Reference string
+	RewardID  uint
+	UserID    uint
+}
+
+// Issuer issues vouchers. An empty code means the reward is collected with
+// the redemption code and needs no voucher of its own.
+type Issuer interface {
+	Issue(ctx context.Context, req Request) (string, error)
+}
+
+// Default is the issuer of the handlers unless they are given another.
+// No voucher provider is connected yet, so rewards are collected with their
+// redemption code, except in PROVIDERS_MODE=mock, where Init sends requests
+// to the outbox.
+var Default Issuer = CodeIssuer{}
+
+// Init sets Default to the outbox in PROVIDERS_MODE=mock.
+func Init() {
+	if outbox.MockMode() {
+		Default = OutboxIssuer{}
+	}
+}
+
+// CodeIssuer issues no vouchers: rewards are collected with the redemption
+// code.
+type CodeIssuer struct{}
+
+func (CodeIssuer) Issue(ctx context.Context, req Request) (string, error) {
+	return "", nil
+}
+
+// OutboxIssuer records requests in the mock provider outbox and issues a
+// random voucher code for each.
+type OutboxIssuer struct{}
+
+func (OutboxIssuer) Issue(ctx context.Context, req Request) (string, error) {
+	code := "VC" + rand.Text()[:10]
+	outbox.Record(outbox.Message{
+		Channel: outbox.ChannelVoucher,
+		To:      fmt.Sprintf("user:%d", req.UserID),
+		Subject: "Voucher",
+		Body:    code,
+		Metadata: map[string]string{
+			"reference": req.Reference,
+			"reward_id": fmt.Sprint(req.RewardID),
+		},
+	})
+	return code, nil
+}
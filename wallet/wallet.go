@@ -0,0 +1,193 @@
+// Package wallet keeps the stored-value wallets of members, separate from
+// their loyalty points. Money only moves in transactions whose entries, one
+// per account, add up to zero, so the balances of all accounts, the system
+// accounts included, always add up to zero as well. Balances are changed
+// only here, with every account of the transaction locked.
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInsufficientFunds is returned when a payment or transfer would take
+	// a member's balance below zero.
+	ErrInsufficientFunds = errors.New("insufficient wallet balance")
+	// ErrBalanceLimit is returned when a top-up or transfer would take a
+	// member's balance above wallet.max_balance.
+	ErrBalanceLimit = errors.New("wallet balance limit reached")
+	// ErrSameWallet is returned for transfers to oneself.
+	ErrSameWallet = errors.New("cannot transfer to the same wallet")
+)
+
+// maxBalance is the wallet.max_balance setting given to Init.
+var maxBalance int
+
+// Init sets the most a member's wallet can hold.
+func Init(cfg config.WalletConfig) {
+	maxBalance = cfg.MaxBalance
+}
+
+// leg is the change a transaction makes to one account, with the
+// description shown in that account's statement.
+type leg struct {
+	account     *models.WalletAccount
+	amount      int
+	description string
+}
+
+// Account returns the wallet of the member userID, opening an empty one if
+// they have none yet.
+func Account(tx *gorm.DB, userID uint) (*models.WalletAccount, error) {
+	account := models.WalletAccount{UserID: &userID, Currency: models.WalletCurrency}
+	err := tx.Where(models.WalletAccount{UserID: &userID}).FirstOrCreate(&account).Error
+	return &account, err
+}
+
+// system returns the system account code, creating it if needed.
+func system(tx *gorm.DB, code string) (*models.WalletAccount, error) {
+	account := models.WalletAccount{Code: code, Currency: models.WalletCurrency}
+	err := tx.Where(models.WalletAccount{Code: code}).FirstOrCreate(&account).Error
+	return &account, err
+}
+
+// TopUp credits txn.Amount to the wallet of userID from the funding account.
+// It should run once the gateway charge, txn.Reference, was paid. It returns
+// the recorded transaction and the member's account after it.
+func TopUp(tx *gorm.DB, userID uint, txn models.WalletTransaction) (*models.WalletTransaction, *models.WalletAccount, error) {
+	funding, err := system(tx, models.WalletAccountFunding)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, err := Account(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txn.Type = models.WalletTopUp
+	txn.InitiatorID = userID
+	if txn.Description == "" {
+		txn.Description = "Top-up"
+	}
+	err = post(tx, &txn, []leg{{account: funding, amount: -txn.Amount}, {account: member, amount: txn.Amount}})
+	return &txn, member, err
+}
+
+// Pay debits txn.Amount from the wallet of userID to the spending account.
+func Pay(tx *gorm.DB, userID uint, txn models.WalletTransaction) (*models.WalletTransaction, *models.WalletAccount, error) {
+	spending, err := system(tx, models.WalletAccountSpending)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, err := Account(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txn.Type = models.WalletPayment
+	txn.InitiatorID = userID
+	err = post(tx, &txn, []leg{{account: member, amount: -txn.Amount}, {account: spending, amount: txn.Amount}})
+	return &txn, member, err
+}
+
+// Transfer moves txn.Amount from the wallet of from to the wallet of to.
+// The statements of both name the other member; txn.Reference is set to the
+// recipient's membership ID.
+func Transfer(tx *gorm.DB, from, to *models.User, txn models.WalletTransaction) (*models.WalletTransaction, *models.WalletAccount, error) {
+	if from.ID == to.ID {
+		return nil, nil, ErrSameWallet
+	}
+	sender, err := Account(tx, from.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipient, err := Account(tx, to.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txn.Type = models.WalletTransfer
+	txn.InitiatorID = from.ID
+	txn.Reference = to.MembershipID
+	err = post(tx, &txn, []leg{
+		{account: sender, amount: -txn.Amount, description: transferDescription("Transfer to", to, txn.Description)},
+		{account: recipient, amount: txn.Amount, description: transferDescription("Transfer from", from, txn.Description)},
+	})
+	return &txn, sender, err
+}
+
+// transferDescription names the other member of a transfer in a statement,
+// followed by the note the sender gave, if any.
+func transferDescription(prefix string, other *models.User, note string) string {
+	description := prefix + " " + other.MembershipID
+	if note != "" {
+		description += ": " + note
+	}
+	return description
+}
+
+// post records txn with an entry per leg and applies the legs to the
+// balances. Member balances must stay between zero and wallet.max_balance;
+// system accounts have no limits. The accounts are locked in ID order so
+// concurrent transactions between the same accounts cannot deadlock, and
+// the accounts of legs are updated in place.
+func post(tx *gorm.DB, txn *models.WalletTransaction, legs []leg) error {
+	sum := 0
+	for i := range legs {
+		sum += legs[i].amount
+		if legs[i].description == "" {
+			legs[i].description = txn.Description
+		}
+	}
+	if txn.Amount <= 0 || sum != 0 {
+		return fmt.Errorf("wallet: unbalanced %s of %d", txn.Type, txn.Amount)
+	}
+
+	slices.SortFunc(legs, func(a, b leg) int { return int(a.account.ID) - int(b.account.ID) })
+	for _, l := range legs {
+		err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+			Select("balance").First(l.account, l.account.ID).Error
+		if err != nil {
+			return err
+		}
+		balance := l.account.Balance + l.amount
+		if l.account.UserID != nil {
+			if balance < 0 {
+				return ErrInsufficientFunds
+			}
+			if l.amount > 0 && maxBalance > 0 && balance > maxBalance {
+				return ErrBalanceLimit
+			}
+		}
+		l.account.Balance = balance
+	}
+
+	if err := tx.Create(txn).Error; err != nil {
+		return err
+	}
+	for _, l := range legs {
+		if err := tx.Model(&models.WalletAccount{}).Where("id = ?", l.account.ID).Update("balance", l.account.Balance).Error; err != nil {
+			return err
+		}
+		entry := models.WalletEntry{
+			TransactionID: txn.ID,
+			AccountID:     l.account.ID,
+			Type:          txn.Type,
+			Description:   l.description,
+			Amount:        l.amount,
+			BalanceAfter:  l.account.Balance,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package wallet_test
+
+import (
+	"errors"
+	"testing"
+
+	"temp-backend-at-kbtg/config"
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/testutil"
+	"temp-backend-at-kbtg/wallet"
+
+	"gorm.io/gorm"
+)
+
+// topUp credits amount to the wallet of user.
+func topUp(t *testing.T, db *gorm.DB, user models.User, amount int) {
+	t.Helper()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, _, err := wallet.TopUp(tx, user.ID, models.WalletTransaction{Amount: amount, Reference: "mock_1"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("top up %d: %v", amount, err)
+	}
+}
+
+// balances returns the balance of the wallet of each user and checks that
+// all accounts, the system ones included, add up to zero.
+func balances(t *testing.T, db *gorm.DB, users ...models.User) []int {
+	t.Helper()
+	var total int
+	db.Model(&models.WalletAccount{}).Select("COALESCE(SUM(balance), 0)").Scan(&total)
+	if total != 0 {
+		t.Errorf("accounts add up to %d, want 0", total)
+	}
+	var entries int
+	db.Model(&models.WalletEntry{}).Select("COALESCE(SUM(amount), 0)").Scan(&entries)
+	if entries != 0 {
+		t.Errorf("entries add up to %d, want 0", entries)
+	}
+
+	var out []int
+	for _, user := range users {
+		var account models.WalletAccount
+		if err := db.Where("user_id = ?", user.ID).Limit(1).Find(&account).Error; err != nil {
+			t.Fatalf("load wallet: %v", err)
+		}
+		out = append(out, account.Balance)
+	}
+	return out
+}
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBalance int
+		sender     int
+		recipient  int
+		amount     int
+		self       bool
+		wantErr    error
+		invalid    bool
+		want       [2]int
+	}{
+		{name: "transfer", sender: 50000, amount: 15000, want: [2]int{35000, 15000}},
+		{name: "whole balance", sender: 50000, recipient: 100, amount: 50000, want: [2]int{0, 50100}},
+		{name: "insufficient funds", sender: 10000, amount: 10001, wantErr: wallet.ErrInsufficientFunds, want: [2]int{10000, 0}},
+		{name: "empty wallet", amount: 100, wantErr: wallet.ErrInsufficientFunds, want: [2]int{0, 0}},
+		{name: "up to the limit", maxBalance: 100000, sender: 50000, recipient: 60000, amount: 40000, want: [2]int{10000, 100000}},
+		{name: "over the limit", maxBalance: 100000, sender: 50000, recipient: 60000, amount: 40001, wantErr: wallet.ErrBalanceLimit, want: [2]int{50000, 60000}},
+		{name: "to oneself", sender: 50000, amount: 100, self: true, wantErr: wallet.ErrSameWallet, want: [2]int{50000, 0}},
+		{name: "zero amount", sender: 50000, amount: 0, invalid: true, want: [2]int{50000, 0}},
+		{name: "negative amount", sender: 50000, amount: -100, invalid: true, want: [2]int{50000, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewDB(t)
+			from := testutil.CreateUser(t, db)
+			to := testutil.CreateUser(t, db)
+			wallet.Init(config.WalletConfig{})
+			if tt.sender > 0 {
+				topUp(t, db, from, tt.sender)
+			}
+			if tt.recipient > 0 {
+				topUp(t, db, to, tt.recipient)
+			}
+			wallet.Init(config.WalletConfig{MaxBalance: tt.maxBalance})
+			recipient := to
+			if tt.self {
+				recipient = from
+			}
+
+			var txn *models.WalletTransaction
+			var account *models.WalletAccount
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				txn, account, err = wallet.Transfer(tx, &from, &recipient, models.WalletTransaction{Amount: tt.amount, Description: "Dinner"})
+				return err
+			})
+			if got := balances(t, db, from, to); [2]int(got) != tt.want {
+				t.Errorf("balances %v, want %v", got, tt.want)
+			}
+			if tt.wantErr != nil || tt.invalid {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("transfer: error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+
+			if txn.Type != models.WalletTransfer || txn.Reference != to.MembershipID || txn.InitiatorID != from.ID {
+				t.Errorf("transaction %+v", txn)
+			}
+			if account.Balance != tt.want[0] {
+				t.Errorf("returned balance %d, want %d", account.Balance, tt.want[0])
+			}
+			var entries []models.WalletEntry
+			db.Where("transaction_id = ?", txn.ID).Order("amount").Find(&entries)
+			wantEntries := []struct {
+				amount      int
+				balance     int
+				description string
+			}{
+				{-tt.amount, tt.want[0], "Transfer to " + to.MembershipID + ": Dinner"},
+				{tt.amount, tt.want[1], "Transfer from " + from.MembershipID + ": Dinner"},
+			}
+			if len(entries) != len(wantEntries) {
+				t.Fatalf("%d entries, want %d", len(entries), len(wantEntries))
+			}
+			for i, want := range wantEntries {
+				if entries[i].Amount != want.amount || entries[i].BalanceAfter != want.balance || entries[i].Description != want.description {
+					t.Errorf("entry %+v, want %d to %d, %q", entries[i], want.amount, want.balance, want.description)
+				}
+			}
+		})
+	}
+}
+
+func TestTopUpAndPay(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBalance int
+		topUps     []int
+		pay        int
+		wantErr    error
+		balance    int
+	}{
+		{name: "top up", topUps: []int{50000, 25000}, balance: 75000},
+		{name: "pay", topUps: []int{50000}, pay: 12000, balance: 38000},
+		{name: "pay everything", topUps: []int{50000}, pay: 50000, balance: 0},
+		{name: "pay too much", topUps: []int{50000}, pay: 50001, wantErr: wallet.ErrInsufficientFunds, balance: 50000},
+		{name: "top up over the limit", maxBalance: 60000, topUps: []int{50000, 10001}, wantErr: wallet.ErrBalanceLimit, balance: 50000},
+		{name: "pay at the limit", maxBalance: 60000, topUps: []int{60000}, pay: 1000, balance: 59000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewDB(t)
+			user := testutil.CreateUser(t, db)
+			wallet.Init(config.WalletConfig{MaxBalance: tt.maxBalance})
+
+			var err error
+			for _, amount := range tt.topUps {
+				err = db.Transaction(func(tx *gorm.DB) error {
+					_, _, err := wallet.TopUp(tx, user.ID, models.WalletTransaction{Amount: amount, Reference: "mock_1"})
+					return err
+				})
+			}
+			if tt.pay > 0 {
+				err = db.Transaction(func(tx *gorm.DB) error {
+					_, _, err := wallet.Pay(tx, user.ID, models.WalletTransaction{Amount: tt.pay, Description: "Coffee"})
+					return err
+				})
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+			if got := balances(t, db, user); got[0] != tt.balance {
+				t.Errorf("balance %d, want %d", got[0], tt.balance)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Package webhook posts events to the endpoints integrators register under
+// /admin/webhooks. Enqueue records one delivery per subscribed endpoint in
+// the transaction of the change, so changes that roll back send nothing;
+// the worker of Start posts the deliveries, signed with the endpoint's
+// secret, and retries failures with exponential backoff.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+	"temp-backend-at-kbtg/requestid"
+	"temp-backend-at-kbtg/retry"
+	"temp-backend-at-kbtg/tracing"
+	"temp-backend-at-kbtg/worker"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it is failed,
+	// about four hours after the event.
+	MaxAttempts = 10
+	// pollInterval is how often the worker looks for due deliveries, and
+	// batchSize how many it takes at a time.
+	pollInterval = 5 * time.Second
+	batchSize    = 50
+	// claimTimeout is how long a delivery being attempted is left alone by
+	// other instances; it outlasts the request timeout.
+	claimTimeout   = time.Minute
+	requestTimeout = 10 * time.Second
+)
+
+// backoff is the delay after a failed attempt: 30 seconds after the first,
+// doubling with every further failure up to 6 hours.
+var backoff = retry.Backoff{Delay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+
+var client = &http.Client{
+	Timeout:   requestTimeout,
+	Transport: requestid.Transport(tracing.Transport(nil)),
+	// A redirect is a failed delivery; the endpoint's URL should be fixed
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Enqueue records a delivery of event, marshalled as payload, to every
+// active endpoint subscribed to it. events.Publish calls it in the
+// transaction of the change the event reports.
+func Enqueue(tx *gorm.DB, event models.Event, payload []byte) error {
+	var endpoints []models.WebhookEndpoint
+	if err := tx.Where("active = ?", true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, endpoint := range endpoints {
+		if slices.Contains(endpoint.Events, event.Event) {
+			deliveries = append(deliveries, models.WebhookDelivery{
+				EndpointID:    endpoint.ID,
+				EventID:       event.ID,
+				Event:         event.Event,
+				Payload:       string(payload),
+				Status:        models.WebhookDeliveryPending,
+				NextAttemptAt: &now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+// Redeliver queues delivery to be sent again at once, whatever its status.
+// A failed delivery gets one more attempt.
+func Redeliver(tx *gorm.DB, delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.NextAttemptAt = &now
+	delivery.Attempts = min(delivery.Attempts, MaxAttempts-1)
+	return tx.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"next_attempt_at": now,
+		"attempts":        delivery.Attempts,
+	}).Error
+}
+
+// Sign returns the X-Webhook-Signature of body sent at timestamp: sha256=
+// and the hex HMAC-SHA256 of the timestamp, a dot and the body under the
+// endpoint's secret. Receivers compute the same to check that the request
+// came from us, and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start posts due deliveries in the background until shutdown.
+func Start(db *gorm.DB) {
+	worker.Go("webhook delivery", func(ctx context.Context) {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deliverDue(ctx, db)
+			}
+		}
+	})
+}
+
+// deliverDue attempts the pending deliveries that are due, oldest first,
+// until ctx is cancelled. Deliveries of inactive endpoints wait until the
+// endpoint is activated again.
+func deliverDue(ctx context.Context, db *gorm.DB) {
+	var due []models.WebhookDelivery
+	err := db.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+		Where("endpoint_id IN (?)", db.Model(&models.WebhookEndpoint{}).Select("id").Where("active = ?", true)).
+		Order("next_attempt_at").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		log.Printf("[webhook] loading due deliveries failed: %v", err)
+		return
+	}
+
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := deliver(db, &due[i]); err != nil {
+			log.Printf("[webhook] delivery %d not recorded: %v", due[i].ID, err)
+		}
+	}
+}
+
+// deliver claims delivery, posts it and records the outcome. A delivery
+// another instance claimed first is skipped.
+func deliver(db *gorm.DB, delivery *models.WebhookDelivery) error {
+	claim := db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", delivery.ID, models.WebhookDeliveryPending, delivery.Attempts).
+		Updates(map[string]interface{}{
+			"attempts":        delivery.Attempts + 1,
+			"next_attempt_at": time.Now().Add(claimTimeout),
+		})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+	delivery.Attempts++
+
+	var endpoint models.WebhookEndpoint
+	if err := db.First(&endpoint, delivery.EndpointID).Error; err != nil {
+		return err
+	}
+
+	status, err := post(endpoint, delivery)
+	now := time.Now()
+	updates := map[string]interface{}{"response_status": status, "last_error": ""}
+	switch {
+	case err == nil:
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case delivery.Attempts >= MaxAttempts:
+		log.Printf("[webhook] %s %s to endpoint %d failed after %d attempts: %v", delivery.Event, delivery.EventID, endpoint.ID, delivery.Attempts, err)
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["last_error"] = retry.Error(err)
+		updates["next_attempt_at"] = nil
+	default:
+		updates["last_error"] = retry.Error(err)
+		updates["next_attempt_at"] = now.Add(backoff.After(delivery.Attempts))
+	}
+	return db.Model(delivery).Updates(updates).Error
+}
+
+// post sends delivery to endpoint and returns the response status. Any
+// status but 2xx is an error.
+func post(endpoint models.WebhookEndpoint, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
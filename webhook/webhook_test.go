@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"temp-backend-at-kbtg/models"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"points.earned"}`)
+	// HMAC-SHA256 of "1700000000." and the body under "whsec_test"
+	const want = "sha256=b0d8b6ce89e09b5dffd27ffe146e7ce439d372e3387bb5ed4965971d7042485a"
+	if got := Sign("whsec_test", 1700000000, body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+
+	// Changing the secret, the timestamp or a byte of the body changes the
+	// signature, so none can be forged or replayed with a new timestamp
+	for name, got := range map[string]string{
+		"other secret":    Sign("whsec_other", 1700000000, body),
+		"other timestamp": Sign("whsec_test", 1700000001, body),
+		"other body":      Sign("whsec_test", 1700000000, []byte(`{"event":"points.earneD"}`)),
+	} {
+		if got == want {
+			t.Errorf("%s: same signature", name)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   string
+	}
+	requests := make(chan received, 1)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: string(body)}
+		if status == http.StatusFound {
+			http.Redirect(w, r, "/elsewhere", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint := models.WebhookEndpoint{URL: server.URL, Secret: "whsec_test"}
+	delivery := &models.WebhookDelivery{EventID: "evt_1", Event: "points.earned", Payload: `{"event":"points.earned","amount":100}`}
+
+	got, err := post(endpoint, delivery)
+	if err != nil || got != http.StatusOK {
+		t.Fatalf("post = %d, %v", got, err)
+	}
+	req := <-requests
+	if req.body != delivery.Payload {
+		t.Errorf("body %s, want %s", req.body, delivery.Payload)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":    "application/json",
+		"X-Webhook-ID":    "evt_1",
+		"X-Webhook-Event": "points.earned",
+	} {
+		if got := req.header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// The receiver checks the signature as the documentation tells it to
+	timestamp, err := strconv.ParseInt(req.header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Fatalf("timestamp %q", req.header.Get("X-Webhook-Timestamp"))
+	}
+	signature := req.header.Get("X-Webhook-Signature")
+	if signature != Sign("whsec_test", timestamp, []byte(req.body)) {
+		t.Errorf("signature %s does not verify", signature)
+	}
+	if signature == Sign("whsec_other", timestamp, []byte(req.body)) {
+		t.Error("signature verifies with another secret")
+	}
+
+	for _, status = range []int{http.StatusInternalServerError, http.StatusFound} {
+		got, err := post(endpoint, delivery)
+		<-requests
+		if err == nil || got != status {
+			t.Errorf("answer %d: post = %d, %v, want an error", status, got, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), strconv.Itoa(status)) {
+			t.Errorf("answer %d: error %v does not name the status", status, err)
+		}
+	}
+}
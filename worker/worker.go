@@ -0,0 +1,72 @@
+// Package worker runs background jobs that have to finish before the server
+// exits, such as backups and periodic cleanups.
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+var (
+	mu      sync.Mutex
+	jobs    sync.WaitGroup
+	running = map[string]int{}
+
+	ctx, cancel = context.WithCancel(context.Background())
+)
+
+// Go runs fn in the background. Its context is cancelled when the server
+// shuts down; loops should return then, while one-off jobs may just finish
+// their work. Shutdown waits for fn to return. Jobs are not started once
+// shutdown has begun.
+func Go(name string, fn func(ctx context.Context)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ctx.Err() != nil {
+		log.Printf("[worker] %s not started: shutting down", name)
+		return
+	}
+	jobs.Add(1)
+	running[name]++
+	go func() {
+		defer func() {
+			mu.Lock()
+			running[name]--
+			if running[name] == 0 {
+				delete(running, name)
+			}
+			mu.Unlock()
+			jobs.Done()
+		}()
+		fn(ctx)
+	}()
+}
+
+// Shutdown cancels the jobs' context and waits until they have all returned
+// or until shutdownCtx is done, in which case it logs the jobs still running
+// and returns the context's error.
+func Shutdown(shutdownCtx context.Context) error {
+	mu.Lock()
+	cancel()
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-shutdownCtx.Done():
+		mu.Lock()
+		defer mu.Unlock()
+		for name, n := range running {
+			log.Printf("[worker] %s still running (%d) at shutdown", name, n)
+		}
+		return shutdownCtx.Err()
+	}
+}
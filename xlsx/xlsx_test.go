@@ -0,0 +1,141 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumn(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := column(tt.index); got != tt.want {
+			t.Errorf("column(%d) = %s, want %s", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells []interface{}
+		want  string
+	}{
+		{name: "int", cells: []interface{}{-120}, want: `<c r="A1"><v>-120</v></c>`},
+		{name: "int64", cells: []interface{}{int64(1) << 40}, want: `<c r="A1"><v>1099511627776</v></c>`},
+		{name: "uint", cells: []interface{}{uint(7)}, want: `<c r="A1"><v>7</v></c>`},
+		{name: "midnight", cells: []interface{}{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, want: `<c r="A1" s="1"><v>45292</v></c>`},
+		{name: "noon in Bangkok", cells: []interface{}{time.Date(2024, 1, 1, 19, 0, 0, 0, time.FixedZone("ICT", 7*3600))}, want: `<c r="A1" s="1"><v>45292.5</v></c>`},
+		{name: "string", cells: []interface{}{"Coffee & <cake>"}, want: `<c r="A1" t="inlineStr"><is><t xml:space="preserve">Coffee &amp; &lt;cake&gt;</t></is></c>`},
+		{name: "control character", cells: []interface{}{"a\x01b"}, want: "<t xml:space=\"preserve\">a\uFFFDb</t>"},
+		{name: "nil leaves a gap", cells: []interface{}{"a", nil, 3}, want: `<c r="A1" t="inlineStr"><is><t xml:space="preserve">a</t></is></c><c r="C1"><v>3</v></c></row>`},
+		{name: "other types as text", cells: []interface{}{1.5}, want: `<c r="A1" t="inlineStr"><is><t xml:space="preserve">1.5</t></is></c>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, "Points")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRow(tt.cells...); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			sheet := readPart(t, buf.Bytes(), "xl/worksheets/sheet1.xml")
+			if !strings.Contains(sheet, tt.want) {
+				t.Errorf("sheet %s does not contain %s", sheet, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, `Points "2024"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WriteRow("row", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := w.WriteRow("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteRow after Close: %v, want ErrClosed", err)
+	}
+
+	tests := []struct {
+		part string
+		want string
+	}{
+		{"[Content_Types].xml", `PartName="/xl/worksheets/sheet1.xml"`},
+		{"_rels/.rels", `Target="xl/workbook.xml"`},
+		{"xl/_rels/workbook.xml.rels", `Target="styles.xml"`},
+		{"xl/styles.xml", `formatCode="yyyy-mm-dd hh:mm:ss"`},
+		{"xl/workbook.xml", `<sheet name="Points &#34;2024&#34;" sheetId="1" r:id="rId1"/>`},
+		{"xl/worksheets/sheet1.xml", `<row r="3">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.part, func(t *testing.T) {
+			content := readPart(t, buf.Bytes(), tt.part)
+			if !strings.Contains(content, tt.want) {
+				t.Errorf("%s does not contain %s", content, tt.want)
+			}
+			decoder := xml.NewDecoder(strings.NewReader(content))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("not well-formed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// readPart returns the content of the part called name of the workbook in
+// data.
+func readPart(t *testing.T, data []byte, name string) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(content)
+}